@@ -0,0 +1,377 @@
+// Package alerts watches heatsinks for thermal events, such as a heatsink reaching its critical
+// temperature or a fan that stalls, and passes every event to the registered alerters when it
+// is raised and when it is resolved. Alerters deliver events to wherever they are needed, e.g.
+// to a webhook, by email, or to an MQTT broker, and applications may implement their own
+package alerts
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/malkhamis/heatsink"
+	"go.uber.org/zap"
+)
+
+// hysteresis is how far below the threshold the temperature must drop before a threshold event
+// is resolved, so that a temperature hovering around it is not noisy
+const hysteresis = 3.0
+
+// EventType identifies what happened to a heatsink
+type EventType string
+
+// Types of events that are watched for
+const (
+	// CriticalTemperature is raised when a heatsink reaches its critical temperature
+	CriticalTemperature EventType = "critical_temperature"
+	// TemperatureThreshold is raised when a heatsink rises above the threshold given with
+	// OptTemperatureThreshold
+	TemperatureThreshold EventType = "temperature_threshold"
+	// FanStall is raised when a fan reports no speed while it is driven at the duty cycle given
+	// with OptStallDutyCycle or more
+	FanStall EventType = "fan_stall"
+	// SensorFailure is raised when a sensor of a heatsink fails to read
+	SensorFailure EventType = "sensor_failure"
+	// SensorQuarantined is raised when a heatsink leaves out the readings of a misbehaving
+	// sensor, see heatsink.OptSensorQuarantine
+	SensorQuarantined EventType = "sensor_quarantined"
+	// ControllerStopped is raised when thermal control of a heatsink stops
+	ControllerStopped EventType = "controller_stopped"
+)
+
+var summaries = map[EventType]string{
+	CriticalTemperature:  "Critical temperature",
+	TemperatureThreshold: "High temperature",
+	FanStall:             "Fan stalled",
+	SensorFailure:        "Sensor failure",
+	SensorQuarantined:    "Sensor quarantined",
+	ControllerStopped:    "Thermal control stopped",
+}
+
+// Severity tells how urgently an event needs attention
+type Severity int
+
+// Severities of events. Resolved events are informational
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityCritical
+)
+
+var severities = map[EventType]Severity{
+	CriticalTemperature:  SeverityCritical,
+	TemperatureThreshold: SeverityWarning,
+	FanStall:             SeverityCritical,
+	SensorFailure:        SeverityWarning,
+	SensorQuarantined:    SeverityWarning,
+	ControllerStopped:    SeverityCritical,
+}
+
+// String returns the name of the severity, e.g. "warning"
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityCritical:
+		return "critical"
+	}
+	return fmt.Sprintf("severity(%d)", int(s))
+}
+
+// MarshalText encodes the severity by its name
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes a severity from its name
+func (s *Severity) UnmarshalText(text []byte) error {
+	for _, severity := range []Severity{SeverityInfo, SeverityWarning, SeverityCritical} {
+		if string(text) == severity.String() {
+			*s = severity
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown severity '%s'", text)
+}
+
+// Event is a thermal event of a heatsink that was raised or resolved
+type Event struct {
+	Type     EventType `json:"event"`
+	Severity Severity  `json:"severity"`
+	Resolved bool      `json:"resolved"`
+	Heatsink string    `json:"heatsink"`
+	// Subject is the sensor of a sensor event, the fan of a fan stall, or the hottest sensor
+	// of a temperature event
+	Subject     string    `json:"subject,omitempty"`
+	Temperature float64   `json:"temperature"`
+	Message     string    `json:"message"`
+	Time        time.Time `json:"time"`
+}
+
+// Summary returns a short title of the event, e.g. "Fan stalled resolved"
+func (e Event) Summary() string {
+	summary, ok := summaries[e.Type]
+	if !ok {
+		summary = string(e.Type)
+	}
+	if e.Resolved {
+		summary += " resolved"
+	}
+	return summary
+}
+
+// Alerter delivers events. Alerters are called one after the other by a dedicated goroutine, so
+// they may block for a while, e.g. to retry, but a slow alerter delays the others and events
+// are dropped if they fall too far behind
+type Alerter interface {
+	// Alert delivers the given event
+	Alert(e Event) error
+	// Name identifies the alerter in logs
+	Name() string
+}
+
+// Target is a heatsink to watch
+type Target struct {
+	Heatsink *heatsink.Heatsink
+	// Fan names the fan of the heatsink in fan stall events
+	Fan string
+	// FanSpeed returns the speed of the fan in rpm. If it is nil, fan stalls are not detected
+	FanSpeed func() (rpm int, err error)
+}
+
+// target is a Target along with the events it raised
+type target struct {
+	Target
+	critical bool
+	hot      bool
+	stalled  bool
+	stopped  bool
+	failed   map[string]bool
+	isolated map[string]bool
+}
+
+// Watcher checks heatsinks periodically and passes an event to every alerter whenever one is
+// raised or resolved. Instances of this type are safe for concurrent use
+type Watcher struct {
+	targets      []*target
+	threshold    float64
+	hasThreshold bool
+	stallDC      float64
+	interval     time.Duration
+	queueSize    int
+	logger       *zap.Logger
+
+	mutex    sync.Mutex
+	alerters []Alerter
+}
+
+// New returns a watcher of the given heatsinks, which starts checking them once it is started.
+// For details about options and defaults, see the documentation for type 'Option'
+func New(targets []Target, options ...Option) *Watcher {
+
+	w := &Watcher{
+		stallDC:   0.3,
+		interval:  5 * time.Second,
+		queueSize: 64,
+		logger:    zap.NewNop(),
+	}
+	for _, t := range targets {
+		w.targets = append(w.targets, &target{Target: t, failed: make(map[string]bool), isolated: make(map[string]bool)})
+	}
+	for _, applyOption := range options {
+		applyOption(w)
+	}
+	return w
+}
+
+// Register adds an alerter that receives every event from now on
+func (w *Watcher) Register(a Alerter) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.alerters = append(w.alerters, a)
+}
+
+// Alerters returns the registered alerters
+func (w *Watcher) Alerters() []Alerter {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return append([]Alerter(nil), w.alerters...)
+}
+
+// check compares the state of every heatsink to the one of the previous check and returns the
+// events that were raised or resolved since then
+func (w *Watcher) check(now time.Time) []Event {
+
+	var events []Event
+	for _, t := range w.targets {
+		name := t.Heatsink.Name()
+		smpl := t.Heatsink.LastSample()
+		raise := func(typ EventType, subject string, resolved bool, format string, args ...interface{}) {
+			severity := severities[typ]
+			if resolved {
+				severity = SeverityInfo
+			}
+			events = append(events, Event{
+				Type:        typ,
+				Severity:    severity,
+				Resolved:    resolved,
+				Heatsink:    name,
+				Subject:     subject,
+				Temperature: smpl.Temperature,
+				Message:     fmt.Sprintf(format, args...),
+				Time:        now,
+			})
+		}
+
+		if t.Heatsink.Stopped() {
+			if !t.stopped {
+				t.stopped = true
+				raise(ControllerStopped, "", false, "thermal control of %s stopped", name)
+			}
+			continue
+		}
+		if smpl.Time.IsZero() {
+			continue
+		}
+
+		if smpl.Critical != t.critical {
+			t.critical = smpl.Critical
+			if t.critical {
+				raise(CriticalTemperature, smpl.Sensor, false, "%s reached its critical temperature: %.1f°C", name, smpl.Temperature)
+			} else {
+				raise(CriticalTemperature, smpl.Sensor, true, "%s is below its critical temperature: %.1f°C", name, smpl.Temperature)
+			}
+		}
+
+		if w.hasThreshold {
+			hot := smpl.Temperature > w.threshold || (t.hot && smpl.Temperature > w.threshold-hysteresis)
+			if hot != t.hot {
+				t.hot = hot
+				if hot {
+					raise(TemperatureThreshold, smpl.Sensor, false, "%s is above %.1f°C: %.1f°C", name, w.threshold, smpl.Temperature)
+				} else {
+					raise(TemperatureThreshold, smpl.Sensor, true, "%s cooled down to %.1f°C", name, smpl.Temperature)
+				}
+			}
+		}
+
+		read := make(map[string]bool)
+		for _, r := range smpl.Readings {
+			read[r.Sensor] = true
+		}
+		quarantined := make(map[string]bool)
+		for _, sensor := range smpl.Quarantined {
+			quarantined[sensor] = true
+		}
+		for _, sensor := range t.Heatsink.SensorNames() {
+			if isolated := quarantined[sensor]; isolated != t.isolated[sensor] {
+				t.isolated[sensor] = isolated
+				if isolated {
+					raise(SensorQuarantined, sensor, false, "sensor %s of %s is quarantined for implausible readings", sensor, name)
+				} else {
+					raise(SensorQuarantined, sensor, true, "sensor %s of %s was readmitted", sensor, name)
+				}
+			}
+			// the readings of quarantined sensors are left out, which is not a failure by itself
+			if failed := !read[sensor] && !quarantined[sensor]; failed != t.failed[sensor] {
+				t.failed[sensor] = failed
+				if failed {
+					raise(SensorFailure, sensor, false, "sensor %s of %s failed to read", sensor, name)
+				} else {
+					raise(SensorFailure, sensor, true, "sensor %s of %s reads again", sensor, name)
+				}
+			}
+		}
+
+		if t.FanSpeed != nil {
+			rpm, err := t.FanSpeed()
+			if err != nil {
+				w.logger.Warn("reading fan speed", zap.Error(err), zap.String("heatsink", name))
+				continue
+			}
+			if stalled := rpm <= 0 && smpl.DutyCycle >= w.stallDC; stalled != t.stalled {
+				t.stalled = stalled
+				if stalled {
+					raise(FanStall, t.Fan, false, "fan %s of %s stalled at %.0f%% duty cycle", t.Fan, name, 100*smpl.DutyCycle)
+				} else {
+					raise(FanStall, t.Fan, true, "fan %s of %s spins again at %d rpm", t.Fan, name, rpm)
+				}
+			}
+		}
+	}
+	return events
+}
+
+// deliver passes the given event to every alerter and logs failures
+func (w *Watcher) deliver(e Event) {
+	for _, a := range w.Alerters() {
+		if err := a.Alert(e); err != nil {
+			w.logger.Warn(
+				"failed to deliver alert",
+				zap.Error(err), zap.String("alerter", a.Name()), zap.String("event", string(e.Type)),
+			)
+		}
+	}
+}
+
+// Start checks the heatsinks periodically and delivers events in the background, so that slow
+// alerters do not delay checks. Every event is logged as a warning, or as info if it was
+// resolved. The returned function stops checking and waits for queued events to be delivered
+func (w *Watcher) Start() (stop func()) {
+
+	queue := make(chan Event, w.queueSize)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for e := range queue {
+			w.deliver(e)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		defer close(queue)
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				for _, e := range w.check(now) {
+					w.log(e)
+					select {
+					case queue <- e:
+					default:
+						w.logger.Warn("dropping alert, alerters are falling behind", zap.String("event", string(e.Type)))
+					}
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// log logs the given event as a warning, or as info if it was resolved
+func (w *Watcher) log(e Event) {
+	log := w.logger.Warn
+	if e.Resolved {
+		log = w.logger.Info
+	}
+	log(
+		e.Message,
+		zap.String("event", string(e.Type)),
+		zap.Stringer("severity", e.Severity),
+		zap.Bool("resolved", e.Resolved),
+		zap.String("heatsink", e.Heatsink),
+		zap.String("subject", e.Subject),
+		zap.Float64("temperature", e.Temperature),
+	)
+}
@@ -0,0 +1,345 @@
+package alerts
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/malkhamis/heatsink"
+	"github.com/malkhamis/heatsink/heatsinktest"
+)
+
+// testSensor is a thermal sensor whose reading can be changed while it is in use
+type testSensor struct {
+	name  string
+	mutex sync.Mutex
+	temp  float64
+	err   error
+}
+
+func (s *testSensor) set(temp float64, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.temp, s.err = temp, err
+}
+
+func (s *testSensor) Temperature() (float64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.temp, s.err
+}
+
+func (s *testSensor) Name() string {
+	return s.name
+}
+
+func (s *testSensor) Close() error {
+	return nil
+}
+
+// testAlerter sends the events it receives to a channel
+type testAlerter struct {
+	events chan Event
+	err    error
+}
+
+func (a *testAlerter) Alert(e Event) error {
+	a.events <- e
+	return a.err
+}
+
+func (a *testAlerter) Name() string {
+	return "test"
+}
+
+// waitForSample blocks until the given heatsink records a sample of an iteration that started
+// after the given time
+func waitForSample(t *testing.T, hs *heatsink.Heatsink, after time.Time) {
+	t.Helper()
+	for deadline := time.After(time.Second); !hs.LastSample().Timings.Start.After(after); {
+		select {
+		case <-deadline:
+			t.Fatal("timeout waiting for a control iteration")
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func TestSeverity(t *testing.T) {
+
+	testCases := []struct {
+		severity Severity
+		expected string
+	}{
+		{SeverityInfo, "info"},
+		{SeverityWarning, "warning"},
+		{SeverityCritical, "critical"},
+		{Severity(7), "severity(7)"},
+	}
+	for _, tc := range testCases {
+		if actual := tc.severity.String(); actual != tc.expected {
+			t.Errorf("unexpected name\nwant: %s\n got: %s", tc.expected, actual)
+		}
+	}
+}
+
+func TestEvent_json(t *testing.T) {
+
+	e := Event{
+		Type:        FanStall,
+		Severity:    SeverityCritical,
+		Heatsink:    "cpu",
+		Subject:     "cpu_fan",
+		Temperature: 61.5,
+		Message:     "fan cpu_fan of cpu stalled at 60% duty cycle",
+		Time:        time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"event":"fan_stall","severity":"critical","resolved":false,"heatsink":"cpu",` +
+		`"subject":"cpu_fan","temperature":61.5,"message":"fan cpu_fan of cpu stalled at 60% duty cycle",` +
+		`"time":"2021-01-02T03:04:05Z"}`
+	if string(data) != expected {
+		t.Fatalf("unexpected json\nwant: %s\n got: %s", expected, data)
+	}
+
+	var decoded Event
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(decoded, e); diff != nil {
+		t.Fatal(diff)
+	}
+	if err := json.Unmarshal([]byte(`{"severity":"dire"}`), &decoded); err == nil {
+		t.Fatal("expected an error decoding an unknown severity")
+	}
+}
+
+func TestEvent_Summary(t *testing.T) {
+
+	testCases := []struct {
+		event    Event
+		expected string
+	}{
+		{Event{Type: CriticalTemperature}, "Critical temperature"},
+		{Event{Type: SensorFailure, Resolved: true}, "Sensor failure resolved"},
+		{Event{Type: "custom"}, "custom"},
+	}
+	for _, tc := range testCases {
+		if actual := tc.event.Summary(); actual != tc.expected {
+			t.Errorf("unexpected summary\nwant: %s\n got: %s", tc.expected, actual)
+		}
+	}
+}
+
+func TestNew_options(t *testing.T) {
+
+	alerter := &testAlerter{}
+	w := New(
+		nil,
+		OptInterval(time.Second),
+		OptTemperatureThreshold(80),
+		OptStallDutyCycle(0.5),
+		OptQueueSize(8),
+		OptLogger(nil),
+		OptAlerter(alerter),
+		OptAlerter(nil),
+	)
+	if w.interval != time.Second || w.threshold != 80 || !w.hasThreshold || w.stallDC != 0.5 || w.queueSize != 8 || w.logger == nil {
+		t.Errorf("unexpected watcher: %+v", w)
+	}
+
+	w = New(nil, OptInterval(0), OptQueueSize(-1))
+	if w.interval != 5*time.Second || w.queueSize != 64 || w.hasThreshold || w.stallDC != 0.3 {
+		t.Errorf("expected defaults, got: %+v", w)
+	}
+
+	w.Register(alerter)
+	if diff := deep.Equal(w.Alerters(), []Alerter{alerter}); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestWatcher_check(t *testing.T) {
+
+	cpu := &testSensor{name: "cpu", temp: 40}
+	gpu := &testSensor{name: "gpu", temp: 35}
+	hs, err := heatsink.New(
+		&heatsink.Config{
+			Fan:            &heatsinktest.FakeFanDriver{},
+			Sensors:        []heatsink.ThermoSensor{cpu, gpu},
+			MinTemperature: 30,
+			MaxTemperature: 50,
+		},
+		heatsink.OptName("case"),
+		heatsink.OptTemperatureCheckPeriod(5*time.Millisecond),
+		heatsink.OptCriticalTemperature(60),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mutex sync.Mutex
+	rpm := 0
+	setRPM := func(value int) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		rpm = value
+	}
+	fanSpeed := func() (int, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return rpm, nil
+	}
+	w := New(
+		[]Target{{Heatsink: hs, Fan: "case_fan", FanSpeed: fanSpeed}},
+		OptTemperatureThreshold(45),
+		OptStallDutyCycle(0.05),
+	)
+
+	type event struct {
+		Type     EventType
+		Severity Severity
+		Resolved bool
+		Subject  string
+	}
+	checkEvents := func(expected []event) {
+		t.Helper()
+		var actual []event
+		for _, e := range w.check(time.Now()) {
+			if e.Heatsink != "case" || e.Message == "" {
+				t.Errorf("unexpected event: %+v", e)
+			}
+			actual = append(actual, event{Type: e.Type, Severity: e.Severity, Resolved: e.Resolved, Subject: e.Subject})
+		}
+		if diff := deep.Equal(actual, expected); diff != nil {
+			t.Fatal(diff)
+		}
+	}
+
+	// nothing is raised before the first control iteration
+	checkEvents(nil)
+
+	go hs.StartThermalControl()
+	defer hs.StopThermalControl()
+	waitForSample(t, hs, time.Time{})
+	checkEvents([]event{{Type: FanStall, Severity: SeverityCritical, Subject: "case_fan"}})
+	checkEvents(nil)
+
+	cpu.set(47, nil)
+	setRPM(1200)
+	waitForSample(t, hs, time.Now())
+	checkEvents([]event{
+		{Type: TemperatureThreshold, Severity: SeverityWarning, Subject: "cpu"},
+		{Type: FanStall, Severity: SeverityInfo, Resolved: true, Subject: "case_fan"},
+	})
+
+	// within the hysteresis, the threshold event is not resolved
+	cpu.set(43, nil)
+	waitForSample(t, hs, time.Now())
+	checkEvents(nil)
+
+	cpu.set(41, nil)
+	gpu.set(0, errors.New("simulated error"))
+	waitForSample(t, hs, time.Now())
+	checkEvents([]event{
+		{Type: TemperatureThreshold, Severity: SeverityInfo, Resolved: true, Subject: "cpu"},
+		{Type: SensorFailure, Severity: SeverityWarning, Subject: "gpu"},
+	})
+
+	gpu.set(35, nil)
+	cpu.set(65, nil)
+	waitForSample(t, hs, time.Now())
+	checkEvents([]event{
+		{Type: CriticalTemperature, Severity: SeverityCritical, Subject: "cpu"},
+		{Type: TemperatureThreshold, Severity: SeverityWarning, Subject: "cpu"},
+		{Type: SensorFailure, Severity: SeverityInfo, Resolved: true, Subject: "gpu"},
+	})
+
+	hs.StopThermalControl()
+	checkEvents([]event{{Type: ControllerStopped, Severity: SeverityCritical}})
+	checkEvents(nil)
+}
+
+func TestWatcher_Start(t *testing.T) {
+
+	hs, err := heatsink.New(
+		&heatsink.Config{
+			Fan:            &heatsinktest.FakeFanDriver{},
+			Sensors:        []heatsink.ThermoSensor{&testSensor{name: "cpu", temp: 40}},
+			MinTemperature: 30,
+			MaxTemperature: 50,
+		},
+		heatsink.OptName("cpu"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs.StopThermalControl()
+
+	failing := &testAlerter{events: make(chan Event, 1), err: errors.New("unreachable")}
+	working := &testAlerter{events: make(chan Event, 1)}
+	w := New([]Target{{Heatsink: hs}}, OptInterval(time.Millisecond), OptAlerter(failing))
+	w.Register(working)
+	stop := w.Start()
+
+	for _, a := range []*testAlerter{failing, working} {
+		select {
+		case e := <-a.events:
+			if e.Type != ControllerStopped || e.Heatsink != "cpu" {
+				t.Errorf("unexpected event: %+v", e)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for an event")
+		}
+	}
+	stop()
+
+	select {
+	case e := <-working.events:
+		t.Fatalf("expected a single event, got: %+v", e)
+	default:
+	}
+}
+
+func TestWatcher_check_quarantine(t *testing.T) {
+
+	gpu := &testSensor{name: "gpu", temp: 35}
+	hs, err := heatsink.New(
+		&heatsink.Config{
+			Fan:            &heatsinktest.FakeFanDriver{},
+			Sensors:        []heatsink.ThermoSensor{&testSensor{name: "cpu", temp: 40}, gpu},
+			MinTemperature: 30,
+			MaxTemperature: 50,
+		},
+		heatsink.OptName("case"),
+		heatsink.OptTemperatureCheckPeriod(5*time.Millisecond),
+		heatsink.OptSensorQuarantine(heatsink.SensorQuarantine{MaxJump: 20, Window: 1, MinScore: 1, Readmit: 1000}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := New([]Target{{Heatsink: hs}})
+
+	go hs.StartThermalControl()
+	defer hs.StopThermalControl()
+	waitForSample(t, hs, time.Time{})
+	if events := w.check(time.Now()); len(events) != 0 {
+		t.Fatalf("expected no events, got: %+v", events)
+	}
+
+	gpu.set(95, nil)
+	waitForSample(t, hs, time.Now())
+	events := w.check(time.Now())
+	if len(events) != 1 {
+		t.Fatalf("expected a single event, got: %+v", events)
+	}
+	if e := events[0]; e.Type != SensorQuarantined || e.Severity != SeverityWarning || e.Subject != "gpu" || e.Resolved {
+		t.Errorf("unexpected event: %+v", e)
+	}
+}
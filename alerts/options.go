@@ -0,0 +1,77 @@
+package alerts
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Option is used to pass optional parameters to the New factory function
+type Option func(*Watcher)
+
+// OptInterval sets how often the heatsinks are checked. If d is not positive, it is set to the
+// default value
+//
+// (default: 5s)
+func OptInterval(d time.Duration) Option {
+	return func(w *Watcher) {
+		if d > 0 {
+			w.interval = d
+		}
+	}
+}
+
+// OptTemperatureThreshold raises a TemperatureThreshold event when the temperature of a heatsink
+// rises above temp, which is resolved once it drops 3°C below it
+//
+// (default: no threshold)
+func OptTemperatureThreshold(temp float64) Option {
+	return func(w *Watcher) {
+		w.threshold, w.hasThreshold = temp, true
+	}
+}
+
+// OptStallDutyCycle sets the duty cycle ratio at or above which a fan that reports no speed is
+// considered stalled, since fans may stop spinning at low duty cycles by design
+//
+// (default: 0.3)
+func OptStallDutyCycle(dcRatio float64) Option {
+	return func(w *Watcher) {
+		w.stallDC = dcRatio
+	}
+}
+
+// OptQueueSize sets how many events may wait for slow alerters before new ones are dropped. If
+// n is not positive, it is set to the default value
+//
+// (default: 64)
+func OptQueueSize(n int) Option {
+	return func(w *Watcher) {
+		if n > 0 {
+			w.queueSize = n
+		}
+	}
+}
+
+// OptLogger sets the logger of events and of alerters that fail. If logger is nil, it is set to
+// the default value
+//
+// (default: no-op logger)
+func OptLogger(logger *zap.Logger) Option {
+	return func(w *Watcher) {
+		if logger != nil {
+			w.logger = logger
+		}
+	}
+}
+
+// OptAlerter registers the given alerter, just like Register
+//
+// (default: no alerters)
+func OptAlerter(a Alerter) Option {
+	return func(w *Watcher) {
+		if a != nil {
+			w.alerters = append(w.alerters, a)
+		}
+	}
+}
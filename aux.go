@@ -0,0 +1,60 @@
+package heatsink
+
+import (
+	"io"
+
+	"go.uber.org/zap"
+)
+
+// AuxInput is an auxiliary signal that leads temperature, such as package power draw or CPU
+// load, which the heatsink uses to ramp up the fan before the temperature catches up
+type AuxInput interface {
+	// Value returns the current reading of this input. If the input is closed, it should
+	// return ErrAuxInputClosed
+	Value() (float64, error)
+	// Name returns the name of this input
+	Name() string
+	io.Closer
+}
+
+// auxInput maps the readings of an auxiliary input linearly to a minimum duty cycle
+type auxInput struct {
+	input AuxInput
+	low   float64
+	high  float64
+}
+
+// ratio returns the duty cycle ratio for the given reading. Readings at or below low map to
+// zero and readings at or above high map to one
+func (a auxInput) ratio(value float64) float64 {
+	switch {
+	case value <= a.low:
+		return 0
+	case value >= a.high:
+		return 1
+	default:
+		return (value - a.low) / (a.high - a.low)
+	}
+}
+
+// feedForward raises the given duty cycle to the one derived from each auxiliary input, if
+// higher. Inputs that fail to be read are logged and skipped
+func (hs *Heatsink) feedForward(dcRatio float64, why *reason) float64 {
+	for _, aux := range hs.auxInputs {
+		value, err := aux.input.Value()
+		if err != nil {
+			hs.logger.Error(
+				"failed to read auxiliary input",
+				zap.Error(err),
+				zap.String("heatsink_name", hs.name),
+				zap.String("input_name", aux.input.Name()),
+			)
+			continue
+		}
+		if auxDC := aux.ratio(value); auxDC > dcRatio {
+			why.adjust("raised to %.2f by auxiliary input '%s' at %.2f", auxDC, aux.input.Name(), value)
+			dcRatio = auxDC
+		}
+	}
+	return dcRatio
+}
@@ -0,0 +1,74 @@
+package heatsink
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+)
+
+func TestAuxInput_ratio(t *testing.T) {
+	t.Parallel()
+
+	aux := auxInput{low: 20, high: 100}
+	for value, expected := range map[float64]float64{0: 0, 20: 0, 60: 0.5, 100: 1, 150: 1} {
+		if actual := aux.ratio(value); actual != expected {
+			t.Errorf("unexpected ratio for %v\nwant: %v\n got: %v", value, expected, actual)
+		}
+	}
+}
+
+func TestOptAuxInput_ignoresInvalid(t *testing.T) {
+	t.Parallel()
+
+	hs := &Heatsink{}
+	OptAuxInput(nil, 0, 1)(nil, hs)
+	OptAuxInput(&fakeAuxInput{}, 1, 1)(nil, hs)
+	if len(hs.auxInputs) != 0 {
+		t.Fatalf("expected invalid auxiliary inputs to be ignored, got: %v", hs.auxInputs)
+	}
+}
+
+func TestHeatsink_StartThermalControl_feedForward(t *testing.T) {
+	t.Parallel()
+
+	simulatedErr := errors.New("simulated error")
+	fanDriver := &fakeFanDriver{}
+	aux := &fakeAuxInput{
+		onValueVals: []float64{80, 0, 20},
+		onValueErrs: []error{nil, simulatedErr, nil},
+	}
+	config := &Config{
+		Fan: fanDriver,
+		Sensors: []ThermoSensor{&fakeThermoSensor{
+			onTemperatureVals: []float64{40, 40, 40},
+			onTemperatureErrs: []error{nil, nil, nil, simulatedErr},
+		}},
+		MinTemperature: 35,
+		MaxTemperature: 45,
+	}
+	hs, err := New(
+		config,
+		OptTemperatureCheckPeriod(time.Millisecond),
+		OptAuxInput(aux, 0, 100),
+		OptUnchangedDutyCycle(-1, 0),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs.dcCalc = &fakeDutyCycler{tmpToDC: map[float64]float64{40: 0.4}}
+
+	if err := hs.StartThermalControl(); !errors.Is(err, simulatedErr) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", simulatedErr, err)
+	}
+
+	// the input raises the duty cycle, is skipped when failing, and never lowers it
+	expected := []float64{0.8, 0.4, 0.4}
+	if diff := deep.Equal(fanDriver.argSetDutyCycle, expected); diff != nil {
+		t.Fatal(diff)
+	}
+	if aux.numCloseCalls != 1 {
+		t.Fatalf("expected the auxiliary input to be closed once, got: %d", aux.numCloseCalls)
+	}
+}
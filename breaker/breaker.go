@@ -0,0 +1,186 @@
+// Package breaker provides a circuit breaker for device IO along with wrappers for
+// heatsink.ThermoSensor and heatsink.FanDriver that use it. After repeated failures, the
+// breaker opens and calls fail fast without touching the device. Once the open duration
+// elapses, a single probe call is let through to check whether the device recovered
+package breaker
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Sentinel errors that are wrapped and returned by this package
+var (
+	ErrOpen    = errors.New("circuit breaker is open")
+	ErrTimeout = errors.New("device call timed out")
+)
+
+// State is the state of a circuit breaker
+type State int
+
+// The states a circuit breaker can be in
+const (
+	// StateClosed lets all calls through
+	StateClosed State = iota
+	// StateOpen fails all calls fast
+	StateOpen
+	// StateHalfOpen lets a single probe call through and fails other calls fast
+	StateHalfOpen
+)
+
+// String returns a human-readable name of the state
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
+
+// Breaker is a circuit breaker that guards calls to a single device. Instances of this type
+// are safe for concurrent use
+type Breaker struct {
+	name          string
+	threshold     int
+	openDuration  time.Duration
+	timeout       time.Duration
+	onStateChange func(name string, from, to State)
+	now           func() time.Time
+
+	mutex    sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	stuck    bool
+}
+
+// New returns a new closed circuit breaker with the given name, which is passed to the state
+// change callback. For details about options and defaults, see the documentation for type
+// 'Option'
+func New(name string, options ...Option) *Breaker {
+	b := &Breaker{
+		name:         name,
+		threshold:    3,
+		openDuration: 30 * time.Second,
+		now:          time.Now,
+	}
+	for _, applyOption := range options {
+		applyOption(b)
+	}
+	return b
+}
+
+// Name returns the name of this breaker
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// State returns the current state of this breaker
+func (b *Breaker) State() State {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.state
+}
+
+// Do calls the given function unless the breaker is open, in which case an error wrapping
+// ErrOpen is returned immediately. If a timeout is set and the call does not return in time,
+// an error wrapping ErrTimeout is returned and, until the call eventually returns, subsequent
+// calls fail fast with the same error without calling the function again. Any error counts
+// as a failure
+func (b *Breaker) Do(call func() error) error {
+
+	b.mutex.Lock()
+	switch {
+	case b.state == StateOpen && b.now().Sub(b.openedAt) < b.openDuration:
+		b.mutex.Unlock()
+		return fmt.Errorf("%w: '%s'", ErrOpen, b.name)
+	case b.state == StateHalfOpen:
+		b.mutex.Unlock()
+		return fmt.Errorf("%w: '%s' is being probed", ErrOpen, b.name)
+	}
+	from := b.state
+	if b.state == StateOpen {
+		b.state = StateHalfOpen
+	}
+	stuck, to := b.stuck, b.state
+	b.mutex.Unlock()
+	b.notify(from, to)
+
+	var err error
+	if stuck {
+		err = fmt.Errorf("%w: a previous call to '%s' has not returned yet", ErrTimeout, b.name)
+	} else {
+		err = b.call(call)
+	}
+	b.record(err)
+	return err
+}
+
+// call calls the given function and waits for it to return or for the timeout to elapse
+func (b *Breaker) call(call func() error) error {
+
+	if b.timeout <= 0 {
+		return call()
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- call() }()
+
+	timer := time.NewTimer(b.timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+	}
+
+	b.mutex.Lock()
+	b.stuck = true
+	b.mutex.Unlock()
+	go func() {
+		<-done
+		b.mutex.Lock()
+		b.stuck = false
+		b.mutex.Unlock()
+	}()
+	return fmt.Errorf("%w: '%s' did not return within %s", ErrTimeout, b.name, b.timeout)
+}
+
+// record updates the state of the breaker according to the outcome of a call
+func (b *Breaker) record(err error) {
+
+	b.mutex.Lock()
+	from := b.state
+	switch {
+	case err == nil:
+		b.failures = 0
+		b.state = StateClosed
+	case b.state == StateHalfOpen:
+		b.openedAt = b.now()
+		b.state = StateOpen
+	default:
+		b.failures++
+		if b.failures >= b.threshold {
+			b.openedAt = b.now()
+			b.state = StateOpen
+		}
+	}
+	to := b.state
+	b.mutex.Unlock()
+
+	b.notify(from, to)
+}
+
+func (b *Breaker) notify(from, to State) {
+	if from != to && b.onStateChange != nil {
+		b.onStateChange(b.name, from, to)
+	}
+}
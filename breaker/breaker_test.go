@@ -0,0 +1,147 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/malkhamis/heatsink/heatsinktest"
+)
+
+func TestBreaker_lifeCycle(t *testing.T) {
+
+	clock := heatsinktest.NewFakeClock(time.Unix(0, 0))
+	now, advance := clock.Now, clock.Advance
+	var transitions []string
+	b := New(
+		"dev",
+		OptFailureThreshold(2),
+		OptOpenDuration(time.Minute),
+		OptOnStateChange(func(name string, from, to State) {
+			transitions = append(transitions, name+": "+from.String()+" -> "+to.String())
+		}),
+		func(b *Breaker) { b.now = now },
+	)
+
+	simulatedErr := errors.New("simulated error")
+	failing := func() error { return simulatedErr }
+	succeeding := func() error { return nil }
+
+	steps := []struct {
+		call     func() error
+		advance  time.Duration
+		expected error
+		state    State
+	}{
+		{failing, 0, simulatedErr, StateClosed},
+		{succeeding, 0, nil, StateClosed},
+		{failing, 0, simulatedErr, StateClosed},
+		{failing, 0, simulatedErr, StateOpen},
+		{succeeding, 30 * time.Second, ErrOpen, StateOpen},
+		{failing, 30 * time.Second, simulatedErr, StateOpen},
+		{succeeding, 59 * time.Second, ErrOpen, StateOpen},
+		{succeeding, time.Second, nil, StateClosed},
+	}
+
+	for i, step := range steps {
+		advance(step.advance)
+		if err := b.Do(step.call); !errors.Is(err, step.expected) {
+			t.Fatalf("step %d: unexpected error\nwant: %v\n got: %v", i, step.expected, err)
+		}
+		if actual := b.State(); actual != step.state {
+			t.Fatalf("step %d: unexpected state\nwant: %s\n got: %s", i, step.state, actual)
+		}
+	}
+
+	expected := []string{
+		"dev: closed -> open",
+		"dev: open -> half-open",
+		"dev: half-open -> open",
+		"dev: open -> half-open",
+		"dev: half-open -> closed",
+	}
+	if diff := deep.Equal(transitions, expected); diff != nil {
+		t.Fatal(diff)
+	}
+}
+
+func TestBreaker_Do_halfOpenFailsOtherCallsFast(t *testing.T) {
+
+	clock := heatsinktest.NewFakeClock(time.Unix(0, 0))
+	now, advance := clock.Now, clock.Advance
+	b := New("dev", OptFailureThreshold(1), func(b *Breaker) { b.now = now })
+	_ = b.Do(func() error { return errors.New("simulated error") })
+	advance(time.Hour)
+
+	var errDuringProbe error
+	err := b.Do(func() error {
+		errDuringProbe = b.Do(func() error { return nil })
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(errDuringProbe, ErrOpen) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", ErrOpen, errDuringProbe)
+	}
+}
+
+func TestBreaker_Do_timeout(t *testing.T) {
+
+	b := New("dev", OptTimeout(10*time.Millisecond), OptFailureThreshold(10))
+
+	release := make(chan struct{})
+	numCalls := 0
+	blocking := func() error {
+		numCalls++
+		<-release
+		return nil
+	}
+
+	if err := b.Do(blocking); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", ErrTimeout, err)
+	}
+	if err := b.Do(blocking); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("unexpected error while a call is stuck\nwant: %v\n got: %v", ErrTimeout, err)
+	}
+	close(release)
+
+	for deadline := time.After(time.Second); ; {
+		if err := b.Do(func() error { return nil }); err == nil {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatal("timeout waiting for the stuck call to return")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	if numCalls != 1 {
+		t.Fatalf("expected the stuck call not to be repeated, got %d calls", numCalls)
+	}
+}
+
+func TestBreaker_defaults(t *testing.T) {
+
+	b := New("dev", OptFailureThreshold(0), OptOpenDuration(-1), OptTimeout(-1), OptOnStateChange(nil))
+	if b.threshold != 3 || b.openDuration != 30*time.Second || b.timeout != 0 || b.onStateChange != nil {
+		t.Fatalf("expected invalid options to fall back to defaults, got: %+v", b)
+	}
+	if expected, actual := "dev", b.Name(); actual != expected {
+		t.Errorf("unexpected name\nwant: %s\n got: %s", expected, actual)
+	}
+}
+
+func TestState_String(t *testing.T) {
+	for state, expected := range map[State]string{
+		StateClosed:   "closed",
+		StateOpen:     "open",
+		StateHalfOpen: "half-open",
+		State(7):      "State(7)",
+	} {
+		if actual := state.String(); actual != expected {
+			t.Errorf("unexpected string\nwant: %s\n got: %s", expected, actual)
+		}
+	}
+}
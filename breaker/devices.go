@@ -0,0 +1,84 @@
+package breaker
+
+import (
+	"github.com/malkhamis/heatsink"
+)
+
+// compile-time check for interface implementation and dependency inversion
+var (
+	_ heatsink.ThermoSensor = (*Sensor)(nil)
+	_ heatsink.FanDriver    = (*Fan)(nil)
+)
+
+// Sensor is a thermal sensor whose temperature readings are guarded by a circuit breaker
+type Sensor struct {
+	heatsink.ThermoSensor
+	breaker *Breaker
+}
+
+// NewSensor returns a sensor that wraps the given one and guards its readings with a circuit
+// breaker named after it. For details about options and defaults, see the documentation for
+// type 'Option'
+func NewSensor(sensor heatsink.ThermoSensor, options ...Option) *Sensor {
+	return &Sensor{
+		ThermoSensor: sensor,
+		breaker:      New(sensor.Name(), options...),
+	}
+}
+
+// Temperature returns the temperature reading of the wrapped sensor, unless the breaker is
+// open or the reading timed out
+func (s *Sensor) Temperature() (float64, error) {
+	var temp float64
+	err := s.breaker.Do(func() (err error) {
+		temp, err = s.ThermoSensor.Temperature()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return temp, nil
+}
+
+// Breaker returns the circuit breaker of this sensor
+func (s *Sensor) Breaker() *Breaker {
+	return s.breaker
+}
+
+// Fan is a fan driver whose duty cycle writes are guarded by a circuit breaker
+type Fan struct {
+	heatsink.FanDriver
+	breaker *Breaker
+}
+
+// NewFan returns a fan driver that wraps the given one and guards its writes with a circuit
+// breaker named after it. For details about options and defaults, see the documentation for
+// type 'Option'
+func NewFan(fan heatsink.FanDriver, options ...Option) *Fan {
+	return &Fan{
+		FanDriver: fan,
+		breaker:   New(fan.Name(), options...),
+	}
+}
+
+// SetDutyCycle passes the given duty cycle to the wrapped driver, unless the breaker is open
+// or the write timed out
+func (f *Fan) SetDutyCycle(dcRatio float64) error {
+	return f.breaker.Do(func() error {
+		return f.FanDriver.SetDutyCycle(dcRatio)
+	})
+}
+
+// SelfTest passes the self-test on to the wrapped driver, or returns heatsink.ErrNoSelfTest if
+// it is not a heatsink.SelfTester
+func (f *Fan) SelfTest() error {
+	if tester, ok := f.FanDriver.(heatsink.SelfTester); ok {
+		return tester.SelfTest()
+	}
+	return heatsink.ErrNoSelfTest
+}
+
+// Breaker returns the circuit breaker of this fan
+func (f *Fan) Breaker() *Breaker {
+	return f.breaker
+}
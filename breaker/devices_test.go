@@ -0,0 +1,82 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/malkhamis/heatsink"
+	"github.com/malkhamis/heatsink/heatsinktest"
+)
+
+func TestSensor_Temperature(t *testing.T) {
+
+	simulatedErr := errors.New("simulated error")
+	wrapped := &heatsinktest.FakeThermoSensor{
+		TemperatureVals: []float64{42},
+		TemperatureErrs: []error{nil, simulatedErr, simulatedErr, simulatedErr, simulatedErr, simulatedErr},
+		SensorName:      "fake",
+	}
+	sensor := NewSensor(wrapped, OptFailureThreshold(2))
+
+	temp, err := sensor.Temperature()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if temp != 42 {
+		t.Fatalf("unexpected temperature\nwant: %v\n got: %v", 42.0, temp)
+	}
+
+	for range make([]struct{}, 5) {
+		sensor.Temperature()
+	}
+	if numCalls := wrapped.NumTemperatureCalls(); numCalls != 3 {
+		t.Fatalf("expected the open breaker to stop calling the sensor, got %d calls", numCalls)
+	}
+	if _, err := sensor.Temperature(); !errors.Is(err, ErrOpen) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", ErrOpen, err)
+	}
+	if expected, actual := "fake", sensor.Breaker().Name(); actual != expected {
+		t.Errorf("expected the breaker to be named after the sensor\nwant: %s\n got: %s", expected, actual)
+	}
+}
+
+func TestFan_SetDutyCycle(t *testing.T) {
+
+	wrapped := &heatsinktest.FakeFanDriver{SetDutyCycleErrs: []error{errors.New("simulated error")}}
+	fan := NewFan(wrapped, OptFailureThreshold(1))
+
+	if err := fan.SetDutyCycle(0.5); err == nil {
+		t.Fatal("expected an error from the wrapped driver")
+	}
+	if err := fan.SetDutyCycle(0.6); !errors.Is(err, ErrOpen) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", ErrOpen, err)
+	}
+	if diff := deep.Equal(wrapped.DutyCycles(), []float64{0.5}); diff != nil {
+		t.Fatal(diff)
+	}
+	if expected, actual := StateOpen, fan.Breaker().State(); actual != expected {
+		t.Errorf("unexpected state\nwant: %s\n got: %s", expected, actual)
+	}
+}
+
+// selfTestingFan is a fake fan driver that implements heatsink.SelfTester
+type selfTestingFan struct {
+	heatsinktest.FakeFanDriver
+	err error
+}
+
+func (f *selfTestingFan) SelfTest() error {
+	return f.err
+}
+
+func TestFan_SelfTest(t *testing.T) {
+
+	if err := NewFan(&heatsinktest.FakeFanDriver{}).SelfTest(); !errors.Is(err, heatsink.ErrNoSelfTest) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", heatsink.ErrNoSelfTest, err)
+	}
+	simErr := errors.New("simulated error")
+	if err := NewFan(&selfTestingFan{err: simErr}).SelfTest(); !errors.Is(err, simErr) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", simErr, err)
+	}
+}
@@ -0,0 +1,55 @@
+package breaker
+
+import "time"
+
+// Option is used to pass optional parameters to the New, NewSensor, and NewFan factory
+// functions
+type Option func(*Breaker)
+
+// OptFailureThreshold sets the number of consecutive failures that open the breaker. If n is
+// less than one, it is set to the default value
+//
+// (default: 3)
+func OptFailureThreshold(n int) Option {
+	return func(b *Breaker) {
+		if n > 0 {
+			b.threshold = n
+		}
+	}
+}
+
+// OptOpenDuration sets how long the breaker stays open before a probe call is let through.
+// If d is less than or equal to zero, it is set to the default value
+//
+// (default: 30 seconds)
+func OptOpenDuration(d time.Duration) Option {
+	return func(b *Breaker) {
+		if d > 0 {
+			b.openDuration = d
+		}
+	}
+}
+
+// OptTimeout sets the maximum duration of a single call. If d is less than or equal to zero,
+// it is set to the default value
+//
+// (default: 0, i.e. calls are not timed out)
+func OptTimeout(d time.Duration) Option {
+	return func(b *Breaker) {
+		if d > 0 {
+			b.timeout = d
+		}
+	}
+}
+
+// OptOnStateChange sets a function that is called whenever the breaker changes its state. It
+// must not call methods of the breaker. If fn is nil, it is set to the default value
+//
+// (default: nil, i.e. no callback)
+func OptOnStateChange(fn func(name string, from, to State)) Option {
+	return func(b *Breaker) {
+		if fn != nil {
+			b.onStateChange = fn
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/malkhamis/heatsink"
+	"github.com/malkhamis/heatsink/httpfan"
+	"go.uber.org/zap"
+)
+
+var (
+	errAgentNoDevices = errors.New("agent exposes neither sensors nor fans")
+	errAgentToken     = errors.New("agent requires a token")
+	errAgentFanName   = errors.New("agent fans must have unique, non-empty names")
+)
+
+// agentTokenEnv is read for the token if the agent's config does not set one, which keeps the
+// token out of the config file
+const agentTokenEnv = "HEATSINK_AGENT_TOKEN"
+
+// configAgent configures the 'agent' subcommand, which serves the host's sensors and fans to
+// a central controller that reads them with remote sensors and drives them with remote fans
+type configAgent struct {
+	Listen  string              `json:"listen"`
+	Token   string              `json:"token,omitempty"`
+	Sensors []configNamedSensor `json:"sensors,omitempty"`
+	Fans    []configFan         `json:"fans,omitempty"`
+	// FanTimeout is how long a fan may go without a duty cycle from the controller before it is
+	// set to its maximum speed
+	FanTimeout string `json:"fan_timeout,omitempty"`
+	SysfsRoot  string `json:"sysfs_root,omitempty"`
+}
+
+func newConfigAgent(jsonData io.Reader) (*configAgent, error) {
+
+	cfg := &configAgent{Listen: ":9440", FanTimeout: "30s"}
+	dec := json.NewDecoder(jsonData)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Token == "" {
+		cfg.Token = os.Getenv(agentTokenEnv)
+	}
+	if cfg.Token == "" {
+		return nil, fmt.Errorf("%w: set 'token' or %s", errAgentToken, agentTokenEnv)
+	}
+	if len(cfg.Sensors) == 0 && len(cfg.Fans) == 0 {
+		return nil, errAgentNoDevices
+	}
+	for i := range cfg.Sensors {
+		cfg.Sensors[i].PathGlob = resolveSysfsPath(cfg.SysfsRoot, cfg.Sensors[i].PathGlob)
+	}
+	seen := make(map[string]bool)
+	for i := range cfg.Fans {
+		if cfg.Fans[i].Name == "" || seen[cfg.Fans[i].Name] {
+			return nil, fmt.Errorf("%w: '%s'", errAgentFanName, cfg.Fans[i].Name)
+		}
+		seen[cfg.Fans[i].Name] = true
+		cfg.Fans[i].PathGlob = resolveSysfsPath(cfg.SysfsRoot, cfg.Fans[i].PathGlob)
+	}
+	return cfg, nil
+}
+
+// agent serves local sensors under '/sensors/<name>' in the format read by remote sensors and
+// local fans under '/fans/<name>' in the format sent by remote fans
+type agent struct {
+	token   string
+	sensors map[string]heatsink.ThermoSensor
+	fans    map[string]*agentFan
+	logger  *zap.Logger
+}
+
+// agentFan is a local fan that is set to its maximum speed by a watchdog unless the controller
+// keeps sending duty cycles
+type agentFan struct {
+	heatsink.FanDriver
+	timeout  time.Duration
+	watchdog *time.Timer
+}
+
+func (c *configAgent) newAgent(logger *zap.Logger) (*agent, error) {
+
+	timeout, err := time.ParseDuration(c.FanTimeout)
+	if err != nil || timeout <= 0 {
+		return nil, fmt.Errorf("%w: fan timeout '%s'", errBadDuration, c.FanTimeout)
+	}
+	named, err := newNamedSensors(c.Sensors, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &agent{
+		token:   c.Token,
+		sensors: make(map[string]heatsink.ThermoSensor),
+		fans:    make(map[string]*agentFan),
+		logger:  logger,
+	}
+	for _, s := range c.Sensors {
+		sensor, err := named.newSensor(s.Name, logger)
+		if err != nil {
+			a.close()
+			return nil, fmt.Errorf("agent sensor '%s': %w", s.Name, err)
+		}
+		a.sensors[s.Name] = sensor
+	}
+	for _, f := range c.Fans {
+		driver, err := f.newFan(logger)
+		if err != nil {
+			a.close()
+			return nil, fmt.Errorf("agent fan '%s': %w", f.Name, err)
+		}
+		fan := &agentFan{FanDriver: driver, timeout: timeout}
+		name := f.Name
+		fan.watchdog = time.AfterFunc(timeout, func() {
+			logger.Warn(
+				"no duty cycle received from the controller, setting fan to max",
+				zap.String("event", "agent_fan_timeout"),
+				zap.String("fan", name),
+				zap.Duration("timeout", timeout),
+			)
+			if err := driver.SetDutyCycle(1); err != nil {
+				logger.Error("failed to set fan to max", zap.String("fan", name), zap.Error(err))
+			}
+		})
+		a.fans[name] = fan
+	}
+	return a, nil
+}
+
+// handler returns the agent's HTTP API, which requires the agent's token as a bearer token
+func (a *agent) handler() http.Handler {
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sensors", a.serveList)
+	mux.HandleFunc("/sensors/", a.serveSensor)
+	mux.HandleFunc("/fans/", a.serveFan)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+a.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func (a *agent) serveList(w http.ResponseWriter, r *http.Request) {
+
+	list := struct {
+		Sensors []string `json:"sensors"`
+		Fans    []string `json:"fans"`
+	}{Sensors: []string{}, Fans: []string{}}
+	for name := range a.sensors {
+		list.Sensors = append(list.Sensors, name)
+	}
+	for name := range a.fans {
+		list.Fans = append(list.Fans, name)
+	}
+	sort.Strings(list.Sensors)
+	sort.Strings(list.Fans)
+	a.writeJSON(w, http.StatusOK, list)
+}
+
+func (a *agent) serveSensor(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sensor, ok := a.sensors[strings.TrimPrefix(r.URL.Path, "/sensors/")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	temp, err := sensor.Temperature()
+	if err != nil {
+		a.logger.Warn("failed to read sensor", zap.String("sensor", sensor.Name()), zap.Error(err))
+		http.Error(w, "failed to read sensor", http.StatusBadGateway)
+		return
+	}
+	a.writeJSON(w, http.StatusOK, struct {
+		Temperature float64 `json:"temperature"`
+	}{temp})
+}
+
+func (a *agent) serveFan(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPut {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	fan, ok := a.fans[strings.TrimPrefix(r.URL.Path, "/fans/")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	var req httpfan.Request
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<16)).Decode(&req); err != nil ||
+		math.IsNaN(req.DutyCycle) || req.DutyCycle < 0 || req.DutyCycle > 1 {
+		http.Error(w, "body must be {\"duty_cycle\": <0.0 to 1.0>}", http.StatusBadRequest)
+		return
+	}
+	if err := fan.SetDutyCycle(req.DutyCycle); err != nil {
+		a.logger.Warn("failed to set fan duty cycle", zap.String("fan", fan.Name()), zap.Error(err))
+		http.Error(w, "failed to set duty cycle", http.StatusBadGateway)
+		return
+	}
+	fan.watchdog.Reset(fan.timeout)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *agent) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		a.logger.Warn("failed to write agent response", zap.Error(err))
+	}
+}
+
+// close stops the watchdogs and closes every device. Closing a fan sets it to its maximum speed
+func (a *agent) close() {
+	for name, fan := range a.fans {
+		fan.watchdog.Stop()
+		if err := fan.Close(); err != nil {
+			a.logger.Error("failed to close fan", zap.String("fan", name), zap.Error(err))
+		}
+	}
+	for name, sensor := range a.sensors {
+		if err := sensor.Close(); err != nil {
+			a.logger.Error("failed to close sensor", zap.String("sensor", name), zap.Error(err))
+		}
+	}
+}
+
+// runAgent implements the 'agent' subcommand, which serves the host's sensors and fans until
+// the process is signaled to terminate
+func runAgent(args []string) (exitCode int) {
+
+	logger := newLogger(logSettings{})
+	defer logger.Sync()
+
+	flags := flag.NewFlagSet("agent", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		logger.Error("invalid arguments", zap.String("usage", "agent <config_file>"))
+		return 64
+	}
+	filename := flags.Arg(0)
+
+	file, err := os.Open(filename)
+	if err != nil {
+		logger.Error("opening the given file", zap.Error(err))
+		return 66
+	}
+	cfg, err := newConfigAgent(file)
+	file.Close()
+	if err != nil {
+		logger.Error("creating agent config", zap.Error(err), zap.String("filename", filename))
+		return 78
+	}
+	a, err := cfg.newAgent(logger)
+	if err != nil {
+		logger.Error("creating agent", zap.Error(err), zap.String("filename", filename))
+		return 78
+	}
+	defer a.close()
+
+	listener, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		logger.Error("starting agent server", zap.Error(err), zap.String("address", cfg.Listen))
+		return 71
+	}
+	server := &http.Server{Handler: a.handler(), ReadHeaderTimeout: 5 * time.Second}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			logger.Error("agent server returned an error", zap.Error(err))
+		}
+	}()
+	logger.Info("serving agent", zap.String("address", listener.Addr().String()))
+
+	terminate := make(chan os.Signal, 1)
+	signalNotify(terminate, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(terminate)
+	sig := <-terminate
+	logger.Info("received signal, stopping agent", zap.String("signal", sig.String()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Warn("failed to shut down agent server", zap.Error(err))
+	}
+	wg.Wait()
+	return 0
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/malkhamis/heatsink/httpfan"
+	"github.com/malkhamis/heatsink/httpsense"
+	"go.uber.org/zap"
+)
+
+func Test_newConfigAgent_errors(t *testing.T) {
+
+	cases := map[string]struct {
+		json        string
+		expectedErr error
+	}{
+		"no token":      {json: `{"sensors": [{"name": "cpu", "path_glob": "/tmp/x"}]}`, expectedErr: errAgentToken},
+		"no devices":    {json: `{"token": "secret"}`, expectedErr: errAgentNoDevices},
+		"unnamed fan":   {json: `{"token": "secret", "fans": [{"path_glob": "/tmp/x"}]}`, expectedErr: errAgentFanName},
+		"duplicate fan": {json: `{"token": "secret", "fans": [{"name": "a"}, {"name": "a"}]}`, expectedErr: errAgentFanName},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			_, err := newConfigAgent(strings.NewReader(c.json))
+			if !errors.Is(err, c.expectedErr) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", c.expectedErr, err)
+			}
+		})
+	}
+
+	if _, err := newConfigAgent(strings.NewReader(`{"token": "secret", "fan": {}}`)); err == nil {
+		t.Fatal("expected an error given an unknown field")
+	}
+}
+
+func Test_newConfigAgent_tokenFromEnv(t *testing.T) {
+
+	orig, isSet := os.LookupEnv(agentTokenEnv)
+	defer func() {
+		if isSet {
+			os.Setenv(agentTokenEnv, orig)
+		} else {
+			os.Unsetenv(agentTokenEnv)
+		}
+	}()
+	os.Setenv(agentTokenEnv, "from-env")
+
+	cfg, err := newConfigAgent(strings.NewReader(`{"sensors": [{"name": "cpu", "path_glob": "temp1"}], "sysfs_root": "/host/sys"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal([]string{cfg.Token, cfg.Sensors[0].PathGlob}, []string{"from-env", "/host/sys/temp1"}); diff != nil {
+		t.Fatal(diff)
+	}
+}
+
+func Test_agent_handler(t *testing.T) {
+
+	sensorFile, cleanup := temporaryFile(t)
+	defer cleanup()
+	if _, err := sensorFile.WriteString("42000"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the agent drives a fan hub, which lets the test observe the duty cycles it sets
+	var (
+		mutex    sync.Mutex
+		received []float64
+	)
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req httpfan.Request
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		mutex.Lock()
+		defer mutex.Unlock()
+		received = append(received, req.DutyCycle)
+	}))
+	defer hub.Close()
+
+	cfg, err := newConfigAgent(strings.NewReader(fmt.Sprintf(`
+		{
+		  "token": "secret",
+		  "fan_timeout": "100ms",
+		  "sensors": [{"name": "cpu", "path_glob": %q}],
+		  "fans": [{"name": "case", "remote": {"url": %q}}]
+		}
+	`, sensorFile.Name(), hub.URL)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := cfg.newAgent(zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(a.handler())
+	defer server.Close()
+
+	sensor, err := httpsense.New(server.URL+"/sensors/cpu", httpsense.OptHeader("Authorization", "Bearer secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sensor.Close()
+	if temp, err := sensor.Temperature(); err != nil || temp != 42 {
+		t.Fatalf("unexpected remote temperature\nwant: 42\n got: %v (%v)", temp, err)
+	}
+
+	fan, err := httpfan.New(server.URL+"/fans/case", httpfan.OptHeader("Authorization", "Bearer secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fan.SetDutyCycle(0.3); err != nil {
+		t.Fatal(err)
+	}
+
+	unauthorized, err := httpsense.New(server.URL+"/sensors/cpu", httpsense.OptHeader("Authorization", "Bearer guess"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := unauthorized.Temperature(); !errors.Is(err, httpsense.ErrBadStatus) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", httpsense.ErrBadStatus, err)
+	}
+
+	cases := []struct {
+		method, path, body string
+		expectedStatus     int
+	}{
+		{http.MethodGet, "/sensors", "", http.StatusOK},
+		{http.MethodGet, "/sensors/gpu", "", http.StatusNotFound},
+		{http.MethodPut, "/sensors/cpu", "", http.StatusMethodNotAllowed},
+		{http.MethodPut, "/fans/case", `{"duty_cycle": 2}`, http.StatusBadRequest},
+		{http.MethodPut, "/fans/pump", `{"duty_cycle": 1}`, http.StatusNotFound},
+		{http.MethodGet, "/fans/case", "", http.StatusMethodNotAllowed},
+	}
+	for _, c := range cases {
+		req, err := http.NewRequest(c.method, server.URL+c.path, strings.NewReader(c.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != c.expectedStatus {
+			t.Errorf("%s %s\nwant: %d\n got: %d", c.method, c.path, c.expectedStatus, resp.StatusCode)
+		}
+	}
+
+	// the watchdog sets the fan to max once the controller stops sending duty cycles
+	time.Sleep(200 * time.Millisecond)
+	a.close()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if diff := deep.Equal(received, []float64{0.3, 1, 1}); diff != nil {
+		t.Fatal(diff)
+	}
+}
+
+func Test_runAgent_errors(t *testing.T) {
+
+	if code := runAgent(nil); code != 64 {
+		t.Fatalf("unexpected exit code given no config\nwant: 64\n got: %d", code)
+	}
+	if code := runAgent([]string{"/non/existent/agent.json"}); code != 66 {
+		t.Fatalf("unexpected exit code given a missing config\nwant: 66\n got: %d", code)
+	}
+}
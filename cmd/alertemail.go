@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/malkhamis/heatsink/alerts"
+)
+
+var (
+	errEmailServer     = errors.New("email alerts need a server as host:port")
+	errEmailRecipients = errors.New("email alerts need a sender and at least one recipient")
+	errEmailAddress    = errors.New("invalid email address")
+	errEmailTemplate   = errors.New("invalid email template")
+)
+
+const (
+	defaultEmailThrottle = 15 * time.Minute
+	emailTimeout         = 30 * time.Second
+	defaultEmailSubject  = `[heatsink] {{.Summary}} on {{.Hostname}}: {{.Heatsink}}`
+	defaultEmailBody     = `{{.Message}}
+
+Host:        {{.Hostname}}
+Heatsink:    {{.Heatsink}}
+Event:       {{.Type}}{{if .Resolved}} (resolved){{end}}
+Severity:    {{.Severity}}
+{{- if .Subject}}
+Subject:     {{.Subject}}{{end}}
+Temperature: {{printf "%.1f" .Temperature}}°C
+Time:        {{.Time.Format "2006-01-02 15:04:05 MST"}}
+{{- if .Suppressed}}
+
+{{.Suppressed}} more alert(s) of this event were throttled since the last email.{{end}}
+`
+)
+
+// configAlertEmail mails alerts through an SMTP server, upgrading the connection with STARTTLS
+// when the server supports it or using TLS from the start if tls is set. The subject and body
+// are Go templates of the fields of the alert along with Summary, Hostname, and Suppressed.
+// Once an email is sent for an event, further alerts of the same event are throttled for the
+// throttle duration and counted in Suppressed of the next email
+type configAlertEmail struct {
+	Server   string   `json:"server"`
+	TLS      bool     `json:"tls,omitempty"`
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+	Subject  string   `json:"subject,omitempty"`
+	Body     string   `json:"body,omitempty"`
+	Throttle string   `json:"throttle,omitempty"`
+}
+
+// emailData is what email templates are executed with
+type emailData struct {
+	alerts.Event
+	Summary    string
+	Hostname   string
+	Suppressed int
+}
+
+// emailAlerter mails alerts, throttling them per event
+type emailAlerter struct {
+	server string
+	tls    bool
+	auth   smtp.Auth
+	from   string
+	to     []string
+	// envelope holds the bare addresses of the sender followed by those of the recipients
+	envelope []string
+	subject  *template.Template
+	body     *template.Template
+	hostname string
+	throttle time.Duration
+	// tlsConfig is internally used to ease unit testing
+	tlsConfig *tls.Config
+
+	mutex      sync.Mutex
+	lastSent   map[alerts.EventType]time.Time
+	suppressed map[alerts.EventType]int
+}
+
+func (c *configAlertEmail) newAlerter() (*emailAlerter, error) {
+
+	host, _, err := net.SplitHostPort(c.Server)
+	if err != nil || host == "" {
+		return nil, fmt.Errorf("%w, got: '%s'", errEmailServer, c.Server)
+	}
+	if c.From == "" || len(c.To) == 0 {
+		return nil, errEmailRecipients
+	}
+	n := &emailAlerter{
+		server:     c.Server,
+		tls:        c.TLS,
+		from:       c.From,
+		to:         c.To,
+		throttle:   defaultEmailThrottle,
+		tlsConfig:  &tls.Config{ServerName: host},
+		lastSent:   make(map[alerts.EventType]time.Time),
+		suppressed: make(map[alerts.EventType]int),
+	}
+	for _, address := range append([]string{c.From}, c.To...) {
+		parsed, err := mail.ParseAddress(address)
+		if err != nil {
+			return nil, fmt.Errorf("%w: '%s': %v", errEmailAddress, address, err)
+		}
+		n.envelope = append(n.envelope, parsed.Address)
+	}
+	if c.Username != "" {
+		n.auth = smtp.PlainAuth("", c.Username, c.Password, host)
+	}
+	if n.hostname, err = os.Hostname(); err != nil || n.hostname == "" {
+		n.hostname = "localhost"
+	}
+
+	subject, body := c.Subject, c.Body
+	if subject == "" {
+		subject = defaultEmailSubject
+	}
+	if body == "" {
+		body = defaultEmailBody
+	}
+	if n.subject, err = template.New("subject").Parse(subject); err != nil {
+		return nil, fmt.Errorf("%w: %v", errEmailTemplate, err)
+	}
+	if n.body, err = template.New("body").Parse(body); err != nil {
+		return nil, fmt.Errorf("%w: %v", errEmailTemplate, err)
+	}
+
+	if c.Throttle != "" {
+		throttle, err := time.ParseDuration(c.Throttle)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errBadDuration, err)
+		}
+		if throttle >= 0 {
+			n.throttle = throttle
+		}
+	}
+	return n, nil
+}
+
+func (n *emailAlerter) Name() string {
+	return "email"
+}
+
+// allow reports whether an email may be sent for the given alert now. If so, it returns the
+// number of alerts of the same event that were throttled since the last email
+func (n *emailAlerter) allow(a alerts.Event) (suppressed int, ok bool) {
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if last, sent := n.lastSent[a.Type]; sent && a.Time.Sub(last) < n.throttle {
+		n.suppressed[a.Type]++
+		return 0, false
+	}
+	n.lastSent[a.Type] = a.Time
+	suppressed = n.suppressed[a.Type]
+	delete(n.suppressed, a.Type)
+	return suppressed, true
+}
+
+func (n *emailAlerter) Alert(a alerts.Event) error {
+
+	suppressed, ok := n.allow(a)
+	if !ok {
+		return nil
+	}
+	msg, err := n.compose(emailData{
+		Event:      a,
+		Summary:    a.Summary(),
+		Hostname:   n.hostname,
+		Suppressed: suppressed,
+	})
+	if err != nil {
+		return err
+	}
+	return n.send(msg)
+}
+
+// compose renders the message of the given alert, including its headers
+func (n *emailAlerter) compose(data emailData) ([]byte, error) {
+
+	var subject, body bytes.Buffer
+	if err := n.subject.Execute(&subject, data); err != nil {
+		return nil, fmt.Errorf("%w: %v", errEmailTemplate, err)
+	}
+	if err := n.body.Execute(&body, data); err != nil {
+		return nil, fmt.Errorf("%w: %v", errEmailTemplate, err)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", n.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(n.to, ", "))
+	// a subject must be a single line
+	oneLine := strings.Join(strings.Fields(subject.String()), " ")
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", oneLine))
+	fmt.Fprintf(&msg, "Date: %s\r\n", data.Time.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(body.String(), "\n", "\r\n"))
+	return msg.Bytes(), nil
+}
+
+// send delivers the given message to every recipient
+func (n *emailAlerter) send(msg []byte) error {
+
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: emailTimeout}
+	if n.tls {
+		conn, err = tls.DialWithDialer(dialer, "tcp", n.server, n.tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", n.server)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(emailTimeout)); err != nil {
+		return err
+	}
+
+	host, _, _ := net.SplitHostPort(n.server)
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if err := client.Hello(n.hostname); err != nil {
+		return err
+	}
+	if ok, _ := client.Extension("STARTTLS"); ok && !n.tls {
+		if err := client.StartTLS(n.tlsConfig); err != nil {
+			return err
+		}
+	}
+	if n.auth != nil {
+		if err := client.Auth(n.auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(n.envelope[0]); err != nil {
+		return err
+	}
+	for _, to := range n.envelope[1:] {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("recipient '%s': %w", to, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/malkhamis/heatsink/alerts"
+)
+
+// fakeSMTPServer accepts a single session and records the commands and message it receives
+type fakeSMTPServer struct {
+	listener net.Listener
+	commands []string
+	message  string
+	done     chan struct{}
+}
+
+func newFakeSMTPServer(t *testing.T, rejectRcpt bool) *fakeSMTPServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSMTPServer{listener: listener, done: make(chan struct{})}
+	go func() {
+		defer close(s.done)
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		text := textproto.NewConn(conn)
+		text.PrintfLine("220 fake ESMTP")
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				return
+			}
+			verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+			s.commands = append(s.commands, line)
+			switch {
+			case verb == "EHLO":
+				text.PrintfLine("250-fake\r\n250 AUTH PLAIN")
+			case verb == "AUTH":
+				text.PrintfLine("235 authenticated")
+			case verb == "RCPT" && rejectRcpt:
+				text.PrintfLine("550 no such user")
+			case verb == "DATA":
+				text.PrintfLine("354 go ahead")
+				lines, err := text.ReadDotLines()
+				if err != nil {
+					return
+				}
+				s.message = strings.Join(lines, "\n")
+				text.PrintfLine("250 queued")
+			case verb == "QUIT":
+				text.PrintfLine("221 bye")
+				return
+			default:
+				text.PrintfLine("250 ok")
+			}
+		}
+	}()
+	return s
+}
+
+func (s *fakeSMTPServer) close() {
+	s.listener.Close()
+	<-s.done
+}
+
+func Test_configAlertEmail_newAlerter(t *testing.T) {
+
+	valid := configAlertEmail{Server: "smtp.example.com:587", From: "heatsink@example.com", To: []string{"admin@example.com"}}
+	testCases := []struct {
+		name     string
+		modify   func(c *configAlertEmail)
+		expected error
+	}{
+		{name: "valid", modify: func(c *configAlertEmail) {}},
+		{name: "no port", modify: func(c *configAlertEmail) { c.Server = "smtp.example.com" }, expected: errEmailServer},
+		{name: "no sender", modify: func(c *configAlertEmail) { c.From = "" }, expected: errEmailRecipients},
+		{name: "no recipients", modify: func(c *configAlertEmail) { c.To = nil }, expected: errEmailRecipients},
+		{name: "bad address", modify: func(c *configAlertEmail) { c.To = []string{"admin"} }, expected: errEmailAddress},
+		{name: "bad subject", modify: func(c *configAlertEmail) { c.Subject = "{{.Event" }, expected: errEmailTemplate},
+		{name: "bad body", modify: func(c *configAlertEmail) { c.Body = "{{end}}" }, expected: errEmailTemplate},
+		{name: "bad throttle", modify: func(c *configAlertEmail) { c.Throttle = "hourly" }, expected: errBadDuration},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := valid
+			tc.modify(&c)
+			n, err := c.newAlerter()
+			if !errors.Is(err, tc.expected) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", tc.expected, err)
+			}
+			if err == nil && n.throttle != defaultEmailThrottle {
+				t.Errorf("expected the default throttle, got: %s", n.throttle)
+			}
+		})
+	}
+}
+
+func Test_emailAlerter_Alert(t *testing.T) {
+
+	server := newFakeSMTPServer(t, false)
+	defer server.close()
+
+	n, err := (&configAlertEmail{
+		Server:   server.listener.Addr().String(),
+		Username: "heatsink",
+		Password: "secret",
+		From:     "Heatsink <heatsink@example.com>",
+		To:       []string{"admin@example.com", "Ops <ops@example.com>"},
+		Subject:  "{{.Summary}} on {{.Heatsink}}",
+		Body:     "{{.Message}}\n.{{.Suppressed}}\n",
+	}).newAlerter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.hostname = "server1"
+
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	n.suppressed[alerts.FanStall] = 2
+	err = n.Alert(alerts.Event{Type: alerts.FanStall, Heatsink: "cpu", Message: "fan cpu_fan of cpu stalled", Time: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.close()
+
+	expectedCommands := []string{
+		"EHLO server1",
+		"AUTH PLAIN AGhlYXRzaW5rAHNlY3JldA==",
+		"MAIL FROM:<heatsink@example.com>",
+		"RCPT TO:<admin@example.com>",
+		"RCPT TO:<ops@example.com>",
+		"DATA",
+		"QUIT",
+	}
+	if diff := deep.Equal(server.commands, expectedCommands); diff != nil {
+		t.Error(diff)
+	}
+	expectedMessage := strings.Join([]string{
+		"From: Heatsink <heatsink@example.com>",
+		"To: admin@example.com, Ops <ops@example.com>",
+		"Subject: Fan stalled on cpu",
+		"Date: Sat, 02 Jan 2021 03:04:05 +0000",
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=utf-8",
+		"Content-Transfer-Encoding: 8bit",
+		"",
+		"fan cpu_fan of cpu stalled",
+		".2",
+	}, "\n")
+	if server.message != expectedMessage {
+		t.Fatalf("unexpected message\nwant: %s\n got: %s", expectedMessage, server.message)
+	}
+}
+
+func Test_emailAlerter_Alert_rejected(t *testing.T) {
+
+	server := newFakeSMTPServer(t, true)
+	defer server.close()
+
+	n, err := (&configAlertEmail{
+		Server: server.listener.Addr().String(),
+		From:   "heatsink@example.com",
+		To:     []string{"nobody@example.com"},
+	}).newAlerter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = n.Alert(alerts.Event{Type: alerts.ControllerStopped, Time: time.Now()})
+	if err == nil || !strings.Contains(err.Error(), "nobody@example.com") {
+		t.Fatalf("expected the rejected recipient in the error, got: %v", err)
+	}
+}
+
+func Test_emailAlerter_allow(t *testing.T) {
+
+	n := &emailAlerter{
+		throttle:   time.Minute,
+		lastSent:   make(map[alerts.EventType]time.Time),
+		suppressed: make(map[alerts.EventType]int),
+	}
+	start := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	type result struct {
+		Suppressed int
+		OK         bool
+	}
+	steps := []struct {
+		event    alerts.EventType
+		after    time.Duration
+		expected result
+	}{
+		{event: alerts.FanStall, after: 0, expected: result{OK: true}},
+		{event: alerts.FanStall, after: 10 * time.Second, expected: result{}},
+		// other events are throttled on their own
+		{event: alerts.SensorFailure, after: 20 * time.Second, expected: result{OK: true}},
+		{event: alerts.FanStall, after: 30 * time.Second, expected: result{}},
+		{event: alerts.FanStall, after: time.Minute, expected: result{Suppressed: 2, OK: true}},
+		{event: alerts.FanStall, after: 2 * time.Minute, expected: result{OK: true}},
+	}
+	for i, step := range steps {
+		suppressed, ok := n.allow(alerts.Event{Type: step.event, Time: start.Add(step.after)})
+		if diff := deep.Equal(result{Suppressed: suppressed, OK: ok}, step.expected); diff != nil {
+			t.Errorf("step %d: %v", i, diff)
+		}
+	}
+}
+
+func Test_emailAlerter_compose_default(t *testing.T) {
+
+	n, err := (&configAlertEmail{Server: "localhost:25", From: "a@example.com", To: []string{"b@example.com"}}).newAlerter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.hostname = "server1"
+	msg, err := n.compose(emailData{
+		Event: alerts.Event{
+			Type:        alerts.CriticalTemperature,
+			Resolved:    true,
+			Heatsink:    "gpu",
+			Subject:     "edge",
+			Temperature: 79.96,
+			Message:     "gpu is below its critical temperature: 80.0°C",
+			Time:        time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC),
+		},
+		Summary:    "Critical temperature resolved",
+		Hostname:   "server1",
+		Suppressed: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"Subject: [heatsink] Critical temperature resolved on server1: gpu\r\n",
+		"\r\n\r\ngpu is below its critical temperature: 80.0°C\r\n",
+		"Event:       critical_temperature (resolved)\r\n",
+		"Subject:     edge\r\n",
+		"Temperature: 80.0°C\r\n",
+		"Time:        2021-01-02 03:04:05 UTC\r\n",
+		"1 more alert(s) of this event were throttled since the last email.\r\n",
+	} {
+		if !strings.Contains(string(msg), expected) {
+			t.Errorf("expected '%q' in the message, got:\n%s", expected, msg)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/malkhamis/heatsink/alerts"
+	"github.com/malkhamis/heatsink/dbus"
+)
+
+var errAlertHookCommand = errors.New("alert hook must have a command")
+
+const (
+	defaultAlertHookTimeout = 10 * time.Second
+	// maxAlertHookOutput limits how much of the output of a failed alert hook is reported
+	maxAlertHookOutput = 512
+)
+
+// configDesktopAlerts sends alerts as desktop notifications through the notification server on
+// the given bus, which is the session bus unless it is 'system' or an address
+type configDesktopAlerts struct {
+	Bus string `json:"bus,omitempty"`
+}
+
+// dbusCaller is the subset of the dbus connection used by the desktop alerter
+type dbusCaller interface {
+	Call(dest string, path dbus.ObjectPath, iface, member string, args ...interface{}) ([]interface{}, error)
+	Close() error
+}
+
+// desktopAlerter sends alerts to org.freedesktop.Notifications. It connects for every alert,
+// since alerts are rare and the notification server may come and go with the desktop session
+type desktopAlerter struct {
+	address string
+	// dial is internally used to ease unit testing
+	dial func(address string) (dbusCaller, error)
+}
+
+func (c *configDesktopAlerts) newAlerter() *desktopAlerter {
+	address := c.Bus
+	switch c.Bus {
+	case "", "session":
+		address = dbus.SessionBusAddress()
+	case "system":
+		address = dbus.SystemBusAddress()
+	}
+	return &desktopAlerter{
+		address: address,
+		dial: func(address string) (dbusCaller, error) {
+			return dbus.Dial(address, dbus.OptCallTimeout(5*time.Second))
+		},
+	}
+}
+
+func (n *desktopAlerter) Name() string {
+	return "desktop"
+}
+
+func (n *desktopAlerter) Alert(a alerts.Event) error {
+
+	conn, err := n.dial(n.address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// urgency is a byte: 0 for low, 1 for normal, and 2 for critical notifications, which stay
+	// visible until they are dismissed
+	urgency, icon := uint8(0), "dialog-information"
+	switch a.Severity {
+	case alerts.SeverityWarning:
+		urgency, icon = 1, "dialog-warning"
+	case alerts.SeverityCritical:
+		urgency, icon = 2, "dialog-error"
+	}
+	_, err = conn.Call(
+		"org.freedesktop.Notifications",
+		"/org/freedesktop/Notifications",
+		"org.freedesktop.Notifications",
+		"Notify",
+		"heatsink",  // app_name
+		uint32(0),   // replaces_id
+		icon,        // app_icon
+		a.Summary(), // summary
+		a.Message,   // body
+		[]string{},  // actions
+		map[string]dbus.Variant{"urgency": {Value: urgency}}, // hints
+		int32(-1), // expire_timeout
+	)
+	return err
+}
+
+// configAlertHook runs a command for every alert, which receives the alert as json on its
+// standard input and in the environment variables HEATSINK_ALERT_EVENT,
+// HEATSINK_ALERT_SEVERITY, HEATSINK_ALERT_RESOLVED, HEATSINK_ALERT_HEATSINK, HEATSINK_ALERT_SUBJECT,
+// HEATSINK_ALERT_TEMPERATURE, and HEATSINK_ALERT_MESSAGE
+type configAlertHook struct {
+	Command []string `json:"command"`
+	Timeout string   `json:"timeout,omitempty"`
+}
+
+// hookAlerter runs a command for every alert
+type hookAlerter struct {
+	command []string
+	timeout time.Duration
+}
+
+func (c *configAlertHook) newAlerter() (*hookAlerter, error) {
+	if len(c.Command) == 0 || c.Command[0] == "" {
+		return nil, errAlertHookCommand
+	}
+	timeout := defaultAlertHookTimeout
+	if c.Timeout != "" {
+		parsed, err := time.ParseDuration(c.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errBadDuration, err)
+		}
+		if parsed > 0 {
+			timeout = parsed
+		}
+	}
+	return &hookAlerter{command: c.Command, timeout: timeout}, nil
+}
+
+func (n *hookAlerter) Name() string {
+	return "hook"
+}
+
+func (n *hookAlerter) Alert(a alerts.Event) error {
+
+	payload, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), n.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, n.command[0], n.command[1:]...)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Env = append(
+		os.Environ(),
+		"HEATSINK_ALERT_EVENT="+string(a.Type),
+		"HEATSINK_ALERT_SEVERITY="+a.Severity.String(),
+		"HEATSINK_ALERT_RESOLVED="+strconv.FormatBool(a.Resolved),
+		"HEATSINK_ALERT_HEATSINK="+a.Heatsink,
+		"HEATSINK_ALERT_SUBJECT="+a.Subject,
+		"HEATSINK_ALERT_TEMPERATURE="+strconv.FormatFloat(a.Temperature, 'f', 1, 64),
+		"HEATSINK_ALERT_MESSAGE="+a.Message,
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		if len(output) > maxAlertHookOutput {
+			output = output[:maxAlertHookOutput]
+		}
+		return fmt.Errorf("running '%s': %w: %s", n.command[0], err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/malkhamis/heatsink/alerts"
+	"github.com/malkhamis/heatsink/dbus"
+)
+
+type fakeDBusCaller struct {
+	dest   string
+	path   dbus.ObjectPath
+	member string
+	args   []interface{}
+	err    error
+	closed bool
+}
+
+func (c *fakeDBusCaller) Call(dest string, path dbus.ObjectPath, iface, member string, args ...interface{}) ([]interface{}, error) {
+	c.dest, c.path, c.member, c.args = dest, path, iface+"."+member, args
+	return []interface{}{uint32(1)}, c.err
+}
+
+func (c *fakeDBusCaller) Close() error {
+	c.closed = true
+	return nil
+}
+
+func Test_configDesktopAlerts_newAlerter(t *testing.T) {
+
+	testCases := []struct {
+		bus      string
+		expected string
+	}{
+		{bus: "", expected: dbus.SessionBusAddress()},
+		{bus: "session", expected: dbus.SessionBusAddress()},
+		{bus: "system", expected: dbus.SystemBusAddress()},
+		{bus: "unix:path=/tmp/bus", expected: "unix:path=/tmp/bus"},
+	}
+	for _, tc := range testCases {
+		n := (&configDesktopAlerts{Bus: tc.bus}).newAlerter()
+		if n.address != tc.expected {
+			t.Errorf("bus '%s': expected address '%s', got '%s'", tc.bus, tc.expected, n.address)
+		}
+	}
+}
+
+func Test_desktopAlerter_Alert(t *testing.T) {
+
+	conn := &fakeDBusCaller{}
+	n := &desktopAlerter{
+		address: "unix:path=/tmp/bus",
+		dial: func(address string) (dbusCaller, error) {
+			if address != "unix:path=/tmp/bus" {
+				t.Errorf("unexpected address: %s", address)
+			}
+			return conn, nil
+		},
+	}
+
+	err := n.Alert(alerts.Event{Type: alerts.FanStall, Severity: alerts.SeverityCritical, Heatsink: "cpu", Message: "fan cpu_fan of cpu stalled"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []interface{}{
+		"heatsink",
+		uint32(0),
+		"dialog-error",
+		"Fan stalled",
+		"fan cpu_fan of cpu stalled",
+		[]string{},
+		map[string]dbus.Variant{"urgency": {Value: uint8(2)}},
+		int32(-1),
+	}
+	if diff := deep.Equal(conn.args, expected); diff != nil {
+		t.Fatal(diff)
+	}
+	if conn.dest != "org.freedesktop.Notifications" || conn.member != "org.freedesktop.Notifications.Notify" || !conn.closed {
+		t.Errorf("unexpected call: %+v", conn)
+	}
+
+	err = n.Alert(alerts.Event{Type: alerts.FanStall, Resolved: true, Heatsink: "cpu"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn.args[3] != "Fan stalled resolved" || deep.Equal(conn.args[6], map[string]dbus.Variant{"urgency": {Value: uint8(0)}}) != nil {
+		t.Errorf("unexpected arguments of a resolved alert: %v", conn.args)
+	}
+}
+
+func Test_desktopAlerter_Alert_errors(t *testing.T) {
+
+	errDial := errors.New("no bus")
+	n := &desktopAlerter{dial: func(string) (dbusCaller, error) { return nil, errDial }}
+	if err := n.Alert(alerts.Event{Type: alerts.ControllerStopped}); !errors.Is(err, errDial) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", errDial, err)
+	}
+
+	conn := &fakeDBusCaller{err: &dbus.Error{Name: dbus.ErrorUnknownMethod}}
+	n.dial = func(string) (dbusCaller, error) { return conn, nil }
+	var dbusErr *dbus.Error
+	if err := n.Alert(alerts.Event{Type: alerts.ControllerStopped}); !errors.As(err, &dbusErr) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", conn.err, err)
+	}
+	if !conn.closed {
+		t.Error("expected the connection to be closed")
+	}
+}
+
+func Test_hookAlerter_Alert(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	output := filepath.Join(dir, "alert")
+
+	n, err := (&configAlertHook{
+		Command: []string{"sh", "-c", `cat > "$1"; echo "$HEATSINK_ALERT_EVENT $HEATSINK_ALERT_SEVERITY $HEATSINK_ALERT_RESOLVED $HEATSINK_ALERT_HEATSINK $HEATSINK_ALERT_SUBJECT $HEATSINK_ALERT_TEMPERATURE" >> "$1"`, "sh", output},
+	}).newAlerter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.timeout != defaultAlertHookTimeout {
+		t.Errorf("expected the default timeout, got: %s", n.timeout)
+	}
+
+	a := alerts.Event{
+		Type:        alerts.SensorFailure,
+		Severity:    alerts.SeverityWarning,
+		Heatsink:    "cpu",
+		Subject:     "core0",
+		Temperature: 52.25,
+		Message:     "sensor core0 of cpu failed to read",
+		Time:        time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	if err := n.Alert(a); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"event":"sensor_failure","severity":"warning","resolved":false,"heatsink":"cpu","subject":"core0",` +
+		`"temperature":52.25,"message":"sensor core0 of cpu failed to read","time":"2021-01-02T03:04:05Z"}` +
+		"sensor_failure warning false cpu core0 52.2\n"
+	if string(data) != expected {
+		t.Fatalf("unexpected hook input\nwant: %s\n got: %s", expected, data)
+	}
+}
+
+func Test_hookAlerter_Alert_errors(t *testing.T) {
+
+	n := &hookAlerter{command: []string{"sh", "-c", "echo broken pipe; exit 3"}, timeout: time.Second}
+	err := n.Alert(alerts.Event{Type: alerts.ControllerStopped})
+	if err == nil || !strings.Contains(err.Error(), "broken pipe") {
+		t.Fatalf("expected the output of the hook in the error, got: %v", err)
+	}
+
+	n = &hookAlerter{command: []string{"sleep", "5"}, timeout: 10 * time.Millisecond}
+	start := time.Now()
+	if err := n.Alert(alerts.Event{Type: alerts.ControllerStopped}); err == nil {
+		t.Fatal("expected an error from a hook that timed out")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the hook to be killed on timeout, it took %s", elapsed)
+	}
+}
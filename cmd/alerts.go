@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/malkhamis/heatsink"
+	"github.com/malkhamis/heatsink/alerts"
+	"go.uber.org/zap"
+)
+
+var errAlertMQTT = errors.New("mqtt alerts need an mqtt config")
+
+// configAlerts notifies about thermal events: a heatsink reaching its critical temperature or
+// the temperature in temp_above, a fan that reports no speed on its rpm_path_glob while its
+// duty cycle is at least stall_duty_cycle, a sensor that fails to read, and a control loop
+// that stops. Heatsinks are checked every interval and every event is passed to the configured
+// alerters when it is raised and when it is resolved
+type configAlerts struct {
+	TempAbove      *float64             `json:"temp_above,omitempty"`
+	StallDutyCycle *float64             `json:"stall_duty_cycle,omitempty"`
+	Interval       string               `json:"interval,omitempty"`
+	Desktop        *configDesktopAlerts `json:"desktop,omitempty"`
+	Hook           *configAlertHook     `json:"hook,omitempty"`
+	Webhooks       []configAlertWebhook `json:"webhooks,omitempty"`
+	Email          *configAlertEmail    `json:"email,omitempty"`
+	// MQTT publishes alerts to the alerts topic of the mqtt bridge
+	MQTT bool `json:"mqtt,omitempty"`
+}
+
+// newAlertWatcher returns the alert watcher of this config, or nil if none is configured. The
+// given heatsinks must be the ones created from this config and the bridge, which may be nil,
+// the one created from its mqtt config
+func (c *config) newAlertWatcher(heatsinks []*heatsink.Heatsink, bridge *mqttBridge) (*alerts.Watcher, error) {
+
+	if c.Alerts == nil {
+		return nil, nil
+	}
+
+	options := []alerts.Option{alerts.OptLogger(c.logger)}
+	if c.Alerts.Interval != "" {
+		interval, err := time.ParseDuration(c.Alerts.Interval)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errBadDuration, err)
+		}
+		options = append(options, alerts.OptInterval(interval))
+	}
+	if c.Alerts.TempAbove != nil {
+		options = append(options, alerts.OptTemperatureThreshold(*c.Alerts.TempAbove))
+	}
+	if c.Alerts.StallDutyCycle != nil {
+		options = append(options, alerts.OptStallDutyCycle(*c.Alerts.StallDutyCycle))
+	}
+
+	if c.Alerts.Desktop != nil {
+		options = append(options, alerts.OptAlerter(c.Alerts.Desktop.newAlerter()))
+	}
+	if c.Alerts.Hook != nil {
+		alerter, err := c.Alerts.Hook.newAlerter()
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, alerts.OptAlerter(alerter))
+	}
+	if c.Alerts.Email != nil {
+		alerter, err := c.Alerts.Email.newAlerter()
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, alerts.OptAlerter(alerter))
+	}
+	for i := range c.Alerts.Webhooks {
+		alerter, err := c.Alerts.Webhooks[i].newAlerter()
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, alerts.OptAlerter(alerter))
+	}
+	if c.Alerts.MQTT {
+		if bridge == nil {
+			return nil, errAlertMQTT
+		}
+		options = append(options, alerts.OptAlerter(bridge.alerter()))
+	}
+
+	fans := c.fans()
+	var targets []alerts.Target
+	for i, hs := range heatsinks {
+		target := alerts.Target{Heatsink: hs, Fan: fans[i].Name}
+		if pattern := fans[i].RpmPathGlob; pattern != "" {
+			rpmFile, err := globOne(pattern)
+			if err != nil {
+				c.logger.Warn(
+					"fan stalls will not be detected without a tachometer",
+					zap.Error(err), zap.String("heatsink", hs.Name()),
+				)
+			} else {
+				target.FanSpeed = func() (int, error) { return readRPM(rpmFile) }
+			}
+		}
+		targets = append(targets, target)
+	}
+	return alerts.New(targets, options...), nil
+}
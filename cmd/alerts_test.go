@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func Test_config_newAlertWatcher(t *testing.T) {
+
+	above, stall := 70.0, 0.5
+	testCases := []struct {
+		name     string
+		alerts   *configAlerts
+		bridge   *mqttBridge
+		expected error
+	}{
+		{name: "disabled"},
+		{name: "defaults", alerts: &configAlerts{}},
+		{
+			name: "alerters",
+			alerts: &configAlerts{
+				TempAbove:      &above,
+				StallDutyCycle: &stall,
+				Interval:       "1s",
+				Desktop:        &configDesktopAlerts{},
+				Hook:           &configAlertHook{Command: []string{"true"}, Timeout: "2s"},
+				Webhooks:       []configAlertWebhook{{URL: "http://localhost/a"}, {URL: "http://localhost/b"}},
+				Email:          &configAlertEmail{Server: "localhost:25", From: "a@example.com", To: []string{"b@example.com"}},
+				MQTT:           true,
+			},
+			bridge: &mqttBridge{},
+		},
+		{name: "no mqtt bridge", alerts: &configAlerts{MQTT: true}, expected: errAlertMQTT},
+		{name: "bad interval", alerts: &configAlerts{Interval: "often"}, expected: errBadDuration},
+		{name: "empty hook", alerts: &configAlerts{Hook: &configAlertHook{}}, expected: errAlertHookCommand},
+		{
+			name:     "bad email",
+			alerts:   &configAlerts{Email: &configAlertEmail{Server: "localhost:25"}},
+			expected: errEmailRecipients,
+		},
+		{
+			name:     "bad webhook",
+			alerts:   &configAlerts{Webhooks: []configAlertWebhook{{URL: "localhost"}}},
+			expected: errWebhookURL,
+		},
+		{
+			name:     "bad hook timeout",
+			alerts:   &configAlerts{Hook: &configAlertHook{Command: []string{"true"}, Timeout: "soon"}},
+			expected: errBadDuration,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &config{Alerts: tc.alerts, logger: zap.NewNop()}
+			w, err := cfg.newAlertWatcher(nil, tc.bridge)
+			if !errors.Is(err, tc.expected) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", tc.expected, err)
+			}
+			if tc.alerts == nil || tc.expected != nil {
+				if w != nil {
+					t.Fatalf("expected no watcher, got: %+v", w)
+				}
+				return
+			}
+			if tc.name == "alerters" && len(w.Alerters()) != 6 {
+				t.Errorf("expected six alerters, got: %d", len(w.Alerters()))
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/malkhamis/heatsink/alerts"
+)
+
+var (
+	errWebhookURL    = errors.New("webhook url must have an 'http' or 'https' scheme")
+	errWebhookStatus = errors.New("unexpected http status from webhook")
+)
+
+const (
+	defaultWebhookTimeout   = 10 * time.Second
+	defaultWebhookRetries   = 3
+	defaultWebhookRateLimit = 10
+	webhookMinBackoff       = time.Second
+)
+
+// configAlertWebhook posts every alert as json to the given url. Requests that fail to connect
+// or are answered with 429 or a 5xx status are retried up to retries times with exponential
+// backoff. At most rate_limit alerts per minute are posted and the others are dropped, with
+// the number of dropped alerts reported along with the next one that is posted
+type configAlertWebhook struct {
+	URL       string            `json:"url"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Timeout   string            `json:"timeout,omitempty"`
+	Retries   *int              `json:"retries,omitempty"`
+	RateLimit int               `json:"rate_limit,omitempty"`
+}
+
+// webhookPayload is the body of a webhook request. Text makes it readable by chat services
+// that accept incoming webhooks, such as Slack
+type webhookPayload struct {
+	alerts.Event
+	Text       string `json:"text"`
+	Suppressed int    `json:"suppressed,omitempty"`
+}
+
+// webhookAlerter posts alerts to a url, limiting the rate with a token bucket that holds up to
+// a minute worth of alerts
+type webhookAlerter struct {
+	url string
+	// host names the webhook in logs, since urls of chat services often embed a secret
+	host    string
+	headers map[string]string
+	timeout time.Duration
+	retries int
+	// backoff is the delay before the first retry, which doubles with every retry
+	backoff time.Duration
+	client  *http.Client
+
+	mutex      sync.Mutex
+	rate       float64
+	tokens     float64
+	refilled   time.Time
+	suppressed int
+	// now is internally used to ease unit testing
+	now func() time.Time
+}
+
+func (c *configAlertWebhook) newAlerter() (*webhookAlerter, error) {
+
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errWebhookURL, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%w, got: '%s'", errWebhookURL, c.URL)
+	}
+	n := &webhookAlerter{
+		url:     c.URL,
+		host:    u.Host,
+		headers: c.Headers,
+		timeout: defaultWebhookTimeout,
+		retries: defaultWebhookRetries,
+		backoff: webhookMinBackoff,
+		client:  http.DefaultClient,
+		rate:    defaultWebhookRateLimit,
+		now:     time.Now,
+	}
+	if c.Timeout != "" {
+		timeout, err := time.ParseDuration(c.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errBadDuration, err)
+		}
+		if timeout > 0 {
+			n.timeout = timeout
+		}
+	}
+	if c.Retries != nil && *c.Retries >= 0 {
+		n.retries = *c.Retries
+	}
+	if c.RateLimit > 0 {
+		n.rate = float64(c.RateLimit)
+	}
+	n.tokens = n.rate
+	return n, nil
+}
+
+func (n *webhookAlerter) Name() string {
+	return "webhook " + n.host
+}
+
+// allow takes a token from the bucket. If there is none, it counts the alert as suppressed and
+// returns false. Otherwise, it returns the number of alerts suppressed since the last allowed one
+func (n *webhookAlerter) allow() (suppressed int, ok bool) {
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	now := n.now()
+	if !n.refilled.IsZero() {
+		n.tokens += now.Sub(n.refilled).Minutes() * n.rate
+		if n.tokens > n.rate {
+			n.tokens = n.rate
+		}
+	}
+	n.refilled = now
+	if n.tokens < 1 {
+		n.suppressed++
+		return 0, false
+	}
+	n.tokens--
+	suppressed, n.suppressed = n.suppressed, 0
+	return suppressed, true
+}
+
+func (n *webhookAlerter) Alert(a alerts.Event) error {
+
+	suppressed, ok := n.allow()
+	if !ok {
+		return nil
+	}
+	body, err := json.Marshal(webhookPayload{
+		Event:      a,
+		Text:       a.Summary() + ": " + a.Message,
+		Suppressed: suppressed,
+	})
+	if err != nil {
+		return err
+	}
+
+	backoff := n.backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := n.post(body)
+		if err == nil || !retry || attempt >= n.retries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post sends the given body once and reports whether a failure is worth retrying
+func (n *webhookAlerter) post(body []byte) (retry bool, err error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), n.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range n.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		// the url is left out of the error as it may embed a secret
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		retry = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode/100 == 5
+		return retry, fmt.Errorf("%w: %s: %s", errWebhookStatus, resp.Status, bytes.TrimSpace(msg))
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return false, nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/malkhamis/heatsink/alerts"
+)
+
+func Test_configAlertWebhook_newAlerter(t *testing.T) {
+
+	retries := 0
+	testCases := []struct {
+		name     string
+		webhook  configAlertWebhook
+		expected error
+	}{
+		{name: "defaults", webhook: configAlertWebhook{URL: "https://hooks.example.com/T000/B000/secret"}},
+		{
+			name: "custom",
+			webhook: configAlertWebhook{
+				URL:       "http://localhost:8080/alerts",
+				Headers:   map[string]string{"Authorization": "Bearer token"},
+				Timeout:   "3s",
+				Retries:   &retries,
+				RateLimit: 2,
+			},
+		},
+		{name: "no url", expected: errWebhookURL},
+		{name: "bad scheme", webhook: configAlertWebhook{URL: "ftp://example.com"}, expected: errWebhookURL},
+		{name: "bad url", webhook: configAlertWebhook{URL: "http://[::1"}, expected: errWebhookURL},
+		{name: "bad timeout", webhook: configAlertWebhook{URL: "http://example.com", Timeout: "1 min"}, expected: errBadDuration},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			n, err := tc.webhook.newAlerter()
+			if !errors.Is(err, tc.expected) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", tc.expected, err)
+			}
+			if err != nil {
+				return
+			}
+			if strings.Contains(n.Name(), "secret") {
+				t.Errorf("expected the name to leave out the path, got: %s", n.Name())
+			}
+			switch tc.name {
+			case "defaults":
+				if n.timeout != defaultWebhookTimeout || n.retries != defaultWebhookRetries || n.rate != defaultWebhookRateLimit {
+					t.Errorf("expected defaults, got: %+v", n)
+				}
+			case "custom":
+				if n.timeout != 3*time.Second || n.retries != 0 || n.rate != 2 {
+					t.Errorf("expected custom settings, got: %+v", n)
+				}
+			}
+		})
+	}
+}
+
+func Test_webhookAlerter_Alert(t *testing.T) {
+
+	var payloads []map[string]interface{}
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Error(err)
+		}
+		payloads = append(payloads, payload)
+		auth = r.Header.Get("Authorization")
+	}))
+	defer server.Close()
+
+	n, err := (&configAlertWebhook{
+		URL:       server.URL,
+		Headers:   map[string]string{"Authorization": "Bearer token"},
+		RateLimit: 2,
+	}).newAlerter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	n.now = func() time.Time { return now }
+
+	a := alerts.Event{Type: alerts.CriticalTemperature, Severity: alerts.SeverityCritical, Heatsink: "cpu", Subject: "core0", Temperature: 95, Message: "cpu reached its critical temperature: 95.0°C", Time: now}
+	for i := 0; i < 4; i++ {
+		if err := n.Alert(a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a token is refilled every 30s with a rate limit of 2 per minute
+	now = now.Add(30 * time.Second)
+	a.Resolved, a.Severity = true, alerts.SeverityInfo
+	if err := n.Alert(a); err != nil {
+		t.Fatal(err)
+	}
+
+	if auth != "Bearer token" {
+		t.Errorf("expected the configured headers, got: '%s'", auth)
+	}
+	expected := []map[string]interface{}{
+		{
+			"event":       "critical_temperature",
+			"severity":    "critical",
+			"resolved":    false,
+			"heatsink":    "cpu",
+			"subject":     "core0",
+			"temperature": 95.0,
+			"message":     "cpu reached its critical temperature: 95.0°C",
+			"time":        "2021-01-02T03:04:05Z",
+			"text":        "Critical temperature: cpu reached its critical temperature: 95.0°C",
+		},
+		{
+			"event":       "critical_temperature",
+			"severity":    "critical",
+			"resolved":    false,
+			"heatsink":    "cpu",
+			"subject":     "core0",
+			"temperature": 95.0,
+			"message":     "cpu reached its critical temperature: 95.0°C",
+			"time":        "2021-01-02T03:04:05Z",
+			"text":        "Critical temperature: cpu reached its critical temperature: 95.0°C",
+		},
+		{
+			"event":       "critical_temperature",
+			"severity":    "info",
+			"resolved":    true,
+			"heatsink":    "cpu",
+			"subject":     "core0",
+			"temperature": 95.0,
+			"message":     "cpu reached its critical temperature: 95.0°C",
+			"time":        "2021-01-02T03:04:05Z",
+			"text":        "Critical temperature resolved: cpu reached its critical temperature: 95.0°C",
+			"suppressed":  2.0,
+		},
+	}
+	if diff := deep.Equal(payloads, expected); diff != nil {
+		t.Fatal(diff)
+	}
+}
+
+func Test_webhookAlerter_Alert_retries(t *testing.T) {
+
+	testCases := []struct {
+		name     string
+		statuses []int
+		attempts int
+		expected error
+	}{
+		{name: "success", statuses: []int{http.StatusNoContent}, attempts: 1},
+		{name: "recovers", statuses: []int{http.StatusBadGateway, http.StatusTooManyRequests, http.StatusOK}, attempts: 3},
+		{name: "gives up", statuses: []int{500, 500, 500, 500, 500}, attempts: 3, expected: errWebhookStatus},
+		{name: "client error", statuses: []int{http.StatusBadRequest, http.StatusOK}, attempts: 1, expected: errWebhookStatus},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			attempts := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ioutil.ReadAll(r.Body)
+				w.WriteHeader(tc.statuses[attempts])
+				attempts++
+			}))
+			defer server.Close()
+
+			retries := 2
+			n, err := (&configAlertWebhook{URL: server.URL, Retries: &retries}).newAlerter()
+			if err != nil {
+				t.Fatal(err)
+			}
+			n.backoff = time.Millisecond
+
+			err = n.Alert(alerts.Event{Type: alerts.ControllerStopped})
+			if !errors.Is(err, tc.expected) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", tc.expected, err)
+			}
+			if attempts != tc.attempts {
+				t.Errorf("expected %d attempts, got: %d", tc.attempts, attempts)
+			}
+		})
+	}
+}
+
+func Test_webhookAlerter_Alert_unreachable(t *testing.T) {
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	retries := 1
+	n, err := (&configAlertWebhook{URL: server.URL + "/secret", Retries: &retries}).newAlerter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.backoff = time.Millisecond
+	err = n.Alert(alerts.Event{Type: alerts.ControllerStopped})
+	if err == nil || strings.Contains(err.Error(), "secret") {
+		t.Fatalf("expected an error without the url, got: %v", err)
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/malkhamis/heatsink"
+	"go.uber.org/zap"
+)
+
+var (
+	errBenchmarkFormat   = errors.New("unknown benchmark format")
+	errBenchmarkStep     = errors.New("benchmark step must be in (0,1]")
+	errBenchmarkHeatsink = errors.New("unknown heatsink")
+)
+
+// benchmarkPollInterval is how often temperatures are read while waiting for them to settle
+var benchmarkPollInterval = time.Second
+
+// benchmarkStep is the outcome of running a fan at a fixed duty cycle until the temperature
+// settled or the step timed out
+type benchmarkStep struct {
+	DutyCycle   float64 `json:"duty_cycle"`
+	Temperature float64 `json:"temperature"`
+	RPM         *int    `json:"rpm,omitempty"`
+	Settled     bool    `json:"settled"`
+}
+
+// benchmark steps a fan through duty cycles and records the steady-state temperature of the
+// hottest sensor and the fan speed at each step
+type benchmark struct {
+	sensors   []heatsink.ThermoSensor
+	fan       heatsink.FanDriver
+	rpmFile   string
+	step      float64
+	window    time.Duration
+	tolerance float64
+	timeout   time.Duration
+	logger    *zap.Logger
+}
+
+// run steps the fan from zero to full duty cycle
+func (b *benchmark) run() ([]benchmarkStep, error) {
+
+	var steps []benchmarkStep
+	for i := 0; ; i++ {
+		// rounding avoids accumulating floating point errors, e.g. 0.30000000000000004
+		dc := math.Min(1, math.Round(float64(i)*b.step*1000)/1000)
+		if err := b.fan.SetDutyCycle(dc); err != nil {
+			return nil, fmt.Errorf("setting fan's duty cycle: %w", err)
+		}
+
+		temp, settled, err := b.settle()
+		if err != nil {
+			return nil, err
+		}
+		result := benchmarkStep{DutyCycle: dc, Temperature: temp, Settled: settled}
+		if b.rpmFile != "" {
+			rpm, err := readRPM(b.rpmFile)
+			if err != nil {
+				return nil, fmt.Errorf("reading fan speed: %w", err)
+			}
+			result.RPM = &rpm
+		}
+		steps = append(steps, result)
+
+		b.logger.Info(
+			"benchmark step completed",
+			zap.Float64("duty_cycle", dc),
+			zap.Float64("temperature", temp),
+			zap.Bool("settled", settled),
+		)
+		if dc >= 1 {
+			return steps, nil
+		}
+	}
+}
+
+// settle polls the hottest sensor until its readings within the settling window vary by no
+// more than the tolerance, and returns their mean. If they do not settle within the timeout,
+// it returns the mean of the last window and false
+func (b *benchmark) settle() (temp float64, settled bool, err error) {
+
+	size := int(b.window/benchmarkPollInterval) + 1
+	if size < 2 {
+		size = 2
+	}
+	var readings []float64
+	deadline := time.Now().Add(b.timeout)
+	for {
+		reading, err := b.maxTemperature()
+		if err != nil {
+			return 0, false, err
+		}
+		readings = append(readings, reading)
+		if len(readings) > size {
+			readings = readings[1:]
+		}
+
+		min, max, sum := math.Inf(1), math.Inf(-1), 0.0
+		for _, r := range readings {
+			min, max, sum = math.Min(min, r), math.Max(max, r), sum+r
+		}
+		mean := sum / float64(len(readings))
+		if len(readings) == size && max-min <= b.tolerance {
+			return mean, true, nil
+		}
+		if time.Now().After(deadline) {
+			return mean, false, nil
+		}
+		time.Sleep(benchmarkPollInterval)
+	}
+}
+
+func (b *benchmark) maxTemperature() (float64, error) {
+	max := math.Inf(-1)
+	for _, sensor := range b.sensors {
+		temp, err := sensor.Temperature()
+		if err != nil {
+			return 0, fmt.Errorf("reading sensor '%s': %w", sensor.Name(), err)
+		}
+		max = math.Max(max, temp)
+	}
+	return max, nil
+}
+
+// close releases the sensors and the fan
+func (b *benchmark) close() {
+	for _, sensor := range b.sensors {
+		if err := sensor.Close(); err != nil {
+			b.logger.Warn("failed to close sensor", zap.Error(err), zap.String("sensor", sensor.Name()))
+		}
+	}
+	if err := b.fan.Close(); err != nil {
+		b.logger.Warn("failed to close fan", zap.Error(err), zap.String("fan", b.fan.Name()))
+	}
+}
+
+// readRPM reads a fan speed from the given tachometer file
+func readRPM(filename string) (int, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+// writeBenchmarkCSV writes the given steps to w as CSV with a header. The speed column is
+// empty if it was not measured
+func writeBenchmarkCSV(w io.Writer, steps []benchmarkStep) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"duty_cycle", "temperature", "rpm", "settled"})
+	for _, s := range steps {
+		rpm := ""
+		if s.RPM != nil {
+			rpm = strconv.Itoa(*s.RPM)
+		}
+		cw.Write([]string{
+			strconv.FormatFloat(s.DutyCycle, 'f', -1, 64),
+			strconv.FormatFloat(s.Temperature, 'f', 2, 64),
+			rpm,
+			strconv.FormatBool(s.Settled),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// runBenchmark implements the 'benchmark' subcommand, which profiles the thermal behavior of a
+// configured heatsink by stepping its fan through duty cycles and reporting the steady-state
+// temperature and fan speed at each step. The daemon must not control the same fan meanwhile
+func runBenchmark(args []string, stdout io.Writer) (exitCode int) {
+
+	logger := newLogger(logSettings{})
+	defer logger.Sync()
+
+	const usage = "benchmark [-heatsink <name>] [-step <ratio>] [-window <duration>] " +
+		"[-tolerance <celsius>] [-timeout <duration>] [-format csv|json] <config>"
+	flags := flag.NewFlagSet("benchmark", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	name := flags.String("heatsink", "", "name of the heatsink to profile (default: the first one)")
+	step := flags.Float64("step", 0.1, "duty cycle increment between steps")
+	window := flags.Duration("window", 30*time.Second, "time the temperature must be stable to be settled")
+	tolerance := flags.Float64("tolerance", 0.5, "maximum temperature variation within a settled window")
+	timeout := flags.Duration("timeout", 10*time.Minute, "maximum time to wait for each step to settle")
+	format := flags.String("format", "csv", "output format: 'csv' or 'json'")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		logger.Error("invalid arguments", zap.String("usage", usage))
+		return 64
+	}
+	if *step <= 0 || *step > 1 {
+		logger.Error("invalid arguments", zap.Error(errBenchmarkStep), zap.String("usage", usage))
+		return 64
+	}
+	if *format != "csv" && *format != "json" {
+		err := fmt.Errorf("%w: '%s'", errBenchmarkFormat, *format)
+		logger.Error("invalid arguments", zap.Error(err), zap.String("usage", usage))
+		return 64
+	}
+	filename := flags.Arg(0)
+
+	file, err := os.Open(filename)
+	if err != nil {
+		logger.Error("opening the given file", zap.Error(err))
+		return 66
+	}
+	defer file.Close()
+
+	cfg, err := newConfig(file, logger)
+	if err != nil {
+		logger.Error("creating heatsink config", zap.Error(err), zap.String("filename", filename))
+		return 78
+	}
+	hsCfg := cfg.Heatsinks[0]
+	if *name != "" {
+		hsCfg = nil
+		for _, c := range cfg.Heatsinks {
+			if c.Name == *name {
+				hsCfg = c
+			}
+		}
+		if hsCfg == nil {
+			err := fmt.Errorf("%w: '%s'", errBenchmarkHeatsink, *name)
+			logger.Error("invalid arguments", zap.Error(err))
+			return 64
+		}
+	}
+
+	b, err := newBenchmark(hsCfg, cfg.named, logger)
+	if err != nil {
+		logger.Error("creating heatsink devices", zap.Error(err), zap.String("heatsink", hsCfg.Name))
+		return 78
+	}
+	defer b.close()
+	b.step, b.window, b.tolerance, b.timeout = *step, *window, *tolerance, *timeout
+
+	steps, err := b.run()
+	if err != nil {
+		logger.Error("running benchmark", zap.Error(err), zap.String("heatsink", hsCfg.Name))
+		return 74
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(steps)
+	} else {
+		err = writeBenchmarkCSV(stdout, steps)
+	}
+	if err != nil {
+		logger.Error("writing benchmark report", zap.Error(err))
+		return 74
+	}
+	return 0
+}
+
+// newBenchmark creates the sensors, the fan, and the tachometer file of the given heatsink
+func newBenchmark(c *configHeatsink, named namedSensors, logger *zap.Logger) (*benchmark, error) {
+
+	b := &benchmark{logger: logger}
+	if c.Fan.RpmPathGlob != "" {
+		rpmFile, err := globOne(c.Fan.RpmPathGlob)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find tachometer of fan '%s': %w", c.Fan.Name, err)
+		}
+		b.rpmFile = rpmFile
+	}
+
+	sensors, err := c.newSensors(named, logger)
+	if err != nil {
+		return nil, err
+	}
+	b.sensors = sensors
+
+	c.Fan.plugins = named.plugins
+	if b.fan, err = c.Fan.newFan(logger); err != nil {
+		for _, sensor := range sensors {
+			sensor.Close()
+		}
+		return nil, fmt.Errorf("failed to create fan '%s': %w", c.Fan.Name, err)
+	}
+	return b, nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/malkhamis/heatsink"
+	"github.com/malkhamis/heatsink/heatsinktest"
+	"go.uber.org/zap"
+)
+
+func Test_benchmark_run(t *testing.T) {
+
+	origInterval := benchmarkPollInterval
+	defer func() { benchmarkPollInterval = origInterval }()
+	benchmarkPollInterval = time.Millisecond
+
+	fan := &heatsinktest.FakeFanDriver{}
+	b := &benchmark{
+		sensors: []heatsink.ThermoSensor{
+			&heatsinktest.FakeThermoSensor{TemperatureVals: []float64{50, 45, 41, 40.2, 40.1, 40.1}},
+			&heatsinktest.FakeThermoSensor{TemperatureVals: []float64{30}},
+		},
+		fan:       fan,
+		step:      0.5,
+		window:    2 * time.Millisecond,
+		tolerance: 0.5,
+		timeout:   time.Second,
+		logger:    zap.NewNop(),
+	}
+
+	steps, err := b.run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(fan.DutyCycles(), []float64{0, 0.5, 1}); diff != nil {
+		t.Fatal(diff)
+	}
+	if len(steps) != 3 || !steps[0].Settled || math.Abs(steps[0].Temperature-40.1333) > 1e-3 {
+		t.Fatalf("expected the first step to settle at the mean of the last window, got: %+v", steps)
+	}
+	if steps[2].Temperature != 40.1 {
+		t.Errorf("unexpected temperature of the last step\nwant: %v\n got: %v", 40.1, steps[2].Temperature)
+	}
+}
+
+func Test_benchmark_settle_timeout(t *testing.T) {
+
+	origInterval := benchmarkPollInterval
+	defer func() { benchmarkPollInterval = origInterval }()
+	benchmarkPollInterval = time.Millisecond
+
+	b := &benchmark{
+		sensors: []heatsink.ThermoSensor{
+			&heatsinktest.FakeThermoSensor{TemperatureVals: []float64{40, 50, 40, 50, 40, 50}},
+		},
+		window:    time.Hour,
+		tolerance: 0.5,
+	}
+
+	temp, settled, err := b.settle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settled || temp != 40 {
+		t.Fatalf("expected an unsettled first reading given no timeout\nwant: 40, false\n got: %v, %v", temp, settled)
+	}
+}
+
+func Test_runBenchmark(t *testing.T) {
+
+	origInterval := benchmarkPollInterval
+	defer func() { benchmarkPollInterval = origInterval }()
+	benchmarkPollInterval = time.Millisecond
+
+	origNewLogger := newLogger
+	defer func() { newLogger = origNewLogger }()
+	newLogger = func(logSettings) *zap.Logger { return zap.NewNop() }
+
+	sensorFile, cleanup := temporaryFile(t)
+	defer cleanup()
+	if _, err := sensorFile.WriteString("40000"); err != nil {
+		t.Fatal(err)
+	}
+	fanFile, cleanup := temporaryFile(t)
+	defer cleanup()
+	rpmFile, cleanup := temporaryFile(t)
+	defer cleanup()
+	if _, err := rpmFile.WriteString("1200\n"); err != nil {
+		t.Fatal(err)
+	}
+	cfgFile, cleanup := temporaryFile(t)
+	defer cleanup()
+	_, err := fmt.Fprintf(cfgFile, `
+    {
+      "heatsinks": [
+        {
+          "name": "hs",
+          "fan": {"path_glob": %q, "rpm_path_glob": %q},
+          "sensor_path_globs": [%q]
+        }
+      ]
+    }
+  `, fanFile.Name(), rpmFile.Name(), sensorFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restoreProcArgs := backupProcArgs(t)
+	defer restoreProcArgs()
+	for _, args := range [][]string{
+		{"-format", "bogus", cfgFile.Name()},
+		{"-step", "0", cfgFile.Name()},
+		{"-heatsink", "unknown", cfgFile.Name()},
+	} {
+		os.Args = append([]string{"program-name", "benchmark"}, args...)
+		if expected, actual := 64, execute(); expected != actual {
+			t.Fatalf("actual exit code doesn't match expected given %v\nwant: %d\n got: %d", args, expected, actual)
+		}
+	}
+
+	var buf bytes.Buffer
+	args := []string{"-heatsink", "hs", "-step", "0.5", "-window", "1ms", cfgFile.Name()}
+	if expected, actual := 0, runBenchmark(args, &buf); expected != actual {
+		t.Fatalf("actual exit code doesn't match expected\nwant: %d\n got: %d", expected, actual)
+	}
+	expected := "duty_cycle,temperature,rpm,settled\n" +
+		"0,40.00,1200,true\n" +
+		"0.5,40.00,1200,true\n" +
+		"1,40.00,1200,true\n"
+	if actual := buf.String(); actual != expected {
+		t.Fatalf("unexpected csv report\nwant: %q\n got: %q", expected, actual)
+	}
+
+	buf.Reset()
+	args = []string{"-step", "1", "-window", "1ms", "-format", "json", cfgFile.Name()}
+	if expected, actual := 0, runBenchmark(args, &buf); expected != actual {
+		t.Fatalf("actual exit code doesn't match expected\nwant: %d\n got: %d", expected, actual)
+	}
+	var steps []benchmarkStep
+	if err := json.Unmarshal(buf.Bytes(), &steps); err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) != 2 || steps[1].RPM == nil || *steps[1].RPM != 1200 {
+		t.Fatalf("unexpected json report: %s", buf.String())
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	errBadDutyCycle = errors.New("duty cycle must be a percentage like '60%', a ratio in [0,1], or 'auto'")
+	errSetArgs      = errors.New("expected a heatsink name and a duty cycle")
+)
+
+// clientUsage is the usage of each client subcommand
+var clientUsage = map[string]string{
+	controlStatus:  "status [-socket <path>] [<heatsink>]",
+	controlSet:     "set [-socket <path>] <heatsink> <duty_cycle>|auto",
+	controlProfile: "profile [-socket <path>] [<profile>|auto]",
+	controlReload:  "reload [-socket <path>]",
+}
+
+// parseDutyCycle parses a duty cycle given either as a percentage, e.g. '60%', or as a ratio,
+// e.g. '0.6'. It returns nil for 'auto'
+func parseDutyCycle(s string) (*float64, error) {
+	if s == autoProfile {
+		return nil, nil
+	}
+	number, scale := s, 1.0
+	if strings.HasSuffix(s, "%") {
+		number, scale = strings.TrimSuffix(s, "%"), 100
+	}
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil || value < 0 || value > scale {
+		return nil, fmt.Errorf("%w: '%s'", errBadDutyCycle, s)
+	}
+	ratio := value / scale
+	return &ratio, nil
+}
+
+// sendControl sends the given request to the daemon listening on the given socket path and
+// returns its response
+func sendControl(path string, req controlRequest) (controlResponse, error) {
+	conn, err := net.DialTimeout("unix", path, controlTimeout)
+	if err != nil {
+		return controlResponse{}, err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(controlTimeout)); err != nil {
+		return controlResponse{}, err
+	}
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return controlResponse{}, err
+	}
+	var resp controlResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return controlResponse{}, err
+	}
+	return resp, nil
+}
+
+// writeStatusText writes the given heatsink states to w as a human-readable table
+func writeStatusText(w io.Writer, all []heatsinkStatus) error {
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "HEATSINK\tSENSOR\tTEMP\tDUTY CYCLE\tMODE\tSTATE")
+	for _, status := range all {
+		mode := "auto"
+		if status.Manual != nil {
+			mode = fmt.Sprintf("manual %.0f%%", 100**status.Manual)
+		}
+		if status.MaxDutyCycle != nil {
+			mode += fmt.Sprintf(", max %.0f%%", 100**status.MaxDutyCycle)
+		}
+		state := "running"
+		switch {
+		case status.Stopped:
+			state = "stopped"
+		case status.Time.IsZero():
+			state = "starting"
+		case status.Critical:
+			state = "critical"
+		}
+		fmt.Fprintf(
+			tw, "%s\t%s\t%.1f\t%.0f%%\t%s\t%s\n",
+			status.Name, status.Sensor, status.Temperature, 100*status.DutyCycle, mode, state,
+		)
+	}
+	return tw.Flush()
+}
+
+// writeProfileText writes the given profile status to w in a human-readable form
+func writeProfileText(w io.Writer, status profileStatus) error {
+	active := status.Active
+	if active == "" {
+		active = "(none)"
+	}
+	if status.Pinned {
+		active += " (pinned)"
+	}
+	_, err := fmt.Fprintf(w, "active: %s\navailable: %s\n", active, strings.Join(status.Available, ", "))
+	return err
+}
+
+// runClient implements the 'status', 'set', 'profile', and 'reload' subcommands, which send
+// the given command to the running daemon over its control socket
+func runClient(command string, args []string, stdout io.Writer) (exitCode int) {
+
+	logger := newLogger(logSettings{})
+	defer logger.Sync()
+
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	socket := flags.String("socket", defaultControlSocket, "control socket of the daemon")
+	err := flags.Parse(args)
+
+	req := controlRequest{Command: command}
+	switch {
+	case err != nil:
+	case command == controlStatus && flags.NArg() <= 1:
+		req.Heatsink = flags.Arg(0)
+	case command == controlSet && flags.NArg() == 2:
+		req.Heatsink = flags.Arg(0)
+		req.DutyCycle, err = parseDutyCycle(flags.Arg(1))
+	case command == controlProfile && flags.NArg() <= 1:
+		req.Profile = flags.Arg(0)
+	case command == controlReload && flags.NArg() == 0:
+	default:
+		err = errTooManyArgs
+		if command == controlSet {
+			err = errSetArgs
+		}
+	}
+	if err != nil {
+		logger.Error("invalid arguments", zap.Error(err), zap.String("usage", clientUsage[command]))
+		return 64
+	}
+
+	resp, err := sendControl(*socket, req)
+	if err != nil {
+		logger.Error("contacting the daemon", zap.Error(err), zap.String("socket", *socket))
+		return 69
+	}
+	if resp.Error != "" {
+		logger.Error("the daemon rejected the command", zap.String("error", resp.Error))
+		return 1
+	}
+
+	switch command {
+	case controlProfile:
+		if resp.Profile != nil {
+			err = writeProfileText(stdout, *resp.Profile)
+		}
+	case controlReload:
+		_, err = fmt.Fprintln(stdout, "reloading")
+	default:
+		err = writeStatusText(stdout, resp.Heatsinks)
+	}
+	if err != nil {
+		logger.Error("writing the response", zap.Error(err))
+		return 74
+	}
+	return 0
+}
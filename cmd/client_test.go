@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"go.uber.org/zap"
+)
+
+func Test_parseDutyCycle(t *testing.T) {
+
+	ratio := func(v float64) *float64 { return &v }
+	testCases := []struct {
+		input       string
+		expected    *float64
+		expectedErr error
+	}{
+		{"60%", ratio(0.6), nil},
+		{"0.25", ratio(0.25), nil},
+		{"100%", ratio(1), nil},
+		{"auto", nil, nil},
+		{"101%", nil, errBadDutyCycle},
+		{"1.5", nil, errBadDutyCycle},
+		{"-1", nil, errBadDutyCycle},
+		{"fast", nil, errBadDutyCycle},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.input, func(t *testing.T) {
+			actual, err := parseDutyCycle(tc.input)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", tc.expectedErr, err)
+			}
+			if diff := deep.Equal(actual, tc.expected); diff != nil {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func Test_writeStatusText(t *testing.T) {
+
+	manual, max := 0.6, 0.8
+	all := []heatsinkStatus{
+		{Name: "cpu", Sensor: "core0", Temperature: 45.25, DutyCycle: 0.6, Manual: &manual, MaxDutyCycle: &max, Time: time.Now()},
+		{Name: "gpu", Sensor: "edge", Temperature: 90, DutyCycle: 1, Critical: true, Time: time.Now()},
+		{Name: "disk"},
+	}
+	var out bytes.Buffer
+	if err := writeStatusText(&out, all); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected a header and a line per heatsink, got:\n%s", out.String())
+	}
+	for i, expected := range [][]string{
+		{"HEATSINK", "TEMP", "DUTY CYCLE"},
+		{"cpu", "core0", "45.2", "60%", "manual 60%, max 80%", "running"},
+		{"gpu", "90.0", "100%", "auto", "critical"},
+		{"disk", "starting"},
+	} {
+		for _, field := range expected {
+			if !strings.Contains(lines[i], field) {
+				t.Errorf("expected %q in line %d, got: %q", field, i, lines[i])
+			}
+		}
+	}
+}
+
+func Test_runClient(t *testing.T) {
+
+	origNewLogger := newLogger
+	defer func() { newLogger = origNewLogger }()
+	newLogger = func(logSettings) *zap.Logger { return zap.NewNop() }
+
+	dir, err := ioutil.TempDir("", "heatsink-client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "heatsink.sock")
+
+	s, cleanup := testControlServer(t, "")
+	defer cleanup()
+	_, stop, err := serveControl(controlSocket{path: path, mode: 0660, gid: -1}, "", false, s.heatsinks, s.profiles, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+	name := s.heatsinks[0].Name()
+
+	testCases := []struct {
+		name     string
+		command  string
+		args     []string
+		expected int
+		output   string
+	}{
+		{"status", controlStatus, []string{"-socket", path}, 0, name},
+		{"set", controlSet, []string{"-socket", path, name, "60%"}, 0, "manual 60%"},
+		{"set auto", controlSet, []string{"-socket", path, name, "auto"}, 0, "auto"},
+		{"profile", controlProfile, []string{"-socket", path, "silent"}, 0, "active: silent (pinned)"},
+		{"profile status", controlProfile, []string{"-socket", path}, 0, "available: silent"},
+		{"unknown heatsink", controlSet, []string{"-socket", path, "nope", "60%"}, 1, ""},
+		{"reload without config", controlReload, []string{"-socket", path}, 1, ""},
+		{"bad duty cycle", controlSet, []string{"-socket", path, name, "fast"}, 64, ""},
+		{"missing duty cycle", controlSet, []string{"-socket", path, name}, 64, ""},
+		{"too many args", controlReload, []string{"-socket", path, "now"}, 64, ""},
+		{"no daemon", controlStatus, []string{"-socket", filepath.Join(dir, "nope.sock")}, 69, ""},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			if actual := runClient(tc.command, tc.args, &stdout); actual != tc.expected {
+				t.Fatalf("actual exit code doesn't match expected\nwant: %d\n got: %d", tc.expected, actual)
+			}
+			if !strings.Contains(stdout.String(), tc.output) {
+				t.Errorf("expected %q in the output, got: %q", tc.output, stdout.String())
+			}
+		})
+	}
+}
@@ -10,48 +10,401 @@ import (
 	"time"
 
 	"github.com/malkhamis/heatsink"
+	"github.com/malkhamis/heatsink/breaker"
+	"github.com/malkhamis/heatsink/cpuload"
+	"github.com/malkhamis/heatsink/expr"
 	"github.com/malkhamis/heatsink/fanpwm"
+	"github.com/malkhamis/heatsink/faultinject"
+	"github.com/malkhamis/heatsink/rapl"
 	"github.com/malkhamis/heatsink/thermosense"
+	"github.com/malkhamis/heatsink/virtsense"
 
 	"go.uber.org/zap"
 )
 
 var (
-	errNoJsonConfig       = errors.New("no json config data given")
-	errNoHeatsinkConfig   = errors.New("no heatsink config in given json data")
-	errBadDuration        = errors.New("error parsing string as duration")
-	errGlobNoMatches      = errors.New("no file matches for the given glob(s)")
-	errGlobTooManyMatches = errors.New("too many matches for the given globe(s)")
-	errFanRespTypeUnknwon = errors.New("unknown fan response type")
+	errNoJsonConfig        = errors.New("no json config data given")
+	errNoHeatsinkConfig    = errors.New("no heatsink config in given json data")
+	errBadDuration         = errors.New("error parsing string as duration")
+	errGlobNoMatches       = errors.New("no file matches for the given glob(s)")
+	errGlobTooManyMatches  = errors.New("too many matches for the given globe(s)")
+	errFanRespTypeUnknwon  = errors.New("unknown fan response type")
+	errSensorNameEmpty     = errors.New("a named sensor must have a name")
+	errSensorNameDup       = errors.New("duplicate sensor name")
+	errSensorNameUnknown   = errors.New("unknown sensor name")
+	errSensorCycle         = errors.New("virtual sensor references itself")
+	errAuxInputTypeUnknown = errors.New("unknown auxiliary input type")
+	errAmbientDeltaRange   = errors.New("invalid ambient delta range")
+	errBadExponent         = errors.New("the exponent of a pow fan response must be positive")
+	errBadSigmoid          = errors.New("a sigmoid fan response needs a midpoint in (0, 1) and a positive steepness")
+	errNoSteps             = errors.New("a steps fan response needs at least one step")
+	errBadCurveExpr        = errors.New("invalid fan response expression")
+	errBadSchedule         = errors.New("invalid schedule")
+	errBadEnablePolicy     = errors.New("unknown pwm enable policy")
+	errBadOnClose          = errors.New("invalid fan close behavior")
+	errPwmOnlySetting      = errors.New("setting is only supported by hwmon pwm fans")
+	errBadPwmOutput        = errors.New("invalid hardware pwm output")
+	errBadSensorCount      = errors.New("invalid required sensor count")
+	errSensorCount         = errors.New("unexpected number of sensors")
 )
 
 type config struct {
-	Heatsinks []*configHeatsink `json:"heatsinks"`
-	logger    *zap.Logger
+	// Schema is the JSON Schema of the config for editors, see the 'schema' subcommand
+	Schema  string `json:"$schema,omitempty"`
+	Version int    `json:"version"`
+	// Include is a list of globs of config files that are merged into this one
+	Include []string `json:"include,omitempty"`
+	// Defaults are the fields that every heatsink inherits unless it sets them itself
+	Defaults       *configHeatsink       `json:"defaults,omitempty"`
+	Heatsinks      []*configHeatsink     `json:"heatsinks"`
+	Zones          []configZone          `json:"zones,omitempty"`
+	Sensors        []configNamedSensor   `json:"sensors,omitempty"`
+	VirtualSensors []configVirtualSensor `json:"virtual_sensors,omitempty"`
+	RemoteSensors  []configRemoteSensor  `json:"remote_sensors,omitempty"`
+	Plugins        []configPlugin        `json:"plugins,omitempty"`
+	Logging        logSettings           `json:"logging"`
+	StateFile      string                `json:"state_file,omitempty"`
+	PolicyHook     *configPolicyHook     `json:"policy_hook,omitempty"`
+	PowerSource    *configPowerSource    `json:"power_source,omitempty"`
+	Telemetry      *configTelemetry      `json:"telemetry,omitempty"`
+	MQTT           *configMQTT           `json:"mqtt,omitempty"`
+	DBus           *configDBus           `json:"dbus,omitempty"`
+	ControlSocket  *configControlSocket  `json:"control_socket,omitempty"`
+	ControlScript  *configControlScript  `json:"control_script,omitempty"`
+	Alerts         *configAlerts         `json:"alerts,omitempty"`
+	Privileges     *configPrivileges     `json:"privileges,omitempty"`
+	WatchConfig    *configWatch          `json:"watch_config,omitempty"`
+	// SysfsRoot is where sysfs is mounted, e.g. /host/sys in a container. Relative path globs
+	// and path globs under /sys are resolved against it
+	SysfsRoot string `json:"sysfs_root,omitempty"`
+	// Strict rejects the config if it has fields the daemon does not know, e.g. typos
+	Strict         bool `json:"strict,omitempty"`
+	raw            []byte
+	logger         *zap.Logger
+	named          namedSensors
+	faultInjection bool
+	dryRun         bool
+	state          daemonState
+	sinks          []sampleSink
 }
 
 type configHeatsink struct {
-	Name            string        `json:"name"`
-	Fan             configFan     `json:"fan"`
-	SensorPathGlobs configSensors `json:"sensor_path_globs"`
-	TempChkPeriod   string        `json:"temp_check_period"`
-	MinTemp         float64       `json:"min_temp"`
-	MaxTemp         float64       `json:"max_temp"`
-	FanRespType     string        `json:"fan_response"`
+	Name            string                   `json:"name"`
+	Fan             configFan                `json:"fan"`
+	SensorPathGlobs configSensors            `json:"sensor_path_globs"`
+	SensorNames     []string                 `json:"sensor_names,omitempty"`
+	ThermalZones    []string                 `json:"thermal_zones,omitempty"`
+	AmbientSensor   string                   `json:"ambient_sensor,omitempty"`
+	AmbientDelta    *configDeltaRange        `json:"ambient_delta_range,omitempty"`
+	ServiceLevels   []configSvcLevel         `json:"service_levels,omitempty"`
+	FaultInjection  *configFaultInjection    `json:"fault_injection,omitempty"`
+	CircuitBreaker  *configCircuitBreaker    `json:"circuit_breaker,omitempty"`
+	LogSummary      *configLogSummary        `json:"log_summary,omitempty"`
+	AuxInputs       []configAuxInput         `json:"aux_inputs,omitempty"`
+	Inputs          []configInput            `json:"inputs,omitempty"`
+	RateOfChange    *configRateOfChange      `json:"rate_of_change,omitempty"`
+	Quarantine      *configQuarantine        `json:"sensor_quarantine,omitempty"`
+	MaxStaleReads   int                      `json:"max_stale_reads,omitempty"`
+	Schedules       []configSchedule         `json:"schedules,omitempty"`
+	Profiles        map[string]configProfile `json:"profiles,omitempty"`
+	SysfsRoot       string                   `json:"sysfs_root,omitempty"`
+	// MinSensors and ExpectedSensors make creating the heatsink fail if it has fewer sensors
+	// than MinSensors, or not exactly ExpectedSensors, counting those of the globs, names, and
+	// thermal zones, e.g. because the sensor of a dead core no longer shows up
+	MinSensors      int `json:"min_sensors,omitempty"`
+	ExpectedSensors int `json:"expected_sensors,omitempty"`
+	// SensorRescan re-evaluates the sensor path globs periodically while the daemon runs, so
+	// that sensors that appear or disappear are added or removed. It is a duration, or a
+	// number of seconds
+	SensorRescan configDuration `json:"sensor_rescan_period,omitempty"`
+	// TempChkPeriod is a duration, or a number of seconds
+	TempChkPeriod   configDuration        `json:"temp_check_period"`
+	ChkPeriodJitter string                `json:"check_period_jitter,omitempty"`
+	PhaseOffset     string                `json:"phase_offset,omitempty"`
+	AdaptivePeriod  *configAdaptivePeriod `json:"adaptive_check_period,omitempty"`
+	CatchUp         bool                  `json:"catch_up_overruns,omitempty"`
+	UnchangedDC     *configUnchangedDC    `json:"unchanged_duty_cycle,omitempty"`
+	MinTemp         float64               `json:"min_temp"`
+	MaxTemp         float64               `json:"max_temp"`
+	CritTemp        float64               `json:"critical_temp,omitempty"`
+	// TripPointLimits derives the temperature limits that are not set from the trip points of
+	// the thermal zones
+	TripPointLimits bool `json:"trip_point_limits,omitempty"`
+	// HwmonLimits derives the maximum and critical temperatures that are not set from the
+	// limits that hwmon chips report for the sensors
+	HwmonLimits *configHwmonLimits `json:"hwmon_limits,omitempty"`
+	// thermalClassDir is where the thermal zones are found after resolving the sysfs root
+	thermalClassDir string
 }
 
 type configFan struct {
-	Name        string `json:"name"`
-	PathGlob    string `json:"path_glob"`
-	PwmPeriod   string `json:"pwm_period"`
-	MinSpeedVal string `json:"min_speed_value"`
-	MaxSpeedVal string `json:"max_speed_value"`
+	Name     string `json:"name"`
+	PathGlob string `json:"path_glob"`
+	// PwmPeriod is a duration, or a number of milliseconds
+	PwmPeriod configDuration `json:"pwm_period"`
+	// MinSpeedVal and MaxSpeedVal are the pwm values in [0, 255] of the minimum and maximum
+	// speeds, which default to 0 and 255
+	MinSpeedVal configSpeed `json:"min_speed_value"`
+	MaxSpeedVal configSpeed `json:"max_speed_value"`
 	// RespType is relevant to configHeatsink. However, presenting it here is user-friendlier
 	RespType string `json:"response_type"`
+	// Exponent is the exponent of the 'pow' response type, e.g. 2.5 for f(x) = x**2.5
+	Exponent float64 `json:"exponent,omitempty"`
+	// Midpoint and Steepness shape the 'sigmoid' response type. The midpoint is a fraction of
+	// the temperature range, e.g. 0.7, and the steepness is typically around 10
+	Midpoint  float64 `json:"midpoint,omitempty"`
+	Steepness float64 `json:"steepness,omitempty"`
+	// Expr is the duty cycle of the 'expr' response type as an expression of the temperature
+	// 't', e.g. "clamp((t-30)/40, 0, 1)^2", which is compiled when the config is loaded
+	Expr string `json:"expr,omitempty"`
+	// Steps are the discrete duty cycles of the 'steps' response type, between which the fan
+	// only moves after the temperature stayed in a step's band for StepDwell
+	Steps     []configStep `json:"steps,omitempty"`
+	StepDwell string       `json:"step_dwell,omitempty"`
+	// RespBounds is relevant to configHeatsink for the same reason as RespType
+	RespBounds *configRespBounds `json:"response_boundaries,omitempty"`
+	// ConflictChkPeriod enables detecting other programs that write to the same pwm file
+	ConflictChkPeriod string `json:"conflict_check_period,omitempty"`
+	ConflictTolerance int    `json:"conflict_tolerance,omitempty"`
+	// EnablePolicy takes manual control through the fan's pwmN_enable file and determines what
+	// happens if the kernel or firmware switches it back to automatic control: 'reassert',
+	// 'yield', or 'fail'. If it is empty, the pwmN_enable file is left alone
+	EnablePolicy string `json:"pwm_enable_policy,omitempty"`
+	// OnClose is what the fan is left at when the daemon exits: 'max', which is the default,
+	// 'min', 'value', which is ExitValue, 'restore', or 'leave'. If it is empty, RestoreOnExit
+	// selects 'restore' and ExitValue selects 'value'. ExitMode is written to the pwmN_enable
+	// file after the value unless the fan is left alone
+	OnClose       string `json:"on_close,omitempty"`
+	RestoreOnExit bool   `json:"restore_on_exit,omitempty"`
+	ExitValue     string `json:"exit_value,omitempty"`
+	ExitMode      string `json:"exit_mode,omitempty"`
+	// Inverted drives a fan whose header or board inverts the pwm signal, so that a pwm value of
+	// 0 spins it at full speed. The speed values still denote the slowest and fastest speeds
+	Inverted bool `json:"inverted,omitempty"`
+	// PwmFrequency and PwmMode set the hardware pwm signal through the pwmN_freq and pwmN_mode
+	// files while the daemon runs, where the frequency is in Hz and the mode is 'dc' or 'pwm'.
+	// If they are not set, the files are left alone
+	PwmFrequency int    `json:"pwm_frequency,omitempty"`
+	PwmMode      string `json:"pwm_mode,omitempty"`
+	// WriteVerify reads back every pwm value written to verify that the fan controller
+	// accepted it
+	WriteVerify *configWriteVerify `json:"write_verification,omitempty"`
+	// RpmPathGlob matches the fan's tachometer file, e.g. fan1_input, which is read by 'benchmark'
+	RpmPathGlob string `json:"rpm_path_glob,omitempty"`
+	// Remote drives a fan of another host through an agent instead of a local pwm file
+	Remote *configRemoteFan `json:"remote,omitempty"`
+	// dryRun replaces the pwm fan with one that only logs the duty cycles it would have set
+	dryRun bool
+	// plugins are those of the config, among which that of a 'plugin:' path glob is looked up
+	plugins pluginSet
+	// curve is Expr as compiled when the config was loaded
+	curve *expr.Expr
 }
 
 type configSensors []string
 
+// configWriteVerify configures retrying pwm writes that did not read back with exponential
+// backoff, and logging an event once FailAfter consecutive writes failed
+type configWriteVerify struct {
+	Retries   int    `json:"retries,omitempty"`
+	Backoff   string `json:"backoff,omitempty"`
+	Tolerance int    `json:"tolerance,omitempty"`
+	FailAfter int    `json:"fail_after,omitempty"`
+}
+
+// configStep is a duty cycle that applies while the temperature is above a threshold
+type configStep struct {
+	AboveTemp float64 `json:"above_temp"`
+	DutyCycle float64 `json:"duty_cycle"`
+}
+
+// stepsOption returns the heatsink option for the steps of this fan
+func (c configFan) stepsOption() (heatsink.Option, error) {
+	if len(c.Steps) == 0 {
+		return nil, errNoSteps
+	}
+	dwell, err := time.ParseDuration(c.StepDwell)
+	if err != nil && c.StepDwell != "" {
+		return nil, fmt.Errorf("%w: %v", errBadDuration, err)
+	}
+	steps := make([]heatsink.Step, len(c.Steps))
+	for i, step := range c.Steps {
+		steps[i] = heatsink.Step{AboveTemp: step.AboveTemp, DutyCycle: step.DutyCycle}
+	}
+	return heatsink.OptSteps(steps, dwell), nil
+}
+
+// curveVar is the variable that holds the temperature in the expression of a fan response
+const curveVar = "t"
+
+// compileCurve compiles the expression of the 'expr' response type of this fan, which may only
+// refer to the temperature
+func (c configFan) compileCurve() (*expr.Expr, error) {
+	compiled, err := expr.Parse(c.Expr)
+	if err != nil {
+		return nil, fmt.Errorf("%w %q: %v", errBadCurveExpr, c.Expr, err)
+	}
+	for _, v := range compiled.Vars() {
+		if v != curveVar {
+			return nil, fmt.Errorf("%w %q: unknown variable '%s', use '%s'", errBadCurveExpr, c.Expr, v, curveVar)
+		}
+	}
+	return compiled, nil
+}
+
+// exprOption returns the heatsink option for the expression of this fan, which is compiled
+// unless it was when the config was loaded
+func (c configFan) exprOption() (heatsink.Option, error) {
+	compiled := c.curve
+	if compiled == nil {
+		var err error
+		if compiled, err = c.compileCurve(); err != nil {
+			return nil, err
+		}
+	}
+	return heatsink.OptFanResponseFunc(func(temp float64) (float64, error) {
+		return compiled.Eval(map[string]float64{curveVar: temp})
+	}), nil
+}
+
+// configRespBounds sets the duty cycle at and beyond the minimum and maximum temperatures
+type configRespBounds struct {
+	Min *configBoundary `json:"min,omitempty"`
+	Max *configBoundary `json:"max,omitempty"`
+}
+
+// configBoundary is a duty cycle applied beyond a temperature boundary and, unless inclusive
+// is false, exactly at it
+type configBoundary struct {
+	DutyCycle float64 `json:"duty_cycle"`
+	Inclusive *bool   `json:"inclusive,omitempty"`
+}
+
+// option returns the heatsink option for these boundaries. Omitted boundaries keep their
+// default behavior
+func (c configRespBounds) option() heatsink.Option {
+	lower := heatsink.Boundary{DutyCycle: 0, Inclusive: true}
+	upper := heatsink.Boundary{DutyCycle: 1, Inclusive: true}
+	for _, b := range []struct {
+		cfg    *configBoundary
+		target *heatsink.Boundary
+	}{{c.Min, &lower}, {c.Max, &upper}} {
+		if b.cfg == nil {
+			continue
+		}
+		b.target.DutyCycle = b.cfg.DutyCycle
+		if b.cfg.Inclusive != nil {
+			b.target.Inclusive = *b.cfg.Inclusive
+		}
+	}
+	return heatsink.OptBoundaries(lower, upper)
+}
+
+// configRateOfChange ramps up the fan earlier on rising temperatures by projecting them gain
+// seconds ahead, and limits decreasing the duty cycle to relax_rate per second
+type configRateOfChange struct {
+	Gain      float64 `json:"gain,omitempty"`
+	RelaxRate float64 `json:"relax_rate,omitempty"`
+}
+
+// configQuarantine leaves out the readings of sensors that fail, jump by more than max_jump
+// degrees between reads, or repeat the same reading stuck_reads times, once fewer than
+// min_score of their last window reads were good, until they read well readmit times in a row
+type configQuarantine struct {
+	MaxJump    float64 `json:"max_jump,omitempty"`
+	StuckReads int     `json:"stuck_reads,omitempty"`
+	Window     int     `json:"window,omitempty"`
+	MinScore   float64 `json:"min_score,omitempty"`
+	Readmit    int     `json:"readmit,omitempty"`
+}
+
+// configAdaptivePeriod doubles the check period, up to max_period, after each check where the
+// temperature is below calm_below and changed by at most max_rate degrees per second
+type configAdaptivePeriod struct {
+	MaxPeriod string  `json:"max_period"`
+	MaxRate   float64 `json:"max_rate"`
+	CalmBelow float64 `json:"calm_below,omitempty"`
+}
+
+// configUnchangedDC skips applying a duty cycle within epsilon of the last applied one, which
+// is reapplied every refresh interval nonetheless. An empty refresh keeps the default and a
+// negative epsilon applies every duty cycle
+type configUnchangedDC struct {
+	Epsilon float64 `json:"epsilon,omitempty"`
+	Refresh string  `json:"refresh,omitempty"`
+}
+
+// configDeltaRange is the range of the difference between the hottest sensor and the ambient
+// sensor over which the fan speeds up, while min_temp and max_temp apply to the absolute
+// temperature if the ambient sensor fails
+type configDeltaRange struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+// configAuxInput is an auxiliary signal whose readings between low and high are mapped to a
+// minimum duty cycle between zero and one. The type "rapl" reads watts, and its path glob must
+// match a single RAPL domain directory. The type "cpu_load" reads the utilization of all CPUs
+// in percent, optionally smoothed over a duration, and its path glob defaults to /proc/stat
+type configAuxInput struct {
+	Type      string  `json:"type"`
+	Name      string  `json:"name,omitempty"`
+	PathGlob  string  `json:"path_glob"`
+	Low       float64 `json:"low"`
+	High      float64 `json:"high"`
+	Smoothing string  `json:"smoothing,omitempty"`
+}
+
+// configLogSummary periodically logs a summary of temperatures and duty cycles of a heatsink
+type configLogSummary struct {
+	Iterations int    `json:"iterations,omitempty"`
+	Period     string `json:"period,omitempty"`
+}
+
+// configCircuitBreaker guards each sensor and the fan of a heatsink with a circuit breaker
+type configCircuitBreaker struct {
+	FailureThreshold int    `json:"failure_threshold,omitempty"`
+	OpenDuration     string `json:"open_duration,omitempty"`
+	SensorTimeout    string `json:"sensor_timeout,omitempty"`
+	FanTimeout       string `json:"fan_timeout,omitempty"`
+}
+
+// configFaultInjection injects faults into the devices of a heatsink for chaos testing. It is
+// ignored unless the daemon is started with the 'fault-injection' flag
+type configFaultInjection struct {
+	Sensors configFaults `json:"sensors"`
+	Fan     configFaults `json:"fan"`
+}
+
+// configFaults describes the faults injected into a device. Each sensor of a heatsink uses the
+// given seed plus its index, so random failures of different sensors are not synchronized
+type configFaults struct {
+	ErrorRate      float64 `json:"error_rate,omitempty"`
+	FailEvery      int     `json:"fail_every,omitempty"`
+	Delay          string  `json:"delay,omitempty"`
+	OutageAfter    string  `json:"outage_after,omitempty"`
+	OutageDuration string  `json:"outage_duration,omitempty"`
+	Seed           int64   `json:"seed,omitempty"`
+}
+
+// configSvcLevel is a minimum duty cycle that is enforced while the temperature is above a limit
+type configSvcLevel struct {
+	AboveTemp    float64 `json:"above_temp"`
+	MinDutyCycle float64 `json:"min_duty_cycle"`
+}
+
+// configNamedSensor is a physical sensor that is defined once and referenced by name
+type configNamedSensor struct {
+	Name     string `json:"name"`
+	PathGlob string `json:"path_glob"`
+}
+
+// configVirtualSensor is a sensor whose temperature is an expression over other named sensors
+type configVirtualSensor struct {
+	Name       string `json:"name"`
+	Expression string `json:"expression"`
+}
+
 func newConfig(jsonData io.Reader, logger *zap.Logger) (*config, error) {
 
 	if jsonData == nil {
@@ -62,35 +415,157 @@ func newConfig(jsonData io.Reader, logger *zap.Logger) (*config, error) {
 		logger = zap.NewNop()
 	}
 
-	cfg := &config{logger: logger}
-	if err := json.NewDecoder(jsonData).Decode(cfg); err != nil {
+	raw, fromVersion, err := decodeMigratedRaw(jsonData)
+	if err != nil {
 		return nil, fmt.Errorf("error decoding json config: %w", err)
 	}
+	if fromVersion != currentConfigVersion {
+		logger.Warn(
+			"config schema is outdated and was upgraded in memory, consider running 'migrate'",
+			zap.Int("from_version", fromVersion),
+			zap.Int("to_version", currentConfigVersion),
+		)
+	}
+	if err := includeConfigs(raw, configFilename(jsonData), fromVersion, logger); err != nil {
+		return nil, err
+	}
+	if err := applyDefaults(raw); err != nil {
+		return nil, err
+	}
+	migrated, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding json config: %w", err)
+	}
+
+	cfg := &config{logger: logger, raw: migrated}
+	if err := json.Unmarshal(migrated, cfg); err != nil {
+		return nil, fmt.Errorf("error decoding json config: %w", err)
+	}
+	if cfg.Strict {
+		if err := cfg.rejectUnknownFields(); err != nil {
+			return nil, err
+		}
+	}
 
 	for _, hs := range cfg.Heatsinks {
-		if hs.Fan.RespType == "" {
+		switch {
+		case hs.Fan.RespType == "" && hs.Fan.Expr != "":
+			hs.Fan.RespType = "expr"
+		case hs.Fan.RespType == "":
 			hs.Fan.RespType = "PowPi"
 		}
+		if strings.EqualFold(hs.Fan.RespType, "expr") {
+			if hs.Fan.curve, err = hs.Fan.compileCurve(); err != nil {
+				return nil, fmt.Errorf("heatsink '%s': %w", hs.Name, err)
+			}
+		}
+		if _, _, err := hs.Fan.speedRange(); err != nil {
+			return nil, fmt.Errorf("heatsink '%s': %w", hs.Name, err)
+		}
+		if err := hs.validateSensorCounts(); err != nil {
+			return nil, fmt.Errorf("heatsink '%s': %w", hs.Name, err)
+		}
 	}
 
 	if len(cfg.Heatsinks) == 0 {
 		return nil, errNoHeatsinkConfig
 	}
+	if err := cfg.validateZones(); err != nil {
+		return nil, err
+	}
+	cfg.resolveSysfsPaths()
+
+	if err := cfg.Logging.validate(); err != nil {
+		return nil, fmt.Errorf("invalid logging config: %w", err)
+	}
+
+	if _, err := cfg.ControlSocket.resolve(nil); err != nil {
+		return nil, err
+	}
+
+	if cfg.Privileges != nil {
+		if _, err := cfg.Privileges.resolve(); err != nil {
+			return nil, err
+		}
+	}
+
+	named, err := newNamedSensors(cfg.Sensors, cfg.VirtualSensors, cfg.RemoteSensors)
+	if err != nil {
+		return nil, err
+	}
+	cfg.named = named
+	if cfg.named.plugins, err = newPlugins(cfg.Plugins); err != nil {
+		return nil, err
+	}
 
 	return cfg, nil
 }
 
 func (c *config) newHeatsinks() ([]*heatsink.Heatsink, error) {
 
+	sinks, err := c.Telemetry.newSinks(c.logger)
+	if err != nil {
+		return nil, fmt.Errorf("invalid telemetry config: %w", err)
+	}
+	c.sinks = sinks
+
 	var heatsinks []*heatsink.Heatsink
 	for _, hsCfg := range c.Heatsinks {
-		hs, err := hsCfg.newHeatsink(c.logger)
+		if hsCfg.FaultInjection != nil && !c.faultInjection {
+			c.logger.Warn(
+				"ignoring fault injection config, use the 'fault-injection' flag to enable it",
+				zap.String("heatsink", hsCfg.Name),
+			)
+			hsCfg.FaultInjection = nil
+		}
+		hsCfg.Fan.dryRun = c.dryRun
+		hsCfg.Fan.plugins = c.named.plugins
+		saved := c.state.Heatsinks[hsCfg.Name]
+		opts := saved.options()
+		var hs *heatsink.Heatsink
+		if len(sinks) > 0 {
+			// the samples are only emitted once thermal control starts, i.e. after hs is set
+			opts = append(opts, heatsink.OptSampleHandler(func(smpl heatsink.Sample) {
+				for _, sink := range sinks {
+					sink.write(hs.Name(), smpl)
+				}
+			}))
+		}
+		hs, err = hsCfg.newHeatsink(c.named, c.logger, opts...)
 		if err != nil {
+			// release the devices of the heatsinks created so far, e.g. the locks of their fans
+			for _, created := range heatsinks {
+				created.StopThermalControl()
+			}
 			return nil, fmt.Errorf("heatsink '%s': %w", hsCfg.Name, err)
 		}
+		saved.restore(hs)
 		heatsinks = append(heatsinks, hs)
 	}
 
+	// zones come last, so the heatsinks keep the indices of their configs
+	for _, zoneCfg := range c.Zones {
+		zoneCfg.Fan.dryRun = c.dryRun
+		zoneCfg.Fan.plugins = c.named.plugins
+		var zone *heatsink.Heatsink
+		var opts []heatsink.Option
+		if len(sinks) > 0 {
+			opts = append(opts, heatsink.OptSampleHandler(func(smpl heatsink.Sample) {
+				for _, sink := range sinks {
+					sink.write(zone.Name(), smpl)
+				}
+			}))
+		}
+		zone, err = zoneCfg.newZone(heatsinks, c.logger, opts...)
+		if err != nil {
+			for _, created := range heatsinks {
+				created.StopThermalControl()
+			}
+			return nil, fmt.Errorf("zone '%s': %w", zoneCfg.Name, err)
+		}
+		heatsinks = append(heatsinks, zone)
+	}
+
 	c.logger.Info(
 		"all heatsinks were created successfully",
 		zap.Int("heatsink-count", len(heatsinks)),
@@ -98,23 +573,199 @@ func (c *config) newHeatsinks() ([]*heatsink.Heatsink, error) {
 	return heatsinks, nil
 }
 
-func (c *configHeatsink) newHeatsink(logger *zap.Logger) (*heatsink.Heatsink, error) {
+func (c *configHeatsink) newHeatsink(
+	named namedSensors, logger *zap.Logger, extra ...heatsink.Option,
+) (*heatsink.Heatsink, error) {
 
-	tempChkPeriod, err := time.ParseDuration(c.TempChkPeriod)
-	if err != nil && c.TempChkPeriod != "" {
-		return nil, fmt.Errorf("%w: %v", errBadDuration, err)
+	tempChkPeriod, err := c.TempChkPeriod.duration("temp_check_period", time.Second)
+	if err != nil {
+		return nil, err
+	}
+	// a zero period, i.e. an empty one, falls back to the default
+	var timing [2]time.Duration
+	for i, d := range []string{c.ChkPeriodJitter, c.PhaseOffset} {
+		if d == "" {
+			continue
+		}
+		if timing[i], err = time.ParseDuration(d); err != nil {
+			return nil, fmt.Errorf("%w: %v", errBadDuration, err)
+		}
 	}
-	// otherwise, it is empty and we assume the zero-value will fallback to default
 
-	sensors, err := c.SensorPathGlobs.newSensors(logger)
+	for name, profile := range c.Profiles {
+		if name == autoProfile || name == "" {
+			return nil, fmt.Errorf("%w: '%s' is a reserved name", errBadProfile, name)
+		}
+		if err := profile.validate(); err != nil {
+			return nil, fmt.Errorf("profile '%s': %w", name, err)
+		}
+	}
+
+	var optAdaptive heatsink.Option
+	if c.AdaptivePeriod != nil {
+		maxPeriod, err := time.ParseDuration(c.AdaptivePeriod.MaxPeriod)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errBadDuration, err)
+		}
+		optAdaptive = heatsink.OptAdaptiveCheckPeriod(maxPeriod, c.AdaptivePeriod.MaxRate, c.AdaptivePeriod.CalmBelow)
+	}
+
+	var optUnchanged heatsink.Option
+	if c.UnchangedDC != nil {
+		refresh := time.Minute
+		if c.UnchangedDC.Refresh != "" {
+			if refresh, err = time.ParseDuration(c.UnchangedDC.Refresh); err != nil {
+				return nil, fmt.Errorf("%w: %v", errBadDuration, err)
+			}
+		}
+		optUnchanged = heatsink.OptUnchangedDutyCycle(c.UnchangedDC.Epsilon, refresh)
+	}
+
+	if c.AmbientDelta != nil && (c.AmbientSensor == "" || c.AmbientDelta.Min >= c.AmbientDelta.Max) {
+		return nil, fmt.Errorf(
+			"%w: [%v, %v] requires an ambient sensor and min less than max",
+			errAmbientDeltaRange, c.AmbientDelta.Min, c.AmbientDelta.Max,
+		)
+	}
+
+	var optSchedules []heatsink.Option
+	for _, sc := range c.Schedules {
+		opt, err := sc.option()
+		if err != nil {
+			return nil, err
+		}
+		optSchedules = append(optSchedules, opt)
+	}
+
+	var optSummary heatsink.Option
+	if c.LogSummary != nil {
+		period, err := time.ParseDuration(c.LogSummary.Period)
+		if err != nil && c.LogSummary.Period != "" {
+			return nil, fmt.Errorf("%w: %v", errBadDuration, err)
+		}
+		optSummary = heatsink.OptPeriodicSummary(c.LogSummary.Iterations, period)
+	}
+
+	var sensorFaults, fanFaults []faultinject.Option
+	if c.FaultInjection != nil {
+		if sensorFaults, err = c.FaultInjection.Sensors.options(); err != nil {
+			return nil, fmt.Errorf("invalid sensor fault injection: %w", err)
+		}
+		if fanFaults, err = c.FaultInjection.Fan.options(); err != nil {
+			return nil, fmt.Errorf("invalid fan fault injection: %w", err)
+		}
+	}
+
+	var sensorBreaker, fanBreaker []breaker.Option
+	if c.CircuitBreaker != nil {
+		sensorBreaker, fanBreaker, err = c.CircuitBreaker.options(logger)
+		if err != nil {
+			return nil, fmt.Errorf("invalid circuit breaker: %w", err)
+		}
+	}
+
+	var (
+		sensors   []heatsink.ThermoSensor
+		inputs    []heatsink.Input
+		ambient   heatsink.ThermoSensor
+		fan       heatsink.FanDriver
+		auxInputs []heatsink.AuxInput
+	)
+	// the devices hold open files, plugin processes, or locks, e.g. of the fan's device file,
+	// until they are closed, which is up to the heatsink once it is created
+	created := false
+	defer func() {
+		if created {
+			return
+		}
+		for _, sensor := range sensors {
+			_ = sensor.Close()
+		}
+		for _, in := range inputs {
+			for _, sensor := range in.Sensors {
+				_ = sensor.Close()
+			}
+		}
+		if ambient != nil {
+			_ = ambient.Close()
+		}
+		if fan != nil {
+			_ = fan.Close()
+		}
+		for _, aux := range auxInputs {
+			_ = aux.Close()
+		}
+	}()
+
+	sensors, err = c.newSensors(named, logger)
+	if err != nil {
+		return nil, err
+	}
+	for _, inCfg := range c.Inputs {
+		in, err := inCfg.newInput(named, logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create input '%s': %w", inCfg.Name, err)
+		}
+		inputs = append(inputs, in)
+	}
+	minTemp, maxTemp, critTemp, err := c.temperatureLimits(logger)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create all sensors: %w", err)
+		return nil, fmt.Errorf("failed to derive temperature limits: %w", err)
 	}
 
-	fan, err := c.Fan.newFan(logger)
+	if c.AmbientSensor != "" {
+		sensor, err := named.newSensor(c.AmbientSensor, logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create ambient sensor '%s': %w", c.AmbientSensor, err)
+		}
+		ambient = sensor
+	}
+
+	driver, err := c.Fan.newFan(logger)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create fan '%s': %w", c.Fan.Name, err)
 	}
+	fan = driver
+
+	if c.FaultInjection != nil {
+		seed := c.FaultInjection.Sensors.Seed
+		for i := range sensors {
+			sensors[i] = faultinject.NewSensor(
+				sensors[i], append(sensorFaults, faultinject.OptSeed(seed+int64(i)))...,
+			)
+		}
+		if ambient != nil {
+			ambient = faultinject.NewSensor(
+				ambient, append(sensorFaults, faultinject.OptSeed(seed+int64(len(sensors))))...,
+			)
+		}
+		offset := len(sensors) + 1
+		for _, in := range inputs {
+			for i := range in.Sensors {
+				in.Sensors[i] = faultinject.NewSensor(
+					in.Sensors[i], append(sensorFaults, faultinject.OptSeed(seed+int64(offset)))...,
+				)
+				offset++
+			}
+		}
+		fan = faultinject.NewFan(fan, fanFaults...)
+		logger.Warn("injecting faults into heatsink devices", zap.String("heatsink", c.Name))
+	}
+
+	if c.CircuitBreaker != nil {
+		for i := range sensors {
+			sensors[i] = breaker.NewSensor(sensors[i], sensorBreaker...)
+		}
+		if ambient != nil {
+			ambient = breaker.NewSensor(ambient, sensorBreaker...)
+		}
+		for _, in := range inputs {
+			for i := range in.Sensors {
+				in.Sensors[i] = breaker.NewSensor(in.Sensors[i], sensorBreaker...)
+			}
+		}
+		fan = breaker.NewFan(fan, fanBreaker...)
+	}
 
 	var optRespType heatsink.Option
 	switch strings.ToLower(c.Fan.RespType) {
@@ -122,64 +773,435 @@ func (c *configHeatsink) newHeatsink(logger *zap.Logger) (*heatsink.Heatsink, er
 		optRespType = heatsink.OptFanResponse(heatsink.FanResponseLinear)
 	case "powpi":
 		optRespType = heatsink.OptFanResponse(heatsink.FanResponsePowPi)
+	case "pow":
+		if c.Fan.Exponent <= 0 {
+			return nil, fmt.Errorf("%w: %v", errBadExponent, c.Fan.Exponent)
+		}
+		optRespType = heatsink.OptFanResponsePow(c.Fan.Exponent)
+	case "sigmoid":
+		if c.Fan.Midpoint <= 0 || c.Fan.Midpoint >= 1 || c.Fan.Steepness <= 0 {
+			return nil, fmt.Errorf("%w: midpoint %v, steepness %v", errBadSigmoid, c.Fan.Midpoint, c.Fan.Steepness)
+		}
+		optRespType = heatsink.OptFanResponseSigmoid(c.Fan.Midpoint, c.Fan.Steepness)
+	case "steps":
+		if optRespType, err = c.Fan.stepsOption(); err != nil {
+			return nil, err
+		}
+	case "expr":
+		if optRespType, err = c.Fan.exprOption(); err != nil {
+			return nil, err
+		}
 	default:
 		return nil, fmt.Errorf("%w: '%s'", errFanRespTypeUnknwon, c.Fan.RespType)
 	}
 
+	opts := []heatsink.Option{
+		optRespType,
+		heatsink.OptTemperatureCheckPeriod(tempChkPeriod),
+		heatsink.OptCheckPeriodJitter(timing[0]),
+		heatsink.OptPhaseOffset(timing[1]),
+		optAdaptive,
+		optUnchanged,
+		heatsink.OptCatchUpOverruns(c.CatchUp),
+		heatsink.OptLogger(logger),
+		heatsink.OptAmbientSensor(ambient),
+		optSummary,
+	}
+	if c.Name != "" {
+		opts = append(opts, heatsink.OptName(c.Name))
+	}
+	if c.Fan.RespBounds != nil {
+		opts = append(opts, c.Fan.RespBounds.option())
+	}
+	if critTemp != 0 {
+		opts = append(opts, heatsink.OptCriticalTemperature(critTemp))
+	}
+	if c.AmbientDelta != nil {
+		opts = append(opts, heatsink.OptAmbientDeltaRange(c.AmbientDelta.Min, c.AmbientDelta.Max))
+	}
+	opts = append(opts, extra...)
+	for _, sl := range c.ServiceLevels {
+		opts = append(opts, heatsink.OptServiceLevel(sl.AboveTemp, sl.MinDutyCycle))
+	}
+	for _, auxCfg := range c.AuxInputs {
+		aux, err := auxCfg.newAuxInput(logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create auxiliary input '%s': %w", auxCfg.Name, err)
+		}
+		auxInputs = append(auxInputs, aux)
+		opts = append(opts, heatsink.OptAuxInput(aux, auxCfg.Low, auxCfg.High))
+	}
+	for _, in := range inputs {
+		opts = append(opts, heatsink.OptInput(in))
+	}
+	if c.RateOfChange != nil {
+		opts = append(opts, heatsink.OptRateOfChange(c.RateOfChange.Gain, c.RateOfChange.RelaxRate))
+	}
+	if c.Quarantine != nil {
+		opts = append(opts, heatsink.OptSensorQuarantine(heatsink.SensorQuarantine(*c.Quarantine)))
+	}
+	if c.MaxStaleReads > 0 {
+		opts = append(opts, heatsink.OptLastKnownGood(c.MaxStaleReads))
+	}
+	opts = append(opts, optSchedules...)
+
 	hs, err := heatsink.New(
 		&heatsink.Config{
 			Fan:            fan,
 			Sensors:        sensors,
-			MinTemperature: c.MinTemp,
-			MaxTemperature: c.MaxTemp,
+			MinTemperature: minTemp,
+			MaxTemperature: maxTemp,
 		},
-		optRespType,
-		heatsink.OptName(c.Name),
-		heatsink.OptTemperatureCheckPeriod(tempChkPeriod),
-		heatsink.OptLogger(logger),
+		opts...,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create heatsink: %w", err)
 	}
+	created = true
 
 	logger.Info(
 		"created heatsink",
 		zap.String("name", c.Name),
 		zap.String("temp_check_period", tempChkPeriod.String()),
-		zap.Float64("min_temp", c.MinTemp),
-		zap.Float64("max_temp", c.MaxTemp),
+		zap.Float64("min_temp", minTemp),
+		zap.Float64("max_temp", maxTemp),
+		zap.Float64("critical_temp", critTemp),
+		zap.String("ambient_sensor", c.AmbientSensor),
 	)
 	return hs, nil
 }
 
+// newSensors creates the sensors matched by the path globs and the referenced named sensors.
+// If any of them cannot be created, those created so far are closed
+func (c *configHeatsink) newSensors(
+	named namedSensors, logger *zap.Logger,
+) (sensors []heatsink.ThermoSensor, err error) {
+
+	defer func() {
+		if err != nil {
+			for _, sensor := range sensors {
+				_ = sensor.Close()
+			}
+			sensors = nil
+		}
+	}()
+
+	if len(c.SensorPathGlobs) > 0 || (len(c.SensorNames) == 0 && len(c.ThermalZones) == 0) {
+		if sensors, err = c.SensorPathGlobs.newSensors(logger); err != nil {
+			return sensors, fmt.Errorf("failed to create all sensors: %w", err)
+		}
+	}
+	zones, err := c.thermalZones()
+	if err != nil {
+		return sensors, fmt.Errorf("failed to create all sensors: %w", err)
+	}
+	for _, zone := range zones {
+		sensor, err := newThermalZoneSensor(zone, logger)
+		if err != nil {
+			return sensors, err
+		}
+		sensors = append(sensors, sensor)
+	}
+	for _, name := range c.SensorNames {
+		sensor, err := named.newSensor(name, logger)
+		if err != nil {
+			return sensors, fmt.Errorf("failed to create sensor '%s': %w", name, err)
+		}
+		sensors = append(sensors, sensor)
+	}
+	if err := c.checkSensorCount(sensors); err != nil {
+		return sensors, err
+	}
+	return sensors, nil
+}
+
+// validateSensorCounts returns an error if the required sensor counts contradict each other
+func (c *configHeatsink) validateSensorCounts() error {
+	switch {
+	case c.MinSensors < 0 || c.ExpectedSensors < 0:
+		return fmt.Errorf("%w: min_sensors and expected_sensors must not be negative", errBadSensorCount)
+	case c.ExpectedSensors > 0 && c.MinSensors > c.ExpectedSensors:
+		return fmt.Errorf(
+			"%w: min_sensors %d exceeds expected_sensors %d", errBadSensorCount, c.MinSensors, c.ExpectedSensors,
+		)
+	}
+	return nil
+}
+
+// checkSensorCount returns an error naming the given sensors if there are fewer of them than
+// the heatsink requires, or if they are not as many as it expects
+func (c *configHeatsink) checkSensorCount(sensors []heatsink.ThermoSensor) error {
+
+	var want string
+	switch {
+	case c.ExpectedSensors > 0 && len(sensors) != c.ExpectedSensors:
+		want = fmt.Sprintf("expected %d", c.ExpectedSensors)
+	case len(sensors) < c.MinSensors:
+		want = fmt.Sprintf("expected at least %d", c.MinSensors)
+	default:
+		return nil
+	}
+	names := make([]string, len(sensors))
+	for i, sensor := range sensors {
+		names[i] = sensor.Name()
+	}
+	return fmt.Errorf("%w: found %d [%s], %s", errSensorCount, len(sensors), strings.Join(names, ", "), want)
+}
+
+func (c configAuxInput) newAuxInput(logger *zap.Logger) (heatsink.AuxInput, error) {
+	switch c.Type {
+	case "rapl":
+		return c.newRaplMeter(logger)
+	case "cpu_load":
+		return c.newLoadMeter(logger)
+	default:
+		return nil, fmt.Errorf("%w: '%s'", errAuxInputTypeUnknown, c.Type)
+	}
+}
+
+func (c configAuxInput) newRaplMeter(logger *zap.Logger) (heatsink.AuxInput, error) {
+
+	domainDir, err := globOne(c.PathGlob)
+	if err != nil {
+		return nil, err
+	}
+	meter, err := rapl.New(domainDir, rapl.OptName(c.Name))
+	if err != nil {
+		return nil, fmt.Errorf("'%s': %w", domainDir, err)
+	}
+
+	logger.Info(
+		"created RAPL power meter",
+		zap.String("name", meter.Name()),
+		zap.String("domain", domainDir),
+		zap.Float64("low", c.Low),
+		zap.Float64("high", c.High),
+	)
+	return meter, nil
+}
+
+func (c configAuxInput) newLoadMeter(logger *zap.Logger) (heatsink.AuxInput, error) {
+
+	smoothing, err := time.ParseDuration(c.Smoothing)
+	if err != nil && c.Smoothing != "" {
+		return nil, fmt.Errorf("%w: %v", errBadDuration, err)
+	}
+	statFile := cpuload.DefaultStatFile
+	if c.PathGlob != "" {
+		if statFile, err = globOne(c.PathGlob); err != nil {
+			return nil, err
+		}
+	}
+	meter, err := cpuload.New(statFile, cpuload.OptName(c.Name), cpuload.OptSmoothing(smoothing))
+	if err != nil {
+		return nil, fmt.Errorf("'%s': %w", statFile, err)
+	}
+
+	logger.Info(
+		"created CPU load meter",
+		zap.String("name", meter.Name()),
+		zap.String("stat_file", statFile),
+		zap.String("smoothing", smoothing.String()),
+		zap.Float64("low", c.Low),
+		zap.Float64("high", c.High),
+	)
+	return meter, nil
+}
+
+func (c configCircuitBreaker) options(logger *zap.Logger) (sensorOpts, fanOpts []breaker.Option, err error) {
+
+	var durations [3]time.Duration
+	for i, d := range []string{c.OpenDuration, c.SensorTimeout, c.FanTimeout} {
+		if d == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(d)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", errBadDuration, err)
+		}
+		durations[i] = parsed
+	}
+
+	onStateChange := func(name string, from, to breaker.State) {
+		logger.Warn(
+			"circuit breaker changed its state",
+			zap.String("event", "circuit_breaker_state_change"),
+			zap.String("device", name),
+			zap.String("from", from.String()),
+			zap.String("to", to.String()),
+		)
+	}
+	common := []breaker.Option{
+		breaker.OptFailureThreshold(c.FailureThreshold),
+		breaker.OptOpenDuration(durations[0]),
+		breaker.OptOnStateChange(onStateChange),
+	}
+
+	sensorOpts = append([]breaker.Option{breaker.OptTimeout(durations[1])}, common...)
+	fanOpts = append([]breaker.Option{breaker.OptTimeout(durations[2])}, common...)
+	return sensorOpts, fanOpts, nil
+}
+
+func (c configFaults) options() ([]faultinject.Option, error) {
+
+	var durations [3]time.Duration
+	for i, d := range []string{c.Delay, c.OutageAfter, c.OutageDuration} {
+		if d == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(d)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errBadDuration, err)
+		}
+		durations[i] = parsed
+	}
+
+	return []faultinject.Option{
+		faultinject.OptErrorRate(c.ErrorRate),
+		faultinject.OptFailEvery(c.FailEvery),
+		faultinject.OptDelay(durations[0]),
+		faultinject.OptOutage(durations[1], durations[2]),
+		faultinject.OptSeed(c.Seed),
+	}, nil
+}
+
 func (c configFan) newFan(logger *zap.Logger) (heatsink.FanDriver, error) {
-	period, err := time.ParseDuration(c.PwmPeriod)
-	if err != nil && c.PwmPeriod != "" {
+	period, err := c.PwmPeriod.duration("pwm_period", time.Millisecond)
+	if err != nil {
+		return nil, err
+	}
+	// a zero period, i.e. an empty one, falls back to the default
+
+	conflictChkPeriod, err := time.ParseDuration(c.ConflictChkPeriod)
+	if err != nil && c.ConflictChkPeriod != "" {
 		return nil, fmt.Errorf("%w: %v", errBadDuration, err)
 	}
-	// otherwise, it is empty and we assume the zero-value will fallback to default
+	// otherwise, it is empty and the zero-value disables conflict detection
+
+	var optEnable fanpwm.Option
+	if c.EnablePolicy != "" {
+		policy, err := c.enablePolicy()
+		if err != nil {
+			return nil, err
+		}
+		optEnable = fanpwm.OptEnableMonitor(policy, func(reclaim fanpwm.Reclaim) {
+			fields := []zap.Field{
+				zap.String("name", reclaim.Driver),
+				zap.String("filename", reclaim.Filename),
+				zap.String("mode", reclaim.Mode),
+				zap.String("policy", reclaim.Policy.String()),
+			}
+			if reclaim.Mode == fanpwm.EnableManual {
+				logger.Info(
+					"pwm channel is back in manual mode",
+					append(fields, zap.String("event", "fan_manual_control"))...,
+				)
+				return
+			}
+			logger.Warn(
+				"pwm channel was switched to automatic fan control by the kernel or the firmware",
+				append(fields, zap.String("event", "fan_auto_control"))...,
+			)
+		})
+	}
 
-	matches, err := filepath.Glob(c.PathGlob)
+	onClose, err := c.closeBehavior()
 	if err != nil {
-		return nil, fmt.Errorf("invalid glob '%s': %w", c.PathGlob, err)
+		return nil, err
 	}
-	if len(matches) == 0 {
-		return nil, fmt.Errorf("'%s': %w", c.PathGlob, errGlobNoMatches)
+	minSpeed, maxSpeed, err := c.speedRange()
+	if err != nil {
+		return nil, err
 	}
-	if len(matches) > 1 {
-		return nil, fmt.Errorf("'%s': %w", c.PathGlob, errGlobTooManyMatches)
+
+	var optVerify fanpwm.Option
+	if c.WriteVerify != nil {
+		backoff, err := time.ParseDuration(c.WriteVerify.Backoff)
+		if err != nil && c.WriteVerify.Backoff != "" {
+			return nil, fmt.Errorf("%w: %v", errBadDuration, err)
+		}
+		optVerify = fanpwm.OptWriteVerification(fanpwm.WriteVerification{
+			Retries:   c.WriteVerify.Retries,
+			Backoff:   backoff,
+			Tolerance: c.WriteVerify.Tolerance,
+			FailAfter: c.WriteVerify.FailAfter,
+			OnFailure: func(failure fanpwm.WriteFailure) {
+				logger.Warn(
+					"pwm value was not accepted by the fan controller",
+					zap.String("event", "fan_write_ignored"),
+					zap.String("name", failure.Driver),
+					zap.String("filename", failure.Filename),
+					zap.String("expected_value", failure.Expected),
+					zap.String("actual_value", failure.Actual),
+					zap.Int("consecutive_failures", failure.Failures),
+				)
+			},
+		})
+	}
+
+	output, err := c.hardwareOutput()
+	if err != nil {
+		return nil, err
+	}
+	_, isSMC := smcAddress(c.PathGlob)
+	_, _, isPlugin := pluginAddress(c.PathGlob)
+	if setting := c.pwmOnlySetting(); setting != "" && (c.Remote != nil || isSMC || isPlugin) {
+		return nil, fmt.Errorf("'%s': %w: %s", c.Name, errPwmOnlySetting, setting)
+	}
+	if c.Remote != nil {
+		return c.newRemoteFan(logger)
+	}
+	if index, ok := smcAddress(c.PathGlob); ok {
+		return c.newSMCFan(index, logger)
+	}
+	if isPlugin {
+		return c.newPluginFan(logger)
+	}
+	filename, err := globOne(c.PathGlob)
+	if err != nil {
+		return nil, err
+	}
+	if c.dryRun {
+		logger.Info("created dry-run fan", zap.String("name", c.Name), zap.String("filename", filename))
+		return newDryRunFan(c.Name, filename, logger), nil
+	}
+	if strings.HasPrefix(filename, pwmDevDir) {
+		if setting := c.pwmOnlySetting(); setting != "" {
+			return nil, fmt.Errorf("'%s': %w: %s", filename, errPwmOnlySetting, setting)
+		}
+		return c.newFreeBSDFan(filename, logger)
+	}
+	var optInverted fanpwm.Option
+	if c.Inverted {
+		optInverted = fanpwm.OptInvertedPolarity()
+	}
+	onConflict := func(conflict fanpwm.Conflict) {
+		logger.Warn(
+			"pwm value was changed by another program or the firmware",
+			zap.String("event", "fan_control_conflict"),
+			zap.String("name", conflict.Driver),
+			zap.String("filename", conflict.Filename),
+			zap.String("expected_value", conflict.Expected),
+			zap.String("actual_value", conflict.Actual),
+		)
 	}
-	filename := matches[0]
 
 	fan, err := fanpwm.New(
 		filename,
 		fanpwm.OptName(c.Name),
 		fanpwm.OptPeriodPWM(period),
-		fanpwm.OptMinSpeedValue(c.MinSpeedVal),
-		fanpwm.OptMaxSpeedValue(c.MaxSpeedVal),
+		fanpwm.OptMinSpeed(minSpeed),
+		fanpwm.OptMaxSpeed(maxSpeed),
+		optInverted,
+		fanpwm.OptHardwareOutput(output),
+		fanpwm.OptConflictDetection(conflictChkPeriod, c.ConflictTolerance, onConflict),
+		optEnable,
+		optVerify,
+		fanpwm.OptCloseBehavior(onClose, c.ExitValue),
+		fanpwm.OptExitState("", c.ExitMode),
 	)
 	if err != nil {
-		return nil, fmt.Errorf("'%s': %w", filename, err)
+		return nil, fmt.Errorf("'%s': %w", filename, diagnosePermission(err, accessWrite))
 	}
 
 	logger.Info(
@@ -187,13 +1209,82 @@ func (c configFan) newFan(logger *zap.Logger) (heatsink.FanDriver, error) {
 		zap.String("name", c.Name),
 		zap.String("filename", filename),
 		zap.String("pwm_period", period.String()),
-		zap.String("min_speed_value", c.MinSpeedVal),
-		zap.String("max_speed_value", c.MaxSpeedVal),
+		zap.Int("min_speed_value", minSpeed),
+		zap.Int("max_speed_value", maxSpeed),
+		zap.Bool("inverted", c.Inverted),
 		zap.String("response_type", c.RespType),
 	)
 	return fan, nil
 }
 
+// pwmOnlySetting returns the name of a setting of the fan that only hwmon pwm fans support, or
+// an empty string if it sets none
+func (c configFan) pwmOnlySetting() string {
+	switch {
+	case c.Inverted:
+		return "inverted"
+	case c.PwmFrequency != 0:
+		return "pwm_frequency"
+	case c.PwmMode != "":
+		return "pwm_mode"
+	}
+	return ""
+}
+
+// hardwareOutput returns the configured hardware pwm output of the fan
+func (c configFan) hardwareOutput() (fanpwm.HardwareOutput, error) {
+	out := fanpwm.HardwareOutput{Frequency: c.PwmFrequency}
+	if c.PwmFrequency < 0 {
+		return out, fmt.Errorf("%w: pwm_frequency must not be negative, got: %d", errBadPwmOutput, c.PwmFrequency)
+	}
+	switch strings.ToLower(c.PwmMode) {
+	case "":
+	case "dc":
+		out.Mode = fanpwm.OutputDC
+	case "pwm":
+		out.Mode = fanpwm.OutputPWM
+	default:
+		return out, fmt.Errorf("%w: pwm_mode must be 'dc' or 'pwm', got: '%s'", errBadPwmOutput, c.PwmMode)
+	}
+	return out, nil
+}
+
+// enablePolicy returns the fanpwm policy of the configured pwm enable policy
+func (c configFan) enablePolicy() (fanpwm.ReclaimPolicy, error) {
+	for _, policy := range []fanpwm.ReclaimPolicy{fanpwm.ReclaimReassert, fanpwm.ReclaimYield, fanpwm.ReclaimFail} {
+		if strings.EqualFold(c.EnablePolicy, policy.String()) {
+			return policy, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: '%s'", errBadEnablePolicy, c.EnablePolicy)
+}
+
+// closeBehavior returns the fanpwm close behavior of the configured one
+func (c configFan) closeBehavior() (fanpwm.CloseBehavior, error) {
+
+	switch {
+	case c.OnClose == "" && c.RestoreOnExit:
+		return fanpwm.CloseRestore, nil
+	case c.OnClose == "" && c.ExitValue != "":
+		return fanpwm.CloseValue, nil
+	case c.OnClose == "":
+		return fanpwm.CloseMaxSpeed, nil
+	}
+	behaviors := []fanpwm.CloseBehavior{
+		fanpwm.CloseMaxSpeed, fanpwm.CloseMinSpeed, fanpwm.CloseValue, fanpwm.CloseRestore, fanpwm.CloseLeave,
+	}
+	for _, behavior := range behaviors {
+		if !strings.EqualFold(c.OnClose, behavior.String()) {
+			continue
+		}
+		if behavior == fanpwm.CloseValue && c.ExitValue == "" {
+			return 0, fmt.Errorf("%w: 'value' requires an exit_value", errBadOnClose)
+		}
+		return behavior, nil
+	}
+	return 0, fmt.Errorf("%w: '%s'", errBadOnClose, c.OnClose)
+}
+
 func (c configSensors) newSensors(logger *zap.Logger) ([]heatsink.ThermoSensor, error) {
 
 	var (
@@ -202,6 +1293,38 @@ func (c configSensors) newSensors(logger *zap.Logger) ([]heatsink.ThermoSensor,
 	)
 
 	for _, pattern := range c {
+		if key, ok := smcAddress(pattern); ok {
+			sensor, err := newSMCSensor(key, "", logger)
+			if err != nil {
+				return nil, err
+			}
+			allSensors = append(allSensors, sensor)
+			continue
+		}
+		if sysctl, ok := sysctlAddress(pattern); ok {
+			sensor, err := newSysctlSensor(sysctl, "", logger)
+			if err != nil {
+				return nil, err
+			}
+			allSensors = append(allSensors, sensor)
+			continue
+		}
+		if chip, feature, ok := lmsensorsAddress(pattern); ok {
+			sensor, err := newLMSensor(chip, feature, "", logger)
+			if err != nil {
+				return nil, err
+			}
+			allSensors = append(allSensors, sensor)
+			continue
+		}
+		if domainGlob, ok := raplAddress(pattern); ok {
+			sensor, err := newRaplSensor(domainGlob, "", logger)
+			if err != nil {
+				return nil, err
+			}
+			allSensors = append(allSensors, sensor)
+			continue
+		}
 		sensorFilenames, err := filepath.Glob(pattern)
 		if err != nil {
 			return nil, fmt.Errorf("invalid glob '%s': %w", pattern, err)
@@ -209,7 +1332,7 @@ func (c configSensors) newSensors(logger *zap.Logger) ([]heatsink.ThermoSensor,
 		allFilenames = append(allFilenames, sensorFilenames...)
 	}
 
-	if len(allFilenames) == 0 {
+	if len(allFilenames) == 0 && len(allSensors) == 0 {
 		return nil, fmt.Errorf("[%s]: %w", strings.Join(c, ", "), errGlobNoMatches)
 	}
 
@@ -217,7 +1340,7 @@ func (c configSensors) newSensors(logger *zap.Logger) ([]heatsink.ThermoSensor,
 		filename = filepath.Clean(filename)
 		sensor, err := thermosense.New(filename)
 		if err != nil {
-			return nil, fmt.Errorf("'%s': %w", filename, err)
+			return nil, fmt.Errorf("'%s': %w", filename, diagnosePermission(err, accessRead))
 		}
 		logger.Info("created thermo sensor", zap.String("filename", filename))
 		allSensors = append(allSensors, sensor)
@@ -225,3 +1348,153 @@ func (c configSensors) newSensors(logger *zap.Logger) ([]heatsink.ThermoSensor,
 
 	return allSensors, nil
 }
+
+// globOne returns the only file that matches the given pattern
+func globOne(pattern string) (string, error) {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid glob '%s': %w", pattern, err)
+	}
+	if len(matches) == 0 {
+		return "", fmt.Errorf("'%s': %w", pattern, errGlobNoMatches)
+	}
+	if len(matches) > 1 {
+		return "", fmt.Errorf("'%s': %w", pattern, errGlobTooManyMatches)
+	}
+	return matches[0], nil
+}
+
+// namedSensors holds the definitions of sensors that heatsinks and virtual sensors can
+// reference by name. A new sensor instance is created for every reference so that no sensor
+// is shared, and hence closed, by more than one owner
+type namedSensors struct {
+	physical map[string]string
+	virtual  map[string]string
+	remote   map[string]configRemoteSensor
+	// plugins provide the sensors whose path globs address them
+	plugins pluginSet
+}
+
+func newNamedSensors(
+	physical []configNamedSensor, virtual []configVirtualSensor, remote []configRemoteSensor,
+) (namedSensors, error) {
+
+	ns := namedSensors{
+		physical: make(map[string]string),
+		virtual:  make(map[string]string),
+		remote:   make(map[string]configRemoteSensor),
+	}
+	isDefined := func(name string) bool {
+		_, isPhysical := ns.physical[name]
+		_, isVirtual := ns.virtual[name]
+		_, isRemote := ns.remote[name]
+		return isPhysical || isVirtual || isRemote
+	}
+
+	for _, s := range physical {
+		if s.Name == "" {
+			return ns, errSensorNameEmpty
+		}
+		if isDefined(s.Name) {
+			return ns, fmt.Errorf("%w: '%s'", errSensorNameDup, s.Name)
+		}
+		ns.physical[s.Name] = s.PathGlob
+	}
+	for _, s := range virtual {
+		if s.Name == "" {
+			return ns, errSensorNameEmpty
+		}
+		if isDefined(s.Name) {
+			return ns, fmt.Errorf("%w: '%s'", errSensorNameDup, s.Name)
+		}
+		ns.virtual[s.Name] = s.Expression
+	}
+	for _, s := range remote {
+		if s.Name == "" {
+			return ns, errSensorNameEmpty
+		}
+		if isDefined(s.Name) {
+			return ns, fmt.Errorf("%w: '%s'", errSensorNameDup, s.Name)
+		}
+		ns.remote[s.Name] = s
+	}
+
+	return ns, nil
+}
+
+func (ns namedSensors) newSensor(name string, logger *zap.Logger) (heatsink.ThermoSensor, error) {
+	return ns.newSensorResolving(name, logger, make(map[string]bool))
+}
+
+func (ns namedSensors) newSensorResolving(
+	name string, logger *zap.Logger, resolving map[string]bool,
+) (heatsink.ThermoSensor, error) {
+
+	if pattern, ok := ns.physical[name]; ok {
+		if key, ok := smcAddress(pattern); ok {
+			return newSMCSensor(key, name, logger)
+		}
+		if sysctl, ok := sysctlAddress(pattern); ok {
+			return newSysctlSensor(sysctl, name, logger)
+		}
+		if chip, feature, ok := lmsensorsAddress(pattern); ok {
+			return newLMSensor(chip, feature, name, logger)
+		}
+		if domainGlob, ok := raplAddress(pattern); ok {
+			return newRaplSensor(domainGlob, name, logger)
+		}
+		if _, _, ok := pluginAddress(pattern); ok {
+			return ns.plugins.newSensor(pattern, name, logger)
+		}
+		filename, err := globOne(pattern)
+		if err != nil {
+			return nil, err
+		}
+		sensor, err := thermosense.New(filepath.Clean(filename), thermosense.OptName(name))
+		if err != nil {
+			return nil, fmt.Errorf("'%s': %w", filename, diagnosePermission(err, accessRead))
+		}
+		logger.Info("created thermo sensor", zap.String("name", name), zap.String("filename", filename))
+		return sensor, nil
+	}
+	if remote, ok := ns.remote[name]; ok {
+		return remote.newSensor(logger)
+	}
+
+	expression, ok := ns.virtual[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: '%s'", errSensorNameUnknown, name)
+	}
+	if resolving[name] {
+		return nil, fmt.Errorf("%w: '%s'", errSensorCycle, name)
+	}
+	resolving[name] = true
+	defer delete(resolving, name)
+
+	parsed, err := expr.Parse(expression)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", expression, err)
+	}
+	inputs := make(map[string]heatsink.ThermoSensor)
+	closeInputs := func() {
+		for _, input := range inputs {
+			_ = input.Close()
+		}
+	}
+	for _, inputName := range parsed.Vars() {
+		input, err := ns.newSensorResolving(inputName, logger, resolving)
+		if err != nil {
+			closeInputs()
+			return nil, fmt.Errorf("virtual sensor '%s': %w", name, err)
+		}
+		inputs[inputName] = input
+	}
+
+	sensor, err := virtsense.New(expression, inputs, virtsense.OptName(name))
+	if err != nil {
+		closeInputs()
+		return nil, fmt.Errorf("virtual sensor '%s': %w", name, err)
+	}
+	logger.Info("created virtual sensor", zap.String("name", name), zap.String("expression", expression))
+	return sensor, nil
+}
@@ -13,9 +13,13 @@ import (
 
 	"github.com/go-test/deep"
 	"github.com/malkhamis/heatsink"
+	"github.com/malkhamis/heatsink/breaker"
 	"github.com/malkhamis/heatsink/fanpwm"
+	"github.com/malkhamis/heatsink/faultinject"
+	"github.com/malkhamis/heatsink/heatsinktest"
 	"github.com/malkhamis/heatsink/thermosense"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 func Test_config_newHeatsinks(t *testing.T) {
@@ -96,6 +100,8 @@ func Test_config_newHeatsinks(t *testing.T) {
 		          "min_temp": 30,
 		          "max_temp": 50,
 		          "temp_check_period": "3s",
+		          "service_levels": [{"above_temp": 40, "min_duty_cycle": 0.25}],
+		          "log_summary": {"iterations": 60, "period": "5m"},
 		          "fan": {
 		            "name": "fan/1",
 		            "path_glob": %q,
@@ -162,6 +168,8 @@ func Test_config_newHeatsinks(t *testing.T) {
 		heatsink.OptFanResponse(heatsink.FanResponsePowPi),
 		heatsink.OptTemperatureCheckPeriod(3*time.Second),
 		heatsink.OptLogger(logger),
+		heatsink.OptServiceLevel(40, 0.25),
+		heatsink.OptPeriodicSummary(60, 5*time.Minute),
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -199,6 +207,12 @@ func Test_config_newHeatsinks(t *testing.T) {
 	}
 
 	expected := []*heatsink.Heatsink{heatsink1, heatsink2}
+	// the fans of the expected heatsinks hold the locks of the device files until released
+	for _, hs := range expected {
+		if err := hs.StopThermalControl(); err != nil {
+			t.Fatal(err)
+		}
+	}
 
 	cfg, err := newConfig(jsonData, nil)
 	if err != nil {
@@ -212,6 +226,12 @@ func Test_config_newHeatsinks(t *testing.T) {
 	if len(actual) != 2 {
 		t.Fatalf("expected 2 heatsinks, got: %d", len(actual))
 	}
+	// released like the expected ones, so that their devices are in the same state
+	for _, hs := range actual {
+		if err := hs.StopThermalControl(); err != nil {
+			t.Fatal(err)
+		}
+	}
 	if diff := deep.Equal(expected, actual); diff != nil {
 		t.Fatal("actual deserialized heatsinks doesn't match expected\n", strings.Join(diff, "\n"))
 	}
@@ -261,6 +281,36 @@ func Test_newConfig_errNoHeatsinkConfig(t *testing.T) {
 	}
 }
 
+func Test_newConfig_errBadLogging(t *testing.T) {
+	t.Parallel()
+
+	jsonData := `{"heatsinks": [{}], "logging": {"level": "verbose"}}`
+	_, err := newConfig(strings.NewReader(jsonData), nil)
+	if !errors.Is(err, errBadLogLevel) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", errBadLogLevel, err)
+	}
+}
+
+func Test_newConfig_errBadControlSocket(t *testing.T) {
+	t.Parallel()
+
+	jsonData := `{"heatsinks": [{}], "control_socket": {"mode": "0999"}}`
+	_, err := newConfig(strings.NewReader(jsonData), nil)
+	if !errors.Is(err, errBadSocketMode) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", errBadSocketMode, err)
+	}
+}
+
+func Test_newConfig_errPrivilegesUser(t *testing.T) {
+	t.Parallel()
+
+	jsonData := `{"heatsinks": [{}], "privileges": {"user": "no-such-heatsink-user"}}`
+	_, err := newConfig(strings.NewReader(jsonData), nil)
+	if !errors.Is(err, errPrivilegesUser) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", errPrivilegesUser, err)
+	}
+}
+
 func Test_config_newHeatsinks_error_tempChkPeriod_wrongType(t *testing.T) {
 	t.Parallel()
 
@@ -333,6 +383,100 @@ func Test_config_newHeatsinks_errorCreatingSensor_noGlobMatches(t *testing.T) {
 	}
 }
 
+func Test_configFan_newFan_inverted(t *testing.T) {
+	t.Parallel()
+
+	fanFile, cleanup := temporaryFile(t)
+	defer cleanup()
+
+	jsonData := fmt.Sprintf(`{"path_glob": %q, "min_speed_value": 30, "inverted": true}`, fanFile.Name())
+	var fanCfg configFan
+	if err := json.Unmarshal([]byte(jsonData), &fanCfg); err != nil {
+		t.Fatal(err)
+	}
+	fan, err := fanCfg.newFan(zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	readBack := func() string {
+		data, err := ioutil.ReadFile(fanFile.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	if err := fan.SetDutyCycle(0); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "225", readBack(); actual != expected {
+		t.Errorf("unexpected pwm value of the min speed\nwant: %q\n got: %q", expected, actual)
+	}
+	if err := fan.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "0", readBack(); actual != expected {
+		t.Errorf("unexpected pwm value after close\nwant: %q\n got: %q", expected, actual)
+	}
+}
+
+func Test_configHeatsink_newSensors_sensorCount(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"temp1_input", "temp2_input"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("40000"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	glob := configSensors{filepath.Join(dir, "temp*_input")}
+
+	testCases := []struct {
+		name        string
+		hsCfg       configHeatsink
+		expectedErr error
+	}{
+		{"unset", configHeatsink{SensorPathGlobs: glob}, nil},
+		{"min-met", configHeatsink{SensorPathGlobs: glob, MinSensors: 2}, nil},
+		{"min-not-met", configHeatsink{SensorPathGlobs: glob, MinSensors: 3}, errSensorCount},
+		{"expected-met", configHeatsink{SensorPathGlobs: glob, MinSensors: 1, ExpectedSensors: 2}, nil},
+		{"expected-too-many", configHeatsink{SensorPathGlobs: glob, ExpectedSensors: 1}, errSensorCount},
+		{"expected-too-few", configHeatsink{SensorPathGlobs: glob, ExpectedSensors: 4}, errSensorCount},
+	}
+
+	for _, tc := range testCases {
+		sensors, err := tc.hsCfg.newSensors(namedSensors{}, zap.NewNop())
+		if !errors.Is(err, tc.expectedErr) {
+			t.Errorf("%s: unexpected error\nwant: %v\n got: %v", tc.name, tc.expectedErr, err)
+		}
+		if err != nil && !strings.Contains(err.Error(), "temp1_input") {
+			t.Errorf("%s: expected the error to name the sensors found, got: %v", tc.name, err)
+		}
+		for _, sensor := range sensors {
+			_ = sensor.Close()
+		}
+	}
+}
+
+func Test_newConfig_badSensorCount(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]string{
+		"negative":          `{"heatsinks": [{"min_sensors": -1}]}`,
+		"min-over-expected": `{"heatsinks": [{"min_sensors": 3, "expected_sensors": 2}]}`,
+	}
+	for name, jsonData := range testCases {
+		_, err := newConfig(strings.NewReader(jsonData), nil)
+		if !errors.Is(err, errBadSensorCount) {
+			t.Errorf("%s: unexpected error\nwant: %v\n got: %v", name, errBadSensorCount, err)
+		}
+	}
+}
+
 func Test_config_newHeatsinks_errorCreatingFan_badGlob(t *testing.T) {
 	t.Parallel()
 
@@ -608,6 +752,239 @@ func Test_config_newHeatsinks_error_badFanResponseType(t *testing.T) {
 
 }
 
+func Test_config_newHeatsinks_error_badExponent(t *testing.T) {
+	t.Parallel()
+
+	sensorFile, cleanup := temporaryFile(t)
+	defer cleanup()
+
+	fanFile, cleanup := temporaryFile(t)
+	defer cleanup()
+
+	jsonData := strings.NewReader(fmt.Sprintf(`
+		{
+		  "heatsinks": [
+
+		    {
+		      "name":"heatsink/1",
+		      "min_temp": 1,
+		      "max_temp": 10,
+		      "temp_check_period": "3s",
+		      "sensor_path_globs": [%q],
+					"fan": {
+						"path_glob": %q,
+						"pwm_period": "22ms",
+						"min_speed_value": "10",
+						"max_speed_value": "200",
+						"response_type": "pow"
+					}
+		    }
+
+		  ]
+		}
+	`, sensorFile.Name(), fanFile.Name(),
+	))
+
+	cfg, err := newConfig(jsonData, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cfg.newHeatsinks()
+	if !errors.Is(err, errBadExponent) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", errBadExponent, err)
+	}
+
+}
+
+func Test_configFan_newFan_enablePolicy(t *testing.T) {
+	t.Parallel()
+
+	fanFile, cleanup := temporaryFile(t)
+	defer cleanup()
+	enableFile := fanFile.Name() + "_enable"
+	if err := ioutil.WriteFile(enableFile, []byte("2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(enableFile)
+
+	_, err := configFan{PathGlob: fanFile.Name(), EnablePolicy: "sometimes"}.newFan(zap.NewNop())
+	if !errors.Is(err, errBadEnablePolicy) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", errBadEnablePolicy, err)
+	}
+
+	fan, err := configFan{PathGlob: fanFile.Name(), EnablePolicy: "Yield"}.newFan(zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fan.Close()
+	data, err := ioutil.ReadFile(enableFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != fanpwm.EnableManual {
+		t.Errorf("expected the pwm channel to be switched to manual mode, got: %q", data)
+	}
+}
+
+func Test_configFan_newFan_restoreOnExit(t *testing.T) {
+	t.Parallel()
+
+	fanFile, cleanup := temporaryFile(t)
+	defer cleanup()
+	if err := ioutil.WriteFile(fanFile.Name(), []byte("77\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	fan, err := configFan{PathGlob: fanFile.Name(), RestoreOnExit: true}.newFan(zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fan.SetDutyCycle(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := fan.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(fanFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "77" {
+		t.Errorf("expected the original pwm value to be restored, got: %q", data)
+	}
+}
+
+func Test_configFan_closeBehavior(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		fan         configFan
+		expected    fanpwm.CloseBehavior
+		expectedErr error
+	}{
+		{"default", configFan{}, fanpwm.CloseMaxSpeed, nil},
+		{"restore-on-exit", configFan{RestoreOnExit: true, ExitValue: "10"}, fanpwm.CloseRestore, nil},
+		{"exit-value", configFan{ExitValue: "10"}, fanpwm.CloseValue, nil},
+		{"min", configFan{OnClose: "min", RestoreOnExit: true}, fanpwm.CloseMinSpeed, nil},
+		{"leave", configFan{OnClose: "Leave"}, fanpwm.CloseLeave, nil},
+		{"value", configFan{OnClose: "value", ExitValue: "10"}, fanpwm.CloseValue, nil},
+		{"value-missing", configFan{OnClose: "value"}, 0, errBadOnClose},
+		{"unknown", configFan{OnClose: "off"}, 0, errBadOnClose},
+	}
+
+	for _, tc := range testCases {
+		behavior, err := tc.fan.closeBehavior()
+		if !errors.Is(err, tc.expectedErr) {
+			t.Fatalf("%s: unexpected error\nwant: %v\n got: %v", tc.name, tc.expectedErr, err)
+		}
+		if behavior != tc.expected {
+			t.Errorf("%s: unexpected close behavior\nwant: %s\n got: %s", tc.name, tc.expected, behavior)
+		}
+	}
+}
+
+func Test_configFan_hardwareOutput(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		fan         configFan
+		expected    fanpwm.HardwareOutput
+		expectedErr error
+	}{
+		{"default", configFan{}, fanpwm.HardwareOutput{}, nil},
+		{"frequency", configFan{PwmFrequency: 25000}, fanpwm.HardwareOutput{Frequency: 25000}, nil},
+		{"dc", configFan{PwmMode: "dc"}, fanpwm.HardwareOutput{Mode: fanpwm.OutputDC}, nil},
+		{"pwm", configFan{PwmFrequency: 22500, PwmMode: "PWM"}, fanpwm.HardwareOutput{Frequency: 22500, Mode: fanpwm.OutputPWM}, nil},
+		{"negative-frequency", configFan{PwmFrequency: -1}, fanpwm.HardwareOutput{Frequency: -1}, errBadPwmOutput},
+		{"unknown-mode", configFan{PwmMode: "voltage"}, fanpwm.HardwareOutput{}, errBadPwmOutput},
+	}
+
+	for _, tc := range testCases {
+		out, err := tc.fan.hardwareOutput()
+		if !errors.Is(err, tc.expectedErr) {
+			t.Fatalf("%s: unexpected error\nwant: %v\n got: %v", tc.name, tc.expectedErr, err)
+		}
+		if err == nil && out != tc.expected {
+			t.Errorf("%s: unexpected hardware output\nwant: %+v\n got: %+v", tc.name, tc.expected, out)
+		}
+	}
+}
+
+func Test_configFan_newFan_writeVerification(t *testing.T) {
+	t.Parallel()
+
+	fanFile, cleanup := temporaryFile(t)
+	defer cleanup()
+
+	bad := configFan{PathGlob: fanFile.Name(), WriteVerify: &configWriteVerify{Backoff: "soon"}}
+	if _, err := bad.newFan(zap.NewNop()); !errors.Is(err, errBadDuration) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", errBadDuration, err)
+	}
+
+	core, logs := observer.New(zap.WarnLevel)
+	good := configFan{PathGlob: fanFile.Name(), WriteVerify: &configWriteVerify{Backoff: "1ms"}}
+	fan, err := good.newFan(zap.New(core))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fan.SetDutyCycle(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := fan.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := logs.FilterField(zap.String("event", "fan_write_ignored")).Len(); n != 0 {
+		t.Errorf("expected accepted writes not to be logged, got %d entries", n)
+	}
+}
+
+func Test_config_newHeatsinks_error_badSigmoid(t *testing.T) {
+	t.Parallel()
+
+	sensorFile, cleanup := temporaryFile(t)
+	defer cleanup()
+
+	fanFile, cleanup := temporaryFile(t)
+	defer cleanup()
+
+	jsonData := strings.NewReader(fmt.Sprintf(`
+		{
+		  "heatsinks": [
+
+		    {
+		      "name":"heatsink/1",
+		      "min_temp": 1,
+		      "max_temp": 10,
+		      "temp_check_period": "3s",
+		      "sensor_path_globs": [%q],
+					"fan": {
+						"path_glob": %q,
+						"pwm_period": "22ms",
+						"min_speed_value": "10",
+						"max_speed_value": "200",
+						"response_type": "sigmoid",
+						"midpoint": 0.7
+					}
+		    }
+
+		  ]
+		}
+	`, sensorFile.Name(), fanFile.Name(),
+	))
+
+	cfg, err := newConfig(jsonData, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cfg.newHeatsinks()
+	if !errors.Is(err, errBadSigmoid) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", errBadSigmoid, err)
+	}
+
+}
+
 func Test_config_newHeatsinks_errorCreatingHeatsink(t *testing.T) {
 	t.Parallel()
 
@@ -645,13 +1022,732 @@ func Test_config_newHeatsinks_errorCreatingHeatsink(t *testing.T) {
 		t.Fatal(err)
 	}
 	_, err = cfg.newHeatsinks()
+	if !errors.Is(err, heatsink.ErrBadTemperatureRange) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", heatsink.ErrBadTemperatureRange, err)
+	}
+}
+
+func Test_configHeatsink_newHeatsink_ambientDeltaRange(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		hs       configHeatsink
+		expected error
+	}{
+		"no-ambient-sensor": {
+			hs:       configHeatsink{AmbientDelta: &configDeltaRange{Min: 5, Max: 30}},
+			expected: errAmbientDeltaRange,
+		},
+		"bad-range": {
+			hs:       configHeatsink{AmbientSensor: "room", AmbientDelta: &configDeltaRange{Min: 30, Max: 5}},
+			expected: errAmbientDeltaRange,
+		},
+	}
+	for name, testCase := range cases {
+		_, err := testCase.hs.newHeatsink(namedSensors{}, zap.NewNop())
+		if !errors.Is(err, testCase.expected) {
+			t.Errorf("%s: unexpected error\nwant: %v\n got: %v", name, testCase.expected, err)
+		}
+	}
+}
+
+func Test_configHeatsink_newHeatsink_profiles(t *testing.T) {
+	t.Parallel()
+
+	quiet := 0.3
+	cases := map[string]map[string]configProfile{
+		"reserved": {autoProfile: {MaxDutyCycle: &quiet}},
+		"empty":    {"": {MaxDutyCycle: &quiet}},
+		"invalid":  {"quiet": {MinTemp: &quiet}},
+	}
+	for name, profiles := range cases {
+		hs := configHeatsink{Profiles: profiles}
+		if _, err := hs.newHeatsink(namedSensors{}, zap.NewNop()); !errors.Is(err, errBadProfile) {
+			t.Errorf("%s: unexpected error\nwant: %v\n got: %v", name, errBadProfile, err)
+		}
+	}
+}
+
+func Test_namedSensors_newSensor_virtual(t *testing.T) {
+	t.Parallel()
+
+	cpuFile, cleanup := temporaryFile(t)
+	defer cleanup()
+	ambientFile, cleanup := temporaryFile(t)
+	defer cleanup()
+	if _, err := cpuFile.WriteString("61000"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ambientFile.WriteString("24000"); err != nil {
+		t.Fatal(err)
+	}
+
+	jsonData := strings.NewReader(fmt.Sprintf(`
+		{
+		  "sensors": [
+		    {"name": "cpu_package", "path_glob": %q},
+		    {"name": "ambient", "path_glob": %q}
+		  ],
+		  "virtual_sensors": [
+		    {"name": "cpu_delta", "expression": "cpu_package - ambient"},
+		    {"name": "cpu_delta_half", "expression": "cpu_delta / 2"}
+		  ],
+		  "heatsinks": [{"sensor_names": ["cpu_delta_half"]}]
+		}
+	`, cpuFile.Name(), ambientFile.Name(),
+	))
 
-	// asserting against error strings is bad. However, it is better than introducing a custom
-	// error type, overriding the returned error, or exporting an error from the other package
-	// for the sake of this test. This should be good for now
-	expectedString := "maximum temperature must be greater than the minimum"
-	if !strings.Contains(err.Error(), expectedString) {
-		t.Fatalf("expected error to contain the following string: '%s'", expectedString)
+	cfg, err := newConfig(jsonData, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sensor, err := cfg.named.newSensor("cpu_delta_half", zap.NewNop())
+	if err != nil {
+		t.Fatalf("expected no error creating a virtual sensor, got: %v", err)
 	}
+	defer sensor.Close()
 
+	actual, err := sensor.Temperature()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := 18.5; expected != actual {
+		t.Fatalf("unexpected virtual sensor temperature\nwant: %.1f\n got: %.1f", expected, actual)
+	}
+	if expected := "cpu_delta_half"; expected != sensor.Name() {
+		t.Fatalf("unexpected virtual sensor name\nwant: %q\n got: %q", expected, sensor.Name())
+	}
+}
+
+func Test_namedSensors_newSensor_composite(t *testing.T) {
+	t.Parallel()
+
+	cpuFile, cleanup := temporaryFile(t)
+	defer cleanup()
+	gpuFile, cleanup := temporaryFile(t)
+	defer cleanup()
+	ambientFile, cleanup := temporaryFile(t)
+	defer cleanup()
+	for file, milliC := range map[*os.File]string{cpuFile: "60000", gpuFile: "72000", ambientFile: "24000"} {
+		if _, err := file.WriteString(milliC); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	jsonData := strings.NewReader(fmt.Sprintf(`
+		{
+		  "sensors": [
+		    {"name": "cpu", "path_glob": %q},
+		    {"name": "gpu", "path_glob": %q},
+		    {"name": "ambient", "path_glob": %q}
+		  ],
+		  "virtual_sensors": [
+		    {"name": "hottest", "expression": "max(cpu, gpu)"},
+		    {"name": "mean", "expression": "avg(cpu, gpu)"},
+		    {"name": "board", "expression": "weighted(cpu, 3, gpu, 1) - ambient"}
+		  ],
+		  "heatsinks": [{"sensor_names": ["hottest"], "ambient_sensor": "mean"}]
+		}
+	`, cpuFile.Name(), gpuFile.Name(), ambientFile.Name(),
+	))
+
+	cfg, err := newConfig(jsonData, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]float64{"hottest": 72, "mean": 66, "board": 39} {
+		sensor, err := cfg.named.newSensor(name, zap.NewNop())
+		if err != nil {
+			t.Fatalf("expected no error creating virtual sensor '%s', got: %v", name, err)
+		}
+		actual, err := sensor.Temperature()
+		sensor.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected != actual {
+			t.Errorf("unexpected temperature of '%s'\nwant: %.1f\n got: %.1f", name, expected, actual)
+		}
+	}
+}
+
+func Test_namedSensors_errors(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		inJson      string
+		inName      string
+		errOnConfig error
+		errOnSensor error
+	}{
+		"empty-name": {
+			inJson:      `{"heatsinks":[{}],"sensors":[{"path_glob":"/tmp/x"}]}`,
+			errOnConfig: errSensorNameEmpty,
+		},
+		"duplicate-name": {
+			inJson: `{"heatsinks":[{}],
+				"sensors":[{"name":"a","path_glob":"/tmp/x"}],
+				"virtual_sensors":[{"name":"a","expression":"1"}]}`,
+			errOnConfig: errSensorNameDup,
+		},
+		"duplicate-remote-name": {
+			inJson: `{"heatsinks":[{}],
+				"sensors":[{"name":"a","path_glob":"/tmp/x"}],
+				"remote_sensors":[{"name":"a","url":"http://nas/"}]}`,
+			errOnConfig: errSensorNameDup,
+		},
+		"unknown-name": {
+			inJson:      `{"heatsinks":[{}],"virtual_sensors":[{"name":"a","expression":"b + 1"}]}`,
+			inName:      "a",
+			errOnSensor: errSensorNameUnknown,
+		},
+		"cycle": {
+			inJson: `{"heatsinks":[{}],"virtual_sensors":[
+				{"name":"a","expression":"b + 1"},{"name":"b","expression":"a - 1"}]}`,
+			inName:      "a",
+			errOnSensor: errSensorCycle,
+		},
+	}
+
+	for name, testCase := range cases {
+		testCase := testCase
+		t.Run(name, func(t *testing.T) {
+			cfg, err := newConfig(strings.NewReader(testCase.inJson), nil)
+			if !errors.Is(err, testCase.errOnConfig) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", testCase.errOnConfig, err)
+			}
+			if err != nil {
+				return
+			}
+			_, err = cfg.named.newSensor(testCase.inName, zap.NewNop())
+			if !errors.Is(err, testCase.errOnSensor) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", testCase.errOnSensor, err)
+			}
+		})
+	}
+}
+
+func Test_config_newHeatsinks_error_unknownAmbientSensor(t *testing.T) {
+	t.Parallel()
+
+	sensorFile, cleanup := temporaryFile(t)
+	defer cleanup()
+
+	jsonData := strings.NewReader(fmt.Sprintf(`
+		{
+		  "heatsinks": [
+		    {
+		      "max_temp": 10,
+		      "sensor_path_globs": [%q],
+		      "ambient_sensor": "does-not-exist"
+		    }
+		  ]
+		}
+	`, sensorFile.Name(),
+	))
+
+	cfg, err := newConfig(jsonData, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cfg.newHeatsinks()
+	if !errors.Is(err, errSensorNameUnknown) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", errSensorNameUnknown, err)
+	}
+}
+
+func Test_config_newHeatsinks_fan_conflictChkPeriod_wrongType(t *testing.T) {
+	t.Parallel()
+
+	sensorFile, cleanup := temporaryFile(t)
+	defer cleanup()
+
+	jsonData := strings.NewReader(fmt.Sprintf(`
+    {
+      "heatsinks": [
+        {
+          "max_temp": 10,
+          "fan": {
+            "conflict_check_period": "ten seconds"
+          },
+          "sensor_path_globs": [%q]
+        }
+      ]
+    }
+  `, sensorFile.Name(),
+	))
+
+	cfg, err := newConfig(jsonData, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = cfg.newHeatsinks()
+	if !errors.Is(err, errBadDuration) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", errBadDuration, err)
+	}
+}
+
+func Test_config_newHeatsinks_faultInjection(t *testing.T) {
+	t.Parallel()
+
+	sensorFile, cleanup := temporaryFile(t)
+	defer cleanup()
+	if _, err := sensorFile.WriteString("40000"); err != nil {
+		t.Fatal(err)
+	}
+	fanFile, cleanup := temporaryFile(t)
+	defer cleanup()
+
+	jsonData := fmt.Sprintf(`
+    {
+      "heatsinks": [
+        {
+          "max_temp": 50,
+          "temp_check_period": "1ms",
+          "fan": {"path_glob": %q},
+          "sensor_path_globs": [%q],
+          "fault_injection": {"sensors": {"fail_every": 1}}
+        }
+      ]
+    }
+  `, fanFile.Name(), sensorFile.Name(),
+	)
+
+	testCases := []struct {
+		name     string
+		enabled  bool
+		expected error
+	}{
+		{"enabled", true, faultinject.ErrInjected},
+		{"disabled", false, heatsink.ErrControllerStopped},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := newConfig(strings.NewReader(jsonData), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg.faultInjection = tc.enabled
+
+			heatsinks, err := cfg.newHeatsinks()
+			if err != nil {
+				t.Fatal(err)
+			}
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				heatsinks[0].StopThermalControl()
+			}()
+			if err := heatsinks[0].StartThermalControl(); !errors.Is(err, tc.expected) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func Test_config_newHeatsinks_faultInjection_wrongType(t *testing.T) {
+	t.Parallel()
+
+	jsonData := strings.NewReader(`
+    {
+      "heatsinks": [
+        {
+          "fault_injection": {"fan": {"delay": "a while"}}
+        }
+      ]
+    }
+  `)
+
+	cfg, err := newConfig(jsonData, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.faultInjection = true
+
+	_, err = cfg.newHeatsinks()
+	if !errors.Is(err, errBadDuration) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", errBadDuration, err)
+	}
+}
+
+func Test_config_newHeatsinks_circuitBreaker(t *testing.T) {
+	t.Parallel()
+
+	sensorFile, cleanup := temporaryFile(t)
+	defer cleanup()
+	if _, err := sensorFile.WriteString("40000"); err != nil {
+		t.Fatal(err)
+	}
+	fanFile, cleanup := temporaryFile(t)
+	defer cleanup()
+
+	jsonData := strings.NewReader(fmt.Sprintf(`
+    {
+      "heatsinks": [
+        {
+          "max_temp": 50,
+          "fan": {"path_glob": %q},
+          "sensor_path_globs": [%q],
+          "fault_injection": {"sensors": {"delay": "100ms"}},
+          "circuit_breaker": {"failure_threshold": 1, "sensor_timeout": "1ms"}
+        }
+      ]
+    }
+  `, fanFile.Name(), sensorFile.Name(),
+	))
+
+	core, logs := observer.New(zap.WarnLevel)
+	cfg, err := newConfig(jsonData, zap.New(core))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.faultInjection = true
+
+	heatsinks, err := cfg.newHeatsinks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := heatsinks[0].StartThermalControl(); !errors.Is(err, breaker.ErrTimeout) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", breaker.ErrTimeout, err)
+	}
+
+	entries := logs.FilterMessage("circuit breaker changed its state").AllUntimed()
+	if len(entries) != 1 {
+		t.Fatalf("expected one state change to be logged, got: %v", entries)
+	}
+	expected := map[string]interface{}{
+		"event":  "circuit_breaker_state_change",
+		"device": sensorFile.Name(),
+		"from":   "closed",
+		"to":     "open",
+	}
+	if diff := deep.Equal(entries[0].ContextMap(), expected); diff != nil {
+		t.Fatal(diff)
+	}
+}
+
+func Test_config_newHeatsinks_circuitBreaker_wrongType(t *testing.T) {
+	t.Parallel()
+
+	jsonData := strings.NewReader(`
+    {
+      "heatsinks": [
+        {
+          "circuit_breaker": {"open_duration": "forever"}
+        }
+      ]
+    }
+  `)
+
+	cfg, err := newConfig(jsonData, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = cfg.newHeatsinks()
+	if !errors.Is(err, errBadDuration) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", errBadDuration, err)
+	}
+}
+
+func Test_config_newHeatsinks_logSummary_wrongType(t *testing.T) {
+	t.Parallel()
+
+	jsonData := strings.NewReader(`
+    {
+      "heatsinks": [
+        {
+          "log_summary": {"period": "hourly"}
+        }
+      ]
+    }
+  `)
+
+	cfg, err := newConfig(jsonData, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = cfg.newHeatsinks()
+	if !errors.Is(err, errBadDuration) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", errBadDuration, err)
+	}
+}
+
+func Test_config_newHeatsinks_checkTiming_wrongType(t *testing.T) {
+	t.Parallel()
+
+	for _, field := range []string{
+		`"check_period_jitter": "a little"`,
+		`"phase_offset": "a little"`,
+		`"adaptive_check_period": {"max_period": "a while", "max_rate": 0.5}`,
+		`"unchanged_duty_cycle": {"refresh": "a while"}`,
+	} {
+		jsonData := strings.NewReader(fmt.Sprintf(`
+      {
+        "heatsinks": [
+          {
+            %s
+          }
+        ]
+      }
+    `, field))
+
+		cfg, err := newConfig(jsonData, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = cfg.newHeatsinks()
+		if !errors.Is(err, errBadDuration) {
+			t.Errorf("%s: unexpected error\nwant: %v\n got: %v", field, errBadDuration, err)
+		}
+	}
+}
+
+func Test_config_newHeatsinks_auxInputs(t *testing.T) {
+	t.Parallel()
+
+	sensorFile, cleanup := temporaryFile(t)
+	defer cleanup()
+	fanFile, cleanup := temporaryFile(t)
+	defer cleanup()
+
+	domainDir, err := ioutil.TempDir("", "intel-rapl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(domainDir)
+	energyFile := filepath.Join(domainDir, "energy_uj")
+	if err := ioutil.WriteFile(energyFile, []byte("1000\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	statFile := filepath.Join(domainDir, "stat")
+	if err := ioutil.WriteFile(statFile, []byte("cpu  10 0 10 80 0 0 0 0 0 0\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name     string
+		auxInput string
+		expected error
+	}{
+		{"rapl", fmt.Sprintf(`{"type": "rapl", "path_glob": %q, "low": 15, "high": 95}`, domainDir), nil},
+		{"cpu-load", fmt.Sprintf(`{"type": "cpu_load", "path_glob": %q, "low": 80, "high": 100, "smoothing": "30s"}`, statFile), nil},
+		{"cpu-load-bad-smoothing", `{"type": "cpu_load", "smoothing": "half a minute"}`, errBadDuration},
+		{"unknown-type", `{"type": "thermal-camera"}`, errAuxInputTypeUnknown},
+		{"no-domain", `{"type": "rapl", "path_glob": "/this/domain/does/not/exist"}`, errGlobNoMatches},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			jsonData := strings.NewReader(fmt.Sprintf(`
+        {
+          "heatsinks": [
+            {
+              "max_temp": 50,
+              "fan": {"path_glob": %q},
+              "sensor_path_globs": [%q],
+              "aux_inputs": [%s]
+            }
+          ]
+        }
+      `, fanFile.Name(), sensorFile.Name(), tc.auxInput,
+			))
+
+			cfg, err := newConfig(jsonData, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			heatsinks, err := cfg.newHeatsinks()
+			if !errors.Is(err, tc.expected) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", tc.expected, err)
+			}
+			for _, hs := range heatsinks {
+				hs.StopThermalControl()
+			}
+		})
+	}
+}
+
+func Test_config_newHeatsinks_sharedFan(t *testing.T) {
+	t.Parallel()
+
+	sensorFile, cleanup := temporaryFile(t)
+	defer cleanup()
+	fanFile, cleanup := temporaryFile(t)
+	defer cleanup()
+
+	jsonData := strings.NewReader(fmt.Sprintf(`
+    {
+      "heatsinks": [
+        {"name": "cpu", "max_temp": 50, "fan": {"path_glob": %q}, "sensor_path_globs": [%q]},
+        {"name": "gpu", "max_temp": 50, "fan": {"path_glob": %q}, "sensor_path_globs": [%q]}
+      ]
+    }
+  `, fanFile.Name(), sensorFile.Name(), fanFile.Name(), sensorFile.Name()))
+
+	cfg, err := newConfig(jsonData, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cfg.newHeatsinks()
+	if !errors.Is(err, fanpwm.ErrDeviceLocked) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", fanpwm.ErrDeviceLocked, err)
+	}
+
+	// the fan of the first heatsink was released along with the lock
+	fan, err := fanpwm.New(fanFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fan.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_configRespBounds_option(t *testing.T) {
+
+	exclusive := false
+	cases := map[string]struct {
+		bounds   configRespBounds
+		expected []float64
+	}{
+		"defaults": {
+			bounds:   configRespBounds{},
+			expected: []float64{0, 1},
+		},
+		"min-only": {
+			bounds:   configRespBounds{Min: &configBoundary{DutyCycle: 0.3}},
+			expected: []float64{0.3, 1},
+		},
+		"max-inclusive": {
+			bounds:   configRespBounds{Max: &configBoundary{DutyCycle: 0.9}},
+			expected: []float64{0, 0.9},
+		},
+		"max-exclusive": {
+			bounds:   configRespBounds{Max: &configBoundary{DutyCycle: 0.9, Inclusive: &exclusive}},
+			expected: []float64{0, 1},
+		},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			fan := &heatsinktest.FakeFanDriver{}
+			sensor := &heatsinktest.FakeThermoSensor{
+				TemperatureVals: []float64{25, 50},
+				TemperatureErrs: []error{nil, nil, heatsink.ErrThermoSensorClosed},
+			}
+			hs, err := heatsink.New(
+				&heatsink.Config{
+					Fan:            fan,
+					Sensors:        []heatsink.ThermoSensor{sensor},
+					MinTemperature: 30,
+					MaxTemperature: 50,
+				},
+				heatsink.OptFanResponse(heatsink.FanResponseLinear),
+				heatsink.OptTemperatureCheckPeriod(time.Millisecond),
+				c.bounds.option(),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hs.StartThermalControl()
+			if diff := deep.Equal(fan.DutyCycles(), c.expected); diff != nil {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func Test_configFan_stepsOption(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		fan      configFan
+		expected error
+	}{
+		"valid": {
+			fan:      configFan{Steps: []configStep{{AboveTemp: 40, DutyCycle: 0.3}}, StepDwell: "10s"},
+			expected: nil,
+		},
+		"no-steps": {
+			fan:      configFan{StepDwell: "10s"},
+			expected: errNoSteps,
+		},
+		"bad-dwell": {
+			fan:      configFan{Steps: []configStep{{AboveTemp: 40, DutyCycle: 0.3}}, StepDwell: "ten seconds"},
+			expected: errBadDuration,
+		},
+	}
+	for name, testCase := range cases {
+		opt, err := testCase.fan.stepsOption()
+		if !errors.Is(err, testCase.expected) {
+			t.Errorf("%s: unexpected error\nwant: %v\n got: %v", name, testCase.expected, err)
+		}
+		if err == nil && opt == nil {
+			t.Errorf("%s: expected an option", name)
+		}
+	}
+}
+
+func Test_configFan_exprOption(t *testing.T) {
+	t.Parallel()
+
+	fan := &heatsinktest.FakeFanDriver{}
+	sensor := &heatsinktest.FakeThermoSensor{
+		TemperatureVals: []float64{20, 50, 90},
+		TemperatureErrs: []error{nil, nil, nil, heatsink.ErrThermoSensorClosed},
+	}
+	opt, err := configFan{Expr: "clamp((t-30)/40, 0, 1)^2"}.exprOption()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs, err := heatsink.New(
+		&heatsink.Config{
+			Fan:            fan,
+			Sensors:        []heatsink.ThermoSensor{sensor},
+			MinTemperature: 30,
+			MaxTemperature: 70,
+		},
+		heatsink.OptTemperatureCheckPeriod(time.Millisecond),
+		opt,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs.StartThermalControl()
+	if diff := deep.Equal(fan.DutyCycles(), []float64{0, 0.25, 1}); diff != nil {
+		t.Fatal(diff)
+	}
+}
+
+func Test_newConfig_curveExpr(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		fan      string
+		expected error
+	}{
+		"implied":      {fan: `{"expr": "(t - 30) / 40"}`},
+		"explicit":     {fan: `{"response_type": "Expr", "expr": "t / 100"}`},
+		"missing":      {fan: `{"response_type": "expr"}`, expected: errBadCurveExpr},
+		"syntax":       {fan: `{"expr": "(t - 30"}`, expected: errBadCurveExpr},
+		"unknown-var":  {fan: `{"expr": "temp / 100"}`, expected: errBadCurveExpr},
+		"unknown-func": {fan: `{"expr": "sqrt(t)"}`, expected: errBadCurveExpr},
+	}
+	for name, testCase := range cases {
+		jsonData := strings.NewReader(fmt.Sprintf(`{"heatsinks": [{"max_temp": 50, "fan": %s}]}`, testCase.fan))
+		cfg, err := newConfig(jsonData, nil)
+		if !errors.Is(err, testCase.expected) {
+			t.Errorf("%s: unexpected error\nwant: %v\n got: %v", name, testCase.expected, err)
+		}
+		if err == nil && cfg.Heatsinks[0].Fan.curve == nil {
+			t.Errorf("%s: expected the expression to be compiled when loading the config", name)
+		}
+	}
 }
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// defaultWatchDebounce is how long the config file must be left alone after a change before
+// it is reloaded, so that an editor that writes it in several steps causes a single reload
+const defaultWatchDebounce = time.Second
+
+// configWatch reloads the daemon automatically when the config file changes
+type configWatch struct {
+	// Debounce is a duration, or a number of seconds
+	Debounce configDuration `json:"debounce,omitempty"`
+}
+
+// configWatcher watches the config file and requests a reload once it changed and is valid
+type configWatcher struct {
+	path     string
+	strict   bool
+	debounce time.Duration
+	logger   *zap.Logger
+}
+
+// newConfigWatcher returns a watcher of the config file at the given path, or nil if the config
+// does not enable watching it
+func (c *config) newConfigWatcher(path string, strict bool) (*configWatcher, error) {
+
+	if c.WatchConfig == nil {
+		return nil, nil
+	}
+	debounce, err := c.WatchConfig.Debounce.duration("watch_config.debounce", time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if debounce <= 0 {
+		debounce = defaultWatchDebounce
+	}
+	return &configWatcher{path: path, strict: strict, debounce: debounce, logger: c.logger}, nil
+}
+
+// start watches the config file until the returned function is called. Reload requests of the
+// given channel, e.g. of the control socket, are delivered on the returned channel along with
+// those of config changes. A change is only delivered once the file was left alone for the
+// debounce period and it loads without errors, so that a broken edit never stops the running
+// control loops. An invalid change is logged and the file is watched for the next one
+func (w *configWatcher) start(reload <-chan struct{}) (merged <-chan struct{}, stop func(), err error) {
+
+	changes, stopWatching, err := watchFile(w.path)
+	if err != nil {
+		return nil, nil, err
+	}
+	out := make(chan struct{}, 1)
+	request := func() {
+		select {
+		case out <- struct{}{}:
+		default: // a reload is already pending
+		}
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		debounce := time.NewTimer(w.debounce)
+		if !debounce.Stop() {
+			<-debounce.C
+		}
+		defer debounce.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-reload:
+				request()
+			case <-changes:
+				if !debounce.Stop() {
+					select {
+					case <-debounce.C:
+					default:
+					}
+				}
+				debounce.Reset(w.debounce)
+			case <-debounce.C:
+				if err := validateConfigFile(w.path, w.strict); err != nil {
+					w.logger.Error(
+						"ignoring change of config file that failed to load, keeping the running config",
+						zap.String("event", "config_change_invalid"),
+						zap.Error(err),
+						zap.String("filename", w.path),
+					)
+					continue
+				}
+				w.logger.Info("config file changed, reloading", zap.String("filename", w.path))
+				request()
+			}
+		}
+	}()
+	w.logger.Info("watching config file", zap.String("filename", w.path), zap.Duration("debounce", w.debounce))
+
+	stop = func() {
+		close(done)
+		wg.Wait()
+		stopWatching()
+	}
+	return out, stop, nil
+}
+
+// validateConfigFile returns an error if the config file at the given path cannot be loaded or
+// the daemon cannot be built from it, e.g. because a sensor glob matches nothing or a fan has
+// an unknown response type. The daemon is built with dry-run fans, which leave the fans of the
+// running daemon alone, and is released right away
+func validateConfigFile(path string, strict bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	cfg, err := newConfig(file, zap.NewNop())
+	if err == nil && strict {
+		err = cfg.rejectUnknownFields()
+	}
+	if err != nil {
+		return err
+	}
+	cfg.dryRun = true
+	d, err := cfg.newDaemon(path, strict)
+	if err != nil {
+		return err
+	}
+	d.release(cfg.sinks, cfg.logger)
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+// watchEvents are the inotify events of a directory that may change the watched file, which
+// includes editors that save by renaming a new file over it
+const watchEvents = syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE | syscall.IN_CREATE |
+	syscall.IN_MOVED_TO | syscall.IN_DELETE
+
+// watchFile delivers a value on the returned channel whenever the given file may have changed,
+// until the returned function is called. The directory of the file is watched with inotify(7),
+// rather than the file itself, so that the watch survives the file being replaced
+func watchFile(path string) (changes <-chan struct{}, stop func(), err error) {
+
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, nil, os.NewSyscallError("inotify_init1", err)
+	}
+	if _, err := syscall.InotifyAddWatch(fd, filepath.Dir(path), watchEvents); err != nil {
+		syscall.Close(fd)
+		return nil, nil, os.NewSyscallError("inotify_add_watch", err)
+	}
+	// a non-blocking fd is handed to the runtime poller, so that closing it ends a pending read
+	file := os.NewFile(uintptr(fd), "inotify")
+	name := []byte(filepath.Base(path))
+
+	out := make(chan struct{}, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+		for {
+			n, err := file.Read(buf)
+			if err != nil {
+				return
+			}
+			for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+				event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+				start := offset + syscall.SizeofInotifyEvent
+				end := start + int(event.Len)
+				offset = end
+				if end > n || !bytes.Equal(bytes.TrimRight(buf[start:end], "\x00"), name) {
+					continue
+				}
+				select {
+				case out <- struct{}{}:
+				default: // a change is already pending
+				}
+			}
+		}
+	}()
+
+	stop = func() {
+		file.Close()
+		<-done
+	}
+	return out, stop, nil
+}
@@ -0,0 +1,52 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// watchPollPeriod is how often the config file is checked for changes without inotify
+const watchPollPeriod = time.Second
+
+// watchFile delivers a value on the returned channel whenever the given file may have changed,
+// until the returned function is called. The file is polled for changes of its modification
+// time or size, since inotify(7) is only supported on linux
+func watchFile(path string) (changes <-chan struct{}, stop func(), err error) {
+
+	last, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	out := make(chan struct{}, 1)
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(watchPollPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			info, err := os.Stat(path)
+			if err != nil || (info.ModTime().Equal(last.ModTime()) && info.Size() == last.Size()) {
+				continue
+			}
+			last = info
+			select {
+			case out <- struct{}{}:
+			default: // a change is already pending
+			}
+		}
+	}()
+
+	stop = func() {
+		close(done)
+		<-stopped
+	}
+	return out, stop, nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func Test_configWatcher(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.json")
+	write := func(filename, contents string) {
+		if err := ioutil.WriteFile(filename, []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a change is only delivered if the daemon can be built from it, i.e. given real devices
+	sensor, fan := filepath.Join(dir, "temp1_input"), filepath.Join(dir, "pwm1")
+	write(sensor, "40000")
+	write(fan, "")
+	heatsink := func(name string) string {
+		return fmt.Sprintf(
+			`{"name": %q, "max_temp": 60, "sensor_path_globs": [%q], "fan": {"path_glob": %q}}`, name, sensor, fan,
+		)
+	}
+	write(path, `{"heatsinks": [`+heatsink("cpu")+`], "watch_config": {"debounce": "50ms"}}`)
+	write(filepath.Join(dir, "other.json"), `{}`)
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	cfg, err := newConfig(file, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := cfg.newConfigWatcher(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	control := make(chan struct{}, 1)
+	reload, stop, err := w.start(control)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	expectReload := func(step string, expected bool) {
+		t.Helper()
+		// a change is only delivered after the debounce period, and after polling off linux
+		timeout := 500 * time.Millisecond
+		if expected {
+			timeout = 5 * time.Second
+		}
+		select {
+		case <-reload:
+			if !expected {
+				t.Errorf("%s: unexpected reload", step)
+			}
+		case <-time.After(timeout):
+			if expected {
+				t.Errorf("%s: expected a reload", step)
+			}
+		}
+	}
+
+	write(filepath.Join(dir, "other.json"), `{"heatsinks": []}`)
+	expectReload("other file changed", false)
+
+	write(path, `{"heatsinks": [`)
+	expectReload("invalid change", false)
+
+	write(path, `{"heatsinks": [{"name": "gpu", "max_temp": 60, "sensor_path_globs": ["/non/existent"]}]}`)
+	expectReload("change that fails to build", false)
+
+	write(path, `{"heatsinks": [`+heatsink("gpu")+`], "watch_config": {"debounce": "50ms"}}`)
+	expectReload("valid change", true)
+
+	replacement := filepath.Join(dir, "config.json.tmp")
+	write(replacement, `{"heatsinks": [`+heatsink("cpu")+`]}`)
+	if err := os.Rename(replacement, path); err != nil {
+		t.Fatal(err)
+	}
+	expectReload("replaced", true)
+
+	control <- struct{}{}
+	expectReload("requested over the control socket", true)
+}
+
+func Test_config_newConfigWatcher(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config{logger: zap.NewNop()}
+	if w, err := cfg.newConfigWatcher("config.json", false); w != nil || err != nil {
+		t.Fatalf("expected no watcher unless it is enabled, got: %+v, %v", w, err)
+	}
+
+	cfg.WatchConfig = &configWatch{}
+	w, err := cfg.newConfigWatcher("config.json", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.debounce != defaultWatchDebounce {
+		t.Errorf("unexpected debounce\nwant: %v\n got: %v", defaultWatchDebounce, w.debounce)
+	}
+
+	cfg.WatchConfig = &configWatch{Debounce: "soon"}
+	if _, err := cfg.newConfigWatcher("config.json", false); !errors.Is(err, errBadDuration) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", errBadDuration, err)
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/malkhamis/heatsink"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultControlSocket is where the daemon listens for commands and where the client
+	// subcommands connect to, unless told otherwise
+	defaultControlSocket     = "/run/heatsink.sock"
+	defaultControlSocketMode = 0660
+)
+
+// controlTimeout bounds how long a single connection to the control socket may take
+const controlTimeout = 5 * time.Second
+
+// Commands accepted on the control socket
+const (
+	controlStatus  = "status"
+	controlSet     = "set"
+	controlProfile = "profile"
+	controlReload  = "reload"
+)
+
+var (
+	errControlCommand  = errors.New("unknown control command")
+	errHeatsinkUnknown = errors.New("no heatsink with the given name")
+	errSocketInUse     = errors.New("control socket is in use by another process")
+	errBadSocketMode   = errors.New("invalid control socket mode")
+	errBadSocketGroup  = errors.New("invalid control socket group")
+)
+
+// configControlSocket configures the Unix socket the daemon accepts commands on. The socket is
+// created with the given permissions in octal, e.g. "0660", and may be handed to a group, given
+// by name or id, whose members are then allowed to control the daemon
+type configControlSocket struct {
+	Path     string `json:"path,omitempty"`
+	Mode     string `json:"mode,omitempty"`
+	Group    string `json:"group,omitempty"`
+	Disabled bool   `json:"disabled,omitempty"`
+}
+
+// controlSocket is where and with which permissions the control socket is created
+type controlSocket struct {
+	path string
+	mode os.FileMode
+	gid  int // -1 keeps the group of the daemon
+}
+
+// resolve returns the control socket to create, whose path is empty if it is disabled. If
+// the given path is not nil, it replaces the configured one. A nil config means the defaults
+func (c *configControlSocket) resolve(path *string) (controlSocket, error) {
+
+	socket := controlSocket{path: defaultControlSocket, mode: defaultControlSocketMode, gid: -1}
+	if c == nil {
+		c = &configControlSocket{}
+	}
+	switch {
+	case path != nil:
+		socket.path = *path
+	case c.Disabled:
+		socket.path = ""
+	case c.Path != "":
+		socket.path = c.Path
+	}
+
+	if c.Mode != "" {
+		mode, err := strconv.ParseUint(c.Mode, 8, 32)
+		if err != nil || mode > 0777 {
+			return controlSocket{}, fmt.Errorf("%w: '%s'", errBadSocketMode, c.Mode)
+		}
+		socket.mode = os.FileMode(mode)
+	}
+
+	if c.Group != "" {
+		gid, err := strconv.Atoi(c.Group)
+		if err != nil {
+			group, lookupErr := user.LookupGroup(c.Group)
+			if lookupErr != nil {
+				return controlSocket{}, fmt.Errorf("%w: %v", errBadSocketGroup, lookupErr)
+			}
+			gid, err = strconv.Atoi(group.Gid)
+		}
+		if err != nil || gid < 0 {
+			return controlSocket{}, fmt.Errorf("%w: '%s'", errBadSocketGroup, c.Group)
+		}
+		socket.gid = gid
+	}
+	return socket, nil
+}
+
+// controlRequest is a command sent to the daemon over the control socket
+type controlRequest struct {
+	Command  string `json:"command"`
+	Heatsink string `json:"heatsink,omitempty"`
+	// DutyCycle is the manual duty cycle ratio for 'set'; if nil, the heatsink goes back to
+	// following its fan response curve
+	DutyCycle *float64 `json:"duty_cycle,omitempty"`
+	// Profile is the profile to pin for 'profile'; if empty, the profile status is returned
+	Profile string `json:"profile,omitempty"`
+}
+
+// controlResponse is the daemon's answer to a control request
+type controlResponse struct {
+	Error     string           `json:"error,omitempty"`
+	Heatsinks []heatsinkStatus `json:"heatsinks,omitempty"`
+	Profile   *profileStatus   `json:"profile,omitempty"`
+}
+
+// heatsinkStatus is the state of a single heatsink as reported by the 'status' command
+type heatsinkStatus struct {
+	Name         string    `json:"name"`
+	Sensor       string    `json:"sensor"`
+	Temperature  float64   `json:"temperature"`
+	DutyCycle    float64   `json:"duty_cycle"`
+	Manual       *float64  `json:"manual_duty_cycle,omitempty"`
+	MaxDutyCycle *float64  `json:"max_duty_cycle,omitempty"`
+	Critical     bool      `json:"critical"`
+	Time         time.Time `json:"time"`
+	Stopped      bool      `json:"stopped"`
+}
+
+// newHeatsinkStatus returns the status of the given heatsink as of its last sample
+func newHeatsinkStatus(hs *heatsink.Heatsink) heatsinkStatus {
+	sample := hs.LastSample()
+	status := heatsinkStatus{
+		Name:        hs.Name(),
+		Sensor:      sample.Sensor,
+		Temperature: sample.Temperature,
+		DutyCycle:   sample.DutyCycle,
+		Critical:    sample.Critical,
+		Time:        sample.Time,
+		Stopped:     hs.Stopped(),
+	}
+	if dc, ok := hs.ManualDutyCycle(); ok {
+		status.Manual = &dc
+	}
+	if dc, ok := hs.MaxDutyCycle(); ok {
+		status.MaxDutyCycle = &dc
+	}
+	return status
+}
+
+// controlServer answers requests on the control socket, one request per connection
+type controlServer struct {
+	heatsinks  []*heatsink.Heatsink
+	profiles   *profileSwitcher
+	configPath string
+	strict     bool
+	reload     chan struct{}
+	logger     *zap.Logger
+}
+
+// handle executes the given request and returns the response to send back
+func (s *controlServer) handle(req controlRequest) controlResponse {
+
+	var err error
+	switch req.Command {
+	case controlStatus:
+	case controlSet:
+		err = s.set(req.Heatsink, req.DutyCycle)
+	case controlProfile:
+		if req.Profile != "" {
+			err = s.profiles.pin(req.Profile)
+		}
+		if err == nil {
+			current, pinned := s.profiles.status()
+			return controlResponse{
+				Profile: &profileStatus{Active: current, Pinned: pinned, Available: s.profiles.names()},
+			}
+		}
+	case controlReload:
+		err = s.requestReload()
+	default:
+		err = fmt.Errorf("%w: '%s'", errControlCommand, req.Command)
+	}
+	if err != nil {
+		return controlResponse{Error: err.Error()}
+	}
+
+	resp := controlResponse{Heatsinks: []heatsinkStatus{}}
+	for _, hs := range s.heatsinks {
+		if req.Heatsink == "" || req.Heatsink == hs.Name() {
+			resp.Heatsinks = append(resp.Heatsinks, newHeatsinkStatus(hs))
+		}
+	}
+	if len(resp.Heatsinks) == 0 && req.Heatsink != "" {
+		return controlResponse{Error: fmt.Sprintf("%v: '%s'", errHeatsinkUnknown, req.Heatsink)}
+	}
+	return resp
+}
+
+// set pins the named heatsink to the given duty cycle ratio or, if it is nil, returns it to
+// its fan response curve
+func (s *controlServer) set(name string, dcRatio *float64) error {
+	for _, hs := range s.heatsinks {
+		if hs.Name() != name {
+			continue
+		}
+		if dcRatio == nil {
+			hs.ClearManualDutyCycle()
+		} else {
+			hs.SetManualDutyCycle(*dcRatio)
+		}
+		s.logger.Info(
+			"manual duty cycle changed over the control socket",
+			zap.String("heatsink", name), zap.Float64p("duty_cycle", dcRatio),
+		)
+		return nil
+	}
+	return fmt.Errorf("%w: '%s'", errHeatsinkUnknown, name)
+}
+
+// requestReload validates the config file and, if it is valid, asks the daemon to restart
+// thermal control with it. A config that cannot be loaded, or whose heatsinks and helpers
+// cannot be built from it, leaves the running one untouched
+func (s *controlServer) requestReload() error {
+	if err := validateConfigFile(s.configPath, s.strict); err != nil {
+		return err
+	}
+	select {
+	case s.reload <- struct{}{}:
+	default: // a reload is already pending
+	}
+	return nil
+}
+
+// serve answers a single request on the given connection
+func (s *controlServer) serve(conn net.Conn) {
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(controlTimeout)); err != nil {
+		s.logger.Warn("failed to set control connection deadline", zap.Error(err))
+		return
+	}
+	var req controlRequest
+	var resp controlResponse
+	if err := json.NewDecoder(io.LimitReader(conn, maxPolicyHookOutput)).Decode(&req); err != nil {
+		resp.Error = fmt.Sprintf("decoding request: %v", err)
+	} else {
+		resp = s.handle(req)
+	}
+	if err := json.NewEncoder(conn).Encode(resp); err != nil {
+		s.logger.Warn("failed to write control response", zap.Error(err))
+	}
+}
+
+// serveControl listens on the given Unix socket and answers control requests until the
+// returned function is called. A socket file left behind by a previous run is replaced, but
+// one that another process still listens on is not. Reload requests are delivered on the
+// returned channel
+func serveControl(
+	socket controlSocket, configPath string, strictConfig bool,
+	heatsinks []*heatsink.Heatsink, profiles *profileSwitcher, logger *zap.Logger,
+) (reload <-chan struct{}, stop func(), err error) {
+
+	path := socket.path
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("%w: %s", errSocketInUse, path)
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := os.Chmod(path, socket.mode); err != nil {
+		listener.Close()
+		return nil, nil, err
+	}
+	if socket.gid >= 0 {
+		if err := os.Chown(path, -1, socket.gid); err != nil {
+			listener.Close()
+			return nil, nil, err
+		}
+	}
+
+	s := &controlServer{
+		heatsinks:  heatsinks,
+		profiles:   profiles,
+		configPath: configPath,
+		strict:     strictConfig,
+		reload:     make(chan struct{}, 1),
+		logger:     logger,
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.serve(conn)
+			}()
+		}
+	}()
+	logger.Info("serving control socket", zap.String("path", path))
+
+	stop = func() {
+		listener.Close() // also removes the socket file
+		wg.Wait()
+	}
+	return s.reload, stop, nil
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/malkhamis/heatsink"
+	"go.uber.org/zap"
+)
+
+// testControlServer returns a control server for a single heatsink named after the test that
+// defines the profile 'silent'
+func testControlServer(t *testing.T, configPath string) (s *controlServer, cleanup func()) {
+	t.Helper()
+
+	hs, cleanup := testHeatsink(t, "40000")
+	silent := 0.3
+	s = &controlServer{
+		heatsinks: []*heatsink.Heatsink{hs},
+		profiles: &profileSwitcher{
+			logger:  zap.NewNop(),
+			targets: []profileTarget{{hs: hs, profiles: map[string]configProfile{"silent": {MaxDutyCycle: &silent}}}},
+		},
+		configPath: configPath,
+		reload:     make(chan struct{}, 1),
+		logger:     zap.NewNop(),
+	}
+	return s, cleanup
+}
+
+func Test_controlServer_handle(t *testing.T) {
+
+	s, cleanup := testControlServer(t, "/this/file/does/not/exist")
+	defer cleanup()
+	name := s.heatsinks[0].Name()
+	half := 0.5
+
+	resp := s.handle(controlRequest{Command: controlSet, Heatsink: name, DutyCycle: &half})
+	if resp.Error != "" || len(resp.Heatsinks) != 1 {
+		t.Fatalf("unexpected response to set: %+v", resp)
+	}
+	if diff := deep.Equal(resp.Heatsinks[0].Manual, &half); diff != nil {
+		t.Fatal(diff)
+	}
+	if dc, ok := s.heatsinks[0].ManualDutyCycle(); !ok || dc != half {
+		t.Fatalf("expected the manual duty cycle to be set\nwant: %v, true\n got: %v, %v", half, dc, ok)
+	}
+
+	resp = s.handle(controlRequest{Command: controlSet, Heatsink: name})
+	if resp.Error != "" || resp.Heatsinks[0].Manual != nil {
+		t.Fatalf("unexpected response to set auto: %+v", resp)
+	}
+	if _, ok := s.heatsinks[0].ManualDutyCycle(); ok {
+		t.Fatal("expected the manual duty cycle to be cleared")
+	}
+
+	resp = s.handle(controlRequest{Command: controlProfile, Profile: "silent"})
+	expected := &profileStatus{Active: "silent", Pinned: true, Available: []string{"silent"}}
+	if diff := deep.Equal(resp.Profile, expected); diff != nil {
+		t.Fatal(diff)
+	}
+
+	resp = s.handle(controlRequest{Command: controlStatus})
+	if resp.Error != "" || len(resp.Heatsinks) != 1 || resp.Heatsinks[0].Name != name {
+		t.Fatalf("unexpected response to status: %+v", resp)
+	}
+
+	errCases := []struct {
+		name     string
+		req      controlRequest
+		expected string
+	}{
+		{"unknown command", controlRequest{Command: "explode"}, errControlCommand.Error()},
+		{"unknown heatsink", controlRequest{Command: controlSet, Heatsink: "nope"}, errHeatsinkUnknown.Error()},
+		{"status of unknown heatsink", controlRequest{Command: controlStatus, Heatsink: "nope"}, errHeatsinkUnknown.Error()},
+		{"unknown profile", controlRequest{Command: controlProfile, Profile: "turbo"}, errProfileUnknown.Error()},
+		{"missing config", controlRequest{Command: controlReload}, "no such file or directory"},
+	}
+	for _, tc := range errCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			resp := s.handle(tc.req)
+			if !strings.Contains(resp.Error, tc.expected) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", tc.expected, resp.Error)
+			}
+		})
+	}
+}
+
+func Test_controlServer_reload(t *testing.T) {
+
+	configFile, cleanupConfig := temporaryFile(t)
+	defer cleanupConfig()
+	s, cleanup := testControlServer(t, configFile.Name())
+	defer cleanup()
+
+	if _, err := configFile.WriteString("{ bad json data }"); err != nil {
+		t.Fatal(err)
+	}
+	if resp := s.handle(controlRequest{Command: controlReload}); resp.Error == "" {
+		t.Fatal("expected an invalid config to be rejected")
+	}
+	select {
+	case <-s.reload:
+		t.Fatal("expected no reload given an invalid config")
+	default:
+	}
+
+	// a config that loads but cannot be built, e.g. because its sensors do not exist, would
+	// stop the running daemon
+	unbuildable := `{"heatsinks": [{
+	  "name": "cpu", "min_temp": 35, "max_temp": 65, "sensor_path_globs": ["/non/existent/sensor"],
+	  "fan": {"name": "fan", "path_glob": "/non/existent/fan"}
+	}]}`
+	if err := ioutil.WriteFile(configFile.Name(), []byte(unbuildable), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if resp := s.handle(controlRequest{Command: controlReload}); resp.Error == "" {
+		t.Fatal("expected a config that cannot be built to be rejected")
+	}
+
+	sensorFile, cleanupSensor := temporaryFile(t)
+	defer cleanupSensor()
+	fanFile, cleanupFan := temporaryFile(t)
+	defer cleanupFan()
+	validConfig := fmt.Sprintf(`{"heatsinks": [{
+	  "name": "cpu", "min_temp": 35, "max_temp": 65, "sensor_path_globs": [%q],
+	  "fan": {"name": "fan", "path_glob": %q, "min_speed_value": "0", "max_speed_value": "255"}
+	}]}`, sensorFile.Name(), fanFile.Name())
+	if err := ioutil.WriteFile(configFile.Name(), []byte(validConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ { // a pending reload must not block
+		if resp := s.handle(controlRequest{Command: controlReload}); resp.Error != "" {
+			t.Fatalf("unexpected error\nwant: %v\n got: %v", nil, resp.Error)
+		}
+	}
+	select {
+	case <-s.reload:
+	default:
+		t.Fatal("expected a reload to be requested")
+	}
+}
+
+func Test_configControlSocket_resolve(t *testing.T) {
+
+	override, empty := "/tmp/override.sock", ""
+	testCases := []struct {
+		name        string
+		config      *configControlSocket
+		path        *string
+		expected    controlSocket
+		expectedErr error
+	}{
+		{
+			name:     "defaults",
+			expected: controlSocket{path: defaultControlSocket, mode: 0660, gid: -1},
+		},
+		{
+			name:     "configured",
+			config:   &configControlSocket{Path: "/var/run/fans.sock", Mode: "0600", Group: "0"},
+			expected: controlSocket{path: "/var/run/fans.sock", mode: 0600, gid: 0},
+		},
+		{
+			name:     "group name",
+			config:   &configControlSocket{Group: "root"},
+			expected: controlSocket{path: defaultControlSocket, mode: 0660, gid: 0},
+		},
+		{
+			name:     "disabled",
+			config:   &configControlSocket{Path: "/var/run/fans.sock", Disabled: true},
+			expected: controlSocket{mode: 0660, gid: -1},
+		},
+		{
+			name:     "flag overrides config",
+			config:   &configControlSocket{Path: "/var/run/fans.sock", Disabled: true},
+			path:     &override,
+			expected: controlSocket{path: override, mode: 0660, gid: -1},
+		},
+		{
+			name:     "flag disables",
+			config:   &configControlSocket{Path: "/var/run/fans.sock"},
+			path:     &empty,
+			expected: controlSocket{mode: 0660, gid: -1},
+		},
+		{
+			name:        "mode not octal",
+			config:      &configControlSocket{Mode: "rw-rw----"},
+			expectedErr: errBadSocketMode,
+		},
+		{
+			name:        "mode out of range",
+			config:      &configControlSocket{Mode: "01777"},
+			expectedErr: errBadSocketMode,
+		},
+		{
+			name:        "unknown group",
+			config:      &configControlSocket{Group: "no-such-group-exists"},
+			expectedErr: errBadSocketGroup,
+		},
+		{
+			name:        "negative gid",
+			config:      &configControlSocket{Group: "-5"},
+			expectedErr: errBadSocketGroup,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := tc.config.resolve(tc.path)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", tc.expectedErr, err)
+			}
+			if diff := deep.Equal(actual, tc.expected); diff != nil {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func Test_serveControl(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "heatsink-control")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "heatsink.sock")
+
+	// a socket file left behind by a previous run is replaced
+	if err := ioutil.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, cleanup := testControlServer(t, "")
+	defer cleanup()
+	_, stop, err := serveControl(controlSocket{path: path, mode: 0640, gid: os.Getgid()}, "", false, s.heatsinks, s.profiles, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := os.FileMode(0640), info.Mode().Perm(); expected != actual {
+		t.Errorf("unexpected socket permissions\nwant: %v\n got: %v", expected, actual)
+	}
+
+	resp, err := sendControl(path, controlRequest{Command: controlStatus})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Heatsinks) != 1 || resp.Heatsinks[0].Name != s.heatsinks[0].Name() {
+		t.Fatalf("unexpected response to status: %+v", resp)
+	}
+
+	_, _, err = serveControl(controlSocket{path: path, mode: 0660, gid: -1}, "", false, s.heatsinks, s.profiles, zap.NewNop())
+	if !errors.Is(err, errSocketInUse) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", errSocketInUse, err)
+	}
+
+	stop()
+	if _, err := sendControl(path, controlRequest{Command: controlStatus}); err == nil {
+		t.Fatal("expected an error contacting a stopped server")
+	}
+}
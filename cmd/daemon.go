@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/malkhamis/heatsink"
+	"github.com/malkhamis/heatsink/alerts"
+	"go.uber.org/zap"
+)
+
+// daemon is everything that is built from a config before thermal control starts. Nothing but
+// the heatsinks holds devices until it is started
+type daemon struct {
+	heatsinks  []*heatsink.Heatsink
+	profiles   *profileSwitcher
+	policy     *policyHook
+	script     *controlScript
+	bridge     *mqttBridge
+	dbus       *dbusService
+	alerts     *alerts.Watcher
+	rescanners []*sensorRescanner
+	cfgWatcher *configWatcher
+}
+
+// newDaemon builds the heatsinks of this config along with everything that drives or observes
+// them. The given path and strictness are those the config was loaded with. If building fails,
+// whatever was built is released
+func (c *config) newDaemon(configPath string, strict bool) (_ *daemon, err error) {
+
+	// the sinks are created along with the heatsinks and must be closed even if creating the
+	// heatsinks fails, e.g. since some of them flush in the background
+	d := &daemon{}
+	defer func() {
+		if err != nil {
+			d.release(c.sinks, c.logger)
+		}
+	}()
+	heatsinks, err := c.newHeatsinks()
+	if err != nil {
+		return nil, fmt.Errorf("instantiating heatsinks: %w", err)
+	}
+	d.heatsinks = heatsinks
+
+	d.profiles = c.newProfileSwitcher(heatsinks)
+	if d.policy, err = c.newPolicyHook(d.profiles); err != nil {
+		return nil, fmt.Errorf("creating policy hook: %w", err)
+	}
+	if d.script, err = c.newControlScript(heatsinks); err != nil {
+		return nil, fmt.Errorf("creating control script: %w", err)
+	}
+	if d.bridge, err = c.newMQTTBridge(heatsinks); err != nil {
+		return nil, fmt.Errorf("creating mqtt bridge: %w", err)
+	}
+	if d.dbus, err = c.newDBusService(heatsinks, d.profiles); err != nil {
+		return nil, fmt.Errorf("creating dbus service: %w", err)
+	}
+	if d.alerts, err = c.newAlertWatcher(heatsinks, d.bridge); err != nil {
+		return nil, fmt.Errorf("creating alert watcher: %w", err)
+	}
+	if d.rescanners, err = c.newSensorRescanners(heatsinks); err != nil {
+		return nil, fmt.Errorf("creating sensor rescanners: %w", err)
+	}
+	if d.cfgWatcher, err = c.newConfigWatcher(configPath, strict); err != nil {
+		return nil, fmt.Errorf("creating config watcher: %w", err)
+	}
+	return d, nil
+}
+
+// release stops the heatsinks, which releases their fans and sensors, and then closes the given
+// sinks, to which the heatsinks write their samples
+func (d *daemon) release(sinks []sampleSink, logger *zap.Logger) {
+	stopHeatsinks(d.heatsinks, logger)
+	closeSinks(sinks, logger)
+}
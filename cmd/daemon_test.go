@@ -0,0 +1,33 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_config_newDaemon_closesSinksOnError(t *testing.T) {
+	t.Parallel()
+
+	jsonData := strings.NewReader(`
+    {
+      "telemetry": {"influx": {"url": "http://127.0.0.1:1", "bucket": "fans"}},
+      "heatsinks": [{"name": "cpu", "max_temp": 50, "sensor_path_globs": ["/non/existent"]}]
+    }
+  `)
+	cfg, err := newConfig(jsonData, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cfg.newDaemon("", false); err == nil {
+		t.Fatal("expected an error creating the daemon")
+	}
+	if len(cfg.sinks) != 1 {
+		t.Fatalf("expected the influx sink to be created, got: %v", cfg.sinks)
+	}
+	// the sink flushes in the background until it is closed
+	select {
+	case <-cfg.sinks[0].(*influxSink).done:
+	default:
+		t.Error("expected the influx sink to be closed")
+	}
+}
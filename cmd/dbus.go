@@ -0,0 +1,496 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/malkhamis/heatsink"
+	"github.com/malkhamis/heatsink/dbus"
+	"go.uber.org/zap"
+)
+
+var errDBusBus = errors.New("dbus bus must be 'system', 'session', or an address")
+
+const (
+	defaultDBusName     = "org.malkhamis.Heatsink1"
+	defaultDBusInterval = 2 * time.Second
+
+	dbusRootPath         = dbus.ObjectPath("/org/malkhamis/Heatsink1")
+	dbusHeatsinksPath    = dbusRootPath + "/heatsinks"
+	dbusRootInterface    = "org.malkhamis.Heatsink1"
+	dbusHeatsinkIface    = "org.malkhamis.Heatsink1.Heatsink"
+	dbusPropertiesIface  = "org.freedesktop.DBus.Properties"
+	dbusIntrospectIface  = "org.freedesktop.DBus.Introspectable"
+	dbusPropertyReadOnly = "org.freedesktop.DBus.Error.PropertyReadOnly"
+)
+
+// configDBus exposes the daemon on D-Bus, e.g. to desktop applets. Changed properties are
+// announced every interval
+type configDBus struct {
+	Bus      string `json:"bus,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Interval string `json:"interval,omitempty"`
+}
+
+// dbusConn is the subset of the dbus connection used by the service
+type dbusConn interface {
+	RequestName(name string) error
+	Emit(path dbus.ObjectPath, iface, member string, args ...interface{}) error
+	Close() error
+}
+
+// dbusService answers method calls on the daemon's D-Bus objects: the root object, which
+// manages profiles, and an object per heatsink
+type dbusService struct {
+	address  string
+	name     string
+	interval time.Duration
+	targets  []dbusTarget
+	profiles *profileSwitcher
+	logger   *zap.Logger
+	// dial is internally used to ease unit testing
+	dial func(address string, handler dbus.Handler) (dbusConn, error)
+}
+
+// dbusTarget is a heatsink along with the path of its object
+type dbusTarget struct {
+	hs   *heatsink.Heatsink
+	path dbus.ObjectPath
+}
+
+// newDBusService returns the D-Bus service of this config, or nil if none is configured. The
+// service does not connect until it is started
+func (c *config) newDBusService(heatsinks []*heatsink.Heatsink, profiles *profileSwitcher) (*dbusService, error) {
+
+	if c.DBus == nil {
+		return nil, nil
+	}
+
+	var address string
+	switch c.DBus.Bus {
+	case "", "system":
+		address = dbus.SystemBusAddress()
+	case "session":
+		address = dbus.SessionBusAddress()
+	default:
+		if !strings.Contains(c.DBus.Bus, ":") {
+			return nil, fmt.Errorf("%w: '%s'", errDBusBus, c.DBus.Bus)
+		}
+		address = c.DBus.Bus
+	}
+	interval := defaultDBusInterval
+	if c.DBus.Interval != "" {
+		parsed, err := time.ParseDuration(c.DBus.Interval)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errBadDuration, err)
+		}
+		if parsed > 0 {
+			interval = parsed
+		}
+	}
+	name := c.DBus.Name
+	if name == "" {
+		name = defaultDBusName
+	}
+
+	s := &dbusService{
+		address:  address,
+		name:     name,
+		interval: interval,
+		profiles: profiles,
+		logger:   c.logger,
+		dial: func(address string, handler dbus.Handler) (dbusConn, error) {
+			return dbus.Dial(address, dbus.OptHandler(handler))
+		},
+	}
+	for _, hs := range heatsinks {
+		path := dbusHeatsinksPath + "/" + dbus.ObjectPath(dbusPathElement(hs.Name()))
+		s.targets = append(s.targets, dbusTarget{hs: hs, path: path})
+	}
+	return s, nil
+}
+
+// dbusPathElement escapes the given name for use as an element of an object path, whose
+// characters are limited to [A-Za-z0-9_], by replacing every other byte with '_' and its
+// hexadecimal value
+func dbusPathElement(name string) string {
+	if name == "" {
+		return "_"
+	}
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9' && i > 0:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "_%02x", c)
+		}
+	}
+	return b.String()
+}
+
+// rootProperties returns the properties of the root object
+func (s *dbusService) rootProperties() map[string]dbus.Variant {
+	current, pinned := s.profiles.status()
+	return map[string]dbus.Variant{
+		"ActiveProfile": {Value: current},
+		"ProfilePinned": {Value: pinned},
+		"Profiles":      {Value: append([]string{}, s.profiles.names()...)},
+		"Heatsinks":     {Value: s.paths()[1:]},
+	}
+}
+
+// heatsinkProperties returns the properties of the given heatsink's object. Duty cycles that
+// are not set are reported as -1
+func heatsinkProperties(hs *heatsink.Heatsink) map[string]dbus.Variant {
+	status := newHeatsinkStatus(hs)
+	manual, max := -1.0, -1.0
+	if status.Manual != nil {
+		manual = *status.Manual
+	}
+	if status.MaxDutyCycle != nil {
+		max = *status.MaxDutyCycle
+	}
+	var updated int64
+	if !status.Time.IsZero() {
+		updated = status.Time.UnixNano() / int64(time.Microsecond)
+	}
+	return map[string]dbus.Variant{
+		"Name":            {Value: status.Name},
+		"Sensor":          {Value: status.Sensor},
+		"Temperature":     {Value: status.Temperature},
+		"DutyCycle":       {Value: status.DutyCycle},
+		"ManualDutyCycle": {Value: manual},
+		"MaxDutyCycle":    {Value: max},
+		"Critical":        {Value: status.Critical},
+		"Stopped":         {Value: status.Stopped},
+		"LastUpdate":      {Value: updated},
+	}
+}
+
+// properties returns the interface and the properties of the object at the given path
+func (s *dbusService) properties(path dbus.ObjectPath) (string, map[string]dbus.Variant, bool) {
+	if path == dbusRootPath {
+		return dbusRootInterface, s.rootProperties(), true
+	}
+	if t, ok := s.target(path); ok {
+		return dbusHeatsinkIface, heatsinkProperties(t.hs), true
+	}
+	return "", nil, false
+}
+
+func (s *dbusService) target(path dbus.ObjectPath) (dbusTarget, bool) {
+	for _, t := range s.targets {
+		if t.path == path {
+			return t, true
+		}
+	}
+	return dbusTarget{}, false
+}
+
+func (s *dbusService) targetNamed(name string) (dbusTarget, error) {
+	for _, t := range s.targets {
+		if t.hs.Name() == name {
+			return t, nil
+		}
+	}
+	return dbusTarget{}, &dbus.Error{Name: dbus.ErrorInvalidArgs, Message: fmt.Sprintf("%v: '%s'", errHeatsinkUnknown, name)}
+}
+
+// handle answers a method call on any of the service's objects
+func (s *dbusService) handle(call *dbus.Call) ([]interface{}, error) {
+
+	if call.Interface == dbusIntrospectIface && call.Member == "Introspect" {
+		if xml, ok := s.introspect(call.Path); ok {
+			return []interface{}{xml}, nil
+		}
+		return nil, &dbus.Error{Name: dbus.ErrorUnknownObject, Message: string(call.Path)}
+	}
+
+	iface, props, ok := s.properties(call.Path)
+	if !ok {
+		return nil, &dbus.Error{Name: dbus.ErrorUnknownObject, Message: string(call.Path)}
+	}
+	badArgs := &dbus.Error{Name: dbus.ErrorInvalidArgs, Message: "unexpected arguments to " + call.Member}
+
+	if call.Interface == dbusPropertiesIface {
+		var askedIface, prop string
+		if len(call.Body) > 0 {
+			askedIface, _ = call.Body[0].(string)
+		}
+		if len(call.Body) > 1 {
+			prop, _ = call.Body[1].(string)
+		}
+		if askedIface != iface && askedIface != "" {
+			return nil, &dbus.Error{Name: dbus.ErrorInvalidArgs, Message: "no such interface: " + askedIface}
+		}
+		switch call.Member {
+		case "GetAll":
+			return []interface{}{props}, nil
+		case "Get":
+			value, ok := props[prop]
+			if !ok {
+				return nil, &dbus.Error{Name: dbus.ErrorInvalidArgs, Message: "no such property: " + prop}
+			}
+			return []interface{}{value}, nil
+		case "Set":
+			return nil, &dbus.Error{Name: dbusPropertyReadOnly, Message: prop}
+		}
+		return nil, &dbus.Error{Name: dbus.ErrorUnknownMethod, Message: call.Member}
+	}
+
+	if call.Interface != iface && call.Interface != "" {
+		return nil, &dbus.Error{Name: dbus.ErrorUnknownMethod, Message: call.Interface + "." + call.Member}
+	}
+	var err error
+	switch {
+	case iface == dbusRootInterface && call.Member == "SetProfile":
+		name, ok := singleArg(call.Body).(string)
+		if !ok {
+			return nil, badArgs
+		}
+		if err := s.profiles.pin(name); err != nil {
+			return nil, &dbus.Error{Name: dbus.ErrorInvalidArgs, Message: err.Error()}
+		}
+	case iface == dbusRootInterface && call.Member == "SetManualDutyCycle":
+		if len(call.Body) != 2 {
+			return nil, badArgs
+		}
+		name, okName := call.Body[0].(string)
+		ratio, okRatio := call.Body[1].(float64)
+		if !okName || !okRatio {
+			return nil, badArgs
+		}
+		var t dbusTarget
+		if t, err = s.targetNamed(name); err == nil {
+			err = s.setManual(t, &ratio, call.Sender)
+		}
+	case iface == dbusRootInterface && call.Member == "ClearManualDutyCycle":
+		name, ok := singleArg(call.Body).(string)
+		if !ok {
+			return nil, badArgs
+		}
+		var t dbusTarget
+		if t, err = s.targetNamed(name); err == nil {
+			err = s.setManual(t, nil, call.Sender)
+		}
+	case iface == dbusHeatsinkIface && call.Member == "SetManualDutyCycle":
+		ratio, ok := singleArg(call.Body).(float64)
+		if !ok {
+			return nil, badArgs
+		}
+		t, _ := s.target(call.Path)
+		err = s.setManual(t, &ratio, call.Sender)
+	case iface == dbusHeatsinkIface && call.Member == "ClearManualDutyCycle":
+		if len(call.Body) != 0 {
+			return nil, badArgs
+		}
+		t, _ := s.target(call.Path)
+		err = s.setManual(t, nil, call.Sender)
+	default:
+		return nil, &dbus.Error{Name: dbus.ErrorUnknownMethod, Message: call.Member}
+	}
+	return nil, err
+}
+
+// singleArg returns the only value of the given body, or nil if there is not exactly one
+func singleArg(body []interface{}) interface{} {
+	if len(body) != 1 {
+		return nil
+	}
+	return body[0]
+}
+
+// setManual pins the given heatsink to the given duty cycle ratio or, if it is nil, returns it
+// to its fan response curve
+func (s *dbusService) setManual(t dbusTarget, ratio *float64, sender string) error {
+	if ratio == nil {
+		t.hs.ClearManualDutyCycle()
+	} else {
+		if *ratio < 0 || *ratio > 1 {
+			return &dbus.Error{Name: dbus.ErrorInvalidArgs, Message: "duty cycle must be in [0,1]"}
+		}
+		t.hs.SetManualDutyCycle(*ratio)
+	}
+	s.logger.Info(
+		"manual duty cycle changed over dbus",
+		zap.String("heatsink", t.hs.Name()), zap.Float64p("duty_cycle", ratio), zap.String("sender", sender),
+	)
+	return nil
+}
+
+// dbusInterfaceXML documents the methods of the service's interfaces for introspection
+var dbusInterfaceXML = map[string]string{
+	dbusRootInterface: `  <interface name="` + dbusRootInterface + `">
+    <method name="SetProfile"><arg name="name" type="s" direction="in"/></method>
+    <method name="SetManualDutyCycle"><arg name="heatsink" type="s" direction="in"/><arg name="ratio" type="d" direction="in"/></method>
+    <method name="ClearManualDutyCycle"><arg name="heatsink" type="s" direction="in"/></method>
+`,
+	dbusHeatsinkIface: `  <interface name="` + dbusHeatsinkIface + `">
+    <method name="SetManualDutyCycle"><arg name="ratio" type="d" direction="in"/></method>
+    <method name="ClearManualDutyCycle"/>
+`,
+}
+
+// dbusPropertySignatures are the types of the properties of the service's interfaces
+var dbusPropertySignatures = map[string]map[string]string{
+	dbusRootInterface: {
+		"ActiveProfile": "s",
+		"ProfilePinned": "b",
+		"Profiles":      "as",
+		"Heatsinks":     "ao",
+	},
+	dbusHeatsinkIface: {
+		"Name":            "s",
+		"Sensor":          "s",
+		"Temperature":     "d",
+		"DutyCycle":       "d",
+		"ManualDutyCycle": "d",
+		"MaxDutyCycle":    "d",
+		"Critical":        "b",
+		"Stopped":         "b",
+		"LastUpdate":      "x",
+	},
+}
+
+// dbusStandardXML documents the standard interfaces every object implements
+const dbusStandardXML = `  <interface name="` + dbusPropertiesIface + `">
+    <method name="Get"><arg type="s" direction="in"/><arg type="s" direction="in"/><arg type="v" direction="out"/></method>
+    <method name="GetAll"><arg type="s" direction="in"/><arg type="a{sv}" direction="out"/></method>
+    <method name="Set"><arg type="s" direction="in"/><arg type="s" direction="in"/><arg type="v" direction="in"/></method>
+    <signal name="PropertiesChanged"><arg type="s"/><arg type="a{sv}"/><arg type="as"/></signal>
+  </interface>
+  <interface name="` + dbusIntrospectIface + `">
+    <method name="Introspect"><arg type="s" direction="out"/></method>
+  </interface>
+  <interface name="org.freedesktop.DBus.Peer">
+    <method name="Ping"/>
+  </interface>
+`
+
+// introspect returns the introspection data of the object at the given path, which may also be
+// one of the nodes leading to the service's objects
+func (s *dbusService) introspect(path dbus.ObjectPath) (string, bool) {
+
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE node PUBLIC \"-//freedesktop//DTD D-BUS Object Introspection 1.0//EN\"\n" +
+		"\"http://www.freedesktop.org/standards/dbus/1.0/introspect.dtd\">\n<node>\n")
+
+	found := false
+	if iface, props, ok := s.properties(path); ok {
+		found = true
+		b.WriteString(dbusStandardXML)
+		b.WriteString(dbusInterfaceXML[iface])
+		names := make([]string, 0, len(props))
+		for name := range props {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			sig := dbusPropertySignatures[iface][name]
+			fmt.Fprintf(&b, "    <property name=%q type=%q access=\"read\"/>\n", name, sig)
+		}
+		b.WriteString("  </interface>\n")
+	}
+
+	prefix := string(path) + "/"
+	if path == "/" {
+		prefix = "/"
+	}
+	children := make(map[string]bool)
+	for _, p := range s.paths() {
+		if strings.HasPrefix(string(p), prefix) {
+			found = true
+			children[strings.SplitN(strings.TrimPrefix(string(p), prefix), "/", 2)[0]] = true
+		}
+	}
+	names := make([]string, 0, len(children))
+	for name := range children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, "  <node name=%q/>\n", name)
+	}
+	b.WriteString("</node>\n")
+	return b.String(), found
+}
+
+// paths returns the paths of the service's objects
+func (s *dbusService) paths() []dbus.ObjectPath {
+	paths := []dbus.ObjectPath{dbusRootPath}
+	for _, t := range s.targets {
+		paths = append(paths, t.path)
+	}
+	return paths
+}
+
+// announce emits PropertiesChanged for every property that changed since the given snapshot,
+// which it updates. If conn is nil, it only updates the snapshot
+func (s *dbusService) announce(conn dbusConn, last map[dbus.ObjectPath]map[string]dbus.Variant) {
+
+	for _, path := range s.paths() {
+		iface, props, _ := s.properties(path)
+		changed := make(map[string]dbus.Variant)
+		for name, value := range props {
+			if prev, ok := last[path][name]; !ok || !reflect.DeepEqual(prev, value) {
+				changed[name] = value
+			}
+		}
+		last[path] = props
+		if conn == nil || len(changed) == 0 {
+			continue
+		}
+		if err := conn.Emit(path, dbusPropertiesIface, "PropertiesChanged", iface, changed, []string{}); err != nil {
+			s.logger.Warn("emitting dbus signal", zap.Error(err), zap.String("path", string(path)))
+		}
+	}
+}
+
+// start connects to the bus, claims the service's name, and announces changed properties
+// periodically. The returned function disconnects from the bus
+func (s *dbusService) start() (stop func(), err error) {
+
+	conn, err := s.dial(s.address, s.handle)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.RequestName(s.name); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	s.logger.Info("serving dbus", zap.String("name", s.name), zap.String("address", s.address))
+
+	last := make(map[dbus.ObjectPath]map[string]dbus.Variant)
+	s.announce(nil, last)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				s.announce(conn, last)
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+		if err := conn.Close(); err != nil && !errors.Is(err, dbus.ErrClosed) {
+			s.logger.Warn("closing dbus connection", zap.Error(err))
+		}
+	}, nil
+}
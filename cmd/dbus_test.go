@@ -0,0 +1,316 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/malkhamis/heatsink/dbus"
+	"go.uber.org/zap"
+)
+
+// fakeDBusConn records the signals it is asked to emit
+type fakeDBusConn struct {
+	mutex     sync.Mutex
+	requested string
+	signals   []fakeDBusSignal
+	closed    bool
+}
+
+type fakeDBusSignal struct {
+	path dbus.ObjectPath
+	args []interface{}
+}
+
+func (c *fakeDBusConn) RequestName(name string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.requested = name
+	return nil
+}
+
+func (c *fakeDBusConn) Emit(path dbus.ObjectPath, _, _ string, args ...interface{}) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.signals = append(c.signals, fakeDBusSignal{path: path, args: args})
+	return nil
+}
+
+func (c *fakeDBusConn) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.closed = true
+	return nil
+}
+
+// testDBusService returns a service for a single heatsink named after the test that defines
+// the profile 'silent'
+func testDBusService(t *testing.T) (s *dbusService, cleanup func()) {
+	t.Helper()
+	control, cleanup := testControlServer(t, "")
+	cfg := &config{DBus: &configDBus{Bus: "session"}, logger: zap.NewNop()}
+	s, err := cfg.newDBusService(control.heatsinks, control.profiles)
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	return s, cleanup
+}
+
+func Test_config_newDBusService(t *testing.T) {
+
+	cfg := &config{logger: zap.NewNop()}
+	if s, err := cfg.newDBusService(nil, nil); s != nil || err != nil {
+		t.Fatalf("expected no service without config, got: %v, %v", s, err)
+	}
+
+	cfg.DBus = &configDBus{Bus: "unix:path=/tmp/bus", Name: "org.example.Fans", Interval: "5s"}
+	s, err := cfg.newDBusService(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.address != "unix:path=/tmp/bus" || s.name != "org.example.Fans" || s.interval != 5*time.Second {
+		t.Errorf("unexpected service: %+v", s)
+	}
+
+	cfg.DBus = &configDBus{}
+	if s, err = cfg.newDBusService(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if s.address != dbus.SystemBusAddress() || s.name != defaultDBusName || s.interval != defaultDBusInterval {
+		t.Errorf("unexpected defaults: %+v", s)
+	}
+
+	testCases := []struct {
+		name        string
+		config      configDBus
+		expectedErr error
+	}{
+		{"bad bus", configDBus{Bus: "desktop"}, errDBusBus},
+		{"bad interval", configDBus{Interval: "soon"}, errBadDuration},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			cfg.DBus = &tc.config
+			_, err := cfg.newDBusService(nil, nil)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func Test_dbusPathElement(t *testing.T) {
+
+	testCases := map[string]string{
+		"cpu":        "cpu",
+		"cpu-fan":    "cpu_2dfan",
+		"heatsink/1": "heatsink_2f1",
+		"1st":        "_31st",
+		"a_b":        "a_5fb",
+		"":           "_",
+	}
+	for name, expected := range testCases {
+		if actual := dbusPathElement(name); actual != expected {
+			t.Errorf("unexpected path element for %q\nwant: %q\n got: %q", name, expected, actual)
+		}
+	}
+}
+
+func Test_dbusService_handle(t *testing.T) {
+
+	s, cleanup := testDBusService(t)
+	defer cleanup()
+	hs, path := s.targets[0].hs, s.targets[0].path
+
+	call := func(path dbus.ObjectPath, iface, member string, body ...interface{}) ([]interface{}, error) {
+		return s.handle(&dbus.Call{Path: path, Interface: iface, Member: member, Body: body})
+	}
+
+	reply, err := call(dbusRootPath, dbusPropertiesIface, "GetAll", dbusRootInterface)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []interface{}{map[string]dbus.Variant{
+		"ActiveProfile": {Value: ""},
+		"ProfilePinned": {Value: false},
+		"Profiles":      {Value: []string{"silent"}},
+		"Heatsinks":     {Value: []dbus.ObjectPath{path}},
+	}}
+	if diff := deep.Equal(reply, expected); diff != nil {
+		t.Fatal(diff)
+	}
+
+	if _, err := call(dbusRootPath, dbusRootInterface, "SetProfile", "silent"); err != nil {
+		t.Fatal(err)
+	}
+	reply, err = call(dbusRootPath, dbusPropertiesIface, "Get", dbusRootInterface, "ActiveProfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(reply, []interface{}{dbus.Variant{Value: "silent"}}); diff != nil {
+		t.Fatal(diff)
+	}
+
+	if _, err := call(path, dbusHeatsinkIface, "SetManualDutyCycle", 0.4); err != nil {
+		t.Fatal(err)
+	}
+	if dc, ok := hs.ManualDutyCycle(); !ok || dc != 0.4 {
+		t.Fatalf("expected the manual duty cycle to be set\nwant: 0.4, true\n got: %v, %v", dc, ok)
+	}
+	reply, err = call(path, dbusPropertiesIface, "Get", dbusHeatsinkIface, "ManualDutyCycle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(reply, []interface{}{dbus.Variant{Value: 0.4}}); diff != nil {
+		t.Fatal(diff)
+	}
+	if _, err := call(dbusRootPath, dbusRootInterface, "ClearManualDutyCycle", hs.Name()); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := hs.ManualDutyCycle(); ok {
+		t.Fatal("expected the manual duty cycle to be cleared")
+	}
+	if _, err := call(dbusRootPath, dbusRootInterface, "SetManualDutyCycle", hs.Name(), 0.7); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := call(path, dbusHeatsinkIface, "ClearManualDutyCycle"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := hs.ManualDutyCycle(); ok {
+		t.Fatal("expected the manual duty cycle to be cleared")
+	}
+
+	errCases := []struct {
+		name     string
+		path     dbus.ObjectPath
+		iface    string
+		member   string
+		body     []interface{}
+		expected string
+	}{
+		{"unknown object", "/nowhere", dbusRootInterface, "SetProfile", []interface{}{"silent"}, dbus.ErrorUnknownObject},
+		{"unknown method", dbusRootPath, dbusRootInterface, "Explode", nil, dbus.ErrorUnknownMethod},
+		{"wrong interface", path, dbusRootInterface, "SetProfile", []interface{}{"silent"}, dbus.ErrorUnknownMethod},
+		{"unknown profile", dbusRootPath, dbusRootInterface, "SetProfile", []interface{}{"turbo"}, dbus.ErrorInvalidArgs},
+		{"unknown heatsink", dbusRootPath, dbusRootInterface, "ClearManualDutyCycle", []interface{}{"nope"}, dbus.ErrorInvalidArgs},
+		{"bad ratio", path, dbusHeatsinkIface, "SetManualDutyCycle", []interface{}{1.5}, dbus.ErrorInvalidArgs},
+		{"bad args", path, dbusHeatsinkIface, "SetManualDutyCycle", []interface{}{"fast"}, dbus.ErrorInvalidArgs},
+		{"unknown property", path, dbusPropertiesIface, "Get", []interface{}{dbusHeatsinkIface, "Color"}, dbus.ErrorInvalidArgs},
+		{"unknown interface", path, dbusPropertiesIface, "GetAll", []interface{}{"org.example"}, dbus.ErrorInvalidArgs},
+		{"read only", path, dbusPropertiesIface, "Set", []interface{}{dbusHeatsinkIface, "DutyCycle", dbus.Variant{Value: 1.0}}, dbusPropertyReadOnly},
+	}
+	for _, tc := range errCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := call(tc.path, tc.iface, tc.member, tc.body...)
+			var dbusErr *dbus.Error
+			if !errors.As(err, &dbusErr) || dbusErr.Name != tc.expected {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func Test_dbusService_introspect(t *testing.T) {
+
+	s, cleanup := testDBusService(t)
+	defer cleanup()
+
+	testCases := []struct {
+		path     dbus.ObjectPath
+		expected []string
+	}{
+		{"/", []string{`<node name="org"/>`}},
+		{"/org/malkhamis", []string{`<node name="Heatsink1"/>`}},
+		{dbusRootPath, []string{`<interface name="org.malkhamis.Heatsink1">`, `<property name="Heatsinks" type="ao"`, `<node name="heatsinks"/>`}},
+		{s.targets[0].path, []string{`<interface name="org.malkhamis.Heatsink1.Heatsink">`, `<property name="Temperature" type="d"`}},
+	}
+	for _, tc := range testCases {
+		reply, err := s.handle(&dbus.Call{Path: tc.path, Interface: dbusIntrospectIface, Member: "Introspect"})
+		if err != nil {
+			t.Fatalf("%s: %v", tc.path, err)
+		}
+		for _, expected := range tc.expected {
+			if xml := reply[0].(string); !strings.Contains(xml, expected) {
+				t.Errorf("%s: expected %q in:\n%s", tc.path, expected, xml)
+			}
+		}
+	}
+
+	if _, err := s.handle(&dbus.Call{Path: "/com", Interface: dbusIntrospectIface, Member: "Introspect"}); err == nil {
+		t.Error("expected an error introspecting an unknown path")
+	}
+}
+
+func Test_dbusService_start(t *testing.T) {
+
+	s, cleanup := testDBusService(t)
+	defer cleanup()
+	s.interval = 10 * time.Millisecond
+	conn := &fakeDBusConn{}
+	s.dial = func(address string, handler dbus.Handler) (dbusConn, error) {
+		return conn, nil
+	}
+
+	stop, err := s.start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.profiles.pin("silent"); err != nil {
+		t.Fatal(err)
+	}
+
+	var signal fakeDBusSignal
+	for deadline := time.After(time.Second); signal.path == ""; {
+		select {
+		case <-deadline:
+			t.Fatal("timeout waiting for a signal")
+		case <-time.After(5 * time.Millisecond):
+		}
+		conn.mutex.Lock()
+		for _, sig := range conn.signals {
+			if sig.path == dbusRootPath {
+				signal = sig
+			}
+		}
+		conn.mutex.Unlock()
+	}
+	stop()
+
+	expected := []interface{}{
+		dbusRootInterface,
+		map[string]dbus.Variant{"ActiveProfile": {Value: "silent"}, "ProfilePinned": {Value: true}},
+		[]string{},
+	}
+	if diff := deep.Equal(signal.args, expected); diff != nil {
+		t.Fatal(diff)
+	}
+	if conn.requested != defaultDBusName || !conn.closed {
+		t.Errorf("expected the name to be requested and the connection closed, got: %+v", conn)
+	}
+}
+
+func Test_heatsinkProperties(t *testing.T) {
+
+	hs, cleanup := testHeatsink(t, "40000")
+	defer cleanup()
+	go hs.StartThermalControl()
+	defer hs.StopThermalControl()
+
+	for deadline := time.After(time.Second); hs.LastSample().Time.IsZero(); {
+		select {
+		case <-deadline:
+			t.Fatal("timeout waiting for a control iteration")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	props := heatsinkProperties(hs)
+	if props["Temperature"].Value != 40.0 || props["ManualDutyCycle"].Value != -1.0 || props["LastUpdate"].Value == int64(0) {
+		t.Fatalf("unexpected properties: %v", props)
+	}
+}
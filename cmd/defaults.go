@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+var errBadDefaults = errors.New("invalid heatsink defaults")
+
+// applyDefaults merges the 'defaults' of the given raw config into each of its heatsinks. The
+// defaults are a partial heatsink whose fields are inherited by every heatsink that does not
+// set them, where objects like 'fan' are merged field by field while any other value that a
+// heatsink sets, including lists, overrides the default as a whole
+func applyDefaults(raw map[string]interface{}) error {
+
+	defaults, ok := raw["defaults"]
+	if !ok {
+		return nil
+	}
+	defaultsMap, ok := defaults.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%w: 'defaults' must be an object", errBadDefaults)
+	}
+	if _, ok := defaultsMap["name"]; ok {
+		return fmt.Errorf("%w: heatsink names cannot have a default", errBadDefaults)
+	}
+
+	heatsinks, _ := raw["heatsinks"].([]interface{})
+	for _, hs := range heatsinks {
+		if hsMap, ok := hs.(map[string]interface{}); ok {
+			mergeDefaults(hsMap, defaultsMap)
+		}
+	}
+	return nil
+}
+
+// mergeDefaults sets each field of the given defaults that the given object does not set, and
+// merges the fields that both set to an object recursively
+func mergeDefaults(obj, defaults map[string]interface{}) {
+	for key, def := range defaults {
+		val, ok := obj[key]
+		if !ok {
+			obj[key] = copyRaw(def)
+			continue
+		}
+		valMap, isMap := val.(map[string]interface{})
+		defMap, isDefMap := def.(map[string]interface{})
+		if isMap && isDefMap {
+			mergeDefaults(valMap, defMap)
+		}
+	}
+}
+
+// copyRaw returns a deep copy of the given decoded json value, so that heatsinks do not share
+// the objects and lists they inherit
+func copyRaw(val interface{}) interface{} {
+	switch v := val.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, elem := range v {
+			copied[key] = copyRaw(elem)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, elem := range v {
+			copied[i] = copyRaw(elem)
+		}
+		return copied
+	default:
+		return v
+	}
+}
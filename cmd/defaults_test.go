@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func Test_newConfig_defaults(t *testing.T) {
+	t.Parallel()
+
+	jsonData := `{
+		"defaults": {
+			"temp_check_period": "2s",
+			"sensor_path_globs": ["/sys/core*"],
+			"fan": {"response_type": "linear", "pwm_period": "100ms", "min_speed_value": "30", "max_speed_value": "200"}
+		},
+		"heatsinks": [
+			{"name": "cpu", "fan": {"name": "cpu-fan"}},
+			{
+				"name": "gpu",
+				"temp_check_period": "5s",
+				"sensor_path_globs": ["/sys/gpu"],
+				"fan": {"response_type": "pow", "exponent": 2, "max_speed_value": "255"}
+			}
+		]
+	}`
+	cfg, err := newConfig(strings.NewReader(jsonData), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cpu, gpu := cfg.Heatsinks[0], cfg.Heatsinks[1]
+	expected := []string{"2s", "linear", "100ms", "30", "200", "cpu-fan"}
+	actual := []string{string(cpu.TempChkPeriod), cpu.Fan.RespType, string(cpu.Fan.PwmPeriod), string(cpu.Fan.MinSpeedVal), string(cpu.Fan.MaxSpeedVal), cpu.Fan.Name}
+	if diff := deep.Equal(expected, actual); diff != nil {
+		t.Errorf("unexpected inherited fields\n%v", diff)
+	}
+	expected = []string{"5s", "pow", "100ms", "30", "255"}
+	actual = []string{string(gpu.TempChkPeriod), gpu.Fan.RespType, string(gpu.Fan.PwmPeriod), string(gpu.Fan.MinSpeedVal), string(gpu.Fan.MaxSpeedVal)}
+	if diff := deep.Equal(expected, actual); diff != nil {
+		t.Errorf("unexpected overridden fields\n%v", diff)
+	}
+	if diff := deep.Equal(configSensors{"/sys/gpu"}, gpu.SensorPathGlobs); diff != nil {
+		t.Errorf("expected lists to be overridden as a whole\n%v", diff)
+	}
+
+}
+
+func Test_newConfig_defaults_errors(t *testing.T) {
+	t.Parallel()
+
+	for _, jsonData := range []string{
+		`{"defaults": ["2s"], "heatsinks": [{}]}`,
+		`{"defaults": {"name": "cpu"}, "heatsinks": [{}]}`,
+	} {
+		_, err := newConfig(strings.NewReader(jsonData), nil)
+		if !errors.Is(err, errBadDefaults) {
+			t.Errorf("%s: unexpected error\nwant: %v\n got: %v", jsonData, errBadDefaults, err)
+		}
+	}
+}
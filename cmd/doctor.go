@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"go.uber.org/zap"
+)
+
+var errDoctorFormat = errors.New("unknown doctor format")
+
+// doctorFinding is the outcome of checking the daemon's access to a single device file
+type doctorFinding struct {
+	Heatsink string   `json:"heatsink,omitempty"`
+	Path     string   `json:"path"`
+	Access   string   `json:"access"`
+	OK       bool     `json:"ok"`
+	Problem  string   `json:"problem,omitempty"`
+	Owner    string   `json:"owner,omitempty"`
+	Group    string   `json:"group,omitempty"`
+	Mode     string   `json:"mode,omitempty"`
+	Remedies []string `json:"remedies,omitempty"`
+}
+
+// deviceFile is a path glob of a device file along with the access the daemon needs to it
+type deviceFile struct {
+	heatsink string
+	pattern  string
+	access   string
+}
+
+// deviceFiles returns the path globs of the local device files of this config. Devices that
+// are not files, e.g. remote fans or lm-sensors features, are left out
+func (c *config) deviceFiles() []deviceFile {
+
+	var files []deviceFile
+	add := func(heatsink, pattern, access string) {
+		if pattern != "" && !isDeviceAddress(pattern) {
+			files = append(files, deviceFile{heatsink: heatsink, pattern: pattern, access: access})
+		}
+	}
+	for _, s := range c.Sensors {
+		add("", s.PathGlob, accessRead)
+	}
+	for _, hs := range c.Heatsinks {
+		if hs.Fan.Remote == nil {
+			add(hs.Name, hs.Fan.PathGlob, accessWrite)
+			if (hs.Fan.EnablePolicy != "" || hs.Fan.ExitMode != "") && hs.Fan.PathGlob != "" {
+				add(hs.Name, hs.Fan.PathGlob+"_enable", accessWrite)
+			}
+			if hs.Fan.PwmFrequency != 0 && hs.Fan.PathGlob != "" {
+				add(hs.Name, hs.Fan.PathGlob+"_freq", accessWrite)
+			}
+			if hs.Fan.PwmMode != "" && hs.Fan.PathGlob != "" {
+				add(hs.Name, hs.Fan.PathGlob+"_mode", accessWrite)
+			}
+		}
+		add(hs.Name, hs.Fan.RpmPathGlob, accessRead)
+		for _, pattern := range hs.SensorPathGlobs {
+			add(hs.Name, pattern, accessRead)
+		}
+		for _, in := range hs.Inputs {
+			for _, pattern := range in.SensorPathGlobs {
+				add(hs.Name, pattern, accessRead)
+			}
+		}
+	}
+	return files
+}
+
+// diagnose checks the daemon's access to every local device file of this config
+func (c *config) diagnose() []doctorFinding {
+
+	var findings []doctorFinding
+	for _, f := range c.deviceFiles() {
+		matches, err := filepath.Glob(f.pattern)
+		if err == nil && len(matches) == 0 {
+			err = errGlobNoMatches
+		}
+		if err != nil {
+			findings = append(findings, doctorFinding{
+				Heatsink: f.heatsink, Path: f.pattern, Access: f.access, Problem: err.Error(),
+			})
+			continue
+		}
+		for _, path := range matches {
+			finding := doctorFinding{Heatsink: f.heatsink, Path: path, Access: f.access, OK: true}
+			if err := checkAccess(path, f.access); err != nil {
+				finding.OK, finding.Problem = false, err.Error()
+				var permErr *permissionError
+				if errors.As(err, &permErr) {
+					finding.Problem = permErr.Err.Error()
+					finding.Owner, finding.Group, finding.Remedies = permErr.Owner, permErr.Group, permErr.Remedies
+					if permErr.Owner != "" {
+						finding.Mode = permErr.Mode.String()
+					}
+				}
+			}
+			findings = append(findings, finding)
+		}
+	}
+	return findings
+}
+
+// writeDoctorText writes the given findings to w as a human-readable table, followed by the
+// remedies of each problem
+func writeDoctorText(w io.Writer, findings []doctorFinding) error {
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, f := range findings {
+		status := "ok"
+		if !f.OK {
+			status = "FAIL"
+		}
+		heatsink := f.Heatsink
+		if heatsink == "" {
+			heatsink = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", status, heatsink, f.Access, f.Path, f.Problem)
+		if f.Owner != "" {
+			fmt.Fprintf(tw, "\t\t\towned by %s:%s with mode %s\t\n", f.Owner, f.Group, f.Mode)
+		}
+		for _, remedy := range f.Remedies {
+			fmt.Fprintf(tw, "\t\t\t- %s\t\n", remedy)
+		}
+	}
+	return tw.Flush()
+}
+
+// runDoctor implements the 'doctor' subcommand, which checks whether the daemon may access
+// every device file of the given config and prints how to fix the problems it finds. It exits
+// with 1 if any check failed
+func runDoctor(args []string, stdout io.Writer) (exitCode int) {
+
+	logger := newLogger(logSettings{})
+	defer logger.Sync()
+
+	const usage = "doctor [-format text|json] <config>"
+	flags := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	format := flags.String("format", "text", "output format: 'text' or 'json'")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		logger.Error("invalid arguments", zap.String("usage", usage))
+		return 64
+	}
+	if *format != "text" && *format != "json" {
+		err := fmt.Errorf("%w: '%s'", errDoctorFormat, *format)
+		logger.Error("invalid arguments", zap.Error(err), zap.String("usage", usage))
+		return 64
+	}
+	filename := flags.Arg(0)
+
+	file, err := os.Open(filename)
+	if err != nil {
+		logger.Error("opening the given file", zap.Error(err))
+		return 66
+	}
+	defer file.Close()
+
+	cfg, err := newConfig(file, logger)
+	if err != nil {
+		logger.Error("creating heatsink config", zap.Error(err), zap.String("filename", filename))
+		return 78
+	}
+
+	findings := cfg.diagnose()
+	if *format == "json" {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(findings)
+	} else {
+		err = writeDoctorText(stdout, findings)
+	}
+	if err != nil {
+		logger.Error("writing findings", zap.Error(err))
+		return 74
+	}
+	for _, f := range findings {
+		if !f.OK {
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func Test_runDoctor(t *testing.T) {
+
+	fanFile, cleanup := temporaryFile(t)
+	defer cleanup()
+	sensorFile, cleanup := temporaryFile(t)
+	defer cleanup()
+	configFile, cleanup := temporaryFile(t)
+	defer cleanup()
+	_, err := configFile.WriteString(fmt.Sprintf(`{
+	  "heatsinks": [{
+	    "name": "cpu",
+	    "min_temp": 30,
+	    "max_temp": 60,
+	    "sensor_path_globs": [%q, "smc:TC0P"],
+	    "fan": {"path_glob": %q, "rpm_path_glob": %q}
+	  }]
+	}`, sensorFile.Name(), fanFile.Name(), fanFile.Name()+".rpm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	origNewLogger := newLogger
+	defer func() { newLogger = origNewLogger }()
+	newLogger = func(logSettings) *zap.Logger { return zap.NewNop() }
+
+	restoreProcArgs := backupProcArgs(t)
+	defer restoreProcArgs()
+	os.Args = []string{"program-name", "doctor", "-format", "bogus", configFile.Name()}
+	if expected, actual := 64, execute(); expected != actual {
+		t.Fatalf("actual exit code doesn't match expected\nwant: %d\n got: %d", expected, actual)
+	}
+
+	var buf bytes.Buffer
+	if expected, actual := 1, runDoctor([]string{"-format", "json", configFile.Name()}, &buf); expected != actual {
+		t.Fatalf("actual exit code doesn't match expected\nwant: %d\n got: %d", expected, actual)
+	}
+	var findings []doctorFinding
+	if err := json.Unmarshal(buf.Bytes(), &findings); err != nil {
+		t.Fatal(err)
+	}
+	expected := []doctorFinding{
+		{Heatsink: "cpu", Path: fanFile.Name(), Access: accessWrite, OK: true},
+		{Heatsink: "cpu", Path: fanFile.Name() + ".rpm", Access: accessRead, Problem: errGlobNoMatches.Error()},
+		{Heatsink: "cpu", Path: sensorFile.Name(), Access: accessRead, OK: true},
+	}
+	if len(findings) != len(expected) {
+		t.Fatalf("unexpected findings: %+v", findings)
+	}
+	for i := range expected {
+		if findings[i].Heatsink != expected[i].Heatsink || findings[i].Path != expected[i].Path ||
+			findings[i].Access != expected[i].Access || findings[i].OK != expected[i].OK ||
+			!strings.Contains(findings[i].Problem, expected[i].Problem) {
+			t.Errorf("unexpected finding %d\nwant: %+v\n got: %+v", i, expected[i], findings[i])
+		}
+	}
+
+	buf.Reset()
+	if expected, actual := 1, runDoctor([]string{configFile.Name()}, &buf); expected != actual {
+		t.Fatalf("actual exit code doesn't match expected\nwant: %d\n got: %d", expected, actual)
+	}
+	if !strings.Contains(buf.String(), "FAIL") || !strings.Contains(buf.String(), "ok") {
+		t.Errorf("unexpected text output:\n%s", buf.String())
+	}
+}
+
+func Test_writeDoctorText(t *testing.T) {
+
+	var buf bytes.Buffer
+	err := writeDoctorText(&buf, []doctorFinding{{
+		Heatsink: "cpu",
+		Path:     "/sys/class/hwmon/hwmon2/pwm1",
+		Access:   accessWrite,
+		Problem:  "permission denied",
+		Owner:    "root",
+		Group:    "root",
+		Mode:     "-rw-r--r--",
+		Remedies: []string{"run it as root"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"FAIL", "cpu", "permission denied", "owned by root:root with mode -rw-r--r--", "- run it as root"} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("expected text output to contain %q, got:\n%s", expected, buf.String())
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/malkhamis/heatsink"
+	"go.uber.org/zap"
+)
+
+// compile-time check for interface implementation
+var _ heatsink.FanDriver = (*dryRunFan)(nil)
+
+// dryRunFan is a fan driver that does not touch the hardware. Instead, it logs every change
+// to the duty cycle that would have been written to the fan
+type dryRunFan struct {
+	name     string
+	filename string
+	logger   *zap.Logger
+	mutex    sync.Mutex
+	prevDC   float64
+	closed   bool
+}
+
+func newDryRunFan(name, filename string, logger *zap.Logger) *dryRunFan {
+	if name == "" {
+		name = filename
+	}
+	return &dryRunFan{name: name, filename: filename, logger: logger, prevDC: -1}
+}
+
+func (f *dryRunFan) SetDutyCycle(dcRatio float64) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.closed {
+		return heatsink.ErrFanDriverClosed
+	}
+	if dcRatio != f.prevDC {
+		f.logger.Info(
+			"dry run: would have set the fan's duty cycle",
+			zap.String("event", "dry_run_duty_cycle"),
+			zap.String("name", f.name),
+			zap.String("filename", f.filename),
+			zap.Float64("duty_cycle", dcRatio),
+		)
+		f.prevDC = dcRatio
+	}
+	return nil
+}
+
+func (f *dryRunFan) Name() string {
+	return f.name
+}
+
+func (f *dryRunFan) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.closed {
+		return heatsink.ErrFanDriverClosed
+	}
+	f.closed = true
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/malkhamis/heatsink"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func Test_dryRunFan(t *testing.T) {
+
+	core, logs := observer.New(zapcore.InfoLevel)
+	fan := newDryRunFan("", "/sys/class/hwmon/hwmon0/pwm1", zap.New(core))
+	if expected, actual := "/sys/class/hwmon/hwmon0/pwm1", fan.Name(); actual != expected {
+		t.Fatalf("expected the name to default to the filename\nwant: %s\n got: %s", expected, actual)
+	}
+
+	for _, dc := range []float64{0.3, 0.3, 0.5} {
+		if err := fan.SetDutyCycle(dc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var actual []float64
+	for _, entry := range logs.FilterField(zap.String("event", "dry_run_duty_cycle")).AllUntimed() {
+		actual = append(actual, entry.ContextMap()["duty_cycle"].(float64))
+	}
+	if diff := deep.Equal(actual, []float64{0.3, 0.5}); diff != nil {
+		t.Fatalf("expected only changes to be logged: %v", diff)
+	}
+
+	if err := fan.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := fan.SetDutyCycle(0.1); !errors.Is(err, heatsink.ErrFanDriverClosed) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", heatsink.ErrFanDriverClosed, err)
+	}
+	if err := fan.Close(); !errors.Is(err, heatsink.ErrFanDriverClosed) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", heatsink.ErrFanDriverClosed, err)
+	}
+}
+
+func Test_config_newHeatsinks_dryRun(t *testing.T) {
+
+	sensorFile, cleanup := temporaryFile(t)
+	defer cleanup()
+	if _, err := sensorFile.WriteString("40000"); err != nil {
+		t.Fatal(err)
+	}
+	fanFile, cleanup := temporaryFile(t)
+	defer cleanup()
+	if _, err := fanFile.WriteString("77"); err != nil {
+		t.Fatal(err)
+	}
+
+	jsonData := strings.NewReader(fmt.Sprintf(`
+    {
+      "heatsinks": [
+        {
+          "max_temp": 50,
+          "temp_check_period": "1ms",
+          "fan": {"path_glob": %q},
+          "sensor_path_globs": [%q]
+        }
+      ]
+    }
+  `, fanFile.Name(), sensorFile.Name(),
+	))
+
+	cfg, err := newConfig(jsonData, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.dryRun = true
+
+	heatsinks, err := cfg.newHeatsinks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs := heatsinks[0]
+	go hs.StartThermalControl()
+	for deadline := time.After(time.Second); hs.LastSample().Time.IsZero(); {
+		select {
+		case <-deadline:
+			t.Fatal("timeout waiting for a control iteration")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	if err := hs.StopThermalControl(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(fanFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "77" {
+		t.Fatalf("expected the fan file to be untouched in a dry run, got: %q", content)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// configDuration is a duration field of the config, which is either a duration string like
+// "1.5s" or "100ms", or a plain number in a unit that each field documents, e.g. seconds for
+// 'temp_check_period' and milliseconds for 'pwm_period'
+type configDuration string
+
+// UnmarshalJSON accepts a json string or number. Any other value is kept verbatim, so that
+// parsing it fails with an error that names the field rather than failing to decode the config
+func (d *configDuration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*d = configDuration(s)
+		return nil
+	}
+	*d = configDuration(bytes.TrimSpace(data))
+	return nil
+}
+
+// duration returns the duration of the given field, where a plain number is in the given unit.
+// It returns zero if the field is empty, in which case callers fall back to their default
+func (d configDuration) duration(field string, unit time.Duration) (time.Duration, error) {
+	if d == "" {
+		return 0, nil
+	}
+	if num, err := strconv.ParseFloat(string(d), 64); err == nil {
+		return time.Duration(num * float64(unit)), nil
+	}
+	parsed, err := time.ParseDuration(string(d))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s: %v", errBadDuration, field, err)
+	}
+	return parsed, nil
+}
+
+// jsonSchema returns the schema of a duration field
+func (configDuration) jsonSchema() map[string]interface{} {
+	return map[string]interface{}{"type": []string{"string", "number"}}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_configDuration(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		jsonData    string
+		unit        time.Duration
+		expected    time.Duration
+		expectedErr error
+	}{
+		{jsonData: `"1.5s"`, unit: time.Second, expected: 1500 * time.Millisecond},
+		{jsonData: `"100ms"`, unit: time.Second, expected: 100 * time.Millisecond},
+		{jsonData: `2`, unit: time.Second, expected: 2 * time.Second},
+		{jsonData: `0.5`, unit: time.Second, expected: 500 * time.Millisecond},
+		{jsonData: `100`, unit: time.Millisecond, expected: 100 * time.Millisecond},
+		{jsonData: `"250"`, unit: time.Millisecond, expected: 250 * time.Millisecond},
+		{jsonData: `""`, unit: time.Second, expected: 0},
+		{jsonData: `"3 s"`, unit: time.Second, expectedErr: errBadDuration},
+		{jsonData: `{"seconds": 3}`, unit: time.Second, expectedErr: errBadDuration},
+	}
+
+	for _, tc := range testCases {
+		var d configDuration
+		if err := json.Unmarshal([]byte(tc.jsonData), &d); err != nil {
+			t.Errorf("%s: unexpected error decoding: %v", tc.jsonData, err)
+			continue
+		}
+		actual, err := d.duration("some_period", tc.unit)
+		if !errors.Is(err, tc.expectedErr) {
+			t.Errorf("%s: unexpected error\nwant: %v\n got: %v", tc.jsonData, tc.expectedErr, err)
+		}
+		if err != nil && !strings.Contains(err.Error(), "some_period") {
+			t.Errorf("%s: expected the error to name the field, got: %v", tc.jsonData, err)
+		}
+		if actual != tc.expected {
+			t.Errorf("%s: unexpected duration\nwant: %v\n got: %v", tc.jsonData, tc.expected, actual)
+		}
+	}
+}
+
+func Test_config_newHeatsinks_durationWrongType(t *testing.T) {
+	t.Parallel()
+
+	sensorFile, cleanup := temporaryFile(t)
+	defer cleanup()
+	jsonData := fmt.Sprintf(`{"heatsinks": [{"sensor_path_globs": [%q], "fan": {"pwm_period": true}}]}`, sensorFile.Name())
+	cfg, err := newConfig(strings.NewReader(jsonData), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cfg.newHeatsinks()
+	if !errors.Is(err, errBadDuration) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", errBadDuration, err)
+	}
+	if !strings.Contains(err.Error(), "pwm_period") {
+		t.Errorf("expected the error to name the field, got: %v", err)
+	}
+}
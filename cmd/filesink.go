@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/malkhamis/heatsink"
+	"go.uber.org/zap"
+)
+
+var (
+	errTelemetryFormat = errors.New("telemetry file format must be either 'csv' or 'jsonl'")
+	errTelemetryPath   = errors.New("telemetry file must have a path")
+)
+
+// defaultTelemetryMaxSize is the size in bytes at which telemetry files are rotated by default
+const defaultTelemetryMaxSize = 10 << 20
+
+// csvTelemetryHeader is the first line of every csv telemetry file
+var csvTelemetryHeader = []string{"time", "heatsink", "sensor", "temperature", "duty_cycle", "readings"}
+
+// configTelemetryFile appends every sample to a csv or json-lines file. Once the file exceeds
+// the maximum size, it is rotated by renaming it with a numeric suffix, e.g. 'samples.csv.1',
+// and the oldest backups beyond the maximum number of backups are deleted
+type configTelemetryFile struct {
+	Path         string `json:"path"`
+	Format       string `json:"format,omitempty"`
+	MaxSizeBytes int64  `json:"max_size_bytes,omitempty"`
+	MaxBackups   int    `json:"max_backups,omitempty"`
+}
+
+func (c configTelemetryFile) newSink(logger *zap.Logger) (*fileSink, error) {
+
+	if c.Path == "" {
+		return nil, errTelemetryPath
+	}
+	format := c.Format
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "jsonl" {
+		return nil, fmt.Errorf("%w, got: '%s'", errTelemetryFormat, c.Format)
+	}
+	maxSize := c.MaxSizeBytes
+	if maxSize <= 0 {
+		maxSize = defaultTelemetryMaxSize
+	}
+
+	return &fileSink{
+		path:       c.Path,
+		format:     format,
+		maxSize:    maxSize,
+		maxBackups: c.MaxBackups,
+		logger:     logger,
+	}, nil
+}
+
+// fileSink appends samples to a file with size-based rotation. The file is opened on the first
+// sample, so merely creating a sink has no side effects
+type fileSink struct {
+	path       string
+	format     string
+	maxSize    int64
+	maxBackups int
+	logger     *zap.Logger
+	file       *os.File
+	size       int64
+	mutex      sync.Mutex
+}
+
+func (s *fileSink) write(hsName string, smpl heatsink.Sample) {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	line, err := s.encode(hsName, smpl)
+	if err == nil {
+		err = s.append(line)
+	}
+	if err != nil {
+		s.logger.Warn("failed to write telemetry sample", zap.Error(err), zap.String("filename", s.path))
+	}
+}
+
+// encode formats the given sample as a single line of the sink's format
+func (s *fileSink) encode(hsName string, smpl heatsink.Sample) ([]byte, error) {
+
+	if s.format == "jsonl" {
+		type reading struct {
+			Sensor      string  `json:"sensor"`
+			Temperature float64 `json:"temperature"`
+		}
+		record := struct {
+			Time        time.Time `json:"time"`
+			Heatsink    string    `json:"heatsink"`
+			Sensor      string    `json:"sensor"`
+			Temperature float64   `json:"temperature"`
+			DutyCycle   float64   `json:"duty_cycle"`
+			Readings    []reading `json:"readings"`
+		}{smpl.Time, hsName, smpl.Sensor, smpl.Temperature, smpl.DutyCycle, []reading{}}
+		for _, r := range smpl.Readings {
+			record.Readings = append(record.Readings, reading{r.Sensor, r.Temperature})
+		}
+		line, err := json.Marshal(record)
+		return append(line, '\n'), err
+	}
+
+	return csvLine([]string{
+		smpl.Time.Format(time.RFC3339Nano),
+		hsName,
+		smpl.Sensor,
+		strconv.FormatFloat(smpl.Temperature, 'f', -1, 64),
+		strconv.FormatFloat(smpl.DutyCycle, 'f', -1, 64),
+		formatReadings(smpl.Readings),
+	})
+}
+
+// formatReadings formats the given readings as a single csv field, e.g. "core0=40.5;core1=42"
+func formatReadings(readings []heatsink.Reading) string {
+	parts := make([]string, len(readings))
+	for i, r := range readings {
+		parts[i] = r.Sensor + "=" + strconv.FormatFloat(r.Temperature, 'f', -1, 64)
+	}
+	return strings.Join(parts, ";")
+}
+
+func csvLine(record []string) ([]byte, error) {
+	var sb strings.Builder
+	w := csv.NewWriter(&sb)
+	w.Write(record)
+	w.Flush()
+	return []byte(sb.String()), w.Error()
+}
+
+// append writes the given line to the file, opening or rotating it first if needed
+func (s *fileSink) append(line []byte) error {
+
+	if s.file != nil && s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return fmt.Errorf("rotating telemetry file: %w", err)
+		}
+	}
+	if s.file == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+// open opens the file for appending and writes the csv header if the file is empty
+func (s *fileSink) open() error {
+
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	s.file, s.size = file, info.Size()
+
+	if s.size == 0 && s.format == "csv" {
+		header, err := csvLine(csvTelemetryHeader)
+		if err != nil {
+			return err
+		}
+		n, err := s.file.Write(header)
+		s.size += int64(n)
+		return err
+	}
+	return nil
+}
+
+// rotate closes the file and shifts it and its backups by one suffix, deleting the oldest
+// backups. The file is reopened on the next write
+func (s *fileSink) rotate() error {
+
+	err := s.file.Close()
+	s.file, s.size = nil, 0
+	if err != nil {
+		return err
+	}
+
+	if s.maxBackups <= 0 {
+		return os.Remove(s.path)
+	}
+	os.Remove(s.backupPath(s.maxBackups))
+	for i := s.maxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(s.backupPath(i), s.backupPath(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(s.path, s.backupPath(1))
+}
+
+func (s *fileSink) backupPath(i int) string {
+	return s.path + "." + strconv.Itoa(i)
+}
+
+func (s *fileSink) close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
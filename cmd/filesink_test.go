@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/malkhamis/heatsink"
+	"go.uber.org/zap"
+)
+
+func Test_configTelemetryFile_newSink_errors(t *testing.T) {
+
+	cases := map[string]struct {
+		cfg         configTelemetryFile
+		expectedErr error
+	}{
+		"path":   {cfg: configTelemetryFile{}, expectedErr: errTelemetryPath},
+		"format": {cfg: configTelemetryFile{Path: "x", Format: "xml"}, expectedErr: errTelemetryFormat},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			_, err := c.cfg.newSink(zap.NewNop())
+			if !errors.Is(err, c.expectedErr) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", c.expectedErr, err)
+			}
+		})
+	}
+}
+
+func Test_fileSink_csv(t *testing.T) {
+
+	tmpDir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	path := filepath.Join(tmpDir, "samples.csv")
+
+	sink, err := configTelemetryFile{Path: path}.newSink(zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected the file not to be created before the first sample, got: %v", err)
+	}
+
+	at := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	sink.write("hs1", heatsink.Sample{
+		Time:        at,
+		Sensor:      "core1",
+		Temperature: 42.5,
+		DutyCycle:   0.25,
+		Readings:    []heatsink.Reading{{Sensor: "core0", Temperature: 40}, {Sensor: "core1", Temperature: 42.5}},
+	})
+	if err := sink.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// reopening appends without repeating the header
+	sink.write("hs2", heatsink.Sample{Time: at, DutyCycle: 1})
+	if err := sink.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "time,heatsink,sensor,temperature,duty_cycle,readings\n" +
+		"2021-03-04T05:06:07Z,hs1,core1,42.5,0.25,core0=40;core1=42.5\n" +
+		"2021-03-04T05:06:07Z,hs2,,0,1,\n"
+	if actual := string(content); actual != expected {
+		t.Fatalf("unexpected file content\nwant: %q\n got: %q", expected, actual)
+	}
+}
+
+func Test_fileSink_jsonl(t *testing.T) {
+
+	tmpDir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	path := filepath.Join(tmpDir, "samples.jsonl")
+
+	sink, err := configTelemetryFile{Path: path, Format: "jsonl"}.newSink(zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.close()
+
+	sink.write("hs1", heatsink.Sample{
+		Sensor:      "core0",
+		Temperature: 40,
+		DutyCycle:   0.5,
+		Readings:    []heatsink.Reading{{Sensor: "core0", Temperature: 40}},
+	})
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(content, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	delete(decoded, "time")
+	expected := map[string]interface{}{
+		"heatsink":    "hs1",
+		"sensor":      "core0",
+		"temperature": 40.0,
+		"duty_cycle":  0.5,
+		"readings":    []interface{}{map[string]interface{}{"sensor": "core0", "temperature": 40.0}},
+	}
+	if diff := deep.Equal(decoded, expected); diff != nil {
+		t.Fatal(diff)
+	}
+}
+
+func Test_fileSink_rotation(t *testing.T) {
+
+	tmpDir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	path := filepath.Join(tmpDir, "samples.jsonl")
+
+	sink, err := configTelemetryFile{
+		Path: path, Format: "jsonl", MaxSizeBytes: 1, MaxBackups: 2,
+	}.newSink(zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.close()
+
+	// every sample exceeds the maximum size, so each one ends up in its own file
+	for i := range make([]struct{}, 4) {
+		sink.write(fmt.Sprintf("hs%d", i), heatsink.Sample{})
+	}
+
+	for filename, expected := range map[string]string{
+		path:        `"heatsink":"hs3"`,
+		path + ".1": `"heatsink":"hs2"`,
+		path + ".2": `"heatsink":"hs1"`,
+	} {
+		content, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(content), expected) || strings.Count(string(content), "\n") != 1 {
+			t.Errorf("expected %s to contain only %s, got: %s", filename, expected, content)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected the oldest backup to be deleted, got: %v", err)
+	}
+}
+
+func Test_config_newHeatsinks_telemetry(t *testing.T) {
+
+	tmpDir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	path := filepath.Join(tmpDir, "samples.csv")
+
+	sensorFile, cleanup := temporaryFile(t)
+	defer cleanup()
+	if _, err := sensorFile.WriteString("40000"); err != nil {
+		t.Fatal(err)
+	}
+	fanFile, cleanup := temporaryFile(t)
+	defer cleanup()
+
+	jsonData := strings.NewReader(fmt.Sprintf(`
+    {
+      "telemetry": {"file": {"path": %q}},
+      "heatsinks": [
+        {
+          "max_temp": 50,
+          "temp_check_period": "1ms",
+          "fan": {"name": "fan", "path_glob": %q},
+          "sensor_path_globs": [%q]
+        }
+      ]
+    }
+  `, path, fanFile.Name(), sensorFile.Name(),
+	))
+	cfg, err := newConfig(jsonData, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	heatsinks, err := cfg.newHeatsinks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs := heatsinks[0]
+
+	go hs.StartThermalControl()
+	for deadline := time.After(time.Second); hs.LastSample().Time.IsZero(); {
+		select {
+		case <-deadline:
+			t.Fatal("timeout waiting for a control iteration")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	hs.StopThermalControl()
+	closeSinks(cfg.sinks, zap.NewNop())
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), ",heatsink/fan,") {
+		t.Fatalf("expected the samples to be written with the heatsink's name, got:\n%s", content)
+	}
+}
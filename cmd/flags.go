@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"runtime"
+)
+
+// version is the release version of the daemon, which is meant to be set at build time
+// using: -ldflags "-X main.version=<version>"
+var version = "dev"
+
+// usage summarizes the accepted command line arguments
+const usage = "heatsink [-config <config>] [-log-level <level>] [-log-format json|console] " +
+	"[-log-output <path>] [-validate] [-self-test] [-dry-run] [-metrics-listen <addr>] [-control-socket <path>] " +
+	"[-fault-injection] [-strict-config] [<config>] | version | topology | migrate | schema | install | stats | benchmark | " +
+	"agent | doctor | udev | status | set | profile | reload"
+
+var (
+	errNoConfigPath  = errors.New("no filepath given for json config")
+	errConfigPathDup = errors.New("config filepath given both as a flag and as an argument")
+	errTooManyArgs   = errors.New("too many arguments")
+)
+
+// cliOptions holds the parsed command line flags of the daemon
+type cliOptions struct {
+	configPath     string
+	log            logSettings
+	validate       bool
+	selfTest       bool
+	metricsAddr    string
+	controlSocket  *string // nil unless given, since an empty path disables the socket
+	faultInjection bool
+	dryRun         bool
+	strictConfig   bool
+}
+
+// parseFlags parses the daemon's command line arguments, excluding the program name. The
+// config file may be given either using the 'config' flag or as the only positional argument.
+// Log settings given as flags take precedence over those in the config file
+func parseFlags(args []string) (cliOptions, error) {
+
+	var opts cliOptions
+	flags := flag.NewFlagSet("heatsink", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	flags.StringVar(&opts.configPath, "config", "", "json config file")
+	flags.StringVar(&opts.log.Level, "log-level", "", "log level: debug, info, warn, or error (default: info)")
+	flags.StringVar(&opts.log.Format, "log-format", "", "log encoding: json or console (default: json)")
+	flags.StringVar(&opts.log.Output, "log-output", "", "log output: stdout, stderr, or a file path (default: stdout)")
+	flags.BoolVar(&opts.validate, "validate", false, "validate the config and exit")
+	flags.BoolVar(&opts.selfTest, "self-test", false, "read every sensor and test writing to every fan before starting, and exit if any fails")
+	flags.StringVar(&opts.metricsAddr, "metrics-listen", "", "address to serve prometheus metrics, health checks, and profile switching on")
+	controlSocket := flags.String("control-socket", "", "unix socket to accept commands on, or empty to disable it (default: "+defaultControlSocket+")")
+	flags.BoolVar(&opts.dryRun, "dry-run", false, "read sensors but only log the duty cycles instead of setting fans")
+	flags.BoolVar(&opts.faultInjection, "fault-injection", false, "enable fault injection configured for chaos testing")
+	flags.BoolVar(&opts.strictConfig, "strict-config", false, "reject config files with unknown fields, as if they set 'strict'")
+
+	if err := flags.Parse(args); err != nil {
+		return cliOptions{}, err
+	}
+	if err := opts.log.validate(); err != nil {
+		return cliOptions{}, err
+	}
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "control-socket" {
+			opts.controlSocket = controlSocket
+		}
+	})
+
+	switch {
+	case flags.NArg() > 1:
+		return cliOptions{}, errTooManyArgs
+	case flags.NArg() == 1 && opts.configPath != "":
+		return cliOptions{}, errConfigPathDup
+	case flags.NArg() == 1:
+		opts.configPath = flags.Arg(0)
+	case opts.configPath == "":
+		return cliOptions{}, errNoConfigPath
+	}
+
+	return opts, nil
+}
+
+// runVersion implements the 'version' subcommand
+func runVersion(stdout io.Writer) (exitCode int) {
+	_, err := fmt.Fprintf(stdout, "heatsink %s (%s %s/%s)\n", version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		return 74
+	}
+	return 0
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func Test_parseFlags(t *testing.T) {
+
+	controlSocketPath := "/tmp/heatsink.sock"
+	testCases := []struct {
+		name     string
+		args     []string
+		expected cliOptions
+	}{
+		{
+			name:     "positional",
+			args:     []string{"config.json"},
+			expected: cliOptions{configPath: "config.json"},
+		},
+		{
+			name:     "flag",
+			args:     []string{"--config", "config.json"},
+			expected: cliOptions{configPath: "config.json"},
+		},
+		{
+			name: "all",
+			args: []string{
+				"-log-level", "debug", "-log-format", "console", "-log-output", "stderr",
+				"-validate", "-self-test", "-metrics-listen", ":9100", "-fault-injection", "-dry-run",
+				"-strict-config", "-control-socket", "/tmp/heatsink.sock", "config.json",
+			},
+			expected: cliOptions{
+				configPath:     "config.json",
+				log:            logSettings{Level: "debug", Format: "console", Output: "stderr"},
+				validate:       true,
+				selfTest:       true,
+				metricsAddr:    ":9100",
+				controlSocket:  &controlSocketPath,
+				faultInjection: true,
+				dryRun:         true,
+				strictConfig:   true,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := parseFlags(tc.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := deep.Equal(actual, tc.expected); diff != nil {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func Test_parseFlags_errors(t *testing.T) {
+
+	testCases := []struct {
+		name     string
+		args     []string
+		expected error
+	}{
+		{"none", nil, errNoConfigPath},
+		{"duplicate", []string{"-config", "a.json", "b.json"}, errConfigPathDup},
+		{"too many", []string{"a.json", "b.json"}, errTooManyArgs},
+		{"log level", []string{"-log-level", "loud", "a.json"}, errBadLogLevel},
+		{"log format", []string{"-log-format", "xml", "a.json"}, errBadLogFormat},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := parseFlags(tc.args)
+			if !errors.Is(err, tc.expected) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", tc.expected, err)
+			}
+		})
+	}
+
+	if _, err := parseFlags([]string{"-unknown", "a.json"}); err == nil {
+		t.Fatal("expected an error given an unknown flag")
+	}
+}
+
+func Test_parseFlags_controlSocketDisabled(t *testing.T) {
+
+	opts, err := parseFlags([]string{"-control-socket", "", "a.json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.controlSocket == nil || *opts.controlSocket != "" {
+		t.Fatalf("expected an empty control socket path to be kept, got: %v", opts.controlSocket)
+	}
+}
+
+func Test_runVersion(t *testing.T) {
+
+	var stdout bytes.Buffer
+	if actual := runVersion(&stdout); actual != 0 {
+		t.Fatalf("actual exit code doesn't match expected\nwant: %d\n got: %d", 0, actual)
+	}
+	if !strings.HasPrefix(stdout.String(), "heatsink "+version) {
+		t.Errorf("expected the version in the output, got: %q", stdout.String())
+	}
+	if !strings.Contains(stdout.String(), runtime.Version()) {
+		t.Errorf("expected the go version in the output, got: %q", stdout.String())
+	}
+}
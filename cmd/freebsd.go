@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/malkhamis/heatsink"
+	"github.com/malkhamis/heatsink/freebsd"
+	"go.uber.org/zap"
+)
+
+// sysctlPrefix marks sensor path globs that address a FreeBSD temperature sysctl instead of a
+// file, e.g. 'sysctl:hw.acpi.thermal.tz0.temperature'
+const sysctlPrefix = "sysctl:"
+
+// pwmDevDir is where FreeBSD creates the device nodes of pwm(9) channels. Fans whose path glob
+// resolves to a file under it are driven through pwm(8) rather than written to like sysfs
+const pwmDevDir = "/dev/pwm/"
+
+// sysctlAddress returns the sysctl that the given path glob addresses, if any
+func sysctlAddress(pattern string) (string, bool) {
+	if !strings.HasPrefix(pattern, sysctlPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(pattern, sysctlPrefix), true
+}
+
+func newSysctlSensor(sysctl, name string, logger *zap.Logger) (heatsink.ThermoSensor, error) {
+	sensor, err := freebsd.NewSensor(sysctl, freebsd.OptName(name))
+	if err != nil {
+		return nil, fmt.Errorf("'%s%s': %w", sysctlPrefix, sysctl, err)
+	}
+	logger.Info("created sysctl sensor", zap.String("name", sensor.Name()), zap.String("sysctl", sysctl))
+	return sensor, nil
+}
+
+func (c configFan) newFreeBSDFan(device string, logger *zap.Logger) (heatsink.FanDriver, error) {
+	fan, err := freebsd.NewFan(device, freebsd.OptName(c.Name))
+	if err != nil {
+		return nil, fmt.Errorf("'%s': %w", device, err)
+	}
+	logger.Info(
+		"created pwm(9) fan",
+		zap.String("name", fan.Name()),
+		zap.String("device", device),
+		zap.String("response_type", c.RespType),
+	)
+	return fan, nil
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+
+	"github.com/malkhamis/heatsink/freebsd"
+	"go.uber.org/zap"
+)
+
+func Test_namedSensors_newSensor_sysctl(t *testing.T) {
+	if runtime.GOOS == "freebsd" {
+		t.Skip("sysctl is supported on freebsd")
+	}
+	named, err := newNamedSensors([]configNamedSensor{{Name: "acpi", PathGlob: "sysctl:hw.acpi.thermal.tz0.temperature"}}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := named.newSensor("acpi", zap.NewNop()); !errors.Is(err, freebsd.ErrUnsupported) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", freebsd.ErrUnsupported, err)
+	}
+}
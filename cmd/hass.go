@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+
+	"go.uber.org/zap"
+)
+
+const defaultHassDiscoveryPrefix = "homeassistant"
+
+// hassDevice groups the entities of a heatsink under a single device in Home Assistant
+type hassDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model"`
+}
+
+// hassEntity is the discovery payload of a Home Assistant entity. Only the fields that are
+// relevant to the entity's platform are set
+type hassEntity struct {
+	Name              string     `json:"name"`
+	UniqueID          string     `json:"unique_id"`
+	Device            hassDevice `json:"device"`
+	AvailabilityTopic string     `json:"availability_topic"`
+	StateTopic        string     `json:"state_topic"`
+	ValueTemplate     string     `json:"value_template,omitempty"`
+	DeviceClass       string     `json:"device_class,omitempty"`
+	StateClass        string     `json:"state_class,omitempty"`
+	UnitOfMeasurement string     `json:"unit_of_measurement,omitempty"`
+
+	// fields of the fan platform
+	StateValueTemplate        string `json:"state_value_template,omitempty"`
+	CommandTopic              string `json:"command_topic,omitempty"`
+	CommandTemplate           string `json:"command_template,omitempty"`
+	PercentageStateTopic      string `json:"percentage_state_topic,omitempty"`
+	PercentageValueTemplate   string `json:"percentage_value_template,omitempty"`
+	PercentageCommandTopic    string `json:"percentage_command_topic,omitempty"`
+	PercentageCommandTemplate string `json:"percentage_command_template,omitempty"`
+}
+
+// hassDiscovery returns the discovery payloads of the given heatsink keyed by their config
+// topics. The heatsink appears as a temperature sensor and a duty cycle sensor and, if
+// commands are enabled, as a fan whose speed sets the manual duty cycle. Turning the fan off
+// returns control to the fan response curve
+func (b *mqttBridge) hassDiscovery(t mqttTarget) map[string]hassEntity {
+
+	id := b.prefix + "_" + t.level
+	device := hassDevice{
+		Identifiers:  []string{id},
+		Name:         t.hs.Name(),
+		Manufacturer: "heatsink",
+		Model:        "fan controller",
+	}
+	base := func(name, suffix string) hassEntity {
+		return hassEntity{
+			Name:              t.hs.Name() + " " + name,
+			UniqueID:          id + "_" + suffix,
+			Device:            device,
+			AvailabilityTopic: b.statusTopic(),
+			StateTopic:        b.stateTopic(t),
+		}
+	}
+	configTopic := func(platform, suffix string) string {
+		return b.discoveryPrefix + "/" + platform + "/" + id + "/" + suffix + "/config"
+	}
+
+	temperature := base("temperature", "temperature")
+	temperature.ValueTemplate = "{{ value_json.temperature }}"
+	temperature.DeviceClass = "temperature"
+	temperature.StateClass = "measurement"
+	temperature.UnitOfMeasurement = "°C"
+
+	dutyCycle := base("duty cycle", "duty_cycle")
+	dutyCycle.ValueTemplate = "{{ (value_json.duty_cycle * 100) | round(1) }}"
+	dutyCycle.StateClass = "measurement"
+	dutyCycle.UnitOfMeasurement = "%"
+
+	entities := map[string]hassEntity{
+		configTopic("sensor", "temperature"): temperature,
+		configTopic("sensor", "duty_cycle"):  dutyCycle,
+	}
+	if !b.commands {
+		return entities
+	}
+
+	fan := base("fan", "fan")
+	fan.StateValueTemplate = "{{ 'OFF' if value_json.manual_duty_cycle is none else 'ON' }}"
+	fan.CommandTopic = b.commandTopic(t)
+	fan.CommandTemplate = "{{ '1' if value == 'ON' else 'auto' }}"
+	fan.PercentageStateTopic = b.stateTopic(t)
+	fan.PercentageValueTemplate = "{{ ((value_json.manual_duty_cycle or 0) * 100) | round(0) }}"
+	fan.PercentageCommandTopic = b.commandTopic(t)
+	fan.PercentageCommandTemplate = "{{ value / 100 }}"
+	entities[configTopic("fan", "fan")] = fan
+	return entities
+}
+
+// publishDiscovery publishes the retained discovery payloads of all heatsinks
+func (b *mqttBridge) publishDiscovery() {
+	for _, t := range b.targets {
+		for topic, entity := range b.hassDiscovery(t) {
+			payload, err := json.Marshal(entity)
+			if err != nil {
+				b.logger.Warn("encoding home assistant discovery payload", zap.Error(err))
+				continue
+			}
+			if err := b.client.Publish(topic, payload, true); err != nil {
+				b.logger.Warn("publishing home assistant discovery payload", zap.Error(err), zap.String("topic", topic))
+			}
+		}
+	}
+}
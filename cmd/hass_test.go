@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"testing"
+
+	"github.com/go-test/deep"
+	"go.uber.org/zap"
+)
+
+func Test_mqttBridge_hassDiscovery(t *testing.T) {
+
+	hs, cleanup := testHeatsink(t, "40000")
+	defer cleanup()
+	bridge := &mqttBridge{
+		prefix:          "home",
+		discoveryPrefix: "ha",
+		logger:          zap.NewNop(),
+		targets:         []mqttTarget{{hs: hs, level: "hs"}},
+	}
+
+	topics := func() []string {
+		var topics []string
+		for topic := range bridge.hassDiscovery(bridge.targets[0]) {
+			topics = append(topics, topic)
+		}
+		sort.Strings(topics)
+		return topics
+	}
+	expected := []string{
+		"ha/sensor/home_hs/duty_cycle/config",
+		"ha/sensor/home_hs/temperature/config",
+	}
+	if diff := deep.Equal(topics(), expected); diff != nil {
+		t.Fatal(diff)
+	}
+
+	bridge.commands = true
+	expected = append([]string{"ha/fan/home_hs/fan/config"}, expected...)
+	if diff := deep.Equal(topics(), expected); diff != nil {
+		t.Fatal(diff)
+	}
+
+	fan := bridge.hassDiscovery(bridge.targets[0])["ha/fan/home_hs/fan/config"]
+	actual := []string{fan.UniqueID, fan.AvailabilityTopic, fan.StateTopic, fan.CommandTopic, fan.PercentageCommandTopic}
+	expected = []string{"home_hs_fan", "home/status", "home/hs/state", "home/hs/manual_duty_cycle/set", "home/hs/manual_duty_cycle/set"}
+	if diff := deep.Equal(actual, expected); diff != nil {
+		t.Fatal(diff)
+	}
+}
+
+func Test_mqttBridge_onConnectionChange_discovery(t *testing.T) {
+
+	hs, cleanup := testHeatsink(t, "40000")
+	defer cleanup()
+	client := newFakeMQTTClient()
+	bridge := &mqttBridge{
+		client:  client,
+		prefix:  "home",
+		logger:  zap.NewNop(),
+		targets: []mqttTarget{{hs: hs, level: "hs"}},
+	}
+
+	bridge.onConnectionChange(nil)
+	if len(client.published) != 1 || client.lastPublished("home/status") != "online" {
+		t.Fatalf("expected only the status to be published without discovery, got: %v", client.published)
+	}
+
+	bridge.discoveryPrefix = "homeassistant"
+	bridge.onConnectionChange(nil)
+	var entity hassEntity
+	payload := client.lastPublished("homeassistant/sensor/home_hs/temperature/config")
+	if err := json.Unmarshal([]byte(payload), &entity); err != nil {
+		t.Fatal(err)
+	}
+	if entity.DeviceClass != "temperature" || entity.Device.Name != hs.Name() {
+		t.Fatalf("unexpected discovery payload: %s", payload)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/malkhamis/heatsink"
+	"go.uber.org/zap"
+)
+
+// Health states of a heatsink's control loop
+const (
+	healthOK       = "ok"
+	healthStarting = "starting"
+	healthStale    = "stale"
+	healthFailed   = "failed"
+)
+
+// heatsinkHealth is the health of a single heatsink as reported by the health endpoints
+type heatsinkHealth struct {
+	Name          string     `json:"name"`
+	Status        string     `json:"status"`
+	LastIteration *time.Time `json:"last_iteration,omitempty"`
+}
+
+// checkHealth returns the health of the given heatsink. A heatsink is stale if its control loop
+// did not complete an iteration within twice its check period and it is starting if it did
+// not complete any iteration yet
+func checkHealth(hs *heatsink.Heatsink, now time.Time) heatsinkHealth {
+
+	health := heatsinkHealth{Name: hs.Name(), Status: healthOK}
+	last := hs.LastSample().Time
+	if !last.IsZero() {
+		health.LastIteration = &last
+	}
+	switch {
+	case hs.Stopped():
+		health.Status = healthFailed
+	case last.IsZero():
+		health.Status = healthStarting
+	case now.Sub(last) > 2*hs.CheckPeriod():
+		health.Status = healthStale
+	}
+	return health
+}
+
+// healthHandler reports the health of every heatsink as json. The response status is 200 if
+// every heatsink's status is acceptable to the given function, and 503 otherwise
+func healthHandler(heatsinks []*heatsink.Heatsink, acceptable func(status string) bool, logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		report := struct {
+			Healthy   bool             `json:"healthy"`
+			Heatsinks []heatsinkHealth `json:"heatsinks"`
+		}{Healthy: true, Heatsinks: []heatsinkHealth{}}
+		now := time.Now()
+		for _, hs := range heatsinks {
+			health := checkHealth(hs, now)
+			report.Healthy = report.Healthy && acceptable(health.Status)
+			report.Heatsinks = append(report.Heatsinks, health)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if !report.Healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			logger.Warn("failed to write health report", zap.Error(err))
+		}
+	})
+}
+
+// livenessHandler fails if any control loop failed or stalled. Heatsinks that are still
+// starting are considered alive so that probes do not restart the daemon during startup
+func livenessHandler(heatsinks []*heatsink.Heatsink, logger *zap.Logger) http.Handler {
+	return healthHandler(heatsinks, func(status string) bool {
+		return status == healthOK || status == healthStarting
+	}, logger)
+}
+
+// readinessHandler fails until every control loop completed an iteration recently
+func readinessHandler(heatsinks []*heatsink.Heatsink, logger *zap.Logger) http.Handler {
+	return healthHandler(heatsinks, func(status string) bool {
+		return status == healthOK
+	}, logger)
+}
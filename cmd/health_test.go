@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/malkhamis/heatsink"
+	"go.uber.org/zap"
+)
+
+func Test_checkHealth(t *testing.T) {
+
+	hs, cleanup := testHeatsink(t, "40000")
+	defer cleanup()
+
+	if actual := checkHealth(hs, time.Now()).Status; actual != healthStarting {
+		t.Fatalf("unexpected status before the first iteration\nwant: %s\n got: %s", healthStarting, actual)
+	}
+
+	go hs.StartThermalControl()
+	for deadline := time.After(time.Second); hs.LastSample().Time.IsZero(); {
+		select {
+		case <-deadline:
+			t.Fatal("timeout waiting for a control iteration")
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	health := checkHealth(hs, time.Now())
+	if health.Status != healthOK || health.LastIteration == nil || health.Name != hs.Name() {
+		t.Fatalf("unexpected health of a running heatsink: %+v", health)
+	}
+	if actual := checkHealth(hs, time.Now().Add(time.Second)).Status; actual != healthStale {
+		t.Fatalf("unexpected status given a stale sample\nwant: %s\n got: %s", healthStale, actual)
+	}
+
+	hs.StopThermalControl()
+	if actual := checkHealth(hs, time.Now()).Status; actual != healthFailed {
+		t.Fatalf("unexpected status of a stopped heatsink\nwant: %s\n got: %s", healthFailed, actual)
+	}
+}
+
+func Test_livenessHandler_readinessHandler(t *testing.T) {
+
+	hs, cleanup := testHeatsink(t, "40000")
+	defer cleanup()
+	heatsinks := []*heatsink.Heatsink{hs}
+
+	probe := func(handler http.Handler) (int, []string) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+		var report struct {
+			Heatsinks []heatsinkHealth `json:"heatsinks"`
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &report); err != nil {
+			t.Fatal(err)
+		}
+		var statuses []string
+		for _, health := range report.Heatsinks {
+			statuses = append(statuses, health.Status)
+		}
+		return recorder.Code, statuses
+	}
+
+	cases := []struct {
+		handler          http.Handler
+		expectedCode     int
+		expectedStatuses []string
+	}{
+		{livenessHandler(heatsinks, zap.NewNop()), http.StatusOK, []string{healthStarting}},
+		{readinessHandler(heatsinks, zap.NewNop()), http.StatusServiceUnavailable, []string{healthStarting}},
+	}
+	for _, c := range cases {
+		code, statuses := probe(c.handler)
+		if diff := deep.Equal([]interface{}{code, statuses}, []interface{}{c.expectedCode, c.expectedStatuses}); diff != nil {
+			t.Fatal(diff)
+		}
+	}
+
+	hs.StopThermalControl()
+	if code, _ := probe(livenessHandler(heatsinks, zap.NewNop())); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected liveness to fail once a heatsink failed, got: %d", code)
+	}
+}
@@ -79,3 +79,11 @@ func temporaryFile(t *testing.T) (file *os.File, cleanup func()) {
 
 	return tmpFile, cleanup
 }
+
+func removeFile(t *testing.T, filename string) {
+	t.Helper()
+	err := os.Remove(filename)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		t.Logf("%s: error removing temporary test file: %s", filename, err)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/malkhamis/heatsink"
+	"github.com/malkhamis/heatsink/thermosense"
+
+	"go.uber.org/zap"
+)
+
+// sensorRescanner periodically re-evaluates the sensor path globs of a running heatsink and
+// adds the sensors that appeared since to it, and removes those that disappeared, e.g. USB
+// temperature probes or drives that spun up. Polling is used rather than inotify, since sysfs
+// does not report hwmon attributes that come and go
+type sensorRescanner struct {
+	hs         *heatsink.Heatsink
+	globs      []string
+	period     time.Duration
+	minSensors int
+	// known are the filenames of the monitored sensors that the globs matched
+	known map[string]bool
+	// pinned is the sensor that disappeared but was kept as the heatsink's only one, so that
+	// this is only logged once
+	pinned string
+	logger *zap.Logger
+}
+
+// newSensorRescanners returns a rescanner for every heatsink that sets a sensor rescan period,
+// where the given heatsinks were created from the config in the same order
+func (c *config) newSensorRescanners(heatsinks []*heatsink.Heatsink) ([]*sensorRescanner, error) {
+
+	var rescanners []*sensorRescanner
+	for i, hsCfg := range c.Heatsinks {
+		period, err := hsCfg.SensorRescan.duration("sensor_rescan_period", time.Second)
+		if err != nil {
+			return nil, err
+		}
+		if period <= 0 || i >= len(heatsinks) {
+			continue
+		}
+		r := &sensorRescanner{
+			hs:         heatsinks[i],
+			period:     period,
+			minSensors: hsCfg.MinSensors,
+			known:      make(map[string]bool),
+			logger:     c.logger,
+		}
+		for _, pattern := range hsCfg.SensorPathGlobs {
+			if !isDeviceAddress(pattern) {
+				r.globs = append(r.globs, pattern)
+			}
+		}
+		matches := r.matches()
+		for _, name := range r.hs.SensorNames() {
+			if matches[name] {
+				r.known[name] = true
+			}
+		}
+		rescanners = append(rescanners, r)
+	}
+	return rescanners, nil
+}
+
+// startSensorRescanners rescans the sensors of every heatsink in its own period until the
+// returned function is called
+func startSensorRescanners(rescanners []*sensorRescanner) (stop func()) {
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, r := range rescanners {
+		wg.Add(1)
+		go func(r *sensorRescanner) {
+			defer wg.Done()
+			ticker := time.NewTicker(r.period)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					r.rescan()
+				}
+			}
+		}(r)
+	}
+
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// matches returns the cleaned filenames that the globs currently match
+func (r *sensorRescanner) matches() map[string]bool {
+	matches := make(map[string]bool)
+	for _, pattern := range r.globs {
+		filenames, _ := filepath.Glob(pattern) // the globs were validated when the sensors were created
+		for _, filename := range filenames {
+			matches[filepath.Clean(filename)] = true
+		}
+	}
+	return matches
+}
+
+// rescan adds the sensors that the globs newly match to the heatsink and removes those that
+// they no longer match, unless it is the heatsink's only sensor
+func (r *sensorRescanner) rescan() {
+
+	matches := r.matches()
+	for _, filename := range sortedSet(matches) {
+		if !r.known[filename] {
+			r.add(filename)
+		}
+	}
+	removed := false
+	for _, filename := range sortedSet(r.known) {
+		if !matches[filename] {
+			removed = r.remove(filename) || removed
+		}
+	}
+
+	if count := len(r.hs.SensorNames()); removed && count < r.minSensors {
+		r.logger.Warn(
+			"heatsink has fewer sensors than required after sensors disappeared",
+			zap.String("event", "sensor_count_low"),
+			zap.String("heatsink", r.hs.Name()),
+			zap.Int("sensor_count", count),
+			zap.Int("min_sensors", r.minSensors),
+		)
+	}
+}
+
+// add creates the sensor of the given filename and adds it to the heatsink
+func (r *sensorRescanner) add(filename string) {
+
+	sensor, err := thermosense.New(filename)
+	if err != nil {
+		// it is retried by the next rescan, e.g. once udev fixed the permissions
+		r.logger.Warn(
+			"failed to open sensor that appeared",
+			zap.Error(diagnosePermission(err, accessRead)),
+			zap.String("heatsink", r.hs.Name()),
+			zap.String("filename", filename),
+		)
+		return
+	}
+	if err := r.hs.AddSensor(sensor); err != nil {
+		_ = sensor.Close()
+		if errors.Is(err, heatsink.ErrSensorExists) {
+			r.known[filename] = true
+		}
+		return
+	}
+	r.known[filename] = true
+	r.logger.Info(
+		"added sensor that appeared",
+		zap.String("event", "sensor_added"),
+		zap.String("heatsink", r.hs.Name()),
+		zap.String("filename", filename),
+	)
+}
+
+// remove removes the sensor of the given filename from the heatsink and returns true if it did
+func (r *sensorRescanner) remove(filename string) bool {
+
+	err := r.hs.RemoveSensor(filename)
+	switch {
+	case errors.Is(err, heatsink.ErrNoSensors):
+		if r.pinned != filename {
+			r.pinned = filename
+			r.logger.Warn(
+				"keeping the only sensor of the heatsink although it disappeared",
+				zap.String("heatsink", r.hs.Name()),
+				zap.String("filename", filename),
+			)
+		}
+		return false
+	case err != nil && !errors.Is(err, heatsink.ErrUnknownSensor):
+		r.logger.Warn(
+			"error closing sensor that disappeared",
+			zap.Error(err),
+			zap.String("heatsink", r.hs.Name()),
+			zap.String("filename", filename),
+		)
+	}
+	delete(r.known, filename)
+	r.pinned = ""
+	r.logger.Info(
+		"removed sensor that disappeared",
+		zap.String("event", "sensor_removed"),
+		zap.String("heatsink", r.hs.Name()),
+		zap.String("filename", filename),
+	)
+	return true
+}
+
+func sortedSet(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
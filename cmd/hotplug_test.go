@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func Test_sensorRescanner_rescan(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fanFile, cleanup := temporaryFile(t)
+	defer cleanup()
+
+	sensorFile := func(name string) string {
+		return filepath.Join(dir, name)
+	}
+	plug := func(name string) {
+		if err := ioutil.WriteFile(sensorFile(name), []byte("40000"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	unplug := func(name string) {
+		if err := os.Remove(sensorFile(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	plug("temp1_input")
+
+	jsonData := fmt.Sprintf(`{"heatsinks": [{
+		"name": "cpu", "max_temp": 80, "sensor_rescan_period": 1,
+		"fan": {"path_glob": %q}, "sensor_path_globs": [%q]
+	}]}`, fanFile.Name(), filepath.Join(dir, "temp*_input"))
+	cfg, err := newConfig(strings.NewReader(jsonData), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	heatsinks, err := cfg.newHeatsinks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs := heatsinks[0]
+	defer hs.StopThermalControl()
+	rescanners, err := cfg.newSensorRescanners(heatsinks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rescanners) != 1 {
+		t.Fatalf("expected a single rescanner, got: %d", len(rescanners))
+	}
+	r := rescanners[0]
+
+	steps := []struct {
+		name     string
+		change   func()
+		expected []string
+	}{
+		{"unchanged", func() {}, []string{sensorFile("temp1_input")}},
+		{"plugged", func() { plug("temp2_input") }, []string{sensorFile("temp1_input"), sensorFile("temp2_input")}},
+		{"unplugged", func() { unplug("temp1_input") }, []string{sensorFile("temp2_input")}},
+		{"only-sensor-kept", func() { unplug("temp2_input") }, []string{sensorFile("temp2_input")}},
+		{"replugged", func() { plug("temp1_input") }, []string{sensorFile("temp1_input")}},
+	}
+	for _, step := range steps {
+		step.change()
+		r.rescan()
+		if diff := deep.Equal(hs.SensorNames(), step.expected); diff != nil {
+			t.Errorf("%s: unexpected sensors\n%s", step.name, strings.Join(diff, "\n"))
+		}
+	}
+}
+
+func Test_config_newSensorRescanners_badPeriod(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config{Heatsinks: []*configHeatsink{{SensorRescan: "often"}}}
+	_, err := cfg.newSensorRescanners(nil)
+	if !errors.Is(err, errBadDuration) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", errBadDuration, err)
+	}
+}
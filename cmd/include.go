@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"go.uber.org/zap"
+)
+
+var (
+	errBadInclude      = errors.New("invalid config include")
+	errIncludeConflict = errors.New("conflicting config files")
+)
+
+// appendedSections are the top-level config fields whose entries are appended across included
+// config files. Every other field may only be set by a single file
+var appendedSections = []string{
+	"heatsinks", "zones", "sensors", "virtual_sensors", "remote_sensors", "plugins",
+}
+
+// configFilename returns the name of the file the given config is read from, if any. The
+// include globs of the config are resolved against its directory, or against the working
+// directory if it is not read from a file
+func configFilename(jsonData io.Reader) string {
+	if file, ok := jsonData.(*os.File); ok {
+		return file.Name()
+	}
+	return ""
+}
+
+// includeConfigs merges the config files matched by the 'include' globs of the given raw config,
+// which was read from the given file and upgraded from the given version, into it. The files
+// are merged in the order of the globs and, for each glob, in lexical order of the matching
+// filenames, where each file is merged once and upgraded to the current config version on its
+// own, assuming the version of the config unless it has its own. The entries of the appended
+// sections, e.g. heatsinks, are appended to those of the config, while any other field that
+// more than one file sets is a conflict, as is a heatsink name that is defined in more than one
+// file. Included files may not include other files
+func includeConfigs(raw map[string]interface{}, filename string, version int, logger *zap.Logger) error {
+
+	includes, err := includeGlobs(raw["include"])
+	if err != nil {
+		return err
+	}
+	delete(raw, "include")
+
+	setBy := make(map[string]string)
+	for key := range raw {
+		setBy[key] = "the main config"
+	}
+	hsFiles := make(map[string]string)
+	_ = recordHeatsinks(raw, "the main config", hsFiles)
+
+	dir, merged := ".", make(map[string]bool)
+	if filename != "" {
+		dir = filepath.Dir(filename)
+		merged[absPath(filename)] = true
+	}
+	for _, glob := range includes {
+		if !filepath.IsAbs(glob) {
+			glob = filepath.Join(dir, glob)
+		}
+		matches, err := filepath.Glob(glob)
+		if err != nil {
+			return fmt.Errorf("%w: %v", errBadInclude, err)
+		}
+		sort.Strings(matches)
+		for _, match := range matches {
+			if merged[absPath(match)] {
+				continue
+			}
+			merged[absPath(match)] = true
+			if err := includeConfig(raw, match, version, setBy, hsFiles, logger); err != nil {
+				return fmt.Errorf("%s: %w", match, err)
+			}
+		}
+	}
+	return nil
+}
+
+// absPath returns the absolute form of the given path, or the path itself if that fails
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// includeConfig merges the given config file into the given raw config
+func includeConfig(
+	raw map[string]interface{}, filename string, version int, setBy, hsFiles map[string]string, logger *zap.Logger,
+) error {
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	dec := json.NewDecoder(file)
+	dec.UseNumber()
+	var included map[string]interface{}
+	if err := dec.Decode(&included); err != nil {
+		return fmt.Errorf("error decoding json config: %w", err)
+	}
+	if included == nil {
+		included = make(map[string]interface{})
+	}
+	if _, ok := included["version"]; !ok {
+		included["version"] = json.Number(fmt.Sprint(version))
+	}
+	fromVersion, err := migrateConfig(included)
+	if err != nil {
+		return fmt.Errorf("error decoding json config: %w", err)
+	}
+	if fromVersion != currentConfigVersion {
+		logger.Warn(
+			"included config schema is outdated and was upgraded in memory, consider running 'migrate'",
+			zap.String("filename", filename),
+			zap.Int("from_version", fromVersion),
+			zap.Int("to_version", currentConfigVersion),
+		)
+	}
+	if _, ok := included["include"]; ok {
+		return fmt.Errorf("%w: included files cannot include other files", errBadInclude)
+	}
+	// the version was taken care of, and the schema is only meant for editors
+	delete(included, "version")
+	delete(included, "$schema")
+	if err := recordHeatsinks(included, filename, hsFiles); err != nil {
+		return err
+	}
+
+	for _, section := range appendedSections {
+		entries, ok := included[section]
+		if !ok {
+			continue
+		}
+		delete(included, section)
+		list, ok := entries.([]interface{})
+		if !ok {
+			return fmt.Errorf("%w: '%s' must be a list", errBadInclude, section)
+		}
+		existing, _ := raw[section].([]interface{})
+		raw[section] = append(existing, list...)
+	}
+	for key, val := range included {
+		if other, ok := setBy[key]; ok {
+			return fmt.Errorf("%w: '%s' is also set by %s", errIncludeConflict, key, other)
+		}
+		setBy[key] = filename
+		raw[key] = val
+	}
+	return nil
+}
+
+// recordHeatsinks records the names of the heatsinks of the given raw config as defined by the
+// given file, and returns an error if another file already defined one of them
+func recordHeatsinks(raw map[string]interface{}, filename string, hsFiles map[string]string) error {
+	heatsinks, _ := raw["heatsinks"].([]interface{})
+	for _, hs := range heatsinks {
+		hsMap, _ := hs.(map[string]interface{})
+		name, _ := hsMap["name"].(string)
+		if name == "" {
+			continue
+		}
+		if other, ok := hsFiles[name]; ok && other != filename {
+			return fmt.Errorf("%w: heatsink '%s' is also defined by %s", errIncludeConflict, name, other)
+		}
+		hsFiles[name] = filename
+	}
+	return nil
+}
+
+// includeGlobs returns the globs of the given raw 'include' field, which is a list of strings
+func includeGlobs(include interface{}) ([]string, error) {
+	if include == nil {
+		return nil, nil
+	}
+	list, ok := include.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: 'include' must be a list of globs", errBadInclude)
+	}
+	globs := make([]string, 0, len(list))
+	for _, glob := range list {
+		s, ok := glob.(string)
+		if !ok || s == "" {
+			return nil, fmt.Errorf("%w: 'include' must be a list of globs", errBadInclude)
+		}
+		globs = append(globs, s)
+	}
+	return globs, nil
+}
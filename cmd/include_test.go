@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+// writeConfigDir creates a directory with the given files, whose names are relative to it
+func writeConfigDir(t *testing.T, files map[string]string) (dir string, cleanup func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "heatsink-include")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+	for name, contents := range files {
+		filename := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+			cleanup()
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(contents), 0600); err != nil {
+			cleanup()
+			t.Fatal(err)
+		}
+	}
+	return dir, cleanup
+}
+
+func Test_newConfig_include(t *testing.T) {
+	t.Parallel()
+
+	dir, cleanup := writeConfigDir(t, map[string]string{
+		"heatsink.json": `{
+			"version": 2,
+			"include": ["conf.d/*.json", "conf.d/10-gpu.json", "heatsink.json"],
+			"heatsinks": [{"name": "cpu"}],
+			"zones": [{"name": "board", "members": [{"heatsink": "cpu"}]}],
+			"sensors": [{"name": "core0", "path_glob": "/sys/core0"}],
+			"plugins": [{"name": "hub", "command": ["hub-plugin"]}]
+		}`,
+		"conf.d/10-gpu.json": `{"heatsinks": [{"name": "gpu", "fan_response": "linear"}]}`,
+		"conf.d/20-chassis.json": `{
+			"version": 2,
+			"$schema": "../heatsink.schema.json",
+			"heatsinks": [{"name": "chassis"}],
+			"zones": [{"name": "case", "members": [{"heatsink": "cpu"}, {"heatsink": "chassis"}]}],
+			"sensors": [{"name": "ambient", "path_glob": "/sys/ambient"}],
+			"plugins": [{"name": "gpu", "command": ["gpu-plugin"]}],
+			"logging": {"level": "debug"}
+		}`,
+		"conf.d/README": `not a config`,
+	})
+	defer cleanup()
+
+	file, err := os.Open(filepath.Join(dir, "heatsink.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	cfg, err := newConfig(file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, hs := range cfg.Heatsinks {
+		names = append(names, hs.Name)
+	}
+	if diff := deep.Equal(names, []string{"cpu", "gpu", "chassis"}); diff != nil {
+		t.Error(diff)
+	}
+	// included files without a version are assumed to be of the version of the main config, so
+	// 'fan_response' is not moved into the fan as it would be for version 1
+	if expected, actual := "PowPi", cfg.Heatsinks[1].Fan.RespType; expected != actual {
+		t.Errorf("unexpected fan response type\nwant: %q\n got: %q", expected, actual)
+	}
+	expectedSensors := []configNamedSensor{
+		{Name: "core0", PathGlob: "/sys/core0"},
+		{Name: "ambient", PathGlob: "/sys/ambient"},
+	}
+	if diff := deep.Equal(cfg.Sensors, expectedSensors); diff != nil {
+		t.Error(diff)
+	}
+	var zones []string
+	for _, z := range cfg.Zones {
+		zones = append(zones, z.Name)
+	}
+	if diff := deep.Equal(zones, []string{"board", "case"}); diff != nil {
+		t.Error(diff)
+	}
+	var plugins []string
+	for _, p := range cfg.Plugins {
+		plugins = append(plugins, p.Name)
+	}
+	if diff := deep.Equal(plugins, []string{"hub", "gpu"}); diff != nil {
+		t.Error(diff)
+	}
+	if expected, actual := "debug", cfg.Logging.Level; expected != actual {
+		t.Errorf("unexpected log level\nwant: %q\n got: %q", expected, actual)
+	}
+}
+
+func Test_newConfig_include_errors(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		files       map[string]string
+		expectedErr error
+	}{
+		{
+			name: "not a list",
+			files: map[string]string{
+				"heatsink.json": `{"include": "conf.d/*.json", "heatsinks": [{}]}`,
+			},
+			expectedErr: errBadInclude,
+		},
+		{
+			name: "nested",
+			files: map[string]string{
+				"heatsink.json":  `{"include": ["conf.d/*.json"], "heatsinks": [{}]}`,
+				"conf.d/a.json":  `{"include": ["b.json"]}`,
+				"conf.d/b.json":  `{}`,
+				"conf.d/c.jsonx": `{}`,
+			},
+			expectedErr: errBadInclude,
+		},
+		{
+			name: "conflicting field",
+			files: map[string]string{
+				"heatsink.json": `{"include": ["conf.d/*.json"], "heatsinks": [{}], "state_file": "/a"}`,
+				"conf.d/a.json": `{"state_file": "/b"}`,
+			},
+			expectedErr: errIncludeConflict,
+		},
+		{
+			name: "conflicting heatsink",
+			files: map[string]string{
+				"heatsink.json": `{"include": ["conf.d/*.json"]}`,
+				"conf.d/a.json": `{"heatsinks": [{"name": "cpu"}]}`,
+				"conf.d/b.json": `{"heatsinks": [{"name": "cpu"}]}`,
+			},
+			expectedErr: errIncludeConflict,
+		},
+		{
+			name: "heatsinks not a list",
+			files: map[string]string{
+				"heatsink.json": `{"include": ["conf.d/*.json"], "heatsinks": [{}]}`,
+				"conf.d/a.json": `{"heatsinks": {"name": "cpu"}}`,
+			},
+			expectedErr: errBadInclude,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir, cleanup := writeConfigDir(t, tc.files)
+			defer cleanup()
+			file, err := os.Open(filepath.Join(dir, "heatsink.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+
+			_, err = newConfig(file, nil)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
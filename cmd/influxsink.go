@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/malkhamis/heatsink"
+	"go.uber.org/zap"
+)
+
+var (
+	errInfluxURL    = errors.New("influx url must have either an 'http', 'https', or 'udp' scheme")
+	errInfluxBucket = errors.New("influx http api requires a bucket")
+	errInfluxStatus = errors.New("unexpected http status from influx")
+)
+
+const (
+	defaultInfluxMeasurement   = "heatsink"
+	defaultInfluxFlushInterval = 10 * time.Second
+	defaultInfluxBatchSize     = 1000
+	// influxUDPPayload keeps udp datagrams below the typical MTU
+	influxUDPPayload = 1400
+	influxTimeout    = 10 * time.Second
+)
+
+// configTelemetryInflux sends every sample to InfluxDB in line protocol, either through the
+// v2 http api or to a udp listener. Samples are batched and flushed periodically or once the
+// batch is full. The heatsink's temperature and duty cycle are written to the measurement and
+// the reading of every sensor is written to the measurement suffixed with '_sensor'
+type configTelemetryInflux struct {
+	URL           string `json:"url"`
+	Org           string `json:"org,omitempty"`
+	Bucket        string `json:"bucket,omitempty"`
+	Token         string `json:"token,omitempty"`
+	Measurement   string `json:"measurement,omitempty"`
+	FlushInterval string `json:"flush_interval,omitempty"`
+	BatchSize     int    `json:"batch_size,omitempty"`
+}
+
+func (c configTelemetryInflux) newSink(logger *zap.Logger) (*influxSink, error) {
+
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInfluxURL, err)
+	}
+	sink := &influxSink{
+		measurement: c.Measurement,
+		interval:    defaultInfluxFlushInterval,
+		batchSize:   c.BatchSize,
+		logger:      logger,
+		flushReq:    make(chan struct{}, 1),
+		done:        make(chan struct{}),
+	}
+	switch u.Scheme {
+	case "http", "https":
+		if c.Bucket == "" {
+			return nil, errInfluxBucket
+		}
+		sink.send = influxHTTP(*u, c.Org, c.Bucket, c.Token)
+	case "udp":
+		sink.send = influxUDP(u.Host)
+	default:
+		return nil, fmt.Errorf("%w, got: '%s'", errInfluxURL, c.URL)
+	}
+	if sink.measurement == "" {
+		sink.measurement = defaultInfluxMeasurement
+	}
+	if sink.batchSize <= 0 {
+		sink.batchSize = defaultInfluxBatchSize
+	}
+	if c.FlushInterval != "" {
+		interval, err := time.ParseDuration(c.FlushInterval)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errBadDuration, err)
+		}
+		if interval > 0 {
+			sink.interval = interval
+		}
+	}
+
+	sink.wg.Add(1)
+	go sink.run()
+	return sink, nil
+}
+
+// influxHTTP returns a function that writes lines through the v2 http api
+func influxHTTP(base url.URL, org, bucket, token string) func([]byte) error {
+
+	base.Path = strings.TrimSuffix(base.Path, "/") + "/api/v2/write"
+	query := url.Values{"bucket": {bucket}, "precision": {"ns"}}
+	if org != "" {
+		query.Set("org", org)
+	}
+	base.RawQuery = query.Encode()
+	endpoint := base.String()
+
+	return func(lines []byte) error {
+		ctx, cancel := context.WithTimeout(context.Background(), influxTimeout)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(lines))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+		if token != "" {
+			req.Header.Set("Authorization", "Token "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+			return fmt.Errorf("%w: %s: %s", errInfluxStatus, resp.Status, bytes.TrimSpace(body))
+		}
+		return nil
+	}
+}
+
+// influxUDP returns a function that writes lines to a udp listener, splitting them into
+// datagrams at line boundaries
+func influxUDP(addr string) func([]byte) error {
+	return func(lines []byte) error {
+		conn, err := net.DialTimeout("udp", addr, influxTimeout)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		for len(lines) > 0 {
+			n := len(lines)
+			if n > influxUDPPayload {
+				if i := bytes.LastIndexByte(lines[:influxUDPPayload], '\n'); i >= 0 {
+					n = i + 1
+				} else if i := bytes.IndexByte(lines, '\n'); i >= 0 {
+					n = i + 1
+				}
+			}
+			if _, err := conn.Write(lines[:n]); err != nil {
+				return err
+			}
+			lines = lines[n:]
+		}
+		return nil
+	}
+}
+
+// influxSink batches samples in line protocol and flushes them in the background
+type influxSink struct {
+	measurement string
+	interval    time.Duration
+	batchSize   int
+	send        func(lines []byte) error
+	logger      *zap.Logger
+
+	mutex    sync.Mutex
+	buf      bytes.Buffer
+	count    int
+	flushReq chan struct{}
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+func (s *influxSink) write(hsName string, smpl heatsink.Sample) {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ts := strconv.FormatInt(smpl.Time.UnixNano(), 10)
+	hsTag := influxEscape(hsName, ",= ")
+	fmt.Fprintf(
+		&s.buf, "%s,heatsink=%s temperature=%s,duty_cycle=%s,sensor=%s %s\n",
+		influxEscape(s.measurement, ", "), hsTag,
+		strconv.FormatFloat(smpl.Temperature, 'f', -1, 64),
+		strconv.FormatFloat(smpl.DutyCycle, 'f', -1, 64),
+		`"`+influxEscape(smpl.Sensor, `"\`)+`"`, ts,
+	)
+	for _, r := range smpl.Readings {
+		fmt.Fprintf(
+			&s.buf, "%s_sensor,heatsink=%s,sensor=%s temperature=%s %s\n",
+			influxEscape(s.measurement, ", "), hsTag, influxEscape(r.Sensor, ",= "),
+			strconv.FormatFloat(r.Temperature, 'f', -1, 64), ts,
+		)
+	}
+
+	if s.count++; s.count >= s.batchSize {
+		select {
+		case s.flushReq <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// influxEscape escapes the given characters with a backslash, as required by line protocol
+func influxEscape(s, chars string) string {
+	if !strings.ContainsAny(s, chars) {
+		return s
+	}
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(chars, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// flush sends the buffered lines. If sending fails, the lines are dropped so that an
+// unreachable database does not grow the buffer indefinitely
+func (s *influxSink) flush() error {
+
+	s.mutex.Lock()
+	lines := append([]byte(nil), s.buf.Bytes()...)
+	count := s.count
+	s.buf.Reset()
+	s.count = 0
+	s.mutex.Unlock()
+
+	if count == 0 {
+		return nil
+	}
+	if err := s.send(lines); err != nil {
+		return fmt.Errorf("dropped %d samples: %w", count, err)
+	}
+	return nil
+}
+
+func (s *influxSink) run() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		case <-s.flushReq:
+		}
+		if err := s.flush(); err != nil {
+			s.logger.Warn("failed to write telemetry to influx", zap.Error(err))
+		}
+	}
+}
+
+// close stops flushing periodically and flushes the remaining samples
+func (s *influxSink) close() error {
+	select {
+	case <-s.done:
+		return nil
+	default:
+		close(s.done)
+	}
+	s.wg.Wait()
+	return s.flush()
+}
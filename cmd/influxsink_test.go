@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/malkhamis/heatsink"
+	"go.uber.org/zap"
+)
+
+func Test_configTelemetryInflux_newSink_errors(t *testing.T) {
+
+	cases := map[string]struct {
+		cfg         configTelemetryInflux
+		expectedErr error
+	}{
+		"url":      {cfg: configTelemetryInflux{URL: "%zz"}, expectedErr: errInfluxURL},
+		"scheme":   {cfg: configTelemetryInflux{URL: "tcp://localhost:8089"}, expectedErr: errInfluxURL},
+		"bucket":   {cfg: configTelemetryInflux{URL: "http://localhost:8086"}, expectedErr: errInfluxBucket},
+		"interval": {cfg: configTelemetryInflux{URL: "udp://localhost:8089", FlushInterval: "x"}, expectedErr: errBadDuration},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			_, err := c.cfg.newSink(zap.NewNop())
+			if !errors.Is(err, c.expectedErr) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", c.expectedErr, err)
+			}
+		})
+	}
+}
+
+func Test_influxSink_http(t *testing.T) {
+
+	requests := make(chan *http.Request, 1)
+	bodies := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests <- r
+		bodies <- string(body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sink, err := configTelemetryInflux{
+		URL: server.URL, Org: "home", Bucket: "hosts", Token: "secret", FlushInterval: "1h",
+	}.newSink(zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sink.write("heatsink/cpu fan", heatsink.Sample{
+		Time:        time.Unix(1, 5),
+		Sensor:      `core "1"`,
+		Temperature: 42.5,
+		DutyCycle:   0.25,
+		Readings:    []heatsink.Reading{{Sensor: "core 0", Temperature: 40}},
+	})
+	if err := sink.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	req := <-requests
+	actual := []string{
+		req.URL.Path,
+		req.URL.Query().Get("org"),
+		req.URL.Query().Get("bucket"),
+		req.URL.Query().Get("precision"),
+		req.Header.Get("Authorization"),
+		<-bodies,
+	}
+	expected := []string{
+		"/api/v2/write", "home", "hosts", "ns", "Token secret",
+		`heatsink,heatsink=heatsink/cpu\ fan temperature=42.5,duty_cycle=0.25,sensor="core \"1\"" 1000000005` + "\n" +
+			`heatsink_sensor,heatsink=heatsink/cpu\ fan,sensor=core\ 0 temperature=40 1000000005` + "\n",
+	}
+	if diff := deep.Equal(actual, expected); diff != nil {
+		t.Fatal(diff)
+	}
+}
+
+func Test_influxSink_httpError(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bucket not found", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	sink, err := configTelemetryInflux{URL: server.URL, Bucket: "x"}.newSink(zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.write("hs", heatsink.Sample{})
+	if err := sink.close(); !errors.Is(err, errInfluxStatus) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", errInfluxStatus, err)
+	}
+}
+
+func Test_influxSink_udpBatch(t *testing.T) {
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	sink, err := configTelemetryInflux{
+		URL: "udp://" + conn.LocalAddr().String(), Measurement: "fans", BatchSize: 2, FlushInterval: "1h",
+	}.newSink(zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.close()
+
+	// a full batch is flushed without waiting for the flush interval
+	sink.write("hs1", heatsink.Sample{Time: time.Unix(0, 1)})
+	sink.write("hs2", heatsink.Sample{Time: time.Unix(0, 2)})
+
+	buf := make([]byte, influxUDPPayload)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(buf[:n])), "\n")
+	expected := []string{
+		`fans,heatsink=hs1 temperature=0,duty_cycle=0,sensor="" 1`,
+		`fans,heatsink=hs2 temperature=0,duty_cycle=0,sensor="" 2`,
+	}
+	if diff := deep.Equal(lines, expected); diff != nil {
+		t.Fatal(diff)
+	}
+}
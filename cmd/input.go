@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/malkhamis/heatsink"
+	"go.uber.org/zap"
+)
+
+// configInput is a group of sensors of a heatsink with its own fan response curve, e.g. for
+// voltage regulators or NVMe drives. The fan runs at the highest duty cycle of all curves
+type configInput struct {
+	Name            string        `json:"name"`
+	SensorPathGlobs configSensors `json:"sensor_path_globs,omitempty"`
+	SensorNames     []string      `json:"sensor_names,omitempty"`
+	RespType        string        `json:"response_type,omitempty"`
+	Exponent        float64       `json:"exponent,omitempty"`
+	Midpoint        float64       `json:"midpoint,omitempty"`
+	Steepness       float64       `json:"steepness,omitempty"`
+	MinTemp         float64       `json:"min_temp"`
+	MaxTemp         float64       `json:"max_temp"`
+}
+
+// newInput creates the sensors of this input. The response type defaults to PowPi
+func (c configInput) newInput(named namedSensors, logger *zap.Logger) (heatsink.Input, error) {
+
+	in, err := c.curve()
+	if err != nil {
+		return heatsink.Input{}, err
+	}
+
+	if len(c.SensorPathGlobs) > 0 || len(c.SensorNames) == 0 {
+		globbed, err := c.SensorPathGlobs.newSensors(logger)
+		if err != nil {
+			return heatsink.Input{}, err
+		}
+		in.Sensors = globbed
+	}
+	for _, name := range c.SensorNames {
+		sensor, err := named.newSensor(name, logger)
+		if err != nil {
+			return heatsink.Input{}, fmt.Errorf("failed to create sensor '%s': %w", name, err)
+		}
+		in.Sensors = append(in.Sensors, sensor)
+	}
+
+	logger.Info(
+		"created heatsink input",
+		zap.String("name", c.Name),
+		zap.Int("sensor_count", len(in.Sensors)),
+		zap.Float64("min_temp", c.MinTemp),
+		zap.Float64("max_temp", c.MaxTemp),
+	)
+	return in, nil
+}
+
+// curve returns this input without sensors after validating its fan response curve and range
+func (c configInput) curve() (heatsink.Input, error) {
+
+	resp := heatsink.FanResponsePowPi
+	switch strings.ToLower(c.RespType) {
+	case "", "powpi":
+	case "linear":
+		resp = heatsink.FanResponseLinear
+	case "pow":
+		if c.Exponent <= 0 {
+			return heatsink.Input{}, fmt.Errorf("%w: %v", errBadExponent, c.Exponent)
+		}
+		resp = heatsink.FanResponsePow
+	case "sigmoid":
+		if c.Midpoint <= 0 || c.Midpoint >= 1 || c.Steepness <= 0 {
+			return heatsink.Input{}, fmt.Errorf(
+				"%w: midpoint %v, steepness %v", errBadSigmoid, c.Midpoint, c.Steepness,
+			)
+		}
+		resp = heatsink.FanResponseSigmoid
+	default:
+		return heatsink.Input{}, fmt.Errorf("%w: '%s'", errFanRespTypeUnknwon, c.RespType)
+	}
+	if c.MinTemp >= c.MaxTemp {
+		return heatsink.Input{}, fmt.Errorf("%w: [%v, %v]", heatsink.ErrBadTemperatureRange, c.MinTemp, c.MaxTemp)
+	}
+
+	return heatsink.Input{
+		Name:           c.Name,
+		MinTemperature: c.MinTemp,
+		MaxTemperature: c.MaxTemp,
+		Response:       resp,
+		Exponent:       c.Exponent,
+		Midpoint:       c.Midpoint,
+		Steepness:      c.Steepness,
+	}, nil
+}
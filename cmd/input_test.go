@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/malkhamis/heatsink"
+	"go.uber.org/zap"
+)
+
+func Test_configInput_newInput(t *testing.T) {
+	t.Parallel()
+
+	vrmFile, cleanup := temporaryFile(t)
+	defer cleanup()
+	nvmeFile, cleanup := temporaryFile(t)
+	defer cleanup()
+	if _, err := nvmeFile.WriteString("52000"); err != nil {
+		t.Fatal(err)
+	}
+
+	named, err := newNamedSensors([]configNamedSensor{{Name: "nvme", PathGlob: nvmeFile.Name()}}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := configInput{
+		Name:            "storage",
+		SensorPathGlobs: configSensors{vrmFile.Name()},
+		SensorNames:     []string{"nvme"},
+		RespType:        "Linear",
+		MinTemp:         40,
+		MaxTemp:         70,
+	}
+	in, err := cfg.newInput(named, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sensor := range in.Sensors {
+		defer sensor.Close()
+	}
+
+	if expected, actual := 2, len(in.Sensors); expected != actual {
+		t.Fatalf("unexpected number of sensors\nwant: %d\n got: %d", expected, actual)
+	}
+	if expected, actual := "nvme", in.Sensors[1].Name(); expected != actual {
+		t.Errorf("unexpected sensor name\nwant: %s\n got: %s", expected, actual)
+	}
+	if in.Response != heatsink.FanResponseLinear || in.MinTemperature != 40 || in.MaxTemperature != 70 {
+		t.Errorf("unexpected input: %+v", in)
+	}
+}
+
+func Test_configInput_newInput_errors(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		cfg      configInput
+		expected error
+	}{
+		"unknown-response": {
+			cfg:      configInput{RespType: "sublinear", MinTemp: 40, MaxTemp: 70},
+			expected: errFanRespTypeUnknwon,
+		},
+		"bad-exponent": {
+			cfg:      configInput{RespType: "pow", Exponent: -1, MinTemp: 40, MaxTemp: 70},
+			expected: errBadExponent,
+		},
+		"bad-sigmoid": {
+			cfg:      configInput{RespType: "sigmoid", Midpoint: 1.5, Steepness: 10, MinTemp: 40, MaxTemp: 70},
+			expected: errBadSigmoid,
+		},
+		"bad-range": {
+			cfg:      configInput{MinTemp: 70, MaxTemp: 40},
+			expected: heatsink.ErrBadTemperatureRange,
+		},
+		"no-sensors": {
+			cfg:      configInput{SensorPathGlobs: configSensors{"/does/not/exist"}, MinTemp: 40, MaxTemp: 70},
+			expected: errGlobNoMatches,
+		},
+		"unknown-name": {
+			cfg:      configInput{SensorNames: []string{"vrm"}, MinTemp: 40, MaxTemp: 70},
+			expected: errSensorNameUnknown,
+		},
+	}
+	for name, testCase := range cases {
+		_, err := testCase.cfg.newInput(namedSensors{}, zap.NewNop())
+		if !errors.Is(err, testCase.expected) {
+			t.Errorf("%s: unexpected error\nwant: %v\n got: %v", name, testCase.expected, err)
+		}
+	}
+}
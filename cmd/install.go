@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"go.uber.org/zap"
+)
+
+var errNoPwmDiscovered = errors.New("no pwm files were discovered")
+
+// unitTemplate is the systemd unit that is written by the 'install' subcommand. The daemon
+// only needs write access to sysfs and its state directory, so everything else is made
+// read-only or inaccessible
+var unitTemplate = template.Must(template.New("unit").Parse(`[Unit]
+Description=Heatsink thermal control daemon
+After=systemd-modules-load.service
+
+[Service]
+Type=notify
+ExecStart={{.Binary}} {{.Config}}
+Restart=on-failure
+RestartSec=5
+WatchdogSec=30
+CapabilityBoundingSet=CAP_DAC_OVERRIDE
+NoNewPrivileges=true
+ProtectSystem=strict
+ReadWritePaths=/sys
+StateDirectory=heatsink
+ProtectHome=true
+PrivateTmp=true
+PrivateNetwork=true
+
+[Install]
+WantedBy=multi-user.target
+`))
+
+// runCommand is internally used to ease unit testing
+var runCommand = func(name string, args ...string) error {
+	output, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s: %w: %s", name, strings.Join(args, " "), err, output)
+	}
+	return nil
+}
+
+// runInstall implements the 'install' subcommand, which writes a systemd unit for the daemon,
+// optionally writes a default config discovered from hwmon, and enables the service
+func runInstall(args []string) (exitCode int) {
+
+	logger := newLogger(logSettings{})
+	defer logger.Sync()
+
+	binary, err := os.Executable()
+	if err != nil {
+		binary = "/usr/local/bin/heatsink"
+	}
+
+	flags := flag.NewFlagSet("install", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	unitPath := flags.String("unit-path", "/etc/systemd/system/heatsink.service", "systemd unit file to write")
+	cfgPath := flags.String("config", "/etc/heatsink/config.json", "config file used by the service")
+	flags.StringVar(&binary, "binary", binary, "daemon executable used by the service")
+	discover := flags.Bool("discover", false, "write a default config discovered from hwmon if none exists")
+	sysfsRoot := flags.String("sysfs", "/sys", "sysfs mount point used for discovery")
+	noEnable := flags.Bool("no-enable", false, "do not enable and start the service")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 0 {
+		logger.Error("invalid arguments", zap.String(
+			"usage", "install [-unit-path <file>] [-config <file>] [-binary <file>] "+
+				"[-discover [-sysfs <dir>]] [-no-enable]",
+		))
+		return 64
+	}
+
+	if *discover {
+		if err := writeDiscoveredConfig(*cfgPath, *sysfsRoot, logger); err != nil {
+			logger.Error("writing discovered config", zap.Error(err), zap.String("filename", *cfgPath))
+			return 73
+		}
+	}
+
+	var unit bytes.Buffer
+	err = unitTemplate.Execute(&unit, struct{ Binary, Config string }{binary, *cfgPath})
+	if err != nil {
+		logger.Error("rendering systemd unit", zap.Error(err))
+		return 70
+	}
+	if err := ioutil.WriteFile(*unitPath, unit.Bytes(), 0644); err != nil {
+		logger.Error("writing systemd unit", zap.Error(err), zap.String("filename", *unitPath))
+		return 73
+	}
+	logger.Info("wrote systemd unit", zap.String("filename", *unitPath))
+
+	if *noEnable {
+		return 0
+	}
+	unitName := filepath.Base(*unitPath)
+	if err := runCommand("systemctl", "daemon-reload"); err != nil {
+		logger.Error("reloading systemd", zap.Error(err))
+		return 71
+	}
+	if err := runCommand("systemctl", "enable", "--now", unitName); err != nil {
+		logger.Error("enabling service", zap.Error(err), zap.String("unit", unitName))
+		return 71
+	}
+	logger.Info("enabled and started service", zap.String("unit", unitName))
+
+	return 0
+}
+
+// writeDiscoveredConfig writes a default config discovered from hwmon to the given file unless
+// the file already exists
+func writeDiscoveredConfig(filename, sysfsRoot string, logger *zap.Logger) error {
+
+	if _, err := os.Stat(filename); err == nil {
+		logger.Info("config file already exists, skipping discovery", zap.String("filename", filename))
+		return nil
+	}
+
+	cfg, err := discoverConfig(sysfsRoot)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filename, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+
+	logger.Info(
+		"wrote discovered config, review it before relying on it",
+		zap.String("filename", filename),
+		zap.Int("heatsink-count", len(cfg.Heatsinks)),
+	)
+	return nil
+}
+
+var rePwmFile = regexp.MustCompile(`^pwm[0-9]+$`)
+
+// cpuHwmonNames are names of hwmon chips that report CPU temperatures
+var cpuHwmonNames = map[string]bool{"coretemp": true, "k10temp": true, "zenpower": true}
+
+// discoverConfig creates a config with one heatsink per pwm file found under hwmon. Each
+// heatsink reads the temperature inputs of CPU chips if any, or otherwise all temperature
+// inputs. The thresholds are conservative defaults that should be tuned by the user
+func discoverConfig(sysfsRoot string) (*config, error) {
+
+	hwmonDirs, err := filepath.Glob(filepath.Join(sysfsRoot, "class", "hwmon", "hwmon*"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(hwmonDirs)
+
+	var pwmFiles, cpuTemps, allTemps []string
+	for _, dir := range hwmonDirs {
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if rePwmFile.MatchString(entry.Name()) {
+				pwmFiles = append(pwmFiles, filepath.Join(dir, entry.Name()))
+			}
+		}
+		temps, _ := filepath.Glob(filepath.Join(dir, "temp*_input"))
+		allTemps = append(allTemps, temps...)
+		chipName, _ := ioutil.ReadFile(filepath.Join(dir, "name"))
+		if cpuHwmonNames[strings.TrimSpace(string(chipName))] {
+			cpuTemps = append(cpuTemps, temps...)
+		}
+	}
+	if len(pwmFiles) == 0 {
+		return nil, fmt.Errorf("%w under '%s'", errNoPwmDiscovered, sysfsRoot)
+	}
+
+	sensors := cpuTemps
+	if len(sensors) == 0 {
+		sensors = allTemps
+	}
+	cfg := &config{Version: currentConfigVersion}
+	for i, pwm := range pwmFiles {
+		cfg.Heatsinks = append(cfg.Heatsinks, &configHeatsink{
+			Name:            fmt.Sprintf("heatsink/%d", i+1),
+			SensorPathGlobs: sensors,
+			TempChkPeriod:   "1s",
+			MinTemp:         40,
+			MaxTemp:         70,
+			Fan: configFan{
+				Name:        fmt.Sprintf("fan/%d", i+1),
+				PathGlob:    pwm,
+				PwmPeriod:   "50ms",
+				MinSpeedVal: "0",
+				MaxSpeedVal: "255",
+				RespType:    "PowPi",
+			},
+		})
+	}
+	return cfg, nil
+}
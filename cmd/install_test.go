@@ -0,0 +1,130 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// fakeSysfs creates a sysfs tree with two hwmon chips: a CPU chip with two temperature inputs
+// and a super I/O chip with two pwm outputs and one temperature input
+func fakeSysfs(t *testing.T) (root string, cleanup func()) {
+	t.Helper()
+
+	root, err := ioutil.TempDir("", "sysfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"class/hwmon/hwmon0/name":        "coretemp\n",
+		"class/hwmon/hwmon0/temp1_input": "40000\n",
+		"class/hwmon/hwmon0/temp2_input": "41000\n",
+		"class/hwmon/hwmon1/name":        "nct6775\n",
+		"class/hwmon/hwmon1/temp1_input": "30000\n",
+		"class/hwmon/hwmon1/pwm1":        "128\n",
+		"class/hwmon/hwmon1/pwm1_enable": "1\n",
+		"class/hwmon/hwmon1/pwm2":        "128\n",
+	}
+	for name, content := range files {
+		filename := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root, func() { os.RemoveAll(root) }
+}
+
+func Test_discoverConfig(t *testing.T) {
+	t.Parallel()
+
+	root, cleanup := fakeSysfs(t)
+	defer cleanup()
+
+	cfg, err := discoverConfig(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Heatsinks) != 2 {
+		t.Fatalf("expected a heatsink per pwm file, got: %d", len(cfg.Heatsinks))
+	}
+	hwmon := filepath.Join(root, "class", "hwmon")
+	if expected, actual := filepath.Join(hwmon, "hwmon1", "pwm2"), cfg.Heatsinks[1].Fan.PathGlob; expected != actual {
+		t.Errorf("unexpected fan path\nwant: %s\n got: %s", expected, actual)
+	}
+	expectedSensors := []string{
+		filepath.Join(hwmon, "hwmon0", "temp1_input"),
+		filepath.Join(hwmon, "hwmon0", "temp2_input"),
+	}
+	if actual := cfg.Heatsinks[0].SensorPathGlobs; strings.Join(actual, ",") != strings.Join(expectedSensors, ",") {
+		t.Errorf("expected only cpu sensors\nwant: %v\n got: %v", expectedSensors, actual)
+	}
+
+	if _, err := discoverConfig(filepath.Join(root, "nothing")); err == nil {
+		t.Error("expected an error if no pwm files are discovered")
+	}
+}
+
+func Test_runInstall(t *testing.T) {
+
+	origNewLogger := newLogger
+	defer func() { newLogger = origNewLogger }()
+	newLogger = func(logSettings) *zap.Logger { return zap.NewNop() }
+
+	var commands []string
+	origRunCommand := runCommand
+	defer func() { runCommand = origRunCommand }()
+	runCommand = func(name string, args ...string) error {
+		commands = append(commands, name+" "+strings.Join(args, " "))
+		return nil
+	}
+
+	root, cleanup := fakeSysfs(t)
+	defer cleanup()
+	unitPath := filepath.Join(root, "heatsink.service")
+	cfgPath := filepath.Join(root, "etc", "heatsink", "config.json")
+
+	exitCode := runInstall([]string{
+		"-unit-path", unitPath, "-config", cfgPath, "-binary", "/opt/heatsink",
+		"-discover", "-sysfs", root,
+	})
+	if exitCode != 0 {
+		t.Fatalf("expected exit code 0, got: %d", exitCode)
+	}
+
+	unit, err := ioutil.ReadFile(unitPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"Type=notify", "ExecStart=/opt/heatsink " + cfgPath, "WatchdogSec=", "StateDirectory=heatsink",
+	} {
+		if !strings.Contains(string(unit), expected) {
+			t.Errorf("expected unit to contain %q, got:\n%s", expected, unit)
+		}
+	}
+
+	cfgFile, err := os.Open(cfgPath)
+	if err != nil {
+		t.Fatalf("expected discovered config to be written: %v", err)
+	}
+	defer cfgFile.Close()
+	if _, err := newConfig(cfgFile, nil); err != nil {
+		t.Errorf("expected discovered config to be valid, got: %v", err)
+	}
+
+	expectedCommands := "systemctl daemon-reload;systemctl enable --now heatsink.service"
+	if actual := strings.Join(commands, ";"); expectedCommands != actual {
+		t.Errorf("unexpected commands\nwant: %s\n got: %s", expectedCommands, actual)
+	}
+
+	if expected, actual := 64, runInstall([]string{"extra-arg"}); expected != actual {
+		t.Errorf("actual exit code doesn't match expected\nwant: %d\n got: %d", expected, actual)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+
+	"github.com/malkhamis/heatsink/thermosense"
+	"go.uber.org/zap"
+)
+
+// configHwmonLimits derives the maximum and critical temperatures of a heatsink from the
+// tempN_max and tempN_crit files next to its sensors' tempN_input files. The margins are how
+// many degrees below the reported limits the derived ones are
+type configHwmonLimits struct {
+	MaxMargin      float64 `json:"max_margin,omitempty"`
+	CriticalMargin float64 `json:"critical_margin,omitempty"`
+}
+
+// derivedLimits are temperature limits derived from the hardware. A zero limit was not derived
+type derivedLimits struct {
+	min, max, crit float64
+}
+
+// temperatureLimits returns the minimum, maximum, and critical temperatures of this heatsink.
+// The limits that are not configured are derived from the trip points of the thermal zones, if
+// enabled, and then from the hwmon limits of the sensors, if enabled. A zero critical
+// temperature means there is none
+func (c *configHeatsink) temperatureLimits(logger *zap.Logger) (min, max, crit float64, err error) {
+
+	type source struct {
+		name   string
+		limits derivedLimits
+	}
+	var sources []source
+	if c.TripPointLimits {
+		limits, err := c.tripPointLimits()
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		sources = append(sources, source{"thermal_zone_trip_points", limits})
+	}
+	if c.HwmonLimits != nil {
+		limits, err := c.HwmonLimits.derive(c.SensorPathGlobs)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		sources = append(sources, source{"hwmon_limits", limits})
+	}
+
+	min, max, crit = c.MinTemp, c.MaxTemp, c.CritTemp
+	for _, src := range sources {
+		for _, limit := range []struct {
+			name    string
+			value   *float64
+			derived float64
+		}{
+			{"min_temp", &min, src.limits.min},
+			{"max_temp", &max, src.limits.max},
+			{"critical_temp", &crit, src.limits.crit},
+		} {
+			if *limit.value != 0 || limit.derived == 0 {
+				continue
+			}
+			*limit.value = limit.derived
+			logger.Info(
+				"derived temperature limit from the hardware",
+				zap.String("heatsink", c.Name),
+				zap.String("limit", limit.name),
+				zap.String("source", src.name),
+				zap.Float64("temperature", limit.derived),
+			)
+		}
+	}
+	return min, max, crit, nil
+}
+
+// derive returns the lowest maximum and critical temperatures reported for the hwmon inputs
+// matched by the given path globs, less the margins. Device addresses are skipped
+func (c configHwmonLimits) derive(patterns configSensors) (derivedLimits, error) {
+
+	lowestMax, lowestCrit := math.Inf(1), math.Inf(1)
+	for _, pattern := range patterns {
+		if isDeviceAddress(pattern) {
+			continue
+		}
+		filenames, err := filepath.Glob(pattern)
+		if err != nil {
+			return derivedLimits{}, fmt.Errorf("invalid glob '%s': %w", pattern, err)
+		}
+		for _, filename := range filenames {
+			reported, err := thermosense.ReadHwmonLimits(filename)
+			if err != nil {
+				return derivedLimits{}, err
+			}
+			if reported.Max > 0 {
+				lowestMax = math.Min(lowestMax, reported.Max)
+			}
+			if reported.Critical > 0 {
+				lowestCrit = math.Min(lowestCrit, reported.Critical)
+			}
+		}
+	}
+
+	var limits derivedLimits
+	if !math.IsInf(lowestMax, 1) {
+		limits.max = lowestMax - c.MaxMargin
+	}
+	if !math.IsInf(lowestCrit, 1) {
+		limits.crit = lowestCrit - c.CriticalMargin
+	}
+	return limits, nil
+}
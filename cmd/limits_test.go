@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/malkhamis/heatsink/thermosense"
+	"go.uber.org/zap"
+)
+
+func Test_configHwmonLimits_derive(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "hwmon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"temp1_input": "45000",
+		"temp1_max":   "84000",
+		"temp1_crit":  "100000",
+		"temp2_input": "45000",
+		"temp2_max":   "82000",
+		"temp3_input": "45000",
+	}
+	for filename, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, filename), []byte(content+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := map[string]struct {
+		cfg      configHwmonLimits
+		patterns configSensors
+		expected derivedLimits
+	}{
+		"lowest-limits": {
+			patterns: configSensors{filepath.Join(dir, "temp*_input")},
+			expected: derivedLimits{max: 82, crit: 100},
+		},
+		"margins": {
+			cfg:      configHwmonLimits{MaxMargin: 2, CriticalMargin: 5},
+			patterns: configSensors{filepath.Join(dir, "temp1_input")},
+			expected: derivedLimits{max: 82, crit: 95},
+		},
+		"no-limits": {
+			cfg:      configHwmonLimits{MaxMargin: 2, CriticalMargin: 5},
+			patterns: configSensors{filepath.Join(dir, "temp3_input"), "lmsensors:coretemp-*/Core 0"},
+			expected: derivedLimits{},
+		},
+	}
+	for name, testCase := range cases {
+		actual, err := testCase.cfg.derive(testCase.patterns)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if diff := deep.Equal(actual, testCase.expected); diff != nil {
+			t.Errorf("%s: %v", name, diff)
+		}
+	}
+
+	_, err = configHwmonLimits{}.derive(configSensors{filepath.Join(dir, "temp1_max")})
+	if !errors.Is(err, thermosense.ErrNotHwmonInput) {
+		t.Errorf("unexpected error\nwant: %v\n got: %v", thermosense.ErrNotHwmonInput, err)
+	}
+}
+
+func Test_configHeatsink_temperatureLimits_precedence(t *testing.T) {
+
+	root, cleanup := fakeSysfsThermal(t, map[string][]thermosense.TripPoint{
+		"acpitz": {{Type: thermosense.TripPassive, Temperature: 90}},
+	})
+	defer cleanup()
+
+	hwmonDir := filepath.Join(root, "class", "hwmon", "hwmon0")
+	if err := os.MkdirAll(hwmonDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for filename, content := range map[string]string{
+		"temp1_input": "45000", "temp1_max": "80000", "temp1_crit": "100000",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(hwmonDir, filename), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hs := &configHeatsink{
+		SensorPathGlobs: configSensors{filepath.Join(hwmonDir, "temp1_input")},
+		ThermalZones:    []string{"acpitz"},
+		TripPointLimits: true,
+		HwmonLimits:     &configHwmonLimits{CriticalMargin: 10},
+		MinTemp:         35,
+		thermalClassDir: filepath.Join(root, thermalClassDir),
+	}
+	min, max, crit, err := hs.temperatureLimits(zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the trip points take precedence over the hwmon limits, which only fill in the rest
+	if diff := deep.Equal([]float64{min, max, crit}, []float64{35, 90, 90}); diff != nil {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/malkhamis/heatsink"
+	"github.com/malkhamis/heatsink/lmsensors"
+	"go.uber.org/zap"
+)
+
+// lmsensorsPrefix marks sensor path globs that name an lm-sensors chip and feature instead of a
+// file, e.g. 'lmsensors:coretemp-*/Package id 0'
+const lmsensorsPrefix = "lmsensors:"
+
+// lmsensorsAddress returns the chip and the feature label that the given path glob addresses,
+// if any. Chip names cannot contain slashes, so the feature label may
+func lmsensorsAddress(pattern string) (chip, feature string, ok bool) {
+	if !strings.HasPrefix(pattern, lmsensorsPrefix) {
+		return "", "", false
+	}
+	address := strings.TrimPrefix(pattern, lmsensorsPrefix)
+	if i := strings.Index(address, "/"); i >= 0 {
+		return address[:i], address[i+1:], true
+	}
+	return address, "", true
+}
+
+func newLMSensor(chip, feature, name string, logger *zap.Logger) (heatsink.ThermoSensor, error) {
+
+	onAlarm := func(sensor string, alarms []string) {
+		logger.Warn(
+			"lm-sensors reports active alarms",
+			zap.String("event", "sensor_alarm"),
+			zap.String("sensor", sensor),
+			zap.Strings("alarms", alarms),
+		)
+	}
+	sensor, err := lmsensors.New(chip, feature, lmsensors.OptName(name), lmsensors.OptOnAlarm(onAlarm))
+	if err != nil {
+		return nil, fmt.Errorf("'%s%s/%s': %w", lmsensorsPrefix, chip, feature, err)
+	}
+	logger.Info(
+		"created lm-sensors sensor",
+		zap.String("name", sensor.Name()),
+		zap.String("chip", chip),
+		zap.String("feature", feature),
+	)
+	return sensor, nil
+}
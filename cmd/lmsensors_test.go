@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func Test_lmsensorsAddress(t *testing.T) {
+
+	cases := []struct {
+		pattern  string
+		expected []interface{}
+	}{
+		{pattern: "lmsensors:coretemp-*/Package id 0", expected: []interface{}{"coretemp-*", "Package id 0", true}},
+		{pattern: "lmsensors:nct6775-isa-0290/SYSTIN/AUX", expected: []interface{}{"nct6775-isa-0290", "SYSTIN/AUX", true}},
+		{pattern: "lmsensors:coretemp-*", expected: []interface{}{"coretemp-*", "", true}},
+		{pattern: "/sys/class/hwmon/hwmon0/temp1_input", expected: []interface{}{"", "", false}},
+	}
+
+	for _, c := range cases {
+		chip, feature, ok := lmsensorsAddress(c.pattern)
+		if diff := deep.Equal([]interface{}{chip, feature, ok}, c.expected); diff != nil {
+			t.Errorf("%s: %v", c.pattern, diff)
+		}
+	}
+}
+
+func Test_config_topology_deviceAddress(t *testing.T) {
+	cfg := &config{Heatsinks: []*configHeatsink{{
+		Name:            "cpu",
+		Fan:             configFan{PathGlob: "smc:0"},
+		SensorPathGlobs: configSensors{"lmsensors:coretemp-*/Package id 0"},
+	}}}
+	for _, node := range cfg.topology().Nodes {
+		if node.Unmatched {
+			t.Errorf("expected device address '%s' not to be reported as an unmatched glob", node.Label)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	errBadLogLevel  = errors.New("log level must be one of 'debug', 'info', 'warn', or 'error'")
+	errBadLogFormat = errors.New("log format must be either 'json' or 'console'")
+)
+
+// logSettings holds the user's preferences for building the logger. Empty fields fall back
+// to info-level json logging to stdout
+type logSettings struct {
+	Level  string `json:"level,omitempty"`
+	Format string `json:"format,omitempty"`
+	Output string `json:"output,omitempty"`
+}
+
+// validate ensures the level and format, if set, are supported
+func (s logSettings) validate() error {
+	switch s.Level {
+	case "", "debug", "info", "warn", "error":
+	default:
+		return fmt.Errorf("%w, got %q", errBadLogLevel, s.Level)
+	}
+	switch s.Format {
+	case "", "json", "console":
+	default:
+		return fmt.Errorf("%w, got %q", errBadLogFormat, s.Format)
+	}
+	return nil
+}
+
+// overriddenBy returns a copy of these settings where the non-empty fields of other win
+func (s logSettings) overriddenBy(other logSettings) logSettings {
+	if other.Level != "" {
+		s.Level = other.Level
+	}
+	if other.Format != "" {
+		s.Format = other.Format
+	}
+	if other.Output != "" {
+		s.Output = other.Output
+	}
+	return s
+}
+
+// zapConfig translates these settings to a zap config. Invalid settings are ignored
+func (s logSettings) zapConfig() zap.Config {
+
+	loggerConfig := zap.NewProductionConfig()
+	if s.Format == "console" {
+		loggerConfig.Encoding = "console"
+		loggerConfig.EncoderConfig = zap.NewDevelopmentEncoderConfig()
+	}
+
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(s.Level)); err == nil {
+		loggerConfig.Level = zap.NewAtomicLevelAt(level)
+	}
+
+	loggerConfig.OutputPaths = []string{"stdout"}
+	if s.Output != "" {
+		loggerConfig.OutputPaths = []string{s.Output}
+	}
+	return loggerConfig
+}
+
+// newLogger is internally used to ease unit testing
+var newLogger = func(settings logSettings) *zap.Logger {
+	logger := getLoggerAndPrintErrIfAny(settings.zapConfig().Build())
+	return logger
+}
+
+// getLoggerAndPrintErrIfAny is internally used to ease unit testing
+func getLoggerAndPrintErrIfAny(logger *zap.Logger, err error) *zap.Logger {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if err != nil {
+		log.Printf("error creating logger: %v\n", err)
+	}
+	return logger
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"go.uber.org/zap/zapcore"
+)
+
+func Test_logSettings_validate(t *testing.T) {
+
+	testCases := []struct {
+		name     string
+		settings logSettings
+		expected error
+	}{
+		{"empty", logSettings{}, nil},
+		{"valid", logSettings{Level: "warn", Format: "console", Output: "stderr"}, nil},
+		{"level", logSettings{Level: "loud"}, errBadLogLevel},
+		{"format", logSettings{Format: "xml"}, errBadLogFormat},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.settings.validate(); !errors.Is(err, tc.expected) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func Test_logSettings_overriddenBy(t *testing.T) {
+
+	fromConfig := logSettings{Level: "debug", Format: "console", Output: "/var/log/heatsink.log"}
+	fromFlags := logSettings{Level: "error"}
+
+	expected := logSettings{Level: "error", Format: "console", Output: "/var/log/heatsink.log"}
+	if diff := deep.Equal(fromConfig.overriddenBy(fromFlags), expected); diff != nil {
+		t.Fatal(diff)
+	}
+}
+
+func Test_logSettings_zapConfig(t *testing.T) {
+
+	defaults := logSettings{}.zapConfig()
+	if expected, actual := zapcore.InfoLevel, defaults.Level.Level(); actual != expected {
+		t.Errorf("unexpected default level\nwant: %s\n got: %s", expected, actual)
+	}
+	if expected, actual := "json", defaults.Encoding; actual != expected {
+		t.Errorf("unexpected default encoding\nwant: %s\n got: %s", expected, actual)
+	}
+	if diff := deep.Equal(defaults.OutputPaths, []string{"stdout"}); diff != nil {
+		t.Errorf("unexpected default output paths: %v", diff)
+	}
+
+	custom := logSettings{Level: "debug", Format: "console", Output: "stderr"}.zapConfig()
+	if expected, actual := zapcore.DebugLevel, custom.Level.Level(); actual != expected {
+		t.Errorf("unexpected level\nwant: %s\n got: %s", expected, actual)
+	}
+	if expected, actual := "console", custom.Encoding; actual != expected {
+		t.Errorf("unexpected encoding\nwant: %s\n got: %s", expected, actual)
+	}
+	if diff := deep.Equal(custom.OutputPaths, []string{"stderr"}); diff != nil {
+		t.Errorf("unexpected output paths: %v", diff)
+	}
+}
+
+func Test_newLogger_outputFile(t *testing.T) {
+
+	tmpFile, cleanup := temporaryFile(t)
+	defer cleanup()
+	output := tmpFile.Name()
+
+	logger := newLogger(logSettings{Level: "warn", Output: output})
+	logger.Info("dropped")
+	logger.Warn("kept")
+	logger.Sync()
+
+	logs, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(logs), "dropped") || !strings.Contains(string(logs), `"msg":"kept"`) {
+		t.Fatalf("expected only warn-level entries in the log file, got:\n%s", logs)
+	}
+}
+
+func Test_getLoggerAndPrintErrIfAny(t *testing.T) {
+
+	stdoutLines, streamErr, restoreStdout := stdoutStream(t)
+	defer restoreStdout()
+
+	orig := log.Writer()
+	defer log.SetOutput(orig)
+	log.SetOutput(os.Stdout)
+
+	actual := getLoggerAndPrintErrIfAny(nil, errors.New("simulated error"))
+	if actual == nil {
+		t.Fatal("expected a non-nil logger")
+	}
+
+	for deadline := time.After(1 * time.Second); ; {
+		select {
+		case <-deadline:
+			t.Fatal("timeout waiting for the expected log entry")
+		case err := <-streamErr:
+			t.Fatalf("reading stdout stream: %v", err)
+		case logLine := <-stdoutLines:
+			if strings.Contains(string(logLine), "error creating logger: simulated error") {
+				return // test passed
+			}
+		default:
+		}
+	}
+}
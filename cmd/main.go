@@ -1,10 +1,13 @@
 package main
 
 import (
-	"log"
+	"errors"
 	"os"
+	"os/signal"
 	"sync"
+	"syscall"
 
+	"github.com/malkhamis/heatsink"
 	"go.uber.org/zap"
 )
 
@@ -18,63 +21,274 @@ func main() {
 
 func execute() (exitCode int) {
 
-	logger := newLogger()
-	defer logger.Sync()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "version":
+			return runVersion(os.Stdout)
+		case "topology":
+			return runTopology(os.Args[2:], os.Stdout)
+		case "migrate":
+			return runMigrate(os.Args[2:], os.Stdout)
+		case "schema":
+			return runSchema(os.Args[2:], os.Stdout)
+		case "install":
+			return runInstall(os.Args[2:])
+		case "stats":
+			return runStats(os.Args[2:], os.Stdout)
+		case "benchmark":
+			return runBenchmark(os.Args[2:], os.Stdout)
+		case "agent":
+			return runAgent(os.Args[2:])
+		case "doctor":
+			return runDoctor(os.Args[2:], os.Stdout)
+		case "udev":
+			return runUdev(os.Args[2:], os.Stdout)
+		case controlStatus, controlSet, controlProfile, controlReload:
+			return runClient(os.Args[1], os.Args[2:], os.Stdout)
+		}
+	}
 
-	if len(os.Args) < 2 {
-		logger.Error("invalid arguments", zap.String("error", "no filepath given for json config"))
+	var args []string
+	if len(os.Args) > 1 {
+		args = os.Args[1:]
+	}
+	opts, err := parseFlags(args)
+	if err != nil {
+		logger := newLogger(logSettings{})
+		defer logger.Sync()
+		logger.Error("invalid arguments", zap.String("error", err.Error()), zap.String("usage", usage))
 		return 64
 	}
-	filename := os.Args[1]
 
-	file, err := os.Open(filename)
+	for {
+		exitCode, reloading := runDaemon(opts)
+		if !reloading {
+			return exitCode
+		}
+	}
+}
+
+// runDaemon loads the config given in the options and runs thermal control until the process
+// is signaled to terminate, all heatsinks stopped on their own, or a reload was requested using
+// SIGHUP, the control socket, or by changing a watched config file, in which case reloading is true
+func runDaemon(opts cliOptions) (exitCode int, reloading bool) {
+
+	logger := newLogger(opts.log)
+	defer func() { logger.Sync() }()
+
+	file, err := os.Open(opts.configPath)
 	if err != nil {
 		logger.Error("opening the given file", zap.Error(err))
-		return 66
+		return 66, false
 	}
 
 	cfg, err := newConfig(file, logger)
+	if err == nil && opts.strictConfig {
+		err = cfg.rejectUnknownFields()
+	}
 	if err != nil {
-		logger.Error("creating heatsink config", zap.Error(err), zap.String("filename", filename))
-		return 78
+		logger.Error("creating heatsink config", zap.Error(err), zap.String("filename", opts.configPath))
+		return 78, false
+	}
+
+	if settings := cfg.Logging.overriddenBy(opts.log); settings != opts.log {
+		logger.Sync()
+		logger = newLogger(settings)
+		cfg.logger = logger
 	}
 
-	heatsinks, err := cfg.newHeatsinks()
+	cfg.faultInjection = opts.faultInjection
+	cfg.dryRun = opts.dryRun
+	if cfg.StateFile != "" {
+		if cfg.state, err = loadState(cfg.StateFile); err != nil {
+			logger.Warn("ignoring unreadable state file", zap.Error(err), zap.String("filename", cfg.StateFile))
+		}
+	}
+	d, err := cfg.newDaemon(opts.configPath, opts.strictConfig)
 	if err != nil {
-		logger.Error("instantiating heatsinks", zap.Error(err), zap.String("filename", filename))
-		return 78
+		logger.Error("creating daemon", zap.Error(err), zap.String("filename", opts.configPath))
+		return 78, false
+	}
+	heatsinks, profiles := d.heatsinks, d.profiles
+	// the fans are released on every return that does not hand the heatsinks over to
+	// runHeatsinks, so that they are left as they would be on exit, e.g. at full speed
+	running := false
+	defer func() {
+		if running {
+			closeSinks(cfg.sinks, logger)
+		} else {
+			d.release(cfg.sinks, logger)
+		}
+	}()
+
+	if opts.validate {
+		logger.Info("config is valid", zap.String("filename", opts.configPath))
+		return 0, false
+	}
+
+	if opts.selfTest && !runSelfTest(heatsinks, logger) {
+		return 69, false
+	}
+
+	// every device file is open by now, so the daemon no longer needs to be root. The
+	// privileges are dropped before anything else runs, e.g. the policy hook or control script
+	if cfg.Privileges != nil {
+		if err := cfg.Privileges.drop(logger); err != nil {
+			logger.Error("dropping privileges", zap.Error(err), zap.String("user", cfg.Privileges.User))
+			return 77, false
+		}
+	}
+
+	if opts.metricsAddr != "" {
+		stopMetrics, err := serveMetrics(opts.metricsAddr, heatsinks, profiles, logger)
+		if err != nil {
+			logger.Error("starting metrics server", zap.Error(err), zap.String("address", opts.metricsAddr))
+			return 71, false
+		}
+		defer stopMetrics()
+	}
+
+	var reload <-chan struct{}
+	// the control socket config was validated along with the rest of the config
+	if socket, _ := cfg.ControlSocket.resolve(opts.controlSocket); socket.path != "" {
+		var stopControl func()
+		reload, stopControl, err = serveControl(socket, opts.configPath, opts.strictConfig, heatsinks, profiles, logger)
+		if err != nil {
+			logger.Warn("not serving control socket", zap.Error(err), zap.String("path", socket.path))
+		} else {
+			defer stopControl()
+		}
+	}
+
+	if d.cfgWatcher != nil {
+		merged, stopWatcher, err := d.cfgWatcher.start(reload)
+		if err != nil {
+			logger.Warn("not watching config file", zap.Error(err), zap.String("filename", opts.configPath))
+		} else {
+			reload = merged
+			defer stopWatcher()
+		}
+	}
+
+	// a dry run must not overwrite the state of the real fans
+	if cfg.StateFile != "" && !opts.dryRun {
+		stopStateSaver := startStateSaver(cfg.StateFile, cfg.state, heatsinks, logger)
+		defer stopStateSaver()
+	}
+
+	if d.policy != nil {
+		stopPolicy := d.policy.start()
+		defer stopPolicy()
 	}
 
+	if d.script != nil {
+		stopScript := d.script.start()
+		defer stopScript()
+	}
+
+	if d.bridge != nil {
+		stopBridge := d.bridge.start()
+		defer stopBridge()
+	}
+
+	if d.dbus != nil {
+		if stopDBus, err := d.dbus.start(); err != nil {
+			logger.Warn("not serving dbus", zap.Error(err))
+		} else {
+			defer stopDBus()
+		}
+	}
+
+	if d.alerts != nil {
+		stopAlerts := d.alerts.Start()
+		defer stopAlerts()
+	}
+
+	if len(d.rescanners) > 0 {
+		stopRescanners := startSensorRescanners(d.rescanners)
+		defer stopRescanners()
+	}
+
+	running = true
+	return runHeatsinks(heatsinks, reload, logger)
+}
+
+// stopHeatsinks stops the given heatsinks, which releases their fans and sensors
+func stopHeatsinks(heatsinks []*heatsink.Heatsink, logger *zap.Logger) {
+	for _, hs := range heatsinks {
+		if err := hs.StopThermalControl(); err != nil {
+			logger.Error("releasing heatsink", zap.Error(err), zap.String("heatsink", hs.Name()))
+		}
+	}
+}
+
+// signalNotify is internally used to ease unit testing
+var signalNotify = signal.Notify
+
+// runHeatsinks starts thermal control of all heatsinks and blocks until all of them stop. If
+// the process is signaled to terminate, all heatsinks are stopped and it returns 0. If the
+// process receives SIGHUP or a reload is requested on the given channel, all heatsinks are
+// stopped and it returns 0 with reloading set. Otherwise, it returns 1 once all heatsinks
+// stopped on their own due to errors
+func runHeatsinks(
+	heatsinks []*heatsink.Heatsink, reload <-chan struct{}, logger *zap.Logger,
+) (exitCode int, reloading bool) {
+
+	terminate := make(chan os.Signal, 1)
+	signalNotify(terminate, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(terminate)
+
 	var wg sync.WaitGroup
 	for _, hs := range heatsinks {
 		hs := hs
 		wg.Add(1)
 		go func() {
 			err := hs.StartThermalControl()
-			logger.Error("thermal control returned an error", zap.Error(err))
+			if !errors.Is(err, heatsink.ErrControllerStopped) {
+				logger.Error("thermal control returned an error", zap.Error(err))
+			}
 			wg.Done()
 		}()
 	}
-	wg.Wait()
+	allStopped := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(allStopped)
+	}()
 
-	return 1
-}
+	if err := sdNotify("READY=1"); err != nil {
+		logger.Error("failed to notify systemd about readiness", zap.Error(err))
+	}
+	stopWatchdog := startWatchdog(heatsinks, logger)
+	defer stopWatchdog()
 
-// newLogger is internally used to ease unit testing
-var newLogger = func() *zap.Logger {
-	loggerConfig := zap.NewProductionConfig()
-	loggerConfig.OutputPaths = []string{"stdout"}
-	logger := getLoggerAndPrintErrIfAny(loggerConfig.Build())
-	return logger
-}
+	select {
+	case <-allStopped:
+		return 1, false
+	case sig := <-terminate:
+		reloading = sig == syscall.SIGHUP
+		logger.Info("received signal, stopping thermal control", zap.String("signal", sig.String()))
+	case <-reload:
+		reloading = true
+		logger.Info("reload requested, stopping thermal control")
+	}
 
-// getLoggerAndPrintErrIfAny is internally used to ease unit testing
-func getLoggerAndPrintErrIfAny(logger *zap.Logger, err error) *zap.Logger {
-	if logger == nil {
-		logger = zap.NewNop()
+	state := "STOPPING=1"
+	if reloading {
+		state = "RELOADING=1"
 	}
-	if err != nil {
-		log.Printf("error creating logger: %v\n", err)
+	if err := sdNotify(state); err != nil {
+		logger.Error("failed to notify systemd about stopping", zap.Error(err), zap.String("state", state))
 	}
-	return logger
+	for _, hs := range heatsinks {
+		err := hs.StopThermalControl()
+		if err != nil && !errors.Is(err, heatsink.ErrControllerStopped) {
+			logger.Error(
+				"failed to stop thermal control", zap.Error(err), zap.String("heatsink", hs.Name()),
+			)
+		}
+	}
+	<-allStopped
+
+	return 0, reloading
 }
@@ -1,14 +1,14 @@
 package main
 
 import (
-	"errors"
 	"fmt"
-	"log"
+	"io/ioutil"
 	"os"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/go-test/deep"
 	"go.uber.org/zap"
 )
 
@@ -23,7 +23,7 @@ func TestMain(t *testing.T) {
 	origNewLogger := newLogger
 	defer func() { newLogger = origNewLogger }()
 
-	newLogger = func() *zap.Logger { return zap.NewNop() }
+	newLogger = func(logSettings) *zap.Logger { return zap.NewNop() }
 	os.Args = nil
 	osExit = func(actualExitCode int) {
 		if expected := 64; actualExitCode != expected {
@@ -280,7 +280,7 @@ func Test_execute_invalidHeatsinkConfig(t *testing.T) {
 		case logLine := <-stdoutLines:
 			if strings.Contains(
 				string(logLine),
-				`"msg":"instantiating heatsinks","error":"heatsink '': failed to create all sensors`,
+				`"msg":"creating daemon","error":"instantiating heatsinks: heatsink '': failed to create all sensors`,
 			) {
 				return // test passed
 			}
@@ -289,31 +289,99 @@ func Test_execute_invalidHeatsinkConfig(t *testing.T) {
 	}
 }
 
-func Test_getLoggerAndPrintErrIfAny(t *testing.T) {
+func Test_execute_validate(t *testing.T) {
 
-	stdoutLines, streamErr, restoreStdout := stdoutStream(t)
-	defer restoreStdout()
+	restoreProcArgs := backupProcArgs(t)
+	defer restoreProcArgs()
 
-	orig := log.Writer()
-	defer log.SetOutput(orig)
-	log.SetOutput(os.Stdout)
+	origNewLogger := newLogger
+	defer func() { newLogger = origNewLogger }()
+	var settings []logSettings
+	newLogger = func(s logSettings) *zap.Logger {
+		settings = append(settings, s)
+		return zap.NewNop()
+	}
 
-	actual := getLoggerAndPrintErrIfAny(nil, errors.New("simulated error"))
-	if actual == nil {
-		t.Fatal("expected a non-nil logger")
+	tmpFileConfig, cleanup := temporaryFile(t)
+	defer cleanup()
+	tmpFileFan, cleanup := temporaryFile(t)
+	defer cleanup()
+	tmpFileSensor, cleanup := temporaryFile(t)
+	defer cleanup()
+
+	validConfig := fmt.Sprintf(`
+    {
+      "heatsinks": [
+        {
+          "name":"heatsink/1",
+          "min_temp": 35,
+          "max_temp": 65,
+          "sensor_path_globs": [%q],
+          "fan": {"path_glob": %q}
+        }
+      ],
+      "logging": {"level": "debug", "format": "console"}
+    }`,
+		tmpFileSensor.Name(), tmpFileFan.Name(),
+	)
+	if _, err := tmpFileConfig.WriteString(validConfig); err != nil {
+		t.Fatal(err)
 	}
 
-	for deadline := time.After(1 * time.Second); ; {
-		select {
-		case <-deadline:
-			t.Fatal("timeout waiting for the expected log entry")
-		case err := <-streamErr:
-			t.Fatalf("reading stdout stream: %v", err)
-		case logLine := <-stdoutLines:
-			if strings.Contains(string(logLine), "error creating logger: simulated error") {
-				return // test passed
-			}
-		default:
-		}
+	os.Args = []string{"program-name", "-validate", "-log-level", "warn", "-config", tmpFileConfig.Name()}
+	if expected, actual := 0, execute(); actual != expected {
+		t.Fatalf("actual exit code doesn't match expected\nwant: %d\n got: %d", expected, actual)
+	}
+	expected := []logSettings{{Level: "warn"}, {Level: "warn", Format: "console"}}
+	if diff := deep.Equal(settings, expected); diff != nil {
+		t.Fatalf("unexpected logger settings: %v", diff)
+	}
+
+	os.Args = []string{"program-name", "-log-format", "yaml", tmpFileConfig.Name()}
+	if expected, actual := 64, execute(); actual != expected {
+		t.Fatalf("actual exit code doesn't match expected\nwant: %d\n got: %d", expected, actual)
+	}
+}
+
+func Test_execute_releasesFansOnError(t *testing.T) {
+
+	restoreProcArgs := backupProcArgs(t)
+	defer restoreProcArgs()
+
+	origNewLogger := newLogger
+	defer func() { newLogger = origNewLogger }()
+	newLogger = func(logSettings) *zap.Logger { return zap.NewNop() }
+
+	tmpFileConfig, cleanup := temporaryFile(t)
+	defer cleanup()
+	tmpFileFan, cleanup := temporaryFile(t)
+	defer cleanup()
+	tmpFileSensor, cleanup := temporaryFile(t)
+	defer cleanup()
+
+	// the control script is only rejected once the heatsinks were created
+	config := fmt.Sprintf(`
+    {
+      "heatsinks": [
+        {"name": "cpu", "max_temp": 65, "sensor_path_globs": [%q], "fan": {"path_glob": %q}}
+      ],
+      "control_script": {}
+    }`,
+		tmpFileSensor.Name(), tmpFileFan.Name(),
+	)
+	if _, err := tmpFileConfig.WriteString(config); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Args = []string{"program-name", tmpFileConfig.Name()}
+	if expected, actual := 78, execute(); actual != expected {
+		t.Fatalf("actual exit code doesn't match expected\nwant: %d\n got: %d", expected, actual)
+	}
+	pwm, err := ioutil.ReadFile(tmpFileFan.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual := strings.TrimSpace(string(pwm)); actual != "255" {
+		t.Fatalf("expected the fan to be closed at full speed, got: %q", actual)
 	}
 }
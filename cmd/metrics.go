@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/malkhamis/heatsink"
+	"go.uber.org/zap"
+)
+
+// serveMetrics starts an HTTP server on the given address that exposes the last sample of
+// each heatsink in the prometheus text exposition format under '/metrics', and the active
+// profile, which can be switched, under '/profile'. The returned function shuts the server down
+func serveMetrics(
+	addr string, heatsinks []*heatsink.Heatsink, profiles *profileSwitcher, logger *zap.Logger,
+) (stop func(), err error) {
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metricsHandler(heatsinks, logger))
+	mux.Handle("/healthz", livenessHandler(heatsinks, logger))
+	mux.Handle("/readyz", readinessHandler(heatsinks, logger))
+	mux.Handle("/profile", profileHandler(profiles, logger))
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			logger.Error("metrics server returned an error", zap.Error(err))
+		}
+	}()
+	logger.Info("serving metrics", zap.String("address", listener.Addr().String()))
+
+	stop = func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			logger.Warn("failed to shut down metrics server", zap.Error(err))
+		}
+	}
+	return stop, nil
+}
+
+// metricsHandler serves the last sample of the given heatsinks as prometheus metrics
+func metricsHandler(heatsinks []*heatsink.Heatsink, logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		if err := writeMetrics(w, heatsinks); err != nil {
+			logger.Warn("failed to write metrics", zap.Error(err))
+		}
+	})
+}
+
+// writeMetrics writes the last sample and the duty cycle histogram of the given heatsinks to w
+// in the prometheus text exposition format. Heatsinks that have not yet applied a duty cycle
+// are omitted
+func writeMetrics(w io.Writer, heatsinks []*heatsink.Heatsink) error {
+
+	samples := make([]heatsink.Sample, len(heatsinks))
+	for i, hs := range heatsinks {
+		samples[i] = hs.LastSample()
+	}
+
+	metrics := []struct {
+		name, help string
+		value      func(heatsink.Sample) float64
+	}{
+		{
+			"heatsink_temperature_celsius",
+			"Temperature the last duty cycle was derived from.",
+			func(s heatsink.Sample) float64 { return s.Temperature },
+		},
+		{
+			"heatsink_duty_cycle_ratio",
+			"Last duty cycle applied to the fan.",
+			func(s heatsink.Sample) float64 { return s.DutyCycle },
+		},
+		{
+			"heatsink_last_sample_timestamp_seconds",
+			"Unix time of the last applied duty cycle.",
+			func(s heatsink.Sample) float64 { return float64(s.Time.UnixNano()) / 1e9 },
+		},
+		{
+			"heatsink_iteration_duration_seconds",
+			"Time the last control iteration took to read sensors and write the fan.",
+			func(s heatsink.Sample) float64 {
+				return (s.Timings.SensorRead + s.Timings.Computation + s.Timings.FanWrite).Seconds()
+			},
+		},
+		{
+			"heatsink_iteration_lateness_seconds",
+			"Time the last control iteration started after it was due.",
+			func(s heatsink.Sample) float64 { return s.Timings.Lateness.Seconds() },
+		},
+	}
+
+	var sb strings.Builder
+	for _, m := range metrics {
+		fmt.Fprintf(&sb, "# HELP %s %s\n# TYPE %s gauge\n", m.name, m.help, m.name)
+		for i, hs := range heatsinks {
+			if samples[i].Time.IsZero() {
+				continue
+			}
+			fmt.Fprintf(
+				&sb, "%s{heatsink=%q,sensor=%q} %g\n",
+				m.name, hs.Name(), samples[i].Sensor, m.value(samples[i]),
+			)
+		}
+	}
+
+	name := "heatsink_iteration_overruns_total"
+	fmt.Fprintf(&sb, "# HELP %s Control iterations that took longer than the check period.\n# TYPE %s counter\n", name, name)
+	for i, hs := range heatsinks {
+		if samples[i].Time.IsZero() {
+			continue
+		}
+		fmt.Fprintf(&sb, "%s{heatsink=%q} %d\n", name, hs.Name(), hs.Overruns())
+	}
+
+	name = "heatsink_duty_cycle_seconds_total"
+	fmt.Fprintf(&sb, "# HELP %s Time the fan spent in each duty cycle band.\n# TYPE %s counter\n", name, name)
+	for _, hs := range heatsinks {
+		histogram := hs.DutyCycleHistogram()
+		if histogram.Total() == 0 {
+			continue
+		}
+		for band, d := range histogram {
+			fmt.Fprintf(
+				&sb, "%s{heatsink=%q,band=%q} %g\n", name, hs.Name(), dutyCycleBandLabel(band), d.Seconds(),
+			)
+		}
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/malkhamis/heatsink"
+	"go.uber.org/zap"
+)
+
+func Test_metricsHandler(t *testing.T) {
+
+	hs, cleanup := testHeatsink(t, "40000")
+	defer cleanup()
+
+	go hs.StartThermalControl()
+	defer hs.StopThermalControl()
+	for deadline := time.After(time.Second); hs.DutyCycleHistogram().Total() == 0; {
+		select {
+		case <-deadline:
+			t.Fatal("timeout waiting for a control iteration")
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	handler := metricsHandler([]*heatsink.Heatsink{hs}, zap.NewNop())
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	body := recorder.Body.String()
+	for _, expected := range []string{
+		"# TYPE heatsink_temperature_celsius gauge\n",
+		`heatsink_temperature_celsius{heatsink="Test_metricsHandler",sensor=`,
+		"} 40\n",
+		"# TYPE heatsink_duty_cycle_ratio gauge\n",
+		`heatsink_duty_cycle_ratio{heatsink="Test_metricsHandler",sensor=`,
+		"# TYPE heatsink_last_sample_timestamp_seconds gauge\n",
+		"# TYPE heatsink_iteration_duration_seconds gauge\n",
+		"# TYPE heatsink_iteration_lateness_seconds gauge\n",
+		`heatsink_iteration_overruns_total{heatsink="Test_metricsHandler"} `,
+		"# TYPE heatsink_duty_cycle_seconds_total counter\n",
+		`heatsink_duty_cycle_seconds_total{heatsink="Test_metricsHandler",band="0.0-0.1"} `,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected metrics to contain %q, got:\n%s", expected, body)
+		}
+	}
+}
+
+func Test_metricsHandler_noSamples(t *testing.T) {
+
+	hs, cleanup := testHeatsink(t, "40000")
+	defer cleanup()
+
+	var sb strings.Builder
+	if err := writeMetrics(&sb, []*heatsink.Heatsink{hs}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(sb.String(), "heatsink=") {
+		t.Errorf("expected no series for a heatsink that never ran, got:\n%s", sb.String())
+	}
+}
+
+func Test_serveMetrics(t *testing.T) {
+
+	stop, err := serveMetrics("127.0.0.1:0", nil, &profileSwitcher{}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop()
+
+	if _, err := serveMetrics("not an address", nil, &profileSwitcher{}, zap.NewNop()); err == nil {
+		t.Fatal("expected an error given an invalid address")
+	}
+}
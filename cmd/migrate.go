@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	"go.uber.org/zap"
+)
+
+// currentConfigVersion is the version of the config schema that this program understands.
+// Config files without a version are assumed to be of version 1
+const currentConfigVersion = 2
+
+var (
+	errConfigVersionBad    = errors.New("config version must be a positive integer")
+	errConfigVersionTooNew = errors.New("config version is newer than supported")
+)
+
+// migration upgrades a raw config of some version to the following version in place
+type migration func(raw map[string]interface{}) error
+
+// migrations maps a schema version to the migration that upgrades it to the next version
+var migrations = map[int]migration{
+	1: migrateV1toV2,
+}
+
+// migrateConfig upgrades the given raw config to the current version in place and returns
+// the version it was upgraded from
+func migrateConfig(raw map[string]interface{}) (fromVersion int, err error) {
+
+	fromVersion = 1
+	if v, ok := raw["version"]; ok {
+		num, isNum := v.(json.Number)
+		if !isNum {
+			return 0, fmt.Errorf("%w, got: %v", errConfigVersionBad, v)
+		}
+		parsed, err := strconv.Atoi(num.String())
+		if err != nil || parsed < 1 {
+			return 0, fmt.Errorf("%w, got: %v", errConfigVersionBad, v)
+		}
+		fromVersion = parsed
+	}
+	if fromVersion > currentConfigVersion {
+		return 0, fmt.Errorf(
+			"%w: got %d, supported up to %d", errConfigVersionTooNew, fromVersion, currentConfigVersion,
+		)
+	}
+
+	for v := fromVersion; v < currentConfigVersion; v++ {
+		if err := migrations[v](raw); err != nil {
+			return 0, fmt.Errorf("migrating config from version %d to %d: %w", v, v+1, err)
+		}
+	}
+	raw["version"] = json.Number(strconv.Itoa(currentConfigVersion))
+	return fromVersion, nil
+}
+
+// migrateV1toV2 moves the heatsink-level 'fan_response', which was never honored in version 1,
+// into 'fan.response_type' unless the latter is already set
+func migrateV1toV2(raw map[string]interface{}) error {
+	heatsinks, _ := raw["heatsinks"].([]interface{})
+	for _, hs := range heatsinks {
+		hsMap, ok := hs.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		resp, ok := hsMap["fan_response"]
+		if !ok {
+			continue
+		}
+		delete(hsMap, "fan_response")
+		fan, ok := hsMap["fan"].(map[string]interface{})
+		if !ok {
+			fan = make(map[string]interface{})
+			hsMap["fan"] = fan
+		}
+		if _, ok := fan["response_type"]; !ok {
+			fan["response_type"] = resp
+		}
+	}
+	return nil
+}
+
+// decodeMigrated decodes the given json data, upgrades it to the current config version, and
+// returns the upgraded json data
+func decodeMigrated(jsonData io.Reader) (migrated []byte, fromVersion int, err error) {
+
+	raw, fromVersion, err := decodeMigratedRaw(jsonData)
+	if err != nil {
+		return nil, 0, err
+	}
+	migrated, err = json.Marshal(raw)
+	return migrated, fromVersion, err
+}
+
+// decodeMigratedRaw decodes the given json data and upgrades it to the current config version
+func decodeMigratedRaw(jsonData io.Reader) (raw map[string]interface{}, fromVersion int, err error) {
+
+	dec := json.NewDecoder(jsonData)
+	dec.UseNumber()
+	if err := dec.Decode(&raw); err != nil {
+		return nil, 0, err
+	}
+	if raw == nil {
+		raw = make(map[string]interface{})
+	}
+
+	fromVersion, err = migrateConfig(raw)
+	if err != nil {
+		return nil, 0, err
+	}
+	return raw, fromVersion, nil
+}
+
+// runMigrate implements the 'migrate' subcommand, which upgrades a config file to the current
+// version and writes it to stdout or to the given output file
+func runMigrate(args []string, stdout io.Writer) (exitCode int) {
+
+	logger := newLogger(logSettings{})
+	defer logger.Sync()
+
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	output := flags.String("o", "", "output file (default: stdout)")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		logger.Error("invalid arguments", zap.String("usage", "migrate [-o <output>] <config>"))
+		return 64
+	}
+	filename := flags.Arg(0)
+
+	file, err := os.Open(filename)
+	if err != nil {
+		logger.Error("opening the given file", zap.Error(err))
+		return 66
+	}
+	defer file.Close()
+
+	migrated, fromVersion, err := decodeMigrated(file)
+	if err != nil {
+		logger.Error("migrating config", zap.Error(err), zap.String("filename", filename))
+		return 78
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, migrated, "", "  "); err != nil {
+		logger.Error("formatting migrated config", zap.Error(err))
+		return 70
+	}
+	indented.WriteByte('\n')
+
+	if *output == "" {
+		_, err = indented.WriteTo(stdout)
+	} else {
+		err = ioutil.WriteFile(*output, indented.Bytes(), 0644)
+	}
+	if err != nil {
+		logger.Error("writing migrated config", zap.Error(err))
+		return 73
+	}
+
+	logger.Info(
+		"migrated config",
+		zap.String("filename", filename),
+		zap.Int("from_version", fromVersion),
+		zap.Int("to_version", currentConfigVersion),
+	)
+	return 0
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+	"go.uber.org/zap"
+)
+
+func Test_newConfig_migratesLegacyFanResponse(t *testing.T) {
+	t.Parallel()
+
+	jsonData := strings.NewReader(`{"heatsinks":[
+		{"name":"hs1","fan_response":"linear"},
+		{"name":"hs2","fan_response":"linear","fan":{"response_type":"PowPi"}}
+	]}`)
+	cfg, err := newConfig(jsonData, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, actual := currentConfigVersion, cfg.Version; expected != actual {
+		t.Errorf("unexpected config version\nwant: %d\n got: %d", expected, actual)
+	}
+	if expected, actual := "linear", cfg.Heatsinks[0].Fan.RespType; expected != actual {
+		t.Errorf("expected legacy fan response to be migrated\nwant: %q\n got: %q", expected, actual)
+	}
+	if expected, actual := "PowPi", cfg.Heatsinks[1].Fan.RespType; expected != actual {
+		t.Errorf("expected explicit response type to be kept\nwant: %q\n got: %q", expected, actual)
+	}
+}
+
+func Test_migrateConfig_errors(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		inJson   string
+		expected error
+	}{
+		"too-new":    {inJson: `{"version": 99}`, expected: errConfigVersionTooNew},
+		"not-number": {inJson: `{"version": "2"}`, expected: errConfigVersionBad},
+		"fraction":   {inJson: `{"version": 1.5}`, expected: errConfigVersionBad},
+		"zero":       {inJson: `{"version": 0}`, expected: errConfigVersionBad},
+	}
+	for name, testCase := range cases {
+		testCase := testCase
+		t.Run(name, func(t *testing.T) {
+			_, err := newConfig(strings.NewReader(testCase.inJson), nil)
+			if !errors.Is(err, testCase.expected) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", testCase.expected, err)
+			}
+		})
+	}
+}
+
+func Test_runMigrate(t *testing.T) {
+
+	origNewLogger := newLogger
+	defer func() { newLogger = origNewLogger }()
+	newLogger = func(logSettings) *zap.Logger { return zap.NewNop() }
+
+	cfgFile, cleanup := temporaryFile(t)
+	defer cleanup()
+	if _, err := cfgFile.WriteString(`{"heatsinks":[{"fan_response":"linear","min_temp":30}]}`); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout bytes.Buffer
+	if expected, actual := 0, runMigrate([]string{cfgFile.Name()}, &stdout); expected != actual {
+		t.Fatalf("actual exit code doesn't match expected\nwant: %d\n got: %d", expected, actual)
+	}
+	var actual, expected interface{}
+	if err := json.Unmarshal(stdout.Bytes(), &actual); err != nil {
+		t.Fatal(err)
+	}
+	err := json.Unmarshal(
+		[]byte(`{"version":2,"heatsinks":[{"fan":{"response_type":"linear"},"min_temp":30}]}`),
+		&expected,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(expected, actual); diff != nil {
+		t.Fatal("actual migrated config does not match expected\n", strings.Join(diff, "\n"))
+	}
+
+	output := filepath.Join(filepath.Dir(cfgFile.Name()), filepath.Base(cfgFile.Name())+".migrated")
+	defer removeFile(t, output)
+	if code := runMigrate([]string{"-o", output, cfgFile.Name()}, nil); code != 0 {
+		t.Fatalf("expected exit code 0 migrating to an output file, got: %d", code)
+	}
+	written, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(written, stdout.Bytes()) {
+		t.Errorf("expected output file to match stdout\nwant: %s\n got: %s", stdout.Bytes(), written)
+	}
+
+	if expected, actual := 64, runMigrate(nil, nil); expected != actual {
+		t.Errorf("actual exit code doesn't match expected\nwant: %d\n got: %d", expected, actual)
+	}
+	if expected, actual := 66, runMigrate([]string{"/does/not/exist"}, nil); expected != actual {
+		t.Errorf("actual exit code doesn't match expected\nwant: %d\n got: %d", expected, actual)
+	}
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/malkhamis/heatsink"
+	"github.com/malkhamis/heatsink/alerts"
+	"github.com/malkhamis/heatsink/mqtt"
+	"go.uber.org/zap"
+)
+
+var (
+	errMQTTBroker = errors.New("mqtt config must have a broker")
+	errMQTTTLS    = errors.New("invalid mqtt tls config")
+)
+
+const (
+	defaultMQTTTopicPrefix = "heatsink"
+	defaultMQTTInterval    = 10 * time.Second
+)
+
+// configMQTT connects the daemon to an MQTT broker, e.g. to integrate it with Home Assistant.
+// The state of every heatsink is published periodically. If commands is true, the manual duty
+// cycle of every heatsink can be set through the broker. If hass_discovery is true, the
+// heatsinks are announced to Home Assistant under hass_discovery_prefix
+type configMQTT struct {
+	Broker      string         `json:"broker"`
+	ClientID    string         `json:"client_id,omitempty"`
+	Username    string         `json:"username,omitempty"`
+	Password    string         `json:"password,omitempty"`
+	TopicPrefix string         `json:"topic_prefix,omitempty"`
+	Interval    string         `json:"interval,omitempty"`
+	TLS         *configMQTTTLS `json:"tls,omitempty"`
+	Commands    bool           `json:"commands,omitempty"`
+	// HassDiscovery enables Home Assistant's MQTT discovery
+	HassDiscovery       bool   `json:"hass_discovery,omitempty"`
+	HassDiscoveryPrefix string `json:"hass_discovery_prefix,omitempty"`
+}
+
+// configMQTTTLS configures the TLS connection to the broker. If ca_file is empty, the system's
+// certificate authorities are used. The client certificate is optional
+type configMQTTTLS struct {
+	CAFile             string `json:"ca_file,omitempty"`
+	CertFile           string `json:"cert_file,omitempty"`
+	KeyFile            string `json:"key_file,omitempty"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"`
+}
+
+// tlsConfig loads the certificates referenced by this config
+func (c *configMQTTTLS) tlsConfig() (*tls.Config, error) {
+
+	if c == nil {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify}
+	if c.CAFile != "" {
+		pem, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errMQTTTLS, err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%w: no certificates in '%s'", errMQTTTLS, c.CAFile)
+		}
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errMQTTTLS, err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// mqttClient is the subset of the mqtt client used by the bridge
+type mqttClient interface {
+	Start()
+	Publish(topic string, payload []byte, retain bool) error
+	Subscribe(filter string, handler mqtt.Handler) error
+	Close() error
+}
+
+// mqttBridge publishes the state of the heatsinks to an MQTT broker and applies the manual
+// duty cycles that are published to their command topics
+type mqttBridge struct {
+	client   mqttClient
+	prefix   string
+	interval time.Duration
+	commands bool
+	targets  []mqttTarget
+	logger   *zap.Logger
+	// discoveryPrefix is the Home Assistant discovery prefix, or empty if discovery is disabled
+	discoveryPrefix string
+}
+
+// mqttTarget is a heatsink along with the topic level that identifies it
+type mqttTarget struct {
+	hs    *heatsink.Heatsink
+	level string
+}
+
+// mqttState is the payload of a heatsink's state topic
+type mqttState struct {
+	Sensor          string   `json:"sensor"`
+	Temperature     float64  `json:"temperature"`
+	DutyCycle       float64  `json:"duty_cycle"`
+	ManualDutyCycle *float64 `json:"manual_duty_cycle"`
+}
+
+// newMQTTBridge returns the mqtt bridge of this config, or nil if none is configured. The
+// client does not connect until the bridge is started
+func (c *config) newMQTTBridge(heatsinks []*heatsink.Heatsink) (*mqttBridge, error) {
+
+	if c.MQTT == nil {
+		return nil, nil
+	}
+	if c.MQTT.Broker == "" {
+		return nil, errMQTTBroker
+	}
+
+	interval := defaultMQTTInterval
+	if c.MQTT.Interval != "" {
+		parsed, err := time.ParseDuration(c.MQTT.Interval)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errBadDuration, err)
+		}
+		if parsed > 0 {
+			interval = parsed
+		}
+	}
+	prefix := strings.Trim(c.MQTT.TopicPrefix, "/")
+	if prefix == "" {
+		prefix = defaultMQTTTopicPrefix
+	}
+	tlsConfig, err := c.MQTT.TLS.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	bridge := &mqttBridge{
+		prefix:   prefix,
+		interval: interval,
+		commands: c.MQTT.Commands,
+		logger:   c.logger,
+	}
+	if c.MQTT.HassDiscovery {
+		bridge.discoveryPrefix = strings.Trim(c.MQTT.HassDiscoveryPrefix, "/")
+		if bridge.discoveryPrefix == "" {
+			bridge.discoveryPrefix = defaultHassDiscoveryPrefix
+		}
+	}
+	client, err := mqtt.New(
+		c.MQTT.Broker,
+		mqtt.OptClientID(c.MQTT.ClientID),
+		mqtt.OptCredentials(c.MQTT.Username, c.MQTT.Password),
+		mqtt.OptTLSConfig(tlsConfig),
+		mqtt.OptWill(bridge.statusTopic(), []byte("offline"), true),
+		mqtt.OptOnConnectionChange(bridge.onConnectionChange),
+	)
+	if err != nil {
+		return nil, err
+	}
+	bridge.client = client
+
+	for _, hs := range heatsinks {
+		bridge.targets = append(bridge.targets, mqttTarget{hs: hs, level: mqttTopicLevel(hs.Name())})
+	}
+	return bridge, nil
+}
+
+// mqttTopicLevel replaces the characters of the given name that have special meanings in
+// topics, so that it can be used as a single topic level
+func mqttTopicLevel(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '+', '#', ' ':
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+func (b *mqttBridge) statusTopic() string {
+	return b.prefix + "/status"
+}
+
+func (b *mqttBridge) alertsTopic() string {
+	return b.prefix + "/alerts"
+}
+
+func (b *mqttBridge) stateTopic(t mqttTarget) string {
+	return b.prefix + "/" + t.level + "/state"
+}
+
+func (b *mqttBridge) commandTopic(t mqttTarget) string {
+	return b.prefix + "/" + t.level + "/manual_duty_cycle/set"
+}
+
+// onConnectionChange marks the daemon as online whenever the client connects. Discovery
+// payloads are republished too, since the broker may have lost its retained messages
+func (b *mqttBridge) onConnectionChange(err error) {
+	if err != nil {
+		b.logger.Warn("mqtt connection failed", zap.Error(err))
+		return
+	}
+	b.logger.Info("connected to mqtt broker")
+	if b.discoveryPrefix != "" {
+		b.publishDiscovery()
+	}
+	if err := b.client.Publish(b.statusTopic(), []byte("online"), true); err != nil {
+		b.logger.Warn("publishing mqtt status", zap.Error(err))
+	}
+}
+
+// publish publishes the state of every heatsink that completed a control iteration
+func (b *mqttBridge) publish() {
+	for _, t := range b.targets {
+		smpl := t.hs.LastSample()
+		if smpl.Time.IsZero() {
+			continue
+		}
+		state := mqttState{Sensor: smpl.Sensor, Temperature: smpl.Temperature, DutyCycle: smpl.DutyCycle}
+		if dc, ok := t.hs.ManualDutyCycle(); ok {
+			state.ManualDutyCycle = &dc
+		}
+		payload, err := json.Marshal(state)
+		if err != nil {
+			b.logger.Warn("encoding mqtt state", zap.Error(err))
+			continue
+		}
+		if err := b.client.Publish(b.stateTopic(t), payload, true); err != nil && !errors.Is(err, mqtt.ErrNotConnected) {
+			b.logger.Warn("publishing mqtt state", zap.Error(err), zap.String("heatsink", t.hs.Name()))
+		}
+	}
+}
+
+// handleCommand sets the manual duty cycle of the given heatsink to the ratio in the payload.
+// An empty payload or "auto" returns control to the fan response curve
+func (b *mqttBridge) handleCommand(t mqttTarget, payload []byte) {
+
+	cmd := strings.TrimSpace(string(payload))
+	if cmd == "" || strings.EqualFold(cmd, "auto") {
+		t.hs.ClearManualDutyCycle()
+		b.logger.Info("manual duty cycle cleared over mqtt", zap.String("heatsink", t.hs.Name()))
+		return
+	}
+	dc, err := strconv.ParseFloat(cmd, 64)
+	if err != nil || dc < 0 || dc > 1 {
+		b.logger.Warn(
+			"ignoring invalid mqtt command, expected a ratio between 0 and 1 or 'auto'",
+			zap.String("heatsink", t.hs.Name()),
+			zap.String("payload", cmd),
+		)
+		return
+	}
+	t.hs.SetManualDutyCycle(dc)
+	b.logger.Info("manual duty cycle set over mqtt", zap.String("heatsink", t.hs.Name()), zap.Float64("duty-cycle", dc))
+}
+
+// start connects to the broker in the background and publishes the state of the heatsinks
+// periodically. The returned function marks the daemon as offline and disconnects
+func (b *mqttBridge) start() (stop func()) {
+
+	if b.commands {
+		for _, t := range b.targets {
+			t := t
+			err := b.client.Subscribe(b.commandTopic(t), func(_ string, payload []byte) {
+				b.handleCommand(t, payload)
+			})
+			if err != nil {
+				b.logger.Warn("subscribing to mqtt commands", zap.Error(err), zap.String("heatsink", t.hs.Name()))
+			}
+		}
+	}
+	b.client.Start()
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(b.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				b.publish()
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+		b.client.Publish(b.statusTopic(), []byte("offline"), true)
+		if err := b.client.Close(); err != nil {
+			b.logger.Warn("closing mqtt client", zap.Error(err))
+		}
+	}
+}
+
+// mqttAlerter publishes alerts as json to the alerts topic of a bridge
+type mqttAlerter struct {
+	bridge *mqttBridge
+}
+
+// alerter returns an alerter that publishes through this bridge while it is started
+func (b *mqttBridge) alerter() alerts.Alerter {
+	return mqttAlerter{bridge: b}
+}
+
+func (a mqttAlerter) Name() string {
+	return "mqtt"
+}
+
+func (a mqttAlerter) Alert(e alerts.Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return a.bridge.client.Publish(a.bridge.alertsTopic(), payload, false)
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/malkhamis/heatsink/alerts"
+	"github.com/malkhamis/heatsink/mqtt"
+	"go.uber.org/zap"
+)
+
+// fakeMQTTClient records what the bridge publishes and subscribes to
+type fakeMQTTClient struct {
+	mutex     sync.Mutex
+	published map[string]string
+	handlers  map[string]mqtt.Handler
+	started   bool
+	closed    bool
+}
+
+func newFakeMQTTClient() *fakeMQTTClient {
+	return &fakeMQTTClient{published: map[string]string{}, handlers: map[string]mqtt.Handler{}}
+}
+
+func (c *fakeMQTTClient) Start() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.started = true
+}
+
+func (c *fakeMQTTClient) Publish(topic string, payload []byte, retain bool) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.published[topic] = string(payload)
+	return nil
+}
+
+func (c *fakeMQTTClient) Subscribe(filter string, handler mqtt.Handler) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.handlers[filter] = handler
+	return nil
+}
+
+func (c *fakeMQTTClient) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.closed = true
+	return nil
+}
+
+func (c *fakeMQTTClient) lastPublished(topic string) string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.published[topic]
+}
+
+func Test_config_newMQTTBridge(t *testing.T) {
+
+	cfg := &config{logger: zap.NewNop()}
+	bridge, err := cfg.newMQTTBridge(nil)
+	if err != nil || bridge != nil {
+		t.Fatalf("expected no mqtt bridge without config, got: %v, %v", bridge, err)
+	}
+
+	cases := map[string]struct {
+		mqtt        configMQTT
+		expectedErr error
+	}{
+		"no broker": {mqtt: configMQTT{}, expectedErr: errMQTTBroker},
+		"bad url":   {mqtt: configMQTT{Broker: "http://x"}, expectedErr: mqtt.ErrBadBroker},
+		"interval":  {mqtt: configMQTT{Broker: "tcp://x", Interval: "x"}, expectedErr: errBadDuration},
+		"ca file":   {mqtt: configMQTT{Broker: "ssl://x", TLS: &configMQTTTLS{CAFile: "/non/existent"}}, expectedErr: errMQTTTLS},
+		"key pair":  {mqtt: configMQTT{Broker: "ssl://x", TLS: &configMQTTTLS{CertFile: "/non/existent"}}, expectedErr: errMQTTTLS},
+		"valid":     {mqtt: configMQTT{Broker: "tcp://x", TLS: &configMQTTTLS{InsecureSkipVerify: true}}},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			cfg.MQTT = &c.mqtt
+			_, err := cfg.newMQTTBridge(nil)
+			if !errors.Is(err, c.expectedErr) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", c.expectedErr, err)
+			}
+		})
+	}
+}
+
+func Test_mqttTopicLevel(t *testing.T) {
+	expected := "heatsink_cpu_fan____"
+	if actual := mqttTopicLevel("heatsink/cpu fan/+/#"); actual != expected {
+		t.Fatalf("unexpected topic level\nwant: %s\n got: %s", expected, actual)
+	}
+}
+
+func Test_mqttBridge_publish(t *testing.T) {
+
+	hs, cleanup := testHeatsink(t, "40000")
+	defer cleanup()
+	client := newFakeMQTTClient()
+	bridge := &mqttBridge{
+		client:  client,
+		prefix:  "home",
+		logger:  zap.NewNop(),
+		targets: []mqttTarget{{hs: hs, level: "hs"}},
+	}
+
+	bridge.publish()
+	if actual := client.lastPublished("home/hs/state"); actual != "" {
+		t.Fatalf("expected nothing to be published before the first sample, got: %s", actual)
+	}
+
+	go hs.StartThermalControl()
+	for deadline := time.After(time.Second); hs.LastSample().Time.IsZero(); {
+		select {
+		case <-deadline:
+			t.Fatal("timeout waiting for a control iteration")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	hs.StopThermalControl()
+	hs.SetManualDutyCycle(0.75)
+
+	bridge.publish()
+	var actual mqttState
+	if err := json.Unmarshal([]byte(client.lastPublished("home/hs/state")), &actual); err != nil {
+		t.Fatal(err)
+	}
+	smpl := hs.LastSample()
+	manual := 0.75
+	expected := mqttState{
+		Sensor:          smpl.Sensor,
+		Temperature:     smpl.Temperature,
+		DutyCycle:       smpl.DutyCycle,
+		ManualDutyCycle: &manual,
+	}
+	if diff := deep.Equal(actual, expected); diff != nil {
+		t.Fatal(diff)
+	}
+}
+
+func Test_mqttBridge_alerter(t *testing.T) {
+
+	client := newFakeMQTTClient()
+	bridge := &mqttBridge{client: client, prefix: "home", logger: zap.NewNop()}
+
+	e := alerts.Event{
+		Type:     alerts.SensorFailure,
+		Severity: alerts.SeverityWarning,
+		Heatsink: "cpu",
+		Subject:  "core0",
+		Message:  "sensor core0 of cpu failed to read",
+		Time:     time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	if err := bridge.alerter().Alert(e); err != nil {
+		t.Fatal(err)
+	}
+	var actual alerts.Event
+	if err := json.Unmarshal([]byte(client.lastPublished("home/alerts")), &actual); err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(actual, e); diff != nil {
+		t.Fatal(diff)
+	}
+}
+
+func Test_mqttBridge_commands(t *testing.T) {
+
+	hs, cleanup := testHeatsink(t, "40000")
+	defer cleanup()
+	client := newFakeMQTTClient()
+	bridge := &mqttBridge{
+		client:   client,
+		prefix:   "home",
+		interval: time.Hour,
+		commands: true,
+		logger:   zap.NewNop(),
+		targets:  []mqttTarget{{hs: hs, level: "hs"}},
+	}
+
+	stop := bridge.start()
+	handler := client.handlers["home/hs/manual_duty_cycle/set"]
+	if handler == nil || !client.started {
+		t.Fatal("expected the bridge to subscribe to the command topic and start the client")
+	}
+
+	cases := []struct {
+		payload    string
+		expectedDC float64
+		expectedOK bool
+	}{
+		{payload: "0.4", expectedDC: 0.4, expectedOK: true},
+		{payload: "1.5", expectedDC: 0.4, expectedOK: true},
+		{payload: "fast", expectedDC: 0.4, expectedOK: true},
+		{payload: " auto ", expectedOK: false},
+		{payload: "0", expectedDC: 0, expectedOK: true},
+		{payload: "", expectedOK: false},
+	}
+	for _, c := range cases {
+		handler("home/hs/manual_duty_cycle/set", []byte(c.payload))
+		dc, ok := hs.ManualDutyCycle()
+		if dc != c.expectedDC || ok != c.expectedOK {
+			t.Fatalf("payload %q: unexpected manual duty cycle\nwant: %v, %v\n got: %v, %v",
+				c.payload, c.expectedDC, c.expectedOK, dc, ok)
+		}
+	}
+
+	stop()
+	if actual := client.lastPublished("home/status"); actual != "offline" || !client.closed {
+		t.Fatalf("expected the daemon to be marked offline and the client closed, got: %q", actual)
+	}
+}
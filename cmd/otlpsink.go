@@ -0,0 +1,385 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/malkhamis/heatsink"
+	"go.uber.org/zap"
+)
+
+var (
+	errOTLPEndpoint = errors.New("otlp endpoint must be an 'http' or 'https' url")
+	errOTLPStatus   = errors.New("unexpected http status from otlp collector")
+)
+
+const (
+	defaultOTLPServiceName   = "heatsink"
+	defaultOTLPFlushInterval = 10 * time.Second
+	// maxOTLPSpans bounds the spans buffered between flushes, beyond which new spans are dropped
+	maxOTLPSpans = 4096
+	otlpTimeout  = 10 * time.Second
+	otlpScope    = "github.com/malkhamis/heatsink"
+)
+
+// configTelemetryOTLP exports the samples to an OpenTelemetry collector using OTLP over http
+// with json encoding. The latest temperatures and duty cycles are exported as gauges, along
+// with a counter of control iterations. If traces is true, every control iteration is also
+// exported as a span whose children are the sensor read, the duty cycle computation, and the
+// fan write
+type configTelemetryOTLP struct {
+	Endpoint      string            `json:"endpoint"`
+	Headers       map[string]string `json:"headers,omitempty"`
+	ServiceName   string            `json:"service_name,omitempty"`
+	FlushInterval string            `json:"flush_interval,omitempty"`
+	Traces        bool              `json:"traces,omitempty"`
+}
+
+func (c configTelemetryOTLP) newSink(logger *zap.Logger) (*otlpSink, error) {
+
+	u, err := url.Parse(c.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errOTLPEndpoint, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%w, got: '%s'", errOTLPEndpoint, c.Endpoint)
+	}
+	sink := &otlpSink{
+		endpoint:  strings.TrimSuffix(c.Endpoint, "/"),
+		headers:   c.Headers,
+		interval:  defaultOTLPFlushInterval,
+		traces:    c.Traces,
+		logger:    logger,
+		startTime: time.Now(),
+		latest:    map[string]otlpLatest{},
+		done:      make(chan struct{}),
+	}
+	serviceName := c.ServiceName
+	if serviceName == "" {
+		serviceName = defaultOTLPServiceName
+	}
+	sink.resource = otlpResource{Attributes: []otlpAttribute{otlpString("service.name", serviceName)}}
+	if c.FlushInterval != "" {
+		interval, err := time.ParseDuration(c.FlushInterval)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errBadDuration, err)
+		}
+		if interval > 0 {
+			sink.interval = interval
+		}
+	}
+
+	sink.wg.Add(1)
+	go sink.run()
+	return sink, nil
+}
+
+// The following types are the subset of the json encoding of OTLP used by the sink
+type (
+	otlpAttribute struct {
+		Key   string            `json:"key"`
+		Value map[string]string `json:"value"`
+	}
+	otlpResource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	}
+	otlpScopeInfo struct {
+		Name string `json:"name"`
+	}
+	otlpDataPoint struct {
+		Attributes        []otlpAttribute `json:"attributes"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano,omitempty"`
+		TimeUnixNano      string          `json:"timeUnixNano"`
+		AsDouble          *float64        `json:"asDouble,omitempty"`
+		AsInt             string          `json:"asInt,omitempty"`
+	}
+	otlpGauge struct {
+		DataPoints []otlpDataPoint `json:"dataPoints"`
+	}
+	otlpSum struct {
+		DataPoints             []otlpDataPoint `json:"dataPoints"`
+		AggregationTemporality int             `json:"aggregationTemporality"`
+		IsMonotonic            bool            `json:"isMonotonic"`
+	}
+	otlpMetric struct {
+		Name  string     `json:"name"`
+		Unit  string     `json:"unit,omitempty"`
+		Gauge *otlpGauge `json:"gauge,omitempty"`
+		Sum   *otlpSum   `json:"sum,omitempty"`
+	}
+	otlpSpan struct {
+		TraceID           string          `json:"traceId"`
+		SpanID            string          `json:"spanId"`
+		ParentSpanID      string          `json:"parentSpanId,omitempty"`
+		Name              string          `json:"name"`
+		Kind              int             `json:"kind"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+		Attributes        []otlpAttribute `json:"attributes"`
+	}
+)
+
+// otlpAggregationCumulative and otlpSpanKindInternal are enum values of the OTLP schema
+const (
+	otlpAggregationCumulative = 2
+	otlpSpanKindInternal      = 1
+)
+
+func otlpString(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: map[string]string{"stringValue": value}}
+}
+
+func otlpTime(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// otlpLatest is the most recent sample of a heatsink and the number of samples so far
+type otlpLatest struct {
+	smpl  heatsink.Sample
+	count int64
+}
+
+// otlpSink keeps the latest sample of every heatsink and the pending spans, and exports them
+// to the collector in the background
+type otlpSink struct {
+	endpoint  string
+	headers   map[string]string
+	interval  time.Duration
+	traces    bool
+	resource  otlpResource
+	logger    *zap.Logger
+	startTime time.Time
+
+	mutex   sync.Mutex
+	latest  map[string]otlpLatest
+	spans   []otlpSpan
+	dropped int
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func (s *otlpSink) write(hsName string, smpl heatsink.Sample) {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	latest := s.latest[hsName]
+	s.latest[hsName] = otlpLatest{smpl: smpl, count: latest.count + 1}
+	if !s.traces || smpl.Timings.Start.IsZero() {
+		return
+	}
+	if len(s.spans)+4 > maxOTLPSpans {
+		s.dropped++
+		return
+	}
+	s.spans = append(s.spans, iterationSpans(hsName, smpl)...)
+}
+
+// iterationSpans returns the span of a control iteration followed by the spans of its phases
+func iterationSpans(hsName string, smpl heatsink.Sample) []otlpSpan {
+
+	traceID, rootID := otlpID(16), otlpID(8)
+	timings := smpl.Timings
+	attrs := []otlpAttribute{otlpString("heatsink", hsName)}
+	root := otlpSpan{
+		TraceID:           traceID,
+		SpanID:            rootID,
+		Name:              "control_iteration",
+		Kind:              otlpSpanKindInternal,
+		StartTimeUnixNano: otlpTime(timings.Start),
+		EndTimeUnixNano:   otlpTime(smpl.Time),
+		Attributes: append(attrs,
+			otlpString("sensor", smpl.Sensor),
+			otlpString("temperature", strconv.FormatFloat(smpl.Temperature, 'f', -1, 64)),
+			otlpString("duty_cycle", strconv.FormatFloat(smpl.DutyCycle, 'f', -1, 64)),
+		),
+	}
+
+	spans := []otlpSpan{root}
+	start := timings.Start
+	for _, phase := range []struct {
+		name     string
+		duration time.Duration
+	}{
+		{"sensor_read", timings.SensorRead},
+		{"duty_cycle_computation", timings.Computation},
+		{"fan_write", timings.FanWrite},
+	} {
+		end := start.Add(phase.duration)
+		spans = append(spans, otlpSpan{
+			TraceID:           traceID,
+			SpanID:            otlpID(8),
+			ParentSpanID:      rootID,
+			Name:              phase.name,
+			Kind:              otlpSpanKindInternal,
+			StartTimeUnixNano: otlpTime(start),
+			EndTimeUnixNano:   otlpTime(end),
+			Attributes:        attrs,
+		})
+		start = end
+	}
+	return spans
+}
+
+// otlpID returns a random hex-encoded identifier of the given number of bytes
+func otlpID(size int) string {
+	id := make([]byte, size)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// metrics returns the metrics of the latest samples, sorted by heatsink name
+func (s *otlpSink) metrics(latest map[string]otlpLatest) []otlpMetric {
+
+	names := make([]string, 0, len(latest))
+	for name := range latest {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	temperature := &otlpGauge{}
+	dutyCycle := &otlpGauge{}
+	sensors := &otlpGauge{}
+	iterations := &otlpSum{AggregationTemporality: otlpAggregationCumulative, IsMonotonic: true}
+	for _, name := range names {
+		l := latest[name]
+		attrs := []otlpAttribute{otlpString("heatsink", name)}
+		ts := otlpTime(l.smpl.Time)
+		temp, dc := l.smpl.Temperature, l.smpl.DutyCycle
+		temperature.DataPoints = append(temperature.DataPoints, otlpDataPoint{Attributes: attrs, TimeUnixNano: ts, AsDouble: &temp})
+		dutyCycle.DataPoints = append(dutyCycle.DataPoints, otlpDataPoint{Attributes: attrs, TimeUnixNano: ts, AsDouble: &dc})
+		for _, r := range l.smpl.Readings {
+			temp := r.Temperature
+			sensors.DataPoints = append(sensors.DataPoints, otlpDataPoint{
+				Attributes:   append(attrs, otlpString("sensor", r.Sensor)),
+				TimeUnixNano: ts,
+				AsDouble:     &temp,
+			})
+		}
+		iterations.DataPoints = append(iterations.DataPoints, otlpDataPoint{
+			Attributes:        attrs,
+			StartTimeUnixNano: otlpTime(s.startTime),
+			TimeUnixNano:      ts,
+			AsInt:             strconv.FormatInt(l.count, 10),
+		})
+	}
+
+	metrics := []otlpMetric{
+		{Name: "heatsink.temperature", Unit: "Cel", Gauge: temperature},
+		{Name: "heatsink.duty_cycle", Unit: "1", Gauge: dutyCycle},
+		{Name: "heatsink.iterations", Unit: "1", Sum: iterations},
+	}
+	if len(sensors.DataPoints) > 0 {
+		metrics = append(metrics, otlpMetric{Name: "heatsink.sensor.temperature", Unit: "Cel", Gauge: sensors})
+	}
+	return metrics
+}
+
+// flush exports the latest metrics and the pending spans. Spans that fail to be exported are
+// dropped
+func (s *otlpSink) flush() error {
+
+	s.mutex.Lock()
+	latest := make(map[string]otlpLatest, len(s.latest))
+	for name, l := range s.latest {
+		latest[name] = l
+	}
+	spans, dropped := s.spans, s.dropped
+	s.spans, s.dropped = nil, 0
+	s.mutex.Unlock()
+
+	if dropped > 0 {
+		s.logger.Warn("dropped otlp spans since the buffer is full", zap.Int("iterations", dropped))
+	}
+	if len(latest) == 0 {
+		return nil
+	}
+
+	scope := otlpScopeInfo{Name: otlpScope}
+	err := s.post("/v1/metrics", map[string]interface{}{
+		"resourceMetrics": []interface{}{map[string]interface{}{
+			"resource":     s.resource,
+			"scopeMetrics": []interface{}{map[string]interface{}{"scope": scope, "metrics": s.metrics(latest)}},
+		}},
+	})
+	if err != nil || len(spans) == 0 {
+		return err
+	}
+	return s.post("/v1/traces", map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource":   s.resource,
+			"scopeSpans": []interface{}{map[string]interface{}{"scope": scope, "spans": spans}},
+		}},
+	})
+}
+
+// post sends the given payload as json to the given path of the collector
+func (s *otlpSink) post(path string, payload interface{}) error {
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), otlpTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range s.headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%w: %s: %s", errOTLPStatus, resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+func (s *otlpSink) run() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+		if err := s.flush(); err != nil {
+			s.logger.Warn("failed to export telemetry to otlp collector", zap.Error(err))
+		}
+	}
+}
+
+// close stops exporting periodically and exports the remaining telemetry
+func (s *otlpSink) close() error {
+	select {
+	case <-s.done:
+		return nil
+	default:
+		close(s.done)
+	}
+	s.wg.Wait()
+	return s.flush()
+}
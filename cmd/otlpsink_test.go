@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/malkhamis/heatsink"
+	"go.uber.org/zap"
+)
+
+func Test_configTelemetryOTLP_newSink_errors(t *testing.T) {
+
+	cases := map[string]struct {
+		cfg         configTelemetryOTLP
+		expectedErr error
+	}{
+		"url":      {cfg: configTelemetryOTLP{Endpoint: "%zz"}, expectedErr: errOTLPEndpoint},
+		"scheme":   {cfg: configTelemetryOTLP{Endpoint: "grpc://localhost:4317"}, expectedErr: errOTLPEndpoint},
+		"host":     {cfg: configTelemetryOTLP{Endpoint: "http://"}, expectedErr: errOTLPEndpoint},
+		"interval": {cfg: configTelemetryOTLP{Endpoint: "http://x", FlushInterval: "x"}, expectedErr: errBadDuration},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			_, err := c.cfg.newSink(zap.NewNop())
+			if !errors.Is(err, c.expectedErr) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", c.expectedErr, err)
+			}
+		})
+	}
+}
+
+func Test_otlpSink(t *testing.T) {
+
+	var mutex sync.Mutex
+	payloads := map[string]map[string]interface{}{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var payload map[string]interface{}
+		if err := json.Unmarshal(body, &payload); err != nil || r.Header.Get("X-Token") != "secret" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		mutex.Lock()
+		payloads[r.URL.Path] = payload
+		mutex.Unlock()
+	}))
+	defer server.Close()
+
+	sink, err := configTelemetryOTLP{
+		Endpoint:      server.URL + "/",
+		Headers:       map[string]string{"X-Token": "secret"},
+		FlushInterval: "1h",
+		Traces:        true,
+	}.newSink(zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Unix(100, 0)
+	smpl := heatsink.Sample{
+		Time:        start.Add(time.Millisecond),
+		Sensor:      "core0",
+		Temperature: 40,
+		DutyCycle:   0.5,
+		Readings:    []heatsink.Reading{{Sensor: "core0", Temperature: 40}},
+		Timings:     heatsink.Timings{Start: start, SensorRead: 300, Computation: 200, FanWrite: 100},
+	}
+	sink.write("hs", smpl)
+	sink.write("hs", smpl)
+	if err := sink.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var metrics struct {
+		ResourceMetrics []struct {
+			ScopeMetrics []struct {
+				Metrics []otlpMetric `json:"metrics"`
+			} `json:"scopeMetrics"`
+		} `json:"resourceMetrics"`
+	}
+	remarshal(t, payloads["/v1/metrics"], &metrics)
+	var names []string
+	var iterations string
+	for _, m := range metrics.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		names = append(names, m.Name)
+		if m.Sum != nil {
+			iterations = m.Sum.DataPoints[0].AsInt
+		}
+	}
+	expectedNames := []string{
+		"heatsink.temperature", "heatsink.duty_cycle", "heatsink.iterations", "heatsink.sensor.temperature",
+	}
+	if diff := deep.Equal(names, expectedNames); diff != nil {
+		t.Fatal(diff)
+	}
+	if iterations != "2" {
+		t.Fatalf("expected 2 iterations, got: %s", iterations)
+	}
+
+	var traces struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []otlpSpan `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	remarshal(t, payloads["/v1/traces"], &traces)
+	spans := traces.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 8 {
+		t.Fatalf("expected 4 spans per iteration, got: %d", len(spans))
+	}
+	var actual [][]string
+	for _, span := range spans[:4] {
+		if span.TraceID != spans[0].TraceID {
+			t.Fatal("expected the spans of an iteration to share a trace")
+		}
+		isChild := span.ParentSpanID == spans[0].SpanID
+		actual = append(actual, []string{span.Name, span.StartTimeUnixNano, span.EndTimeUnixNano, strconv.FormatBool(isChild)})
+	}
+	expected := [][]string{
+		{"control_iteration", "100000000000", "100001000000", "false"},
+		{"sensor_read", "100000000000", "100000000300", "true"},
+		{"duty_cycle_computation", "100000000300", "100000000500", "true"},
+		{"fan_write", "100000000500", "100000000600", "true"},
+	}
+	if diff := deep.Equal(actual, expected); diff != nil {
+		t.Fatal(diff)
+	}
+}
+
+func Test_otlpSink_error(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	sink, err := configTelemetryOTLP{Endpoint: server.URL}.newSink(zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.flush(); err != nil {
+		t.Fatalf("expected nothing to be exported before the first sample, got: %v", err)
+	}
+	sink.write("hs", heatsink.Sample{})
+	if err := sink.close(); !errors.Is(err, errOTLPStatus) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", errOTLPStatus, err)
+	}
+}
+
+// remarshal converts the given decoded json into the given target
+func remarshal(t *testing.T, decoded interface{}, target interface{}) {
+	t.Helper()
+	data, err := json.Marshal(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, target); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// access to a device file that the daemon needs
+const (
+	accessRead  = "read"
+	accessWrite = "write"
+)
+
+// defaultDeviceGroup is the group suggested to own device files that are owned by root
+const defaultDeviceGroup = "heatsink"
+
+// hwmonDir matches the directory of an hwmon device, e.g. /sys/class/hwmon/hwmon2
+var hwmonDir = regexp.MustCompile(`^hwmon[0-9]+$`)
+
+// permissionError is returned in place of a bare *os.PathError when a device file cannot be
+// opened for lack of permission. It describes the file and how to grant the daemon access
+type permissionError struct {
+	Path     string
+	Access   string
+	Owner    string
+	Group    string
+	Mode     os.FileMode
+	Remedies []string
+	Err      error
+}
+
+// Error describes the file and the remedies
+func (e *permissionError) Error() string {
+	msg := fmt.Sprintf("permission denied to %s '%s'", e.Access, e.Path)
+	if e.Owner != "" {
+		msg += fmt.Sprintf(" (owner: %s, group: %s, mode: %s)", e.Owner, e.Group, e.Mode)
+	}
+	if len(e.Remedies) > 0 {
+		msg += "; to fix it, " + strings.Join(e.Remedies, "; or ")
+	}
+	return msg
+}
+
+// Unwrap returns the error of opening the file
+func (e *permissionError) Unwrap() error {
+	return e.Err
+}
+
+// diagnosePermission returns a *permissionError in place of the given error if it is a
+// permission error of a file the daemon needs the given access to. Other errors are returned
+// as they are
+func diagnosePermission(err error, access string) error {
+
+	var pathErr *os.PathError
+	if !errors.Is(err, os.ErrPermission) || !errors.As(err, &pathErr) {
+		return err
+	}
+	diagnosis := &permissionError{Path: pathErr.Path, Access: access, Err: err}
+
+	info, statErr := os.Stat(pathErr.Path)
+	if statErr == nil {
+		diagnosis.Mode = info.Mode().Perm()
+		if uid, gid, ok := fileOwner(info); ok {
+			diagnosis.Owner, diagnosis.Group = userName(uid), groupName(gid)
+		}
+	}
+	diagnosis.Remedies = diagnosis.remedies()
+	return diagnosis
+}
+
+// remedies returns the ways to grant the daemon access to the file, from the least privileged
+func (e *permissionError) remedies() []string {
+
+	var remedies []string
+	groupBit := os.FileMode(0040)
+	if e.Access == accessWrite {
+		groupBit = 0020
+	}
+	if e.Group != "" && e.Group != "root" && e.Mode&groupBit != 0 {
+		name := "<user>"
+		if u, err := user.Current(); err == nil {
+			name = u.Username
+		}
+		remedies = append(remedies, fmt.Sprintf(
+			"add the user '%s' to the group '%s', e.g. usermod -aG %s %s", name, e.Group, e.Group, name,
+		))
+	}
+	if rule, ok := udevRule(e.Path, e.Group, e.Access); ok {
+		remedies = append(remedies, "add a udev rule, e.g. to /etc/udev/rules.d/90-heatsink.rules: "+rule)
+	}
+	return append(remedies,
+		"grant the daemon CAP_DAC_OVERRIDE, e.g. with AmbientCapabilities=CAP_DAC_OVERRIDE in its systemd unit, or run it as root",
+	)
+}
+
+// udevRule returns a udev rule that grants the given group the given access to the given file
+// of an hwmon device whenever the device is added, and whether the file is one. If the group
+// is empty or root, the rule grants access to defaultDeviceGroup
+func udevRule(path, group, access string) (string, bool) {
+
+	dir, file := filepath.Split(filepath.Clean(path))
+	if !hwmonDir.MatchString(filepath.Base(dir)) {
+		return "", false
+	}
+	if group == "" || group == "root" {
+		group = defaultDeviceGroup
+	}
+	device := hwmonDevice{chip: hwmonChip(dir)}
+	device.add(file, access)
+	return device.rule(group), true
+}
+
+// userName returns the name of the user with the given id, or the id if it is unknown
+func userName(uid string) string {
+	if u, err := user.LookupId(uid); err == nil {
+		return u.Username
+	}
+	return uid
+}
+
+// groupName returns the name of the group with the given id, or the id if it is unknown
+func groupName(gid string) string {
+	if g, err := user.LookupGroupId(gid); err == nil {
+		return g.Name
+	}
+	return gid
+}
+
+// checkAccess opens the given file with the given access and closes it right away. If the
+// daemon lacks permission, it returns a *permissionError
+func checkAccess(path, access string) error {
+	flag := os.O_RDONLY
+	if access == accessWrite {
+		flag = os.O_WRONLY
+	}
+	file, err := os.OpenFile(path, flag, 0)
+	if err != nil {
+		return diagnosePermission(err, access)
+	}
+	return file.Close()
+}
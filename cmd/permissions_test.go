@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func Test_diagnosePermission(t *testing.T) {
+
+	file, cleanup := temporaryFile(t)
+	defer cleanup()
+	if err := os.Chmod(file.Name(), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	openErr := &os.PathError{Op: "open", Path: file.Name(), Err: os.ErrPermission}
+	err := diagnosePermission(openErr, accessWrite)
+	var permErr *permissionError
+	if !errors.As(err, &permErr) {
+		t.Fatalf("expected a permission error, got: %v", err)
+	}
+	if !errors.Is(err, os.ErrPermission) {
+		t.Errorf("expected the error to wrap the open error, got: %v", err)
+	}
+	if permErr.Path != file.Name() || permErr.Access != accessWrite || permErr.Mode != 0640 || permErr.Owner == "" || permErr.Group == "" {
+		t.Errorf("unexpected diagnosis: %+v", permErr)
+	}
+	last := permErr.Remedies[len(permErr.Remedies)-1]
+	if !strings.Contains(last, "CAP_DAC_OVERRIDE") || !strings.Contains(err.Error(), last) {
+		t.Errorf("expected the capability as the last remedy in the error, got: %v", err)
+	}
+
+	otherErr := &os.PathError{Op: "open", Path: file.Name(), Err: os.ErrNotExist}
+	if err := diagnosePermission(otherErr, accessRead); err != otherErr {
+		t.Errorf("expected other errors to be returned as they are, got: %v", err)
+	}
+}
+
+func Test_permissionError_remedies(t *testing.T) {
+
+	testCases := []struct {
+		name     string
+		err      permissionError
+		expected []string
+	}{
+		{
+			name:     "group may write",
+			err:      permissionError{Path: "/sys/class/hwmon/hwmon2/pwm1", Access: accessWrite, Group: "fans", Mode: 0664},
+			expected: []string{"to the group 'fans'", `RUN+="/bin/chgrp fans /sys%p/pwm1", RUN+="/bin/chmod g+w /sys%p/pwm1"`, "CAP_DAC_OVERRIDE"},
+		},
+		{
+			name:     "owned by root",
+			err:      permissionError{Path: "/sys/class/hwmon/hwmon2/temp1_input", Access: accessRead, Group: "root", Mode: 0600},
+			expected: []string{`RUN+="/bin/chgrp heatsink /sys%p/temp1_input", RUN+="/bin/chmod g+r /sys%p/temp1_input"`, "CAP_DAC_OVERRIDE"},
+		},
+		{
+			name:     "group may not write",
+			err:      permissionError{Path: "/dev/fan", Access: accessWrite, Group: "fans", Mode: 0644},
+			expected: []string{"CAP_DAC_OVERRIDE"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			remedies := tc.err.remedies()
+			if len(remedies) != len(tc.expected) {
+				t.Fatalf("unexpected remedies\nwant: %q\n got: %q", tc.expected, remedies)
+			}
+			for i, expected := range tc.expected {
+				if !strings.Contains(remedies[i], expected) {
+					t.Errorf("expected remedy %d to contain %q, got: %s", i, expected, remedies[i])
+				}
+			}
+		})
+	}
+}
+
+func Test_checkAccess(t *testing.T) {
+
+	file, cleanup := temporaryFile(t)
+	defer cleanup()
+	for _, access := range []string{accessRead, accessWrite} {
+		if err := checkAccess(file.Name(), access); err != nil {
+			t.Errorf("access '%s': %v", access, err)
+		}
+	}
+	if err := checkAccess(file.Name()+".missing", accessRead); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("unexpected error\nwant: %v\n got: %v", os.ErrNotExist, err)
+	}
+}
@@ -0,0 +1,8 @@
+package main
+
+import "os"
+
+// fileOwner is unknown on windows, where files have no owning user and group ids
+func fileOwner(os.FileInfo) (uid, gid string, ok bool) {
+	return "", "", false
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/malkhamis/heatsink"
+	"github.com/malkhamis/heatsink/execplugin"
+	"go.uber.org/zap"
+)
+
+// pluginPrefix marks path globs that address a device of a plugin instead of a file, e.g.
+// 'plugin:hub/fan0' for the device 'fan0' of the plugin 'hub'
+const pluginPrefix = "plugin:"
+
+var (
+	errBadPlugin     = errors.New("invalid plugin")
+	errPluginUnknown = errors.New("unknown plugin")
+)
+
+// configPlugin is a program of a third party that provides fans and sensors the daemon has no
+// support for. It is run once for all of its devices, which fans and named sensors address as
+// 'plugin:<name>/<device>', and speaks JSON-RPC over its standard input and output, as
+// documented by package execplugin. The program runs with only the given environment
+// variables and is killed if it does not answer a request within the timeout
+type configPlugin struct {
+	Name    string   `json:"name"`
+	Command []string `json:"command"`
+	Env     []string `json:"env,omitempty"`
+	// Timeout is a duration, or a number of seconds
+	Timeout configDuration `json:"timeout,omitempty"`
+}
+
+// pluginSet holds the plugins of the config by name
+type pluginSet map[string]*execplugin.Plugin
+
+// pluginAddress returns the plugin and the device that the given path glob addresses, if any
+func pluginAddress(pattern string) (plugin, device string, ok bool) {
+	if !strings.HasPrefix(pattern, pluginPrefix) {
+		return "", "", false
+	}
+	address := strings.TrimPrefix(pattern, pluginPrefix)
+	if i := strings.Index(address, "/"); i >= 0 {
+		return address[:i], address[i+1:], true
+	}
+	return address, "", true
+}
+
+// newPlugins returns the given plugins, none of which is started until one of its devices is
+// used
+func newPlugins(configs []configPlugin) (pluginSet, error) {
+
+	plugins := make(pluginSet, len(configs))
+	for _, c := range configs {
+		if c.Name == "" || strings.Contains(c.Name, "/") {
+			return nil, fmt.Errorf("%w: name '%s' is empty or has a '/'", errBadPlugin, c.Name)
+		}
+		if _, ok := plugins[c.Name]; ok {
+			return nil, fmt.Errorf("%w: name '%s' is taken", errBadPlugin, c.Name)
+		}
+		timeout, err := c.Timeout.duration("timeout", time.Second)
+		if err != nil {
+			return nil, fmt.Errorf("plugin '%s': %w", c.Name, err)
+		}
+		options := []execplugin.Option{execplugin.OptEnv(c.Env), execplugin.OptStderr(os.Stderr)}
+		if timeout != 0 {
+			options = append(options, execplugin.OptTimeout(timeout))
+		}
+		plugin, err := execplugin.New(c.Name, c.Command, options...)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errBadPlugin, err)
+		}
+		plugins[c.Name] = plugin
+	}
+	return plugins, nil
+}
+
+// lookup returns the plugin of the given address
+func (ps pluginSet) lookup(pattern string) (*execplugin.Plugin, string, error) {
+	name, device, _ := pluginAddress(pattern)
+	plugin, ok := ps[name]
+	if !ok {
+		return nil, "", fmt.Errorf("'%s': %w: '%s'", pattern, errPluginUnknown, name)
+	}
+	if device == "" {
+		return nil, "", fmt.Errorf("'%s': %w: no device", pattern, errBadPlugin)
+	}
+	return plugin, device, nil
+}
+
+func (ps pluginSet) newSensor(pattern, name string, logger *zap.Logger) (heatsink.ThermoSensor, error) {
+
+	plugin, device, err := ps.lookup(pattern)
+	if err != nil {
+		return nil, err
+	}
+	sensor, err := plugin.NewSensor(device, name)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info(
+		"created plugin sensor",
+		zap.String("name", sensor.Name()),
+		zap.String("plugin", plugin.Name()),
+		zap.String("device", device),
+	)
+	return sensor, nil
+}
+
+func (c configFan) newPluginFan(logger *zap.Logger) (heatsink.FanDriver, error) {
+
+	plugin, device, err := c.plugins.lookup(c.PathGlob)
+	if err != nil {
+		return nil, err
+	}
+	if c.dryRun {
+		logger.Info("created dry-run fan", zap.String("name", c.Name), zap.String("filename", c.PathGlob))
+		return newDryRunFan(c.Name, c.PathGlob, logger), nil
+	}
+	fan, err := plugin.NewFan(device, c.Name)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info(
+		"created plugin fan",
+		zap.String("name", fan.Name()),
+		zap.String("plugin", plugin.Name()),
+		zap.String("device", device),
+		zap.String("response_type", c.RespType),
+	)
+	return fan, nil
+}
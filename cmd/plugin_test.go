@@ -0,0 +1,229 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// fakePluginScript answers every request of a plugin with a temperature of 40, which is what
+// the result of 'temperature' holds and is ignored otherwise
+const fakePluginScript = `while read -r line; do
+  id=$(echo "$line" | sed 's/.*"id":\([0-9]*\).*/\1/')
+  echo "{\"jsonrpc\": \"2.0\", \"id\": $id, \"result\": {\"temperature\": 40}}"
+done`
+
+// loggingPluginScript answers like fakePluginScript and appends the method and device of every
+// request to the file named by LOG
+const loggingPluginScript = `while read -r line; do
+  echo "$line" | sed 's/.*"method":"\([a-z_]*\)".*"device":"\([a-z0-9]*\)".*/\1 \2/' >> "$LOG"
+  id=$(echo "$line" | sed 's/.*"id":\([0-9]*\).*/\1/')
+  echo "{\"jsonrpc\": \"2.0\", \"id\": $id, \"result\": {\"temperature\": 40}}"
+done`
+
+func Test_pluginAddress(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		plugin, device string
+		ok             bool
+	}{
+		"plugin:hub/fan0":  {plugin: "hub", device: "fan0", ok: true},
+		"plugin:hub/a/b":   {plugin: "hub", device: "a/b", ok: true},
+		"plugin:hub":       {plugin: "hub", ok: true},
+		"/sys/class/hwmon": {},
+	}
+	for pattern, c := range cases {
+		plugin, device, ok := pluginAddress(pattern)
+		if plugin != c.plugin || device != c.device || ok != c.ok {
+			t.Errorf("'%s': unexpected address: %q, %q, %v", pattern, plugin, device, ok)
+		}
+	}
+}
+
+func Test_newPlugins_errors(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		plugins string
+		wantErr error
+	}{
+		"valid":       {plugins: `[{"name": "hub", "command": ["hub-plugin"], "timeout": "500ms"}]`},
+		"no-name":     {plugins: `[{"command": ["hub-plugin"]}]`, wantErr: errBadPlugin},
+		"slash":       {plugins: `[{"name": "a/b", "command": ["hub-plugin"]}]`, wantErr: errBadPlugin},
+		"name-taken":  {plugins: `[{"name": "hub", "command": ["a"]}, {"name": "hub", "command": ["b"]}]`, wantErr: errBadPlugin},
+		"no-command":  {plugins: `[{"name": "hub"}]`, wantErr: errBadPlugin},
+		"bad-timeout": {plugins: `[{"name": "hub", "command": ["hub-plugin"], "timeout": "soon"}]`, wantErr: errBadDuration},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			jsonData := strings.NewReader(fmt.Sprintf(
+				`{"heatsinks": [{"name": "cpu", "max_temp": 50}], "plugins": %s}`, c.plugins,
+			))
+			_, err := newConfig(jsonData, nil)
+			if !errors.Is(err, c.wantErr) {
+				t.Errorf("unexpected error\nwant: %v\n got: %v", c.wantErr, err)
+			}
+		})
+	}
+}
+
+func Test_config_newHeatsinks_plugin(t *testing.T) {
+	t.Parallel()
+
+	jsonData := strings.NewReader(fmt.Sprintf(`
+    {
+      "plugins": [{"name": "hub", "command": ["sh", "-c", %q], "timeout": 5}],
+      "sensors": [{"name": "probe", "path_glob": "plugin:hub/probe0"}],
+      "heatsinks": [
+        {"name": "case", "max_temp": 50, "fan": {"path_glob": "plugin:hub/fan0"}, "sensor_names": ["probe"]}
+      ]
+    }
+  `, fakePluginScript))
+
+	cfg, err := newConfig(jsonData, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	heatsinks, err := cfg.newHeatsinks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer heatsinks[0].StopThermalControl()
+
+	sensor, err := cfg.named.newSensor("probe", cfg.logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sensor.Close()
+	temp, err := sensor.Temperature()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if temp != 40 {
+		t.Errorf("unexpected temperature\nwant: 40\n got: %v", temp)
+	}
+}
+
+func Test_config_plugin_errors(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := newConfig(strings.NewReader(`
+    {
+      "plugins": [{"name": "hub", "command": ["hub-plugin"]}],
+      "sensors": [{"name": "gpu", "path_glob": "plugin:gpu/temp"}, {"name": "hub", "path_glob": "plugin:hub"}],
+      "heatsinks": [{"name": "cpu", "max_temp": 50}]
+    }
+  `), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cfg.named.newSensor("gpu", zap.NewNop()); !errors.Is(err, errPluginUnknown) {
+		t.Errorf("unexpected error\nwant: %v\n got: %v", errPluginUnknown, err)
+	}
+	if _, err := cfg.named.newSensor("hub", zap.NewNop()); !errors.Is(err, errBadPlugin) {
+		t.Errorf("unexpected error\nwant: %v\n got: %v", errBadPlugin, err)
+	}
+
+	fan := configFan{Name: "fan", PathGlob: "plugin:hub/fan0", Inverted: true, plugins: cfg.named.plugins}
+	if _, err := fan.newFan(zap.NewNop()); !errors.Is(err, errPwmOnlySetting) {
+		t.Errorf("unexpected error\nwant: %v\n got: %v", errPwmOnlySetting, err)
+	}
+	fan = configFan{Name: "fan", PathGlob: "plugin:hub/fan0", dryRun: true, plugins: cfg.named.plugins}
+	driver, err := fan.newFan(zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := driver.(*dryRunFan); !ok {
+		t.Errorf("expected a dry-run fan, got: %T", driver)
+	}
+}
+
+func Test_configHeatsink_newHeatsink_releasesDevicesOnError(t *testing.T) {
+	t.Parallel()
+
+	fanFile, cleanup := temporaryFile(t)
+	defer cleanup()
+	logFile, cleanup := temporaryFile(t)
+	defer cleanup()
+
+	jsonData := strings.NewReader(fmt.Sprintf(`
+    {
+      "plugins": [{"name": "hub", "command": ["sh", "-c", %q], "env": ["LOG=%s"], "timeout": 5}],
+      "sensors": [
+        {"name": "probe", "path_glob": "plugin:hub/probe0"},
+        {"name": "inlet", "path_glob": "plugin:hub/probe1"},
+        {"name": "room", "path_glob": "plugin:hub/probe2"}
+      ],
+      "heatsinks": [{
+        "name": "case", "max_temp": 50, "sensor_names": ["probe"], "ambient_sensor": "room",
+        "inputs": [{"name": "inlet", "sensor_names": ["inlet"], "min_temp": 20, "max_temp": 40}],
+        "fan": {"path_glob": %q, "response_type": "bogus"}
+      }]
+    }
+  `, loggingPluginScript, logFile.Name(), fanFile.Name()))
+
+	cfg, err := newConfig(jsonData, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cfg.newHeatsinks(); !errors.Is(err, errFanRespTypeUnknwon) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", errFanRespTypeUnknwon, err)
+	}
+
+	data, err := ioutil.ReadFile(logFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, device := range []string{"probe0", "probe1", "probe2"} {
+		if !strings.Contains(string(data), "close "+device) {
+			t.Errorf("expected sensor '%s' to be closed, requests:\n%s", device, data)
+		}
+	}
+	if data, err = ioutil.ReadFile(fanFile.Name()); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "255", string(data); actual != expected {
+		t.Errorf("expected the fan to be released\nwant: %q\n got: %q", expected, actual)
+	}
+}
+
+func Test_configHeatsink_newSensors_closesSensorsOnError(t *testing.T) {
+	t.Parallel()
+
+	logFile, cleanup := temporaryFile(t)
+	defer cleanup()
+	jsonData := strings.NewReader(fmt.Sprintf(`
+    {
+      "plugins": [{"name": "hub", "command": ["sh", "-c", %q], "env": ["LOG=%s"], "timeout": 5}],
+      "sensors": [{"name": "probe", "path_glob": "plugin:hub/probe0"}],
+      "heatsinks": [{"name": "case", "max_temp": 50, "sensor_names": ["probe", "missing"]}]
+    }
+  `, loggingPluginScript, logFile.Name()))
+
+	cfg, err := newConfig(jsonData, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sensors, err := cfg.Heatsinks[0].newSensors(cfg.named, zap.NewNop())
+	if err == nil {
+		t.Fatal("expected an error creating an unknown sensor")
+	}
+	if sensors != nil {
+		t.Errorf("expected no sensors, got: %v", sensors)
+	}
+	data, err := ioutil.ReadFile(logFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "close probe0") {
+		t.Errorf("expected the sensor created before the error to be closed, requests:\n%s", data)
+	}
+}
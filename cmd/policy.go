@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/malkhamis/heatsink"
+	"go.uber.org/zap"
+)
+
+var (
+	errPolicyHookSource = errors.New("policy hook must have either a command or a url")
+	errPolicyHookStatus = errors.New("unexpected http status from policy hook")
+	errPolicyConflict   = errors.New("only one of policy_hook and power_source can select profiles")
+	errBadProfile       = errors.New("invalid profile")
+)
+
+const (
+	defaultPolicyHookInterval = time.Minute
+	defaultPolicyHookTimeout  = 10 * time.Second
+	// maxPolicyHookOutput limits how much of the output of a policy hook is read
+	maxPolicyHookOutput = 1024
+)
+
+// configProfile is a named set of adjustments of a heatsink that an external policy hook or
+// the power source can ask the daemon to apply, e.g. a quiet profile while the user is in a
+// meeting. Omitted adjustments keep the heatsink's config
+type configProfile struct {
+	MaxDutyCycle *float64 `json:"max_duty_cycle,omitempty"`
+	MinTemp      *float64 `json:"min_temp,omitempty"`
+	MaxTemp      *float64 `json:"max_temp,omitempty"`
+	// TempChkPeriod is a duration, or a number of seconds
+	TempChkPeriod configDuration `json:"temp_check_period,omitempty"`
+}
+
+// validate returns an error if this profile cannot be applied
+func (p configProfile) validate() error {
+	if (p.MinTemp == nil) != (p.MaxTemp == nil) {
+		return fmt.Errorf("%w: min_temp and max_temp must be set together", errBadProfile)
+	}
+	if p.MinTemp != nil && *p.MaxTemp <= *p.MinTemp {
+		return fmt.Errorf("%w: max_temp must be greater than min_temp", errBadProfile)
+	}
+	if _, err := p.TempChkPeriod.duration("temp_check_period", time.Second); err != nil {
+		return err
+	}
+	return nil
+}
+
+// apply applies this profile to the given heatsink, replacing any previously applied profile.
+// The profile must be valid
+func (p configProfile) apply(hs *heatsink.Heatsink) {
+	if p.MaxDutyCycle == nil {
+		hs.ClearMaxDutyCycle()
+	} else {
+		hs.SetMaxDutyCycle(*p.MaxDutyCycle)
+	}
+	if p.MinTemp == nil || hs.SetTemperatureRange(*p.MinTemp, *p.MaxTemp) != nil {
+		hs.ClearTemperatureRange()
+	}
+	if period, _ := p.TempChkPeriod.duration("temp_check_period", time.Second); period > 0 {
+		hs.SetCheckPeriod(period)
+	} else {
+		hs.ClearCheckPeriod()
+	}
+}
+
+// configPolicyHook is an external program or http endpoint that is evaluated periodically and
+// answers with the name of the profile to apply. The command's standard output or the
+// response body is trimmed and an empty answer means no profile. Exactly one of command and
+// url must be set
+type configPolicyHook struct {
+	Command  []string `json:"command,omitempty"`
+	URL      string   `json:"url,omitempty"`
+	Interval string   `json:"interval,omitempty"`
+	Timeout  string   `json:"timeout,omitempty"`
+}
+
+// policyHook applies the profiles that an external policy asks for to the heatsinks
+type policyHook struct {
+	query    func(ctx context.Context) (string, error)
+	interval time.Duration
+	timeout  time.Duration
+	switcher *profileSwitcher
+	source   string
+	logger   *zap.Logger
+}
+
+// newPolicyHook returns the policy hook of this config, or nil if none is configured. The
+// policy hook applies profiles through the given switcher
+func (c *config) newPolicyHook(switcher *profileSwitcher) (*policyHook, error) {
+
+	switch {
+	case c.PolicyHook == nil && c.PowerSource == nil:
+		return nil, nil
+	case c.PolicyHook != nil && c.PowerSource != nil:
+		return nil, errPolicyConflict
+	case c.PowerSource != nil:
+		hook, err := c.PowerSource.newPolicyHook(c.SysfsRoot, c.logger)
+		if err != nil {
+			return nil, err
+		}
+		hook.switcher = switcher
+		return hook, nil
+	}
+
+	durations := [2]time.Duration{defaultPolicyHookInterval, defaultPolicyHookTimeout}
+	for i, d := range []string{c.PolicyHook.Interval, c.PolicyHook.Timeout} {
+		if d == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(d)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errBadDuration, err)
+		}
+		if parsed > 0 {
+			durations[i] = parsed
+		}
+	}
+	hook := &policyHook{
+		interval: durations[0],
+		timeout:  durations[1],
+		switcher: switcher,
+		source:   "policy_hook",
+		logger:   c.logger,
+	}
+
+	switch cmd, url := c.PolicyHook.Command, c.PolicyHook.URL; {
+	case len(cmd) > 0 && url == "":
+		hook.query = commandPolicy(cmd)
+	case len(cmd) == 0 && url != "":
+		hook.query = httpPolicy(url)
+	default:
+		return nil, errPolicyHookSource
+	}
+
+	return hook, nil
+}
+
+// commandPolicy returns a query that runs the given command and answers with its output
+func commandPolicy(command []string) func(context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		output, err := exec.CommandContext(ctx, command[0], command[1:]...).Output()
+		if err != nil {
+			return "", fmt.Errorf("running '%s': %w", command[0], err)
+		}
+		if len(output) > maxPolicyHookOutput {
+			output = output[:maxPolicyHookOutput]
+		}
+		return strings.TrimSpace(string(output)), nil
+	}
+}
+
+// httpPolicy returns a query that sends a GET request to the given url and answers with the
+// response body
+func httpPolicy(url string) func(context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return "", err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("%w: %s", errPolicyHookStatus, resp.Status)
+		}
+		body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxPolicyHookOutput))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(body)), nil
+	}
+}
+
+// evaluate queries the policy and applies the profile it answers with to every heatsink. A
+// heatsink that does not define that profile runs without one. If the query fails, the
+// current profile is kept
+func (p *policyHook) evaluate() {
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+	name, err := p.query(ctx)
+	if err != nil {
+		p.logger.Warn("policy hook failed, keeping the current profile", zap.Error(err))
+		return
+	}
+	p.switcher.setAutomatic(name, p.source)
+}
+
+// start evaluates the policy immediately and then periodically. The returned function stops
+// evaluating it
+func (p *policyHook) start() (stop func()) {
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		p.evaluate()
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				p.evaluate()
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
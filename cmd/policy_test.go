@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func Test_config_newPolicyHook(t *testing.T) {
+
+	quiet := 0.3
+	cfg := &config{
+		Heatsinks: []*configHeatsink{
+			{Profiles: map[string]configProfile{"quiet": {MaxDutyCycle: &quiet}}},
+		},
+		logger: zap.NewNop(),
+	}
+
+	hook, err := cfg.newPolicyHook(nil)
+	if err != nil || hook != nil {
+		t.Fatalf("expected no policy hook without config, got: %v, %v", hook, err)
+	}
+
+	cases := map[string]struct {
+		hook        configPolicyHook
+		expectedErr error
+	}{
+		"none":     {hook: configPolicyHook{}, expectedErr: errPolicyHookSource},
+		"both":     {hook: configPolicyHook{Command: []string{"true"}, URL: "http://x"}, expectedErr: errPolicyHookSource},
+		"interval": {hook: configPolicyHook{Command: []string{"true"}, Interval: "x"}, expectedErr: errBadDuration},
+		"timeout":  {hook: configPolicyHook{URL: "http://x", Timeout: "x"}, expectedErr: errBadDuration},
+		"valid":    {hook: configPolicyHook{URL: "http://x", Interval: "5s"}},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			cfg.PolicyHook = &c.hook
+			_, err := cfg.newPolicyHook(nil)
+			if !errors.Is(err, c.expectedErr) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", c.expectedErr, err)
+			}
+		})
+	}
+}
+
+func Test_policyHook_evaluate(t *testing.T) {
+
+	hs1, cleanup := testHeatsink(t, "40000")
+	defer cleanup()
+	hs2, cleanup := testHeatsink(t, "40000")
+	defer cleanup()
+
+	quiet := 0.3
+	var answer string
+	var answerErr error
+	hook := &policyHook{
+		query:  func(context.Context) (string, error) { return answer, answerErr },
+		logger: zap.NewNop(),
+		switcher: &profileSwitcher{
+			logger: zap.NewNop(),
+			targets: []profileTarget{
+				{hs: hs1, profiles: map[string]configProfile{"quiet": {MaxDutyCycle: &quiet}}},
+				{hs: hs2},
+			},
+		},
+	}
+
+	answer = "quiet"
+	hook.evaluate()
+	if max, ok := hs1.MaxDutyCycle(); !ok || max != quiet {
+		t.Fatalf("expected the profile to be applied\nwant: %v, true\n got: %v, %v", quiet, max, ok)
+	}
+	if _, ok := hs2.MaxDutyCycle(); ok {
+		t.Fatal("expected no profile for a heatsink that does not define it")
+	}
+
+	answer, answerErr = "", errors.New("simulated error")
+	hook.evaluate()
+	if _, ok := hs1.MaxDutyCycle(); !ok {
+		t.Fatal("expected the current profile to be kept when the hook fails")
+	}
+
+	answerErr = nil
+	hook.evaluate()
+	if _, ok := hs1.MaxDutyCycle(); ok {
+		t.Fatal("expected the profile to be cleared given an empty answer")
+	}
+	if current, _ := hook.switcher.status(); current != "" {
+		t.Fatalf("unexpected current profile\nwant: %q\n got: %q", "", current)
+	}
+}
+
+func Test_configProfile(t *testing.T) {
+
+	hs, cleanup := testHeatsink(t, "40000")
+	defer cleanup()
+
+	quiet, minTemp, maxTemp, low := 0.3, 40.0, 70.0, 30.0
+	cases := map[string]struct {
+		profile     configProfile
+		expectedErr error
+	}{
+		"valid":        {profile: configProfile{MaxDutyCycle: &quiet, MinTemp: &minTemp, MaxTemp: &maxTemp, TempChkPeriod: "5s"}},
+		"min-only":     {profile: configProfile{MinTemp: &minTemp}, expectedErr: errBadProfile},
+		"bad-range":    {profile: configProfile{MinTemp: &maxTemp, MaxTemp: &low}, expectedErr: errBadProfile},
+		"bad-duration": {profile: configProfile{TempChkPeriod: "x"}, expectedErr: errBadDuration},
+	}
+	for name, c := range cases {
+		if err := c.profile.validate(); !errors.Is(err, c.expectedErr) {
+			t.Errorf("%s: unexpected error\nwant: %v\n got: %v", name, c.expectedErr, err)
+		}
+	}
+
+	cases["valid"].profile.apply(hs)
+	if actual := hs.CheckPeriod(); actual != 5*time.Second {
+		t.Errorf("unexpected check period\nwant: %v\n got: %v", 5*time.Second, actual)
+	}
+	if max, ok := hs.MaxDutyCycle(); !ok || max != quiet {
+		t.Errorf("unexpected max duty cycle\nwant: %v, true\n got: %v, %v", quiet, max, ok)
+	}
+
+	configProfile{}.apply(hs)
+	if actual := hs.CheckPeriod(); actual != 10*time.Millisecond {
+		t.Errorf("unexpected check period\nwant: %v\n got: %v", 10*time.Millisecond, actual)
+	}
+	if _, ok := hs.MaxDutyCycle(); ok {
+		t.Error("expected the max duty cycle to be cleared")
+	}
+}
+
+func Test_commandPolicy(t *testing.T) {
+
+	answer, err := commandPolicy([]string{"echo", " quiet "})(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer != "quiet" {
+		t.Fatalf("unexpected answer\nwant: %q\n got: %q", "quiet", answer)
+	}
+
+	if _, err := commandPolicy([]string{"false"})(context.Background()); err == nil {
+		t.Fatal("expected an error given a failing command")
+	}
+}
+
+func Test_httpPolicy(t *testing.T) {
+
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		fmt.Fprintln(w, "quiet")
+	}))
+	defer server.Close()
+
+	answer, err := httpPolicy(server.URL)(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer != "quiet" {
+		t.Fatalf("unexpected answer\nwant: %q\n got: %q", "quiet", answer)
+	}
+
+	status = http.StatusInternalServerError
+	_, err = httpPolicy(server.URL)(context.Background())
+	if !errors.Is(err, errPolicyHookStatus) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", errPolicyHookStatus, err)
+	}
+}
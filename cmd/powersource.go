@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var errNoMainsSupply = errors.New("no mains power supply found")
+
+const (
+	// powerSupplyClassDir is where the kernel's power supplies are found, relative to the sysfs root
+	powerSupplyClassDir        = "class/power_supply"
+	defaultPowerSourceInterval = 5 * time.Second
+)
+
+// configPowerSource switches the profiles of all heatsinks when a laptop moves between AC and
+// battery power, e.g. to a profile that caps the fan and checks less often on battery. Either
+// profile may be empty, in which case the heatsinks run without a profile on that source
+type configPowerSource struct {
+	OnAC      string `json:"on_ac,omitempty"`
+	OnBattery string `json:"on_battery,omitempty"`
+	Interval  string `json:"interval,omitempty"`
+}
+
+// newPolicyHook returns a policy hook that answers with the profile for the current power
+// source, which is AC if any mains power supply under the given sysfs root is online
+func (c *configPowerSource) newPolicyHook(sysfsRoot string, logger *zap.Logger) (*policyHook, error) {
+
+	interval := defaultPowerSourceInterval
+	if c.Interval != "" {
+		parsed, err := time.ParseDuration(c.Interval)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errBadDuration, err)
+		}
+		if parsed > 0 {
+			interval = parsed
+		}
+	}
+
+	classDir := resolveSysfsPath(sysfsRoot, powerSupplyClassDir)
+	if _, err := onlineMains(classDir); err != nil {
+		return nil, err
+	}
+	query := func(context.Context) (string, error) {
+		online, err := onlineMains(classDir)
+		if err != nil {
+			return "", err
+		}
+		if online {
+			return c.OnAC, nil
+		}
+		return c.OnBattery, nil
+	}
+	return &policyHook{
+		query:    query,
+		interval: interval,
+		timeout:  interval,
+		source:   "power_source",
+		logger:   logger,
+	}, nil
+}
+
+// onlineMains reports whether any mains power supply in the given directory, which is
+// typically /sys/class/power_supply, is online. It returns errNoMainsSupply if there is none
+func onlineMains(classDir string) (bool, error) {
+
+	typeFiles, err := filepath.Glob(filepath.Join(classDir, "*", "type"))
+	if err != nil {
+		return false, err
+	}
+	found := false
+	for _, typeFile := range typeFiles {
+		supplyType, err := ioutil.ReadFile(typeFile)
+		if err != nil || strings.TrimSpace(string(supplyType)) != "Mains" {
+			continue
+		}
+		found = true
+		online, err := ioutil.ReadFile(filepath.Join(filepath.Dir(typeFile), "online"))
+		if err != nil {
+			return false, err
+		}
+		if strings.TrimSpace(string(online)) == "1" {
+			return true, nil
+		}
+	}
+	if !found {
+		return false, fmt.Errorf("%w in '%s'", errNoMainsSupply, classDir)
+	}
+	return false, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// fakePowerSupplies creates a sysfs root with a mains power supply, whose online state is the
+// given one, and a battery
+func fakePowerSupplies(t *testing.T, online string) (root string, cleanup func()) {
+	t.Helper()
+
+	root, err := ioutil.TempDir("", "sysfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup = func() { os.RemoveAll(root) }
+	files := map[string]string{
+		"AC/type":     "Mains",
+		"AC/online":   online,
+		"BAT0/type":   "Battery",
+		"BAT0/status": "Discharging",
+	}
+	for name, content := range files {
+		filename := filepath.Join(root, powerSupplyClassDir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+			cleanup()
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(content+"\n"), 0600); err != nil {
+			cleanup()
+			t.Fatal(err)
+		}
+	}
+	return root, cleanup
+}
+
+func Test_configPowerSource_newPolicyHook(t *testing.T) {
+
+	root, cleanup := fakePowerSupplies(t, "1")
+	defer cleanup()
+	onlineFile := filepath.Join(root, powerSupplyClassDir, "AC", "online")
+
+	src := &configPowerSource{OnAC: "performance", OnBattery: "silent"}
+	hook, err := src.newPolicyHook(root, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hook.interval != defaultPowerSourceInterval {
+		t.Errorf("unexpected interval\nwant: %v\n got: %v", defaultPowerSourceInterval, hook.interval)
+	}
+
+	for _, step := range []struct{ online, expected string }{{"1", "performance"}, {"0", "silent"}} {
+		if err := ioutil.WriteFile(onlineFile, []byte(step.online), 0600); err != nil {
+			t.Fatal(err)
+		}
+		actual, err := hook.query(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual != step.expected {
+			t.Errorf("unexpected profile while online is %s\nwant: %q\n got: %q", step.online, step.expected, actual)
+		}
+	}
+
+	src.Interval = "often"
+	if _, err := src.newPolicyHook(root, zap.NewNop()); !errors.Is(err, errBadDuration) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", errBadDuration, err)
+	}
+	src.Interval = ""
+	if _, err := src.newPolicyHook(filepath.Join(root, "nowhere"), zap.NewNop()); !errors.Is(err, errNoMainsSupply) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", errNoMainsSupply, err)
+	}
+}
+
+func Test_config_newPolicyHook_powerSource(t *testing.T) {
+
+	root, cleanup := fakePowerSupplies(t, "0")
+	defer cleanup()
+
+	cfg := &config{
+		Heatsinks:   []*configHeatsink{{}},
+		PowerSource: &configPowerSource{OnBattery: "silent"},
+		PolicyHook:  &configPolicyHook{Command: []string{"true"}},
+		SysfsRoot:   root,
+		logger:      zap.NewNop(),
+	}
+	if _, err := cfg.newPolicyHook(&profileSwitcher{}); !errors.Is(err, errPolicyConflict) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", errPolicyConflict, err)
+	}
+
+	cfg.PolicyHook = nil
+	switcher := &profileSwitcher{}
+	hook, err := cfg.newPolicyHook(switcher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hook.switcher != switcher || hook.source != "power_source" {
+		t.Fatalf("expected the power source to apply profiles through the given switcher, got: %+v", hook)
+	}
+}
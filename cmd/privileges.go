@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+
+	"go.uber.org/zap"
+)
+
+var (
+	errPrivilegesUser  = errors.New("invalid user to drop privileges to")
+	errPrivilegesGroup = errors.New("invalid group to drop privileges to")
+	errPrivilegesDrop  = errors.New("failed to drop privileges")
+)
+
+// configPrivileges configures the unprivileged user, given by name or id, that the daemon
+// switches to once it opened every device file as root. The group defaults to the primary
+// group of the user. If NoNewPrivileges is set, neither the daemon nor the commands it runs
+// may gain privileges again, e.g. through setuid binaries
+type configPrivileges struct {
+	User            string `json:"user"`
+	Group           string `json:"group,omitempty"`
+	NoNewPrivileges bool   `json:"no_new_privileges,omitempty"`
+}
+
+// credentials are the ids the daemon switches to
+type credentials struct {
+	uid int
+	gid int
+}
+
+// resolve looks up the ids of the configured user and group
+func (c *configPrivileges) resolve() (credentials, error) {
+
+	if c.User == "" {
+		return credentials{}, fmt.Errorf("%w: no user given", errPrivilegesUser)
+	}
+	u, err := user.Lookup(c.User)
+	if err != nil {
+		if u, err = user.LookupId(c.User); err != nil {
+			return credentials{}, fmt.Errorf("%w: '%s'", errPrivilegesUser, c.User)
+		}
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return credentials{}, fmt.Errorf("%w: '%s' has non-numeric id '%s'", errPrivilegesUser, c.User, u.Uid)
+	}
+
+	gid := u.Gid
+	if c.Group != "" {
+		g, err := user.LookupGroup(c.Group)
+		if err != nil {
+			if g, err = user.LookupGroupId(c.Group); err != nil {
+				return credentials{}, fmt.Errorf("%w: '%s'", errPrivilegesGroup, c.Group)
+			}
+		}
+		gid = g.Gid
+	}
+	numGid, err := strconv.Atoi(gid)
+	if err != nil {
+		return credentials{}, fmt.Errorf("%w: non-numeric id '%s'", errPrivilegesGroup, gid)
+	}
+	return credentials{uid: uid, gid: numGid}, nil
+}
+
+// These are internally used to ease unit testing, see also setgroups, setgid, and setuid
+var (
+	geteuid       = os.Geteuid
+	setNoNewPrivs = noNewPrivs
+)
+
+// drop switches the daemon to the configured user and group and drops every
+// supplementary group. Device files that are already open stay usable. If the daemon is
+// already running as the user, e.g. after a reload, nothing but no-new-privileges is applied.
+// If it is running as another unprivileged user, it cannot switch and only logs a warning
+func (c *configPrivileges) drop(logger *zap.Logger) error {
+
+	creds, err := c.resolve()
+	if err != nil {
+		return err
+	}
+
+	switch euid := geteuid(); {
+	case euid == creds.uid:
+		logger.Debug("already running as the unprivileged user", zap.String("user", c.User))
+	case euid != 0:
+		logger.Warn(
+			"not dropping privileges, the daemon is not running as root",
+			zap.String("user", c.User), zap.Int("uid", euid),
+		)
+	default:
+		// the group must be changed first, since an unprivileged user may no longer change it
+		if err := setgroups([]int{creds.gid}); err != nil {
+			return fmt.Errorf("%w: setting supplementary groups: %v", errPrivilegesDrop, err)
+		}
+		if err := setgid(creds.gid); err != nil {
+			return fmt.Errorf("%w: setting group id %d: %v", errPrivilegesDrop, creds.gid, err)
+		}
+		if err := setuid(creds.uid); err != nil {
+			return fmt.Errorf("%w: setting user id %d: %v", errPrivilegesDrop, creds.uid, err)
+		}
+		logger.Info(
+			"dropped privileges",
+			zap.String("user", c.User), zap.Int("uid", creds.uid), zap.Int("gid", creds.gid),
+		)
+	}
+
+	if c.NoNewPrivileges {
+		if err := setNoNewPrivs(); err != nil {
+			return fmt.Errorf("%w: setting no-new-privileges: %v", errPrivilegesDrop, err)
+		}
+	}
+	return nil
+}
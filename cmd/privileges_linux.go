@@ -0,0 +1,15 @@
+package main
+
+import "syscall"
+
+// prSetNoNewPrivs is PR_SET_NO_NEW_PRIVS of prctl(2)
+const prSetNoNewPrivs = 38
+
+// noNewPrivs sets the no_new_privs bit of the process, which is inherited by its children
+// and cannot be unset
+func noNewPrivs() error {
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
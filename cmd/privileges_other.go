@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "errors"
+
+// noNewPrivs is only supported on linux
+func noNewPrivs() error {
+	return errors.New("no-new-privileges is only supported on linux")
+}
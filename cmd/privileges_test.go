@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-test/deep"
+	"go.uber.org/zap"
+)
+
+func Test_configPrivileges_resolve(t *testing.T) {
+
+	testCases := []struct {
+		name        string
+		cfg         configPrivileges
+		expected    credentials
+		expectedErr error
+	}{
+		{
+			name:     "user by name",
+			cfg:      configPrivileges{User: "daemon"},
+			expected: credentials{uid: 1, gid: 1},
+		},
+		{
+			name:     "user by id with group",
+			cfg:      configPrivileges{User: "65534", Group: "daemon"},
+			expected: credentials{uid: 65534, gid: 1},
+		},
+		{
+			name:        "no user",
+			cfg:         configPrivileges{},
+			expectedErr: errPrivilegesUser,
+		},
+		{
+			name:        "unknown user",
+			cfg:         configPrivileges{User: "no-such-heatsink-user"},
+			expectedErr: errPrivilegesUser,
+		},
+		{
+			name:        "unknown group",
+			cfg:         configPrivileges{User: "daemon", Group: "no-such-heatsink-group"},
+			expectedErr: errPrivilegesGroup,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			creds, err := tc.cfg.resolve()
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", tc.expectedErr, err)
+			}
+			if diff := deep.Equal(creds, tc.expected); diff != nil {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+// stubPrivileges replaces the syscalls of dropping privileges with ones that record their
+// calls, and returns a function that restores them
+func stubPrivileges(euid int, failing string, calls *[]string) (restore func()) {
+
+	origGeteuid, origSetgroups, origSetgid, origSetuid, origNoNewPrivs := geteuid, setgroups, setgid, setuid, setNoNewPrivs
+	record := func(call string) error {
+		*calls = append(*calls, call)
+		if call == failing {
+			return errors.New("simulated error")
+		}
+		return nil
+	}
+	geteuid = func() int { return euid }
+	setgroups = func(gids []int) error { return record(fmt.Sprintf("setgroups %v", gids)) }
+	setgid = func(gid int) error { return record(fmt.Sprintf("setgid %d", gid)) }
+	setuid = func(uid int) error { return record(fmt.Sprintf("setuid %d", uid)) }
+	setNoNewPrivs = func() error { return record("no_new_privs") }
+
+	return func() {
+		geteuid, setgroups, setgid, setuid, setNoNewPrivs = origGeteuid, origSetgroups, origSetgid, origSetuid, origNoNewPrivs
+	}
+}
+
+func Test_configPrivileges_drop(t *testing.T) {
+
+	testCases := []struct {
+		name          string
+		cfg           configPrivileges
+		euid          int
+		failing       string
+		expectedCalls []string
+		expectedErr   error
+	}{
+		{
+			name:          "root",
+			cfg:           configPrivileges{User: "daemon", NoNewPrivileges: true},
+			euid:          0,
+			expectedCalls: []string{"setgroups [1]", "setgid 1", "setuid 1", "no_new_privs"},
+		},
+		{
+			name:          "already the user",
+			cfg:           configPrivileges{User: "daemon", NoNewPrivileges: true},
+			euid:          1,
+			expectedCalls: []string{"no_new_privs"},
+		},
+		{
+			name: "another unprivileged user",
+			cfg:  configPrivileges{User: "daemon"},
+			euid: 1000,
+		},
+		{
+			name:          "failing setgid",
+			cfg:           configPrivileges{User: "daemon", NoNewPrivileges: true},
+			euid:          0,
+			failing:       "setgid 1",
+			expectedCalls: []string{"setgroups [1]", "setgid 1"},
+			expectedErr:   errPrivilegesDrop,
+		},
+		{
+			name:        "unknown user",
+			cfg:         configPrivileges{User: "no-such-heatsink-user"},
+			euid:        0,
+			expectedErr: errPrivilegesUser,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls []string
+			restore := stubPrivileges(tc.euid, tc.failing, &calls)
+			defer restore()
+
+			err := tc.cfg.drop(zap.NewNop())
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", tc.expectedErr, err)
+			}
+			if diff := deep.Equal(calls, tc.expectedCalls); diff != nil {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
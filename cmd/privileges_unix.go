@@ -0,0 +1,13 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import "syscall"
+
+// These are internally used to ease unit testing
+var (
+	setgroups = syscall.Setgroups
+	setgid    = syscall.Setgid
+	setuid    = syscall.Setuid
+)
@@ -0,0 +1,11 @@
+package main
+
+import "syscall"
+
+// Switching users is not supported on windows, where the effective user id is always -1 and
+// these are never called
+var (
+	setgroups = func([]int) error { return syscall.EWINDOWS }
+	setgid    = func(int) error { return syscall.EWINDOWS }
+	setuid    = func(int) error { return syscall.EWINDOWS }
+)
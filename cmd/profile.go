@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/malkhamis/heatsink"
+	"go.uber.org/zap"
+)
+
+var errProfileUnknown = errors.New("no heatsink defines the profile")
+
+// autoProfile is the reserved profile name that hands the choice of profile back to the policy
+// hook or the power source, if any, and otherwise runs every heatsink without a profile
+const autoProfile = "auto"
+
+// profileTarget is a heatsink along with the profiles it defines
+type profileTarget struct {
+	hs       *heatsink.Heatsink
+	profiles map[string]configProfile
+}
+
+// profileSwitcher applies profiles to all heatsinks, either as asked by a policy hook or the
+// power source, or as pinned by an operator at runtime, which takes precedence until the
+// operator switches back to 'auto'. It is safe for concurrent use
+type profileSwitcher struct {
+	targets   []profileTarget
+	logger    *zap.Logger
+	mutex     sync.Mutex
+	current   string
+	automatic string
+	pinned    bool
+}
+
+// newProfileSwitcher returns a profile switcher for the given heatsinks, which must be the
+// ones created from this config
+func (c *config) newProfileSwitcher(heatsinks []*heatsink.Heatsink) *profileSwitcher {
+	s := &profileSwitcher{logger: c.logger}
+	for i, hsCfg := range c.Heatsinks {
+		if i < len(heatsinks) {
+			s.targets = append(s.targets, profileTarget{hs: heatsinks[i], profiles: hsCfg.Profiles})
+		}
+	}
+	return s
+}
+
+// setAutomatic applies the given profile, unless an operator pinned one, in which case it is
+// applied once the operator switches back to 'auto'. An empty name means no profile
+func (s *profileSwitcher) setAutomatic(name, source string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.automatic = name
+	if !s.pinned {
+		s.switchTo(name, source)
+	}
+}
+
+// pin applies the given profile until another one is pinned or 'auto' is given. It returns
+// errProfileUnknown if no heatsink defines the profile
+func (s *profileSwitcher) pin(name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if name == autoProfile {
+		s.pinned = false
+		s.switchTo(s.automatic, "operator")
+		return nil
+	}
+	if !s.defines(name) {
+		return fmt.Errorf("%w: '%s'", errProfileUnknown, name)
+	}
+	s.pinned = true
+	s.switchTo(name, "operator")
+	return nil
+}
+
+// status returns the name of the applied profile, which is empty if there is none, and whether
+// an operator pinned it
+func (s *profileSwitcher) status() (current string, pinned bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.current, s.pinned
+}
+
+// names returns the sorted names of the profiles that any heatsink defines
+func (s *profileSwitcher) names() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, target := range s.targets {
+		for name := range target.profiles {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *profileSwitcher) defines(name string) bool {
+	for _, target := range s.targets {
+		if _, ok := target.profiles[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// switchTo applies the given profile to every heatsink. A heatsink that does not define the
+// profile runs without one. The caller must hold the mutex
+func (s *profileSwitcher) switchTo(name, source string) {
+	if name == s.current {
+		return
+	}
+	if name != "" && !s.defines(name) {
+		s.logger.Warn("no heatsink defines the requested profile", zap.String("profile", name))
+	}
+	for _, target := range s.targets {
+		target.profiles[name].apply(target.hs)
+	}
+	s.logger.Info(
+		"applied profile",
+		zap.String("event", "profile_change"),
+		zap.String("from", s.current),
+		zap.String("to", name),
+		zap.String("requested_by", source),
+	)
+	s.current = name
+}
+
+// profileStatus is the payload of the profile endpoint
+type profileStatus struct {
+	Active    string   `json:"active"`
+	Pinned    bool     `json:"pinned"`
+	Available []string `json:"available"`
+}
+
+// profileHandler serves the status of the given switcher on GET and pins the profile named in
+// the body of a PUT or POST request, where 'auto' unpins it
+func profileHandler(s *profileSwitcher, logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxPolicyHookOutput))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := s.pin(strings.TrimSpace(string(body))); err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, PUT, POST")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		current, pinned := s.status()
+		status := profileStatus{Active: current, Pinned: pinned, Available: s.names()}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			logger.Warn("failed to write profile status", zap.Error(err))
+		}
+	})
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/malkhamis/heatsink"
+	"go.uber.org/zap"
+)
+
+func Test_profileSwitcher(t *testing.T) {
+
+	hs, cleanup := testHeatsink(t, "40000")
+	defer cleanup()
+
+	silent, performance := 0.3, 1.0
+	cfg := &config{
+		Heatsinks: []*configHeatsink{{Profiles: map[string]configProfile{
+			"silent":      {MaxDutyCycle: &silent},
+			"performance": {MaxDutyCycle: &performance},
+		}}},
+		logger: zap.NewNop(),
+	}
+	s := cfg.newProfileSwitcher([]*heatsink.Heatsink{hs})
+	if diff := deep.Equal(s.names(), []string{"performance", "silent"}); diff != nil {
+		t.Fatal(diff)
+	}
+
+	steps := []struct {
+		automatic, pin string
+		expectedErr    error
+		expected       string
+		pinned         bool
+	}{
+		{automatic: "silent", expected: "silent"},
+		{pin: "performance", expected: "performance", pinned: true},
+		{automatic: "", expected: "performance", pinned: true}, // pinned profiles take precedence
+		{pin: "turbo", expectedErr: errProfileUnknown, expected: "performance", pinned: true},
+		{pin: autoProfile, expected: ""}, // back to the latest automatic profile
+		{automatic: "silent", expected: "silent"},
+	}
+	for i, step := range steps {
+		var err error
+		if step.pin != "" {
+			err = s.pin(step.pin)
+		} else {
+			s.setAutomatic(step.automatic, "test")
+		}
+		if !errors.Is(err, step.expectedErr) {
+			t.Fatalf("step %d: unexpected error\nwant: %v\n got: %v", i, step.expectedErr, err)
+		}
+		current, pinned := s.status()
+		if current != step.expected || pinned != step.pinned {
+			t.Fatalf("step %d: unexpected status\nwant: %q, %v\n got: %q, %v", i, step.expected, step.pinned, current, pinned)
+		}
+	}
+	if max, ok := hs.MaxDutyCycle(); !ok || max != silent {
+		t.Fatalf("expected the profile to be applied\nwant: %v, true\n got: %v, %v", silent, max, ok)
+	}
+}
+
+func Test_profileHandler(t *testing.T) {
+
+	hs, cleanup := testHeatsink(t, "40000")
+	defer cleanup()
+
+	silent := 0.3
+	s := &profileSwitcher{
+		logger:  zap.NewNop(),
+		targets: []profileTarget{{hs: hs, profiles: map[string]configProfile{"silent": {MaxDutyCycle: &silent}}}},
+	}
+	handler := profileHandler(s, zap.NewNop())
+
+	cases := []struct {
+		method, body   string
+		expectedCode   int
+		expectedStatus profileStatus
+	}{
+		{method: http.MethodGet, expectedCode: http.StatusOK, expectedStatus: profileStatus{Available: []string{"silent"}}},
+		{method: http.MethodPut, body: "silent\n", expectedCode: http.StatusOK, expectedStatus: profileStatus{
+			Active: "silent", Pinned: true, Available: []string{"silent"},
+		}},
+		{method: http.MethodPost, body: "turbo", expectedCode: http.StatusNotFound},
+		{method: http.MethodPost, body: "auto", expectedCode: http.StatusOK, expectedStatus: profileStatus{Available: []string{"silent"}}},
+		{method: http.MethodDelete, expectedCode: http.StatusMethodNotAllowed},
+	}
+	for i, c := range cases {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(c.method, "/profile", strings.NewReader(c.body)))
+		if recorder.Code != c.expectedCode {
+			t.Fatalf("case %d: unexpected status code\nwant: %d\n got: %d", i, c.expectedCode, recorder.Code)
+		}
+		if recorder.Code != http.StatusOK {
+			continue
+		}
+		var actual profileStatus
+		if err := json.NewDecoder(recorder.Body).Decode(&actual); err != nil {
+			t.Fatal(err)
+		}
+		if diff := deep.Equal(actual, c.expectedStatus); diff != nil {
+			t.Fatalf("case %d: %v", i, diff)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/malkhamis/heatsink"
+	"github.com/malkhamis/heatsink/rapl"
+	"go.uber.org/zap"
+)
+
+// raplPrefix marks sensor path globs that match a RAPL domain directory whose power draw, in
+// watts, is read in place of a temperature, e.g. 'rapl:/sys/class/powercap/intel-rapl:0'
+const raplPrefix = "rapl:"
+
+// raplAddress returns the path glob of the RAPL domain that the given path glob addresses, if any
+func raplAddress(pattern string) (domainGlob string, ok bool) {
+	if !strings.HasPrefix(pattern, raplPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(pattern, raplPrefix), true
+}
+
+func newRaplSensor(domainGlob, name string, logger *zap.Logger) (heatsink.ThermoSensor, error) {
+
+	domainDir, err := globOne(domainGlob)
+	if err != nil {
+		return nil, err
+	}
+	sensor, err := rapl.NewSensor(domainDir, rapl.OptName(name))
+	if err != nil {
+		return nil, fmt.Errorf("'%s%s': %w", raplPrefix, domainDir, err)
+	}
+	logger.Info(
+		"created RAPL power sensor",
+		zap.String("name", sensor.Name()),
+		zap.String("domain", domainDir),
+	)
+	return sensor, nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_raplAddress(t *testing.T) {
+
+	if glob, ok := raplAddress("rapl:/sys/class/powercap/intel-rapl:0"); !ok || glob != "/sys/class/powercap/intel-rapl:0" {
+		t.Errorf("unexpected domain glob\nwant: %q, true\n got: %q, %v", "/sys/class/powercap/intel-rapl:0", glob, ok)
+	}
+	if _, ok := raplAddress("/sys/class/hwmon/hwmon0/temp1_input"); ok {
+		t.Error("expected a file path glob not to be a RAPL address")
+	}
+}
+
+func Test_config_newHeatsinks_raplSensor(t *testing.T) {
+
+	fanFile, cleanup := temporaryFile(t)
+	defer cleanup()
+	domainDir, err := ioutil.TempDir("", "intel-rapl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(domainDir)
+	if err := ioutil.WriteFile(filepath.Join(domainDir, "energy_uj"), []byte("1000\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	jsonData := strings.NewReader(fmt.Sprintf(`
+    {
+      "sensors": [{"name": "package-power", "path_glob": "rapl:%s"}],
+      "heatsinks": [
+        {
+          "min_temp": 15,
+          "max_temp": 95,
+          "fan": {"path_glob": %q},
+          "sensor_path_globs": ["rapl:%s"],
+          "inputs": [{"name": "power", "sensor_names": ["package-power"], "min_temp": 15, "max_temp": 95}]
+        }
+      ]
+    }
+  `, domainDir, fanFile.Name(), domainDir,
+	))
+
+	cfg, err := newConfig(jsonData, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	heatsinks, err := cfg.newHeatsinks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, hs := range heatsinks {
+		hs.StopThermalControl()
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/malkhamis/heatsink"
+	"github.com/malkhamis/heatsink/httpfan"
+	"go.uber.org/zap"
+)
+
+// configRemoteFan is a fan on another host or on a fan hub that is driven by sending its duty
+// cycles to an agent over HTTP. When set, the fan's path glob and pwm settings are ignored
+type configRemoteFan struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Timeout string            `json:"timeout,omitempty"`
+}
+
+func (c configFan) newRemoteFan(logger *zap.Logger) (heatsink.FanDriver, error) {
+
+	if c.dryRun {
+		logger.Info("created dry-run fan", zap.String("name", c.Name), zap.String("url", c.Remote.URL))
+		return newDryRunFan(c.Name, c.Remote.URL, logger), nil
+	}
+
+	options := []httpfan.Option{httpfan.OptName(c.Name)}
+	for key, value := range c.Remote.Headers {
+		options = append(options, httpfan.OptHeader(key, value))
+	}
+	if c.Remote.Timeout != "" {
+		timeout, err := time.ParseDuration(c.Remote.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errBadDuration, err)
+		}
+		options = append(options, httpfan.OptTimeout(timeout))
+	}
+
+	fan, err := httpfan.New(c.Remote.URL, options...)
+	if err != nil {
+		return nil, err
+	}
+	// headers are left out since they usually carry credentials
+	logger.Info(
+		"created remote fan",
+		zap.String("name", fan.Name()),
+		zap.String("url", c.Remote.URL),
+		zap.String("response_type", c.RespType),
+	)
+	return fan, nil
+}
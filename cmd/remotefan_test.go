@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/malkhamis/heatsink/httpfan"
+	"go.uber.org/zap"
+)
+
+func Test_configFan_newFan_remote(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mutex    sync.Mutex
+		received []float64
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req httpfan.Request
+		if r.Header.Get("X-Api-Key") != "secret" || json.NewDecoder(r.Body).Decode(&req) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		received = append(received, req.DutyCycle)
+	}))
+	defer server.Close()
+
+	cfg := configFan{
+		Name: "hub",
+		Remote: &configRemoteFan{
+			URL:     server.URL + "/fans/hub",
+			Headers: map[string]string{"X-Api-Key": "secret"},
+			Timeout: "1s",
+		},
+	}
+	fan, err := cfg.newFan(zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fan.SetDutyCycle(0.75); err != nil {
+		t.Fatal(err)
+	}
+	if err := fan.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if diff := deep.Equal(received, []float64{0.75, 1}); diff != nil {
+		t.Fatal(diff)
+	}
+}
+
+func Test_configFan_newFan_remoteErrors(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		fan         configFan
+		expectedErr error
+	}{
+		"bad url":     {fan: configFan{Remote: &configRemoteFan{URL: "hub:8080"}}, expectedErr: httpfan.ErrBadURL},
+		"bad timeout": {fan: configFan{Remote: &configRemoteFan{URL: "http://hub/", Timeout: "1"}}, expectedErr: errBadDuration},
+		"dry run":     {fan: configFan{Remote: &configRemoteFan{URL: "hub:8080"}, dryRun: true}},
+		"pwm mode":    {fan: configFan{Remote: &configRemoteFan{URL: "http://hub/"}, PwmMode: "dc"}, expectedErr: errPwmOnlySetting},
+		"inverted":    {fan: configFan{Remote: &configRemoteFan{URL: "http://hub/"}, Inverted: true}, expectedErr: errPwmOnlySetting},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			fan, err := c.fan.newFan(zap.NewNop())
+			if !errors.Is(err, c.expectedErr) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", c.expectedErr, err)
+			}
+			if err == nil {
+				_ = fan.Close()
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/malkhamis/heatsink"
+	"github.com/malkhamis/heatsink/httpsense"
+	"go.uber.org/zap"
+)
+
+// configRemoteSensor is a named sensor whose temperature is fetched from a remote HTTP endpoint
+// returning JSON, e.g. the enclosure sensor of a NAS, or polled over SNMP if SNMP is set.
+// JSONPath is dot-separated and indexes arrays by position, e.g. 'sensors.0.temp'
+type configRemoteSensor struct {
+	Name     string            `json:"name"`
+	URL      string            `json:"url,omitempty"`
+	JSONPath string            `json:"json_path,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	SNMP     *configSNMP       `json:"snmp,omitempty"`
+	Timeout  string            `json:"timeout,omitempty"`
+}
+
+// location returns where the sensor's temperature is read from
+func (c configRemoteSensor) location() string {
+	if c.SNMP != nil {
+		return "snmp://" + c.SNMP.Target + "/" + strings.TrimPrefix(c.SNMP.OID, ".")
+	}
+	return c.URL
+}
+
+func (c configRemoteSensor) newSensor(logger *zap.Logger) (heatsink.ThermoSensor, error) {
+
+	if c.SNMP != nil {
+		return c.newSNMPSensor(logger)
+	}
+
+	options := []httpsense.Option{httpsense.OptName(c.Name)}
+	if c.JSONPath != "" {
+		options = append(options, httpsense.OptJSONPath(c.JSONPath))
+	}
+	for key, value := range c.Headers {
+		options = append(options, httpsense.OptHeader(key, value))
+	}
+	if c.Timeout != "" {
+		timeout, err := time.ParseDuration(c.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errBadDuration, err)
+		}
+		options = append(options, httpsense.OptTimeout(timeout))
+	}
+
+	sensor, err := httpsense.New(c.URL, options...)
+	if err != nil {
+		return nil, fmt.Errorf("remote sensor '%s': %w", c.Name, err)
+	}
+	// headers are left out since they usually carry credentials
+	logger.Info(
+		"created remote sensor",
+		zap.String("name", c.Name),
+		zap.String("url", c.URL),
+		zap.String("json_path", c.JSONPath),
+	)
+	return sensor, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/malkhamis/heatsink/httpsense"
+	"go.uber.org/zap"
+)
+
+func Test_namedSensors_newSensor_remote(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte(`{"enclosure": {"temps": [35.5, 41]}}`))
+	}))
+	defer server.Close()
+
+	cfg, err := newConfig(strings.NewReader(fmt.Sprintf(`
+		{
+		  "remote_sensors": [
+		    {"name": "nas", "url": %q, "json_path": "enclosure.temps.1",
+		     "headers": {"X-Api-Key": "secret"}, "timeout": "1s"}
+		  ],
+		  "virtual_sensors": [{"name": "nas_half", "expression": "nas / 2"}],
+		  "heatsinks": [{"sensor_names": ["nas_half"]}]
+		}
+	`, server.URL)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sensor, err := cfg.named.newSensor("nas_half", zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sensor.Close()
+
+	actual, err := sensor.Temperature()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := 20.5; expected != actual {
+		t.Fatalf("unexpected temperature\nwant: %.1f\n got: %.1f", expected, actual)
+	}
+}
+
+func Test_configRemoteSensor_newSensor_errors(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		sensor      configRemoteSensor
+		expectedErr error
+	}{
+		"bad url":     {sensor: configRemoteSensor{URL: "nas/temperature"}, expectedErr: httpsense.ErrBadURL},
+		"bad timeout": {sensor: configRemoteSensor{URL: "http://nas/", Timeout: "soon"}, expectedErr: errBadDuration},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			_, err := c.sensor.newSensor(zap.NewNop())
+			if !errors.Is(err, c.expectedErr) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", c.expectedErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/malkhamis/heatsink"
+)
+
+// configSchedule adjusts a heatsink between two times of day in local time, given as "HH:MM",
+// e.g. from "22:00" to "07:00". During the window, the duty cycle is capped at max_duty_cycle
+// unless the temperature is above unless_above, and min_temp and max_temp, if set, replace
+// those of the heatsink
+type configSchedule struct {
+	Name         string   `json:"name"`
+	Start        string   `json:"start"`
+	End          string   `json:"end"`
+	MaxDutyCycle *float64 `json:"max_duty_cycle,omitempty"`
+	UnlessAbove  float64  `json:"unless_above,omitempty"`
+	MinTemp      float64  `json:"min_temp,omitempty"`
+	MaxTemp      float64  `json:"max_temp,omitempty"`
+}
+
+// option returns the heatsink option for this schedule
+func (c configSchedule) option() (heatsink.Option, error) {
+
+	start, err := parseTimeOfDay(c.Start)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseTimeOfDay(c.End)
+	if err != nil {
+		return nil, err
+	}
+	if start == end {
+		return nil, fmt.Errorf("%w: '%s' starts and ends at '%s'", errBadSchedule, c.Name, c.Start)
+	}
+	hasRange := c.MinTemp != 0 || c.MaxTemp != 0
+	if hasRange && c.MinTemp >= c.MaxTemp {
+		return nil, fmt.Errorf(
+			"%w: '%s' needs min_temp less than max_temp, got [%v, %v]",
+			errBadSchedule, c.Name, c.MinTemp, c.MaxTemp,
+		)
+	}
+
+	maxDutyCycle := -1.0
+	if c.MaxDutyCycle != nil {
+		maxDutyCycle = *c.MaxDutyCycle
+	}
+	return heatsink.OptSchedule(heatsink.Schedule{
+		Name:           c.Name,
+		Start:          start,
+		End:            end,
+		MaxDutyCycle:   maxDutyCycle,
+		UnlessAbove:    c.UnlessAbove,
+		MinTemperature: c.MinTemp,
+		MaxTemperature: c.MaxTemp,
+	}), nil
+}
+
+// parseTimeOfDay returns the offset from midnight of the given "HH:MM" time of day
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", errBadSchedule, err)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
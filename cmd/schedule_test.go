@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func Test_configSchedule_option(t *testing.T) {
+	t.Parallel()
+
+	quiet := 0.4
+	cases := map[string]struct {
+		sched    configSchedule
+		expected error
+	}{
+		"valid": {
+			sched:    configSchedule{Name: "night", Start: "22:00", End: "07:00", MaxDutyCycle: &quiet, UnlessAbove: 80},
+			expected: nil,
+		},
+		"curve-only": {
+			sched:    configSchedule{Name: "night", Start: "22:00", End: "07:00", MinTemp: 50, MaxTemp: 85},
+			expected: nil,
+		},
+		"bad-start": {
+			sched:    configSchedule{Name: "night", Start: "10pm", End: "07:00"},
+			expected: errBadSchedule,
+		},
+		"bad-end": {
+			sched:    configSchedule{Name: "night", Start: "22:00", End: "25:00"},
+			expected: errBadSchedule,
+		},
+		"empty-window": {
+			sched:    configSchedule{Name: "night", Start: "22:00", End: "22:00"},
+			expected: errBadSchedule,
+		},
+		"bad-range": {
+			sched:    configSchedule{Name: "night", Start: "22:00", End: "07:00", MinTemp: 85, MaxTemp: 50},
+			expected: errBadSchedule,
+		},
+	}
+	for name, testCase := range cases {
+		opt, err := testCase.sched.option()
+		if !errors.Is(err, testCase.expected) {
+			t.Errorf("%s: unexpected error\nwant: %v\n got: %v", name, testCase.expected, err)
+		}
+		if err == nil && opt == nil {
+			t.Errorf("%s: expected an option", name)
+		}
+	}
+}
+
+func Test_parseTimeOfDay(t *testing.T) {
+	t.Parallel()
+
+	actual, err := parseTimeOfDay("07:30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := 7*time.Hour + 30*time.Minute; actual != expected {
+		t.Fatalf("unexpected offset\nwant: %v\n got: %v", expected, actual)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"io/ioutil"
+	"reflect"
+
+	"go.uber.org/zap"
+)
+
+// schemaDraft is the JSON Schema dialect of the generated schemas
+const schemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// schemaProvider is implemented by config types whose json encoding differs from that of their
+// Go type, e.g. because they implement json.Unmarshaler
+type schemaProvider interface {
+	jsonSchema() map[string]interface{}
+}
+
+// configSchema returns a JSON Schema of the config format, which is generated from the config
+// structs so that it never falls behind them. Objects do not allow properties the daemon does
+// not know, like a strict config, so that editors flag typos
+func configSchema(typ reflect.Type, title string) map[string]interface{} {
+	schema := typeSchema(typ, make(map[reflect.Type]bool))
+	schema["$schema"] = schemaDraft
+	schema["title"] = title
+	return schema
+}
+
+// typeSchema returns the schema of the json encoding of the given type. Types that are being
+// visited are given an empty schema, which accepts anything, to stop recursive types
+func typeSchema(typ reflect.Type, visiting map[reflect.Type]bool) map[string]interface{} {
+
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if visiting[typ] {
+		return map[string]interface{}{}
+	}
+	if provider, ok := reflect.Zero(typ).Interface().(schemaProvider); ok {
+		return provider.jsonSchema()
+	}
+
+	switch typ.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(typ.Elem(), visiting)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(typ.Elem(), visiting)}
+	case reflect.Struct:
+		visiting[typ] = true
+		defer delete(visiting, typ)
+		fields := jsonFields(typ)
+		props := make(map[string]interface{}, len(fields))
+		for name, field := range fields {
+			props[name] = typeSchema(field, visiting)
+		}
+		return map[string]interface{}{"type": "object", "properties": props, "additionalProperties": false}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// runSchema implements the 'schema' subcommand, which writes the JSON Schema of the config
+// format, or of the agent's config format, to stdout or to the given output file
+func runSchema(args []string, stdout io.Writer) (exitCode int) {
+
+	logger := newLogger(logSettings{})
+	defer logger.Sync()
+
+	flags := flag.NewFlagSet("schema", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	output := flags.String("o", "", "output file (default: stdout)")
+	agent := flags.Bool("agent", false, "emit the schema of the agent's config instead of the daemon's")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 0 {
+		logger.Error("invalid arguments", zap.String("usage", "schema [-agent] [-o <output>]"))
+		return 64
+	}
+
+	schema := configSchema(reflect.TypeOf(config{}), "heatsink config")
+	if *agent {
+		schema = configSchema(reflect.TypeOf(configAgent{}), "heatsink agent config")
+	}
+	encoded, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		logger.Error("encoding schema", zap.Error(err))
+		return 70
+	}
+	encoded = append(encoded, '\n')
+
+	if *output == "" {
+		_, err = stdout.Write(encoded)
+	} else {
+		err = ioutil.WriteFile(*output, encoded, 0644)
+	}
+	if err != nil {
+		logger.Error("writing schema", zap.Error(err))
+		return 73
+	}
+	return 0
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-test/deep"
+	"go.uber.org/zap"
+)
+
+func Test_runSchema(t *testing.T) {
+
+	origNewLogger := newLogger
+	defer func() { newLogger = origNewLogger }()
+	newLogger = func(logSettings) *zap.Logger { return zap.NewNop() }
+
+	var stdout bytes.Buffer
+	if expected, actual := 0, runSchema(nil, &stdout); expected != actual {
+		t.Fatalf("actual exit code doesn't match expected\nwant: %d\n got: %d", expected, actual)
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(stdout.Bytes(), &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		path     []string
+		expected interface{}
+	}{
+		{path: []string{"$schema"}, expected: schemaDraft},
+		{path: []string{"additionalProperties"}, expected: false},
+		{path: []string{"properties", "$schema", "type"}, expected: "string"},
+		{path: []string{"properties", "strict", "type"}, expected: "boolean"},
+		{path: []string{"properties", "version", "type"}, expected: "integer"},
+		{path: []string{"properties", "heatsinks", "type"}, expected: "array"},
+		{path: []string{"properties", "heatsinks", "items", "properties", "min_temp", "type"}, expected: "number"},
+		{path: []string{"properties", "heatsinks", "items", "properties", "temp_check_period", "type"}, expected: []interface{}{"string", "number"}},
+		{path: []string{"properties", "heatsinks", "items", "properties", "sensor_path_globs", "items", "type"}, expected: "string"},
+		{path: []string{"properties", "heatsinks", "items", "properties", "fan", "properties", "response_type", "type"}, expected: "string"},
+		{path: []string{"properties", "heatsinks", "items", "properties", "profiles", "additionalProperties", "properties", "max_duty_cycle", "type"}, expected: "number"},
+	}
+	for _, tc := range testCases {
+		var actual interface{} = schema
+		for _, key := range tc.path {
+			obj, _ := actual.(map[string]interface{})
+			actual = obj[key]
+		}
+		if diff := deep.Equal(tc.expected, actual); diff != nil {
+			t.Errorf("%v: unexpected schema\nwant: %v\n got: %v", tc.path, tc.expected, actual)
+		}
+	}
+	if _, ok := schema["properties"].(map[string]interface{})["logger"]; ok {
+		t.Error("expected unexported fields not to be part of the schema")
+	}
+
+	dir, err := ioutil.TempDir("", "heatsink-schema")
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "agent.schema.json")
+	defer removeFile(t, dir)
+	defer removeFile(t, output)
+	if code := runSchema([]string{"-agent", "-o", output}, nil); code != 0 {
+		t.Fatalf("expected exit code 0 writing the agent schema to a file, got: %d", code)
+	}
+	written, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var agentSchema map[string]interface{}
+	if err := json.Unmarshal(written, &agentSchema); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := agentSchema["properties"].(map[string]interface{})["fan_timeout"]; !ok {
+		t.Errorf("expected the agent schema to have the agent's fields, got: %v", agentSchema["properties"])
+	}
+
+	if expected, actual := 64, runSchema([]string{"extra"}, nil); expected != actual {
+		t.Errorf("actual exit code doesn't match expected\nwant: %d\n got: %d", expected, actual)
+	}
+}
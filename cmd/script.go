@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/malkhamis/heatsink"
+	"go.uber.org/zap"
+)
+
+var (
+	errControlScript       = errors.New("control script must have a command")
+	errControlScriptOutput = errors.New("control script wrote too much output")
+	errControlScriptAnswer = errors.New("invalid answer of control script")
+)
+
+const (
+	defaultControlScriptInterval = 2 * time.Second
+	defaultControlScriptTimeout  = time.Second
+	// maxControlScriptOutput limits how much a control script may write per run
+	maxControlScriptOutput = 4096
+)
+
+// configControlScript is a user-provided program that is run periodically for policies too
+// complex for the config. It receives the last sample of every heatsink as JSON on its standard
+// input and answers with a JSON object that maps heatsink names to duty cycle ratios. The
+// program runs with only the given environment variables and is killed once the timeout
+// elapses
+type configControlScript struct {
+	Command []string `json:"command"`
+	Env     []string `json:"env,omitempty"`
+	// Interval and Timeout are durations, or numbers of seconds
+	Interval configDuration `json:"interval,omitempty"`
+	Timeout  configDuration `json:"timeout,omitempty"`
+}
+
+// scriptInput is what a control script receives on its standard input
+type scriptInput struct {
+	Time      time.Time        `json:"time"`
+	Heatsinks []scriptHeatsink `json:"heatsinks"`
+}
+
+// scriptHeatsink is the status of a heatsink along with all the readings of its last sample
+type scriptHeatsink struct {
+	heatsinkStatus
+	Readings []scriptReading `json:"readings"`
+}
+
+// scriptReading is the temperature of a single sensor
+type scriptReading struct {
+	Sensor      string  `json:"sensor"`
+	Temperature float64 `json:"temperature"`
+}
+
+// controlScript overrides the duty cycles of heatsinks with those a control script answers
+// with. Heatsinks the script leaves out, or answers with null for, follow their curves, and so
+// do all of them while the script fails. Manual duty cycles take precedence over the script's
+// and are never touched by it
+type controlScript struct {
+	command   []string
+	env       []string
+	interval  time.Duration
+	timeout   time.Duration
+	heatsinks []*heatsink.Heatsink
+	logger    *zap.Logger
+}
+
+// newControlScript returns the control script of this config for the given heatsinks, or nil
+// if none is configured
+func (c *config) newControlScript(heatsinks []*heatsink.Heatsink) (*controlScript, error) {
+
+	if c.ControlScript == nil {
+		return nil, nil
+	}
+	if len(c.ControlScript.Command) == 0 {
+		return nil, errControlScript
+	}
+	interval, err := c.ControlScript.Interval.duration("interval", time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		interval = defaultControlScriptInterval
+	}
+	timeout, err := c.ControlScript.Timeout.duration("timeout", time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if timeout <= 0 {
+		timeout = defaultControlScriptTimeout
+	}
+
+	return &controlScript{
+		command:   c.ControlScript.Command,
+		env:       append([]string{}, c.ControlScript.Env...),
+		interval:  interval,
+		timeout:   timeout,
+		heatsinks: heatsinks,
+		logger:    c.logger,
+	}, nil
+}
+
+// input returns what the script receives, i.e. the last sample of every heatsink
+func (s *controlScript) input() scriptInput {
+	in := scriptInput{Time: time.Now(), Heatsinks: make([]scriptHeatsink, len(s.heatsinks))}
+	for i, hs := range s.heatsinks {
+		in.Heatsinks[i] = scriptHeatsink{heatsinkStatus: newHeatsinkStatus(hs), Readings: []scriptReading{}}
+		for _, r := range hs.LastSample().Readings {
+			in.Heatsinks[i].Readings = append(
+				in.Heatsinks[i].Readings, scriptReading{Sensor: r.Sensor, Temperature: r.Temperature},
+			)
+		}
+	}
+	return in
+}
+
+// run runs the script once with the given input and returns its answer, which only names
+// known heatsinks and holds ratios within [0, 1]
+func (s *controlScript) run(ctx context.Context, input []byte) (map[string]*float64, error) {
+
+	cmd := exec.CommandContext(ctx, s.command[0], s.command[1:]...)
+	cmd.Env = s.env // an empty environment rather than that of the daemon
+	cmd.Stdin = bytes.NewReader(input)
+	// the script writes to a pipe of its own rather than one that exec drains, which would
+	// outlive the timeout as long as a child of the script holds it open
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	cmd.Stdout = w
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		return nil, fmt.Errorf("running '%s': %w", s.command[0], err)
+	}
+	stdout := &cappedBuffer{limit: maxControlScriptOutput}
+	read := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(stdout, r)
+		if errors.Is(err, errControlScriptOutput) {
+			cmd.Process.Kill()
+		}
+		read <- err
+	}()
+	waitErr := cmd.Wait()
+	select {
+	case err = <-read:
+	case <-ctx.Done():
+		select {
+		case err = <-read:
+		default:
+			err = ctx.Err()
+		}
+	}
+	// a script that wrote too much is killed
+	if waitErr != nil && !errors.Is(err, errControlScriptOutput) {
+		return nil, fmt.Errorf("running '%s': %w", s.command[0], waitErr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading the output of '%s': %w", s.command[0], err)
+	}
+
+	var answer map[string]*float64
+	if err := json.Unmarshal(stdout.Bytes(), &answer); err != nil {
+		return nil, fmt.Errorf("%w: %v", errControlScriptAnswer, err)
+	}
+	known := make(map[string]bool, len(s.heatsinks))
+	for _, hs := range s.heatsinks {
+		known[hs.Name()] = true
+	}
+	for name, dc := range answer {
+		if !known[name] {
+			return nil, fmt.Errorf("%w: unknown heatsink '%s'", errControlScriptAnswer, name)
+		}
+		if dc != nil && (*dc < 0 || *dc > 1) {
+			return nil, fmt.Errorf("%w: duty cycle %v of '%s' is not in [0, 1]", errControlScriptAnswer, *dc, name)
+		}
+	}
+	return answer, nil
+}
+
+// evaluate runs the script and applies its answer. If it fails, the heatsinks it drives go
+// back to their curves
+func (s *controlScript) evaluate() {
+
+	input, err := json.Marshal(s.input())
+	if err != nil {
+		s.logger.Error("failed to encode control script input", zap.Error(err))
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	answer, err := s.run(ctx, input)
+	if err != nil {
+		s.logger.Warn("control script failed, heatsinks follow their curves", zap.Error(err))
+		s.release()
+		return
+	}
+
+	for _, hs := range s.heatsinks {
+		if dc := answer[hs.Name()]; dc != nil {
+			hs.SetOverrideDutyCycle(*dc)
+		} else {
+			hs.ClearOverrideDutyCycle()
+		}
+	}
+}
+
+// release returns the heatsinks the script drives to their curves
+func (s *controlScript) release() {
+	for _, hs := range s.heatsinks {
+		hs.ClearOverrideDutyCycle()
+	}
+}
+
+// start runs the script immediately and then periodically. The returned function stops
+// running it and returns the heatsinks to their curves
+func (s *controlScript) start() (stop func()) {
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.evaluate()
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				s.evaluate()
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+		s.release()
+	}
+}
+
+// cappedBuffer collects output up to a limit, beyond which writes fail. It does not embed a
+// bytes.Buffer, whose ReadFrom would let io.Copy bypass the limit
+type cappedBuffer struct {
+	buf   bytes.Buffer
+	limit int
+}
+
+// Write implements the io.Writer interface
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if b.buf.Len()+len(p) > b.limit {
+		return 0, errControlScriptOutput
+	}
+	return b.buf.Write(p)
+}
+
+// Bytes returns the output collected so far
+func (b *cappedBuffer) Bytes() []byte {
+	return b.buf.Bytes()
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/malkhamis/heatsink"
+	"go.uber.org/zap"
+)
+
+func Test_config_newControlScript(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config{logger: zap.NewNop()}
+	if script, err := cfg.newControlScript(nil); script != nil || err != nil {
+		t.Fatalf("expected no control script, got: %v, %v", script, err)
+	}
+
+	cfg.ControlScript = &configControlScript{}
+	if _, err := cfg.newControlScript(nil); !errors.Is(err, errControlScript) {
+		t.Errorf("unexpected error\nwant: %v\n got: %v", errControlScript, err)
+	}
+
+	cfg.ControlScript = &configControlScript{Command: []string{"true"}, Timeout: "soon"}
+	if _, err := cfg.newControlScript(nil); !errors.Is(err, errBadDuration) {
+		t.Errorf("unexpected error\nwant: %v\n got: %v", errBadDuration, err)
+	}
+
+	cfg.ControlScript = &configControlScript{Command: []string{"true"}, Interval: "5"}
+	script, err := cfg.newControlScript(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if script.interval != 5*time.Second || script.timeout != defaultControlScriptTimeout {
+		t.Errorf("unexpected interval and timeout: %v, %v", script.interval, script.timeout)
+	}
+}
+
+func Test_controlScript_evaluate(t *testing.T) {
+	t.Parallel()
+
+	hs, cleanup := testHeatsink(t, "40000")
+	defer cleanup()
+	defer hs.StopThermalControl()
+
+	newScript := func(answer string) *controlScript {
+		return &controlScript{
+			// the answer is passed through the environment, which is all the script gets
+			command:   []string{"sh", "-c", `cat >/dev/null; printf '%s' "$ANSWER"`},
+			env:       []string{"ANSWER=" + answer},
+			interval:  time.Hour,
+			timeout:   5 * time.Second,
+			heatsinks: []*heatsink.Heatsink{hs},
+			logger:    zap.NewNop(),
+		}
+	}
+
+	// a manual duty cycle is never touched by the script
+	hs.SetManualDutyCycle(0.9)
+
+	script := newScript(fmt.Sprintf(`{%q: 0.4}`, hs.Name()))
+	script.evaluate()
+	if dc, ok := hs.OverrideDutyCycle(); !ok || dc != 0.4 {
+		t.Fatalf("expected the heatsink to be driven at 0.4, got: %v, %v", dc, ok)
+	}
+
+	script.env = []string{fmt.Sprintf(`ANSWER={%q: null}`, hs.Name())}
+	script.evaluate()
+	if _, ok := hs.OverrideDutyCycle(); ok {
+		t.Fatal("expected a null answer to return the heatsink to its curve")
+	}
+
+	script.env = []string{fmt.Sprintf(`ANSWER={%q: 0.7}`, hs.Name())}
+	script.evaluate()
+	script.env = []string{"ANSWER=garbage"}
+	script.evaluate()
+	if _, ok := hs.OverrideDutyCycle(); ok {
+		t.Fatal("expected a failed script to return the heatsink to its curve")
+	}
+
+	script = newScript(fmt.Sprintf(`{%q: 0.3}`, hs.Name()))
+	stop := script.start()
+	stop()
+	if _, ok := hs.OverrideDutyCycle(); ok {
+		t.Fatal("expected a stopped script to return the heatsink to its curve")
+	}
+	if dc, ok := hs.ManualDutyCycle(); !ok || dc != 0.9 {
+		t.Fatalf("expected the manual duty cycle to be kept, got: %v, %v", dc, ok)
+	}
+}
+
+func Test_controlScript_run_errors(t *testing.T) {
+	t.Parallel()
+
+	hs, cleanup := testHeatsink(t, "40000")
+	defer cleanup()
+	defer hs.StopThermalControl()
+
+	cases := map[string]struct {
+		script  string
+		timeout time.Duration
+		wantErr error
+	}{
+		"unknown-heatsink": {script: `echo '{"gpu": 0.5}'`, wantErr: errControlScriptAnswer},
+		"out-of-range":     {script: fmt.Sprintf(`echo '{%q: 1.5}'`, hs.Name()), wantErr: errControlScriptAnswer},
+		"too-much-output":  {script: `head -c 100000 /dev/zero`, wantErr: errControlScriptOutput},
+		"timeout":          {script: `exec sleep 5`, timeout: 50 * time.Millisecond},
+		"failure":          {script: `exit 3`},
+	}
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			script := &controlScript{
+				command:   []string{"sh", "-c", c.script},
+				heatsinks: []*heatsink.Heatsink{hs},
+			}
+			timeout := c.timeout
+			if timeout == 0 {
+				timeout = 5 * time.Second
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			start := time.Now()
+			_, err := script.run(ctx, []byte("{}"))
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if c.wantErr != nil && !errors.Is(err, c.wantErr) {
+				t.Errorf("unexpected error\nwant: %v\n got: %v", c.wantErr, err)
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("expected the script to be killed, took: %v", elapsed)
+			}
+		})
+	}
+}
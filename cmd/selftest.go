@@ -0,0 +1,39 @@
+package main
+
+import (
+	"github.com/malkhamis/heatsink"
+	"go.uber.org/zap"
+)
+
+// runSelfTest self-tests every device of the given heatsinks, logs the outcome of each check,
+// and reports whether all of them passed
+func runSelfTest(heatsinks []*heatsink.Heatsink, logger *zap.Logger) (passed bool) {
+
+	passed = true
+	numChecks, numFailed := 0, 0
+	for _, hs := range heatsinks {
+		for _, check := range hs.SelfTest() {
+			numChecks++
+			fields := []zap.Field{
+				zap.String("heatsink", hs.Name()),
+				zap.String("kind", check.Kind),
+				zap.String("device", check.Device),
+			}
+			switch {
+			case !check.Passed():
+				passed = false
+				numFailed++
+				logger.Error("self-test failed", append(fields, zap.Error(check.Err))...)
+			case check.Skipped:
+				logger.Info("self-test skipped, the device cannot be tested", fields...)
+			case check.Kind == heatsink.DeviceFan:
+				logger.Info("self-test passed", fields...)
+			default:
+				logger.Info("self-test passed", append(fields, zap.Float64("temperature", check.Temperature))...)
+			}
+		}
+	}
+
+	logger.Info("self-test finished", zap.Bool("passed", passed), zap.Int("checks", numChecks), zap.Int("failed", numFailed))
+	return passed
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/malkhamis/heatsink"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func Test_runSelfTest(t *testing.T) {
+
+	hs, cleanup := testHeatsink(t, "40000")
+	defer cleanup()
+	defer hs.StopThermalControl()
+
+	core, logs := observer.New(zap.InfoLevel)
+	if !runSelfTest([]*heatsink.Heatsink{hs}, zap.New(core)) {
+		t.Fatalf("expected the self-test to pass, got: %v", logs.All())
+	}
+	passed := logs.FilterMessage("self-test passed").All()
+	if len(passed) != 2 {
+		t.Fatalf("expected a passed check of the sensor and the fan, got: %v", logs.All())
+	}
+	if kind := passed[0].ContextMap()["kind"]; kind != heatsink.DeviceSensor {
+		t.Errorf("expected the sensor to be checked first, got: %v", kind)
+	}
+	if temp := passed[0].ContextMap()["temperature"]; temp != 40.0 {
+		t.Errorf("unexpected temperature\nwant: %v\n got: %v", 40.0, temp)
+	}
+
+	// a stopped heatsink closed its devices
+	hs.StopThermalControl()
+	core, logs = observer.New(zap.InfoLevel)
+	if runSelfTest([]*heatsink.Heatsink{hs}, zap.New(core)) {
+		t.Fatal("expected the self-test of closed devices to fail")
+	}
+	if failed := logs.FilterMessage("self-test failed").Len(); failed != 2 {
+		t.Errorf("expected both devices to fail, got: %v", logs.All())
+	}
+}
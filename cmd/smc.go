@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/malkhamis/heatsink"
+	"github.com/malkhamis/heatsink/smc"
+	"go.uber.org/zap"
+)
+
+// smcPrefix marks path globs that address the System Management Controller of a Mac instead
+// of a file, e.g. 'smc:TC0P' for a sensor key or 'smc:0' for the first fan
+const smcPrefix = "smc:"
+
+var errSMCFanIndex = errors.New("invalid smc fan index")
+
+// smcAddress returns the SMC key or fan index that the given path glob addresses, if any
+func smcAddress(pattern string) (string, bool) {
+	if !strings.HasPrefix(pattern, smcPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(pattern, smcPrefix), true
+}
+
+func newSMCSensor(key, name string, logger *zap.Logger) (heatsink.ThermoSensor, error) {
+	sensor, err := smc.NewSensor(key, smc.OptName(name))
+	if err != nil {
+		return nil, fmt.Errorf("'%s%s': %w", smcPrefix, key, err)
+	}
+	logger.Info("created smc sensor", zap.String("name", sensor.Name()), zap.String("key", key))
+	return sensor, nil
+}
+
+func (c configFan) newSMCFan(index string, logger *zap.Logger) (heatsink.FanDriver, error) {
+
+	i, err := strconv.Atoi(index)
+	if err != nil || i < 0 {
+		return nil, fmt.Errorf("%w: '%s'", errSMCFanIndex, index)
+	}
+	if c.dryRun {
+		logger.Info("created dry-run fan", zap.String("name", c.Name), zap.String("filename", smcPrefix+index))
+		return newDryRunFan(c.Name, smcPrefix+index, logger), nil
+	}
+	fan, err := smc.NewFan(i, smc.OptName(c.Name))
+	if err != nil {
+		return nil, fmt.Errorf("'%s%s': %w", smcPrefix, index, err)
+	}
+	logger.Info(
+		"created smc fan",
+		zap.String("name", fan.Name()),
+		zap.Int("index", i),
+		zap.String("response_type", c.RespType),
+	)
+	return fan, nil
+}
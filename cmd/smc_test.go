@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+
+	"github.com/malkhamis/heatsink/smc"
+	"go.uber.org/zap"
+)
+
+func Test_configFan_newFan_smc(t *testing.T) {
+
+	cases := map[string]struct {
+		fan         configFan
+		expectedErr error
+	}{
+		"bad index":      {fan: configFan{PathGlob: "smc:fan0"}, expectedErr: errSMCFanIndex},
+		"negative index": {fan: configFan{PathGlob: "smc:-1"}, expectedErr: errSMCFanIndex},
+		"dry run":        {fan: configFan{PathGlob: "smc:0", dryRun: true}},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			fan, err := c.fan.newFan(zap.NewNop())
+			if !errors.Is(err, c.expectedErr) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", c.expectedErr, err)
+			}
+			if err == nil {
+				_ = fan.Close()
+			}
+		})
+	}
+}
+
+func Test_configSensors_newSensors_smc(t *testing.T) {
+	if runtime.GOOS == "darwin" {
+		t.Skip("smc is supported on macOS")
+	}
+	_, err := configSensors{"smc:TC0P"}.newSensors(zap.NewNop())
+	if !errors.Is(err, smc.ErrUnsupported) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", smc.ErrUnsupported, err)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/malkhamis/heatsink"
+	"github.com/malkhamis/heatsink/snmpsense"
+	"go.uber.org/zap"
+)
+
+// configSNMP polls an SNMP object for a temperature, e.g. the inlet probe of a PDU. Scale
+// converts the object's value to degrees celsius, e.g. 0.1 for tenths of a degree. If V3 is
+// set, SNMPv3 is used instead of SNMPv2c and the community is ignored
+type configSNMP struct {
+	Target    string        `json:"target"`
+	OID       string        `json:"oid"`
+	Community string        `json:"community,omitempty"`
+	Scale     float64       `json:"scale,omitempty"`
+	Retries   *int          `json:"retries,omitempty"`
+	V3        *configSNMPv3 `json:"v3,omitempty"`
+}
+
+// configSNMPv3 holds the credentials of an SNMPv3 user. Protocols are "MD5" or "SHA" for
+// authentication and "AES" for privacy, and may be omitted for lower security levels
+type configSNMPv3 struct {
+	User         string `json:"user"`
+	AuthProtocol string `json:"auth_protocol,omitempty"`
+	AuthPassword string `json:"auth_password,omitempty"`
+	PrivProtocol string `json:"priv_protocol,omitempty"`
+	PrivPassword string `json:"priv_password,omitempty"`
+}
+
+func (c configRemoteSensor) newSNMPSensor(logger *zap.Logger) (heatsink.ThermoSensor, error) {
+
+	options := []snmpsense.Option{snmpsense.OptName(c.Name)}
+	if c.SNMP.Community != "" {
+		options = append(options, snmpsense.OptCommunity(c.SNMP.Community))
+	}
+	if c.SNMP.Scale != 0 {
+		options = append(options, snmpsense.OptScale(c.SNMP.Scale))
+	}
+	if c.SNMP.Retries != nil {
+		options = append(options, snmpsense.OptRetries(*c.SNMP.Retries))
+	}
+	if c.Timeout != "" {
+		timeout, err := time.ParseDuration(c.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errBadDuration, err)
+		}
+		options = append(options, snmpsense.OptTimeout(timeout))
+	}
+	version := "2c"
+	if v3 := c.SNMP.V3; v3 != nil {
+		version = "3"
+		options = append(options, snmpsense.OptV3(snmpsense.USM{
+			User:         v3.User,
+			AuthProtocol: snmpsense.AuthProtocol(v3.AuthProtocol),
+			AuthPassword: v3.AuthPassword,
+			PrivProtocol: snmpsense.PrivProtocol(v3.PrivProtocol),
+			PrivPassword: v3.PrivPassword,
+		}))
+	}
+
+	sensor, err := snmpsense.New(c.SNMP.Target, c.SNMP.OID, options...)
+	if err != nil {
+		return nil, fmt.Errorf("snmp sensor '%s': %w", c.Name, err)
+	}
+	logger.Info(
+		"created snmp sensor",
+		zap.String("name", c.Name),
+		zap.String("target", c.SNMP.Target),
+		zap.String("oid", c.SNMP.OID),
+		zap.String("version", version),
+	)
+	return sensor, nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/malkhamis/heatsink/snmpsense"
+	"go.uber.org/zap"
+)
+
+func Test_configRemoteSensor_newSensor_snmp(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		json        string
+		expectedErr error
+	}{
+		"v2c": {json: `{"name": "inlet", "snmp": {"target": "pdu.local", "oid": "1.3.6.1.4.1.318.1", "scale": 0.1}}`},
+		"v3": {json: `{"name": "inlet", "snmp": {"target": "pdu.local", "oid": "1.3.6.1.4.1.318.1",
+			"v3": {"user": "monitor", "auth_protocol": "SHA", "auth_password": "authpass1", "priv_protocol": "AES", "priv_password": "privpass1"}}}`},
+		"bad oid": {
+			json:        `{"name": "inlet", "snmp": {"target": "pdu.local", "oid": "inlet"}}`,
+			expectedErr: snmpsense.ErrBadOID,
+		},
+		"bad security": {
+			json:        `{"name": "inlet", "snmp": {"target": "pdu.local", "oid": "1.3.6.1", "v3": {"user": "monitor", "priv_protocol": "AES"}}}`,
+			expectedErr: snmpsense.ErrBadSecurity,
+		},
+		"bad retries": {
+			json:        `{"name": "inlet", "snmp": {"target": "pdu.local", "oid": "1.3.6.1", "retries": -1}}`,
+			expectedErr: snmpsense.ErrBadParameters,
+		},
+		"bad timeout": {
+			json:        `{"name": "inlet", "timeout": "2", "snmp": {"target": "pdu.local", "oid": "1.3.6.1"}}`,
+			expectedErr: errBadDuration,
+		},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			cfg, err := newConfig(strings.NewReader(`{"heatsinks": [{}], "remote_sensors": [`+c.json+`]}`), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sensor, err := cfg.named.newSensor("inlet", zap.NewNop())
+			if !errors.Is(err, c.expectedErr) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", c.expectedErr, err)
+			}
+			if err == nil && sensor.Name() != "inlet" {
+				t.Fatalf("unexpected name\nwant: inlet\n got: %s", sensor.Name())
+			}
+		})
+	}
+}
+
+func Test_configRemoteSensor_location(t *testing.T) {
+	remote := configRemoteSensor{SNMP: &configSNMP{Target: "pdu.local:161", OID: ".1.3.6.1.4.1.318.1"}}
+	if expected, actual := "snmp://pdu.local:161/1.3.6.1.4.1.318.1", remote.location(); expected != actual {
+		t.Fatalf("unexpected location\nwant: %s\n got: %s", expected, actual)
+	}
+}
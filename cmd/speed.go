@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/malkhamis/heatsink/fanpwm"
+)
+
+var errBadSpeedValue = errors.New("invalid fan speed value")
+
+// configSpeed is a pwm value of the config, e.g. 'min_speed_value', which is an integer in the
+// range [0, 255]. A string holding such an integer, e.g. "255", is accepted as well
+type configSpeed string
+
+// UnmarshalJSON accepts a json number or string. Any other value is kept verbatim, so that
+// parsing it fails with an error that names the field rather than failing to decode the config
+func (s *configSpeed) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		*s = configSpeed(str)
+		return nil
+	}
+	*s = configSpeed(bytes.TrimSpace(data))
+	return nil
+}
+
+// MarshalJSON encodes an integer value as a json number, e.g. in the configs that 'install'
+// generates, and any other value as a string
+func (s configSpeed) MarshalJSON() ([]byte, error) {
+	if val, err := strconv.Atoi(string(s)); err == nil {
+		return []byte(strconv.Itoa(val)), nil
+	}
+	return json.Marshal(string(s))
+}
+
+// value returns the pwm value of the given field, or the given default if the field is empty
+func (s configSpeed) value(field string, def int) (int, error) {
+	if s == "" {
+		return def, nil
+	}
+	val, err := strconv.Atoi(string(s))
+	if err != nil || val < 0 || val > fanpwm.MaxSpeed {
+		return 0, fmt.Errorf("%w: %s must be an integer in [0, %d], got: %s", errBadSpeedValue, field, fanpwm.MaxSpeed, s)
+	}
+	return val, nil
+}
+
+// jsonSchema returns the schema of a speed value field
+func (configSpeed) jsonSchema() map[string]interface{} {
+	return map[string]interface{}{"type": []string{"integer", "string"}, "minimum": 0, "maximum": fanpwm.MaxSpeed}
+}
+
+// speedRange returns the min and max pwm values of the fan, where the min must be below the max
+func (c configFan) speedRange() (min, max int, err error) {
+	if min, err = c.MinSpeedVal.value("min_speed_value", 0); err != nil {
+		return 0, 0, err
+	}
+	if max, err = c.MaxSpeedVal.value("max_speed_value", fanpwm.MaxSpeed); err != nil {
+		return 0, 0, err
+	}
+	if min >= max {
+		return 0, 0, fmt.Errorf("%w: min_speed_value %d must be less than max_speed_value %d", errBadSpeedValue, min, max)
+	}
+	return min, max, nil
+}
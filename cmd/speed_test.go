@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func Test_configFan_speedRange(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		jsonData    string
+		expectedMin int
+		expectedMax int
+		expectedErr error
+	}{
+		{jsonData: `{}`, expectedMin: 0, expectedMax: 255},
+		{jsonData: `{"min_speed_value": 30, "max_speed_value": 200}`, expectedMin: 30, expectedMax: 200},
+		{jsonData: `{"min_speed_value": "30", "max_speed_value": "200"}`, expectedMin: 30, expectedMax: 200},
+		{jsonData: `{"min_speed_value": "", "max_speed_value": 255}`, expectedMin: 0, expectedMax: 255},
+		{jsonData: `{"min_speed_value": -1}`, expectedErr: errBadSpeedValue},
+		{jsonData: `{"max_speed_value": 256}`, expectedErr: errBadSpeedValue},
+		{jsonData: `{"max_speed_value": 99.5}`, expectedErr: errBadSpeedValue},
+		{jsonData: `{"max_speed_value": "full"}`, expectedErr: errBadSpeedValue},
+		{jsonData: `{"max_speed_value": true}`, expectedErr: errBadSpeedValue},
+		{jsonData: `{"min_speed_value": 200, "max_speed_value": 100}`, expectedErr: errBadSpeedValue},
+		{jsonData: `{"min_speed_value": 100, "max_speed_value": 100}`, expectedErr: errBadSpeedValue},
+	}
+
+	for _, tc := range testCases {
+		var fan configFan
+		if err := json.Unmarshal([]byte(tc.jsonData), &fan); err != nil {
+			t.Errorf("%s: unexpected error decoding: %v", tc.jsonData, err)
+			continue
+		}
+		min, max, err := fan.speedRange()
+		if !errors.Is(err, tc.expectedErr) {
+			t.Errorf("%s: unexpected error\nwant: %v\n got: %v", tc.jsonData, tc.expectedErr, err)
+		}
+		if min != tc.expectedMin || max != tc.expectedMax {
+			t.Errorf("%s: unexpected speed range\nwant: [%d, %d]\n got: [%d, %d]", tc.jsonData, tc.expectedMin, tc.expectedMax, min, max)
+		}
+	}
+}
+
+func Test_newConfig_badSpeedValue(t *testing.T) {
+	t.Parallel()
+
+	jsonData := `{"heatsinks": [{"name": "cpu", "fan": {"min_speed_value": 0, "max_speed_value": 300}}]}`
+	_, err := newConfig(strings.NewReader(jsonData), nil)
+	if !errors.Is(err, errBadSpeedValue) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", errBadSpeedValue, err)
+	}
+	if !strings.Contains(err.Error(), "max_speed_value") || !strings.Contains(err.Error(), "cpu") {
+		t.Errorf("expected the error to name the heatsink and the field, got: %v", err)
+	}
+}
+
+func Test_configFan_newFan_speedValues(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]string{
+		"integers": `"min_speed_value": 10, "max_speed_value": 200`,
+		"strings":  `"min_speed_value": "10", "max_speed_value": "200"`,
+	}
+	for name, speedValues := range testCases {
+		fanFile, cleanup := temporaryFile(t)
+		defer cleanup()
+
+		var fanCfg configFan
+		jsonData := fmt.Sprintf(`{"path_glob": %q, %s}`, fanFile.Name(), speedValues)
+		if err := json.Unmarshal([]byte(jsonData), &fanCfg); err != nil {
+			t.Fatal(err)
+		}
+		fan, err := fanCfg.newFan(zap.NewNop())
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if err := fan.SetDutyCycle(0); err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile(fanFile.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := "10", string(data); actual != expected {
+			t.Errorf("%s: unexpected pwm value of the min speed\nwant: %q\n got: %q", name, expected, actual)
+		}
+		if err := fan.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if data, err = ioutil.ReadFile(fanFile.Name()); err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := "200", string(data); actual != expected {
+			t.Errorf("%s: unexpected pwm value after close\nwant: %q\n got: %q", name, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/malkhamis/heatsink"
+	"go.uber.org/zap"
+)
+
+// stateSaveInterval is how often the state is persisted while the daemon is running
+var stateSaveInterval = 30 * time.Second
+
+// daemonState is what the daemon persists across restarts, keyed by heatsink name
+type daemonState struct {
+	Heatsinks map[string]heatsinkState `json:"heatsinks"`
+}
+
+type heatsinkState struct {
+	DutyCycle       *float64 `json:"duty_cycle,omitempty"`
+	ManualDutyCycle *float64 `json:"manual_duty_cycle,omitempty"`
+	// DutyCycleSeconds is the time in seconds spent in each band of the duty cycle histogram
+	DutyCycleSeconds []float64 `json:"duty_cycle_seconds,omitempty"`
+}
+
+// loadState reads the state persisted in the given file. A missing file is not an error and
+// results in an empty state
+func loadState(filename string) (daemonState, error) {
+
+	state := daemonState{Heatsinks: make(map[string]heatsinkState)}
+	data, err := ioutil.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return daemonState{Heatsinks: make(map[string]heatsinkState)}, fmt.Errorf("decoding state: %w", err)
+	}
+	if state.Heatsinks == nil {
+		state.Heatsinks = make(map[string]heatsinkState)
+	}
+	return state, nil
+}
+
+// options returns the heatsink options that restore this state
+func (s heatsinkState) options() []heatsink.Option {
+	var opts []heatsink.Option
+	if s.DutyCycle != nil {
+		opts = append(opts, heatsink.OptInitialDutyCycle(*s.DutyCycle))
+	}
+	if len(s.DutyCycleSeconds) == heatsink.DutyCycleBands {
+		opts = append(opts, heatsink.OptDutyCycleHistogram(s.histogram()))
+	}
+	return opts
+}
+
+// histogram converts the persisted duty cycle histogram. Band times that were not persisted
+// are zero
+func (s heatsinkState) histogram() heatsink.DutyCycleHistogram {
+	var h heatsink.DutyCycleHistogram
+	for i := 0; i < len(h) && i < len(s.DutyCycleSeconds); i++ {
+		h[i] = time.Duration(s.DutyCycleSeconds[i] * float64(time.Second))
+	}
+	return h
+}
+
+// restore restores the parts of this state that cannot be restored using options
+func (s heatsinkState) restore(hs *heatsink.Heatsink) {
+	if s.ManualDutyCycle != nil {
+		hs.SetManualDutyCycle(*s.ManualDutyCycle)
+	}
+}
+
+// capture updates the state with the last applied and manual duty cycles and the duty cycle
+// histograms of the given heatsinks. Heatsinks that did not apply a duty cycle yet keep their previous state
+func (s daemonState) capture(heatsinks []*heatsink.Heatsink) {
+	for _, hs := range heatsinks {
+		hsState := s.Heatsinks[hs.Name()]
+		if last := hs.LastSample(); !last.Time.IsZero() {
+			dc := last.DutyCycle
+			hsState.DutyCycle = &dc
+		}
+		hsState.DutyCycleSeconds = make([]float64, heatsink.DutyCycleBands)
+		for i, d := range hs.DutyCycleHistogram() {
+			hsState.DutyCycleSeconds[i] = d.Seconds()
+		}
+		hsState.ManualDutyCycle = nil
+		if manual, ok := hs.ManualDutyCycle(); ok {
+			hsState.ManualDutyCycle = &manual
+		}
+		s.Heatsinks[hs.Name()] = hsState
+	}
+}
+
+// save atomically writes the state to the given file
+func (s daemonState) save(filename string) (err error) {
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpFile, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(tmpFile.Name())
+		}
+	}()
+
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), filename)
+}
+
+// startStateSaver periodically persists the state of the given heatsinks to the given file.
+// The returned function stops saving periodically and persists the state one last time
+func startStateSaver(
+	filename string, state daemonState, heatsinks []*heatsink.Heatsink, logger *zap.Logger,
+) (stop func()) {
+
+	save := func() {
+		state.capture(heatsinks)
+		if err := state.save(filename); err != nil {
+			logger.Error("failed to persist state", zap.Error(err), zap.String("filename", filename))
+		}
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(stateSaveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				save()
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+		save()
+	}
+}
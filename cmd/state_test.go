@@ -0,0 +1,210 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/malkhamis/heatsink"
+	"go.uber.org/zap"
+)
+
+func Test_loadState(t *testing.T) {
+
+	tmpDir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	state, err := loadState(filepath.Join(tmpDir, "does-not-exist.json"))
+	if err != nil {
+		t.Fatalf("expected no error given a missing state file, got: %v", err)
+	}
+	if diff := deep.Equal(state, daemonState{Heatsinks: map[string]heatsinkState{}}); diff != nil {
+		t.Fatal(diff)
+	}
+
+	corrupt := filepath.Join(tmpDir, "corrupt.json")
+	if err := ioutil.WriteFile(corrupt, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadState(corrupt); err == nil {
+		t.Fatal("expected an error given a corrupt state file")
+	}
+}
+
+func Test_daemonState_roundTrip(t *testing.T) {
+
+	hs, cleanup := testHeatsink(t, "40000")
+	defer cleanup()
+
+	go hs.StartThermalControl()
+	for deadline := time.After(time.Second); hs.LastSample().Time.IsZero(); {
+		select {
+		case <-deadline:
+			t.Fatal("timeout waiting for a control iteration")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	hs.SetManualDutyCycle(0.6)
+	hs.StopThermalControl()
+
+	tmpDir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	filename := filepath.Join(tmpDir, "state.json")
+
+	stale := 0.1
+	state := daemonState{Heatsinks: map[string]heatsinkState{
+		"other": {DutyCycle: &stale},
+	}}
+	state.capture([]*heatsink.Heatsink{hs})
+	if err := state.save(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := loadState(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last, manual := hs.LastSample().DutyCycle, 0.6
+	var seconds []float64
+	for _, d := range hs.DutyCycleHistogram() {
+		seconds = append(seconds, d.Seconds())
+	}
+	expected := daemonState{Heatsinks: map[string]heatsinkState{
+		"other":  {DutyCycle: &stale},
+		t.Name(): {DutyCycle: &last, ManualDutyCycle: &manual, DutyCycleSeconds: seconds},
+	}}
+	if diff := deep.Equal(loaded, expected); diff != nil {
+		t.Fatal(diff)
+	}
+
+	leftovers, err := filepath.Glob(filepath.Join(tmpDir, "*.tmp-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leftovers) > 0 {
+		t.Errorf("expected no temporary files to be left behind, got: %v", leftovers)
+	}
+}
+
+func Test_startStateSaver(t *testing.T) {
+
+	origInterval := stateSaveInterval
+	defer func() { stateSaveInterval = origInterval }()
+	stateSaveInterval = time.Millisecond
+
+	hs, cleanup := testHeatsink(t, "40000")
+	defer cleanup()
+	hs.SetManualDutyCycle(0.3)
+
+	tmpDir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	filename := filepath.Join(tmpDir, "state.json")
+
+	stop := startStateSaver(
+		filename, daemonState{Heatsinks: map[string]heatsinkState{}},
+		[]*heatsink.Heatsink{hs}, zap.NewNop(),
+	)
+	for deadline := time.After(time.Second); ; {
+		if _, err := os.Stat(filename); err == nil {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatal("timeout waiting for the state to be saved periodically")
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	hs.SetManualDutyCycle(0.8)
+	stop()
+
+	loaded, err := loadState(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manual := loaded.Heatsinks[t.Name()].ManualDutyCycle
+	if manual == nil || *manual != 0.8 {
+		t.Fatalf("expected the state to be saved on stop, got: %+v", loaded)
+	}
+}
+
+func Test_config_newHeatsinks_restoresState(t *testing.T) {
+
+	sensorFile, cleanup := temporaryFile(t)
+	defer cleanup()
+	if _, err := sensorFile.WriteString("40000"); err != nil {
+		t.Fatal(err)
+	}
+	fanFile, cleanup := temporaryFile(t)
+	defer cleanup()
+
+	jsonData := strings.NewReader(`
+    {
+      "heatsinks": [
+        {
+          "name": "hs",
+          "max_temp": 50,
+          "fan": {"path_glob": "` + fanFile.Name() + `"},
+          "sensor_path_globs": ["` + sensorFile.Name() + `"]
+        }
+      ]
+    }
+  `)
+	cfg, err := newConfig(jsonData, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc, manual := 0.4, 0.7
+	cfg.state = daemonState{Heatsinks: map[string]heatsinkState{
+		"hs": {DutyCycle: &dc, ManualDutyCycle: &manual},
+	}}
+
+	heatsinks, err := cfg.newHeatsinks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer heatsinks[0].StopThermalControl()
+
+	actual, ok := heatsinks[0].ManualDutyCycle()
+	if !ok || actual != manual {
+		t.Fatalf("unexpected manual duty cycle\nwant: %v, true\n got: %v, %v", manual, actual, ok)
+	}
+}
+
+func Test_heatsinkState_options(t *testing.T) {
+	if opts := (heatsinkState{}).options(); len(opts) != 0 {
+		t.Errorf("expected no options given an empty state, got: %d", len(opts))
+	}
+	dc := 0.5
+	if opts := (heatsinkState{DutyCycle: &dc}).options(); len(opts) != 1 {
+		t.Errorf("expected one option given a duty cycle, got: %d", len(opts))
+	}
+	seconds := make([]float64, heatsink.DutyCycleBands)
+	if opts := (heatsinkState{DutyCycleSeconds: seconds}).options(); len(opts) != 1 {
+		t.Errorf("expected one option given a histogram, got: %d", len(opts))
+	}
+	if opts := (heatsinkState{DutyCycleSeconds: seconds[1:]}).options(); len(opts) != 0 {
+		t.Errorf("expected no options given a histogram with missing bands, got: %d", len(opts))
+	}
+}
+
+func Test_heatsinkState_histogram(t *testing.T) {
+	state := heatsinkState{DutyCycleSeconds: []float64{1.5, 0, 60}}
+	expected := heatsink.DutyCycleHistogram{1500 * time.Millisecond, 0, time.Minute}
+	if diff := deep.Equal(state.histogram(), expected); diff != nil {
+		t.Fatal(diff)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/malkhamis/heatsink"
+	"go.uber.org/zap"
+)
+
+var errStatsFormat = errors.New("unknown stats format")
+
+// dutyCycleStats is the duty cycle histogram of a heatsink's fan as reported by 'stats'
+type dutyCycleStats struct {
+	Heatsink     string           `json:"heatsink"`
+	TotalSeconds float64          `json:"total_seconds"`
+	Bands        []dutyCycleShare `json:"bands"`
+}
+
+type dutyCycleShare struct {
+	Band    string  `json:"band"`
+	Seconds float64 `json:"seconds"`
+	// Share is the fraction of the total time spent in this band
+	Share float64 `json:"share"`
+}
+
+// dutyCycleBandLabel returns the range of duty cycle ratios covered by the given band
+func dutyCycleBandLabel(band int) string {
+	return fmt.Sprintf("%.1f-%.1f", float64(band)/heatsink.DutyCycleBands, float64(band+1)/heatsink.DutyCycleBands)
+}
+
+// stats returns the duty cycle histograms in this state, sorted by heatsink name. Heatsinks
+// without a histogram are omitted
+func (s daemonState) stats() []dutyCycleStats {
+
+	var names []string
+	for name, hsState := range s.Heatsinks {
+		if len(hsState.DutyCycleSeconds) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	all := make([]dutyCycleStats, 0, len(names))
+	for _, name := range names {
+		histogram := s.Heatsinks[name].histogram()
+		total := histogram.Total().Seconds()
+		stats := dutyCycleStats{Heatsink: name, TotalSeconds: total}
+		for band, d := range histogram {
+			share := 0.0
+			if total > 0 {
+				share = d.Seconds() / total
+			}
+			stats.Bands = append(stats.Bands, dutyCycleShare{
+				Band:    dutyCycleBandLabel(band),
+				Seconds: d.Seconds(),
+				Share:   share,
+			})
+		}
+		all = append(all, stats)
+	}
+	return all
+}
+
+// writeStatsText writes the given stats to w as a human-readable table per heatsink
+func writeStatsText(w io.Writer, all []dutyCycleStats) error {
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for i, stats := range all {
+		if i > 0 {
+			fmt.Fprintln(tw)
+		}
+		total := time.Duration(stats.TotalSeconds * float64(time.Second)).Round(time.Second)
+		fmt.Fprintf(tw, "%s\t(total: %s)\t\n", stats.Heatsink, total)
+		for _, b := range stats.Bands {
+			d := time.Duration(b.Seconds * float64(time.Second)).Round(time.Second)
+			fmt.Fprintf(tw, "  %s\t%s\t%5.1f%%\n", b.Band, d, 100*b.Share)
+		}
+	}
+	return tw.Flush()
+}
+
+// runStats implements the 'stats' subcommand, which reports how long each fan spent in each
+// duty cycle band according to the given state file
+func runStats(args []string, stdout io.Writer) (exitCode int) {
+
+	logger := newLogger(logSettings{})
+	defer logger.Sync()
+
+	flags := flag.NewFlagSet("stats", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	format := flags.String("format", "text", "output format: 'text' or 'json'")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		logger.Error("invalid arguments", zap.String("usage", "stats [-format text|json] <state_file>"))
+		return 64
+	}
+	filename := flags.Arg(0)
+
+	state, err := loadState(filename)
+	if err != nil {
+		logger.Error("reading the given state file", zap.Error(err), zap.String("filename", filename))
+		return 66
+	}
+
+	all := state.stats()
+	switch *format {
+	case "text":
+		err = writeStatsText(stdout, all)
+	case "json":
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(all)
+	default:
+		err = fmt.Errorf("%w: '%s'", errStatsFormat, *format)
+		logger.Error("invalid arguments", zap.Error(err))
+		return 64
+	}
+	if err != nil {
+		logger.Error("writing stats", zap.Error(err))
+		return 74
+	}
+	return 0
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+	"go.uber.org/zap"
+)
+
+func Test_daemonState_stats(t *testing.T) {
+
+	state := daemonState{Heatsinks: map[string]heatsinkState{
+		"b": {DutyCycleSeconds: []float64{30, 0, 0, 0, 0, 0, 0, 0, 0, 90}},
+		"a": {DutyCycleSeconds: make([]float64, 10)},
+		"c": {},
+	}}
+
+	all := state.stats()
+	var names []string
+	for _, stats := range all {
+		names = append(names, stats.Heatsink)
+	}
+	if diff := deep.Equal(names, []string{"a", "b"}); diff != nil {
+		t.Fatalf("expected heatsinks with histograms sorted by name: %v", diff)
+	}
+	if all[0].Bands[0].Share != 0 {
+		t.Errorf("expected a zero share given no time at all, got: %v", all[0].Bands[0].Share)
+	}
+
+	b := all[1]
+	if b.TotalSeconds != 120 {
+		t.Errorf("unexpected total\nwant: %v\n got: %v", 120.0, b.TotalSeconds)
+	}
+	expectedFirst := dutyCycleShare{Band: "0.0-0.1", Seconds: 30, Share: 0.25}
+	if diff := deep.Equal(b.Bands[0], expectedFirst); diff != nil {
+		t.Error(diff)
+	}
+	expectedLast := dutyCycleShare{Band: "0.9-1.0", Seconds: 90, Share: 0.75}
+	if diff := deep.Equal(b.Bands[9], expectedLast); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func Test_runStats(t *testing.T) {
+
+	stateFile, cleanup := temporaryFile(t)
+	defer cleanup()
+	_, err := stateFile.WriteString(`{"heatsinks":{"hs1":{"duty_cycle_seconds":[3600,0,0,0,0,0,0,0,0,1200]}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	origNewLogger := newLogger
+	defer func() { newLogger = origNewLogger }()
+	newLogger = func(logSettings) *zap.Logger { return zap.NewNop() }
+
+	restoreProcArgs := backupProcArgs(t)
+	defer restoreProcArgs()
+	os.Args = []string{"program-name", "stats", "-format", "bogus", stateFile.Name()}
+	if expected, actual := 64, execute(); expected != actual {
+		t.Fatalf("actual exit code doesn't match expected\nwant: %d\n got: %d", expected, actual)
+	}
+
+	var buf bytes.Buffer
+	if expected, actual := 0, runStats([]string{stateFile.Name()}, &buf); expected != actual {
+		t.Fatalf("actual exit code doesn't match expected\nwant: %d\n got: %d", expected, actual)
+	}
+	for _, expected := range []string{"hs1", "(total: 1h20m0s)", "0.0-0.1", "1h0m0s", "75.0%", "25.0%"} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("expected text output to contain %q, got:\n%s", expected, buf.String())
+		}
+	}
+
+	buf.Reset()
+	if expected, actual := 0, runStats([]string{"-format", "json", stateFile.Name()}, &buf); expected != actual {
+		t.Fatalf("actual exit code doesn't match expected\nwant: %d\n got: %d", expected, actual)
+	}
+	var decoded []dutyCycleStats
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 1 || decoded[0].TotalSeconds != 4800 {
+		t.Errorf("unexpected json output: %s", buf.String())
+	}
+
+	if _, err := stateFile.WriteString("{"); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := 66, runStats([]string{stateFile.Name()}, &buf); expected != actual {
+		t.Fatalf("actual exit code doesn't match expected\nwant: %d\n got: %d", expected, actual)
+	}
+}
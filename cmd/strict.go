@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var errUnknownField = errors.New("unknown config field")
+
+// rejectUnknownFields returns an error naming every field of the config that the daemon does
+// not know, along with where it is, e.g. a typo like 'heatsinks[0].fan.fan_reponse'. Such fields
+// are otherwise ignored, silently leaving the settings they were meant for at their defaults
+func (c *config) rejectUnknownFields() error {
+
+	dec := json.NewDecoder(bytes.NewReader(c.raw))
+	dec.UseNumber()
+	var raw interface{}
+	if err := dec.Decode(&raw); err != nil {
+		return fmt.Errorf("error decoding json config: %w", err)
+	}
+
+	unknown := unknownFields(raw, reflect.TypeOf(c).Elem(), "")
+	if len(unknown) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", errUnknownField, strings.Join(unknown, ", "))
+}
+
+// unknownFields returns the paths of the object keys in the given decoded json value that do
+// not match a field of the given type, which it is decoded into. Like encoding/json, keys match
+// field names case-insensitively
+func unknownFields(raw interface{}, typ reflect.Type, path string) []string {
+
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if reflect.PtrTo(typ).Implements(reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()) {
+		return nil
+	}
+
+	var unknown []string
+	switch val := raw.(type) {
+	case map[string]interface{}:
+		switch typ.Kind() {
+		case reflect.Map:
+			for _, key := range sortedKeys(val) {
+				unknown = append(unknown, unknownFields(val[key], typ.Elem(), joinPath(path, key))...)
+			}
+		case reflect.Struct:
+			fields := jsonFields(typ)
+			for _, key := range sortedKeys(val) {
+				field, ok := fields[key]
+				if !ok {
+					field, ok = foldedField(fields, key)
+				}
+				if !ok {
+					unknown = append(unknown, joinPath(path, key))
+					continue
+				}
+				unknown = append(unknown, unknownFields(val[key], field, joinPath(path, key))...)
+			}
+		}
+	case []interface{}:
+		if typ.Kind() != reflect.Slice && typ.Kind() != reflect.Array {
+			return nil
+		}
+		for i, elem := range val {
+			unknown = append(unknown, unknownFields(elem, typ.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	}
+	return unknown
+}
+
+// jsonFields returns the types of the fields of the given struct type by their json names,
+// including those promoted from embedded structs
+func jsonFields(typ reflect.Type) map[string]reflect.Type {
+
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				for n, t := range jsonFields(embedded) {
+					if _, ok := fields[n]; !ok {
+						fields[n] = t
+					}
+				}
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue // unexported
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+// foldedField returns the type of the field whose name matches the given key ignoring case
+func foldedField(fields map[string]reflect.Type, key string) (reflect.Type, bool) {
+	for name, typ := range fields {
+		if strings.EqualFold(name, key) {
+			return typ, true
+		}
+	}
+	return nil, false
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func Test_newConfig_strict(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		jsonData    string
+		expectedErr error
+		unknown     []string
+	}{
+		{
+			name:     "known fields",
+			jsonData: `{"strict": true, "heatsinks": [{"name": "cpu", "fan": {"response_type": "linear"}}]}`,
+		},
+		{
+			name:     "case-insensitive",
+			jsonData: `{"strict": true, "Heatsinks": [{"NAME": "cpu"}]}`,
+		},
+		{
+			name:     "not strict",
+			jsonData: `{"heatsinks": [{"fan": {"fan_reponse": "linear"}}]}`,
+		},
+		{
+			name: "unknown fields",
+			jsonData: `{
+				"strict": true,
+				"heatsinks": [
+					{"fan": {"fan_reponse": "linear"}},
+					{"profiles": {"quiet": {"max_duty": 0.4}}, "schedules": [{"strat": "22:00"}]}
+				],
+				"logging": {"levle": "debug"}
+			}`,
+			expectedErr: errUnknownField,
+			unknown: []string{
+				"heatsinks[0].fan.fan_reponse",
+				"heatsinks[1].profiles.quiet.max_duty",
+				"heatsinks[1].schedules[0].strat",
+				"logging.levle",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := newConfig(strings.NewReader(tc.jsonData), nil)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", tc.expectedErr, err)
+			}
+			for _, field := range tc.unknown {
+				if !strings.Contains(err.Error(), field) {
+					t.Errorf("expected the error to name '%s', got: %v", field, err)
+				}
+			}
+		})
+	}
+}
+
+func Test_config_rejectUnknownFields(t *testing.T) {
+	t.Parallel()
+
+	jsonData := `{"heatsinks": [{"temp_chek_period": "2s"}]}`
+	cfg, err := newConfig(strings.NewReader(jsonData), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cfg.rejectUnknownFields()
+	if !errors.Is(err, errUnknownField) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", errUnknownField, err)
+	}
+	if !strings.Contains(err.Error(), "heatsinks[0].temp_chek_period") {
+		t.Errorf("expected the error to name the unknown field, got: %v", err)
+	}
+}
+
+func Test_config_rejectUnknownFields_sampleConfig(t *testing.T) {
+	t.Parallel()
+
+	file, err := os.Open("config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	cfg, err := newConfig(file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.rejectUnknownFields(); err != nil {
+		t.Fatalf("expected the sample config to have no unknown fields, got: %v", err)
+	}
+}
+
+func Test_config_rejectUnknownFields_schemaProperty(t *testing.T) {
+	t.Parallel()
+
+	jsonData := `{"$schema": "heatsink.schema.json", "strict": true, "heatsinks": [{}]}`
+	if _, err := newConfig(strings.NewReader(jsonData), nil); err != nil {
+		t.Fatalf("expected a strict config to accept the schema property, got: %v", err)
+	}
+}
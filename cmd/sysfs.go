@@ -0,0 +1,84 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// defaultSysfsRoot is where sysfs is mounted unless the config says otherwise
+const defaultSysfsRoot = "/sys"
+
+// resolveSysfsPath resolves a path glob against the given sysfs root. Relative path globs are
+// joined to the root and path globs under /sys are mapped to the same path under the root,
+// e.g. to control the host's devices from a container that mounts its sysfs at /host/sys.
+// Other absolute path globs and device addresses are returned unchanged, except for the path
+// globs of RAPL domains, which are resolved the same way. An empty root means /sys
+func resolveSysfsPath(root, pattern string) string {
+	if root == "" {
+		root = defaultSysfsRoot
+	}
+	if domainGlob, ok := raplAddress(pattern); ok {
+		return raplPrefix + resolveSysfsPath(root, domainGlob)
+	}
+	if isDeviceAddress(pattern) || pattern == "" {
+		return pattern
+	}
+	if !filepath.IsAbs(pattern) {
+		return filepath.Join(root, pattern)
+	}
+	if root == defaultSysfsRoot {
+		return pattern
+	}
+	rel := strings.TrimPrefix(pattern, defaultSysfsRoot)
+	if rel == pattern || (rel != "" && rel[0] != '/') {
+		return pattern
+	}
+	return filepath.Join(root, rel)
+}
+
+// isDeviceAddress reports whether the given path glob addresses a device through another
+// interface than a file, e.g. 'smc:TC0P', rather than matching files
+func isDeviceAddress(pattern string) bool {
+	for _, prefix := range []string{smcPrefix, sysctlPrefix, lmsensorsPrefix, raplPrefix, pluginPrefix} {
+		if strings.HasPrefix(pattern, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveSysfsPaths resolves every path glob of this config against the configured sysfs
+// root. The path globs of a heatsink that sets its own sysfs root are resolved against it
+func (c *config) resolveSysfsPaths() {
+
+	for i := range c.Sensors {
+		c.Sensors[i].PathGlob = resolveSysfsPath(c.SysfsRoot, c.Sensors[i].PathGlob)
+	}
+	for _, hs := range c.Heatsinks {
+		root := c.SysfsRoot
+		if hs.SysfsRoot != "" {
+			root = hs.SysfsRoot
+		}
+		resolve := func(pattern *string) {
+			*pattern = resolveSysfsPath(root, *pattern)
+		}
+		hs.thermalClassDir = resolveSysfsPath(root, thermalClassDir)
+		resolve(&hs.Fan.PathGlob)
+		resolve(&hs.Fan.RpmPathGlob)
+		for i := range hs.SensorPathGlobs {
+			resolve(&hs.SensorPathGlobs[i])
+		}
+		for _, in := range hs.Inputs {
+			for i := range in.SensorPathGlobs {
+				resolve(&in.SensorPathGlobs[i])
+			}
+		}
+		for i := range hs.AuxInputs {
+			resolve(&hs.AuxInputs[i].PathGlob)
+		}
+	}
+	for i := range c.Zones {
+		c.Zones[i].Fan.PathGlob = resolveSysfsPath(c.SysfsRoot, c.Zones[i].Fan.PathGlob)
+		c.Zones[i].Fan.RpmPathGlob = resolveSysfsPath(c.SysfsRoot, c.Zones[i].Fan.RpmPathGlob)
+	}
+}
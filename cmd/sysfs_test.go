@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func Test_resolveSysfsPath(t *testing.T) {
+
+	cases := []struct {
+		root     string
+		pattern  string
+		expected string
+	}{
+		{root: "", pattern: "/sys/class/hwmon/hwmon*/pwm1", expected: "/sys/class/hwmon/hwmon*/pwm1"},
+		{root: "/sys", pattern: "/sys/class/hwmon/hwmon*/pwm1", expected: "/sys/class/hwmon/hwmon*/pwm1"},
+		{root: "/host/sys", pattern: "/sys/class/hwmon/hwmon*/pwm1", expected: "/host/sys/class/hwmon/hwmon*/pwm1"},
+		{root: "/host/sys/", pattern: "/sys", expected: "/host/sys"},
+		{root: "/host/sys", pattern: "/system/temp", expected: "/system/temp"},
+		{root: "/host/sys", pattern: "/tmp/temp", expected: "/tmp/temp"},
+		{root: "/host/sys", pattern: "", expected: ""},
+		{root: "", pattern: "class/hwmon/hwmon*/pwm1", expected: "/sys/class/hwmon/hwmon*/pwm1"},
+		{root: "/host/sys", pattern: "class/hwmon/hwmon*/pwm1", expected: "/host/sys/class/hwmon/hwmon*/pwm1"},
+		{root: "/tmp/fake", pattern: "./devices/../class/temp1", expected: "/tmp/fake/class/temp1"},
+		{root: "/host/sys", pattern: "smc:TC0P", expected: "smc:TC0P"},
+		{root: "/host/sys", pattern: "sysctl:dev.cpu.0.temperature", expected: "sysctl:dev.cpu.0.temperature"},
+		{root: "/host/sys", pattern: "lmsensors:coretemp-*/Core 0", expected: "lmsensors:coretemp-*/Core 0"},
+		{root: "/host/sys", pattern: "rapl:/sys/class/powercap/intel-rapl:0", expected: "rapl:/host/sys/class/powercap/intel-rapl:0"},
+		{root: "", pattern: "rapl:class/powercap/intel-rapl:0", expected: "rapl:/sys/class/powercap/intel-rapl:0"},
+	}
+
+	for _, c := range cases {
+		if actual := resolveSysfsPath(c.root, c.pattern); actual != c.expected {
+			t.Errorf("resolveSysfsPath(%q, %q)\nwant: %q\n got: %q", c.root, c.pattern, c.expected, actual)
+		}
+	}
+}
+
+func Test_newConfig_sysfsRoot(t *testing.T) {
+
+	cfg, err := newConfig(strings.NewReader(`
+    {
+      "sysfs_root": "/host/sys",
+      "sensors": [{"name": "core0", "path_glob": "/sys/temp0"}],
+      "heatsinks": [
+        {
+          "fan": {"path_glob": "/sys/pwm1", "rpm_path_glob": "/sys/fan1_input"},
+          "sensor_path_globs": ["/sys/temp1", "/tmp/temp2"],
+          "aux_inputs": [{"type": "rapl", "path_glob": "/sys/rapl"}]
+        },
+        {
+          "sysfs_root": "/chroot/sys",
+          "fan": {"path_glob": "class/hwmon/pwm2"},
+          "sensor_path_globs": ["/sys/temp3"]
+        }
+      ]
+    }
+  `), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hs, override := cfg.Heatsinks[0], cfg.Heatsinks[1]
+	actual := []string{
+		cfg.named.physical["core0"],
+		hs.Fan.PathGlob,
+		hs.Fan.RpmPathGlob,
+		hs.SensorPathGlobs[0],
+		hs.SensorPathGlobs[1],
+		hs.AuxInputs[0].PathGlob,
+		override.Fan.PathGlob,
+		override.SensorPathGlobs[0],
+	}
+	expected := []string{
+		"/host/sys/temp0",
+		"/host/sys/pwm1",
+		"/host/sys/fan1_input",
+		"/host/sys/temp1",
+		"/tmp/temp2",
+		"/host/sys/rapl",
+		"/chroot/sys/class/hwmon/pwm2",
+		"/chroot/sys/temp3",
+	}
+	if diff := deep.Equal(actual, expected); diff != nil {
+		t.Fatal(diff)
+	}
+}
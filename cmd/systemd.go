@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/malkhamis/heatsink"
+	"go.uber.org/zap"
+)
+
+// sdNotify sends the given state, e.g. "READY=1", to systemd if the process was started as a
+// service of Type=notify. If NOTIFY_SOCKET is not set, it is a no-op
+func sdNotify(state string) error {
+
+	socketAddr := os.Getenv("NOTIFY_SOCKET")
+	if socketAddr == "" {
+		return nil
+	}
+	if socketAddr[0] == '@' {
+		socketAddr = "\x00" + socketAddr[1:] // abstract namespace
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socketAddr, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// sdWatchdogInterval returns the interval at which systemd expects keep-alive pings, which is
+// half the configured watchdog timeout. It returns zero if the watchdog is not enabled for
+// this process
+func sdWatchdogInterval() time.Duration {
+
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond / 2
+}
+
+// startWatchdog pings the systemd watchdog periodically as long as every heatsink's control
+// loop is healthy. It returns a function that stops the watchdog. If the watchdog is not
+// enabled for this process, it is a no-op
+func startWatchdog(heatsinks []*heatsink.Heatsink, logger *zap.Logger) (stop func()) {
+
+	interval := sdWatchdogInterval()
+	if interval <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				if unhealthy := unhealthyHeatsinks(heatsinks, now); len(unhealthy) > 0 {
+					logger.Warn(
+						"skipping watchdog keep-alive because control loops are unhealthy",
+						zap.Strings("heatsinks", unhealthy),
+					)
+					continue
+				}
+				if err := sdNotify("WATCHDOG=1"); err != nil {
+					logger.Error("failed to notify systemd watchdog", zap.Error(err))
+				}
+			}
+		}
+	}()
+
+	logger.Info("started systemd watchdog", zap.Duration("interval", interval))
+	return func() { close(done) }
+}
+
+// unhealthyHeatsinks returns the names of heatsinks whose control loop did not complete an
+// iteration within twice its check period
+func unhealthyHeatsinks(heatsinks []*heatsink.Heatsink, now time.Time) []string {
+	var unhealthy []string
+	for _, hs := range heatsinks {
+		if checkHealth(hs, now).Status != healthOK {
+			unhealthy = append(unhealthy, hs.Name())
+		}
+	}
+	return unhealthy
+}
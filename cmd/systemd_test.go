@@ -0,0 +1,228 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/malkhamis/heatsink"
+	"github.com/malkhamis/heatsink/fanpwm"
+	"github.com/malkhamis/heatsink/thermosense"
+	"go.uber.org/zap"
+)
+
+// notifySocket listens on a temporary NOTIFY_SOCKET and returns a channel of received states
+func notifySocket(t *testing.T) (states <-chan string, cleanup func()) {
+	t.Helper()
+
+	tmpDir, err := ioutil.TempDir("", "notify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := &net.UnixAddr{Name: filepath.Join(tmpDir, "notify.sock"), Net: "unixgram"}
+	conn, err := net.ListenUnixgram("unixgram", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	origEnv, hadEnv := os.LookupEnv("NOTIFY_SOCKET")
+	os.Setenv("NOTIFY_SOCKET", addr.Name)
+
+	statesChan := make(chan string, 16)
+	go func() {
+		buf := make([]byte, 256)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				close(statesChan)
+				return
+			}
+			statesChan <- string(buf[:n])
+		}
+	}()
+
+	return statesChan, func() {
+		if hadEnv {
+			os.Setenv("NOTIFY_SOCKET", origEnv)
+		} else {
+			os.Unsetenv("NOTIFY_SOCKET")
+		}
+		conn.Close()
+		os.RemoveAll(tmpDir)
+	}
+}
+
+func Test_sdNotify(t *testing.T) {
+
+	states, cleanup := notifySocket(t)
+	defer cleanup()
+
+	if err := sdNotify("READY=1"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case state := <-states:
+		if state != "READY=1" {
+			t.Fatalf("unexpected state\nwant: %q\n got: %q", "READY=1", state)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for notification")
+	}
+
+	os.Unsetenv("NOTIFY_SOCKET")
+	if err := sdNotify("READY=1"); err != nil {
+		t.Fatalf("expected no error if NOTIFY_SOCKET is not set, got: %v", err)
+	}
+}
+
+func Test_sdWatchdogInterval(t *testing.T) {
+
+	defer os.Unsetenv("WATCHDOG_USEC")
+	defer os.Unsetenv("WATCHDOG_PID")
+
+	os.Setenv("WATCHDOG_USEC", "4000000")
+	if expected, actual := 2*time.Second, sdWatchdogInterval(); expected != actual {
+		t.Errorf("unexpected watchdog interval\nwant: %s\n got: %s", expected, actual)
+	}
+	os.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()+1))
+	if actual := sdWatchdogInterval(); actual != 0 {
+		t.Errorf("expected no watchdog for a different pid, got: %s", actual)
+	}
+	os.Unsetenv("WATCHDOG_PID")
+	os.Setenv("WATCHDOG_USEC", "garbage")
+	if actual := sdWatchdogInterval(); actual != 0 {
+		t.Errorf("expected no watchdog for an invalid timeout, got: %s", actual)
+	}
+}
+
+func testHeatsink(t *testing.T, temp string) (hs *heatsink.Heatsink, cleanup func()) {
+	t.Helper()
+
+	fanFile, cleanupFan := temporaryFile(t)
+	sensorFile, cleanupSensor := temporaryFile(t)
+	cleanup = func() { cleanupFan(); cleanupSensor() }
+	if _, err := sensorFile.WriteString(temp); err != nil {
+		t.Fatal(err)
+	}
+
+	fan, err := fanpwm.New(fanFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sensor, err := thermosense.New(sensorFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs, err = heatsink.New(
+		&heatsink.Config{
+			Fan:            fan,
+			Sensors:        []heatsink.ThermoSensor{sensor},
+			MinTemperature: 30,
+			MaxTemperature: 50,
+		},
+		heatsink.OptName(t.Name()),
+		heatsink.OptTemperatureCheckPeriod(10*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hs, cleanup
+}
+
+func Test_unhealthyHeatsinks(t *testing.T) {
+
+	hs, cleanup := testHeatsink(t, "40000")
+	defer cleanup()
+
+	now := time.Now()
+	if unhealthy := unhealthyHeatsinks([]*heatsink.Heatsink{hs}, now); len(unhealthy) != 1 {
+		t.Fatalf("expected a heatsink that never ran to be unhealthy, got: %v", unhealthy)
+	}
+
+	go hs.StartThermalControl()
+	defer hs.StopThermalControl()
+	for deadline := time.After(time.Second); hs.LastSample().Time.IsZero(); {
+		select {
+		case <-deadline:
+			t.Fatal("timeout waiting for a control iteration")
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	if unhealthy := unhealthyHeatsinks([]*heatsink.Heatsink{hs}, time.Now()); len(unhealthy) != 0 {
+		t.Errorf("expected a running heatsink to be healthy, got: %v", unhealthy)
+	}
+	later := time.Now().Add(time.Second)
+	if unhealthy := unhealthyHeatsinks([]*heatsink.Heatsink{hs}, later); len(unhealthy) != 1 {
+		t.Errorf("expected a heatsink with a stale sample to be unhealthy, got: %v", unhealthy)
+	}
+}
+
+func Test_runHeatsinks_terminated(t *testing.T) {
+
+	states, cleanup := notifySocket(t)
+	defer cleanup()
+
+	origSignalNotify := signalNotify
+	defer func() { signalNotify = origSignalNotify }()
+	signalNotify = func(c chan<- os.Signal, _ ...os.Signal) {
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			c <- syscall.SIGTERM
+		}()
+	}
+
+	hs, cleanupHs := testHeatsink(t, "40000")
+	defer cleanupHs()
+
+	actual, _ := runHeatsinks([]*heatsink.Heatsink{hs}, nil, zap.NewNop())
+	if expected := 0; expected != actual {
+		t.Fatalf("actual exit code doesn't match expected\nwant: %d\n got: %d", expected, actual)
+	}
+
+	for _, expected := range []string{"READY=1", "STOPPING=1"} {
+		select {
+		case actual := <-states:
+			if actual != expected {
+				t.Fatalf("unexpected state\nwant: %q\n got: %q", expected, actual)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for notification %q", expected)
+		}
+	}
+}
+
+func Test_runHeatsinks_reload(t *testing.T) {
+
+	states, cleanup := notifySocket(t)
+	defer cleanup()
+
+	origSignalNotify := signalNotify
+	defer func() { signalNotify = origSignalNotify }()
+	signalNotify = func(chan<- os.Signal, ...os.Signal) {}
+
+	hs, cleanupHs := testHeatsink(t, "40000")
+	defer cleanupHs()
+
+	reload := make(chan struct{}, 1)
+	reload <- struct{}{}
+	exitCode, reloading := runHeatsinks([]*heatsink.Heatsink{hs}, reload, zap.NewNop())
+	if exitCode != 0 || !reloading {
+		t.Fatalf("unexpected result\nwant: 0, true\n got: %d, %v", exitCode, reloading)
+	}
+
+	for _, expected := range []string{"READY=1", "RELOADING=1"} {
+		select {
+		case actual := <-states:
+			if actual != expected {
+				t.Fatalf("unexpected state\nwant: %q\n got: %q", expected, actual)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for notification %q", expected)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"github.com/malkhamis/heatsink"
+	"go.uber.org/zap"
+)
+
+// sampleSink receives the samples of the control loops of all heatsinks, e.g. to export them
+// to external telemetry systems. Implementations must be safe for concurrent use and return
+// quickly since they are called synchronously by the control loops
+type sampleSink interface {
+	write(hsName string, smpl heatsink.Sample)
+	close() error
+}
+
+// configTelemetry configures where the samples of the control loops are exported to
+type configTelemetry struct {
+	File   *configTelemetryFile   `json:"file,omitempty"`
+	Influx *configTelemetryInflux `json:"influx,omitempty"`
+	OTLP   *configTelemetryOTLP   `json:"otlp,omitempty"`
+}
+
+// newSinks creates the configured sample sinks
+func (c *configTelemetry) newSinks(logger *zap.Logger) ([]sampleSink, error) {
+
+	if c == nil {
+		return nil, nil
+	}
+
+	var sinks []sampleSink
+	if c.File != nil {
+		sink, err := c.File.newSink(logger)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	if c.Influx != nil {
+		sink, err := c.Influx.newSink(logger)
+		if err != nil {
+			closeSinks(sinks, logger)
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	if c.OTLP != nil {
+		sink, err := c.OTLP.newSink(logger)
+		if err != nil {
+			closeSinks(sinks, logger)
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+// closeSinks closes the given sinks and logs failures
+func closeSinks(sinks []sampleSink, logger *zap.Logger) {
+	for _, sink := range sinks {
+		if err := sink.close(); err != nil {
+			logger.Warn("failed to close telemetry sink", zap.Error(err))
+		}
+	}
+}
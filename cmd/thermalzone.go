@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/malkhamis/heatsink"
+	"github.com/malkhamis/heatsink/thermosense"
+	"go.uber.org/zap"
+)
+
+// thermalClassDir is where the kernel's thermal zones are found, relative to the sysfs root
+const thermalClassDir = "class/thermal"
+
+// thermalClass returns the directory of the thermal zones under the resolved sysfs root
+func (c *configHeatsink) thermalClass() string {
+	if c.thermalClassDir == "" {
+		return resolveSysfsPath("", thermalClassDir)
+	}
+	return c.thermalClassDir
+}
+
+// thermalZones returns the zones whose types are listed in the config of this heatsink
+func (c *configHeatsink) thermalZones() ([]thermosense.ThermalZone, error) {
+
+	classDir := c.thermalClass()
+	zones := make([]thermosense.ThermalZone, 0, len(c.ThermalZones))
+	for _, zoneType := range c.ThermalZones {
+		zone, err := thermosense.FindThermalZone(classDir, zoneType)
+		if err != nil {
+			return nil, err
+		}
+		zones = append(zones, zone)
+	}
+	return zones, nil
+}
+
+func newThermalZoneSensor(zone thermosense.ThermalZone, logger *zap.Logger) (heatsink.ThermoSensor, error) {
+
+	sensor, err := thermosense.NewThermalZone(zone)
+	if err != nil {
+		return nil, fmt.Errorf("thermal zone '%s': %w", zone.Type, diagnosePermission(err, accessRead))
+	}
+	logger.Info(
+		"created thermal zone sensor",
+		zap.String("name", sensor.Name()),
+		zap.String("zone", zone.Dir),
+	)
+	return sensor, nil
+}
+
+// tripPointLimits derives temperature limits from the trip points of the thermal zones of this
+// heatsink: the lowest active trip point is the minimum temperature, the lowest passive trip
+// point, or hot if there is none, is the maximum temperature, and the lowest critical trip
+// point is the critical temperature
+func (c *configHeatsink) tripPointLimits() (derivedLimits, error) {
+
+	zones, err := c.thermalZones()
+	if err != nil {
+		return derivedLimits{}, err
+	}
+	lowest := func(tripTypes ...string) float64 {
+		for _, tripType := range tripTypes {
+			var (
+				temp  float64
+				found bool
+			)
+			for _, zone := range zones {
+				if t, ok := zone.Trip(tripType); ok && (!found || t < temp) {
+					temp, found = t, true
+				}
+			}
+			if found {
+				return temp
+			}
+		}
+		return 0
+	}
+	return derivedLimits{
+		min:  lowest(thermosense.TripActive),
+		max:  lowest(thermosense.TripPassive, thermosense.TripHot),
+		crit: lowest(thermosense.TripCritical),
+	}, nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/malkhamis/heatsink/thermosense"
+	"go.uber.org/zap"
+)
+
+// fakeSysfsThermal creates a sysfs root with one thermal zone per given zone type, each with
+// a temperature of 40 and the given trip points
+func fakeSysfsThermal(t *testing.T, zones map[string][]thermosense.TripPoint) (root string, cleanup func()) {
+	t.Helper()
+
+	root, err := ioutil.TempDir("", "sysfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup = func() { os.RemoveAll(root) }
+
+	i := 0
+	for zoneType, trips := range zones {
+		files := map[string]string{"type": zoneType, "temp": "40000"}
+		for j, trip := range trips {
+			files[fmt.Sprintf("trip_point_%d_type", j)] = trip.Type
+			files[fmt.Sprintf("trip_point_%d_temp", j)] = fmt.Sprint(int(trip.Temperature * 1000))
+		}
+		zoneDir := filepath.Join(root, thermalClassDir, fmt.Sprintf("thermal_zone%d", i))
+		if err := os.MkdirAll(zoneDir, 0700); err != nil {
+			cleanup()
+			t.Fatal(err)
+		}
+		for filename, content := range files {
+			if err := ioutil.WriteFile(filepath.Join(zoneDir, filename), []byte(content+"\n"), 0600); err != nil {
+				cleanup()
+				t.Fatal(err)
+			}
+		}
+		i++
+	}
+	return root, cleanup
+}
+
+func Test_configHeatsink_temperatureLimits(t *testing.T) {
+
+	root, cleanup := fakeSysfsThermal(t, map[string][]thermosense.TripPoint{
+		"acpitz": {
+			{Type: thermosense.TripActive, Temperature: 50},
+			{Type: thermosense.TripHot, Temperature: 90},
+			{Type: thermosense.TripCritical, Temperature: 105},
+		},
+		"x86_pkg_temp": {
+			{Type: thermosense.TripPassive, Temperature: 85},
+			{Type: thermosense.TripCritical, Temperature: 100},
+		},
+	})
+	defer cleanup()
+
+	cases := map[string]struct {
+		hs       configHeatsink
+		expected []float64
+	}{
+		"disabled": {
+			hs:       configHeatsink{ThermalZones: []string{"acpitz"}, MinTemp: 30, MaxTemp: 70},
+			expected: []float64{30, 70, 0},
+		},
+		"hot-without-passive": {
+			hs:       configHeatsink{ThermalZones: []string{"acpitz"}, TripPointLimits: true},
+			expected: []float64{50, 90, 105},
+		},
+		"lowest-across-zones": {
+			hs:       configHeatsink{ThermalZones: []string{"acpitz", "x86_pkg_temp"}, TripPointLimits: true},
+			expected: []float64{50, 85, 100},
+		},
+		"configured-limits-win": {
+			hs: configHeatsink{
+				ThermalZones: []string{"x86_pkg_temp"}, TripPointLimits: true, MinTemp: 40, CritTemp: 95,
+			},
+			expected: []float64{40, 85, 95},
+		},
+	}
+	for name, testCase := range cases {
+		testCase.hs.thermalClassDir = filepath.Join(root, thermalClassDir)
+		min, max, crit, err := testCase.hs.temperatureLimits(zap.NewNop())
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if diff := deep.Equal([]float64{min, max, crit}, testCase.expected); diff != nil {
+			t.Errorf("%s: %v", name, diff)
+		}
+	}
+}
+
+func Test_configHeatsink_newSensors_thermalZones(t *testing.T) {
+
+	root, cleanup := fakeSysfsThermal(t, map[string][]thermosense.TripPoint{"x86_pkg_temp": nil})
+	defer cleanup()
+
+	cfg := &config{
+		SysfsRoot: root,
+		Heatsinks: []*configHeatsink{{ThermalZones: []string{"x86_pkg_temp"}}},
+	}
+	cfg.resolveSysfsPaths()
+
+	sensors, err := cfg.Heatsinks[0].newSensors(namedSensors{}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sensors) != 1 {
+		t.Fatalf("expected exactly one sensor, got: %d", len(sensors))
+	}
+	defer sensors[0].Close()
+	if expected, actual := "x86_pkg_temp", sensors[0].Name(); expected != actual {
+		t.Errorf("unexpected sensor name\nwant: %s\n got: %s", expected, actual)
+	}
+	if temp, err := sensors[0].Temperature(); err != nil || temp != 40 {
+		t.Errorf("unexpected temperature\nwant: %v, %v\n got: %v, %v", 40.0, nil, temp, err)
+	}
+
+	cfg.Heatsinks[0].ThermalZones = []string{"acpitz"}
+	_, err = cfg.Heatsinks[0].newSensors(namedSensors{}, zap.NewNop())
+	if !errors.Is(err, thermosense.ErrZoneNotFound) {
+		t.Errorf("unexpected error\nwant: %v\n got: %v", thermosense.ErrZoneNotFound, err)
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/malkhamis/heatsink/expr"
+	"github.com/malkhamis/heatsink/thermosense"
+	"go.uber.org/zap"
+)
+
+var errTopologyFormat = errors.New("unknown topology format")
+
+// Node kinds in the topology graph
+const (
+	nodeHeatsink = "heatsink"
+	nodeZone     = "zone"
+	nodeFan      = "fan"
+	nodeSensor   = "sensor"
+	nodeVirtual  = "virtual_sensor"
+	nodeGlob     = "glob"
+)
+
+// topology is a graph of the configured heatsinks and zones, the fans they control, the sensors
+// the heatsinks read, possibly through virtual sensors, and the members of the zones. It is
+// built from the config without opening devices
+type topology struct {
+	Nodes []*topologyNode `json:"nodes"`
+	Edges []topologyEdge  `json:"edges"`
+	index map[string]*topologyNode
+}
+
+type topologyNode struct {
+	ID         string   `json:"id"`
+	Kind       string   `json:"kind"`
+	Label      string   `json:"label"`
+	Paths      []string `json:"paths,omitempty"`
+	Expression string   `json:"expression,omitempty"`
+	// Unmatched is true if a glob that is expected to match device files matches none
+	Unmatched bool `json:"unmatched,omitempty"`
+}
+
+type topologyEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Kind string `json:"kind"`
+}
+
+func (c *config) topology() *topology {
+
+	topo := &topology{index: make(map[string]*topologyNode)}
+	for _, hs := range c.Heatsinks {
+		hsID := topo.addNode(nodeHeatsink, hs.Name, func(n *topologyNode) {})
+		topo.addEdge(hsID, topo.addFan(hs.Fan), "controls")
+
+		for _, pattern := range hs.SensorPathGlobs {
+			sensorID := topo.addGlobNode(nodeSensor, pattern, pattern)
+			topo.addEdge(hsID, sensorID, "reads")
+		}
+		for _, name := range hs.SensorNames {
+			topo.addEdge(hsID, topo.addNamedSensor(c, name), "reads")
+		}
+		for _, in := range hs.Inputs {
+			for _, pattern := range in.SensorPathGlobs {
+				topo.addEdge(hsID, topo.addGlobNode(nodeSensor, pattern, pattern), "reads")
+			}
+			for _, name := range in.SensorNames {
+				topo.addEdge(hsID, topo.addNamedSensor(c, name), "reads")
+			}
+		}
+		for _, zoneType := range hs.ThermalZones {
+			topo.addEdge(hsID, topo.addThermalZone(hs.thermalClass(), zoneType), "reads")
+		}
+		if hs.AmbientSensor != "" {
+			topo.addEdge(hsID, topo.addNamedSensor(c, hs.AmbientSensor), "ambient")
+		}
+	}
+
+	// members are heatsinks or zones defined before, which validating the config ensures
+	for _, z := range c.Zones {
+		zoneID := topo.addNode(nodeZone, z.Name, func(n *topologyNode) {})
+		topo.addEdge(zoneID, topo.addFan(z.Fan), "controls")
+		for _, m := range z.Members {
+			memberID := nodeHeatsink + ":" + m.Heatsink
+			if _, ok := topo.index[nodeZone+":"+m.Heatsink]; ok {
+				memberID = nodeZone + ":" + m.Heatsink
+			}
+			topo.addEdge(zoneID, memberID, "member")
+		}
+	}
+
+	return topo
+}
+
+// addFan adds a node for the given fan, which is labeled by its name, if any, or else by its
+// path glob or url, and returns the node's id
+func (t *topology) addFan(fan configFan) string {
+
+	label := fan.Name
+	if label == "" {
+		label = fan.PathGlob
+	}
+	if remote := fan.Remote; remote != nil {
+		if fan.Name == "" {
+			label = remote.URL
+		}
+		return t.addNode(nodeFan, label, func(n *topologyNode) { n.Paths = []string{remote.URL} })
+	}
+	return t.addGlobNode(nodeFan, label, fan.PathGlob)
+}
+
+// addNode adds a node of the given kind and label if it does not exist yet, calls init on the
+// newly added node, and returns the node's id
+func (t *topology) addNode(kind, label string, init func(*topologyNode)) string {
+	id := kind + ":" + label
+	if _, ok := t.index[id]; ok {
+		return id
+	}
+	node := &topologyNode{ID: id, Kind: kind, Label: label}
+	init(node)
+	t.index[id] = node
+	t.Nodes = append(t.Nodes, node)
+	return id
+}
+
+func (t *topology) addGlobNode(kind, label, pattern string) string {
+	return t.addNode(kind, label, func(n *topologyNode) {
+		if isDeviceAddress(pattern) {
+			n.Paths = []string{pattern}
+			return
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil || len(matches) == 0 {
+			n.Kind, n.Unmatched = nodeGlob, true
+		}
+		n.Paths = matches
+	})
+}
+
+func (t *topology) addThermalZone(classDir, zoneType string) string {
+	return t.addNode(nodeSensor, zoneType, func(n *topologyNode) {
+		zone, err := thermosense.FindThermalZone(classDir, zoneType)
+		if err != nil {
+			n.Kind, n.Unmatched = nodeGlob, true
+			return
+		}
+		n.Paths = []string{filepath.Join(zone.Dir, "temp")}
+	})
+}
+
+func (t *topology) addNamedSensor(c *config, name string) string {
+
+	if pattern, ok := c.named.physical[name]; ok {
+		return t.addGlobNode(nodeSensor, name, pattern)
+	}
+	if remote, ok := c.named.remote[name]; ok {
+		return t.addNode(nodeSensor, name, func(n *topologyNode) { n.Paths = []string{remote.location()} })
+	}
+
+	expression, ok := c.named.virtual[name]
+	if !ok {
+		return t.addNode(nodeSensor, name, func(n *topologyNode) { n.Unmatched = true })
+	}
+
+	id := nodeVirtual + ":" + name
+	if _, ok := t.index[id]; ok {
+		return id // also guards against cycles
+	}
+	t.addNode(nodeVirtual, name, func(n *topologyNode) { n.Expression = expression })
+	if parsed, err := expr.Parse(expression); err == nil {
+		for _, input := range parsed.Vars() {
+			t.addEdge(id, t.addNamedSensor(c, input), "input")
+		}
+	}
+	return id
+}
+
+func (t *topology) addEdge(from, to, kind string) {
+	t.Edges = append(t.Edges, topologyEdge{From: from, To: to, Kind: kind})
+}
+
+func (t *topology) writeJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(t)
+}
+
+func (t *topology) writeDOT(w io.Writer) error {
+
+	shapes := map[string]string{
+		nodeHeatsink: "box",
+		nodeZone:     "box3d",
+		nodeFan:      "doublecircle",
+		nodeSensor:   "ellipse",
+		nodeVirtual:  "hexagon",
+		nodeGlob:     "note",
+	}
+
+	var sb strings.Builder
+	sb.WriteString("digraph heatsinks {\n")
+	sb.WriteString("  rankdir=LR;\n")
+	for _, n := range t.Nodes {
+		label := n.Label
+		if n.Expression != "" {
+			label += "\\n= " + n.Expression
+		}
+		paths := append([]string{}, n.Paths...)
+		sort.Strings(paths)
+		for _, p := range paths {
+			if p != n.Label {
+				label += "\\n" + p
+			}
+		}
+		attrs := fmt.Sprintf("label=%q, shape=%s", label, shapes[n.Kind])
+		if n.Unmatched {
+			attrs += ", style=dashed, color=red"
+		}
+		fmt.Fprintf(&sb, "  %q [%s];\n", n.ID, attrs)
+	}
+	for _, e := range t.Edges {
+		fmt.Fprintf(&sb, "  %q -> %q [label=%q];\n", e.From, e.To, e.Kind)
+	}
+	sb.WriteString("}\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// runTopology implements the 'topology' subcommand, which prints the configured topology as
+// a Graphviz DOT graph or as a JSON graph
+func runTopology(args []string, stdout io.Writer) (exitCode int) {
+
+	logger := newLogger(logSettings{})
+	defer logger.Sync()
+
+	flags := flag.NewFlagSet("topology", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	format := flags.String("format", "dot", "output format: 'dot' or 'json'")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		logger.Error("invalid arguments", zap.String("usage", "topology [-format dot|json] <config>"))
+		return 64
+	}
+	filename := flags.Arg(0)
+
+	file, err := os.Open(filename)
+	if err != nil {
+		logger.Error("opening the given file", zap.Error(err))
+		return 66
+	}
+	defer file.Close()
+
+	cfg, err := newConfig(file, logger)
+	if err != nil {
+		logger.Error("creating heatsink config", zap.Error(err), zap.String("filename", filename))
+		return 78
+	}
+
+	topo := cfg.topology()
+	switch *format {
+	case "dot":
+		err = topo.writeDOT(stdout)
+	case "json":
+		err = topo.writeJSON(stdout)
+	default:
+		err = fmt.Errorf("%w: '%s'", errTopologyFormat, *format)
+		logger.Error("invalid arguments", zap.Error(err))
+		return 64
+	}
+	if err != nil {
+		logger.Error("writing topology", zap.Error(err))
+		return 74
+	}
+
+	return 0
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+	"go.uber.org/zap"
+)
+
+func Test_config_topology(t *testing.T) {
+	t.Parallel()
+
+	fanFile, cleanup := temporaryFile(t)
+	defer cleanup()
+	cpuFile, cleanup := temporaryFile(t)
+	defer cleanup()
+
+	jsonData := strings.NewReader(fmt.Sprintf(`
+		{
+		  "sensors": [
+		    {"name": "cpu", "path_glob": %q},
+		    {"name": "ambient", "path_glob": "/does/not/exist"}
+		  ],
+		  "virtual_sensors": [{"name": "delta", "expression": "cpu - ambient"}],
+		  "heatsinks": [
+		    {"name": "hs1", "fan": {"name": "fan1", "path_glob": %q}, "sensor_names": ["delta"]},
+		    {"name": "hs2", "fan": {"path_glob": "/no/fan"}, "sensor_names": ["cpu"], "ambient_sensor": "ambient"}
+		  ],
+		  "zones": [
+		    {"name": "chassis", "fan": {"path_glob": "/no/chassis"}, "members": [{"heatsink": "hs1"}, {"heatsink": "hs2"}]},
+		    {"name": "rack", "fan": {"name": "fan1", "path_glob": %q}, "members": [{"heatsink": "chassis"}]}
+		  ]
+		}
+	`, cpuFile.Name(), fanFile.Name(), fanFile.Name(),
+	))
+
+	cfg, err := newConfig(jsonData, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := cfg.topology().writeJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var actual topology
+	if err := json.Unmarshal(buf.Bytes(), &actual); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := topology{
+		Nodes: []*topologyNode{
+			{ID: "heatsink:hs1", Kind: nodeHeatsink, Label: "hs1"},
+			{ID: "fan:fan1", Kind: nodeFan, Label: "fan1", Paths: []string{fanFile.Name()}},
+			{ID: "virtual_sensor:delta", Kind: nodeVirtual, Label: "delta", Expression: "cpu - ambient"},
+			{ID: "sensor:ambient", Kind: nodeGlob, Label: "ambient", Unmatched: true},
+			{ID: "sensor:cpu", Kind: nodeSensor, Label: "cpu", Paths: []string{cpuFile.Name()}},
+			{ID: "heatsink:hs2", Kind: nodeHeatsink, Label: "hs2"},
+			{ID: "fan:/no/fan", Kind: nodeGlob, Label: "/no/fan", Unmatched: true},
+			{ID: "zone:chassis", Kind: nodeZone, Label: "chassis"},
+			{ID: "fan:/no/chassis", Kind: nodeGlob, Label: "/no/chassis", Unmatched: true},
+			{ID: "zone:rack", Kind: nodeZone, Label: "rack"},
+		},
+		Edges: []topologyEdge{
+			{From: "heatsink:hs1", To: "fan:fan1", Kind: "controls"},
+			{From: "virtual_sensor:delta", To: "sensor:ambient", Kind: "input"},
+			{From: "virtual_sensor:delta", To: "sensor:cpu", Kind: "input"},
+			{From: "heatsink:hs1", To: "virtual_sensor:delta", Kind: "reads"},
+			{From: "heatsink:hs2", To: "fan:/no/fan", Kind: "controls"},
+			{From: "heatsink:hs2", To: "sensor:cpu", Kind: "reads"},
+			{From: "heatsink:hs2", To: "sensor:ambient", Kind: "ambient"},
+			{From: "zone:chassis", To: "fan:/no/chassis", Kind: "controls"},
+			{From: "zone:chassis", To: "heatsink:hs1", Kind: "member"},
+			{From: "zone:chassis", To: "heatsink:hs2", Kind: "member"},
+			{From: "zone:rack", To: "fan:fan1", Kind: "controls"},
+			{From: "zone:rack", To: "zone:chassis", Kind: "member"},
+		},
+	}
+	if diff := deep.Equal(expected, actual); diff != nil {
+		t.Fatal("actual topology does not match expected\n", strings.Join(diff, "\n"))
+	}
+}
+
+func Test_runTopology_dot(t *testing.T) {
+
+	cfgFile, cleanup := temporaryFile(t)
+	defer cleanup()
+	_, err := cfgFile.WriteString(`{"heatsinks":[{"name":"hs1","fan":{"name":"fan1"},"sensor_path_globs":["/x"]}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	origNewLogger := newLogger
+	defer func() { newLogger = origNewLogger }()
+	newLogger = func(logSettings) *zap.Logger { return zap.NewNop() }
+
+	restoreProcArgs := backupProcArgs(t)
+	defer restoreProcArgs()
+	os.Args = []string{"program-name", "topology", "-format", "bogus", cfgFile.Name()}
+	if expected, actual := 64, execute(); expected != actual {
+		t.Fatalf("actual exit code doesn't match expected\nwant: %d\n got: %d", expected, actual)
+	}
+
+	var buf bytes.Buffer
+	if expected, actual := 0, runTopology([]string{cfgFile.Name()}, &buf); expected != actual {
+		t.Fatalf("actual exit code doesn't match expected\nwant: %d\n got: %d", expected, actual)
+	}
+	for _, expected := range []string{
+		"digraph heatsinks {",
+		`"heatsink:hs1" -> "fan:fan1" [label="controls"];`,
+		`"heatsink:hs1" -> "sensor:/x" [label="reads"];`,
+	} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("expected DOT output to contain %q, got:\n%s", expected, buf.String())
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// defaultUdevRulesPath is where the 'udev' subcommand installs its rules
+const defaultUdevRulesPath = "/etc/udev/rules.d/90-heatsink.rules"
+
+// hwmonDevice is an hwmon device, identified by the name of its chip, along with the files of
+// it that the daemon needs access to
+type hwmonDevice struct {
+	chip  string
+	read  []string
+	write []string
+}
+
+// hwmonChip returns the chip name of the hwmon device in the given directory, or an empty
+// string if it has none
+func hwmonChip(dir string) string {
+	name, err := ioutil.ReadFile(filepath.Join(dir, "name"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(name))
+}
+
+// add records that the daemon needs the given access to the given file of this device
+func (d *hwmonDevice) add(file, access string) {
+	files := &d.read
+	if access == accessWrite {
+		files = &d.write
+	}
+	for _, f := range *files {
+		if f == file {
+			return
+		}
+	}
+	*files = append(*files, file)
+}
+
+// rule returns a udev rule that hands the files of this device to the given group and grants
+// the group access to them whenever a device of the same chip is added. Without a chip name,
+// the rule applies to every hwmon device
+func (d *hwmonDevice) rule(group string) string {
+
+	var all, writable, readable []string
+	for _, f := range d.write {
+		all, writable = append(all, "/sys%p/"+f), append(writable, "/sys%p/"+f)
+	}
+	for _, f := range d.read {
+		all, readable = append(all, "/sys%p/"+f), append(readable, "/sys%p/"+f)
+	}
+
+	parts := []string{`ACTION=="add"`, `SUBSYSTEM=="hwmon"`}
+	if d.chip != "" {
+		parts = append(parts, fmt.Sprintf(`ATTR{name}=="%s"`, d.chip))
+	}
+	parts = append(parts, fmt.Sprintf(`RUN+="/bin/chgrp %s %s"`, group, strings.Join(all, " ")))
+	if len(writable) > 0 {
+		parts = append(parts, fmt.Sprintf(`RUN+="/bin/chmod g+w %s"`, strings.Join(writable, " ")))
+	}
+	if len(readable) > 0 {
+		parts = append(parts, fmt.Sprintf(`RUN+="/bin/chmod g+r %s"`, strings.Join(readable, " ")))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// hwmonDevices returns the hwmon devices of the local device files of this config, in the
+// order they are configured, along with the files that are not of an hwmon device and thus
+// get no rule
+func (c *config) hwmonDevices() (devices []*hwmonDevice, skipped []string) {
+
+	byChip := make(map[string]*hwmonDevice)
+	for _, f := range c.deviceFiles() {
+		matches, _ := filepath.Glob(f.pattern)
+		for _, path := range matches {
+			dir, file := filepath.Split(filepath.Clean(path))
+			if !hwmonDir.MatchString(filepath.Base(dir)) {
+				skipped = append(skipped, path)
+				continue
+			}
+			chip := hwmonChip(dir)
+			device, ok := byChip[chip]
+			if !ok {
+				device = &hwmonDevice{chip: chip}
+				byChip[chip] = device
+				devices = append(devices, device)
+			}
+			device.add(file, f.access)
+		}
+	}
+	return devices, skipped
+}
+
+// udevRules returns the contents of a udev rules file that grants the given group access to
+// the hwmon files of this config, which was read from the given file
+func (c *config) udevRules(group, filename string) []byte {
+
+	var buf bytes.Buffer
+	devices, skipped := c.hwmonDevices()
+	fmt.Fprintf(&buf, "# Generated by 'heatsink udev' from %s\n", filename)
+	fmt.Fprintf(&buf, "# Grants the group '%s' access to the device files of the heatsink daemon\n", group)
+	for _, path := range skipped {
+		fmt.Fprintf(&buf, "# no rule for %s, which is not a file of an hwmon device\n", path)
+	}
+	for _, d := range devices {
+		fmt.Fprintln(&buf, d.rule(group))
+	}
+	return buf.Bytes()
+}
+
+// runUdev implements the 'udev' subcommand, which prints udev rules that grant a dedicated
+// group access to the hwmon files of the given config so that the daemon can run as a member
+// of the group instead of root, or installs them and applies them to present devices
+func runUdev(args []string, stdout io.Writer) (exitCode int) {
+
+	logger := newLogger(logSettings{})
+	defer logger.Sync()
+
+	const usage = "udev [-group <group>] [-install [-rules-path <file>]] <config>"
+	flags := flag.NewFlagSet("udev", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	group := flags.String("group", defaultDeviceGroup, "group that is granted access to the device files")
+	install := flags.Bool("install", false, "write the rules and apply them instead of printing them")
+	rulesPath := flags.String("rules-path", defaultUdevRulesPath, "udev rules file to write with -install")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 || *group == "" {
+		logger.Error("invalid arguments", zap.String("usage", usage))
+		return 64
+	}
+	filename := flags.Arg(0)
+
+	file, err := os.Open(filename)
+	if err != nil {
+		logger.Error("opening the given file", zap.Error(err))
+		return 66
+	}
+	defer file.Close()
+
+	cfg, err := newConfig(file, logger)
+	if err != nil {
+		logger.Error("creating heatsink config", zap.Error(err), zap.String("filename", filename))
+		return 78
+	}
+	if _, err := user.LookupGroup(*group); err != nil {
+		logger.Warn(
+			"the group does not exist, create it with groupadd --system before the rules apply",
+			zap.Error(err), zap.String("group", *group),
+		)
+	}
+	rules := cfg.udevRules(*group, filename)
+
+	if !*install {
+		if _, err := stdout.Write(rules); err != nil {
+			logger.Error("writing udev rules", zap.Error(err))
+			return 74
+		}
+		return 0
+	}
+
+	if err := ioutil.WriteFile(*rulesPath, rules, 0644); err != nil {
+		logger.Error("writing udev rules", zap.Error(err), zap.String("filename", *rulesPath))
+		return 73
+	}
+	logger.Info("wrote udev rules", zap.String("filename", *rulesPath))
+	if err := runCommand("udevadm", "control", "--reload"); err != nil {
+		logger.Error("reloading udev rules", zap.Error(err))
+		return 71
+	}
+	if err := runCommand("udevadm", "trigger", "--action=add", "--subsystem-match=hwmon"); err != nil {
+		logger.Error("applying udev rules", zap.Error(err))
+		return 71
+	}
+	logger.Info("applied udev rules to hwmon devices", zap.String("group", *group))
+	return 0
+}
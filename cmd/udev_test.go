@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+	"go.uber.org/zap"
+)
+
+// fakeHwmon creates hwmon devices of the given chips, each with pwm1 and temp1_input files,
+// along with a file that is not of an hwmon device, and returns the root directory
+func fakeHwmon(t *testing.T, chips ...string) (root string, cleanup func()) {
+	t.Helper()
+
+	root, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{"other/temp": "30000"}
+	for i, chip := range chips {
+		dir := fmt.Sprintf("hwmon%d", i+3)
+		files[dir+"/name"] = chip + "\n"
+		files[dir+"/pwm1"] = "128"
+		files[dir+"/temp1_input"] = "40000"
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root, func() { os.RemoveAll(root) }
+}
+
+func Test_config_udevRules(t *testing.T) {
+
+	root, cleanup := fakeHwmon(t, "nct6775", "k10temp")
+	defer cleanup()
+
+	cfg := &config{Heatsinks: []*configHeatsink{{
+		Name: "cpu",
+		Fan:  configFan{PathGlob: filepath.Join(root, "hwmon3", "pwm1")},
+		SensorPathGlobs: configSensors{
+			filepath.Join(root, "hwmon*", "temp1_input"),
+			filepath.Join(root, "other", "temp"),
+			"smc:TC0P",
+		},
+	}}}
+
+	actual := strings.Split(string(cfg.udevRules("fans", "config.json")), "\n")
+	expected := []string{
+		"# Generated by 'heatsink udev' from config.json",
+		"# Grants the group 'fans' access to the device files of the heatsink daemon",
+		"# no rule for " + filepath.Join(root, "other", "temp") + ", which is not a file of an hwmon device",
+		`ACTION=="add", SUBSYSTEM=="hwmon", ATTR{name}=="nct6775", RUN+="/bin/chgrp fans /sys%p/pwm1 /sys%p/temp1_input", ` +
+			`RUN+="/bin/chmod g+w /sys%p/pwm1", RUN+="/bin/chmod g+r /sys%p/temp1_input"`,
+		`ACTION=="add", SUBSYSTEM=="hwmon", ATTR{name}=="k10temp", RUN+="/bin/chgrp fans /sys%p/temp1_input", ` +
+			`RUN+="/bin/chmod g+r /sys%p/temp1_input"`,
+		"",
+	}
+	if diff := deep.Equal(actual, expected); diff != nil {
+		t.Fatal(diff)
+	}
+}
+
+func Test_runUdev(t *testing.T) {
+
+	root, cleanup := fakeHwmon(t, "nct6775")
+	defer cleanup()
+	cfgPath := filepath.Join(root, "config.json")
+	cfgJSON := fmt.Sprintf(
+		`{"heatsinks": [{"name": "cpu", "min_temp": 30, "max_temp": 60, "sensor_path_globs": [%q], "fan": {"path_glob": %q}}]}`,
+		filepath.Join(root, "hwmon3", "temp1_input"), filepath.Join(root, "hwmon3", "pwm1"),
+	)
+	if err := ioutil.WriteFile(cfgPath, []byte(cfgJSON), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	origNewLogger := newLogger
+	defer func() { newLogger = origNewLogger }()
+	newLogger = func(logSettings) *zap.Logger { return zap.NewNop() }
+	var commands []string
+	origRunCommand := runCommand
+	defer func() { runCommand = origRunCommand }()
+	runCommand = func(name string, args ...string) error {
+		commands = append(commands, name+" "+strings.Join(args, " "))
+		return nil
+	}
+
+	if expected, actual := 64, runUdev([]string{"-group", "", cfgPath}, ioutil.Discard); expected != actual {
+		t.Fatalf("actual exit code doesn't match expected\nwant: %d\n got: %d", expected, actual)
+	}
+
+	var buf bytes.Buffer
+	if expected, actual := 0, runUdev([]string{cfgPath}, &buf); expected != actual {
+		t.Fatalf("actual exit code doesn't match expected\nwant: %d\n got: %d", expected, actual)
+	}
+	if !strings.Contains(buf.String(), `RUN+="/bin/chgrp heatsink /sys%p/pwm1 /sys%p/temp1_input"`) {
+		t.Errorf("expected rules for the default group, got:\n%s", buf.String())
+	}
+	if len(commands) != 0 {
+		t.Errorf("expected printing rules to not run commands, got: %v", commands)
+	}
+
+	rulesPath := filepath.Join(root, "90-heatsink.rules")
+	if expected, actual := 0, runUdev([]string{"-install", "-rules-path", rulesPath, cfgPath}, ioutil.Discard); expected != actual {
+		t.Fatalf("actual exit code doesn't match expected\nwant: %d\n got: %d", expected, actual)
+	}
+	rules, err := ioutil.ReadFile(rulesPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rules) != buf.String() {
+		t.Errorf("expected the installed rules to be the printed ones\nwant: %s\n got: %s", buf.String(), rules)
+	}
+	expected := []string{"udevadm control --reload", "udevadm trigger --action=add --subsystem-match=hwmon"}
+	if diff := deep.Equal(commands, expected); diff != nil {
+		t.Fatal(diff)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/malkhamis/heatsink"
+	"go.uber.org/zap"
+)
+
+var errBadZone = errors.New("invalid zone")
+
+// configZone is a fan, e.g. a chassis fan, that follows the temperatures of the heatsinks it
+// cools, each through a curve of its own, and runs at the highest duty cycle among them
+type configZone struct {
+	Name          string             `json:"name"`
+	Fan           configFan          `json:"fan"`
+	Members       []configZoneMember `json:"members"`
+	TempChkPeriod configDuration     `json:"temp_check_period,omitempty"`
+}
+
+// configZoneMember is a heatsink of a zone along with the curve through which its temperature
+// drives the zone's fan. If both temperatures are zero, those of the heatsink are used. The
+// response type defaults to PowPi
+type configZoneMember struct {
+	Heatsink  string  `json:"heatsink"`
+	RespType  string  `json:"response_type,omitempty"`
+	Exponent  float64 `json:"exponent,omitempty"`
+	Midpoint  float64 `json:"midpoint,omitempty"`
+	Steepness float64 `json:"steepness,omitempty"`
+	MinTemp   float64 `json:"min_temp,omitempty"`
+	MaxTemp   float64 `json:"max_temp,omitempty"`
+}
+
+// validateZones returns an error if a zone has no name or members, if its name is taken, or if
+// a member is neither a heatsink nor a zone defined before it
+func (c *config) validateZones() error {
+
+	names := make(map[string]bool)
+	for _, hs := range c.Heatsinks {
+		names[hs.Name] = true
+	}
+	for _, z := range c.Zones {
+		if z.Name == "" || names[z.Name] {
+			return fmt.Errorf("%w: name '%s' is empty or taken", errBadZone, z.Name)
+		}
+		if len(z.Members) == 0 {
+			return fmt.Errorf("%w: '%s' has no members", errBadZone, z.Name)
+		}
+		for _, m := range z.Members {
+			if !names[m.Heatsink] {
+				return fmt.Errorf("%w: '%s' has an unknown member '%s'", errBadZone, z.Name, m.Heatsink)
+			}
+		}
+		if _, _, err := z.Fan.speedRange(); err != nil {
+			return fmt.Errorf("zone '%s': %w", z.Name, err)
+		}
+		names[z.Name] = true
+	}
+	return nil
+}
+
+// newZone creates the fan of this zone and a heatsink that drives it according to the given
+// heatsinks, among which the members of the zone are looked up by name
+func (c configZone) newZone(
+	heatsinks []*heatsink.Heatsink, logger *zap.Logger, extra ...heatsink.Option,
+) (*heatsink.Heatsink, error) {
+
+	tempChkPeriod, err := c.TempChkPeriod.duration("temp_check_period", time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]*heatsink.Heatsink, len(heatsinks))
+	for _, hs := range heatsinks {
+		byName[hs.Name()] = hs
+	}
+	members := make([]heatsink.ZoneMember, len(c.Members))
+	for i, m := range c.Members {
+		hs, ok := byName[m.Heatsink]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown member '%s'", errBadZone, m.Heatsink)
+		}
+		if m.MinTemp == 0 && m.MaxTemp == 0 {
+			m.MinTemp, m.MaxTemp = hs.MinTemperature(), hs.MaxTemperature()
+		}
+		curve := configInput{
+			Name:      m.Heatsink,
+			RespType:  m.RespType,
+			Exponent:  m.Exponent,
+			Midpoint:  m.Midpoint,
+			Steepness: m.Steepness,
+			MinTemp:   m.MinTemp,
+			MaxTemp:   m.MaxTemp,
+		}
+		in, err := curve.curve()
+		if err != nil {
+			return nil, fmt.Errorf("member '%s': %w", m.Heatsink, err)
+		}
+		members[i] = heatsink.ZoneMember{
+			Heatsink:       hs,
+			MinTemperature: in.MinTemperature,
+			MaxTemperature: in.MaxTemperature,
+			Response:       in.Response,
+			Exponent:       in.Exponent,
+			Midpoint:       in.Midpoint,
+			Steepness:      in.Steepness,
+		}
+	}
+
+	fan, err := c.Fan.newFan(logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create fan '%s': %w", c.Fan.Name, err)
+	}
+	opts := []heatsink.Option{
+		heatsink.OptName(c.Name),
+		heatsink.OptTemperatureCheckPeriod(tempChkPeriod),
+		heatsink.OptLogger(logger),
+	}
+	zone, err := heatsink.NewZone(fan, members, append(opts, extra...)...)
+	if err != nil {
+		fan.Close()
+		return nil, err
+	}
+	logger.Info(
+		"created zone",
+		zap.String("name", c.Name),
+		zap.String("fan", c.Fan.Name),
+		zap.Int("member_count", len(members)),
+	)
+	return zone, nil
+}
+
+// fans returns the fan configs of the heatsinks followed by those of the zones, i.e. in the
+// order of the heatsinks created from this config
+func (c *config) fans() []configFan {
+	fans := make([]configFan, 0, len(c.Heatsinks)+len(c.Zones))
+	for _, hs := range c.Heatsinks {
+		fans = append(fans, hs.Fan)
+	}
+	for _, z := range c.Zones {
+		fans = append(fans, z.Fan)
+	}
+	return fans
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func Test_config_validateZones(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		zones   string
+		wantErr error
+	}{
+		"valid": {
+			zones: `[{"name": "case", "members": [{"heatsink": "cpu"}]},
+			         {"name": "top", "members": [{"heatsink": "case"}]}]`,
+		},
+		"no-name":        {zones: `[{"members": [{"heatsink": "cpu"}]}]`, wantErr: errBadZone},
+		"name-taken":     {zones: `[{"name": "cpu", "members": [{"heatsink": "cpu"}]}]`, wantErr: errBadZone},
+		"no-members":     {zones: `[{"name": "case"}]`, wantErr: errBadZone},
+		"unknown-member": {zones: `[{"name": "case", "members": [{"heatsink": "gpu"}]}]`, wantErr: errBadZone},
+		"bad-speed-range": {
+			zones:   `[{"name": "case", "fan": {"min_speed_value": 200, "max_speed_value": 100}, "members": [{"heatsink": "cpu"}]}]`,
+			wantErr: errBadSpeedValue,
+		},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			jsonData := strings.NewReader(fmt.Sprintf(
+				`{"heatsinks": [{"name": "cpu", "max_temp": 50}], "zones": %s}`, c.zones,
+			))
+			_, err := newConfig(jsonData, nil)
+			if !errors.Is(err, c.wantErr) {
+				t.Errorf("unexpected error\nwant: %v\n got: %v", c.wantErr, err)
+			}
+		})
+	}
+}
+
+func Test_config_newHeatsinks_zones(t *testing.T) {
+	t.Parallel()
+
+	sensorFile, cleanup := temporaryFile(t)
+	defer cleanup()
+	cpuFanFile, cleanup := temporaryFile(t)
+	defer cleanup()
+	gpuFanFile, cleanup := temporaryFile(t)
+	defer cleanup()
+	caseFanFile, cleanup := temporaryFile(t)
+	defer cleanup()
+
+	jsonData := strings.NewReader(fmt.Sprintf(`
+    {
+      "heatsinks": [
+        {"name": "cpu", "min_temp": 30, "max_temp": 80, "fan": {"path_glob": %q}, "sensor_path_globs": [%q]},
+        {"name": "gpu", "min_temp": 30, "max_temp": 90, "fan": {"path_glob": %q}, "sensor_path_globs": [%q]}
+      ],
+      "zones": [
+        {
+          "name": "case",
+          "fan": {"name": "chassis", "path_glob": %q, "rpm_path_glob": "/non/existent"},
+          "members": [
+            {"heatsink": "cpu", "response_type": "linear", "min_temp": 40, "max_temp": 70},
+            {"heatsink": "gpu"}
+          ]
+        }
+      ]
+    }
+  `, cpuFanFile.Name(), sensorFile.Name(), gpuFanFile.Name(), sensorFile.Name(), caseFanFile.Name()))
+
+	cfg, err := newConfig(jsonData, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	heatsinks, err := cfg.newHeatsinks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		for _, hs := range heatsinks {
+			hs.StopThermalControl()
+		}
+	}()
+
+	var names []string
+	for _, hs := range heatsinks {
+		names = append(names, hs.Name())
+	}
+	if diff := deep.Equal(names, []string{"cpu", "gpu", "case"}); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(heatsinks[2].SensorNames(), []string{"cpu"}); diff != nil {
+		t.Error(diff)
+	}
+	if zone := heatsinks[2]; zone.MinTemperature() != 40 || zone.MaxTemperature() != 70 {
+		t.Errorf("expected the range of the first member, got: [%v, %v]", zone.MinTemperature(), zone.MaxTemperature())
+	}
+	if fans := cfg.fans(); len(fans) != 3 || fans[2].Name != "chassis" {
+		t.Errorf("expected the zone's fan to follow those of the heatsinks, got: %+v", fans)
+	}
+}
+
+func Test_config_newHeatsinks_zoneError(t *testing.T) {
+	t.Parallel()
+
+	sensorFile, cleanup := temporaryFile(t)
+	defer cleanup()
+	fanFile, cleanup := temporaryFile(t)
+	defer cleanup()
+
+	jsonData := strings.NewReader(fmt.Sprintf(`
+    {
+      "heatsinks": [
+        {"name": "cpu", "max_temp": 50, "fan": {"path_glob": %q}, "sensor_path_globs": [%q]}
+      ],
+      "zones": [
+        {"name": "case", "fan": {"path_glob": "/non/existent"}, "members": [{"heatsink": "cpu", "response_type": "bogus"}]}
+      ]
+    }
+  `, fanFile.Name(), sensorFile.Name()))
+
+	cfg, err := newConfig(jsonData, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cfg.newHeatsinks()
+	if !errors.Is(err, errFanRespTypeUnknwon) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", errFanRespTypeUnknwon, err)
+	}
+	// the heatsinks created before the zone were released along with the lock of their fan
+	cfg.Zones = nil
+	heatsinks, err := cfg.newHeatsinks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	heatsinks[0].StopThermalControl()
+}
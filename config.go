@@ -1,15 +1,5 @@
 package heatsink
 
-import "errors"
-
-// internal errors defined to ease testing
-var (
-	errNoFan     = errors.New("no fan given")
-	errNoSensors = errors.New("no thermal sensors given")
-	errNilSensor = errors.New("a given sensor cannot be nil")
-	errBadTemps  = errors.New("maximum temperature must be greater than the minimum")
-)
-
 // Config is used to pass configuration to the heatsink factory function
 type Config struct {
 	// Fan is an instance that controls a physical fan, e.g. a fan attached to a CPU heatsink
@@ -24,18 +14,18 @@ type Config struct {
 
 func (c *Config) validate() error {
 	if c.Fan == nil {
-		return errNoFan
+		return ErrNoFan
 	}
 	if len(c.Sensors) == 0 {
-		return errNoSensors
+		return ErrNoSensors
 	}
 	for _, sensor := range c.Sensors {
 		if sensor == nil {
-			return errNilSensor
+			return ErrNilSensor
 		}
 	}
 	if c.MinTemperature >= c.MaxTemperature {
-		return errBadTemps
+		return ErrBadTemperatureRange
 	}
 	return nil
 }
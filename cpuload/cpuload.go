@@ -0,0 +1,111 @@
+// Package cpuload provides an implementation of the heatsink.AuxInput interface that reports
+// the utilization of all CPUs combined, as accounted by the kernel in '/proc/stat'
+package cpuload
+
+import (
+	"errors"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/malkhamis/heatsink"
+)
+
+// DefaultStatFile is where the kernel reports the time CPUs spent in each state
+const DefaultStatFile = "/proc/stat"
+
+// compile-time check for interface implementation and dependency inversion
+var _ heatsink.AuxInput = (*Meter)(nil)
+
+// Sentinel errors that are wrapped and returned by this package
+var (
+	ErrBadStat       = errors.New("malformed aggregate cpu line in stat file")
+	ErrNoElapsedTime = errors.New("no cpu time elapsed since the previous reading")
+)
+
+// Meter reports the utilization, in percent, of all CPUs combined between consecutive
+// readings, optionally smoothed so that only sustained load is reported. Instances of this
+// type are safe for concurrent use
+type Meter struct {
+	name      string
+	devFile   rdOnlyFile `deep:"-"`
+	smoothing time.Duration
+	now       func() time.Time
+	prev      cpuTimes
+	prevTime  time.Time
+	average   float64
+	hasAvg    bool
+	mutex     sync.Mutex
+	closed    bool
+}
+
+// New returns a new load meter that reads the given stat file, which is typically
+// '/proc/stat'. The stat file is read once by New, so the first call to Value() reports the
+// utilization since the meter was created. The stat file will remain open until Close() is
+// called. For details about options and defaults, see the documentation for type 'Option'
+func New(statFile string, options ...Option) (*Meter, error) {
+
+	devFile, err := os.OpenFile(statFile, os.O_RDONLY, os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	meter := &Meter{
+		name:    "cpu",
+		devFile: devFile,
+		now:     time.Now,
+	}
+	for _, applyOption := range options {
+		if applyOption == nil {
+			continue
+		}
+		applyOption(meter)
+	}
+
+	if meter.prev, err = meter.times(); err != nil {
+		devFile.Close()
+		return nil, err
+	}
+	meter.prevTime = meter.now()
+
+	return meter, nil
+}
+
+// Value returns the utilization of all CPUs combined in percent, between 0 and 100, since the
+// previous call, or since the meter was created for the first call. If smoothing is enabled,
+// it returns an exponential moving average of the utilization instead. If the meter is closed,
+// it returns heatsink.ErrAuxInputClosed. Concurrent calls to this method by multiple go
+// routines will be serialized
+func (m *Meter) Value() (float64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	utilization, elapsed, err := m.utilization()
+	if err != nil {
+		return 0, err
+	}
+	if m.smoothing <= 0 {
+		return utilization, nil
+	}
+	if !m.hasAvg {
+		m.average, m.hasAvg = utilization, true
+		return m.average, nil
+	}
+	weight := 1 - math.Exp(-elapsed.Seconds()/m.smoothing.Seconds())
+	m.average += weight * (utilization - m.average)
+	return m.average, nil
+}
+
+// Close closes this meter and releases held resources. If the meter was previously closed, it
+// returns heatsink.ErrAuxInputClosed
+func (m *Meter) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.close()
+}
+
+// Name returns the name of this meter
+func (m *Meter) Name() string {
+	return m.name
+}
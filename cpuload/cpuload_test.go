@@ -0,0 +1,147 @@
+package cpuload
+
+import (
+	"errors"
+	"io/ioutil"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/malkhamis/heatsink"
+)
+
+func TestNew_name(t *testing.T) {
+
+	filename, cleanup := fakeStat(t, 0, 0)
+	defer cleanup()
+
+	testCases := []struct {
+		name     string
+		options  []Option
+		expected string
+	}{
+		{"default", nil, "cpu"},
+		{"from-option", []Option{OptName("load"), nil}, "load"},
+		{"empty-option", []Option{OptName("")}, "cpu"},
+	}
+
+	for _, tc := range testCases {
+		meter, err := New(filename, tc.options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := meter.Name(); actual != tc.expected {
+			t.Errorf("%s: unexpected name\nwant: %s\n got: %s", tc.name, tc.expected, actual)
+		}
+		meter.Close()
+	}
+}
+
+func TestNew_errors(t *testing.T) {
+
+	if _, err := New("/this/file/does/not/exist"); err == nil {
+		t.Fatal("expected an error given a missing stat file")
+	}
+
+	filename, cleanup := fakeStat(t, 0, 0)
+	defer cleanup()
+	if err := ioutil.WriteFile(filename, []byte("intr 0\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(filename); !errors.Is(err, ErrBadStat) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", ErrBadStat, err)
+	}
+}
+
+func TestMeter_Value(t *testing.T) {
+
+	filename, cleanup := fakeStat(t, 100, 900)
+	defer cleanup()
+
+	meter, err := New(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer meter.Close()
+
+	steps := []struct {
+		user, idle uint64
+		expected   float64
+	}{
+		{user: 150, idle: 950, expected: 50},
+		{user: 250, idle: 950, expected: 100},
+		{user: 250, idle: 1050, expected: 0},
+		{user: 280, idle: 1120, expected: 30},
+	}
+
+	for i, step := range steps {
+		setTimes(t, filename, step.user, step.idle)
+		actual, err := meter.Value()
+		if err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if actual != step.expected {
+			t.Fatalf("step %d: unexpected utilization\nwant: %v\n got: %v", i, step.expected, actual)
+		}
+	}
+}
+
+func TestMeter_Value_smoothing(t *testing.T) {
+
+	filename, cleanup := fakeStat(t, 0, 0)
+	defer cleanup()
+
+	now, advance := fakeClock()
+	meter, err := New(filename, OptSmoothing(10*time.Second), func(m *Meter) { m.now = now })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer meter.Close()
+
+	weight := 1 - math.Exp(-0.5)
+	steps := []struct {
+		user, idle uint64
+		expected   float64
+	}{
+		{user: 0, idle: 100, expected: 0}, // the first reading starts the average
+		{user: 100, idle: 100, expected: 100 * weight},
+		{user: 200, idle: 100, expected: 100 * (1 - (1-weight)*(1-weight))},
+	}
+
+	for i, step := range steps {
+		setTimes(t, filename, step.user, step.idle)
+		advance(5 * time.Second)
+		actual, err := meter.Value()
+		if err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if math.Abs(actual-step.expected) > 1e-9 {
+			t.Fatalf("step %d: unexpected utilization\nwant: %v\n got: %v", i, step.expected, actual)
+		}
+	}
+}
+
+func TestMeter_Value_errors(t *testing.T) {
+
+	filename, cleanup := fakeStat(t, 10, 10)
+	defer cleanup()
+
+	meter, err := New(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := meter.Value(); !errors.Is(err, ErrNoElapsedTime) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", ErrNoElapsedTime, err)
+	}
+
+	if err := meter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := meter.Value(); !errors.Is(err, heatsink.ErrAuxInputClosed) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", heatsink.ErrAuxInputClosed, err)
+	}
+	if err := meter.Close(); !errors.Is(err, heatsink.ErrAuxInputClosed) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", heatsink.ErrAuxInputClosed, err)
+	}
+}
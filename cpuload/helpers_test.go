@@ -0,0 +1,53 @@
+package cpuload
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeStat creates a file that looks like /proc/stat with the given aggregate times
+func fakeStat(t *testing.T, user, idle uint64) (filename string, cleanup func()) {
+	t.Helper()
+
+	file, err := ioutil.TempFile("", "stat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	cleanup = func() { os.Remove(file.Name()) }
+	setTimes(t, file.Name(), user, idle)
+	return file.Name(), cleanup
+}
+
+func setTimes(t *testing.T, filename string, user, idle uint64) {
+	t.Helper()
+	content := fmt.Sprintf(
+		"cpu  %d 0 0 %d 0 0 0 0 0 0\ncpu0 %d 0 0 %d 0 0 0 0 0 0\nintr 0\n", user, idle, user, idle,
+	)
+	if err := ioutil.WriteFile(filename, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fakeClock returns a function that can be used as Meter.now and a function that advances it
+func fakeClock() (now func() time.Time, advance func(time.Duration)) {
+	var (
+		mutex   sync.Mutex
+		current = time.Unix(0, 0)
+	)
+	now = func() time.Time {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return current
+	}
+	advance = func(d time.Duration) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		current = current.Add(d)
+	}
+	return now, advance
+}
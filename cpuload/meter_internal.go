@@ -0,0 +1,104 @@
+package cpuload
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/malkhamis/heatsink"
+)
+
+type rdOnlyFile interface {
+	io.ReadSeeker
+	io.Closer
+}
+
+// cpuTimes are the cumulative times, in clock ticks, that all CPUs combined spent idle and in
+// total
+type cpuTimes struct {
+	idle  uint64
+	total uint64
+}
+
+// times returns the cumulative times of the aggregate 'cpu' line of the stat file, which looks
+// like 'cpu user nice system idle iowait irq softirq steal guest guest_nice'. Waiting for I/O
+// counts as idle, and guest times are excluded since they are already included in user times
+func (m *Meter) times() (cpuTimes, error) {
+
+	if _, err := m.devFile.Seek(0, 0); err != nil {
+		return cpuTimes{}, err
+	}
+	line, err := bufio.NewReader(m.devFile).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return cpuTimes{}, err
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return cpuTimes{}, fmt.Errorf("%w: '%s'", ErrBadStat, strings.TrimSpace(line))
+	}
+	fields = fields[1:]
+	if len(fields) > 8 {
+		fields = fields[:8]
+	}
+
+	var times cpuTimes
+	for i, field := range fields {
+		ticks, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return cpuTimes{}, fmt.Errorf("%w: %v", ErrBadStat, err)
+		}
+		times.total += ticks
+		if i == 3 || i == 4 { // idle and iowait
+			times.idle += ticks
+		}
+	}
+	return times, nil
+}
+
+// utilization returns the utilization in percent since the previous reading and the wall
+// time that elapsed since then
+func (m *Meter) utilization() (float64, time.Duration, error) {
+
+	if m.closed {
+		return 0, 0, heatsink.ErrAuxInputClosed
+	}
+
+	times, err := m.times()
+	if err != nil {
+		return 0, 0, err
+	}
+	if times.total <= m.prev.total {
+		return 0, 0, ErrNoElapsedTime
+	}
+	now := m.now()
+	elapsed := now.Sub(m.prevTime)
+
+	deltaTotal := times.total - m.prev.total
+	var deltaIdle uint64
+	if times.idle > m.prev.idle {
+		deltaIdle = times.idle - m.prev.idle
+	}
+	if deltaIdle > deltaTotal {
+		deltaIdle = deltaTotal
+	}
+	m.prev, m.prevTime = times, now
+
+	return 100 * float64(deltaTotal-deltaIdle) / float64(deltaTotal), elapsed, nil
+}
+
+func (m *Meter) close() error {
+	if m.closed {
+		return heatsink.ErrAuxInputClosed
+	}
+	m.closed = true
+
+	if err := m.devFile.Close(); err != nil {
+		return fmt.Errorf("failed to close device file while closing meter: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,30 @@
+package cpuload
+
+import "time"
+
+// Option is used to pass optional parameters to the Meter factory function
+type Option func(*Meter)
+
+// OptName sets the name of the meter. if name is empty, it is set to the default value
+//
+// (default: "cpu")
+func OptName(name string) Option {
+	return func(m *Meter) {
+		if name != "" {
+			m.name = name
+		}
+	}
+}
+
+// OptSmoothing averages the utilization exponentially with the given time constant, so that
+// short bursts barely move the reported value while load that is sustained for about the given
+// duration is reported in full. If the duration is not positive, it is set to the default value
+//
+// (default: no smoothing)
+func OptSmoothing(timeConstant time.Duration) Option {
+	return func(m *Meter) {
+		if timeConstant > 0 {
+			m.smoothing = timeConstant
+		}
+	}
+}
@@ -0,0 +1,400 @@
+// Package dbus provides a minimal D-Bus client that owns a bus name, answers method calls, and
+// emits signals, which is all that is needed to expose the heatsink daemon to desktop applets.
+// It authenticates with the EXTERNAL mechanism over Unix sockets and does not support passing
+// file descriptors
+package dbus
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sentinel errors that are wrapped and returned by this package
+var (
+	ErrBadAddress = errors.New("invalid bus address")
+	ErrAuth       = errors.New("bus rejected authentication")
+	ErrProtocol   = errors.New("d-bus protocol violation")
+	ErrClosed     = errors.New("connection is closed")
+	ErrNoReply    = errors.New("no reply within the call timeout")
+	ErrNameTaken  = errors.New("bus name is owned by another connection")
+)
+
+// Well-known names of the message bus itself
+const (
+	busName      = "org.freedesktop.DBus"
+	busPath      = ObjectPath("/org/freedesktop/DBus")
+	busInterface = "org.freedesktop.DBus"
+)
+
+// Standard error names
+const (
+	ErrorFailed        = "org.freedesktop.DBus.Error.Failed"
+	ErrorUnknownMethod = "org.freedesktop.DBus.Error.UnknownMethod"
+	ErrorUnknownObject = "org.freedesktop.DBus.Error.UnknownObject"
+	ErrorInvalidArgs   = "org.freedesktop.DBus.Error.InvalidArgs"
+)
+
+const (
+	dialTimeout = 10 * time.Second
+	authTimeout = 10 * time.Second
+)
+
+// Error is an error reply, either received from a peer or returned by a Handler to be sent
+type Error struct {
+	Name    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return e.Name
+	}
+	return e.Name + ": " + e.Message
+}
+
+// Call is a method call received from a peer
+type Call struct {
+	Sender    string
+	Path      ObjectPath
+	Interface string
+	Member    string
+	Body      []interface{}
+}
+
+// Handler answers a method call with the values of the reply or an error. An error of type
+// *Error is sent as is and any other error is sent as org.freedesktop.DBus.Error.Failed. It is
+// called by the goroutine that reads from the bus, so it should return quickly
+type Handler func(call *Call) (reply []interface{}, err error)
+
+// Conn is a connection to a message bus. Instances of this type are safe for concurrent use
+type Conn struct {
+	conn        net.Conn
+	reader      *bufio.Reader
+	handler     Handler
+	callTimeout time.Duration
+	uniqueName  string
+
+	writeMutex sync.Mutex
+	mutex      sync.Mutex
+	serial     uint32
+	pending    map[uint32]chan *message
+	closed     bool
+	wg         sync.WaitGroup
+}
+
+// SystemBusAddress returns the address of the system bus
+func SystemBusAddress() string {
+	if addr := os.Getenv("DBUS_SYSTEM_BUS_ADDRESS"); addr != "" {
+		return addr
+	}
+	return "unix:path=/var/run/dbus/system_bus_socket"
+}
+
+// SessionBusAddress returns the address of the session bus of the current user
+func SessionBusAddress() string {
+	if addr := os.Getenv("DBUS_SESSION_BUS_ADDRESS"); addr != "" {
+		return addr
+	}
+	return "unix:path=/run/user/" + strconv.Itoa(os.Getuid()) + "/bus"
+}
+
+// dialAddress connects to the first Unix socket in the given address list, e.g.
+// "unix:path=/var/run/dbus/system_bus_socket;unix:abstract=/tmp/dbus-x"
+func dialAddress(address string) (net.Conn, error) {
+	var lastErr error = fmt.Errorf("%w: no supported transport in '%s'", ErrBadAddress, address)
+	for _, entry := range strings.Split(address, ";") {
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 || parts[0] != "unix" {
+			continue
+		}
+		for _, kv := range strings.Split(parts[1], ",") {
+			var path string
+			switch {
+			case strings.HasPrefix(kv, "path="):
+				path = strings.TrimPrefix(kv, "path=")
+			case strings.HasPrefix(kv, "abstract="):
+				path = "@" + strings.TrimPrefix(kv, "abstract=")
+			default:
+				continue
+			}
+			conn, err := net.DialTimeout("unix", path, dialTimeout)
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+	}
+	return nil, lastErr
+}
+
+// Dial connects to the message bus at the given address, authenticates, and registers with
+// it. Method calls that arrive on the connection are passed to the handler given with
+// OptHandler. For details about options and defaults, see the documentation for type 'Option'
+func Dial(address string, options ...Option) (*Conn, error) {
+
+	conn, err := dialAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	c := &Conn{
+		conn:        conn,
+		reader:      bufio.NewReader(conn),
+		callTimeout: 25 * time.Second,
+		pending:     make(map[uint32]chan *message),
+	}
+	for _, applyOption := range options {
+		applyOption(c)
+	}
+
+	if err := c.authenticate(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c.wg.Add(1)
+	go c.serve()
+
+	reply, err := c.Call(busName, busPath, busInterface, "Hello")
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	if len(reply) != 1 {
+		c.Close()
+		return nil, fmt.Errorf("%w: bad reply to Hello", ErrProtocol)
+	}
+	c.uniqueName, _ = reply[0].(string)
+	return c, nil
+}
+
+// authenticate runs the EXTERNAL authentication handshake with the credentials of the process
+func (c *Conn) authenticate() error {
+
+	if err := c.conn.SetDeadline(time.Now().Add(authTimeout)); err != nil {
+		return err
+	}
+	defer c.conn.SetDeadline(time.Time{})
+
+	uid := hex.EncodeToString([]byte(strconv.Itoa(os.Getuid())))
+	if _, err := c.conn.Write([]byte("\x00AUTH EXTERNAL " + uid + "\r\n")); err != nil {
+		return err
+	}
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "OK ") {
+		return fmt.Errorf("%w: %s", ErrAuth, strings.TrimSpace(line))
+	}
+	_, err = c.conn.Write([]byte("BEGIN\r\n"))
+	return err
+}
+
+// UniqueName returns the name the bus assigned to this connection, e.g. ":1.42"
+func (c *Conn) UniqueName() string {
+	return c.uniqueName
+}
+
+// RequestName asks the bus for the given well-known name without queueing for it. It returns
+// ErrNameTaken if another connection owns the name
+func (c *Conn) RequestName(name string) error {
+	const doNotQueue, primaryOwner, alreadyOwner = uint32(4), uint32(1), uint32(4)
+	reply, err := c.Call(busName, busPath, busInterface, "RequestName", name, doNotQueue)
+	if err != nil {
+		return err
+	}
+	if len(reply) != 1 {
+		return fmt.Errorf("%w: bad reply to RequestName", ErrProtocol)
+	}
+	if code, _ := reply[0].(uint32); code != primaryOwner && code != alreadyOwner {
+		return fmt.Errorf("%w: '%s'", ErrNameTaken, name)
+	}
+	return nil
+}
+
+// Call calls the given method and waits for its reply for up to the call timeout. An error
+// reply is returned as an *Error
+func (c *Conn) Call(dest string, path ObjectPath, iface, member string, args ...interface{}) ([]interface{}, error) {
+
+	replies := make(chan *message, 1)
+	c.mutex.Lock()
+	if c.closed {
+		c.mutex.Unlock()
+		return nil, ErrClosed
+	}
+	serial := c.nextSerial()
+	c.pending[serial] = replies
+	c.mutex.Unlock()
+	defer func() {
+		c.mutex.Lock()
+		delete(c.pending, serial)
+		c.mutex.Unlock()
+	}()
+
+	msg := &message{
+		kind:   typeMethodCall,
+		serial: serial,
+		path:   path,
+		iface:  iface,
+		member: member,
+		dest:   dest,
+		body:   args,
+	}
+	if err := c.write(msg); err != nil {
+		return nil, err
+	}
+
+	select {
+	case reply, ok := <-replies:
+		if !ok {
+			return nil, ErrClosed
+		}
+		if reply.kind == typeError {
+			e := &Error{Name: reply.errName}
+			if len(reply.body) > 0 {
+				e.Message, _ = reply.body[0].(string)
+			}
+			return nil, e
+		}
+		return reply.body, nil
+	case <-time.After(c.callTimeout):
+		return nil, fmt.Errorf("%w: %s.%s", ErrNoReply, iface, member)
+	}
+}
+
+// Emit broadcasts a signal from the given object
+func (c *Conn) Emit(path ObjectPath, iface, member string, args ...interface{}) error {
+	c.mutex.Lock()
+	if c.closed {
+		c.mutex.Unlock()
+		return ErrClosed
+	}
+	serial := c.nextSerial()
+	c.mutex.Unlock()
+	return c.write(&message{
+		kind:   typeSignal,
+		flags:  flagNoReplyExpected,
+		serial: serial,
+		path:   path,
+		iface:  iface,
+		member: member,
+		body:   args,
+	})
+}
+
+// Close disconnects from the bus. If the connection is already closed, it returns ErrClosed
+func (c *Conn) Close() error {
+	c.mutex.Lock()
+	if c.closed {
+		c.mutex.Unlock()
+		return ErrClosed
+	}
+	c.closed = true
+	c.mutex.Unlock()
+
+	err := c.conn.Close()
+	c.wg.Wait()
+	return err
+}
+
+// nextSerial returns a serial for an outgoing message. The caller must hold the mutex
+func (c *Conn) nextSerial() uint32 {
+	c.serial++
+	if c.serial == 0 {
+		c.serial++
+	}
+	return c.serial
+}
+
+func (c *Conn) write(msg *message) error {
+	data, err := msg.encode()
+	if err != nil {
+		return err
+	}
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	_, err = c.conn.Write(data)
+	return err
+}
+
+// serve reads messages until the connection breaks, routing replies to their callers and
+// method calls to the handler
+func (c *Conn) serve() {
+
+	defer c.wg.Done()
+	defer func() {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		c.closed = true
+		for serial, replies := range c.pending {
+			close(replies)
+			delete(c.pending, serial)
+		}
+	}()
+
+	for {
+		msg, err := readMessage(c.reader)
+		if err != nil {
+			c.conn.Close()
+			return
+		}
+		switch msg.kind {
+		case typeMethodReturn, typeError:
+			c.mutex.Lock()
+			replies, ok := c.pending[msg.replyTo]
+			c.mutex.Unlock()
+			if ok {
+				select {
+				case replies <- msg:
+				default: // a duplicate reply
+				}
+			}
+		case typeMethodCall:
+			c.answer(msg)
+		}
+	}
+}
+
+// answer passes the given method call to the handler and sends back its reply, unless the
+// caller does not expect one
+func (c *Conn) answer(msg *message) {
+
+	var reply []interface{}
+	var err error
+	switch {
+	case msg.iface == "org.freedesktop.DBus.Peer" && msg.member == "Ping":
+	case c.handler == nil:
+		err = &Error{Name: ErrorUnknownObject, Message: string(msg.path)}
+	default:
+		reply, err = c.handler(&Call{
+			Sender:    msg.sender,
+			Path:      msg.path,
+			Interface: msg.iface,
+			Member:    msg.member,
+			Body:      msg.body,
+		})
+	}
+	if msg.flags&flagNoReplyExpected != 0 {
+		return
+	}
+
+	c.mutex.Lock()
+	serial := c.nextSerial()
+	c.mutex.Unlock()
+	resp := &message{kind: typeMethodReturn, serial: serial, replyTo: msg.serial, dest: msg.sender, body: reply}
+	if err != nil {
+		var dbusErr *Error
+		if !errors.As(err, &dbusErr) {
+			dbusErr = &Error{Name: ErrorFailed, Message: err.Error()}
+		}
+		resp.kind, resp.errName, resp.body = typeError, dbusErr.Name, []interface{}{dbusErr.Message}
+	}
+	c.write(resp) // if the connection broke, the read loop notices
+}
@@ -0,0 +1,219 @@
+package dbus
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+)
+
+func TestDial(t *testing.T) {
+
+	bus := newFakeBus(t)
+	defer bus.close()
+
+	conn, err := Dial(bus.address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := ":1.7", conn.UniqueName(); expected != actual {
+		t.Errorf("unexpected unique name\nwant: %q\n got: %q", expected, actual)
+	}
+	if err := conn.RequestName("org.example.Mine"); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.RequestName(bus.takenName); !errors.Is(err, ErrNameTaken) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", ErrNameTaken, err)
+	}
+
+	if err := conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Close(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", ErrClosed, err)
+	}
+	if _, err := conn.Call("org.example", "/", "org.example", "Do"); !errors.Is(err, ErrClosed) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", ErrClosed, err)
+	}
+}
+
+func TestDial_errors(t *testing.T) {
+
+	testCases := []struct {
+		name        string
+		address     string
+		expectedErr error
+	}{
+		{"no unix transport", "tcp:host=localhost,port=1234", ErrBadAddress},
+		{"empty", "", ErrBadAddress},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Dial(tc.address)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", tc.expectedErr, err)
+			}
+		})
+	}
+
+	if _, err := Dial("unix:path=/this/socket/does/not/exist"); err == nil {
+		t.Fatal("expected an error dialing a missing socket")
+	}
+}
+
+func TestConn_answer(t *testing.T) {
+
+	bus := newFakeBus(t)
+	defer bus.close()
+
+	handler := func(call *Call) ([]interface{}, error) {
+		switch call.Member {
+		case "Echo":
+			return call.Body, nil
+		case "Refuse":
+			return nil, &Error{Name: ErrorInvalidArgs, Message: "no thanks"}
+		}
+		return nil, fmt.Errorf("broken")
+	}
+	conn, err := Dial(bus.address(), OptHandler(handler))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	testCases := []struct {
+		member   string
+		body     []interface{}
+		expected *message
+	}{
+		{
+			member:   "Echo",
+			body:     []interface{}{"hi", 1.5},
+			expected: &message{kind: typeMethodReturn, body: []interface{}{"hi", 1.5}},
+		},
+		{
+			member:   "Refuse",
+			expected: &message{kind: typeError, errName: ErrorInvalidArgs, body: []interface{}{"no thanks"}},
+		},
+		{
+			member:   "Crash",
+			expected: &message{kind: typeError, errName: ErrorFailed, body: []interface{}{"broken"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		bus.send(&message{
+			kind:   typeMethodCall,
+			path:   "/org/example",
+			iface:  "org.example",
+			member: tc.member,
+			sender: ":1.9",
+			body:   tc.body,
+		})
+		select {
+		case reply := <-bus.messages:
+			tc.expected.serial, tc.expected.dest, tc.expected.replyTo = reply.serial, ":1.9", bus.serial
+			if diff := deep.Equal(reply, tc.expected); diff != nil {
+				t.Fatalf("%s: %v", tc.member, diff)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s: timeout waiting for the reply", tc.member)
+		}
+	}
+
+	// calls that do not expect a reply are not answered
+	bus.send(&message{kind: typeMethodCall, flags: flagNoReplyExpected, path: "/", member: "Echo"})
+	select {
+	case reply := <-bus.messages:
+		t.Fatalf("unexpected reply: %+v", reply)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestConn_Emit(t *testing.T) {
+
+	bus := newFakeBus(t)
+	defer bus.close()
+
+	conn, err := Dial(bus.address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := conn.Emit("/org/example", "org.example", "Changed", map[string]Variant{"X": {1.0}}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case signal := <-bus.messages:
+		expected := &message{
+			kind:   typeSignal,
+			flags:  flagNoReplyExpected,
+			serial: signal.serial,
+			path:   "/org/example",
+			iface:  "org.example",
+			member: "Changed",
+			body:   []interface{}{map[interface{}]interface{}{"X": Variant{1.0}}},
+		}
+		if diff := deep.Equal(signal, expected); diff != nil {
+			t.Fatal(diff)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for the signal")
+	}
+}
+
+func TestConn_Call_errorReply(t *testing.T) {
+
+	bus := newFakeBus(t)
+	defer bus.close()
+
+	conn, err := Dial(bus.address(), OptCallTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	go func() {
+		call := <-bus.messages
+		bus.send(&message{kind: typeError, replyTo: call.serial, errName: ErrorUnknownMethod, body: []interface{}{"nope"}})
+	}()
+	_, err = conn.Call("org.example", "/", "org.example", "Missing")
+	expected := &Error{Name: ErrorUnknownMethod, Message: "nope"}
+	if diff := deep.Equal(err, expected); diff != nil {
+		t.Fatal(diff)
+	}
+
+	if _, err := conn.Call("org.example", "/", "org.example", "Slow"); !errors.Is(err, ErrNoReply) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", ErrNoReply, err)
+	}
+}
+
+func TestBusAddresses(t *testing.T) {
+
+	for _, tc := range []struct {
+		env     string
+		address func() string
+	}{
+		{"DBUS_SYSTEM_BUS_ADDRESS", SystemBusAddress},
+		{"DBUS_SESSION_BUS_ADDRESS", SessionBusAddress},
+	} {
+		orig, set := os.LookupEnv(tc.env)
+		os.Setenv(tc.env, "unix:path=/tmp/custom")
+		if expected, actual := "unix:path=/tmp/custom", tc.address(); expected != actual {
+			t.Errorf("unexpected address\nwant: %q\n got: %q", expected, actual)
+		}
+		os.Unsetenv(tc.env)
+		if actual := tc.address(); actual == "" {
+			t.Errorf("expected a default address for %s", tc.env)
+		}
+		if set {
+			os.Setenv(tc.env, orig)
+		}
+	}
+}
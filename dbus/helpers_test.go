@@ -0,0 +1,115 @@
+package dbus
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeBus accepts a single connection, authenticates it, answers Hello and RequestName, and
+// records every other message it receives
+type fakeBus struct {
+	listener net.Listener
+	dir      string
+	// takenName is a name that RequestName reports as owned by another connection
+	takenName string
+
+	mutex    sync.Mutex
+	conn     net.Conn
+	serial   uint32
+	messages chan *message
+}
+
+func newFakeBus(t *testing.T) *fakeBus {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "dbus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("unix", filepath.Join(dir, "bus"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	b := &fakeBus{
+		listener:  listener,
+		dir:       dir,
+		takenName: "org.example.Taken",
+		messages:  make(chan *message, 100),
+	}
+	go b.accept()
+	return b
+}
+
+func (b *fakeBus) address() string {
+	return "unix:path=" + b.listener.Addr().String()
+}
+
+func (b *fakeBus) accept() {
+	conn, err := b.listener.Accept()
+	if err != nil {
+		return
+	}
+	b.mutex.Lock()
+	b.conn = conn
+	b.mutex.Unlock()
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "\x00AUTH EXTERNAL ") {
+		conn.Write([]byte("REJECTED EXTERNAL\r\n"))
+		return
+	}
+	conn.Write([]byte("OK 0123456789abcdef\r\n"))
+	if line, err := reader.ReadString('\n'); err != nil || line != "BEGIN\r\n" {
+		return
+	}
+
+	for {
+		msg, err := readMessage(reader)
+		if err != nil {
+			return
+		}
+		switch {
+		case msg.member == "Hello":
+			b.send(&message{kind: typeMethodReturn, replyTo: msg.serial, body: []interface{}{":1.7"}})
+		case msg.member == "RequestName":
+			code := uint32(1)
+			if msg.body[0] == b.takenName {
+				code = 3
+			}
+			b.send(&message{kind: typeMethodReturn, replyTo: msg.serial, body: []interface{}{code}})
+		default:
+			b.messages <- msg
+		}
+	}
+}
+
+// send writes the given message to the connection, assigning it the next serial
+func (b *fakeBus) send(msg *message) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.serial++
+	msg.serial = b.serial
+	data, err := msg.encode()
+	if err != nil {
+		panic(err)
+	}
+	b.conn.Write(data)
+}
+
+func (b *fakeBus) close() {
+	b.listener.Close()
+	b.mutex.Lock()
+	if b.conn != nil {
+		b.conn.Close()
+	}
+	b.mutex.Unlock()
+	os.RemoveAll(b.dir)
+}
@@ -0,0 +1,637 @@
+package dbus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Message types
+const (
+	typeMethodCall   = 1
+	typeMethodReturn = 2
+	typeError        = 3
+	typeSignal       = 4
+)
+
+// Header flags
+const (
+	flagNoReplyExpected = 0x1
+)
+
+// Header field codes
+const (
+	fieldPath        = 1
+	fieldInterface   = 2
+	fieldMember      = 3
+	fieldErrorName   = 4
+	fieldReplySerial = 5
+	fieldDestination = 6
+	fieldSender      = 7
+	fieldSignature   = 8
+)
+
+// maxMessageSize is the largest message the specification allows
+const maxMessageSize = 1 << 27
+
+// ObjectPath is a D-Bus object path, e.g. "/org/freedesktop/DBus"
+type ObjectPath string
+
+// Signature is a D-Bus type signature, e.g. "a{sv}"
+type Signature string
+
+// Variant is a value along with its type, which is derived from the Go type of the value
+type Variant struct {
+	Value interface{}
+}
+
+// Struct is a D-Bus struct, whose fields are encoded in order
+type Struct []interface{}
+
+// message is a D-Bus message of any type
+type message struct {
+	kind    byte
+	flags   byte
+	serial  uint32
+	path    ObjectPath
+	iface   string
+	member  string
+	errName string
+	replyTo uint32
+	dest    string
+	sender  string
+	body    []interface{}
+}
+
+// signatureOf returns the signature of the given value, which must be of one of the types
+// this package can encode
+func signatureOf(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case uint8:
+		return "y", nil
+	case bool:
+		return "b", nil
+	case int16:
+		return "n", nil
+	case uint16:
+		return "q", nil
+	case int32:
+		return "i", nil
+	case uint32:
+		return "u", nil
+	case int64:
+		return "x", nil
+	case uint64:
+		return "t", nil
+	case float64:
+		return "d", nil
+	case string:
+		return "s", nil
+	case ObjectPath:
+		return "o", nil
+	case Signature:
+		return "g", nil
+	case Variant:
+		return "v", nil
+	case []string:
+		return "as", nil
+	case []ObjectPath:
+		return "ao", nil
+	case []Variant:
+		return "av", nil
+	case map[string]Variant:
+		return "a{sv}", nil
+	case Struct:
+		sig := "("
+		for _, field := range v {
+			fieldSig, err := signatureOf(field)
+			if err != nil {
+				return "", err
+			}
+			sig += fieldSig
+		}
+		return sig + ")", nil
+	}
+	return "", fmt.Errorf("%w: cannot encode %T", ErrProtocol, v)
+}
+
+// alignment returns the alignment of values of the given type code
+func alignment(code byte) int {
+	switch code {
+	case 'n', 'q':
+		return 2
+	case 'b', 'i', 'u', 's', 'o', 'a':
+		return 4
+	case 'x', 't', 'd', '(', '{':
+		return 8
+	}
+	return 1
+}
+
+// encoder appends little-endian D-Bus values to a buffer whose start is 8-byte aligned
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) align(n int) {
+	for len(e.buf)%n != 0 {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *encoder) uint32(v uint32) {
+	e.align(4)
+	e.buf = append(e.buf, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(e.buf[len(e.buf)-4:], v)
+}
+
+func (e *encoder) uint64(v uint64) {
+	e.align(8)
+	e.buf = append(e.buf, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint64(e.buf[len(e.buf)-8:], v)
+}
+
+func (e *encoder) string(s string) {
+	e.uint32(uint32(len(s)))
+	e.buf = append(e.buf, s...)
+	e.buf = append(e.buf, 0)
+}
+
+func (e *encoder) signature(s string) {
+	e.buf = append(e.buf, byte(len(s)))
+	e.buf = append(e.buf, s...)
+	e.buf = append(e.buf, 0)
+}
+
+// array encodes n elements of the given alignment using the given function
+func (e *encoder) array(elemAlign, n int, encodeElem func(i int) error) error {
+	e.uint32(0)
+	lenPos := len(e.buf) - 4
+	e.align(elemAlign)
+	start := len(e.buf)
+	for i := 0; i < n; i++ {
+		if err := encodeElem(i); err != nil {
+			return err
+		}
+	}
+	binary.LittleEndian.PutUint32(e.buf[lenPos:], uint32(len(e.buf)-start))
+	return nil
+}
+
+func (e *encoder) encode(v interface{}) error {
+	switch v := v.(type) {
+	case uint8:
+		e.buf = append(e.buf, v)
+	case bool:
+		var b uint32
+		if v {
+			b = 1
+		}
+		e.uint32(b)
+	case int16:
+		e.align(2)
+		e.buf = append(e.buf, byte(v), byte(uint16(v)>>8))
+	case uint16:
+		e.align(2)
+		e.buf = append(e.buf, byte(v), byte(v>>8))
+	case int32:
+		e.uint32(uint32(v))
+	case uint32:
+		e.uint32(v)
+	case int64:
+		e.uint64(uint64(v))
+	case uint64:
+		e.uint64(v)
+	case float64:
+		e.uint64(math.Float64bits(v))
+	case string:
+		e.string(v)
+	case ObjectPath:
+		e.string(string(v))
+	case Signature:
+		e.signature(string(v))
+	case Variant:
+		sig, err := signatureOf(v.Value)
+		if err != nil {
+			return err
+		}
+		e.signature(sig)
+		return e.encode(v.Value)
+	case []string:
+		return e.array(4, len(v), func(i int) error { e.string(v[i]); return nil })
+	case []ObjectPath:
+		return e.array(4, len(v), func(i int) error { e.string(string(v[i])); return nil })
+	case []Variant:
+		return e.array(1, len(v), func(i int) error { return e.encode(v[i]) })
+	case map[string]Variant:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		return e.array(8, len(keys), func(i int) error {
+			e.align(8)
+			e.string(keys[i])
+			return e.encode(v[keys[i]])
+		})
+	case Struct:
+		e.align(8)
+		for _, field := range v {
+			if err := e.encode(field); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("%w: cannot encode %T", ErrProtocol, v)
+	}
+	return nil
+}
+
+// encode returns the wire format of the message, which is always little-endian
+func (m *message) encode() ([]byte, error) {
+
+	body := &encoder{}
+	sig := ""
+	for _, v := range m.body {
+		vSig, err := signatureOf(v)
+		if err != nil {
+			return nil, err
+		}
+		sig += vSig
+		if err := body.encode(v); err != nil {
+			return nil, err
+		}
+	}
+
+	var fields []interface{}
+	addField := func(code byte, value interface{}) {
+		fields = append(fields, Struct{code, Variant{value}})
+	}
+	if m.path != "" {
+		addField(fieldPath, m.path)
+	}
+	if m.iface != "" {
+		addField(fieldInterface, m.iface)
+	}
+	if m.member != "" {
+		addField(fieldMember, m.member)
+	}
+	if m.errName != "" {
+		addField(fieldErrorName, m.errName)
+	}
+	if m.replyTo != 0 {
+		addField(fieldReplySerial, m.replyTo)
+	}
+	if m.dest != "" {
+		addField(fieldDestination, m.dest)
+	}
+	if m.sender != "" {
+		addField(fieldSender, m.sender)
+	}
+	if sig != "" {
+		addField(fieldSignature, Signature(sig))
+	}
+
+	header := &encoder{buf: []byte{'l', m.kind, m.flags, 1}}
+	header.uint32(uint32(len(body.buf)))
+	header.uint32(m.serial)
+	err := header.array(8, len(fields), func(i int) error { return header.encode(fields[i]) })
+	if err != nil {
+		return nil, err
+	}
+	header.align(8)
+	if len(header.buf)+len(body.buf) > maxMessageSize {
+		return nil, fmt.Errorf("%w: message too large", ErrProtocol)
+	}
+	return append(header.buf, body.buf...), nil
+}
+
+// decoder reads D-Bus values from a buffer whose start is 8-byte aligned
+type decoder struct {
+	buf   []byte
+	pos   int
+	order binary.ByteOrder
+	depth int
+}
+
+func (d *decoder) align(n int) error {
+	for d.pos%n != 0 {
+		if d.pos >= len(d.buf) || d.buf[d.pos] != 0 {
+			return fmt.Errorf("%w: bad padding", ErrProtocol)
+		}
+		d.pos++
+	}
+	return nil
+}
+
+func (d *decoder) next(n int) ([]byte, error) {
+	if n < 0 || d.pos+n > len(d.buf) {
+		return nil, fmt.Errorf("%w: truncated message", ErrProtocol)
+	}
+	b := d.buf[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *decoder) uint32() (uint32, error) {
+	if err := d.align(4); err != nil {
+		return 0, err
+	}
+	b, err := d.next(4)
+	if err != nil {
+		return 0, err
+	}
+	return d.order.Uint32(b), nil
+}
+
+func (d *decoder) uint64() (uint64, error) {
+	if err := d.align(8); err != nil {
+		return 0, err
+	}
+	b, err := d.next(8)
+	if err != nil {
+		return 0, err
+	}
+	return d.order.Uint64(b), nil
+}
+
+func (d *decoder) string() (string, error) {
+	n, err := d.uint32()
+	if err != nil {
+		return "", err
+	}
+	b, err := d.next(int(n) + 1)
+	if err != nil {
+		return "", err
+	}
+	return string(b[:n]), nil
+}
+
+func (d *decoder) signature() (string, error) {
+	n, err := d.next(1)
+	if err != nil {
+		return "", err
+	}
+	b, err := d.next(int(n[0]) + 1)
+	if err != nil {
+		return "", err
+	}
+	return string(b[:n[0]]), nil
+}
+
+// splitType returns the first complete type of the given signature and the rest of it
+func splitType(sig string) (first, rest string, err error) {
+	if sig == "" {
+		return "", "", fmt.Errorf("%w: incomplete signature", ErrProtocol)
+	}
+	switch sig[0] {
+	case 'a':
+		elem, rest, err := splitType(sig[1:])
+		if err != nil {
+			return "", "", err
+		}
+		return "a" + elem, rest, nil
+	case '(', '{':
+		closing := map[byte]byte{'(': ')', '{': '}'}[sig[0]]
+		inner := sig[1:]
+		for inner != "" && inner[0] != closing {
+			if _, inner, err = splitType(inner); err != nil {
+				return "", "", err
+			}
+		}
+		if inner == "" {
+			return "", "", fmt.Errorf("%w: unbalanced signature '%s'", ErrProtocol, sig)
+		}
+		n := len(sig) - len(inner) + 1
+		return sig[:n], sig[n:], nil
+	}
+	if !strings.ContainsRune("ybnqiuxtdsogv", rune(sig[0])) {
+		return "", "", fmt.Errorf("%w: unsupported type '%c'", ErrProtocol, sig[0])
+	}
+	return sig[:1], sig[1:], nil
+}
+
+// decode reads a value of the given single complete type. Arrays are decoded as slices of
+// interface{}, dictionaries as maps, and structs as Struct
+func (d *decoder) decode(sig string) (interface{}, error) {
+
+	d.depth++
+	defer func() { d.depth-- }()
+	if d.depth > 64 {
+		return nil, fmt.Errorf("%w: nesting too deep", ErrProtocol)
+	}
+
+	switch sig[0] {
+	case 'y':
+		b, err := d.next(1)
+		if err != nil {
+			return nil, err
+		}
+		return b[0], nil
+	case 'b':
+		v, err := d.uint32()
+		return v != 0, err
+	case 'n', 'q':
+		if err := d.align(2); err != nil {
+			return nil, err
+		}
+		b, err := d.next(2)
+		if err != nil {
+			return nil, err
+		}
+		if sig[0] == 'n' {
+			return int16(d.order.Uint16(b)), nil
+		}
+		return d.order.Uint16(b), nil
+	case 'i':
+		v, err := d.uint32()
+		return int32(v), err
+	case 'u':
+		return d.uint32()
+	case 'x':
+		v, err := d.uint64()
+		return int64(v), err
+	case 't':
+		return d.uint64()
+	case 'd':
+		v, err := d.uint64()
+		return math.Float64frombits(v), err
+	case 's':
+		return d.string()
+	case 'o':
+		s, err := d.string()
+		return ObjectPath(s), err
+	case 'g':
+		s, err := d.signature()
+		return Signature(s), err
+	case 'v':
+		s, err := d.signature()
+		if err != nil {
+			return nil, err
+		}
+		first, rest, err := splitType(s)
+		if err != nil || rest != "" {
+			return nil, fmt.Errorf("%w: bad variant signature '%s'", ErrProtocol, s)
+		}
+		v, err := d.decode(first)
+		return Variant{v}, err
+	case 'a':
+		return d.decodeArray(sig[1:])
+	case '(', '{':
+		if err := d.align(8); err != nil {
+			return nil, err
+		}
+		var fields Struct
+		for inner := sig[1 : len(sig)-1]; inner != ""; {
+			var field string
+			var err error
+			if field, inner, err = splitType(inner); err != nil {
+				return nil, err
+			}
+			v, err := d.decode(field)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, v)
+		}
+		return fields, nil
+	}
+	return nil, fmt.Errorf("%w: unsupported type '%s'", ErrProtocol, sig)
+}
+
+func (d *decoder) decodeArray(elemSig string) (interface{}, error) {
+	n, err := d.uint32()
+	if err != nil {
+		return nil, err
+	}
+	if err := d.align(alignment(elemSig[0])); err != nil {
+		return nil, err
+	}
+	end := d.pos + int(n)
+	if n > maxMessageSize || end > len(d.buf) {
+		return nil, fmt.Errorf("%w: truncated array", ErrProtocol)
+	}
+	if elemSig[0] == '{' {
+		dict := make(map[interface{}]interface{})
+		for d.pos < end {
+			entry, err := d.decode(elemSig)
+			if err != nil {
+				return nil, err
+			}
+			pair := entry.(Struct)
+			if len(pair) != 2 {
+				return nil, fmt.Errorf("%w: bad dict entry '%s'", ErrProtocol, elemSig)
+			}
+			dict[pair[0]] = pair[1]
+		}
+		return dict, nil
+	}
+	elems := []interface{}{}
+	for d.pos < end {
+		v, err := d.decode(elemSig)
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, v)
+	}
+	return elems, nil
+}
+
+// decodeValues reads values of every complete type in the given signature
+func (d *decoder) decodeValues(sig string) ([]interface{}, error) {
+	var values []interface{}
+	for sig != "" {
+		var first string
+		var err error
+		if first, sig, err = splitType(sig); err != nil {
+			return nil, err
+		}
+		v, err := d.decode(first)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// readMessage reads a single message from the given reader
+func readMessage(r io.Reader) (*message, error) {
+
+	fixed := make([]byte, 16)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, err
+	}
+	var order binary.ByteOrder
+	switch fixed[0] {
+	case 'l':
+		order = binary.LittleEndian
+	case 'B':
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("%w: bad endianness '%c'", ErrProtocol, fixed[0])
+	}
+	if fixed[3] != 1 {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrProtocol, fixed[3])
+	}
+	bodyLen := order.Uint32(fixed[4:])
+	fieldsLen := order.Uint32(fixed[12:])
+	headerLen := 16 + int(fieldsLen)
+	padded := (headerLen + 7) &^ 7
+	if uint64(padded)+uint64(bodyLen) > maxMessageSize {
+		return nil, fmt.Errorf("%w: message too large", ErrProtocol)
+	}
+
+	buf := make([]byte, padded+int(bodyLen))
+	copy(buf, fixed)
+	if _, err := io.ReadFull(r, buf[16:]); err != nil {
+		return nil, err
+	}
+
+	m := &message{kind: fixed[1], flags: fixed[2], serial: order.Uint32(fixed[8:])}
+	header := &decoder{buf: buf[:headerLen], pos: 12, order: order}
+	fields, err := header.decode("a(yv)")
+	if err != nil {
+		return nil, err
+	}
+	sig := ""
+	for _, f := range fields.([]interface{}) {
+		field := f.(Struct)
+		value := field[1].(Variant).Value
+		var ok bool
+		switch field[0].(byte) {
+		case fieldPath:
+			m.path, ok = value.(ObjectPath)
+		case fieldInterface:
+			m.iface, ok = value.(string)
+		case fieldMember:
+			m.member, ok = value.(string)
+		case fieldErrorName:
+			m.errName, ok = value.(string)
+		case fieldReplySerial:
+			m.replyTo, ok = value.(uint32)
+		case fieldDestination:
+			m.dest, ok = value.(string)
+		case fieldSender:
+			m.sender, ok = value.(string)
+		case fieldSignature:
+			var s Signature
+			s, ok = value.(Signature)
+			sig = string(s)
+		default:
+			ok = true // unknown fields must be ignored
+		}
+		if !ok {
+			return nil, fmt.Errorf("%w: bad header field %d", ErrProtocol, field[0])
+		}
+	}
+
+	body := &decoder{buf: buf[padded:], order: order}
+	if m.body, err = body.decodeValues(sig); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,147 @@
+package dbus
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestMessage_roundTrip(t *testing.T) {
+
+	body := []interface{}{
+		uint8(7), true, int16(-2), uint16(3), int32(-4), uint32(5), int64(-6), uint64(7), 8.5,
+		"text", ObjectPath("/org/example"), Signature("a{sv}"),
+		Variant{"nested"},
+		[]string{"a", "bc"},
+		[]ObjectPath{"/a"},
+		[]Variant{{uint8(1)}, {2.0}},
+		map[string]Variant{"Temperature": {42.5}, "Pinned": {false}},
+		Struct{uint8(1), "x"},
+	}
+	// decoded arrays, dictionaries, and variants hold generic values
+	expected := []interface{}{
+		uint8(7), true, int16(-2), uint16(3), int32(-4), uint32(5), int64(-6), uint64(7), 8.5,
+		"text", ObjectPath("/org/example"), Signature("a{sv}"),
+		Variant{"nested"},
+		[]interface{}{"a", "bc"},
+		[]interface{}{ObjectPath("/a")},
+		[]interface{}{Variant{uint8(1)}, Variant{2.0}},
+		map[interface{}]interface{}{"Temperature": Variant{42.5}, "Pinned": Variant{false}},
+		Struct{uint8(1), "x"},
+	}
+
+	sent := &message{
+		kind:    typeMethodCall,
+		flags:   flagNoReplyExpected,
+		serial:  9,
+		path:    "/org/example",
+		iface:   "org.example.Iface",
+		member:  "Do",
+		dest:    "org.example",
+		sender:  ":1.2",
+		replyTo: 3,
+		errName: "org.example.Error",
+		body:    body,
+	}
+	data, err := sent.encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	received, err := readMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent.body = expected
+	if diff := deep.Equal(received, sent); diff != nil {
+		t.Fatal(diff)
+	}
+}
+
+func TestMessage_bigEndian(t *testing.T) {
+
+	// a method return with reply serial 1 and a single uint32 of 258 in big-endian
+	data := []byte{
+		'B', typeMethodReturn, 0, 1, 0, 0, 0, 4, 0, 0, 0, 2, 0, 0, 0, 15,
+		fieldReplySerial, 1, 'u', 0, 0, 0, 0, 1,
+		fieldSignature, 1, 'g', 0, 1, 'u', 0,
+		0, // header padding
+		0, 0, 1, 2,
+	}
+	msg, err := readMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &message{kind: typeMethodReturn, serial: 2, replyTo: 1, body: []interface{}{uint32(258)}}
+	if diff := deep.Equal(msg, expected); diff != nil {
+		t.Fatal(diff)
+	}
+}
+
+func TestMessage_errors(t *testing.T) {
+
+	valid, err := (&message{kind: typeSignal, serial: 1, path: "/", member: "X", body: []interface{}{"a"}}).encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name string
+		data func() []byte
+	}{
+		{"bad endianness", func() []byte { d := append([]byte{}, valid...); d[0] = 'x'; return d }},
+		{"bad version", func() []byte { d := append([]byte{}, valid...); d[3] = 2; return d }},
+		{"huge body", func() []byte { d := append([]byte{}, valid...); d[7] = 0x7f; return d }},
+		{"bad signature", func() []byte {
+			d := append([]byte{}, valid...)
+			i := bytes.Index(d, []byte{fieldSignature, 1, 'g', 0, 1, 's'})
+			d[i+5] = 'h'
+			return d
+		}},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := readMessage(bytes.NewReader(tc.data()))
+			if !errors.Is(err, ErrProtocol) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", ErrProtocol, err)
+			}
+		})
+	}
+
+	if _, err := (&message{body: []interface{}{struct{}{}}}).encode(); !errors.Is(err, ErrProtocol) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", ErrProtocol, err)
+	}
+}
+
+func Test_splitType(t *testing.T) {
+
+	testCases := []struct {
+		sig, first, rest string
+		expectedErr      error
+	}{
+		{"sv", "s", "v", nil},
+		{"a{sv}as", "a{sv}", "as", nil},
+		{"(yv)", "(yv)", "", nil},
+		{"aa(s(ii))u", "aa(s(ii))", "u", nil},
+		{"", "", "", ErrProtocol},
+		{"a", "", "", ErrProtocol},
+		{"(ss", "", "", ErrProtocol},
+		{"h", "", "", ErrProtocol},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.sig, func(t *testing.T) {
+			first, rest, err := splitType(tc.sig)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", tc.expectedErr, err)
+			}
+			if first != tc.first || rest != tc.rest {
+				t.Fatalf("unexpected split\nwant: %q, %q\n got: %q, %q", tc.first, tc.rest, first, rest)
+			}
+		})
+	}
+}
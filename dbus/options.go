@@ -0,0 +1,28 @@
+package dbus
+
+import "time"
+
+// Option is used to pass optional parameters to the Dial function
+type Option func(*Conn)
+
+// OptHandler sets the function that answers method calls. If it is nil, every method call
+// other than org.freedesktop.DBus.Peer.Ping is answered with an UnknownObject error
+//
+// (default: nil)
+func OptHandler(handler Handler) Option {
+	return func(c *Conn) {
+		c.handler = handler
+	}
+}
+
+// OptCallTimeout sets how long Call waits for a reply. If d is less than or equal to zero, it
+// is set to the default value
+//
+// (default: 25 seconds)
+func OptCallTimeout(d time.Duration) Option {
+	return func(c *Conn) {
+		if d > 0 {
+			c.callTimeout = d
+		}
+	}
+}
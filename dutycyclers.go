@@ -5,9 +5,33 @@ import "math"
 // compile-time check for interface implementation
 var (
 	_ dutyCycler = (*dutyCyclerLinear)(nil)
-	_ dutyCycler = (*dutyCyclerPowPi)(nil)
+	_ dutyCycler = (*dutyCyclerPow)(nil)
+	_ dutyCycler = (*dutyCyclerSigmoid)(nil)
+	_ dutyCycler = (*dutyCyclerBounded)(nil)
 )
 
+// curveParams are the parameters of the fan response curves that have any
+type curveParams struct {
+	exponent  float64
+	midpoint  float64
+	steepness float64
+}
+
+// newDutyCycler returns the fan response curve of the given type for the given range. Curves
+// whose parameters are invalid fall back to FanResponsePowPi
+func newDutyCycler(meth fanResponse, params curveParams, minTemp, maxTemp float64) dutyCycler {
+	switch {
+	case meth == FanResponseLinear:
+		return newDutyCyclerLinear(minTemp, maxTemp)
+	case meth == FanResponsePow && params.exponent > 0:
+		return newDutyCyclerPow(minTemp, maxTemp, params.exponent)
+	case meth == FanResponseSigmoid && validSigmoid(params.midpoint, params.steepness):
+		return newDutyCyclerSigmoid(minTemp, maxTemp, params.midpoint, params.steepness)
+	default:
+		return newDutyCyclerPowPi(minTemp, maxTemp)
+	}
+}
+
 type dutyCyclerLinear struct {
 	minTemp float64
 	maxTemp float64
@@ -33,21 +57,29 @@ func (dc *dutyCyclerLinear) ratio(temp float64) float64 {
 	return dcRatio
 }
 
-type dutyCyclerPowPi struct {
-	minTemp float64
-	maxTemp float64
-	tRange  float64
+// dutyCyclerPow raises the fraction of the temperature range to a power. The higher the
+// exponent, the longer the fan stays quiet before ramping up steeply near the maximum
+type dutyCyclerPow struct {
+	minTemp  float64
+	maxTemp  float64
+	tRange   float64
+	exponent float64
 }
 
-func newDutyCyclerPowPi(minTemp, maxTemp float64) *dutyCyclerPowPi {
-	return &dutyCyclerPowPi{
-		minTemp: minTemp,
-		maxTemp: maxTemp,
-		tRange:  maxTemp - minTemp,
+func newDutyCyclerPow(minTemp, maxTemp, exponent float64) *dutyCyclerPow {
+	return &dutyCyclerPow{
+		minTemp:  minTemp,
+		maxTemp:  maxTemp,
+		tRange:   maxTemp - minTemp,
+		exponent: exponent,
 	}
 }
 
-func (dc *dutyCyclerPowPi) ratio(temp float64) float64 {
+func newDutyCyclerPowPi(minTemp, maxTemp float64) *dutyCyclerPow {
+	return newDutyCyclerPow(minTemp, maxTemp, math.Pi)
+}
+
+func (dc *dutyCyclerPow) ratio(temp float64) float64 {
 	if temp >= dc.maxTemp {
 		return 1.0
 	}
@@ -55,6 +87,94 @@ func (dc *dutyCyclerPowPi) ratio(temp float64) float64 {
 		return 0.0
 	}
 	fraction := (temp - dc.minTemp) / dc.tRange
-	dcRatio := math.Pow(fraction, math.Pi)
+	dcRatio := math.Pow(fraction, dc.exponent)
 	return dcRatio
 }
+
+// dutyCyclerSigmoid follows a logistic curve that is scaled to reach zero at the minimum and one
+// at the maximum temperature. It stays low through most of the range below the midpoint and
+// ramps up steeply around it, the more so the steeper it is
+type dutyCyclerSigmoid struct {
+	minTemp   float64
+	maxTemp   float64
+	tRange    float64
+	midpoint  float64
+	steepness float64
+	low       float64
+	span      float64
+}
+
+func newDutyCyclerSigmoid(minTemp, maxTemp, midpoint, steepness float64) *dutyCyclerSigmoid {
+	dc := &dutyCyclerSigmoid{
+		minTemp:   minTemp,
+		maxTemp:   maxTemp,
+		tRange:    maxTemp - minTemp,
+		midpoint:  midpoint,
+		steepness: steepness,
+	}
+	dc.low = dc.logistic(0)
+	dc.span = dc.logistic(1) - dc.low
+	return dc
+}
+
+// validSigmoid reports whether the given midpoint is within the range and the steepness is
+// positive
+func validSigmoid(midpoint, steepness float64) bool {
+	return midpoint > 0 && midpoint < 1 && steepness > 0
+}
+
+func (dc *dutyCyclerSigmoid) logistic(fraction float64) float64 {
+	return 1 / (1 + math.Exp(-dc.steepness*(fraction-dc.midpoint)))
+}
+
+func (dc *dutyCyclerSigmoid) ratio(temp float64) float64 {
+	if temp >= dc.maxTemp {
+		return 1.0
+	}
+	if temp <= dc.minTemp {
+		return 0.0
+	}
+	fraction := (temp - dc.minTemp) / dc.tRange
+	dcRatio := (dc.logistic(fraction) - dc.low) / dc.span
+	return math.Max(0, math.Min(1, dcRatio))
+}
+
+// Boundary controls the fan's duty cycle at and beyond one end of the temperature range
+type Boundary struct {
+	// DutyCycle is the ratio applied beyond the boundary, which is clamped to [0,1]
+	DutyCycle float64
+	// Inclusive applies DutyCycle exactly at the boundary too. Otherwise, the fan response
+	// curve determines the duty cycle exactly at the boundary
+	Inclusive bool
+}
+
+// dutyCyclerBounded applies explicit boundaries around the curve it wraps
+type dutyCyclerBounded struct {
+	curve   dutyCycler
+	minTemp float64
+	maxTemp float64
+	lower   Boundary
+	upper   Boundary
+}
+
+func (dc *dutyCyclerBounded) ratio(temp float64) float64 {
+	switch {
+	case temp < dc.minTemp || (temp == dc.minTemp && dc.lower.Inclusive):
+		return dc.lower.DutyCycle
+	case temp > dc.maxTemp || (temp == dc.maxTemp && dc.upper.Inclusive):
+		return dc.upper.DutyCycle
+	}
+	return dc.curve.ratio(temp)
+}
+
+// dutyCyclerFunc derives the duty cycle from an arbitrary function of the temperature. A
+// failed or undefined result runs the fan at full speed
+type dutyCyclerFunc func(temp float64) (float64, error)
+
+func (dc dutyCyclerFunc) ratio(temp float64) float64 {
+	dcRatio, err := dc(temp)
+	if err != nil || math.IsNaN(dcRatio) {
+		return 1.0
+	}
+	return math.Max(0, math.Min(1, dcRatio))
+}
@@ -1,7 +1,10 @@
 package heatsink
 
 import (
+	"math"
 	"testing"
+
+	"github.com/go-test/deep"
 )
 
 func TestDutyCycler_Linear(t *testing.T) {
@@ -64,3 +67,253 @@ func TestDutyCycler_PowPi(t *testing.T) {
 		})
 	}
 }
+
+func TestDutyCycler_Pow(t *testing.T) {
+	t.Parallel()
+
+	dc := newDutyCyclerPow(10, 20, 2)
+	cases := map[string]struct {
+		inTemp          float64
+		expectedDcRatio float64
+	}{
+		"at-min":    {inTemp: 10.0, expectedDcRatio: 0.0},
+		"below-min": {inTemp: 9.00, expectedDcRatio: 0.0},
+		"at-max":    {inTemp: 20.0, expectedDcRatio: 1.0},
+		"above-max": {inTemp: 25.0, expectedDcRatio: 1.0},
+		"mid-point": {inTemp: 15.0, expectedDcRatio: 0.25},
+		"quarter":   {inTemp: 12.5, expectedDcRatio: 0.0625},
+	}
+
+	for name, testCase := range cases {
+		t.Run(name, func(t *testing.T) {
+			actual := dc.ratio(testCase.inTemp)
+			if actual != testCase.expectedDcRatio {
+				t.Fatalf(
+					"actual dcRatio does not match expected\nwant: %.4f\n got: %.4f",
+					testCase.expectedDcRatio, actual,
+				)
+			}
+		})
+	}
+}
+
+func TestNewDutyCycler(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		meth     fanResponse
+		params   curveParams
+		expected dutyCycler
+	}{
+		"linear": {
+			meth: FanResponseLinear, params: curveParams{exponent: 2}, expected: newDutyCyclerLinear(10, 20),
+		},
+		"pow-pi": {
+			meth: FanResponsePowPi, params: curveParams{exponent: 2}, expected: newDutyCyclerPowPi(10, 20),
+		},
+		"pow": {
+			meth: FanResponsePow, params: curveParams{exponent: 2.5}, expected: newDutyCyclerPow(10, 20, 2.5),
+		},
+		"pow-bad-exponent": {
+			meth: FanResponsePow, params: curveParams{}, expected: newDutyCyclerPowPi(10, 20),
+		},
+		"sigmoid": {
+			meth:     FanResponseSigmoid,
+			params:   curveParams{midpoint: 0.7, steepness: 10},
+			expected: newDutyCyclerSigmoid(10, 20, 0.7, 10),
+		},
+		"sigmoid-bad-midpoint": {
+			meth:     FanResponseSigmoid,
+			params:   curveParams{midpoint: 1, steepness: 10},
+			expected: newDutyCyclerPowPi(10, 20),
+		},
+	}
+	for name, testCase := range cases {
+		actual := newDutyCycler(testCase.meth, testCase.params, 10, 20)
+		if diff := deep.Equal(actual, testCase.expected); diff != nil {
+			t.Errorf("%s: %v", name, diff)
+		}
+	}
+}
+
+func TestDutyCycler_Bounded(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		lower, upper    Boundary
+		inTemp          float64
+		expectedDcRatio float64
+	}{
+		"below-min":           {lower: Boundary{DutyCycle: 0.2}, inTemp: 9, expectedDcRatio: 0.2},
+		"at-min-inclusive":    {lower: Boundary{DutyCycle: 0.2, Inclusive: true}, inTemp: 10, expectedDcRatio: 0.2},
+		"at-min-exclusive":    {lower: Boundary{DutyCycle: 0.2}, inTemp: 10, expectedDcRatio: 0},
+		"in-range":            {lower: Boundary{DutyCycle: 0.2}, inTemp: 15, expectedDcRatio: 0.5},
+		"at-max-inclusive":    {upper: Boundary{DutyCycle: 0.8, Inclusive: true}, inTemp: 20, expectedDcRatio: 0.8},
+		"at-max-exclusive":    {upper: Boundary{DutyCycle: 0.8}, inTemp: 20, expectedDcRatio: 1},
+		"above-max":           {upper: Boundary{DutyCycle: 0.8}, inTemp: 21, expectedDcRatio: 0.8},
+		"at-min-zero-default": {inTemp: 10, expectedDcRatio: 0},
+	}
+
+	for name, testCase := range cases {
+		testCase := testCase
+		t.Run(name, func(t *testing.T) {
+			dc := &dutyCyclerBounded{
+				curve:   newDutyCyclerLinear(10, 20),
+				minTemp: 10,
+				maxTemp: 20,
+				lower:   testCase.lower,
+				upper:   testCase.upper,
+			}
+			actual := dc.ratio(testCase.inTemp)
+			if actual != testCase.expectedDcRatio {
+				t.Fatalf(
+					"actual dcRatio does not match expected\nwant: %.2f\n got: %.2f",
+					testCase.expectedDcRatio, actual,
+				)
+			}
+		})
+	}
+}
+
+func TestOptBoundaries(t *testing.T) {
+	orig := deep.CompareUnexportedFields
+	deep.CompareUnexportedFields = true
+	defer func() { deep.CompareUnexportedFields = orig }()
+
+	config := &Config{
+		Fan:            &fakeFanDriver{},
+		Sensors:        []ThermoSensor{&fakeThermoSensor{}},
+		MinTemperature: 10,
+		MaxTemperature: 20,
+	}
+	// the boundaries wrap the fan response curve even if they are given before it
+	hs, err := New(
+		config,
+		OptBoundaries(Boundary{DutyCycle: -1}, Boundary{DutyCycle: 2, Inclusive: true}),
+		OptFanResponse(FanResponseLinear),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &dutyCyclerBounded{
+		curve:   newDutyCyclerLinear(10, 20),
+		minTemp: 10,
+		maxTemp: 20,
+		lower:   Boundary{DutyCycle: 0},
+		upper:   Boundary{DutyCycle: 1, Inclusive: true},
+	}
+	if diff := deep.Equal(hs.dcCalc, dutyCycler(expected)); diff != nil {
+		t.Fatal(diff)
+	}
+}
+
+func TestOptFanResponsePow(t *testing.T) {
+	t.Parallel()
+
+	hs := &Heatsink{}
+	OptFanResponsePow(2.5)(&Config{MinTemperature: 10, MaxTemperature: 20}, hs)
+	if diff := deep.Equal(hs.dcCalc, newDutyCyclerPow(10, 20, 2.5)); diff != nil {
+		t.Error(diff)
+	}
+	if hs.response != FanResponsePow || hs.curve.exponent != 2.5 {
+		t.Errorf("unexpected fan response: %v, %v", hs.response, hs.curve.exponent)
+	}
+}
+
+func TestDutyCycler_Sigmoid(t *testing.T) {
+	t.Parallel()
+
+	dc := newDutyCyclerSigmoid(10, 20, 0.5, 10)
+	cases := map[string]struct {
+		inTemp          float64
+		expectedDcRatio float64
+	}{
+		"at-min":    {inTemp: 10.0, expectedDcRatio: 0.0},
+		"below-min": {inTemp: 9.00, expectedDcRatio: 0.0},
+		"at-max":    {inTemp: 20.0, expectedDcRatio: 1.0},
+		"above-max": {inTemp: 25.0, expectedDcRatio: 1.0},
+		"mid-point": {inTemp: 15.0, expectedDcRatio: 0.5},
+		"quarter":   {inTemp: 12.5, expectedDcRatio: 0.0701},
+	}
+
+	for name, testCase := range cases {
+		t.Run(name, func(t *testing.T) {
+			actual := dc.ratio(testCase.inTemp)
+			if math.Abs(actual-testCase.expectedDcRatio) > 1e-4 {
+				t.Fatalf(
+					"actual dcRatio does not match expected\nwant: %.4f\n got: %.4f",
+					testCase.expectedDcRatio, actual,
+				)
+			}
+		})
+	}
+}
+
+func TestDutyCycler_Sigmoid_quietBelowMidpoint(t *testing.T) {
+	t.Parallel()
+
+	sigmoid := newDutyCyclerSigmoid(40, 80, 0.7, 12)
+	linear := newDutyCyclerLinear(40, 80)
+	for temp := 41.0; temp < 64; temp++ {
+		if s, l := sigmoid.ratio(temp), linear.ratio(temp); s >= l {
+			t.Fatalf("expected sigmoid to be quieter than linear at %v\nsigmoid: %.4f\n linear: %.4f", temp, s, l)
+		}
+	}
+	for prev, temp := 0.0, 40.0; temp <= 80; temp++ {
+		actual := sigmoid.ratio(temp)
+		if actual < prev {
+			t.Fatalf("expected sigmoid to be monotonic, but it fell at %v from %.4f to %.4f", temp, prev, actual)
+		}
+		prev = actual
+	}
+}
+
+func TestOptFanResponseSigmoid(t *testing.T) {
+	t.Parallel()
+
+	hs := &Heatsink{}
+	OptFanResponseSigmoid(0, 10)(&Config{MinTemperature: 10, MaxTemperature: 20}, hs)
+	OptFanResponseSigmoid(0.5, -1)(&Config{MinTemperature: 10, MaxTemperature: 20}, hs)
+	if hs.dcCalc != nil {
+		t.Fatalf("expected invalid sigmoid to be ignored, got: %+v", hs.dcCalc)
+	}
+	OptFanResponseSigmoid(0.7, 10)(&Config{MinTemperature: 10, MaxTemperature: 20}, hs)
+	if diff := deep.Equal(hs.dcCalc, newDutyCyclerSigmoid(10, 20, 0.7, 10)); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestDutyCycler_Func(t *testing.T) {
+	t.Parallel()
+
+	dc := dutyCyclerFunc(func(temp float64) (float64, error) {
+		switch {
+		case temp < 0:
+			return 0, ErrBadOption
+		case temp == 0:
+			return math.NaN(), nil
+		}
+		return (temp - 30) / 40, nil
+	})
+	cases := map[float64]float64{-1: 1, 0: 1, 20: 0, 50: 0.5, 90: 1}
+	for temp, expected := range cases {
+		if actual := dc.ratio(temp); actual != expected {
+			t.Errorf("%v: unexpected duty cycle\nwant: %v\n got: %v", temp, expected, actual)
+		}
+	}
+}
+
+func TestOptFanResponseFunc(t *testing.T) {
+	t.Parallel()
+
+	hs := &Heatsink{}
+	OptFanResponseFunc(nil)(nil, hs)
+	if hs.dcCalc != nil {
+		t.Fatalf("expected a nil curve to be ignored, got: %+v", hs.dcCalc)
+	}
+	OptFanResponseFunc(func(float64) (float64, error) { return 0.25, nil })(nil, hs)
+	if actual := hs.dcCalc.ratio(60); actual != 0.25 {
+		t.Errorf("unexpected duty cycle\nwant: %v\n got: %v", 0.25, actual)
+	}
+}
@@ -1,17 +1,31 @@
 package heatsink
 
-import "errors"
+import (
+	"fmt"
+	"strings"
+)
 
 // Sentinel errors that are wrapped and returned by this package
 var (
 	ErrControllerStopped  error = constErr("thermal controller is stopped")
 	ErrFanDriverClosed    error = constErr("fan driver is closed")
 	ErrThermoSensorClosed error = constErr("thermal sensor is closed")
+	ErrAuxInputClosed     error = constErr("auxiliary input is closed")
+	ErrNoSelfTest         error = constErr("device does not support self-testing")
+	ErrSensorExists       error = constErr("a sensor of the same name is monitored already")
+	ErrUnknownSensor      error = constErr("no sensor of the given name is monitored")
 )
 
-// Sentinel errors that are defined to ease testing
+// Sentinel errors for invalid configurations that are wrapped and returned by New
 var (
-	errNoConfig = errors.New("no configuration given")
+	ErrNoConfig            error = constErr("no configuration given")
+	ErrNoFan               error = constErr("no fan given")
+	ErrNoSensors           error = constErr("no thermal sensors given")
+	ErrNilSensor           error = constErr("a given sensor cannot be nil")
+	ErrBadTemperatureRange error = constErr("maximum temperature must be greater than the minimum")
+	ErrBadOption           error = constErr("invalid option value")
+	ErrNoMembers           error = constErr("no zone members given")
+	ErrNilMember           error = constErr("a given zone member cannot be nil")
 )
 
 type constErr string
@@ -19,3 +33,27 @@ type constErr string
 func (ce constErr) Error() string {
 	return string(ce)
 }
+
+// MultiError is a collection of errors that occurred during a single operation, e.g. reading
+// from all sensors or releasing all resources held by a heatsink. The errors are ordered as
+// they were encountered. It implements Unwrap() []error so that errors.Is and errors.As
+// inspect each of the collected errors on Go 1.20+
+type MultiError []error
+
+// Error returns the message of the only error if there is one. Otherwise, it returns the
+// messages of all errors as an indented list
+func (me MultiError) Error() string {
+	if len(me) == 1 {
+		return me[0].Error()
+	}
+	var sb strings.Builder
+	for _, err := range me {
+		fmt.Fprintf(&sb, "\n  - %s", err)
+	}
+	return sb.String()
+}
+
+// Unwrap returns a copy of the collected errors
+func (me MultiError) Unwrap() []error {
+	return append([]error{}, me...)
+}
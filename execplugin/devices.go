@@ -0,0 +1,137 @@
+package execplugin
+
+import (
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/malkhamis/heatsink"
+)
+
+// compile-time check for interface implementation and dependency inversion
+var (
+	_ heatsink.FanDriver    = (*Fan)(nil)
+	_ heatsink.ThermoSensor = (*Sensor)(nil)
+)
+
+// Fan drives a fan of a plugin. Instances of this type are safe for concurrent use
+type Fan struct {
+	name   string
+	device device
+	plugin *Plugin
+	mutex  sync.Mutex
+	closed bool
+}
+
+// NewFan opens the given fan device of this plugin, starting the plugin if it is not running
+// yet. If name is empty, the fan is named '<plugin>/<device>'
+func (p *Plugin) NewFan(dev, name string) (*Fan, error) {
+
+	if name == "" {
+		name = p.name + "/" + dev
+	}
+	fan := &Fan{name: name, device: device{kind: KindFan, name: dev}, plugin: p}
+	if err := p.open(fan.device); err != nil {
+		return nil, err
+	}
+	return fan, nil
+}
+
+// SetDutyCycle sends the given duty cycle, clamped to [0.0, 1.0], to the plugin. If the fan
+// driver is closed, it returns heatsink.ErrFanDriverClosed
+func (f *Fan) SetDutyCycle(dcRatio float64) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.closed {
+		return heatsink.ErrFanDriverClosed
+	}
+	return f.send(dcRatio)
+}
+
+func (f *Fan) send(dcRatio float64) error {
+	params := DutyCycleParams{Device: f.device.name, DutyCycle: math.Max(0, math.Min(1, dcRatio))}
+	return f.plugin.request("set_duty_cycle", params, nil)
+}
+
+// Close sets the fan to its maximum speed so that the hardware remains cooled once the
+// controller stops, and then closes the device. If the fan driver is already closed, it
+// returns heatsink.ErrFanDriverClosed
+func (f *Fan) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.closed {
+		return heatsink.ErrFanDriverClosed
+	}
+	f.closed = true
+	errMax := f.send(1)
+	errRelease := f.plugin.release(f.device)
+	if errMax != nil {
+		return fmt.Errorf("failed to set fan speed to max while closing driver: %w", errMax)
+	}
+	return errRelease
+}
+
+// Name returns the name of this fan driver
+func (f *Fan) Name() string {
+	return f.name
+}
+
+// Sensor reads a sensor of a plugin. Instances of this type are safe for concurrent use
+type Sensor struct {
+	name   string
+	device device
+	plugin *Plugin
+	mutex  sync.RWMutex
+	closed bool
+}
+
+// NewSensor opens the given sensor device of this plugin, starting the plugin if it is not
+// running yet. If name is empty, the sensor is named '<plugin>/<device>'
+func (p *Plugin) NewSensor(dev, name string) (*Sensor, error) {
+
+	if name == "" {
+		name = p.name + "/" + dev
+	}
+	sensor := &Sensor{name: name, device: device{kind: KindSensor, name: dev}, plugin: p}
+	if err := p.open(sensor.device); err != nil {
+		return nil, err
+	}
+	return sensor, nil
+}
+
+// Temperature asks the plugin for the current temperature in degrees celsius and returns it as
+// well as any error encountered. If the sensor is closed, it returns
+// heatsink.ErrThermoSensorClosed
+func (s *Sensor) Temperature() (float64, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.closed {
+		return math.Inf(1), heatsink.ErrThermoSensorClosed
+	}
+
+	var result TemperatureResult
+	if err := s.plugin.request("temperature", TemperatureParams{Device: s.device.name}, &result); err != nil {
+		return math.Inf(1), err
+	}
+	if result.Temperature == nil {
+		return math.Inf(1), fmt.Errorf("plugin '%s': temperature: %w: no temperature", s.plugin.name, ErrBadResponse)
+	}
+	return *result.Temperature, nil
+}
+
+// Close closes the device of this sensor. If the sensor was previously closed, it returns
+// heatsink.ErrThermoSensorClosed
+func (s *Sensor) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return heatsink.ErrThermoSensorClosed
+	}
+	s.closed = true
+	return s.plugin.release(s.device)
+}
+
+// Name returns the name of this sensor
+func (s *Sensor) Name() string {
+	return s.name
+}
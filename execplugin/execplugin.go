@@ -0,0 +1,390 @@
+// Package execplugin provides implementations of the heatsink.FanDriver and
+// heatsink.ThermoSensor interfaces that are backed by a plugin, i.e. a program of a third
+// party, which lets the daemon drive fans and read sensors it has no support for without
+// modifying it.
+//
+// A plugin is a long-running process that speaks JSON-RPC 2.0 over its standard input and
+// output, one request or response per line. The daemon sends these requests, where device is
+// the name of a fan or sensor as understood by the plugin:
+//
+//	{"jsonrpc": "2.0", "id": 1, "method": "open", "params": {"kind": "fan", "device": "fan0"}}
+//	{"jsonrpc": "2.0", "id": 2, "method": "set_duty_cycle", "params": {"device": "fan0", "duty_cycle": 0.5}}
+//	{"jsonrpc": "2.0", "id": 3, "method": "temperature", "params": {"device": "cpu"}}
+//	{"jsonrpc": "2.0", "id": 4, "method": "close", "params": {"kind": "fan", "device": "fan0"}}
+//
+// Every request must be answered before the next one is sent, either with a result, which is
+// '{"temperature": <celsius>}' for 'temperature' and ignored otherwise, or with an error:
+//
+//	{"jsonrpc": "2.0", "id": 3, "result": {"temperature": 45.5}}
+//	{"jsonrpc": "2.0", "id": 3, "error": {"code": 1, "message": "no such device"}}
+//
+// A device is opened once before it is used and closed once it is no longer used by any fan
+// or sensor. The process is started when the first device is opened and its standard input is
+// closed, which should make it exit, once the last device is closed. A plugin that does not
+// answer in time or exits is killed and started again on the next request, after which the
+// devices in use are opened again. Anything the plugin writes to its standard error is passed
+// on as is, e.g. to be logged
+package execplugin
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Sentinel errors that are wrapped and returned by this package
+var (
+	ErrNoCommand   = errors.New("plugin must have a command")
+	ErrBadTimeout  = errors.New("timeout must be positive")
+	ErrTimeout     = errors.New("plugin did not answer in time")
+	ErrExited      = errors.New("plugin exited")
+	ErrBadResponse = errors.New("invalid response of plugin")
+	ErrPlugin      = errors.New("plugin returned an error")
+)
+
+// Kinds of devices that are opened and closed
+const (
+	KindFan    = "fan"
+	KindSensor = "sensor"
+)
+
+// maxLineSize caps the size of a response, which guards against plugins that write something
+// other than small json documents
+const maxLineSize = 1 << 16
+
+// Request is a request that is sent to a plugin
+type Request struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      uint64      `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+// Response is the answer of a plugin to a request. Either Result or Error is set
+type Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      uint64          `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Error is the error a plugin answers with if it failed to handle a request
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// DeviceParams are the parameters of the 'open' and 'close' methods
+type DeviceParams struct {
+	Kind   string `json:"kind"`
+	Device string `json:"device"`
+}
+
+// TemperatureParams are the parameters of the 'temperature' method
+type TemperatureParams struct {
+	Device string `json:"device"`
+}
+
+// TemperatureResult is the result of the 'temperature' method
+type TemperatureResult struct {
+	Temperature *float64 `json:"temperature"`
+}
+
+// DutyCycleParams are the parameters of the 'set_duty_cycle' method, where the duty cycle is
+// in [0.0, 1.0]
+type DutyCycleParams struct {
+	Device    string  `json:"device"`
+	DutyCycle float64 `json:"duty_cycle"`
+}
+
+// device identifies an open device of a plugin
+type device struct {
+	kind string
+	name string
+}
+
+// Plugin is a plugin program that provides fans and sensors. Instances of this type are safe
+// for concurrent use, but requests are sent one at a time
+type Plugin struct {
+	name    string
+	command []string
+	env     []string
+	timeout time.Duration
+	stderr  io.Writer
+	mutex   sync.Mutex
+	proc    *process
+	devices map[device]int
+	lastID  uint64
+}
+
+// New returns a plugin that runs the given command, which is not started until a fan or sensor
+// is created. For details about options and defaults, see the documentation for type 'Option'
+func New(name string, command []string, options ...Option) (*Plugin, error) {
+
+	if len(command) == 0 {
+		return nil, fmt.Errorf("'%s': %w", name, ErrNoCommand)
+	}
+	p := &Plugin{ // defaults
+		name:    name,
+		command: append([]string{}, command...),
+		timeout: 2 * time.Second,
+		devices: make(map[device]int),
+	}
+	for _, applyOption := range options {
+		if applyOption == nil {
+			continue
+		}
+		applyOption(p)
+	}
+	if p.timeout <= 0 {
+		return nil, fmt.Errorf("%w: %v", ErrBadTimeout, p.timeout)
+	}
+	return p, nil
+}
+
+// Name returns the name of this plugin
+func (p *Plugin) Name() string {
+	return p.name
+}
+
+// open opens the given device unless it is already in use
+func (p *Plugin) open(dev device) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.devices[dev] > 0 {
+		p.devices[dev]++
+		return nil
+	}
+	err := p.call("open", DeviceParams{Kind: dev.kind, Device: dev.name}, nil)
+	if err != nil {
+		if len(p.devices) == 0 {
+			p.stop()
+		}
+		return err
+	}
+	p.devices[dev] = 1
+	return nil
+}
+
+// release closes the given device once it is no longer in use, and stops the plugin once no
+// device is
+func (p *Plugin) release(dev device) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.devices[dev] > 1 {
+		p.devices[dev]--
+		return nil
+	}
+	delete(p.devices, dev)
+	var err error
+	if p.proc != nil {
+		err = p.call("close", DeviceParams{Kind: dev.kind, Device: dev.name}, nil)
+	}
+	if len(p.devices) == 0 {
+		p.stop()
+	}
+	return err
+}
+
+// request sends a request about an open device and decodes its result into the given value
+func (p *Plugin) request(method string, params, result interface{}) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.call(method, params, result)
+}
+
+// call sends a request, starting the plugin if it is not running, and decodes its result into
+// the given value unless it is nil. A plugin that fails to answer is killed. The caller must
+// hold the mutex
+func (p *Plugin) call(method string, params, result interface{}) error {
+
+	if p.proc == nil {
+		if err := p.start(); err != nil {
+			return err
+		}
+	}
+	resp, err := p.roundTrip(method, params)
+	if err != nil {
+		p.proc.kill()
+		p.proc = nil
+		return fmt.Errorf("plugin '%s': %s: %w", p.name, method, err)
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("plugin '%s': %s: %w: %s (code %d)", p.name, method, ErrPlugin, resp.Error.Message, resp.Error.Code)
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(resp.Result, result); err != nil {
+		return fmt.Errorf("plugin '%s': %s: %w: %v", p.name, method, ErrBadResponse, err)
+	}
+	return nil
+}
+
+// roundTrip sends a request to the running plugin and waits for the response to it
+func (p *Plugin) roundTrip(method string, params interface{}) (Response, error) {
+
+	p.lastID++
+	line, err := json.Marshal(Request{JSONRPC: "2.0", ID: p.lastID, Method: method, Params: params})
+	if err != nil {
+		return Response{}, err
+	}
+	if _, err := p.proc.stdin.Write(append(line, '\n')); err != nil {
+		return Response{}, fmt.Errorf("%w: %v", ErrExited, err)
+	}
+
+	timer := time.NewTimer(p.timeout)
+	defer timer.Stop()
+	select {
+	case line, ok := <-p.proc.lines:
+		if !ok {
+			return Response{}, fmt.Errorf("%w: %v", ErrExited, p.proc.readErr)
+		}
+		var resp Response
+		if err := json.Unmarshal(line, &resp); err != nil {
+			return Response{}, fmt.Errorf("%w: %v", ErrBadResponse, err)
+		}
+		if resp.ID != p.lastID {
+			return Response{}, fmt.Errorf("%w: id %d instead of %d", ErrBadResponse, resp.ID, p.lastID)
+		}
+		return resp, nil
+	case <-timer.C:
+		return Response{}, fmt.Errorf("%w: %v", ErrTimeout, p.timeout)
+	}
+}
+
+// start starts the plugin and opens the devices in use again. The caller must hold the mutex
+func (p *Plugin) start() error {
+
+	proc, err := startProcess(p.command, p.env, p.stderr)
+	if err != nil {
+		return fmt.Errorf("plugin '%s': %w", p.name, err)
+	}
+	p.proc = proc
+	for dev := range p.devices {
+		if err := p.call("open", DeviceParams{Kind: dev.kind, Device: dev.name}, nil); err != nil {
+			if p.proc != nil {
+				p.proc.kill()
+				p.proc = nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// stop asks the plugin to exit by closing its standard input and kills it unless it exits
+// within the timeout. The caller must hold the mutex
+func (p *Plugin) stop() {
+	if p.proc == nil {
+		return
+	}
+	p.proc.stop(p.timeout)
+	p.proc = nil
+}
+
+// process is a running plugin
+type process struct {
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	stdout  *os.File
+	lines   chan []byte
+	readErr error
+	exited  chan struct{}
+	// abandoned is closed once no more lines are read from the process
+	abandoned chan struct{}
+}
+
+// startProcess runs the given command and reads the lines it writes to its standard output
+func startProcess(command, env []string, stderr io.Writer) (*process, error) {
+
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Env = env // an empty environment rather than that of the daemon
+	cmd.Stderr = stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	// the plugin writes to a pipe of its own rather than one that exec drains, which would
+	// outlive the plugin as long as a child of it holds it open
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdout = w
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		r.Close()
+		return nil, fmt.Errorf("running '%s': %w", command[0], err)
+	}
+
+	proc := &process{
+		cmd:       cmd,
+		stdin:     stdin,
+		stdout:    r,
+		lines:     make(chan []byte),
+		exited:    make(chan struct{}),
+		abandoned: make(chan struct{}),
+	}
+	go func() {
+		defer close(proc.lines)
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 4096), maxLineSize)
+		for scanner.Scan() {
+			line := append([]byte{}, scanner.Bytes()...)
+			select {
+			case proc.lines <- line:
+			case <-proc.abandoned:
+				return
+			}
+		}
+		proc.readErr = scanner.Err()
+		if proc.readErr == nil {
+			proc.readErr = io.EOF
+		}
+	}()
+	go func() {
+		_ = cmd.Wait()
+		close(proc.exited)
+	}()
+	return proc, nil
+}
+
+// stop closes the standard input of the process and kills it unless it exits within the
+// given grace period
+func (proc *process) stop(grace time.Duration) {
+	close(proc.abandoned)
+	proc.stdin.Close()
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	select {
+	case <-proc.exited:
+		proc.stdout.Close()
+	case <-timer.C:
+		proc.terminate()
+	}
+}
+
+// kill kills the process and waits for it to exit
+func (proc *process) kill() {
+	close(proc.abandoned)
+	proc.terminate()
+}
+
+// terminate kills the process, whether or not its lines are still read, and waits for it to
+// exit
+func (proc *process) terminate() {
+	_ = proc.cmd.Process.Kill()
+	<-proc.exited
+	// unblocks reading in case a child of the plugin holds the pipe open
+	proc.stdout.Close()
+}
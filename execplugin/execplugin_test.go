@@ -0,0 +1,232 @@
+package execplugin
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/malkhamis/heatsink"
+)
+
+// TestMain runs the test binary as a fake plugin if asked to by the environment
+func TestMain(m *testing.M) {
+	if os.Getenv("FAKE_PLUGIN") != "" {
+		fakePlugin()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// fakePlugin answers requests like a plugin would and logs them to the file named by
+// FAKE_PLUGIN_LOG. Sensors read 42.5, except for 'hang', which never answers, and 'crash',
+// which makes the plugin exit. Opening 'missing' fails
+func fakePlugin() {
+
+	log, err := os.OpenFile(os.Getenv("FAKE_PLUGIN_LOG"), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		os.Exit(1)
+	}
+	defer log.Close()
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var req struct {
+			ID     uint64
+			Method string
+			Params struct {
+				Device    string
+				DutyCycle *float64 `json:"duty_cycle"`
+			}
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			os.Exit(2)
+		}
+		entry := req.Method + " " + req.Params.Device
+		if req.Params.DutyCycle != nil {
+			entry += fmt.Sprintf(" %v", *req.Params.DutyCycle)
+		}
+		fmt.Fprintln(log, entry)
+
+		resp := Response{JSONRPC: "2.0", ID: req.ID, Result: json.RawMessage(`{}`)}
+		switch {
+		case req.Method == "open" && req.Params.Device == "missing":
+			resp = Response{JSONRPC: "2.0", ID: req.ID, Error: &Error{Code: 1, Message: "no such device"}}
+		case req.Method == "temperature" && req.Params.Device == "hang":
+			time.Sleep(time.Hour)
+		case req.Method == "temperature" && req.Params.Device == "crash":
+			os.Exit(3)
+		case req.Method == "temperature":
+			resp.Result = json.RawMessage(`{"temperature": 42.5}`)
+		}
+		line, _ := json.Marshal(resp)
+		fmt.Println(string(line))
+	}
+}
+
+// newFakePlugin returns a plugin that runs the fake plugin, and a function that returns the
+// requests it received so far
+func newFakePlugin(t *testing.T) (*Plugin, func() []string) {
+	t.Helper()
+
+	logFile := filepath.Join(t.TempDir(), "requests.log")
+	if err := ioutil.WriteFile(logFile, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	plugin, err := New(
+		"fake",
+		[]string{os.Args[0]},
+		OptEnv([]string{"FAKE_PLUGIN=1", "FAKE_PLUGIN_LOG=" + logFile}),
+		OptTimeout(time.Second),
+		OptStderr(os.Stderr),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests := func() []string {
+		data, err := ioutil.ReadFile(logFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Fields(strings.ReplaceAll(string(data), " ", "_"))
+	}
+	return plugin, requests
+}
+
+func TestNew_errors(t *testing.T) {
+
+	cases := map[string]struct {
+		command     []string
+		options     []Option
+		expectedErr error
+	}{
+		"no-command": {expectedErr: ErrNoCommand},
+		"timeout":    {command: []string{"plugin"}, options: []Option{OptTimeout(0)}, expectedErr: ErrBadTimeout},
+		"valid":      {command: []string{"plugin"}, options: []Option{nil}},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			_, err := New("fake", c.command, c.options...)
+			if !errors.Is(err, c.expectedErr) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", c.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestPlugin_lifeCycle(t *testing.T) {
+
+	plugin, requests := newFakePlugin(t)
+	fan, err := plugin.NewFan("fan0", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fan.Name() != "fake/fan0" {
+		t.Fatalf("unexpected name\nwant: fake/fan0\n got: %s", fan.Name())
+	}
+	sensor, err := plugin.NewSensor("cpu", "cpu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a device in use by more than one owner is opened once
+	other, err := plugin.NewSensor("cpu", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	temp, err := sensor.Temperature()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if temp != 42.5 {
+		t.Fatalf("unexpected temperature\nwant: 42.5\n got: %v", temp)
+	}
+	if err := fan.SetDutyCycle(1.5); err != nil {
+		t.Fatal(err)
+	}
+	if err := sensor.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := fan.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"open_fan0", "open_cpu", "temperature_cpu", "set_duty_cycle_fan0_1",
+		"close_cpu", "set_duty_cycle_fan0_1", "close_fan0",
+	}
+	if diff := deep.Equal(requests(), expected); diff != nil {
+		t.Fatal(diff)
+	}
+	if plugin.proc != nil {
+		t.Fatal("expected the plugin to be stopped once no device is in use")
+	}
+	if err := fan.SetDutyCycle(0.5); !errors.Is(err, heatsink.ErrFanDriverClosed) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", heatsink.ErrFanDriverClosed, err)
+	}
+	if _, err := sensor.Temperature(); !errors.Is(err, heatsink.ErrThermoSensorClosed) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", heatsink.ErrThermoSensorClosed, err)
+	}
+}
+
+func TestPlugin_errors(t *testing.T) {
+
+	plugin, requests := newFakePlugin(t)
+	if _, err := plugin.NewSensor("missing", ""); !errors.Is(err, ErrPlugin) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", ErrPlugin, err)
+	}
+	if plugin.proc != nil {
+		t.Fatal("expected the plugin to be stopped if no device could be opened")
+	}
+
+	fan, err := plugin.NewFan("fan0", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fan.Close()
+	hang, err := plugin.NewSensor("hang", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hang.Close()
+	crash, err := plugin.NewSensor("crash", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer crash.Close()
+
+	start := time.Now()
+	if _, err := hang.Temperature(); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", ErrTimeout, err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Fatalf("expected the plugin to be killed, took: %v", elapsed)
+	}
+	if _, err := crash.Temperature(); !errors.Is(err, ErrExited) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", ErrExited, err)
+	}
+
+	// the plugin is started again and the devices in use are opened again
+	if err := fan.SetDutyCycle(0.25); err != nil {
+		t.Fatal(err)
+	}
+	got := requests()
+	got = got[len(got)-4:]
+	sort.Strings(got[:3]) // in no particular order
+	expected := []string{"open_crash", "open_fan0", "open_hang", "set_duty_cycle_fan0_0.25"}
+	if diff := deep.Equal(got, expected); diff != nil {
+		t.Fatal(diff)
+	}
+}
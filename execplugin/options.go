@@ -0,0 +1,39 @@
+package execplugin
+
+import (
+	"io"
+	"time"
+)
+
+// Option is used to pass optional parameters to the plugin's factory function
+type Option func(*Plugin)
+
+// OptEnv sets the environment variables of the plugin, e.g. 'HUB_ADDR=10.0.0.5', as
+// 'key=value' pairs. The plugin does not inherit the environment of the daemon
+//
+// (default: none)
+func OptEnv(env []string) Option {
+	return func(p *Plugin) {
+		p.env = append([]string{}, env...)
+	}
+}
+
+// OptTimeout sets how long the plugin may take to answer a request before it is killed, which
+// is also how long it may take to exit once it is no longer used
+//
+// (default: 2s)
+func OptTimeout(timeout time.Duration) Option {
+	return func(p *Plugin) {
+		p.timeout = timeout
+	}
+}
+
+// OptStderr sets where the standard error of the plugin is written to. If w is nil, it is
+// discarded
+//
+// (default: discarded)
+func OptStderr(w io.Writer) Option {
+	return func(p *Plugin) {
+		p.stderr = w
+	}
+}
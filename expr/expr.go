@@ -0,0 +1,187 @@
+// Package expr provides a small arithmetic expression engine that is used to evaluate
+// user-defined expressions over named variables, e.g. "cpu_package - ambient"
+package expr
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Sentinel errors that are wrapped and returned by this package
+var (
+	ErrSyntax       = errors.New("syntax error")
+	ErrUnknownVar   = errors.New("unknown variable")
+	ErrDivideByZero = errors.New("division by zero")
+	ErrUnknownFunc  = errors.New("unknown function")
+)
+
+// Expr is a compiled expression that can be evaluated multiple times. Instances of this type
+// are immutable and safe for concurrent use
+type Expr struct {
+	src  string
+	root node
+	vars []string
+}
+
+// Parse compiles the given expression. The supported grammar consists of decimal numbers,
+// variables (letters, digits, and underscores not starting with a digit), the binary
+// operators '+', '-', '*', '/', '^' for powers, the unary '-', parentheses, and calls to the
+// following functions:
+//
+//	max(a, b, ...): the greatest argument
+//	min(a, b, ...): the least argument
+//	avg(a, b, ...): the mean of the arguments
+//	weighted(a, wa, b, wb, ...): the mean of the values a, b, ... weighted by wa, wb, ...
+//	clamp(x, lo, hi): x limited to the range [lo, hi]
+func Parse(src string) (*Expr, error) {
+	p := &parser{lex: newLexer(src)}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	root, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %s", p.tok)
+	}
+
+	seen := make(map[string]bool)
+	root.walk(func(n node) {
+		if v, ok := n.(varNode); ok {
+			seen[string(v)] = true
+		}
+	})
+	vars := make([]string, 0, len(seen))
+	for v := range seen {
+		vars = append(vars, v)
+	}
+	sort.Strings(vars)
+
+	return &Expr{src: src, root: root, vars: vars}, nil
+}
+
+// Eval evaluates the expression using the given variable values. It returns ErrUnknownVar if
+// the expression references a variable that is not in vars
+func (e *Expr) Eval(vars map[string]float64) (float64, error) {
+	return e.root.eval(vars)
+}
+
+// Vars returns the sorted names of the variables referenced by the expression
+func (e *Expr) Vars() []string {
+	return append([]string{}, e.vars...)
+}
+
+// String returns the source of the expression
+func (e *Expr) String() string {
+	return e.src
+}
+
+type node interface {
+	eval(vars map[string]float64) (float64, error)
+	walk(visit func(node))
+}
+
+type numNode float64
+
+func (n numNode) eval(map[string]float64) (float64, error) {
+	return float64(n), nil
+}
+
+func (n numNode) walk(visit func(node)) {
+	visit(n)
+}
+
+type varNode string
+
+func (n varNode) eval(vars map[string]float64) (float64, error) {
+	val, ok := vars[string(n)]
+	if !ok {
+		return 0, fmt.Errorf("%w: '%s'", ErrUnknownVar, string(n))
+	}
+	return val, nil
+}
+
+func (n varNode) walk(visit func(node)) {
+	visit(n)
+}
+
+type negNode struct {
+	operand node
+}
+
+func (n negNode) eval(vars map[string]float64) (float64, error) {
+	val, err := n.operand.eval(vars)
+	return -val, err
+}
+
+func (n negNode) walk(visit func(node)) {
+	visit(n)
+	n.operand.walk(visit)
+}
+
+type binNode struct {
+	op          byte
+	left, right node
+}
+
+func (n binNode) eval(vars map[string]float64) (float64, error) {
+	left, err := n.left.eval(vars)
+	if err != nil {
+		return 0, err
+	}
+	right, err := n.right.eval(vars)
+	if err != nil {
+		return 0, err
+	}
+	switch n.op {
+	case '+':
+		return left + right, nil
+	case '-':
+		return left - right, nil
+	case '*':
+		return left * right, nil
+	case '/':
+		if right == 0 {
+			return 0, ErrDivideByZero
+		}
+		return left / right, nil
+	case '^':
+		return math.Pow(left, right), nil
+	default:
+		panic(fmt.Sprintf("unknown binary operator '%c'", n.op))
+	}
+}
+
+func (n binNode) walk(visit func(node)) {
+	visit(n)
+	n.left.walk(visit)
+	n.right.walk(visit)
+}
+
+type callNode struct {
+	name string
+	fn   function
+	args []node
+}
+
+func (n callNode) eval(vars map[string]float64) (float64, error) {
+	vals := make([]float64, len(n.args))
+	for i, arg := range n.args {
+		val, err := arg.eval(vars)
+		if err != nil {
+			return 0, err
+		}
+		vals[i] = val
+	}
+	return n.fn.eval(vals)
+}
+
+func (n callNode) walk(visit func(node)) {
+	visit(n)
+	for _, arg := range n.args {
+		arg.walk(visit)
+	}
+}
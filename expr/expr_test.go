@@ -0,0 +1,112 @@
+package expr
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestExpr_Eval(t *testing.T) {
+	t.Parallel()
+
+	vars := map[string]float64{"cpu_package": 60, "ambient": 25, "x1": 2}
+	cases := map[string]struct {
+		inSrc    string
+		expected float64
+	}{
+		"number":       {inSrc: "42.5", expected: 42.5},
+		"variable":     {inSrc: "ambient", expected: 25},
+		"delta":        {inSrc: "cpu_package - ambient", expected: 35},
+		"precedence":   {inSrc: "1 + 2 * 3", expected: 7},
+		"parentheses":  {inSrc: "(1 + 2) * 3", expected: 9},
+		"left-assoc":   {inSrc: "10 - 4 - 3", expected: 3},
+		"division":     {inSrc: "ambient / 5", expected: 5},
+		"unary-minus":  {inSrc: "-x1 * -3", expected: 6},
+		"nested-unary": {inSrc: "--x1", expected: 2},
+		"whitespace":   {inSrc: "  x1*x1  ", expected: 4},
+		"max":          {inSrc: "max(cpu_package, ambient, x1)", expected: 60},
+		"min":          {inSrc: "min(cpu_package, ambient, x1)", expected: 2},
+		"avg":          {inSrc: "avg(cpu_package, ambient)", expected: 42.5},
+		"weighted":     {inSrc: "weighted(cpu_package, 3, ambient, 1)", expected: 51.25},
+		"single-arg":   {inSrc: "max(x1)", expected: 2},
+		"nested-call":  {inSrc: "max(cpu_package - ambient, avg(x1, 2 * x1)) + 1", expected: 36},
+		"clamp-low":    {inSrc: "clamp(x1 - 5, 0, 1)", expected: 0},
+		"clamp-high":   {inSrc: "clamp(x1, 0, 1)", expected: 1},
+		"clamp-within": {inSrc: "clamp(x1 / 4, 0, 1)", expected: 0.5},
+		"power":        {inSrc: "x1^3", expected: 8},
+		"power-neg":    {inSrc: "-x1^2", expected: -4},
+		"power-right":  {inSrc: "2^3^2", expected: 512},
+		"power-unary":  {inSrc: "4^-x1", expected: 0.0625},
+		"curve":        {inSrc: "clamp((cpu_package-30)/40, 0, 1)^2", expected: 0.5625},
+	}
+
+	for name, testCase := range cases {
+		testCase := testCase
+		t.Run(name, func(t *testing.T) {
+			e, err := Parse(testCase.inSrc)
+			if err != nil {
+				t.Fatalf("expected no error parsing %q, got: %v", testCase.inSrc, err)
+			}
+			actual, err := e.Eval(vars)
+			if err != nil {
+				t.Fatalf("expected no error evaluating %q, got: %v", testCase.inSrc, err)
+			}
+			if actual != testCase.expected {
+				t.Fatalf("unexpected result\nwant: %v\n got: %v", testCase.expected, actual)
+			}
+		})
+	}
+}
+
+func TestParse_errSyntax(t *testing.T) {
+	t.Parallel()
+
+	for _, src := range []string{"", "1 +", "(1 + 2", "1 2", "a $ b", "1..2", ")", "*3", "max()", "max(1 2)", "max(1,", "weighted(x, 1, y)", "clamp(x, 0)", "clamp(x, 0, 1, 2, 3, 4)", "x^"} {
+		if _, err := Parse(src); !errors.Is(err, ErrSyntax) {
+			t.Errorf("%q: unexpected error\nwant: %v\n got: %v", src, ErrSyntax, err)
+		}
+	}
+}
+
+func TestExpr_Eval_errors(t *testing.T) {
+	t.Parallel()
+
+	e, err := Parse("a / b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Eval(map[string]float64{"a": 1}); !errors.Is(err, ErrUnknownVar) {
+		t.Errorf("unexpected error\nwant: %v\n got: %v", ErrUnknownVar, err)
+	}
+	if _, err := e.Eval(map[string]float64{"a": 1, "b": 0}); !errors.Is(err, ErrDivideByZero) {
+		t.Errorf("unexpected error\nwant: %v\n got: %v", ErrDivideByZero, err)
+	}
+
+	e, err = Parse("weighted(a, b, a, b)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Eval(map[string]float64{"a": 1, "b": 0}); !errors.Is(err, ErrDivideByZero) {
+		t.Errorf("unexpected error\nwant: %v\n got: %v", ErrDivideByZero, err)
+	}
+	if _, err := Parse("median(a, b)"); !errors.Is(err, ErrUnknownFunc) {
+		t.Errorf("unexpected error\nwant: %v\n got: %v", ErrUnknownFunc, err)
+	}
+}
+
+func TestExpr_Vars(t *testing.T) {
+	t.Parallel()
+
+	src := "(max(cpu, gpu) - ambient) * cpu / 2"
+	e, err := Parse(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal([]string{"ambient", "cpu", "gpu"}, e.Vars()); diff != nil {
+		t.Error("actual variables do not match expected\n", diff)
+	}
+	if e.String() != src {
+		t.Errorf("unexpected expression string\nwant: %q\n got: %q", src, e.String())
+	}
+}
@@ -0,0 +1,53 @@
+package expr
+
+import (
+	"math"
+)
+
+// function is a function that expressions may call with at least one argument
+type function struct {
+	// argMultiple is what the number of arguments must be a multiple of, e.g. 2 for pairs
+	argMultiple int
+	// maxArgs is the most arguments the function takes, or zero if there is no limit
+	maxArgs int
+	eval    func(args []float64) (float64, error)
+}
+
+// funcs are the functions that expressions may call, by name
+var funcs = map[string]function{
+	"max": {argMultiple: 1, eval: func(args []float64) (float64, error) {
+		max := math.Inf(-1)
+		for _, a := range args {
+			max = math.Max(max, a)
+		}
+		return max, nil
+	}},
+	"min": {argMultiple: 1, eval: func(args []float64) (float64, error) {
+		min := math.Inf(1)
+		for _, a := range args {
+			min = math.Min(min, a)
+		}
+		return min, nil
+	}},
+	"avg": {argMultiple: 1, eval: func(args []float64) (float64, error) {
+		sum := 0.0
+		for _, a := range args {
+			sum += a
+		}
+		return sum / float64(len(args)), nil
+	}},
+	"weighted": {argMultiple: 2, eval: func(args []float64) (float64, error) {
+		sum, weights := 0.0, 0.0
+		for i := 0; i < len(args); i += 2 {
+			sum += args[i] * args[i+1]
+			weights += args[i+1]
+		}
+		if weights == 0 {
+			return 0, ErrDivideByZero
+		}
+		return sum / weights, nil
+	}},
+	"clamp": {argMultiple: 3, maxArgs: 3, eval: func(args []float64) (float64, error) {
+		return math.Max(args[1], math.Min(args[2], args[0])), nil
+	}},
+}
@@ -0,0 +1,243 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"unicode"
+)
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokNum
+	tokIdent
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type token struct {
+	kind tokKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of expression"
+	}
+	return fmt.Sprintf("'%s'", t.text)
+}
+
+type lexer struct {
+	src []rune
+	pos int
+}
+
+func newLexer(src string) *lexer {
+	return &lexer{src: []rune(src)}
+}
+
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.src) && unicode.IsSpace(l.src[l.pos]) {
+		l.pos++
+	}
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, pos: l.pos}, nil
+	}
+
+	start, r := l.pos, l.src[l.pos]
+	switch {
+	case r == '(':
+		l.pos++
+		return token{kind: tokLParen, text: "(", pos: start}, nil
+	case r == ')':
+		l.pos++
+		return token{kind: tokRParen, text: ")", pos: start}, nil
+	case r == ',':
+		l.pos++
+		return token{kind: tokComma, text: ",", pos: start}, nil
+	case r == '+' || r == '-' || r == '*' || r == '/' || r == '^':
+		l.pos++
+		return token{kind: tokOp, text: string(r), pos: start}, nil
+	case unicode.IsDigit(r) || r == '.':
+		for l.pos < len(l.src) && (unicode.IsDigit(l.src[l.pos]) || l.src[l.pos] == '.') {
+			l.pos++
+		}
+		return token{kind: tokNum, text: string(l.src[start:l.pos]), pos: start}, nil
+	case r == '_' || unicode.IsLetter(r):
+		for l.pos < len(l.src) && isIdentRune(l.src[l.pos]) {
+			l.pos++
+		}
+		return token{kind: tokIdent, text: string(l.src[start:l.pos]), pos: start}, nil
+	default:
+		return token{}, fmt.Errorf("%w: unexpected character '%c' at position %d", ErrSyntax, r, start)
+	}
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// parser is a recursive descent parser for the following grammar:
+//
+//	expr   = term { ("+" | "-") term }
+//	term   = unary { ("*" | "/") unary }
+//	unary  = "-" unary | power
+//	power  = primary [ "^" unary ]
+//	primary = number | ident | call | "(" expr ")"
+//	call   = ident "(" expr { "," expr } ")"
+type parser struct {
+	lex *lexer
+	tok token
+}
+
+func (p *parser) next() (err error) {
+	p.tok, err = p.lex.next()
+	return err
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	return fmt.Errorf("%w: %s at position %d", ErrSyntax, msg, p.tok.pos)
+}
+
+func (p *parser) parseExpr() (node, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == tokOp && (p.tok.text == "+" || p.tok.text == "-") {
+		op := p.tok.text[0]
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = binNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseTerm() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == tokOp && (p.tok.text == "*" || p.tok.text == "/") {
+		op := p.tok.text[0]
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = binNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.tok.kind == tokOp && p.tok.text == "-" {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return negNode{operand: operand}, nil
+	}
+	return p.parsePower()
+}
+
+// parsePower parses a power, which is right-associative and binds tighter than the unary '-',
+// i.e. -2^2 is -4 and 2^3^2 is 2^9
+func (p *parser) parsePower() (node, error) {
+	base, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokOp || p.tok.text != "^" {
+		return base, nil
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	exponent, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return binNode{op: '^', left: base, right: exponent}, nil
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokNum:
+		val, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %s", tok)
+		}
+		return numNode(val), p.next()
+	case tokIdent:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if p.tok.kind == tokLParen {
+			return p.parseCall(tok)
+		}
+		return varNode(tok.text), nil
+	case tokLParen:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		inner, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokRParen {
+			return nil, p.errorf("expected ')' but found %s", p.tok)
+		}
+		return inner, p.next()
+	default:
+		return nil, p.errorf("unexpected %s", tok)
+	}
+}
+
+// parseCall parses the arguments of a call to the function named by the given token, whose
+// opening parenthesis is the current token
+func (p *parser) parseCall(name token) (node, error) {
+	fn, ok := funcs[name.text]
+	if !ok {
+		return nil, fmt.Errorf("%w: '%s' at position %d", ErrUnknownFunc, name.text, name.pos)
+	}
+	var args []node
+	for {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if p.tok.kind == tokRParen {
+			break
+		}
+		if p.tok.kind != tokComma {
+			return nil, p.errorf("expected ',' or ')' but found %s", p.tok)
+		}
+	}
+	if n := len(args); n%fn.argMultiple != 0 || (fn.maxArgs > 0 && n > fn.maxArgs) {
+		return nil, fmt.Errorf(
+			"%w: '%s' at position %d does not take %d arguments", ErrSyntax, name.text, name.pos, n,
+		)
+	}
+	return callNode{name: name.text, fn: fn, args: args}, p.next()
+}
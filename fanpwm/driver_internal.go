@@ -3,7 +3,12 @@ package fanpwm
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/malkhamis/heatsink"
 )
 
 type wrOnlyFile interface {
@@ -38,43 +43,122 @@ func (dr *Driver) tryGenSinglePulse(dn, up time.Duration) error {
 	return nil
 }
 
-func (dr *Driver) startAsyncNopPWM() {
-	dr.wg.Add(1)
-	go func() {
-		defer dr.wg.Done()
+// pwmRequest is a duty cycle handed to the PWM worker. If idle is true, the worker stops
+// writing to the device file until the next request
+type pwmRequest struct {
+	dn   time.Duration
+	up   time.Duration
+	flat bool
+	idle bool
+}
+
+// pwmResult is the outcome of the first pulse of a request. A panic of the worker while
+// generating the pulse is handed back to the caller so that it is not silenced
+type pwmResult struct {
+	err      error
+	panicked interface{}
+}
+
+// request hands the given duty cycle to the PWM worker and waits until it generated the first
+// pulse. It must be called with isBusy held
+func (dr *Driver) request(req pwmRequest) error {
+	select {
+	case dr.requests <- req:
+	case <-dr.closeSignal:
+		return heatsink.ErrFanDriverClosed
+	}
+	res := <-dr.results
+	if res.panicked != nil {
+		panic(res.panicked)
+	}
+	if res.err != nil {
+		return fmt.Errorf("generating initial pulse: %w", res.err)
+	}
+	return nil
+}
+
+// runPWM is the PWM worker, which is the only go routine that writes pulses to the device file
+// for as long as the driver is open. It generates a single pulse for every request and replies
+// with its outcome. Unless the request is idle, the pulse was flat, or it failed, the worker then
+// keeps generating pulses until the next request, which preempts the current pulse
+func (dr *Driver) runPWM() {
+	defer dr.wg.Done()
+
+	timer := time.NewTimer(0)
+	<-timer.C
+	defer timer.Stop()
+	// sleep waits for the given duration unless it is preempted by a request or closing
+	sleep := func(d time.Duration) (next *pwmRequest, closed bool) {
+		timer.Reset(d)
 		select {
-		case <-dr.unsetCurPWM:
-			return
+		case <-timer.C:
+			return nil, false
+		case req := <-dr.requests:
+			if !timer.Stop() {
+				<-timer.C
+			}
+			return &req, false
 		case <-dr.closeSignal:
-			return
+			if !timer.Stop() {
+				<-timer.C
+			}
+			return nil, true
 		}
-	}()
-}
+	}
 
-func (dr *Driver) startAsyncPWM(dn, up time.Duration) {
-	dr.wg.Add(1)
-	go func() {
-		defer dr.wg.Done()
-		for {
-			// errors are ignore for the following reasons:
-			//  - intermitten failures are not worth the effort
-			//  - persistent failures indicate there is a bigger problem
-			//  - the go routine will keep trying anyway
-			//  - expectations are SetDutyCycle() will be called again and
-			//    an error will be returned there if it is persistent
-			_ = dr.setSpeedMin()
-			time.Sleep(dn)
-			_ = dr.setSpeedMax()
-			time.Sleep(up)
+	var cur *pwmRequest
+	for {
+		if cur == nil {
 			select {
-			case <-dr.unsetCurPWM:
-				return
+			case req := <-dr.requests:
+				cur = &req
 			case <-dr.closeSignal:
 				return
-			default: // continue
 			}
 		}
+
+		res := dr.firstPulse(*cur)
+		dr.results <- res
+		if res.err != nil || res.panicked != nil || cur.flat || cur.idle {
+			cur = nil
+			continue
+		}
+
+		// errors are ignored for the following reasons:
+		//  - intermittent failures are not worth the effort
+		//  - persistent failures indicate there is a bigger problem
+		//  - the worker will keep trying anyway
+		//  - expectations are SetDutyCycle() will be called again and
+		//    an error will be returned there if it is persistent
+		dn, up := cur.dn, cur.up
+		for next, closed := (*pwmRequest)(nil), false; ; {
+			_ = dr.setSpeedMin()
+			if next, closed = sleep(dn); next == nil && !closed {
+				_ = dr.setSpeedMax()
+				next, closed = sleep(up)
+			}
+			if closed {
+				return
+			}
+			if next != nil {
+				cur = next
+				break
+			}
+		}
+	}
+}
+
+// firstPulse generates the first pulse of the given request, unless it is idle
+func (dr *Driver) firstPulse(req pwmRequest) (res pwmResult) {
+	if req.idle {
+		return pwmResult{}
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			res.panicked = r
+		}
 	}()
+	return pwmResult{err: dr.tryGenSinglePulse(req.dn, req.up)}
 }
 
 func (dr *Driver) isClosed() bool {
@@ -99,23 +183,131 @@ func (dr *Driver) calcDurations(dcRatio float64) (dn, up time.Duration, isFlatPu
 }
 
 func (dr *Driver) setSpeedMax() error {
-	if _, err := dr.devFile.Seek(0, 0); err != nil {
-		return err
+	return dr.write(dr.maxSpeedVal)
+}
+
+func (dr *Driver) setSpeedMin() error {
+	return dr.write(dr.minSpeedVal)
+}
+
+// write writes the given value to the device file and verifies it if write verification is
+// enabled, in which case a failure is reported once the mutex is released. Values that did not
+// read back are not an error, since they are not worth stopping thermal control for
+func (dr *Driver) write(val string) error {
+	dr.wrMutex.Lock()
+	err := dr.writeOnce(val)
+	var failure *WriteFailure
+	if err == nil && dr.verifier != nil {
+		failure, err = dr.verify(val)
 	}
-	if err := dr.devFile.Truncate(0); err != nil {
-		return err
+	dr.wrMutex.Unlock()
+
+	if failure != nil {
+		dr.verifier.OnFailure(*failure)
 	}
-	_, err := dr.devFile.Write([]byte(dr.maxSpeedVal))
 	return err
 }
 
-func (dr *Driver) setSpeedMin() error {
+// writeOnce writes the given value to the device file. It must be called with wrMutex held
+func (dr *Driver) writeOnce(val string) error {
+	// the buffer is reused for every write to spare the allocations of the PWM worker
+	dr.wrBuf = append(dr.wrBuf[:0], val...)
+	if file, ok := dr.devFile.(io.WriterAt); ok {
+		return dr.writeAt(file, val)
+	}
+
 	if _, err := dr.devFile.Seek(0, 0); err != nil {
 		return err
 	}
 	if err := dr.devFile.Truncate(0); err != nil {
 		return err
 	}
-	_, err := dr.devFile.Write([]byte(dr.minSpeedVal))
-	return err
+	if _, err := dr.devFile.Write(dr.wrBuf); err != nil {
+		return err
+	}
+	dr.lastWritten = val
+	return nil
+}
+
+// writeAt writes the buffered value to the device file with a single pwrite(2), which needs no
+// seek. The file is only truncated if the value is shorter than the one it holds, e.g. after
+// switching from "255" to "0", or if that is unknown, which spares most syscalls of every pulse
+func (dr *Driver) writeAt(file io.WriterAt, val string) error {
+	if !dr.sized || len(val) < len(dr.lastWritten) {
+		if err := dr.devFile.Truncate(0); err != nil {
+			dr.sized = false
+			return err
+		}
+	}
+	if _, err := file.WriteAt(dr.wrBuf, 0); err != nil {
+		dr.sized = false
+		return err
+	}
+	dr.lastWritten, dr.sized = val, true
+	return nil
+}
+
+type conflictDetection struct {
+	period     time.Duration
+	tolerance  int
+	onConflict func(Conflict)
+}
+
+func (dr *Driver) startAsyncConflictDetection() {
+	dr.wg.Add(1)
+	go func() {
+		defer dr.wg.Done()
+		ticker := time.NewTicker(dr.conflicts.period)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-dr.closeSignal:
+				return
+			case <-ticker.C:
+				if conflict, found := dr.detectConflict(); found {
+					dr.conflicts.onConflict(conflict)
+				}
+			}
+		}
+	}()
+}
+
+// detectConflict reads back the device file and compares it against the last written value.
+// Integer values are considered equal if they differ by no more than the configured tolerance.
+// Read errors are ignored since they do not indicate a conflict
+func (dr *Driver) detectConflict() (conflict Conflict, found bool) {
+	dr.wrMutex.Lock()
+	defer dr.wrMutex.Unlock()
+
+	if dr.lastWritten == "" {
+		return Conflict{}, false
+	}
+	data, err := ioutil.ReadFile(dr.filename)
+	if err != nil {
+		return Conflict{}, false
+	}
+
+	actual := strings.TrimSpace(string(data))
+	if valuesMatch(dr.lastWritten, actual, dr.conflicts.tolerance) {
+		return Conflict{}, false
+	}
+	return Conflict{
+		Driver:   dr.name,
+		Filename: dr.filename,
+		Expected: dr.lastWritten,
+		Actual:   actual,
+	}, true
+}
+
+func valuesMatch(expected, actual string, tolerance int) bool {
+	e, errE := strconv.Atoi(expected)
+	a, errA := strconv.Atoi(actual)
+	if errE != nil || errA != nil {
+		return expected == actual
+	}
+	diff := e - a
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff <= tolerance
 }
@@ -0,0 +1,155 @@
+package fanpwm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// EnableManual is the mode of a pwm channel, as found in its pwmN_enable file, in which the
+// fan is controlled by writing to the pwm file. Other modes, e.g. "2" in most hwmon drivers,
+// mean that the kernel or the firmware controls the fan automatically
+const EnableManual = "1"
+
+// ErrAutoControl is returned by SetDutyCycle under ReclaimFail if the pwm channel was switched
+// to automatic fan control
+var ErrAutoControl = errors.New("pwm channel was switched to automatic fan control")
+
+// ReclaimPolicy determines what a driver does when it finds that the kernel or the firmware
+// switched its pwm channel away from manual mode
+type ReclaimPolicy int
+
+const (
+	// ReclaimReassert switches the pwm channel back to manual mode and keeps controlling the fan
+	ReclaimReassert ReclaimPolicy = iota
+	// ReclaimYield leaves the fan to automatic control and makes SetDutyCycle a no-op until the
+	// pwm channel is back in manual mode
+	ReclaimYield
+	// ReclaimFail makes SetDutyCycle return ErrAutoControl until the pwm channel is back in
+	// manual mode
+	ReclaimFail
+)
+
+// String returns the name of the policy
+func (p ReclaimPolicy) String() string {
+	switch p {
+	case ReclaimReassert:
+		return "reassert"
+	case ReclaimYield:
+		return "yield"
+	case ReclaimFail:
+		return "fail"
+	default:
+		return fmt.Sprintf("ReclaimPolicy(%d)", int(p))
+	}
+}
+
+// Reclaim describes a change of the mode of a pwm channel that was not made by the driver
+type Reclaim struct {
+	// Driver is the name of the driver
+	Driver string
+	// Filename is the pwmN_enable file of the pwm channel
+	Filename string
+	// Mode is the mode that was found, which is EnableManual if the pwm channel went back to
+	// manual mode while the driver was yielding or failing
+	Mode string
+	// Policy is how the driver responded
+	Policy ReclaimPolicy
+}
+
+// enableMonitor watches the pwmN_enable file of the driver's pwm channel
+type enableMonitor struct {
+	policy    ReclaimPolicy
+	onReclaim func(Reclaim)
+	file      *os.File
+	// original is the mode of the pwm channel before the driver took manual control
+	original string
+	// reclaimed is true while the pwm channel is out of manual mode under ReclaimYield or
+	// ReclaimFail, so that onReclaim is only called when that changes
+	reclaimed bool
+}
+
+// open opens the pwmN_enable file of the given pwm file, records its mode, and switches
+// the pwm channel to manual mode
+func (em *enableMonitor) open(pwmFilename string) error {
+
+	file, err := os.OpenFile(pwmFilename+"_enable", os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("opening pwm enable file: %w", err)
+	}
+	em.file = file
+	if em.original, err = em.mode(); err != nil {
+		file.Close()
+		return fmt.Errorf("reading pwm enable file: %w", err)
+	}
+	if em.original != EnableManual {
+		if err := em.setManual(); err != nil {
+			file.Close()
+			return fmt.Errorf("switching pwm channel to manual mode: %w", err)
+		}
+	}
+	return nil
+}
+
+// mode reads the current mode of the pwm channel
+func (em *enableMonitor) mode() (string, error) {
+	buf := make([]byte, 16)
+	n, err := em.file.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return strings.TrimSpace(string(buf[:n])), nil
+}
+
+// setManual switches the pwm channel to manual mode
+func (em *enableMonitor) setManual() error {
+	if err := em.file.Truncate(0); err != nil {
+		return err
+	}
+	_, err := em.file.WriteAt([]byte(EnableManual), 0)
+	return err
+}
+
+// checkEnable makes sure the pwm channel is in manual mode according to the driver's policy,
+// and reports whether the driver must leave the fan alone. Read errors are ignored since they
+// do not indicate a change of mode
+func (dr *Driver) checkEnable() (yield bool, err error) {
+
+	em := dr.enable
+	if em == nil {
+		return false, nil
+	}
+	mode, err := em.mode()
+	if err != nil {
+		return false, nil
+	}
+	reclaim := Reclaim{Driver: dr.name, Filename: em.file.Name(), Mode: mode, Policy: em.policy}
+
+	if mode == EnableManual {
+		if em.reclaimed {
+			em.reclaimed = false
+			em.onReclaim(reclaim)
+		}
+		return false, nil
+	}
+
+	switch em.policy {
+	case ReclaimYield, ReclaimFail:
+		if !em.reclaimed {
+			em.reclaimed = true
+			em.onReclaim(reclaim)
+		}
+		if em.policy == ReclaimFail {
+			return true, fmt.Errorf("%w: mode '%s'", ErrAutoControl, mode)
+		}
+		return true, nil
+	default:
+		em.onReclaim(reclaim)
+		if err := em.setManual(); err != nil {
+			return true, fmt.Errorf("switching pwm channel back to manual mode: %w", err)
+		}
+		return false, nil
+	}
+}
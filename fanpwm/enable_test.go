@@ -0,0 +1,162 @@
+package fanpwm
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+// enableFile creates the pwmN_enable file of the given pwm file with the given mode
+func enableFile(t *testing.T, pwmFile *os.File, mode string) (filename string, cleanup func()) {
+	t.Helper()
+
+	filename = pwmFile.Name() + "_enable"
+	if err := ioutil.WriteFile(filename, []byte(mode+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return filename, func() { os.Remove(filename) }
+}
+
+func readMode(t *testing.T, filename string) string {
+	t.Helper()
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestOptEnableMonitor(t *testing.T) {
+	t.Parallel()
+
+	dr := &Driver{enable: &enableMonitor{}}
+	OptEnableMonitor(ReclaimYield, nil)(dr)
+	if dr.enable != nil {
+		t.Fatalf("expected a nil callback to disable monitoring, got: %+v", dr.enable)
+	}
+
+	OptEnableMonitor(ReclaimPolicy(7), func(Reclaim) {})(dr)
+	if dr.enable == nil || dr.enable.policy != ReclaimReassert {
+		t.Fatalf("expected an unknown policy to default to reassert, got: %+v", dr.enable)
+	}
+}
+
+func TestNew_enableMonitor(t *testing.T) {
+	t.Parallel()
+
+	tmpFile, cleanup := temporaryFile(t)
+	defer cleanup()
+
+	_, err := New(tmpFile.Name(), OptEnableMonitor(ReclaimReassert, func(Reclaim) {}))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", os.ErrNotExist, err)
+	}
+
+	filename, cleanupEnable := enableFile(t, tmpFile, "2")
+	defer cleanupEnable()
+	driver, err := New(tmpFile.Name(), OptEnableMonitor(ReclaimReassert, func(Reclaim) {}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer driver.Close()
+
+	if mode := readMode(t, filename); mode != EnableManual {
+		t.Errorf("expected the pwm channel to be switched to manual mode, got: %q", mode)
+	}
+	if driver.enable.original != "2" {
+		t.Errorf("expected the original mode to be recorded, got: %q", driver.enable.original)
+	}
+}
+
+func TestDriver_SetDutyCycle_reclaimed(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		policy       ReclaimPolicy
+		expectedErr  error
+		expectedMode string
+		expectedPWM  string
+		// expectedModes are the modes passed to onReclaim, first while the pwm channel is
+		// out of manual mode for two calls, then once it is back in manual mode
+		expectedModes []string
+	}{
+		{
+			policy:        ReclaimReassert,
+			expectedMode:  EnableManual,
+			expectedPWM:   "255",
+			expectedModes: []string{"2", "2"},
+		},
+		{
+			policy:        ReclaimYield,
+			expectedMode:  "2",
+			expectedPWM:   "0",
+			expectedModes: []string{"2", EnableManual},
+		},
+		{
+			policy:        ReclaimFail,
+			expectedErr:   ErrAutoControl,
+			expectedMode:  "2",
+			expectedPWM:   "0",
+			expectedModes: []string{"2", EnableManual},
+		},
+	}
+
+	for _, tc := range testCases {
+		tmpFile, cleanup := temporaryFile(t)
+		filename, cleanupEnable := enableFile(t, tmpFile, EnableManual)
+		t.Run(tc.policy.String(), func(t *testing.T) {
+			defer cleanup()
+			defer cleanupEnable()
+
+			var modes []string
+			onReclaim := func(r Reclaim) {
+				if r.Policy != tc.policy || r.Filename != filename {
+					t.Errorf("unexpected reclaim: %+v", r)
+				}
+				modes = append(modes, r.Mode)
+			}
+			driver, err := New(tmpFile.Name(), OptEnableMonitor(tc.policy, onReclaim))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer driver.Close()
+			if err := driver.SetDutyCycle(0); err != nil {
+				t.Fatal(err)
+			}
+
+			for i := 0; i < 2; i++ {
+				if err := ioutil.WriteFile(filename, []byte("2\n"), 0600); err != nil {
+					t.Fatal(err)
+				}
+				err = driver.SetDutyCycle(1)
+				if !errors.Is(err, tc.expectedErr) {
+					t.Fatalf("unexpected error\nwant: %v\n got: %v", tc.expectedErr, err)
+				}
+			}
+			if mode := readMode(t, filename); mode != tc.expectedMode && mode != tc.expectedMode+"\n" {
+				t.Errorf("unexpected mode\nwant: %q\n got: %q", tc.expectedMode, mode)
+			}
+			if pwm := readMode(t, tmpFile.Name()); pwm != tc.expectedPWM {
+				t.Errorf("unexpected pwm value\nwant: %q\n got: %q", tc.expectedPWM, pwm)
+			}
+
+			// back in manual mode, the fan is controlled again
+			if err := ioutil.WriteFile(filename, []byte(EnableManual), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if err := driver.SetDutyCycle(1); err != nil {
+				t.Fatal(err)
+			}
+			if pwm := readMode(t, tmpFile.Name()); pwm != "255" {
+				t.Errorf("expected the fan to be controlled again, got: %q", pwm)
+			}
+			if diff := deep.Equal(modes, tc.expectedModes); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package fanpwm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// CloseBehavior determines the pwm value that Close leaves the fan in
+type CloseBehavior int
+
+const (
+	// CloseMaxSpeed writes the max speed value, which is the safest choice
+	CloseMaxSpeed CloseBehavior = iota
+	// CloseMinSpeed writes the min speed value
+	CloseMinSpeed
+	// CloseValue writes a given value
+	CloseValue
+	// CloseRestore writes back the pwm value and mode found when the driver was created
+	CloseRestore
+	// CloseLeave writes nothing, leaving the fan at the last duty cycle set
+	CloseLeave
+)
+
+// String returns the name of the close behavior
+func (b CloseBehavior) String() string {
+	switch b {
+	case CloseMaxSpeed:
+		return "max"
+	case CloseMinSpeed:
+		return "min"
+	case CloseValue:
+		return "value"
+	case CloseRestore:
+		return "restore"
+	case CloseLeave:
+		return "leave"
+	default:
+		return fmt.Sprintf("CloseBehavior(%d)", int(b))
+	}
+}
+
+// exitState is what the driver leaves the pwm channel in when it is closed
+type exitState struct {
+	behavior CloseBehavior
+	// value is written under CloseValue
+	value string
+	// mode is written to the pwmN_enable file after the value if it is not empty, taking
+	// precedence over the restored mode
+	mode string
+}
+
+// pwmState is the pwm value and mode of a pwm channel, where the mode is empty if the pwm
+// channel has no pwmN_enable file
+type pwmState struct {
+	value string
+	mode  string
+}
+
+// recordOriginal reads the pwm value and mode of the pwm channel as they are before the driver
+// writes to it, unless they are not needed when the driver is closed. The mode is only read if
+// the pwmN_enable file exists
+func (dr *Driver) recordOriginal() error {
+
+	if dr.exit.behavior != CloseRestore {
+		return nil
+	}
+	data, err := ioutil.ReadFile(dr.filename)
+	if err != nil {
+		return fmt.Errorf("reading original pwm value: %w", err)
+	}
+	dr.original.value = strings.TrimSpace(string(data))
+
+	if dr.enable != nil {
+		dr.original.mode = dr.enable.original
+		return nil
+	}
+	data, err = ioutil.ReadFile(dr.filename + "_enable")
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("reading original pwm enable mode: %w", err)
+	}
+	dr.original.mode = strings.TrimSpace(string(data))
+	return nil
+}
+
+// setExitState writes the pwm value and mode the driver leaves the pwm channel in according to
+// its close behavior
+func (dr *Driver) setExitState() error {
+
+	var state pwmState
+	switch dr.exit.behavior {
+	case CloseLeave:
+		return nil
+	case CloseMinSpeed:
+		state.value = dr.minSpeedVal
+	case CloseValue:
+		state.value = dr.exit.value
+	case CloseRestore:
+		state = dr.original
+	default:
+		state.value = dr.maxSpeedVal
+	}
+	if dr.exit.mode != "" {
+		state.mode = dr.exit.mode
+	}
+
+	if err := dr.write(state.value); err != nil {
+		return fmt.Errorf("writing pwm value '%s': %w", state.value, err)
+	}
+	if state.mode == "" {
+		return nil
+	}
+	// the mode is set last so that automatic control starts off the exit value
+	var err error
+	if dr.enable != nil {
+		if err = dr.enable.file.Truncate(0); err == nil {
+			_, err = dr.enable.file.WriteAt([]byte(state.mode), 0)
+		}
+	} else {
+		err = writeExisting(dr.filename+"_enable", state.mode)
+	}
+	if err != nil {
+		return fmt.Errorf("writing pwm enable mode '%s': %w", state.mode, err)
+	}
+	return nil
+}
+
+// writeExisting writes the given value to the given file, which must exist
+func writeExisting(filename, value string) error {
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write([]byte(value))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,127 @@
+package fanpwm
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestOptCloseBehavior_invalid(t *testing.T) {
+	t.Parallel()
+
+	for _, behavior := range []CloseBehavior{CloseValue, CloseBehavior(-1), CloseBehavior(9)} {
+		dr := &Driver{exit: exitState{behavior: CloseLeave}}
+		OptCloseBehavior(behavior, "")(dr)
+		if dr.exit.behavior != CloseMaxSpeed {
+			t.Errorf("expected %s to fall back to %s, got: %s", behavior, CloseMaxSpeed, dr.exit.behavior)
+		}
+	}
+}
+
+func TestDriver_Close_exitState(t *testing.T) {
+
+	testCases := []struct {
+		name          string
+		enableMode    string // no pwmN_enable file if empty
+		options       []Option
+		expectedValue string
+		expectedMode  string
+	}{
+		{
+			name:          "default",
+			enableMode:    "2",
+			expectedValue: "255",
+			expectedMode:  "2",
+		},
+		{
+			name:          "restore-without-enable-file",
+			options:       []Option{OptRestoreOnClose()},
+			expectedValue: "77",
+		},
+		{
+			name:          "restore",
+			enableMode:    "2",
+			options:       []Option{OptRestoreOnClose()},
+			expectedValue: "77",
+			expectedMode:  "2",
+		},
+		{
+			name:          "restore-monitored",
+			enableMode:    "5",
+			options:       []Option{OptRestoreOnClose(), OptEnableMonitor(ReclaimReassert, func(Reclaim) {})},
+			expectedValue: "77",
+			expectedMode:  "5",
+		},
+		{
+			name:          "exit-state",
+			enableMode:    "1",
+			options:       []Option{OptRestoreOnClose(), OptExitState("128", "2")},
+			expectedValue: "128",
+			expectedMode:  "2",
+		},
+		{
+			name:          "min",
+			options:       []Option{OptMinSpeedValue("30"), OptCloseBehavior(CloseMinSpeed, "")},
+			expectedValue: "30",
+		},
+		{
+			name:          "leave",
+			enableMode:    "1",
+			options:       []Option{OptCloseBehavior(CloseLeave, ""), OptExitState("", "2")},
+			expectedValue: "0",
+			expectedMode:  "1",
+		},
+		{
+			name:          "value",
+			options:       []Option{OptCloseBehavior(CloseValue, "100")},
+			expectedValue: "100",
+		},
+		{
+			name:          "exit-value",
+			enableMode:    "1",
+			options:       []Option{OptExitState("0", "")},
+			expectedValue: "0",
+			expectedMode:  "1",
+		},
+	}
+
+	for _, tc := range testCases {
+		tmpFile, cleanup := temporaryFile(t)
+		defer cleanup()
+		if err := ioutil.WriteFile(tmpFile.Name(), []byte("77\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		enableFilename := tmpFile.Name() + "_enable"
+		if tc.enableMode != "" {
+			if err := ioutil.WriteFile(enableFilename, []byte(tc.enableMode+"\n"), 0600); err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(enableFilename)
+		}
+
+		driver, err := New(tmpFile.Name(), tc.options...)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if err := driver.SetDutyCycle(0.0); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if err := driver.Close(); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+
+		if value := readMode(t, tmpFile.Name()); value != tc.expectedValue {
+			t.Errorf("%s: unexpected pwm value\nwant: %q\n got: %q", tc.name, tc.expectedValue, value)
+		}
+		if tc.enableMode == "" {
+			if _, err := os.Stat(enableFilename); !os.IsNotExist(err) {
+				t.Errorf("%s: expected no pwm enable file to be created, got: %v", tc.name, err)
+			}
+			continue
+		}
+		mode := readMode(t, enableFilename)
+		if mode != tc.expectedMode && mode != tc.expectedMode+"\n" {
+			t.Errorf("%s: unexpected pwm enable mode\nwant: %q\n got: %q", tc.name, tc.expectedMode, mode)
+		}
+	}
+}
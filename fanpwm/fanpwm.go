@@ -2,8 +2,11 @@
 package fanpwm
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
@@ -11,20 +14,55 @@ import (
 )
 
 // compile-time check for interface implementation and dependency inversion
-var _ heatsink.FanDriver = (*Driver)(nil)
+var (
+	_ heatsink.FanDriver  = (*Driver)(nil)
+	_ heatsink.SelfTester = (*Driver)(nil)
+)
+
+// ErrWriteIgnored is returned by a self-test if the device file did not keep the written value,
+// e.g. because the fan is under automatic control by the firmware
+var ErrWriteIgnored = errors.New("device file did not keep the written value")
+
+// MaxSpeed is the largest value that a pwm device file accepts, which spins the fan at full speed
+const MaxSpeed = 255
+
+// ErrDeviceLocked is returned by New if another driver, possibly of another process, holds
+// the lock of the device file
+var ErrDeviceLocked = errors.New("device file is locked by another fan driver")
 
 // Driver is a two-speed fan driver that is backed by an underlying file. It assumes that the
 // physical fan controller can only be set to either a minimum or a maximum speed. Instances
 // of this type are safe for concurrent use although it is not recommended to be used that way
 type Driver struct {
 	name        string
+	filename    string
 	devFile     wrOnlyFile `deep:"-"`
 	minSpeedVal string
 	maxSpeedVal string
-	pwmPeriod   time.Duration
-	// unsetCurPWM is used to send a stop signal to the currently running
-	// go routine that performs the PWM as per a call to SetDutyCycle()
-	unsetCurPWM chan struct{}
+	// inverted is true if the fan spins faster the lower the pwm value, in which case the
+	// speed values are inverted once the options are applied
+	inverted  bool
+	pwmPeriod time.Duration
+	// lastWritten is the most recent value written to the device file. It is guarded by
+	// wrMutex so that reading back the file does not interleave with writing to it
+	lastWritten string
+	// sized is true if the device file is known to hold lastWritten and nothing more
+	sized     bool
+	wrBuf     []byte
+	wrMutex   sync.Mutex
+	conflicts conflictDetection
+	// verifier reads back written values if it is not nil
+	verifier *writeVerifier
+	// enable watches the mode of the pwm channel if it is not nil
+	enable *enableMonitor
+	// output sets the hardware pwm signal of the pwm channel if it is not nil
+	output *hardwareOutput
+	// exit is what Close leaves the pwm channel in, which may be the original state
+	exit     exitState
+	original pwmState
+	// requests hands duty cycles to the PWM worker, which replies on results
+	requests    chan pwmRequest
+	results     chan pwmResult
 	closeSignal chan struct{}
 	closeMutex  sync.Mutex
 	isBusy      sync.Mutex
@@ -34,21 +72,30 @@ type Driver struct {
 // New returns a new unstarted two-speed fan driver. The given file should typically represent a
 // PWM-device and looks like '/sys/class/hwmon/hwmon[x]/pwm[y]'. The returned instance will
 // have the exclusive write access to the given file and it will remain open until Close() is
-// called. For details about options and defaults, see the documentation for type 'Option'
+// called. The file is exclusively locked with flock(2) while it is open, so that two drivers
+// of the same file, e.g. of two daemons, do not fight over the fan. If another driver holds
+// the lock, New returns ErrDeviceLocked identifying the process that holds it. For details
+// about options and defaults, see the documentation for type 'Option'
 func New(filename string, options ...Option) (*Driver, error) {
 
 	devFile, err := os.OpenFile(filename, os.O_EXCL|os.O_WRONLY, os.ModePerm)
 	if err != nil {
 		return nil, err
 	}
+	if err := lockFile(devFile); err != nil {
+		devFile.Close()
+		return nil, err
+	}
 
 	driver := &Driver{ // defaults
 		name:        filename,
+		filename:    filename,
 		minSpeedVal: "0",
 		maxSpeedVal: "255",
 		pwmPeriod:   50 * time.Millisecond,
 		devFile:     devFile,
-		unsetCurPWM: make(chan struct{}),
+		requests:    make(chan pwmRequest),
+		results:     make(chan pwmResult, 1),
 		closeSignal: make(chan struct{}),
 	}
 	for _, applyOption := range options {
@@ -57,15 +104,54 @@ func New(filename string, options ...Option) (*Driver, error) {
 		}
 		applyOption(driver)
 	}
+	if driver.inverted {
+		if err := driver.invertPolarity(); err != nil {
+			devFile.Close()
+			return nil, err
+		}
+	}
+	if driver.enable != nil {
+		if err := driver.enable.open(filename); err != nil {
+			devFile.Close()
+			return nil, err
+		}
+	}
+	if err := driver.recordOriginal(); err != nil {
+		driver.closeFiles()
+		return nil, err
+	}
+	if driver.output != nil {
+		if err := driver.output.apply(filename); err != nil {
+			driver.closeFiles()
+			return nil, err
+		}
+	}
 
-	// So SetDutyCycle() does not block on the very first call
-	driver.startAsyncNopPWM()
+	driver.wg.Add(1)
+	go driver.runPWM()
+	if driver.conflicts.period > 0 {
+		driver.startAsyncConflictDetection()
+	}
 	return driver, nil
 }
 
-// SetDutyCycle is a non-blocking method that uses the given duty cycle ratio to perform PWM.
-// dcRatio must be in the range [0.0, 1.0]. If dcRatio is less than 0.0, it will be set to
-// 0.0 and if it is greater than 1.0, it will be set to 1.0
+// Conflict describes a change to the PWM device file that was not made by the driver, which
+// indicates that another program or the firmware is also controlling the fan
+type Conflict struct {
+	// Driver is the name of the driver
+	Driver string
+	// Filename is the PWM device file
+	Filename string
+	// Expected is the value that was last written by the driver
+	Expected string
+	// Actual is the value that was read back from the device file
+	Actual string
+}
+
+// SetDutyCycle hands the given duty cycle ratio to the driver's PWM worker, which preempts the
+// current pulse, and returns once the first pulse was generated, after which the worker keeps
+// performing PWM in the background. dcRatio must be in the range [0.0, 1.0]. If dcRatio is less
+// than 0.0, it will be set to 0.0 and if it is greater than 1.0, it will be set to 1.0
 func (dr *Driver) SetDutyCycle(dcRatio float64) (err error) {
 	dr.isBusy.Lock()
 	defer dr.isBusy.Unlock()
@@ -73,26 +159,54 @@ func (dr *Driver) SetDutyCycle(dcRatio float64) (err error) {
 	if dr.isClosed() {
 		return heatsink.ErrFanDriverClosed
 	}
-	dr.unsetCurPWM <- struct{}{}
+	if yield, err := dr.checkEnable(); yield || err != nil {
+		if idleErr := dr.request(pwmRequest{idle: true}); err == nil {
+			err = idleErr
+		}
+		return err
+	}
 
 	durationDn, durationUp, isFlatPulse := dr.calcDurations(dcRatio)
-	err = dr.tryGenSinglePulse(durationDn, durationUp)
-	if err != nil || isFlatPulse {
-		dr.startAsyncNopPWM()
+	return dr.request(pwmRequest{dn: durationDn, up: durationUp, flat: isFlatPulse})
+}
+
+// SelfTest verifies that the driver controls the fan by writing the maximum speed value to the
+// device file, reading it back, and restoring the value that was read before. Values read back
+// match within the tolerance of conflict detection, if any. It is meant to be called before the
+// first call to SetDutyCycle. If the driver is closed, it returns heatsink.ErrFanDriverClosed
+func (dr *Driver) SelfTest() error {
+	dr.isBusy.Lock()
+	defer dr.isBusy.Unlock()
+
+	if dr.isClosed() {
+		return heatsink.ErrFanDriverClosed
 	}
+	data, err := ioutil.ReadFile(dr.filename)
 	if err != nil {
-		return fmt.Errorf("generating initial pulse: %w", err)
+		return fmt.Errorf("reading current value: %w", err)
 	}
-	if isFlatPulse {
-		return nil
+	original := strings.TrimSpace(string(data))
+	if err := dr.write(dr.maxSpeedVal); err != nil {
+		return fmt.Errorf("writing max speed value: %w", err)
 	}
 
-	dr.startAsyncPWM(durationDn, durationUp)
-	return nil
+	data, err = ioutil.ReadFile(dr.filename)
+	actual := strings.TrimSpace(string(data))
+	switch {
+	case err != nil:
+		err = fmt.Errorf("reading back written value: %w", err)
+	case !valuesMatch(dr.maxSpeedVal, actual, dr.conflicts.tolerance):
+		err = fmt.Errorf("%w: wrote '%s' but read back '%s'", ErrWriteIgnored, dr.maxSpeedVal, actual)
+	}
+	if rerr := dr.write(original); rerr != nil && err == nil {
+		err = fmt.Errorf("restoring value '%s': %w", original, rerr)
+	}
+	return err
 }
 
-// Close closes open files and releases held resources. If the driver is already closed, it
-// returns heatsink.ErrFanDriverClosed
+// Close sets the fan to its exit state, which is the max speed unless configured otherwise with
+// OptCloseBehavior, closes open files, and releases held resources. If the driver is already
+// closed, it returns heatsink.ErrFanDriverClosed
 func (dr *Driver) Close() error {
 
 	dr.closeMutex.Lock()
@@ -105,12 +219,19 @@ func (dr *Driver) Close() error {
 	dr.isBusy.Lock()
 	defer dr.isBusy.Unlock()
 	dr.wg.Wait()
-	close(dr.unsetCurPWM)
 
-	err1 := dr.setSpeedMax()
-	err2 := dr.devFile.Close()
+	// the hardware output is restored first so that the exit state is set in the original mode
+	var err0 error
+	if dr.output != nil {
+		err0 = dr.output.restore(dr.filename)
+	}
+	err1 := dr.setExitState()
+	err2 := dr.closeFiles()
+	if err0 != nil {
+		return fmt.Errorf("failed to restore hardware output while closing driver: %w", err0)
+	}
 	if err1 != nil {
-		return fmt.Errorf("failed to set fan speed to max while closing driver: %w", err1)
+		return fmt.Errorf("failed to set fan to its exit state while closing driver: %w", err1)
 	}
 	if err2 != nil {
 		return fmt.Errorf("failed to close device file while closing driver: %w", err2)
@@ -119,6 +240,17 @@ func (dr *Driver) Close() error {
 	return nil
 }
 
+// closeFiles closes the device file and the pwmN_enable file, if it is open
+func (dr *Driver) closeFiles() error {
+	err := dr.devFile.Close()
+	if dr.enable != nil {
+		if enableErr := dr.enable.file.Close(); enableErr != nil && err == nil {
+			err = enableErr
+		}
+	}
+	return err
+}
+
 // Name returns the name of this fan driver
 func (dr *Driver) Name() string {
 	return dr.name
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"runtime"
 	"strings"
 	"sync"
 	"testing"
@@ -35,6 +36,7 @@ func TestNew_defaults(t *testing.T) {
 
 	expectedDr := &Driver{
 		name:        tmpFile.Name(),
+		filename:    tmpFile.Name(),
 		minSpeedVal: "0",
 		maxSpeedVal: "255",
 		pwmPeriod:   50 * time.Millisecond,
@@ -80,6 +82,7 @@ func TestNew_validOptions(t *testing.T) {
 
 	expectedDr := &Driver{
 		name:        t.Name(),
+		filename:    tmpFile.Name(),
 		minSpeedVal: "2",
 		maxSpeedVal: "8",
 		pwmPeriod:   13 * time.Microsecond,
@@ -98,6 +101,36 @@ func TestNew_validOptions(t *testing.T) {
 	}
 }
 
+func TestNew_speedOptions(t *testing.T) {
+
+	tmpFile, cleanup := temporaryFile(t)
+	defer cleanup()
+
+	testCases := []struct {
+		min, max                 int
+		expectedMin, expectedMax string
+	}{
+		{min: 2, max: 8, expectedMin: "2", expectedMax: "8"},
+		{min: 0, max: MaxSpeed, expectedMin: "0", expectedMax: "255"},
+		{min: -1, max: MaxSpeed + 1, expectedMin: "0", expectedMax: "255"}, // out of range
+	}
+	for _, tc := range testCases {
+		dr, err := New(tmpFile.Name(), OptMinSpeed(tc.min), OptMaxSpeed(tc.max))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := dr.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if dr.minSpeedVal != tc.expectedMin || dr.maxSpeedVal != tc.expectedMax {
+			t.Errorf(
+				"[%d, %d]: unexpected speed values\nwant: %q, %q\n got: %q, %q",
+				tc.min, tc.max, tc.expectedMin, tc.expectedMax, dr.minSpeedVal, dr.maxSpeedVal,
+			)
+		}
+	}
+}
+
 func TestNew_invalidOptions(t *testing.T) {
 
 	orig := deep.CompareUnexportedFields
@@ -111,6 +144,7 @@ func TestNew_invalidOptions(t *testing.T) {
 		tmpFile.Name(),
 		OptName(""),
 		OptMinSpeedValue(""), OptMaxSpeedValue(""),
+		OptMinSpeed(-1), OptMaxSpeed(MaxSpeed+1),
 		OptPeriodPWM(-16),
 	)
 	if err != nil {
@@ -124,6 +158,7 @@ func TestNew_invalidOptions(t *testing.T) {
 
 	expectedDr := &Driver{
 		name:        tmpFile.Name(),
+		filename:    tmpFile.Name(),
 		minSpeedVal: "0",
 		maxSpeedVal: "255",
 		pwmPeriod:   50 * time.Millisecond,
@@ -151,6 +186,41 @@ func TestNew_error(t *testing.T) {
 	}
 }
 
+func TestNew_errDeviceLocked(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("device files are not locked on windows")
+	}
+
+	tmpFile, cleanup := temporaryFile(t)
+	defer cleanup()
+
+	driver, err := New(tmpFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = New(tmpFile.Name())
+	if !errors.Is(err, ErrDeviceLocked) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", ErrDeviceLocked, err)
+	}
+	if runtime.GOOS == "linux" && !strings.Contains(err.Error(), fmt.Sprintf("pid %d", os.Getpid())) {
+		t.Errorf("expected the error to identify this process as the holder, got: %v", err)
+	}
+
+	// the lock is released along with the device file
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+	driver, err = New(tmpFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestDriver_SetDutyCycle_errorSync(t *testing.T) {
 	t.Parallel()
 
@@ -261,6 +331,61 @@ func TestDriver_SetDutyCycle_max_min(t *testing.T) {
 	}
 }
 
+// truncateCountingFile is a device file that counts how often it is truncated
+type truncateCountingFile struct {
+	*os.File
+	truncates int
+}
+
+func (f *truncateCountingFile) Truncate(size int64) error {
+	f.truncates++
+	return f.File.Truncate(size)
+}
+
+func TestDriver_write_fastPath(t *testing.T) {
+	t.Parallel()
+
+	tmpFile, cleanupTmpFile := temporaryFile(t)
+	defer cleanupTmpFile()
+	if _, err := tmpFile.WriteString("hello world"); err != nil {
+		t.Fatal(err)
+	}
+
+	driver, err := New(tmpFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer driver.Close()
+	devFile := &truncateCountingFile{File: driver.devFile.(*os.File)}
+	driver.devFile = devFile
+
+	steps := []struct {
+		val       string
+		truncates int
+	}{
+		{val: "255", truncates: 1}, // the contents of the file are unknown
+		{val: "255", truncates: 1},
+		{val: "0", truncates: 2},
+		{val: "100", truncates: 2},
+		{val: "100", truncates: 2},
+	}
+	for i, step := range steps {
+		if err := driver.write(step.val); err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		data, err := ioutil.ReadFile(tmpFile.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != step.val {
+			t.Errorf("step %d: unexpected contents\nwant: %q\n got: %q", i, step.val, data)
+		}
+		if devFile.truncates != step.truncates {
+			t.Errorf("step %d: unexpected number of truncates\nwant: %d\n got: %d", i, step.truncates, devFile.truncates)
+		}
+	}
+}
+
 func TestDriver_concurrentUseAfterClose(t *testing.T) {
 	t.Parallel()
 	defer func() {
@@ -369,3 +494,121 @@ func TestDriver_SetDutyCycle_unknownPanicsAreNotSilenced(t *testing.T) {
 	err := driver.SetDutyCycle(0.5)
 	fmt.Println(err)
 }
+
+func TestDriver_conflictDetection(t *testing.T) {
+	t.Parallel()
+
+	tmpFile, cleanup := temporaryFile(t)
+	defer cleanup()
+
+	conflicts := make(chan Conflict, 8)
+	dr, err := New(
+		tmpFile.Name(),
+		OptName(t.Name()),
+		OptConflictDetection(time.Millisecond, 2, func(c Conflict) { conflicts <- c }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dr.Close()
+
+	if err := dr.SetDutyCycle(1.0); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(tmpFile.Name(), []byte("254\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case c := <-conflicts:
+		t.Fatalf("expected no conflict within tolerance, got: %+v", c)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	if err := ioutil.WriteFile(tmpFile.Name(), []byte("100\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case actual := <-conflicts:
+		expected := Conflict{Driver: t.Name(), Filename: tmpFile.Name(), Expected: "255", Actual: "100"}
+		if diff := deep.Equal(expected, actual); diff != nil {
+			t.Fatal("actual conflict does not match expected\n", strings.Join(diff, "\n"))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for a conflict to be detected")
+	}
+}
+
+func Test_valuesMatch(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		inExpected, inActual string
+		inTolerance          int
+		expected             bool
+	}{
+		"equal":            {inExpected: "128", inActual: "128", expected: true},
+		"within-tolerance": {inExpected: "128", inActual: "126", inTolerance: 2, expected: true},
+		"beyond-tolerance": {inExpected: "128", inActual: "125", inTolerance: 2, expected: false},
+		"non-integers":     {inExpected: "on", inActual: "off", inTolerance: 100, expected: false},
+	}
+	for name, testCase := range cases {
+		testCase := testCase
+		t.Run(name, func(t *testing.T) {
+			actual := valuesMatch(testCase.inExpected, testCase.inActual, testCase.inTolerance)
+			if actual != testCase.expected {
+				t.Fatalf("unexpected result\nwant: %v\n got: %v", testCase.expected, actual)
+			}
+		})
+	}
+}
+
+func TestDriver_SelfTest(t *testing.T) {
+	t.Parallel()
+
+	tmpFile, cleanup := temporaryFile(t)
+	defer cleanup()
+	if err := ioutil.WriteFile(tmpFile.Name(), []byte("128\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dr, err := New(tmpFile.Name(), OptMaxSpeedValue("200"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dr.SelfTest(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(tmpFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "128" {
+		t.Fatalf("expected the original value to be restored, got: '%s'", data)
+	}
+
+	if err := dr.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dr.SelfTest(); !errors.Is(err, heatsink.ErrFanDriverClosed) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", heatsink.ErrFanDriverClosed, err)
+	}
+}
+
+func TestDriver_SelfTest_writeIgnored(t *testing.T) {
+	t.Parallel()
+
+	tmpFile, cleanup := temporaryFile(t)
+	defer cleanup()
+
+	dr, err := New(tmpFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dr.Close()
+	// a device file that does not keep what is written to it
+	dr.filename = os.DevNull
+
+	if err := dr.SelfTest(); !errors.Is(err, ErrWriteIgnored) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", ErrWriteIgnored, err)
+	}
+}
@@ -73,7 +73,8 @@ func (ff *fakeFile) Write(b []byte) (n int, err error) {
 		err = ff.onWriteErrs[0]
 		ff.onWriteErrs = ff.onWriteErrs[1:]
 	}
-	passedArg := ffArgPassedToWrite{val: b, ts: ts}
+	// the driver reuses its buffer, so it must not be retained
+	passedArg := ffArgPassedToWrite{val: append([]byte(nil), b...), ts: ts}
 	ff.actualWrites = append(ff.actualWrites, passedArg)
 	return
 }
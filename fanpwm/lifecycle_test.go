@@ -238,15 +238,16 @@ func (lc *lifeCycleTest) collectPulseSamples() *fakeFile {
 				devFile.mutex.Unlock()
 				continue
 			}
-			lc.driver.unsetCurPWM <- struct{}{}
-			lc.driver.wg.Add(1)
-			go func() { <-lc.driver.unsetCurPWM; lc.driver.wg.Done() }()
 			devFile.actualWrites = devFile.actualWrites[:fileWrCount]
 			devFile.actualTruncates = devFile.actualTruncates[:fileTrCount]
 			done = true
 			devFile.mutex.Unlock()
 		}
 	}
+	// stop the pulses before the fake device file is unset
+	if err := lc.driver.request(pwmRequest{idle: true}); err != nil {
+		lc.t.Fatal(err)
+	}
 
 	return devFile
 }
@@ -0,0 +1,79 @@
+//go:build !windows
+// +build !windows
+
+package fanpwm
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// procLocks lists the file locks held on linux
+const procLocks = "/proc/locks"
+
+// lockFile takes an exclusive advisory lock of the given file without blocking. The lock is
+// held until the file is closed. If another open file, possibly of another process, holds the
+// lock, it returns ErrDeviceLocked along with the holder, if it is known. Files that cannot
+// be locked, e.g. of file systems that do not support it, are used without a lock
+func lockFile(file *os.File) error {
+
+	err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err != syscall.EWOULDBLOCK {
+		return nil
+	}
+	if holder := lockHolder(file); holder != "" {
+		return fmt.Errorf("%w: held by %s", ErrDeviceLocked, holder)
+	}
+	return fmt.Errorf("%w: held by another process", ErrDeviceLocked)
+}
+
+// lockHolder describes the process that holds the flock of the given file according to
+// /proc/locks, or returns an empty string if it is unknown, e.g. on systems other than linux
+func lockHolder(file *os.File) string {
+
+	info, err := file.Stat()
+	if err != nil {
+		return ""
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return ""
+	}
+	dev := uint64(st.Dev)
+	major, minor := (dev>>8)&0xfff|(dev>>32)&^0xfff, dev&0xff|(dev>>12)&^0xff
+	// e.g. "1: FLOCK  ADVISORY  WRITE 1234 00:14:5678 0 EOF", where the device is in hex
+	id := fmt.Sprintf("%02x:%02x:%d", major, minor, uint64(st.Ino))
+
+	locks, err := os.Open(procLocks)
+	if err != nil {
+		return ""
+	}
+	defer locks.Close()
+
+	scanner := bufio.NewScanner(locks)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// lines of blocked waiters have an extra "->" field
+		if len(fields) != 8 || fields[1] != "FLOCK" || fields[5] != id {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[4])
+		if err != nil {
+			continue
+		}
+		if pid == os.Getpid() {
+			return fmt.Sprintf("this process (pid %d), e.g. another driver of the same file", pid)
+		}
+		comm, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/comm", pid))
+		if err != nil {
+			return fmt.Sprintf("process %d", pid)
+		}
+		return fmt.Sprintf("process %d (%s)", pid, strings.TrimSpace(string(comm)))
+	}
+	return ""
+}
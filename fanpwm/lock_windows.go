@@ -0,0 +1,8 @@
+package fanpwm
+
+import "os"
+
+// lockFile does nothing on windows, where device files are not locked
+func lockFile(*os.File) error {
+	return nil
+}
@@ -1,6 +1,7 @@
 package fanpwm
 
 import (
+	"strconv"
 	"time"
 )
 
@@ -19,9 +20,37 @@ func OptPeriodPWM(d time.Duration) Option {
 	}
 }
 
+// OptMinSpeed specifies the value, in the range [0, MaxSpeed], which is written to the fan file to
+// cause the fan to spin at the minimum speed. If val is out of range, it is set to the default value
+//
+// (default: 0)
+func OptMinSpeed(val int) Option {
+	return func(dr *Driver) {
+		if val < 0 || val > MaxSpeed {
+			val = 0
+		}
+		dr.minSpeedVal = strconv.Itoa(val)
+	}
+}
+
+// OptMaxSpeed specifies the value, in the range [0, MaxSpeed], which is written to the fan file to
+// cause the fan to spin at the maximum speed. If val is out of range, it is set to the default value
+//
+// (default: 255)
+func OptMaxSpeed(val int) Option {
+	return func(dr *Driver) {
+		if val < 0 || val > MaxSpeed {
+			val = MaxSpeed
+		}
+		dr.maxSpeedVal = strconv.Itoa(val)
+	}
+}
+
 // OptMinSpeedValue specifies the value which is written to the fan file to cause the fan to
 // spin at the minimum speed. If val is empty, it is set to the default value
 //
+// Deprecated: the value is written verbatim, whatever it is; use OptMinSpeed instead
+//
 // (default: "0")
 func OptMinSpeedValue(val string) Option {
 	return func(dr *Driver) {
@@ -35,6 +64,8 @@ func OptMinSpeedValue(val string) Option {
 // OptMaxSpeedValue specifies the value which is written to the fan file to cause the fan to
 // spin at the maximum speed. If val is empty, it is set to the default value
 //
+// Deprecated: the value is written verbatim, whatever it is; use OptMaxSpeed instead
+//
 // (default: "255")
 func OptMaxSpeedValue(val string) Option {
 	return func(dr *Driver) {
@@ -45,6 +76,43 @@ func OptMaxSpeedValue(val string) Option {
 	}
 }
 
+// OptInvertedPolarity drives a fan whose header or board inverts the PWM signal, i.e. the fan
+// spins at full speed at a pwm value of 0. The min and max speed values, which must be integers
+// in the range [0, MaxSpeed], still denote the slowest and fastest speeds, and they are written
+// as MaxSpeed minus the value, e.g. 255 for the default min speed value of 0. Since Close writes
+// the max speed value by default, it leaves such a fan at full speed as well. Values that are
+// written verbatim, e.g. of CloseValue or CloseRestore, are not inverted
+//
+// (default: disabled)
+func OptInvertedPolarity() Option {
+	return func(dr *Driver) {
+		dr.inverted = true
+	}
+}
+
+// OptHardwareOutput sets the frequency and mode of the hardware pwm signal that drives the fan
+// through the pwmN_freq and pwmN_mode files of the pwm channel when the driver is created, and
+// restores the original ones when it is closed. New fails if a file that is needed does not
+// exist. A negative frequency or an unknown mode is set to its default value, which leaves the
+// corresponding file alone
+//
+// (default: disabled)
+func OptHardwareOutput(out HardwareOutput) Option {
+	return func(dr *Driver) {
+		if out.Frequency < 0 {
+			out.Frequency = 0
+		}
+		if out.Mode < OutputUnchanged || out.Mode > OutputPWM {
+			out.Mode = OutputUnchanged
+		}
+		if out == (HardwareOutput{}) {
+			dr.output = nil
+			return
+		}
+		dr.output = &hardwareOutput{HardwareOutput: out}
+	}
+}
+
 // OptName sets the name of the fan driver. if name is empty, it is set to the default value
 //
 // (default: filename)
@@ -55,3 +123,115 @@ func OptName(name string) Option {
 		}
 	}
 }
+
+// OptConflictDetection periodically reads back the device file and calls onConflict if the
+// value differs from the value last written by the driver by more than tolerance, which
+// indicates that another program or the firmware is also controlling the fan. onConflict is
+// called from a separate go routine. If period <= 0 or onConflict is nil, detection is disabled
+//
+// (default: disabled)
+func OptConflictDetection(period time.Duration, tolerance int, onConflict func(Conflict)) Option {
+	return func(dr *Driver) {
+		if period <= 0 || onConflict == nil {
+			dr.conflicts = conflictDetection{}
+			return
+		}
+		if tolerance < 0 {
+			tolerance = 0
+		}
+		dr.conflicts = conflictDetection{
+			period:     period,
+			tolerance:  tolerance,
+			onConflict: onConflict,
+		}
+	}
+}
+
+// OptEnableMonitor takes manual control of the pwm channel through its pwmN_enable file, i.e.
+// the device file followed by "_enable", when the driver is created and records the mode it was
+// in. Every call to SetDutyCycle then checks whether the kernel or the firmware switched the
+// channel back to automatic control and responds according to policy, which defaults to
+// ReclaimReassert if it is unknown. onReclaim is called whenever the mode changed underneath the
+// driver. If onReclaim is nil, the mode is left alone
+//
+// (default: disabled)
+func OptEnableMonitor(policy ReclaimPolicy, onReclaim func(Reclaim)) Option {
+	return func(dr *Driver) {
+		if onReclaim == nil {
+			dr.enable = nil
+			return
+		}
+		if policy < ReclaimReassert || policy > ReclaimFail {
+			policy = ReclaimReassert
+		}
+		dr.enable = &enableMonitor{policy: policy, onReclaim: onReclaim}
+	}
+}
+
+// OptCloseBehavior determines the pwm value that Close leaves the fan in. value is only used
+// by CloseValue and must not be empty for it. If behavior is unknown or value is missing, it is
+// set to the default value. The last of OptCloseBehavior, OptRestoreOnClose, and a non-empty
+// value of OptExitState applies
+//
+// (default: CloseMaxSpeed)
+func OptCloseBehavior(behavior CloseBehavior, value string) Option {
+	return func(dr *Driver) {
+		if behavior < CloseMaxSpeed || behavior > CloseLeave || (behavior == CloseValue && value == "") {
+			behavior, value = CloseMaxSpeed, ""
+		}
+		dr.exit.behavior = behavior
+		dr.exit.value = value
+	}
+}
+
+// OptRestoreOnClose makes Close write back the pwm value found in the device file when the
+// driver was created, rather than the max speed value, followed by the mode found in the
+// pwmN_enable file, if there is one, e.g. to hand the fan back to the firmware's automatic
+// control. It is short for OptCloseBehavior(CloseRestore, "")
+//
+// (default: disabled)
+func OptRestoreOnClose() Option {
+	return OptCloseBehavior(CloseRestore, "")
+}
+
+// OptExitState makes Close write the given pwm value to the device file, as with CloseValue,
+// followed by the given mode to the pwmN_enable file, e.g. "2" for automatic control in most
+// hwmon drivers. An empty value keeps the close behavior, and an empty mode leaves the mode
+// alone unless it is restored. The mode is not written under CloseLeave
+//
+// (default: max speed value and no mode)
+func OptExitState(value, mode string) Option {
+	return func(dr *Driver) {
+		if value != "" {
+			OptCloseBehavior(CloseValue, value)(dr)
+		}
+		dr.exit.mode = mode
+	}
+}
+
+// OptWriteVerification reads back every value written to the device file and writes it again
+// with backoff if the fan controller did not accept it, as configured by v. Invalid values of v
+// are set to their defaults. If v.OnFailure is nil, verification is disabled
+//
+// (default: disabled)
+func OptWriteVerification(v WriteVerification) Option {
+	return func(dr *Driver) {
+		if v.OnFailure == nil {
+			dr.verifier = nil
+			return
+		}
+		if v.Retries <= 0 {
+			v.Retries = 3
+		}
+		if v.Backoff <= 0 {
+			v.Backoff = 10 * time.Millisecond
+		}
+		if v.Tolerance < 0 {
+			v.Tolerance = 0
+		}
+		if v.FailAfter <= 0 {
+			v.FailAfter = 1
+		}
+		dr.verifier = &writeVerifier{WriteVerification: v}
+	}
+}
@@ -0,0 +1,116 @@
+package fanpwm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// OutputMode is the kind of signal that the hwmon chip drives a fan with, as found in the
+// pwmN_mode file of its pwm channel
+type OutputMode int
+
+const (
+	// OutputUnchanged leaves the pwmN_mode file alone
+	OutputUnchanged OutputMode = iota
+	// OutputDC drives the fan by varying its voltage, which is mode "0"
+	OutputDC
+	// OutputPWM drives the fan with a pwm signal, which is mode "1"
+	OutputPWM
+)
+
+// String returns the name of the output mode
+func (m OutputMode) String() string {
+	switch m {
+	case OutputUnchanged:
+		return "unchanged"
+	case OutputDC:
+		return "dc"
+	case OutputPWM:
+		return "pwm"
+	default:
+		return fmt.Sprintf("OutputMode(%d)", int(m))
+	}
+}
+
+// HardwareOutput configures the signal that the hwmon chip drives a fan with, through the
+// pwmN_freq and pwmN_mode files of its pwm channel, which not every chip exposes
+type HardwareOutput struct {
+	// Frequency is the frequency of the hardware pwm signal in Hz, which is written to the
+	// pwmN_freq file unless it is zero
+	Frequency int
+	// Mode is written to the pwmN_mode file unless it is OutputUnchanged
+	Mode OutputMode
+}
+
+// hardwareOutput sets the hardware output of the driver's pwm channel and records the original
+// settings, which are restored when the driver is closed
+type hardwareOutput struct {
+	HardwareOutput
+	originalFreq string
+	originalMode string
+}
+
+// apply records the current frequency and mode of the given pwm file's channel and sets those
+// that are configured. The mode is set first, since the frequency only applies to pwm signals.
+// If setting the frequency fails, the original mode is restored
+func (out *hardwareOutput) apply(pwmFilename string) error {
+
+	if out.Mode != OutputUnchanged {
+		mode, err := readValue(pwmFilename + "_mode")
+		if err != nil {
+			return fmt.Errorf("reading original pwm mode: %w", err)
+		}
+		if err := writeExisting(pwmFilename+"_mode", out.modeValue()); err != nil {
+			return fmt.Errorf("writing pwm mode '%s': %w", out.modeValue(), err)
+		}
+		out.originalMode = mode
+	}
+	if out.Frequency != 0 {
+		freq, err := readValue(pwmFilename + "_freq")
+		if err == nil {
+			err = writeExisting(pwmFilename+"_freq", strconv.Itoa(out.Frequency))
+		}
+		if err != nil {
+			if out.originalMode != "" {
+				_ = writeExisting(pwmFilename+"_mode", out.originalMode)
+			}
+			return fmt.Errorf("setting pwm frequency: %w", err)
+		}
+		out.originalFreq = freq
+	}
+	return nil
+}
+
+// restore writes back the original frequency and mode of the given pwm file's channel
+func (out *hardwareOutput) restore(pwmFilename string) error {
+	if out.originalFreq != "" {
+		if err := writeExisting(pwmFilename+"_freq", out.originalFreq); err != nil {
+			return fmt.Errorf("restoring pwm frequency '%s': %w", out.originalFreq, err)
+		}
+	}
+	if out.originalMode != "" {
+		if err := writeExisting(pwmFilename+"_mode", out.originalMode); err != nil {
+			return fmt.Errorf("restoring pwm mode '%s': %w", out.originalMode, err)
+		}
+	}
+	return nil
+}
+
+// modeValue returns the value of the pwmN_mode file that selects the configured mode
+func (out *hardwareOutput) modeValue() string {
+	if out.Mode == OutputDC {
+		return "0"
+	}
+	return "1"
+}
+
+// readValue returns the trimmed contents of the given file
+func readValue(filename string) (string, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,89 @@
+package fanpwm
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestOptHardwareOutput(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		out      HardwareOutput
+		expected *hardwareOutput
+	}{
+		{out: HardwareOutput{}, expected: nil},
+		{out: HardwareOutput{Frequency: -1, Mode: OutputMode(7)}, expected: nil},
+		{out: HardwareOutput{Frequency: 25000}, expected: &hardwareOutput{HardwareOutput: HardwareOutput{Frequency: 25000}}},
+		{out: HardwareOutput{Mode: OutputDC}, expected: &hardwareOutput{HardwareOutput: HardwareOutput{Mode: OutputDC}}},
+	}
+
+	for _, tc := range testCases {
+		dr := &Driver{output: &hardwareOutput{}}
+		OptHardwareOutput(tc.out)(dr)
+		if (dr.output == nil) != (tc.expected == nil) || (dr.output != nil && *dr.output != *tc.expected) {
+			t.Errorf("%+v: unexpected hardware output\nwant: %+v\n got: %+v", tc.out, tc.expected, dr.output)
+		}
+	}
+}
+
+func TestDriver_hardwareOutput(t *testing.T) {
+	t.Parallel()
+
+	tmpFile, cleanup := temporaryFile(t)
+	defer cleanup()
+	freqFilename, modeFilename := tmpFile.Name()+"_freq", tmpFile.Name()+"_mode"
+	for filename, val := range map[string]string{freqFilename: "25000\n", modeFilename: "0\n"} {
+		if err := ioutil.WriteFile(filename, []byte(val), 0600); err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(filename)
+	}
+
+	dr, err := New(tmpFile.Name(), OptHardwareOutput(HardwareOutput{Frequency: 22500, Mode: OutputPWM}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if freq := readMode(t, freqFilename); freq != "22500" {
+		t.Errorf("unexpected pwm frequency\nwant: %q\n got: %q", "22500", freq)
+	}
+	if mode := readMode(t, modeFilename); mode != "1" {
+		t.Errorf("unexpected pwm mode\nwant: %q\n got: %q", "1", mode)
+	}
+
+	if err := dr.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if freq := readMode(t, freqFilename); freq != "25000" {
+		t.Errorf("unexpected pwm frequency after close\nwant: %q\n got: %q", "25000", freq)
+	}
+	if mode := readMode(t, modeFilename); mode != "0" {
+		t.Errorf("unexpected pwm mode after close\nwant: %q\n got: %q", "0", mode)
+	}
+}
+
+func TestNew_hardwareOutput_missingFile(t *testing.T) {
+	t.Parallel()
+
+	tmpFile, cleanup := temporaryFile(t)
+	defer cleanup()
+	modeFilename := tmpFile.Name() + "_mode"
+	if err := ioutil.WriteFile(modeFilename, []byte("1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(modeFilename)
+
+	// there is no pwmN_freq file
+	_, err := New(tmpFile.Name(), OptHardwareOutput(HardwareOutput{Frequency: 22500, Mode: OutputDC}))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", os.ErrNotExist, err)
+	}
+	if mode := readMode(t, modeFilename); mode != "1" {
+		t.Errorf("expected the original pwm mode to be restored\nwant: %q\n got: %q", "1", mode)
+	}
+	if _, err := os.Stat(tmpFile.Name() + "_freq"); !os.IsNotExist(err) {
+		t.Errorf("expected no pwm frequency file to be created, got: %v", err)
+	}
+}
@@ -0,0 +1,34 @@
+package fanpwm
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ErrNotInvertible is returned by New if the polarity is inverted but a speed value is not an
+// integer in the range [0, MaxSpeed], which has no inverted counterpart
+var ErrNotInvertible = errors.New("speed value cannot be inverted")
+
+// invertPolarity replaces the min and max speed values with the values that spin a fan of
+// inverted polarity at the same speeds, e.g. 255 for a min speed value of 0
+func (dr *Driver) invertPolarity() error {
+	minVal, err := invertSpeedValue(dr.minSpeedVal)
+	if err != nil {
+		return err
+	}
+	maxVal, err := invertSpeedValue(dr.maxSpeedVal)
+	if err != nil {
+		return err
+	}
+	dr.minSpeedVal, dr.maxSpeedVal = minVal, maxVal
+	return nil
+}
+
+func invertSpeedValue(val string) (string, error) {
+	speed, err := strconv.Atoi(val)
+	if err != nil || speed < 0 || speed > MaxSpeed {
+		return "", fmt.Errorf("%w: '%s'", ErrNotInvertible, val)
+	}
+	return strconv.Itoa(MaxSpeed - speed), nil
+}
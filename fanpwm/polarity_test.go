@@ -0,0 +1,71 @@
+package fanpwm
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+func TestDriver_invertedPolarity(t *testing.T) {
+	t.Parallel()
+
+	tmpFile, cleanup := temporaryFile(t)
+	defer cleanup()
+
+	dr, err := New(tmpFile.Name(), OptInvertedPolarity(), OptMinSpeed(30), OptMaxSpeed(200))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	readBack := func() string {
+		data, err := ioutil.ReadFile(tmpFile.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	testCases := []struct {
+		dcRatio  float64
+		expected string
+	}{
+		{dcRatio: 1.0, expected: "55"},
+		{dcRatio: 0.0, expected: "225"},
+	}
+	for _, tc := range testCases {
+		if err := dr.SetDutyCycle(tc.dcRatio); err != nil {
+			t.Fatalf("unexpected error setting duty cycle %v: %v", tc.dcRatio, err)
+		}
+		if actual := readBack(); actual != tc.expected {
+			t.Errorf("duty cycle %v: unexpected pwm value\nwant: %q\n got: %q", tc.dcRatio, tc.expected, actual)
+		}
+	}
+
+	if err := dr.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "55", readBack(); actual != expected {
+		t.Errorf("unexpected pwm value after close\nwant: %q\n got: %q", expected, actual)
+	}
+}
+
+func TestNew_invertedPolarity_notInvertible(t *testing.T) {
+	t.Parallel()
+
+	tmpFile, cleanup := temporaryFile(t)
+	defer cleanup()
+
+	_, err := New(tmpFile.Name(), OptInvertedPolarity(), OptMaxSpeedValue("full"))
+	if !errors.Is(err, ErrNotInvertible) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", ErrNotInvertible, err)
+	}
+
+	// the device file must have been released
+	dr, err := New(tmpFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dr.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
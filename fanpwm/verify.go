@@ -0,0 +1,86 @@
+package fanpwm
+
+import (
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// WriteVerification configures reading back every value written to the device file to verify
+// that the fan controller accepted it, since some Super I/O chips silently ignore writes. A
+// value that does not read back is written again up to Retries times, waiting Backoff before
+// the first retry and twice as long before every further one. Zero values of Retries, Backoff,
+// and FailAfter select their defaults
+type WriteVerification struct {
+	// Retries is the number of times a value is written again if it did not read back
+	// (default: 3)
+	Retries int
+	// Backoff is the wait before the first retry (default: 10ms)
+	Backoff time.Duration
+	// Tolerance is how much integer values read back may differ from the written ones
+	Tolerance int
+	// FailAfter is the number of consecutive writes that did not read back after all retries
+	// at which OnFailure is called (default: 1)
+	FailAfter int
+	// OnFailure is called once every time FailAfter consecutive writes failed verification
+	OnFailure func(WriteFailure)
+}
+
+// WriteFailure describes writes to the device file that the fan controller did not accept
+type WriteFailure struct {
+	// Driver is the name of the driver
+	Driver string
+	// Filename is the PWM device file
+	Filename string
+	// Expected is the value that was written
+	Expected string
+	// Actual is the value that was read back after the last retry
+	Actual string
+	// Failures is the number of consecutive writes that failed verification
+	Failures int
+}
+
+// writeVerifier holds the state of write verification
+type writeVerifier struct {
+	WriteVerification
+	failures int
+}
+
+// verify reads back the value just written to the device file and writes it again as long as it
+// does not match and retries are left. It must be called with wrMutex held. If the value did not
+// read back in the end, and FailAfter consecutive writes failed, it returns the failure to report.
+// Read errors count as mismatches, while write errors are returned as they are
+func (dr *Driver) verify(val string) (failure *WriteFailure, err error) {
+
+	v := dr.verifier
+	backoff := v.Backoff
+	actual := ""
+	for attempt := 0; ; attempt++ {
+		data, readErr := ioutil.ReadFile(dr.filename)
+		actual = strings.TrimSpace(string(data))
+		if readErr == nil && valuesMatch(val, actual, v.Tolerance) {
+			v.failures = 0
+			return nil, nil
+		}
+		if attempt == v.Retries {
+			break
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+		if err := dr.writeOnce(val); err != nil {
+			return nil, err
+		}
+	}
+
+	v.failures++
+	if v.failures != v.FailAfter {
+		return nil, nil
+	}
+	return &WriteFailure{
+		Driver:   dr.name,
+		Filename: dr.filename,
+		Expected: val,
+		Actual:   actual,
+		Failures: v.failures,
+	}, nil
+}
@@ -0,0 +1,93 @@
+package fanpwm
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+)
+
+func TestOptWriteVerification(t *testing.T) {
+	t.Parallel()
+
+	dr := &Driver{verifier: &writeVerifier{}}
+	OptWriteVerification(WriteVerification{Retries: 5})(dr)
+	if dr.verifier != nil {
+		t.Fatalf("expected a nil callback to disable verification, got: %+v", dr.verifier)
+	}
+
+	OptWriteVerification(WriteVerification{Tolerance: -1, OnFailure: func(WriteFailure) {}})(dr)
+	v := dr.verifier.WriteVerification
+	if v.Retries != 3 || v.Backoff != 10*time.Millisecond || v.Tolerance != 0 || v.FailAfter != 1 {
+		t.Fatalf("expected defaults, got: %+v", v)
+	}
+}
+
+func TestDriver_write_verified(t *testing.T) {
+	t.Parallel()
+
+	tmpFile, cleanup := temporaryFile(t)
+	defer cleanup()
+
+	var failures []WriteFailure
+	driver, err := New(tmpFile.Name(), OptWriteVerification(WriteVerification{
+		Backoff:   time.Millisecond,
+		OnFailure: func(f WriteFailure) { failures = append(failures, f) },
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer driver.Close()
+
+	if err := driver.SetDutyCycle(1); err != nil {
+		t.Fatal(err)
+	}
+	if failures != nil {
+		t.Fatalf("expected accepted writes to pass verification, got: %+v", failures)
+	}
+}
+
+func TestDriver_write_ignored(t *testing.T) {
+	t.Parallel()
+
+	tmpFile, cleanup := temporaryFile(t)
+	defer cleanup()
+	// the writes go to a fake file, so the device file keeps reading back this value
+	if err := ioutil.WriteFile(tmpFile.Name(), []byte("9\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var failures []WriteFailure
+	driver, err := New(tmpFile.Name(), OptWriteVerification(WriteVerification{
+		Retries:   2,
+		Backoff:   time.Millisecond,
+		FailAfter: 2,
+		OnFailure: func(f WriteFailure) { failures = append(failures, f) },
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	devFile := new(fakeFile)
+	driver.devFile = devFile
+	defer driver.Close()
+
+	// writes the min speed value first, then the max speed value
+	if err := driver.SetDutyCycle(1); err != nil {
+		t.Fatalf("expected ignored writes not to fail, got: %v", err)
+	}
+
+	expected := []WriteFailure{{
+		Driver:   tmpFile.Name(),
+		Filename: tmpFile.Name(),
+		Expected: "255",
+		Actual:   "9",
+		Failures: 2,
+	}}
+	if diff := deep.Equal(failures, expected); diff != nil {
+		t.Error(diff)
+	}
+	if numWrites := len(devFile.actualWrites); numWrites != 6 {
+		t.Errorf("expected every write to be retried twice, got %d writes", numWrites)
+	}
+}
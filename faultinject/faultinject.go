@@ -0,0 +1,144 @@
+// Package faultinject provides wrappers for heatsink.ThermoSensor and heatsink.FanDriver that
+// inject failures and delays in a controlled way. It is meant for chaos testing, i.e. verifying
+// that alerting and failsafe settings work end-to-end, and must not be used in production
+package faultinject
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/malkhamis/heatsink"
+)
+
+// compile-time check for interface implementation and dependency inversion
+var (
+	_ heatsink.ThermoSensor = (*Sensor)(nil)
+	_ heatsink.FanDriver    = (*Fan)(nil)
+)
+
+// Sentinel errors that are wrapped and returned by this package
+var (
+	ErrInjected = errors.New("injected fault")
+)
+
+// Sensor is a thermal sensor that injects faults into the temperature readings of the sensor
+// it wraps. Instances of this type are safe for concurrent use if the wrapped sensor is
+type Sensor struct {
+	heatsink.ThermoSensor
+	faults *injector
+}
+
+// NewSensor returns a sensor that wraps the given one and injects faults according to the
+// given options. Without options, no faults are injected. For details about options and
+// defaults, see the documentation for type 'Option'
+func NewSensor(sensor heatsink.ThermoSensor, options ...Option) *Sensor {
+	return &Sensor{
+		ThermoSensor: sensor,
+		faults:       newInjector(options...),
+	}
+}
+
+// Temperature returns the temperature reading of the wrapped sensor, unless a fault is
+// injected, in which case an error wrapping ErrInjected is returned
+func (s *Sensor) Temperature() (float64, error) {
+	if err := s.faults.inject(); err != nil {
+		return 0, fmt.Errorf("sensor '%s': %w", s.Name(), err)
+	}
+	return s.ThermoSensor.Temperature()
+}
+
+// Fan is a fan driver that injects faults into the duty cycle writes of the driver it wraps.
+// Instances of this type are safe for concurrent use if the wrapped driver is
+type Fan struct {
+	heatsink.FanDriver
+	faults *injector
+}
+
+// NewFan returns a fan driver that wraps the given one and injects faults according to the
+// given options. Without options, no faults are injected. For details about options and
+// defaults, see the documentation for type 'Option'
+func NewFan(fan heatsink.FanDriver, options ...Option) *Fan {
+	return &Fan{
+		FanDriver: fan,
+		faults:    newInjector(options...),
+	}
+}
+
+// SetDutyCycle passes the given duty cycle to the wrapped driver, unless a fault is injected,
+// in which case the wrapped driver is not called and an error wrapping ErrInjected is returned
+func (f *Fan) SetDutyCycle(dcRatio float64) error {
+	if err := f.faults.inject(); err != nil {
+		return fmt.Errorf("fan '%s': %w", f.Name(), err)
+	}
+	return f.FanDriver.SetDutyCycle(dcRatio)
+}
+
+// SelfTest passes the self-test on to the wrapped driver, or returns heatsink.ErrNoSelfTest if
+// it is not a heatsink.SelfTester
+func (f *Fan) SelfTest() error {
+	if tester, ok := f.FanDriver.(heatsink.SelfTester); ok {
+		return tester.SelfTest()
+	}
+	return heatsink.ErrNoSelfTest
+}
+
+// injector decides whether a call fails and how long it is delayed
+type injector struct {
+	errRate        float64
+	failEvery      int
+	outageAfter    time.Duration
+	outageDuration time.Duration
+	delay          time.Duration
+	seed           int64
+	now            func() time.Time
+
+	mutex sync.Mutex
+	rand  *rand.Rand
+	start time.Time
+	calls int
+}
+
+func newInjector(options ...Option) *injector {
+	inj := &injector{
+		seed: 1,
+		now:  time.Now,
+	}
+	for _, applyOption := range options {
+		applyOption(inj)
+	}
+	inj.rand = rand.New(rand.NewSource(inj.seed))
+	inj.start = inj.now()
+	return inj
+}
+
+// inject delays the caller if configured to do so and returns an error wrapping ErrInjected
+// if the current call is meant to fail
+func (inj *injector) inject() error {
+
+	inj.mutex.Lock()
+	inj.calls++
+	call := inj.calls
+	elapsed := inj.now().Sub(inj.start)
+
+	var fault string
+	switch {
+	case inj.failEvery > 0 && call%inj.failEvery == 0:
+		fault = "scheduled failure"
+	case inj.outageDuration > 0 && elapsed >= inj.outageAfter && elapsed < inj.outageAfter+inj.outageDuration:
+		fault = "outage"
+	case inj.errRate > 0 && inj.rand.Float64() < inj.errRate:
+		fault = "random failure"
+	}
+	inj.mutex.Unlock()
+
+	if inj.delay > 0 {
+		time.Sleep(inj.delay)
+	}
+	if fault != "" {
+		return fmt.Errorf("%w: %s on call %d", ErrInjected, fault, call)
+	}
+	return nil
+}
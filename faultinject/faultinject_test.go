@@ -0,0 +1,175 @@
+package faultinject
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/malkhamis/heatsink"
+	"github.com/malkhamis/heatsink/heatsinktest"
+)
+
+func TestSensor_noFaults(t *testing.T) {
+
+	sensor := NewSensor(&heatsinktest.FakeThermoSensor{TemperatureVals: []float64{42}})
+	for range make([]struct{}, 100) {
+		temp, err := sensor.Temperature()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if temp != 42 {
+			t.Fatalf("unexpected temperature\nwant: %v\n got: %v", 42.0, temp)
+		}
+	}
+}
+
+func TestSensor_passesThrough(t *testing.T) {
+
+	wrapped := &heatsinktest.FakeThermoSensor{SensorName: "fake"}
+	sensor := NewSensor(wrapped)
+	if expected, actual := "fake", sensor.Name(); actual != expected {
+		t.Errorf("unexpected name\nwant: %s\n got: %s", expected, actual)
+	}
+	if err := sensor.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if numCloseCalls := wrapped.NumCloseCalls(); numCloseCalls != 1 {
+		t.Errorf("expected the wrapped sensor to be closed once, got: %d", numCloseCalls)
+	}
+}
+
+func TestSensor_failEvery(t *testing.T) {
+
+	sensor := NewSensor(&heatsinktest.FakeThermoSensor{}, OptFailEvery(3))
+
+	var actual []bool
+	for range make([]struct{}, 6) {
+		_, err := sensor.Temperature()
+		actual = append(actual, errors.Is(err, ErrInjected))
+	}
+
+	expected := []bool{false, false, true, false, false, true}
+	if diff := deep.Equal(actual, expected); diff != nil {
+		t.Fatal(diff)
+	}
+}
+
+func TestSensor_outage(t *testing.T) {
+
+	clock := heatsinktest.NewFakeClock(time.Unix(0, 0))
+	now, advance := clock.Now, clock.Advance
+	sensor := NewSensor(
+		&heatsinktest.FakeThermoSensor{},
+		OptOutage(time.Minute, time.Minute),
+		func(inj *injector) { inj.now = now },
+	)
+
+	var actual []bool
+	for range make([]struct{}, 4) {
+		_, err := sensor.Temperature()
+		actual = append(actual, errors.Is(err, ErrInjected))
+		advance(40 * time.Second)
+	}
+
+	expected := []bool{false, false, true, false}
+	if diff := deep.Equal(actual, expected); diff != nil {
+		t.Fatal(diff)
+	}
+}
+
+func TestSensor_errorRate(t *testing.T) {
+
+	testCases := []struct {
+		name     string
+		rate     float64
+		expected int
+	}{
+		{"never", -1, 0},
+		{"always", 2, 100},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			sensor := NewSensor(&heatsinktest.FakeThermoSensor{}, OptErrorRate(tc.rate))
+			failures := 0
+			for range make([]struct{}, 100) {
+				if _, err := sensor.Temperature(); errors.Is(err, ErrInjected) {
+					failures++
+				}
+			}
+			if failures != tc.expected {
+				t.Fatalf("unexpected failure count\nwant: %d\n got: %d", tc.expected, failures)
+			}
+		})
+	}
+}
+
+func TestSensor_errorRate_reproducible(t *testing.T) {
+
+	failures := func() (failed []bool) {
+		sensor := NewSensor(&heatsinktest.FakeThermoSensor{}, OptErrorRate(0.5), OptSeed(7))
+		for range make([]struct{}, 50) {
+			_, err := sensor.Temperature()
+			failed = append(failed, err != nil)
+		}
+		return failed
+	}
+
+	if diff := deep.Equal(failures(), failures()); diff != nil {
+		t.Fatalf("expected the same seed to produce the same failures: %v", diff)
+	}
+}
+
+func TestSensor_delay(t *testing.T) {
+
+	sensor := NewSensor(&heatsinktest.FakeThermoSensor{}, OptDelay(20*time.Millisecond))
+
+	start := time.Now()
+	if _, err := sensor.Temperature(); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Fatalf("expected the reading to be delayed by at least 20ms, got: %s", elapsed)
+	}
+}
+
+func TestFan_failEvery(t *testing.T) {
+
+	wrapped := &heatsinktest.FakeFanDriver{}
+	fan := NewFan(wrapped, OptFailEvery(2))
+
+	for i, dc := range []float64{0.1, 0.2, 0.3, 0.4} {
+		err := fan.SetDutyCycle(dc)
+		if failed := errors.Is(err, ErrInjected); failed != (i%2 == 1) {
+			t.Fatalf("unexpected error on call %d: %v", i+1, err)
+		}
+	}
+
+	expected := []float64{0.1, 0.3}
+	if diff := deep.Equal(wrapped.DutyCycles(), expected); diff != nil {
+		t.Fatalf("expected failed writes to not reach the wrapped driver: %v", diff)
+	}
+}
+
+// selfTestingFan is a fake fan driver that implements heatsink.SelfTester
+type selfTestingFan struct {
+	heatsinktest.FakeFanDriver
+	err error
+}
+
+func (f *selfTestingFan) SelfTest() error {
+	return f.err
+}
+
+func TestFan_SelfTest(t *testing.T) {
+
+	if err := NewFan(&heatsinktest.FakeFanDriver{}).SelfTest(); !errors.Is(err, heatsink.ErrNoSelfTest) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", heatsink.ErrNoSelfTest, err)
+	}
+	simErr := errors.New("simulated error")
+	if err := NewFan(&selfTestingFan{err: simErr}).SelfTest(); !errors.Is(err, simErr) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", simErr, err)
+	}
+}
@@ -0,0 +1,65 @@
+package faultinject
+
+import (
+	"math"
+	"time"
+)
+
+// Option is used to pass optional parameters to the NewSensor and NewFan factory functions
+type Option func(*injector)
+
+// OptErrorRate sets the probability in [0,1] that any given call fails. Values outside that
+// range are clamped
+//
+// (default: 0)
+func OptErrorRate(probability float64) Option {
+	return func(inj *injector) {
+		inj.errRate = math.Max(0, math.Min(1, probability))
+	}
+}
+
+// OptFailEvery makes every n-th call fail. If n is less than one, it is set to the default
+//
+// (default: 0, i.e. disabled)
+func OptFailEvery(n int) Option {
+	return func(inj *injector) {
+		if n > 0 {
+			inj.failEvery = n
+		}
+	}
+}
+
+// OptOutage makes all calls fail for the given duration, starting after the given time has
+// elapsed since the wrapper was created. If duration is not positive, it is set to the default
+//
+// (default: 0, i.e. disabled)
+func OptOutage(after, duration time.Duration) Option {
+	return func(inj *injector) {
+		if duration > 0 {
+			inj.outageAfter = after
+			inj.outageDuration = duration
+		}
+	}
+}
+
+// OptDelay delays every call, failed or not, by the given duration. If delay is not positive,
+// it is set to the default
+//
+// (default: 0)
+func OptDelay(delay time.Duration) Option {
+	return func(inj *injector) {
+		if delay > 0 {
+			inj.delay = delay
+		}
+	}
+}
+
+// OptSeed sets the seed of the random source used for OptErrorRate, making the sequence of
+// random failures reproducible
+//
+// (default: 1)
+func OptSeed(seed int64) Option {
+	return func(inj *injector) {
+		inj.seed = seed
+	}
+}
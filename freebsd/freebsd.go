@@ -0,0 +1,206 @@
+// Package freebsd provides implementations of the heatsink.ThermoSensor and heatsink.FanDriver
+// interfaces for FreeBSD. Sensors read temperature sysctls, such as those of acpi_thermal(4)
+// and coretemp(4), and fans are driven through pwm(9) channels by way of the pwm(8) tool.
+// Driving fans requires root privileges
+package freebsd
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/malkhamis/heatsink"
+)
+
+// compile-time check for interface implementation and dependency inversion
+var (
+	_ heatsink.ThermoSensor = (*Sensor)(nil)
+	_ heatsink.FanDriver    = (*Fan)(nil)
+)
+
+// Sentinel errors that are wrapped and returned by this package
+var (
+	ErrUnsupported      = errors.New("only supported on FreeBSD")
+	ErrBadSysctlName    = errors.New("invalid sysctl name")
+	ErrBadSensorOutput  = errors.New("sysctl value is not a temperature")
+	ErrBadPWMPeriod     = errors.New("pwm period must be at least one nanosecond")
+	ErrPWMDeviceMissing = errors.New("pwm device name is empty")
+)
+
+// runFunc runs the given command with the given arguments and returns its output
+type runFunc func(command string, args ...string) (string, error)
+
+// settings holds the optional parameters of sensors and fans
+type settings struct {
+	name   string
+	period time.Duration
+}
+
+func newSettings(name string, options []Option) settings {
+	s := settings{name: name, period: 40 * time.Microsecond}
+	for _, applyOption := range options {
+		if applyOption == nil {
+			continue
+		}
+		applyOption(&s)
+	}
+	return s
+}
+
+// Sensor reads temperatures from a sysctl, e.g. 'hw.acpi.thermal.tz0.temperature' or
+// 'dev.cpu.0.temperature'. Instances of this type are safe for concurrent use
+type Sensor struct {
+	name   string
+	sysctl string
+	run    runFunc
+	mutex  sync.Mutex
+	closed bool
+}
+
+// NewSensor returns a new thermal sensor for the given sysctl, which is read once to verify
+// that it reports a temperature. For details about options and defaults, see the documentation
+// for type 'Option'
+func NewSensor(sysctl string, options ...Option) (*Sensor, error) {
+	return newSensor(sysctl, run, options...)
+}
+
+func newSensor(sysctl string, run runFunc, options ...Option) (*Sensor, error) {
+
+	if sysctl == "" || strings.ContainsAny(sysctl, " \t\n=") {
+		return nil, fmt.Errorf("%w: '%s'", ErrBadSysctlName, sysctl)
+	}
+	sensor := &Sensor{name: newSettings(sysctl, options).name, sysctl: sysctl, run: run}
+	if _, err := sensor.read(); err != nil {
+		return nil, err
+	}
+	return sensor, nil
+}
+
+// read returns the temperature reported by the sysctl. Temperature sysctls are stored in
+// tenths of a kelvin and are formatted by sysctl(8) in degrees celsius, e.g. '45.0C'
+func (s *Sensor) read() (float64, error) {
+	output, err := s.run("sysctl", "-n", s.sysctl)
+	if err != nil {
+		return math.Inf(1), fmt.Errorf("'%s': %w", s.sysctl, err)
+	}
+	trimmed := strings.TrimSpace(output)
+	if !strings.HasSuffix(trimmed, "C") {
+		return math.Inf(1), fmt.Errorf("%w: '%s' is '%s'", ErrBadSensorOutput, s.sysctl, trimmed)
+	}
+	temp, err := strconv.ParseFloat(strings.TrimSuffix(trimmed, "C"), 64)
+	if err != nil {
+		return math.Inf(1), fmt.Errorf("%w: '%s' is '%s'", ErrBadSensorOutput, s.sysctl, trimmed)
+	}
+	return temp, nil
+}
+
+// Temperature returns the current temperature in degrees celsius as well as any error
+// encountered. If the sensor is closed, it returns heatsink.ErrThermoSensorClosed
+func (s *Sensor) Temperature() (float64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return math.Inf(1), heatsink.ErrThermoSensorClosed
+	}
+	return s.read()
+}
+
+// Close closes this sensor. If the sensor was previously closed, it returns
+// heatsink.ErrThermoSensorClosed
+func (s *Sensor) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return heatsink.ErrThermoSensorClosed
+	}
+	s.closed = true
+	return nil
+}
+
+// Name returns the name of this sensor
+func (s *Sensor) Name() string {
+	return s.name
+}
+
+// Fan drives a fan through a pwm(9) channel, e.g. '/dev/pwm/pwmc0.0', by setting the channel's
+// duty cycle as a fraction of its period. Instances of this type are safe for concurrent use
+type Fan struct {
+	name   string
+	device string
+	period time.Duration
+	run    runFunc
+	mutex  sync.Mutex
+	closed bool
+}
+
+// NewFan returns a fan driver for the given pwm channel. The channel is queried once to verify
+// that it exists. For details about options and defaults, see the documentation for type
+// 'Option'
+func NewFan(device string, options ...Option) (*Fan, error) {
+	return newFan(device, run, options...)
+}
+
+func newFan(device string, run runFunc, options ...Option) (*Fan, error) {
+
+	if device == "" {
+		return nil, ErrPWMDeviceMissing
+	}
+	s := newSettings(device, options)
+	if s.period < time.Nanosecond {
+		return nil, fmt.Errorf("%w: %v", ErrBadPWMPeriod, s.period)
+	}
+	fan := &Fan{name: s.name, device: device, period: s.period, run: run}
+	if _, err := run("pwm", "-f", device, "-S"); err != nil {
+		return nil, fmt.Errorf("'%s': %w", device, err)
+	}
+	return fan, nil
+}
+
+// SetDutyCycle enables the pwm channel with the given duty cycle, which is clamped to
+// [0.0, 1.0]. If the fan driver is closed, it returns heatsink.ErrFanDriverClosed
+func (f *Fan) SetDutyCycle(dcRatio float64) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.closed {
+		return heatsink.ErrFanDriverClosed
+	}
+	return f.set(dcRatio)
+}
+
+func (f *Fan) set(dcRatio float64) error {
+	dcRatio = math.Max(0, math.Min(1, dcRatio))
+	duty := int64(math.Round(dcRatio * float64(f.period.Nanoseconds())))
+	_, err := f.run(
+		"pwm", "-f", f.device, "-E",
+		"-p", strconv.FormatInt(f.period.Nanoseconds(), 10),
+		"-d", strconv.FormatInt(duty, 10),
+	)
+	if err != nil {
+		return fmt.Errorf("'%s': %w", f.device, err)
+	}
+	return nil
+}
+
+// Close sets the fan to its maximum speed so that the hardware remains cooled once the daemon
+// stops. If the fan driver is already closed, it returns heatsink.ErrFanDriverClosed
+func (f *Fan) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.closed {
+		return heatsink.ErrFanDriverClosed
+	}
+	f.closed = true
+	if err := f.set(1); err != nil {
+		return fmt.Errorf("failed to set fan speed to max while closing driver: %w", err)
+	}
+	return nil
+}
+
+// Name returns the name of this fan driver
+func (f *Fan) Name() string {
+	return f.name
+}
@@ -0,0 +1,159 @@
+package freebsd
+
+import (
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/malkhamis/heatsink"
+)
+
+func TestNewSensor_unsupported(t *testing.T) {
+	if runtime.GOOS == "freebsd" {
+		t.Skip("sysctl is supported on freebsd")
+	}
+	_, err := NewSensor("hw.acpi.thermal.tz0.temperature")
+	if !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", ErrUnsupported, err)
+	}
+}
+
+func TestNewSensor_errors(t *testing.T) {
+
+	cases := map[string]struct {
+		sysctl      string
+		output      string
+		runErr      error
+		expectedErr error
+	}{
+		"empty name":      {sysctl: "", expectedErr: ErrBadSysctlName},
+		"assignment":      {sysctl: "hw.acpi.thermal.tz0.temperature=0", expectedErr: ErrBadSysctlName},
+		"not temperature": {sysctl: "hw.ncpu", output: "8\n", expectedErr: ErrBadSensorOutput},
+		"bad value":       {sysctl: "dev.cpu.0.temperature", output: "hotC\n", expectedErr: ErrBadSensorOutput},
+		"run":             {sysctl: "dev.cpu.0.temperature", runErr: ErrUnsupported, expectedErr: ErrUnsupported},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			run := func(string, ...string) (string, error) { return c.output, c.runErr }
+			_, err := newSensor(c.sysctl, run)
+			if !errors.Is(err, c.expectedErr) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", c.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestSensor_lifeCycle(t *testing.T) {
+
+	var commands []string
+	outputs := []string{"27.9C\n", "45.0C\n"}
+	run := func(command string, args ...string) (string, error) {
+		commands = append(commands, command+" "+strings.Join(args, " "))
+		output := outputs[0]
+		outputs = outputs[1:]
+		return output, nil
+	}
+
+	sensor, err := newSensor("hw.acpi.thermal.tz0.temperature", run, nil, OptName("acpi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sensor.Name() != "acpi" {
+		t.Fatalf("unexpected name\nwant: acpi\n got: %s", sensor.Name())
+	}
+	temp, err := sensor.Temperature()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if temp != 45 {
+		t.Fatalf("unexpected temperature\nwant: %v\n got: %v", 45, temp)
+	}
+	expected := []string{
+		"sysctl -n hw.acpi.thermal.tz0.temperature",
+		"sysctl -n hw.acpi.thermal.tz0.temperature",
+	}
+	if diff := deep.Equal(commands, expected); diff != nil {
+		t.Fatal(diff)
+	}
+
+	if err := sensor.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sensor.Temperature(); !errors.Is(err, heatsink.ErrThermoSensorClosed) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", heatsink.ErrThermoSensorClosed, err)
+	}
+	if err := sensor.Close(); !errors.Is(err, heatsink.ErrThermoSensorClosed) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", heatsink.ErrThermoSensorClosed, err)
+	}
+}
+
+func TestNewFan_errors(t *testing.T) {
+
+	cases := map[string]struct {
+		device      string
+		options     []Option
+		runErr      error
+		expectedErr error
+	}{
+		"no device":  {device: "", expectedErr: ErrPWMDeviceMissing},
+		"bad period": {device: "/dev/pwm/pwmc0.0", options: []Option{OptPeriod(0)}, expectedErr: ErrBadPWMPeriod},
+		"run":        {device: "/dev/pwm/pwmc0.0", runErr: ErrUnsupported, expectedErr: ErrUnsupported},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			run := func(string, ...string) (string, error) { return "", c.runErr }
+			_, err := newFan(c.device, run, c.options...)
+			if !errors.Is(err, c.expectedErr) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", c.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestFan_lifeCycle(t *testing.T) {
+
+	var commands []string
+	run := func(command string, args ...string) (string, error) {
+		commands = append(commands, command+" "+strings.Join(args, " "))
+		return "", nil
+	}
+
+	fan, err := newFan("/dev/pwm/pwmc0.1", run, OptPeriod(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fan.Name() != "/dev/pwm/pwmc0.1" {
+		t.Fatalf("unexpected name\nwant: /dev/pwm/pwmc0.1\n got: %s", fan.Name())
+	}
+	for _, dc := range []float64{0.25, -1} {
+		if err := fan.SetDutyCycle(dc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fan.Close(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"pwm -f /dev/pwm/pwmc0.1 -S",
+		"pwm -f /dev/pwm/pwmc0.1 -E -p 1000000 -d 250000",
+		"pwm -f /dev/pwm/pwmc0.1 -E -p 1000000 -d 0",
+		"pwm -f /dev/pwm/pwmc0.1 -E -p 1000000 -d 1000000",
+	}
+	if diff := deep.Equal(commands, expected); diff != nil {
+		t.Fatal(diff)
+	}
+
+	if err := fan.SetDutyCycle(0.5); !errors.Is(err, heatsink.ErrFanDriverClosed) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", heatsink.ErrFanDriverClosed, err)
+	}
+	if err := fan.Close(); !errors.Is(err, heatsink.ErrFanDriverClosed) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", heatsink.ErrFanDriverClosed, err)
+	}
+}
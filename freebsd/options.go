@@ -0,0 +1,27 @@
+package freebsd
+
+import "time"
+
+// Option is used to pass optional parameters to the Sensor and Fan factory functions
+type Option func(*settings)
+
+// OptName sets the name of the sensor or fan. if name is empty, it is set to the default value
+//
+// (default: the sysctl name for sensors and the pwm device for fans)
+func OptName(name string) Option {
+	return func(s *settings) {
+		if name != "" {
+			s.name = name
+		}
+	}
+}
+
+// OptPeriod sets the period of a fan's pwm signal. It has no effect on sensors. Most 4-pin fans
+// expect a 25 kHz signal
+//
+// (default: 40µs)
+func OptPeriod(period time.Duration) Option {
+	return func(s *settings) {
+		s.period = period
+	}
+}
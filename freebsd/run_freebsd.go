@@ -0,0 +1,18 @@
+//go:build freebsd
+// +build freebsd
+
+package freebsd
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+func run(command string, args ...string) (string, error) {
+	output, err := exec.Command(command, args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return string(output), nil
+}
@@ -0,0 +1,8 @@
+//go:build !freebsd
+// +build !freebsd
+
+package freebsd
+
+func run(command string, args ...string) (string, error) {
+	return "", ErrUnsupported
+}
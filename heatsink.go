@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"io"
 	"math"
-	"strings"
 	"sync"
 	"time"
 
@@ -39,14 +38,102 @@ type dutyCycler interface {
 
 // Heatsink represents a physical heatsink package with thermal monitor and control
 type Heatsink struct {
-	name       string
-	sensors    []ThermoSensor
-	fan        FanDriver
-	dcCalc     dutyCycler
-	chkPeriod  time.Duration
-	isStopped  chan struct{}
-	closeMutex sync.Mutex
-	logger     *zap.Logger
+	name        string
+	sensors     []ThermoSensor
+	sensorMutex sync.Mutex
+	ambient     ThermoSensor
+	deltaRange  *deltaRange
+	deltaCalc   dutyCycler
+	response    fanResponse
+	curve       curveParams
+	numWorkers  int
+	quarantine  *quarantine
+	lastGood    *lastGood
+	fan         FanDriver
+	minTemp     float64
+	maxTemp     float64
+	dcCalc      dutyCycler
+	bounds      *dutyCyclerBounded
+	svcLevels   []serviceLevel
+	critTemp    *float64
+	critical    bool
+	auxInputs   []auxInput
+	inputs      []input
+	roc         *rateOfChange
+	schedules   []schedule
+	activeSched string
+	chkPeriod   time.Duration
+	jitter      *jitter
+	adaptive    *adaptivePeriod
+	phaseOffset time.Duration
+	catchUp     bool
+	isStopped   chan struct{}
+	closeMutex  sync.Mutex
+	logger      *zap.Logger
+	logReasons  bool
+	summary     *summary
+	prevDC      float64
+	lastSample  Sample
+	smplMutex   sync.RWMutex
+	overruns    uint64
+	histogram   DutyCycleHistogram
+	onSample    func(Sample)
+	smplFilter  *sampleFilter
+	initDC      *float64
+	manualDC    float64
+	manualSet   bool
+	overrideDC  float64
+	overrideSet bool
+	maxDC       float64
+	maxSet      bool
+	rangeCurve  dutyCycler
+	setPeriod   time.Duration
+	manualMutex sync.RWMutex
+	skipDC      *dutyCycleSkip
+	strict      bool
+	optErrs     MultiError `deep:"-"`
+}
+
+// Sample is a snapshot of the outcome of a single control iteration
+type Sample struct {
+	// Time is when the duty cycle was applied to the fan
+	Time time.Time
+	// Sensor is the name of the hottest sensor
+	Sensor string
+	// Temperature is the temperature the duty cycle was derived from
+	Temperature float64
+	// DutyCycle is the duty cycle ratio that was applied to the fan
+	DutyCycle float64
+	// Readings are the temperatures of the sensors that were read successfully, in the order
+	// the sensors were given, followed by those of the inputs
+	Readings []Reading
+	// Timings is how long each phase of the control iteration took
+	Timings Timings
+	// Critical reports whether the hottest sensor was at or above the critical temperature
+	Critical bool
+	// Quarantined are the names of the sensors whose readings were left out as implausible,
+	// see SensorQuarantine
+	Quarantined []string
+}
+
+// Timings is the duration of each phase of a control iteration
+type Timings struct {
+	// Start is when the iteration started reading the sensors
+	Start time.Time
+	// SensorRead is how long reading all sensors took
+	SensorRead time.Duration
+	// Computation is how long deriving the duty cycle from the temperature took
+	Computation time.Duration
+	// FanWrite is how long applying the duty cycle to the fan took
+	FanWrite time.Duration
+	// Lateness is how long after it was due the iteration started
+	Lateness time.Duration
+}
+
+// Reading is the temperature of a single sensor during a control iteration
+type Reading struct {
+	Sensor      string
+	Temperature float64
 }
 
 // New returns a new heatsink instance. For details about configs, options, and
@@ -54,20 +141,25 @@ type Heatsink struct {
 func New(config *Config, options ...Option) (*Heatsink, error) {
 
 	if config == nil {
-		return nil, errNoConfig
+		return nil, ErrNoConfig
 	}
 	if err := config.validate(); err != nil {
 		return nil, fmt.Errorf("invalid configuration: %w", err)
 	}
 
 	hs := &Heatsink{
-		name:      "heatsink/" + config.Fan.Name(),
-		dcCalc:    newDutyCyclerPowPi(config.MinTemperature, config.MaxTemperature),
-		chkPeriod: 1 * time.Second,
-		fan:       config.Fan,
-		sensors:   append([]ThermoSensor{}, config.Sensors...),
-		isStopped: make(chan struct{}),
-		logger:    zap.NewNop(),
+		name:       "heatsink/" + config.Fan.Name(),
+		dcCalc:     newDutyCyclerPowPi(config.MinTemperature, config.MaxTemperature),
+		chkPeriod:  1 * time.Second,
+		fan:        config.Fan,
+		minTemp:    config.MinTemperature,
+		maxTemp:    config.MaxTemperature,
+		sensors:    append([]ThermoSensor{}, config.Sensors...),
+		numWorkers: 4,
+		isStopped:  make(chan struct{}),
+		logger:     zap.NewNop(),
+		prevDC:     -1, // no duty cycle was set yet
+		skipDC:     &dutyCycleSkip{refresh: time.Minute},
 	}
 	for _, applyOption := range options {
 		if applyOption == nil {
@@ -75,10 +167,55 @@ func New(config *Config, options ...Option) (*Heatsink, error) {
 		}
 		applyOption(config, hs)
 	}
+	// the check period may be given after the jitter, so the two are compared once both are set
+	if hs.jitter != nil && 2*hs.jitter.max >= hs.chkPeriod {
+		hs.invalidOption(
+			"OptCheckPeriodJitter", "duration %v is not less than half the check period %v", hs.jitter.max, hs.chkPeriod,
+		)
+		hs.jitter = nil
+	}
+	if len(hs.optErrs) > 0 && hs.strict {
+		return nil, fmt.Errorf("invalid options: %w", hs.optErrs)
+	}
+	for _, err := range hs.optErrs {
+		hs.logger.Warn("ignoring invalid option value", zap.String("heatsink_name", hs.name), zap.Error(err))
+	}
+	hs.optErrs = nil
+	// boundaries wrap the fan response curves regardless of the order of options
+	if hs.deltaRange != nil && hs.ambient != nil {
+		hs.deltaCalc = hs.newBoundedCurve(hs.deltaRange.min, hs.deltaRange.max)
+	}
+	for i, s := range hs.schedules {
+		if s.MinTemperature != 0 || s.MaxTemperature != 0 {
+			hs.schedules[i].dcCalc = hs.newBoundedCurve(s.MinTemperature, s.MaxTemperature)
+		}
+	}
+	if hs.bounds != nil {
+		hs.bounds.curve = hs.dcCalc
+		hs.dcCalc = hs.bounds
+	}
+	if hs.adaptive != nil {
+		hs.adaptive.current = hs.chkPeriod
+		if hs.adaptive.calmBelow == 0 {
+			hs.adaptive.calmBelow = hs.maxTemp
+		}
+	}
 
 	return hs, nil
 }
 
+// newBoundedCurve returns the fan response curve of this heatsink for the given range, wrapped
+// by the boundaries if any
+func (hs *Heatsink) newBoundedCurve(minTemp, maxTemp float64) dutyCycler {
+	curve := newDutyCycler(hs.response, hs.curve, minTemp, maxTemp)
+	if hs.bounds == nil {
+		return curve
+	}
+	bounded := *hs.bounds
+	bounded.minTemp, bounded.maxTemp, bounded.curve = minTemp, maxTemp, curve
+	return &bounded
+}
+
 // StartThermalControl continuously monitors temperatures and adjusts the heatsink fan. If the
 // heatsink is stopped, it returns ErrControllerStopped. It always returns a non-nil error
 func (hs *Heatsink) StartThermalControl() error {
@@ -102,8 +239,20 @@ func (hs *Heatsink) StartThermalControl() error {
 		zap.String("heatsink_name", hs.name),
 	)
 
+	if hs.initDC != nil {
+		if _, err := hs.setDutyCycle(*hs.initDC, time.Now(), false); err != nil {
+			return fmt.Errorf("setting fan's initial duty cycle: %w", err)
+		}
+		hs.prevDC = *hs.initDC
+	}
+
+	if !hs.waitPhaseOffset() {
+		return ErrControllerStopped
+	}
+
+	deadline := time.Now()
 loop:
-	for ; ; time.Sleep(hs.chkPeriod) {
+	for {
 
 		select {
 		case <-hs.isStopped:
@@ -111,16 +260,69 @@ loop:
 		default:
 		}
 
-		temp, err := hs.maxCoreTemp()
+		timings := Timings{Start: time.Now()}
+		timings.Lateness = timings.Start.Sub(deadline)
+		temp, hottest, readings, err := hs.maxCoreTemp()
+		timings.SensorRead = time.Since(timings.Start)
 		if err != nil {
 			return fmt.Errorf("determining max core temperature: %w", err)
 		}
 
-		dcRatio := hs.dcCalc.ratio(temp)
-		err = hs.fan.SetDutyCycle(dcRatio)
+		why := &reason{sensor: hottest, temperature: temp}
+		absTemp := temp
+		hs.adapt(absTemp, timings.Start)
+		temp, isDelta := hs.deltaT(temp, why)
+		temp = hs.predict(temp, timings.Start, why)
+		sched := hs.activeSchedule(timings.Start)
+		curve := hs.activeCurve()
+		switch {
+		case isDelta && hs.deltaCalc != nil:
+			curve = hs.deltaCalc
+		case sched != nil && sched.dcCalc != nil:
+			why.adjust("used the curve of schedule '%s'", sched.Name)
+			curve = sched.dcCalc
+		}
+		dcRatio := curve.ratio(temp)
+		why.curve = dcRatio
+		dcRatio, readings = hs.applyInputs(dcRatio, readings, why)
+		dcRatio = hs.feedForward(dcRatio, why)
+		dcRatio = hs.relax(dcRatio, timings.Start, why)
+		dcRatio = hs.applyOverrideDutyCycle(dcRatio, why)
+		dcRatio = hs.applyManualDutyCycle(dcRatio, why)
+		dcRatio = hs.applyMaxDutyCycle(dcRatio, why)
+		dcRatio = hs.applyScheduleCap(sched, absTemp, dcRatio, why)
+		// service levels and the critical temperature must remain the last adjustments since
+		// they are the final guardrails
+		unguarded := dcRatio
+		dcRatio = hs.enforceServiceLevels(absTemp, dcRatio, why)
+		dcRatio = hs.enforceCriticalTemperature(absTemp, dcRatio, why)
+		timings.Computation = time.Since(timings.Start) - timings.SensorRead
+
+		fanWriteStart := time.Now()
+		dcRatio, err = hs.setDutyCycle(dcRatio, fanWriteStart, dcRatio != unguarded)
+		timings.FanWrite = time.Since(fanWriteStart)
 		if err != nil {
 			return fmt.Errorf("setting fan's duty cycle: %w", err)
 		}
+		hs.logReason(dcRatio, why)
+		smpl := Sample{
+			Time:        time.Now(),
+			Sensor:      why.sensor,
+			Temperature: temp,
+			DutyCycle:   dcRatio,
+			Readings:    readings,
+			Timings:     timings,
+			Critical:    hs.critical,
+			Quarantined: hs.quarantined(),
+		}
+		hs.recordSample(smpl)
+		hs.logSummary(smpl)
+		hs.emitSample(smpl)
+
+		deadline = hs.nextDeadline(deadline, time.Now())
+		if !hs.sleepUntil(deadline) {
+			break loop
+		}
 	}
 
 	return ErrControllerStopped
@@ -140,17 +342,39 @@ func (hs *Heatsink) StopThermalControl() error {
 		close(hs.isStopped)
 	}
 
-	var errs multiErrs
+	var errs MultiError
 	if err := hs.fan.Close(); err != nil {
 		err = fmt.Errorf("error closing fan: %w", err)
 		errs = append(errs, err)
 	}
+	hs.sensorMutex.Lock()
 	for _, sensor := range hs.sensors {
 		if err := sensor.Close(); err != nil {
 			err = fmt.Errorf("error closing sensor: %w", err)
 			errs = append(errs, err)
 		}
 	}
+	hs.sensorMutex.Unlock()
+	if hs.ambient != nil {
+		if err := hs.ambient.Close(); err != nil {
+			err = fmt.Errorf("error closing ambient sensor: %w", err)
+			errs = append(errs, err)
+		}
+	}
+	for _, aux := range hs.auxInputs {
+		if err := aux.input.Close(); err != nil {
+			err = fmt.Errorf("error closing auxiliary input: %w", err)
+			errs = append(errs, err)
+		}
+	}
+	for _, in := range hs.inputs {
+		for _, sensor := range in.sensors {
+			if err := sensor.Close(); err != nil {
+				err = fmt.Errorf("error closing sensor of input '%s': %w", in.name, err)
+				errs = append(errs, err)
+			}
+		}
+	}
 	if len(errs) > 0 {
 		return errs
 	}
@@ -158,42 +382,286 @@ func (hs *Heatsink) StopThermalControl() error {
 	return nil
 }
 
-func (hs *Heatsink) maxCoreTemp() (max float64, err error) {
+// LastSample returns the outcome of the most recent control iteration. The returned sample has
+// a zero Time if no iteration completed yet. It is safe to call it concurrently with thermal
+// control, e.g. to check that the control loop is alive
+func (hs *Heatsink) LastSample() Sample {
+	hs.smplMutex.RLock()
+	defer hs.smplMutex.RUnlock()
+	return hs.lastSample
+}
+
+// Stopped reports whether thermal control stopped, either because StopThermalControl was
+// called or because the control loop encountered an error
+func (hs *Heatsink) Stopped() bool {
+	select {
+	case <-hs.isStopped:
+		return true
+	default:
+		return false
+	}
+}
+
+func (hs *Heatsink) recordSample(s Sample) {
+	hs.smplMutex.Lock()
+	defer hs.smplMutex.Unlock()
+	if !hs.lastSample.Time.IsZero() {
+		hs.histogram.add(hs.lastSample.DutyCycle, s.Time.Sub(hs.lastSample.Time))
+	}
+	hs.lastSample = s
+}
+
+// Name returns the name of this heatsink
+func (hs *Heatsink) Name() string {
+	return hs.name
+}
+
+// MinTemperature returns the temperature below which the fan spins at the minimum speed
+func (hs *Heatsink) MinTemperature() float64 {
+	return hs.minTemp
+}
+
+// MaxTemperature returns the temperature above which the fan spins at the maximum speed
+func (hs *Heatsink) MaxTemperature() float64 {
+	return hs.maxTemp
+}
+
+// CriticalTemperature returns the temperature at and above which the fan spins at full speed
+// regardless of any other adjustment, and whether one was set
+func (hs *Heatsink) CriticalTemperature() (float64, bool) {
+	if hs.critTemp == nil {
+		return 0, false
+	}
+	return *hs.critTemp, true
+}
+
+// CheckPeriod returns the current interval between the starts of temperature checks, which
+// is the configured one unless adaptive polling lengthened it. It is safe to call it
+// concurrently with thermal control
+func (hs *Heatsink) CheckPeriod() time.Duration {
+	hs.smplMutex.RLock()
+	defer hs.smplMutex.RUnlock()
+	return hs.period()
+}
+
+// SensorNames returns the names of the sensors whose temperatures are monitored, in the same
+// order they were given in the config followed by those added since. It does not include the
+// ambient sensor, if any, or the sensors of inputs
+func (hs *Heatsink) SensorNames() []string {
+	hs.sensorMutex.Lock()
+	defer hs.sensorMutex.Unlock()
+	names := make([]string, len(hs.sensors))
+	for i, sensor := range hs.sensors {
+		names[i] = sensor.Name()
+	}
+	return names
+}
+
+func (hs *Heatsink) maxCoreTemp() (max float64, hottest string, readings []Reading, err error) {
+	hs.sensorMutex.Lock()
+	defer hs.sensorMutex.Unlock()
+	return hs.pickHottest(hs.sensors, hs.screen(hs.reuseLastGood(hs.readSensors(hs.sensors))))
+}
+
+// hottest reads the given sensors and returns the temperature and name of the hottest one along
+// with all successful readings. Failed sensors are logged unless all of them fail
+func (hs *Heatsink) hottest(sensors []ThermoSensor) (max float64, hottest string, readings []Reading, err error) {
+	return hs.pickHottest(sensors, hs.readSensors(sensors))
+}
+
+// pickHottest returns the temperature and name of the hottest of the given sensors from their
+// given results along with all successful readings. Quarantined sensors are left out silently
+// and failed sensors are logged unless all of the sensors fail
+func (hs *Heatsink) pickHottest(sensors []ThermoSensor, results []sensorReading) (max float64, hottest string, readings []Reading, err error) {
 
 	max = math.SmallestNonzeroFloat64
-	var errs multiErrs
+	var errs MultiError
+	numQuarantined := 0
 
-	for _, thermoSensor := range hs.sensors {
-		temp, err := thermoSensor.Temperature()
-		if err != nil {
-			err = fmt.Errorf("thermo sensor '%s': %w", thermoSensor.Name(), err)
+	for i, r := range results {
+		if r.quarantined {
+			numQuarantined++
+			continue
+		}
+		if r.err != nil {
+			err := fmt.Errorf("thermo sensor '%s': %w", sensors[i].Name(), r.err)
 			errs = append(errs, err)
 			continue
 		}
-		if temp > max {
-			max = temp
+		readings = append(readings, Reading{Sensor: sensors[i].Name(), Temperature: r.temp})
+		if r.temp > max {
+			max, hottest = r.temp, sensors[i].Name()
 		}
 	}
 
-	if len(errs) == len(hs.sensors) {
-		return math.MaxFloat64, errs
+	if len(errs) == len(sensors)-numQuarantined {
+		return math.MaxFloat64, "", nil, errs
 	}
 	for _, e := range errs {
 		hs.logger.Error("failed to read temperature", zap.Error(e))
 	}
 
-	return max, nil
+	return max, hottest, readings, nil
+}
+
+// deltaT returns the difference between the given temperature and the ambient temperature if
+// an ambient sensor is set, and whether it did. If reading the ambient sensor fails, the given
+// temperature is returned as is, which errs on the side of cooling unless the delta has its
+// own range, in which case the absolute temperature is checked against the absolute range
+func (hs *Heatsink) deltaT(temp float64, why *reason) (float64, bool) {
+	if hs.ambient == nil {
+		return temp, false
+	}
+	ambient, err := hs.ambient.Temperature()
+	if err != nil {
+		hs.logger.Error(
+			"failed to read ambient temperature, using absolute temperature instead",
+			zap.Error(err), zap.String("heatsink_name", hs.name),
+		)
+		why.adjust("ambient sensor '%s' failed, used absolute temperature", hs.ambient.Name())
+		return temp, false
+	}
+	why.adjust("subtracted ambient temperature %.2f of sensor '%s'", ambient, hs.ambient.Name())
+	return temp - ambient, true
+}
+
+// deltaRange is the range of the difference between the hottest sensor and the ambient sensor
+// over which the fan speeds up from its minimum to its maximum
+type deltaRange struct {
+	min float64
+	max float64
+}
+
+// serviceLevel is a minimum duty cycle that is enforced while the hottest sensor is above a
+// temperature, regardless of how the duty cycle was derived
+type serviceLevel struct {
+	aboveTemp float64
+	minDC     float64
+}
+
+// enforceServiceLevels raises the given duty cycle to the highest minimum duty cycle of the
+// service levels whose temperature is exceeded by the given absolute temperature
+func (hs *Heatsink) enforceServiceLevels(absTemp, dcRatio float64, why *reason) float64 {
+	for _, sl := range hs.svcLevels {
+		if absTemp > sl.aboveTemp && dcRatio < sl.minDC {
+			why.adjust(
+				"raised to minimum service level %.2f while above %.2f", sl.minDC, sl.aboveTemp,
+			)
+			dcRatio = sl.minDC
+		}
+	}
+	return dcRatio
+}
+
+// enforceCriticalTemperature runs the fan at full speed while the given absolute temperature is
+// at or above the critical temperature, if any. Crossing the critical temperature in either
+// direction is logged once
+func (hs *Heatsink) enforceCriticalTemperature(absTemp, dcRatio float64, why *reason) float64 {
+	if hs.critTemp == nil {
+		return dcRatio
+	}
+	critical := absTemp >= *hs.critTemp
+	if critical != hs.critical {
+		hs.critical = critical
+		if critical {
+			hs.logger.Error(
+				"temperature reached the critical temperature",
+				zap.String("event", "critical_temperature"),
+				zap.String("heatsink_name", hs.name),
+				zap.String("sensor_name", why.sensor),
+				zap.Float64("temperature", absTemp),
+				zap.Float64("critical_temp", *hs.critTemp),
+			)
+		} else {
+			hs.logger.Info(
+				"temperature dropped below the critical temperature",
+				zap.String("event", "critical_temperature_cleared"),
+				zap.String("heatsink_name", hs.name),
+				zap.String("sensor_name", why.sensor),
+				zap.Float64("temperature", absTemp),
+				zap.Float64("critical_temp", *hs.critTemp),
+			)
+		}
+	}
+	if critical && dcRatio < 1 {
+		why.adjust("raised to full speed at critical temperature %.2f", *hs.critTemp)
+		dcRatio = 1
+	}
+	return dcRatio
+}
+
+type sensorReading struct {
+	temp        float64
+	err         error
+	stale       bool
+	quarantined bool
 }
 
-type multiErrs []error
+// readSensors reads all sensors concurrently using a bounded pool of workers. The returned
+// readings are in the same order of the sensors
+func (hs *Heatsink) readSensors(sensors []ThermoSensor) []sensorReading {
 
-func (me multiErrs) Error() string {
-	if len(me) == 1 {
-		return me[0].Error()
+	readings := make([]sensorReading, len(sensors))
+	numWorkers := hs.numWorkers
+	if numWorkers > len(sensors) {
+		numWorkers = len(sensors)
 	}
-	var sb strings.Builder
-	for _, err := range me {
-		fmt.Fprintf(&sb, "\n  - %s", err)
+	if numWorkers <= 1 {
+		for i, sensor := range sensors {
+			readings[i].temp, readings[i].err = sensor.Temperature()
+		}
+		return readings
 	}
-	return sb.String()
+
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(numWorkers)
+	for w := 0; w < numWorkers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				readings[i].temp, readings[i].err = sensors[i].Temperature()
+			}
+		}()
+	}
+	for i := range sensors {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+
+	return readings
+}
+
+// reason records how the duty cycle of a single control iteration was derived
+type reason struct {
+	sensor      string
+	temperature float64
+	curve       float64
+	adjustments []string
+}
+
+func (r *reason) adjust(format string, args ...interface{}) {
+	r.adjustments = append(r.adjustments, fmt.Sprintf(format, args...))
+}
+
+// logReason logs why the duty cycle changed if logging reasons is enabled. It is a no-op if
+// the given duty cycle is the same as the previously applied one
+func (hs *Heatsink) logReason(dcRatio float64, why *reason) {
+	prevDC := hs.prevDC
+	hs.prevDC = dcRatio
+	if !hs.logReasons || dcRatio == prevDC {
+		return
+	}
+	hs.logger.Debug(
+		"duty cycle changed",
+		zap.String("event", "duty_cycle_change"),
+		zap.String("heatsink_name", hs.name),
+		zap.String("sensor_name", why.sensor),
+		zap.Float64("temperature", why.temperature),
+		zap.Float64("curve_duty_cycle", why.curve),
+		zap.Strings("adjustments", why.adjustments),
+		zap.Float64("previous_duty_cycle", prevDC),
+		zap.Float64("duty_cycle", dcRatio),
+	)
 }
@@ -2,6 +2,7 @@ package heatsink
 
 import (
 	"errors"
+	"fmt"
 	"strings"
 	"sync"
 	"testing"
@@ -10,6 +11,7 @@ import (
 	"github.com/go-test/deep"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 func TestConfig(t *testing.T) {
@@ -30,7 +32,7 @@ func TestConfig(t *testing.T) {
 		},
 		"config-is-nil": {
 			inConfig: nil,
-			outErr:   errNoConfig,
+			outErr:   ErrNoConfig,
 		},
 		"fan-is-nil": {
 			inConfig: &Config{
@@ -39,7 +41,7 @@ func TestConfig(t *testing.T) {
 				MaxTemperature: 20,
 				Sensors:        []ThermoSensor{&fakeThermoSensor{}, &fakeThermoSensor{}},
 			},
-			outErr: errNoFan,
+			outErr: ErrNoFan,
 		},
 		"sensors-empty": {
 			inConfig: &Config{
@@ -48,7 +50,7 @@ func TestConfig(t *testing.T) {
 				MaxTemperature: 20,
 				Sensors:        []ThermoSensor{},
 			},
-			outErr: errNoSensors,
+			outErr: ErrNoSensors,
 		},
 		"sensor-is-nil": {
 			inConfig: &Config{
@@ -57,7 +59,7 @@ func TestConfig(t *testing.T) {
 				MaxTemperature: 20,
 				Sensors:        []ThermoSensor{&fakeThermoSensor{}, nil},
 			},
-			outErr: errNilSensor,
+			outErr: ErrNilSensor,
 		},
 		"temperatures-min-max-equal": {
 			inConfig: &Config{
@@ -66,7 +68,7 @@ func TestConfig(t *testing.T) {
 				MaxTemperature: 10,
 				Sensors:        []ThermoSensor{&fakeThermoSensor{}, &fakeThermoSensor{}},
 			},
-			outErr: errBadTemps,
+			outErr: ErrBadTemperatureRange,
 		},
 		"temperatures-min-larger-than-max": {
 			inConfig: &Config{
@@ -75,7 +77,7 @@ func TestConfig(t *testing.T) {
 				MaxTemperature: 10,
 				Sensors:        []ThermoSensor{&fakeThermoSensor{}, &fakeThermoSensor{}},
 			},
-			outErr: errBadTemps,
+			outErr: ErrBadTemperatureRange,
 		},
 	}
 
@@ -98,13 +100,18 @@ func TestNew_defaults(t *testing.T) {
 	ths := &fakeThermoSensor{}
 
 	expected := &Heatsink{
-		name:      "heatsink/cpu-fan1",
-		chkPeriod: 1 * time.Second,
-		dcCalc:    newDutyCyclerPowPi(35, 45),
-		fan:       fd,
-		sensors:   []ThermoSensor{ths},
-		isStopped: make(chan struct{}),
-		logger:    zap.NewNop(),
+		name:       "heatsink/cpu-fan1",
+		chkPeriod:  1 * time.Second,
+		dcCalc:     newDutyCyclerPowPi(35, 45),
+		fan:        fd,
+		minTemp:    35,
+		maxTemp:    45,
+		sensors:    []ThermoSensor{ths},
+		numWorkers: 4,
+		isStopped:  make(chan struct{}),
+		logger:     zap.NewNop(),
+		prevDC:     -1,
+		skipDC:     &dutyCycleSkip{refresh: time.Minute},
 	}
 
 	config := &Config{
@@ -133,13 +140,21 @@ func TestNew_validOptions(t *testing.T) {
 	fanDriver := &fakeFanDriver{}
 
 	expected := &Heatsink{
-		name:      t.Name(),
-		chkPeriod: 100 * time.Millisecond,
-		dcCalc:    newDutyCyclerPowPi(0, 10),
-		fan:       fanDriver,
-		sensors:   sensors,
-		isStopped: make(chan struct{}),
-		logger:    logger,
+		name:       t.Name(),
+		chkPeriod:  100 * time.Millisecond,
+		dcCalc:     newDutyCyclerPowPi(0, 10),
+		fan:        fanDriver,
+		minTemp:    0,
+		maxTemp:    10,
+		sensors:    sensors,
+		numWorkers: 2,
+		isStopped:  make(chan struct{}),
+		logger:     logger,
+		logReasons: true,
+		summary:    &summary{everyN: 10, period: time.Minute},
+		prevDC:     -1,
+		skipDC:     &dutyCycleSkip{refresh: time.Minute},
+		smplFilter: &sampleFilter{tempDelta: 0.5, dcDelta: 0.05, heartbeat: time.Minute},
 	}
 
 	config := &Config{
@@ -151,6 +166,10 @@ func TestNew_validOptions(t *testing.T) {
 	actual, err := New(
 		config,
 		nil, // should be ignored
+		OptLogReasons(true),
+		OptPeriodicSummary(10, time.Minute),
+		OptSampleDeltas(0.5, 0.05, time.Minute),
+		OptSensorConcurrency(2),
 		OptName(t.Name()),
 		OptLogger(logger),
 		OptTemperatureCheckPeriod(100*time.Millisecond),
@@ -175,13 +194,19 @@ func TestNew_validOptions_defaultFanResponse(t *testing.T) {
 	fanDriver := &fakeFanDriver{}
 
 	expected := &Heatsink{
-		name:      t.Name(),
-		chkPeriod: 100 * time.Millisecond,
-		dcCalc:    newDutyCyclerLinear(0, 10),
-		fan:       fanDriver,
-		sensors:   sensors,
-		isStopped: make(chan struct{}),
-		logger:    logger,
+		name:       t.Name(),
+		chkPeriod:  100 * time.Millisecond,
+		dcCalc:     newDutyCyclerLinear(0, 10),
+		response:   FanResponseLinear,
+		fan:        fanDriver,
+		minTemp:    0,
+		maxTemp:    10,
+		sensors:    sensors,
+		numWorkers: 4,
+		isStopped:  make(chan struct{}),
+		logger:     logger,
+		prevDC:     -1,
+		skipDC:     &dutyCycleSkip{refresh: time.Minute},
 	}
 
 	config := &Config{
@@ -215,13 +240,18 @@ func TestNew_invalidOptions(t *testing.T) {
 	fanDriver := &fakeFanDriver{onName: "cpu-fan1"}
 
 	expected := &Heatsink{
-		name:      "heatsink/cpu-fan1",
-		chkPeriod: 1 * time.Second,
-		dcCalc:    newDutyCyclerPowPi(0, 10),
-		fan:       fanDriver,
-		sensors:   sensors,
-		isStopped: make(chan struct{}),
-		logger:    zap.NewNop(),
+		name:       "heatsink/cpu-fan1",
+		chkPeriod:  1 * time.Second,
+		dcCalc:     newDutyCyclerPowPi(0, 10),
+		fan:        fanDriver,
+		minTemp:    0,
+		maxTemp:    10,
+		sensors:    sensors,
+		numWorkers: 4,
+		isStopped:  make(chan struct{}),
+		logger:     zap.NewNop(),
+		prevDC:     -1,
+		skipDC:     &dutyCycleSkip{refresh: time.Minute},
 	}
 
 	config := &Config{
@@ -235,6 +265,8 @@ func TestNew_invalidOptions(t *testing.T) {
 		OptName(""),
 		OptLogger(nil),
 		OptTemperatureCheckPeriod(time.Duration(-10)),
+		OptSensorConcurrency(0),
+		OptFanResponsePow(0),
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -245,6 +277,89 @@ func TestNew_invalidOptions(t *testing.T) {
 	}
 }
 
+func TestNew_invalidOptions_strict(t *testing.T) {
+	t.Parallel()
+
+	invalid := []Option{
+		OptName(""),
+		OptTemperatureCheckPeriod(-time.Second),
+		OptCheckPeriodJitter(-time.Second),
+		OptCheckPeriodJitter(500 * time.Millisecond), // half the default check period
+		OptPhaseOffset(-time.Second),
+		OptSensorConcurrency(-1),
+		OptFanResponsePow(0),
+		OptFanResponseSigmoid(1.5, 10),
+		OptSteps(nil, 0),
+		OptAdaptiveCheckPeriod(0, 1, 0),
+		OptAmbientDeltaRange(10, 5),
+		OptInput(Input{}),
+		OptAuxInput(nil, 0, 1),
+		OptSchedule(Schedule{}),
+		OptServiceLevel(50, 2),
+		OptBoundaries(Boundary{DutyCycle: -1}, Boundary{DutyCycle: 1}),
+		OptLastKnownGood(-1),
+		OptInitialDutyCycle(1.5),
+	}
+	for i, opt := range invalid {
+		config := &Config{
+			Fan:            &fakeFanDriver{},
+			Sensors:        []ThermoSensor{&fakeThermoSensor{}},
+			MinTemperature: 0,
+			MaxTemperature: 10,
+		}
+		_, err := New(config, OptStrict(true), opt)
+		if !errors.Is(err, ErrBadOption) {
+			t.Errorf("option %d: unexpected error\nwant: %v\n got: %v", i, ErrBadOption, err)
+		}
+
+		core, logs := observer.New(zapcore.WarnLevel)
+		if _, err := New(config, OptLogger(zap.New(core)), opt); err != nil {
+			t.Errorf("option %d: expected no error without strict mode, got: %v", i, err)
+		}
+		if actual := logs.Len(); actual != 1 {
+			t.Errorf("option %d: expected exactly one warning without strict mode, got: %d", i, actual)
+		}
+	}
+}
+
+func TestHeatsink_getters(t *testing.T) {
+	t.Parallel()
+
+	config := &Config{
+		Fan: &fakeFanDriver{},
+		Sensors: []ThermoSensor{
+			&fakeThermoSensor{onName: "core0"}, &fakeThermoSensor{onName: "core1"},
+		},
+		MinTemperature: 35,
+		MaxTemperature: 45,
+	}
+	hs, err := New(
+		config,
+		OptName(t.Name()),
+		OptTemperatureCheckPeriod(3*time.Second),
+		OptAmbientSensor(&fakeThermoSensor{onName: "ambient"}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, actual := t.Name(), hs.Name(); expected != actual {
+		t.Errorf("unexpected name\nwant: %q\n got: %q", expected, actual)
+	}
+	if expected, actual := 35.0, hs.MinTemperature(); expected != actual {
+		t.Errorf("unexpected min temperature\nwant: %.1f\n got: %.1f", expected, actual)
+	}
+	if expected, actual := 45.0, hs.MaxTemperature(); expected != actual {
+		t.Errorf("unexpected max temperature\nwant: %.1f\n got: %.1f", expected, actual)
+	}
+	if expected, actual := 3*time.Second, hs.CheckPeriod(); expected != actual {
+		t.Errorf("unexpected check period\nwant: %s\n got: %s", expected, actual)
+	}
+	if diff := deep.Equal([]string{"core0", "core1"}, hs.SensorNames()); diff != nil {
+		t.Error("actual sensor names do not match expected\n", strings.Join(diff, "\n"))
+	}
+}
+
 func TestNew_copiesSensors(t *testing.T) {
 	t.Parallel()
 
@@ -325,6 +440,25 @@ func TestHeatsink(t *testing.T) {
 	}
 	wg.Wait()
 
+	sample := hs.LastSample()
+	if sample.Time.IsZero() {
+		t.Error("expected the last sample to be recorded")
+	}
+	if expected, actual := 0.40, sample.DutyCycle; expected != actual {
+		t.Errorf("unexpected duty cycle in last sample\nwant: %.2f\n got: %.2f", expected, actual)
+	}
+	if expected, actual := 40.0, sample.Temperature; expected != actual {
+		t.Errorf("unexpected temperature in last sample\nwant: %.2f\n got: %.2f", expected, actual)
+	}
+	timings := sample.Timings
+	if timings.Start.IsZero() || timings.Start.After(sample.Time) ||
+		timings.SensorRead < 0 || timings.Computation < 0 || timings.FanWrite < 0 {
+		t.Errorf("unexpected timings in last sample: %+v", timings)
+	}
+	if !hs.Stopped() {
+		t.Error("expected the heatsink to report that it stopped")
+	}
+
 	if sensor1.numCloseCalls != 1 {
 		t.Errorf(
 			"expected sensor1 to be closed exactly once, but it was closed %d times",
@@ -373,7 +507,7 @@ func TestHeatsink_StartThermalControl_errorReadingMaxCoreTemp(t *testing.T) {
 	}
 
 	err = hs.StartThermalControl()
-	var actualErr multiErrs
+	var actualErr MultiError
 	if ok := errors.As(err, &actualErr); !ok {
 		t.Fatalf("unexpected error type\nwant: %T\n got: %T", actualErr, err)
 	}
@@ -385,13 +519,13 @@ func TestHeatsink_StartThermalControl_errorReadingMaxCoreTemp(t *testing.T) {
 	}
 	if !errors.Is(actualErr[0], simErrSensor1) {
 		t.Errorf(
-			"unexpected first error in multiErrs\nwant: %v\n got: %v",
+			"unexpected first error in MultiError\nwant: %v\n got: %v",
 			simErrSensor1, actualErr[0],
 		)
 	}
 	if !errors.Is(actualErr[1], simErrSensor2) {
 		t.Errorf(
-			"unexpected second error in multiErrs\nwant: %v\n got: %v",
+			"unexpected second error in MultiError\nwant: %v\n got: %v",
 			simErrSensor2, actualErr[1],
 		)
 	}
@@ -535,6 +669,367 @@ func TestHeatsink_StartThermalControl_logsErrorIfOneSensorFails(t *testing.T) {
 	}
 }
 
+func TestHeatsink_maxCoreTemp_concurrentReads(t *testing.T) {
+	t.Parallel()
+
+	simErr := errors.New("simulated error")
+	tracker := &concurrencyTracker{}
+	var sensors []ThermoSensor
+	for i := range iter(10) {
+		sensors = append(sensors, &concurrencyTrackingSensor{
+			fakeThermoSensor: fakeThermoSensor{onTemperatureVals: []float64{float64(i)}},
+			tracker:          tracker,
+		})
+	}
+	sensors[9] = &concurrencyTrackingSensor{
+		fakeThermoSensor: fakeThermoSensor{onName: "bad", onTemperatureErrs: []error{simErr}},
+		tracker:          tracker,
+	}
+	hs, err := New(
+		&Config{Fan: &fakeFanDriver{}, Sensors: sensors, MaxTemperature: 100},
+		OptSensorConcurrency(3),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual, _, readings, err := hs.maxCoreTemp()
+	if err != nil {
+		t.Fatalf("expected no error if at least one sensor was read, got: %v", err)
+	}
+	if expected := 8.0; expected != actual {
+		t.Fatalf("unexpected max core temperature\nwant: %.1f\n got: %.1f", expected, actual)
+	}
+	for i, r := range readings {
+		if r.Temperature != float64(i) {
+			t.Fatalf("expected readings in the order of the sensors, got: %v", readings)
+		}
+	}
+	if expected, actual := 9, len(readings); expected != actual {
+		t.Fatalf("expected failed sensors to be omitted from readings\nwant: %d\n got: %d", expected, actual)
+	}
+	if peak := tracker.peakCalls(); peak > 3 || peak < 2 {
+		t.Fatalf("expected sensors to be read by at most 3 workers at a time, got: %d", peak)
+	}
+}
+
+func TestHeatsink_deltaT(t *testing.T) {
+	t.Parallel()
+
+	ambient := &fakeThermoSensor{
+		onName:            "ambient",
+		onTemperatureVals: []float64{21.5, 0},
+		onTemperatureErrs: []error{nil, errors.New("simulated error")},
+	}
+	config := &Config{
+		Fan:            &fakeFanDriver{},
+		Sensors:        []ThermoSensor{&fakeThermoSensor{}},
+		MinTemperature: 5,
+		MaxTemperature: 25,
+	}
+	hs, err := New(config, OptAmbientSensor(ambient))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	why := &reason{}
+	if actual, isDelta := hs.deltaT(51.5, why); actual != 30.0 || !isDelta {
+		t.Errorf("unexpected delta-T temperature\nwant: %.2f\n got: %.2f", 30.0, actual)
+	}
+	if actual, isDelta := hs.deltaT(51.5, why); actual != 51.5 || isDelta {
+		t.Errorf(
+			"expected absolute temperature if ambient sensor fails\nwant: %.2f\n got: %.2f",
+			51.5, actual,
+		)
+	}
+	if len(why.adjustments) != 2 {
+		t.Errorf("expected two adjustments to be recorded, got: %v", why.adjustments)
+	}
+
+	if err := hs.StopThermalControl(); err != nil {
+		t.Fatal(err)
+	}
+	if ambient.numCloseCalls != 1 {
+		t.Errorf(
+			"expected ambient sensor to be closed exactly once, but it was closed %d times",
+			ambient.numCloseCalls,
+		)
+	}
+}
+
+func TestNew_ambientDeltaRange(t *testing.T) {
+	orig := deep.CompareUnexportedFields
+	deep.CompareUnexportedFields = true
+	defer func() { deep.CompareUnexportedFields = orig }()
+
+	config := &Config{
+		Fan:            &fakeFanDriver{},
+		Sensors:        []ThermoSensor{&fakeThermoSensor{}},
+		MinTemperature: 40,
+		MaxTemperature: 80,
+	}
+	lower := Boundary{DutyCycle: 0.2, Inclusive: true}
+	upper := Boundary{DutyCycle: 1, Inclusive: true}
+
+	cases := map[string]struct {
+		options  []Option
+		expected dutyCycler
+	}{
+		"no-ambient-sensor": {
+			options:  []Option{OptAmbientDeltaRange(5, 30)},
+			expected: nil,
+		},
+		"bad-range": {
+			options:  []Option{OptAmbientSensor(&fakeThermoSensor{}), OptAmbientDeltaRange(30, 5)},
+			expected: nil,
+		},
+		"fan-response": {
+			options: []Option{
+				OptAmbientDeltaRange(5, 30),
+				OptAmbientSensor(&fakeThermoSensor{}),
+				OptFanResponse(FanResponseLinear),
+			},
+			expected: newDutyCyclerLinear(5, 30),
+		},
+		"boundaries": {
+			options: []Option{
+				OptAmbientSensor(&fakeThermoSensor{}),
+				OptBoundaries(lower, upper),
+				OptAmbientDeltaRange(5, 30),
+			},
+			expected: &dutyCyclerBounded{
+				curve: newDutyCyclerPowPi(5, 30), minTemp: 5, maxTemp: 30, lower: lower, upper: upper,
+			},
+		},
+	}
+	for name, testCase := range cases {
+		hs, err := New(config, testCase.options...)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if diff := deep.Equal(hs.deltaCalc, testCase.expected); diff != nil {
+			t.Errorf("%s: %v", name, diff)
+		}
+	}
+}
+
+func TestHeatsink_StartThermalControl_ambientDeltaRange(t *testing.T) {
+	t.Parallel()
+
+	fanDriver := &fakeFanDriver{}
+	config := &Config{
+		Fan:            fanDriver,
+		Sensors:        []ThermoSensor{&fakeThermoSensor{onTemperatureVals: []float64{60, 60}}},
+		MinTemperature: 40,
+		MaxTemperature: 80,
+	}
+	ambient := &fakeThermoSensor{
+		onTemperatureVals: []float64{35, 0},
+		onTemperatureErrs: []error{nil, errors.New("simulated error")},
+	}
+	hs, err := New(
+		config,
+		OptAmbientSensor(ambient),
+		OptAmbientDeltaRange(5, 45),
+		OptFanResponse(FanResponseLinear),
+		OptTemperatureCheckPeriod(time.Millisecond),
+		OptUnchangedDutyCycle(-1, 0),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		_ = hs.StartThermalControl()
+	}()
+	for deadline := time.After(100 * time.Millisecond); ; {
+		select {
+		case <-deadline:
+			t.Fatal("timeout waiting for thermal control to set fan's dc ratio twice")
+		default:
+		}
+		fanDriver.mutex.Lock()
+		count := len(fanDriver.argSetDutyCycle)
+		fanDriver.mutex.Unlock()
+		if count >= 2 {
+			break
+		}
+	}
+	if err := hs.StopThermalControl(); err != nil {
+		t.Fatal(err)
+	}
+
+	fanDriver.mutex.Lock()
+	defer fanDriver.mutex.Unlock()
+	// a delta of 25 is half way through the delta range, and an absolute temperature of 60 is
+	// half way through the absolute range when the ambient sensor fails
+	if diff := deep.Equal(fanDriver.argSetDutyCycle[:2], []float64{0.5, 0.5}); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestHeatsink_enforceServiceLevels(t *testing.T) {
+	t.Parallel()
+
+	config := &Config{
+		Fan:            &fakeFanDriver{},
+		Sensors:        []ThermoSensor{&fakeThermoSensor{}},
+		MinTemperature: 50,
+		MaxTemperature: 80,
+	}
+	hs, err := New(config, OptServiceLevel(40, 0.2), OptServiceLevel(60, 1.5), OptServiceLevel(50, 0.3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]struct {
+		inTemp, inDC, expected float64
+	}{
+		"below-all-levels":  {inTemp: 40, inDC: 0.0, expected: 0.0},
+		"above-first-level": {inTemp: 41, inDC: 0.0, expected: 0.2},
+		"highest-minimum":   {inTemp: 55, inDC: 0.1, expected: 0.3},
+		"clamped-minimum":   {inTemp: 61, inDC: 0.5, expected: 1.0},
+		"already-higher":    {inTemp: 45, inDC: 0.9, expected: 0.9},
+	}
+	for name, testCase := range cases {
+		testCase := testCase
+		t.Run(name, func(t *testing.T) {
+			actual := hs.enforceServiceLevels(testCase.inTemp, testCase.inDC, &reason{})
+			if actual != testCase.expected {
+				t.Fatalf("unexpected duty cycle\nwant: %.2f\n got: %.2f", testCase.expected, actual)
+			}
+		})
+	}
+}
+
+func TestHeatsink_enforceCriticalTemperature(t *testing.T) {
+	t.Parallel()
+
+	core, logs := observer.New(zapcore.DebugLevel)
+	config := &Config{
+		Fan:            &fakeFanDriver{},
+		Sensors:        []ThermoSensor{&fakeThermoSensor{}},
+		MinTemperature: 50,
+		MaxTemperature: 80,
+	}
+	hs, err := New(config, OptLogger(zap.New(core)), OptCriticalTemperature(90))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if temp, ok := hs.CriticalTemperature(); !ok || temp != 90 {
+		t.Fatalf("unexpected critical temperature\nwant: %v, %v\n got: %v, %v", 90.0, true, temp, ok)
+	}
+
+	steps := []struct {
+		inTemp, inDC, expected float64
+		critical               bool
+	}{
+		{inTemp: 85, inDC: 0.7, expected: 0.7, critical: false},
+		{inTemp: 90, inDC: 0.8, expected: 1.0, critical: true},
+		{inTemp: 95, inDC: 1.0, expected: 1.0, critical: true},
+		{inTemp: 89, inDC: 0.9, expected: 0.9, critical: false},
+	}
+	for i, step := range steps {
+		actual := hs.enforceCriticalTemperature(step.inTemp, step.inDC, &reason{})
+		if actual != step.expected {
+			t.Errorf("step %d: unexpected duty cycle\nwant: %.2f\n got: %.2f", i, step.expected, actual)
+		}
+		if hs.critical != step.critical {
+			t.Errorf("step %d: unexpected critical state\nwant: %v\n got: %v", i, step.critical, hs.critical)
+		}
+	}
+
+	if n := logs.FilterField(zap.String("event", "critical_temperature")).Len(); n != 1 {
+		t.Errorf("expected reaching the critical temperature to be logged once, got: %d", n)
+	}
+	if n := logs.FilterField(zap.String("event", "critical_temperature_cleared")).Len(); n != 1 {
+		t.Errorf("expected clearing the critical temperature to be logged once, got: %d", n)
+	}
+}
+
+func TestHeatsink_enforceCriticalTemperature_unset(t *testing.T) {
+	t.Parallel()
+
+	config := &Config{
+		Fan:            &fakeFanDriver{},
+		Sensors:        []ThermoSensor{&fakeThermoSensor{}},
+		MinTemperature: 50,
+		MaxTemperature: 80,
+	}
+	hs, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := hs.CriticalTemperature(); ok {
+		t.Error("expected no critical temperature by default")
+	}
+	if actual := hs.enforceCriticalTemperature(500, 0.5, &reason{}); actual != 0.5 {
+		t.Errorf("unexpected duty cycle\nwant: %.2f\n got: %.2f", 0.5, actual)
+	}
+}
+
+func TestHeatsink_StartThermalControl_logsReasons(t *testing.T) {
+	t.Parallel()
+
+	core, logs := observer.New(zapcore.DebugLevel)
+	fanDriver := &fakeFanDriver{}
+	config := &Config{
+		Fan: fanDriver,
+		Sensors: []ThermoSensor{
+			&fakeThermoSensor{onName: "core0", onTemperatureVals: []float64{36, 36}},
+			&fakeThermoSensor{onName: "core1", onTemperatureVals: []float64{40, 40}},
+		},
+		MinTemperature: 35,
+		MaxTemperature: 45,
+	}
+	hs, err := New(
+		config,
+		OptLogger(zap.New(core)),
+		OptLogReasons(true),
+		OptTemperatureCheckPeriod(time.Millisecond),
+		OptUnchangedDutyCycle(-1, 0),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs.dcCalc = &fakeDutyCycler{tmpToDC: map[float64]float64{40: 0.40}}
+
+	go func() {
+		_ = hs.StartThermalControl()
+	}()
+	for deadline := time.After(100 * time.Millisecond); ; {
+		select {
+		case <-deadline:
+			t.Fatal("timeout waiting for thermal control to set fan's dc ratio twice")
+		default:
+		}
+		fanDriver.mutex.Lock()
+		count := len(fanDriver.argSetDutyCycle)
+		fanDriver.mutex.Unlock()
+		if count >= 2 {
+			break
+		}
+	}
+	if err := hs.StopThermalControl(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := logs.FilterField(zap.String("event", "duty_cycle_change")).AllUntimed()
+	if len(entries) != 1 {
+		t.Fatalf("expected exactly one reason to be logged for an unchanged duty cycle, got: %d", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	if expected, actual := "core1", fields["sensor_name"]; expected != actual {
+		t.Errorf("unexpected sensor name in logged reason\nwant: %v\n got: %v", expected, actual)
+	}
+	if expected, actual := 40.0, fields["temperature"]; expected != actual {
+		t.Errorf("unexpected temperature in logged reason\nwant: %v\n got: %v", expected, actual)
+	}
+	if expected, actual := 0.40, fields["duty_cycle"]; expected != actual {
+		t.Errorf("unexpected duty cycle in logged reason\nwant: %v\n got: %v", expected, actual)
+	}
+}
+
 func TestHeatsink_StopThermalControl_multipleErrs(t *testing.T) {
 	t.Parallel()
 
@@ -557,9 +1052,9 @@ func TestHeatsink_StopThermalControl_multipleErrs(t *testing.T) {
 	}
 
 	err = hs.StopThermalControl()
-	var actualErr multiErrs
+	var actualErr MultiError
 	if !errors.As(err, &actualErr) {
-		t.Fatalf("unexpected error type\nwant: %T\n got: %T", multiErrs(nil), err)
+		t.Fatalf("unexpected error type\nwant: %T\n got: %T", MultiError(nil), err)
 	}
 	if len(actualErr) != 3 {
 		t.Fatalf("expected 3 errors, got: %d", len(actualErr))
@@ -583,9 +1078,9 @@ func TestHeatsink_StopThermalControl_multipleErrs(t *testing.T) {
 	}
 }
 
-func Test_multiErrs_Error_singleErr(t *testing.T) {
+func TestMultiError_Error_singleErr(t *testing.T) {
 	simErr := errors.New("simulated error")
-	me := multiErrs{simErr}
+	me := MultiError{simErr}
 	expected := simErr.Error()
 	actual := me.Error()
 	if expected != actual {
@@ -593,6 +1088,29 @@ func Test_multiErrs_Error_singleErr(t *testing.T) {
 	}
 }
 
+func TestMultiError_Unwrap(t *testing.T) {
+	simErr1 := errors.New("simulated error 1")
+	simErr2 := fmt.Errorf("wrapped: %w", ErrThermoSensorClosed)
+	var err error = MultiError{simErr1, simErr2}
+
+	if !errors.Is(err, simErr1) {
+		t.Errorf("expected errors.Is to find the first error\nwant: %v\n got: %v", simErr1, err)
+	}
+	if !errors.Is(err, ErrThermoSensorClosed) {
+		t.Errorf("expected errors.Is to find the second error\nwant: %v\n got: %v", ErrThermoSensorClosed, err)
+	}
+	var ce constErr
+	if !errors.As(err, &ce) || ce != ErrThermoSensorClosed {
+		t.Errorf("expected errors.As to find the wrapped constErr, got: %v", ce)
+	}
+
+	unwrapped := err.(MultiError).Unwrap()
+	unwrapped[0] = nil
+	if err.(MultiError)[0] == nil {
+		t.Error("expected Unwrap() to return a copy of the collected errors")
+	}
+}
+
 func Test_constErr_Error(t *testing.T) {
 	err := constErr(t.Name())
 	if err.Error() != t.Name() {
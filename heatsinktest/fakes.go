@@ -0,0 +1,172 @@
+package heatsinktest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/malkhamis/heatsink"
+)
+
+// compile-time check for interface implementation and dependency inversion
+var (
+	_ heatsink.ThermoSensor = (*FakeThermoSensor)(nil)
+	_ heatsink.FanDriver    = (*FakeFanDriver)(nil)
+)
+
+// FakeThermoSensor is a thermal sensor with programmable readings and errors for unit tests.
+// Its exported fields must be set before it is used. Instances of this type are safe for
+// concurrent use
+type FakeThermoSensor struct {
+	// TemperatureVals are returned by consecutive calls to Temperature. Once exhausted, the
+	// last value is returned repeatedly, or zero if there are none
+	TemperatureVals []float64
+	// TemperatureErrs are returned by consecutive calls to Temperature. Once exhausted, nil is
+	// returned
+	TemperatureErrs []error
+	// CloseErrs are returned by consecutive calls to Close. Once exhausted, nil is returned
+	CloseErrs []error
+	// SensorName is returned by Name
+	SensorName string
+
+	last          float64
+	numTempCalls  int
+	numCloseCalls int
+	mutex         sync.Mutex
+}
+
+// Temperature returns the next programmed temperature and error
+func (fts *FakeThermoSensor) Temperature() (temp float64, err error) {
+	fts.mutex.Lock()
+	defer fts.mutex.Unlock()
+
+	fts.numTempCalls++
+	if len(fts.TemperatureVals) > 0 {
+		fts.last = fts.TemperatureVals[0]
+		fts.TemperatureVals = fts.TemperatureVals[1:]
+	}
+	if len(fts.TemperatureErrs) > 0 {
+		err = fts.TemperatureErrs[0]
+		fts.TemperatureErrs = fts.TemperatureErrs[1:]
+	}
+	return fts.last, err
+}
+
+// Close returns the next programmed error
+func (fts *FakeThermoSensor) Close() (err error) {
+	fts.mutex.Lock()
+	defer fts.mutex.Unlock()
+
+	fts.numCloseCalls++
+	if len(fts.CloseErrs) > 0 {
+		err = fts.CloseErrs[0]
+		fts.CloseErrs = fts.CloseErrs[1:]
+	}
+	return
+}
+
+// Name returns SensorName
+func (fts *FakeThermoSensor) Name() string {
+	return fts.SensorName
+}
+
+// NumTemperatureCalls returns how many times Temperature was called
+func (fts *FakeThermoSensor) NumTemperatureCalls() int {
+	fts.mutex.Lock()
+	defer fts.mutex.Unlock()
+	return fts.numTempCalls
+}
+
+// NumCloseCalls returns how many times Close was called
+func (fts *FakeThermoSensor) NumCloseCalls() int {
+	fts.mutex.Lock()
+	defer fts.mutex.Unlock()
+	return fts.numCloseCalls
+}
+
+// FakeFanDriver is a fan driver with programmable errors that records the duty cycles it is
+// given for unit tests. Its exported fields must be set before it is used. Instances of this
+// type are safe for concurrent use
+type FakeFanDriver struct {
+	// SetDutyCycleErrs are returned by consecutive calls to SetDutyCycle. Once exhausted, nil
+	// is returned. Duty cycles are recorded regardless of the returned error
+	SetDutyCycleErrs []error
+	// CloseErrs are returned by consecutive calls to Close. Once exhausted, nil is returned
+	CloseErrs []error
+	// FanName is returned by Name
+	FanName string
+
+	dutyCycles    []float64
+	numCloseCalls int
+	mutex         sync.Mutex
+}
+
+// SetDutyCycle records the given duty cycle ratio and returns the next programmed error
+func (ffd *FakeFanDriver) SetDutyCycle(dcRatio float64) (err error) {
+	ffd.mutex.Lock()
+	defer ffd.mutex.Unlock()
+
+	ffd.dutyCycles = append(ffd.dutyCycles, dcRatio)
+	if len(ffd.SetDutyCycleErrs) > 0 {
+		err = ffd.SetDutyCycleErrs[0]
+		ffd.SetDutyCycleErrs = ffd.SetDutyCycleErrs[1:]
+	}
+	return
+}
+
+// Close returns the next programmed error
+func (ffd *FakeFanDriver) Close() (err error) {
+	ffd.mutex.Lock()
+	defer ffd.mutex.Unlock()
+
+	ffd.numCloseCalls++
+	if len(ffd.CloseErrs) > 0 {
+		err = ffd.CloseErrs[0]
+		ffd.CloseErrs = ffd.CloseErrs[1:]
+	}
+	return
+}
+
+// Name returns FanName
+func (ffd *FakeFanDriver) Name() string {
+	return ffd.FanName
+}
+
+// DutyCycles returns a copy of the duty cycle ratios given so far, in the order they were given
+func (ffd *FakeFanDriver) DutyCycles() []float64 {
+	ffd.mutex.Lock()
+	defer ffd.mutex.Unlock()
+	return append([]float64(nil), ffd.dutyCycles...)
+}
+
+// NumCloseCalls returns how many times Close was called
+func (ffd *FakeFanDriver) NumCloseCalls() int {
+	ffd.mutex.Lock()
+	defer ffd.mutex.Unlock()
+	return ffd.numCloseCalls
+}
+
+// FakeClock is a clock that only moves when advanced, e.g. to replace time.Now in unit tests of
+// code that waits for durations to elapse. Instances of this type are safe for concurrent use
+type FakeClock struct {
+	current time.Time
+	mutex   sync.Mutex
+}
+
+// NewFakeClock returns a clock that reads the given time until advanced
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{current: start}
+}
+
+// Now returns the current time of the clock
+func (c *FakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.current
+}
+
+// Advance moves the clock forward by the given duration
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.current = c.current.Add(d)
+}
@@ -0,0 +1,122 @@
+package heatsinktest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/malkhamis/heatsink"
+)
+
+func TestFakeThermoSensor(t *testing.T) {
+
+	simulatedErr := errors.New("simulated error")
+	sensor := &FakeThermoSensor{
+		TemperatureVals: []float64{40, 45},
+		TemperatureErrs: []error{nil, simulatedErr},
+		CloseErrs:       []error{simulatedErr},
+		SensorName:      "fake",
+	}
+
+	var temps []float64
+	var errs []error
+	for range make([]struct{}, 3) {
+		temp, err := sensor.Temperature()
+		temps, errs = append(temps, temp), append(errs, err)
+	}
+	if diff := deep.Equal(temps, []float64{40, 45, 45}); diff != nil {
+		t.Errorf("expected the last temperature to repeat: %v", diff)
+	}
+	if diff := deep.Equal(errs, []error{nil, simulatedErr, nil}); diff != nil {
+		t.Error(diff)
+	}
+	if expected, actual := 3, sensor.NumTemperatureCalls(); actual != expected {
+		t.Errorf("unexpected number of calls\nwant: %d\n got: %d", expected, actual)
+	}
+
+	if err := sensor.Close(); !errors.Is(err, simulatedErr) {
+		t.Errorf("unexpected error\nwant: %v\n got: %v", simulatedErr, err)
+	}
+	if err := sensor.Close(); err != nil {
+		t.Errorf("unexpected error\nwant: %v\n got: %v", nil, err)
+	}
+	if expected, actual := 2, sensor.NumCloseCalls(); actual != expected {
+		t.Errorf("unexpected number of calls\nwant: %d\n got: %d", expected, actual)
+	}
+	if expected, actual := "fake", sensor.Name(); actual != expected {
+		t.Errorf("unexpected name\nwant: %s\n got: %s", expected, actual)
+	}
+}
+
+func TestFakeFanDriver(t *testing.T) {
+
+	simulatedErr := errors.New("simulated error")
+	fan := &FakeFanDriver{
+		SetDutyCycleErrs: []error{simulatedErr},
+		CloseErrs:        []error{simulatedErr},
+		FanName:          "fake",
+	}
+
+	if err := fan.SetDutyCycle(0.2); !errors.Is(err, simulatedErr) {
+		t.Errorf("unexpected error\nwant: %v\n got: %v", simulatedErr, err)
+	}
+	if err := fan.SetDutyCycle(0.4); err != nil {
+		t.Errorf("unexpected error\nwant: %v\n got: %v", nil, err)
+	}
+	if diff := deep.Equal(fan.DutyCycles(), []float64{0.2, 0.4}); diff != nil {
+		t.Error(diff)
+	}
+
+	if err := fan.Close(); !errors.Is(err, simulatedErr) {
+		t.Errorf("unexpected error\nwant: %v\n got: %v", simulatedErr, err)
+	}
+	if expected, actual := 1, fan.NumCloseCalls(); actual != expected {
+		t.Errorf("unexpected number of calls\nwant: %d\n got: %d", expected, actual)
+	}
+	if expected, actual := "fake", fan.Name(); actual != expected {
+		t.Errorf("unexpected name\nwant: %s\n got: %s", expected, actual)
+	}
+}
+
+func TestFakeClock(t *testing.T) {
+
+	start := time.Unix(1000, 0)
+	clock := NewFakeClock(start)
+	if actual := clock.Now(); !actual.Equal(start) {
+		t.Fatalf("unexpected time\nwant: %v\n got: %v", start, actual)
+	}
+	clock.Advance(time.Minute)
+	if expected, actual := start.Add(time.Minute), clock.Now(); !actual.Equal(expected) {
+		t.Fatalf("unexpected time\nwant: %v\n got: %v", expected, actual)
+	}
+}
+
+func TestFakes_heatsink(t *testing.T) {
+
+	fan := &FakeFanDriver{}
+	sensor := &FakeThermoSensor{
+		TemperatureVals: []float64{40, 50},
+		TemperatureErrs: []error{nil, nil, heatsink.ErrThermoSensorClosed},
+	}
+	hs, err := heatsink.New(
+		&heatsink.Config{
+			Fan:            fan,
+			Sensors:        []heatsink.ThermoSensor{sensor},
+			MinTemperature: 35,
+			MaxTemperature: 55,
+		},
+		heatsink.OptFanResponse(heatsink.FanResponseLinear),
+		heatsink.OptTemperatureCheckPeriod(time.Millisecond),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hs.StartThermalControl(); !errors.Is(err, heatsink.ErrThermoSensorClosed) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", heatsink.ErrThermoSensorClosed, err)
+	}
+	if diff := deep.Equal(fan.DutyCycles(), []float64{0.25, 0.75}); diff != nil {
+		t.Fatal(diff)
+	}
+}
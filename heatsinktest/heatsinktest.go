@@ -0,0 +1,188 @@
+// Package heatsinktest provides a thermal sensor that replays a recorded temperature trace and
+// a fan driver that records the duty cycles it is given. Together, they allow testing fan
+// response curves and tuning heatsink parameters offline, e.g. in unit tests. It also provides
+// fakes with programmable readings and errors, and a fake clock, for applications that embed
+// the heatsink package
+package heatsinktest
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/malkhamis/heatsink"
+)
+
+// compile-time check for interface implementation and dependency inversion
+var (
+	_ heatsink.ThermoSensor = (*Sensor)(nil)
+	_ heatsink.FanDriver    = (*Fan)(nil)
+)
+
+// Sentinel errors that are wrapped and returned by this package
+var (
+	ErrEmptyTrace = errors.New("trace has no points")
+	ErrBadTrace   = errors.New("invalid trace")
+	ErrTraceEnded = errors.New("trace ended")
+)
+
+// Sensor is a thermal sensor that replays a temperature trace. By default, the trace is
+// replayed in real time starting with the first reading, which returns the temperature of the
+// latest point whose time has elapsed. Once the time of the last point has elapsed, readings
+// return ErrTraceEnded, which stops thermal control of a heatsink using this sensor.
+// Instances of this type are safe for concurrent use
+type Sensor struct {
+	name    string
+	trace   []Point
+	speed   float64
+	stepped bool
+	now     func() time.Time
+	start   time.Time
+	next    int
+	closed  bool
+	mutex   sync.Mutex
+}
+
+// NewSensor returns a sensor that replays the given trace, whose points must be sorted by
+// time. The times are relative to the first point, regardless of its time. For details about
+// options and defaults, see the documentation for type 'Option'
+func NewSensor(trace []Point, options ...Option) (*Sensor, error) {
+
+	if err := validateTrace(trace); err != nil {
+		return nil, err
+	}
+
+	cfg := newSettings("heatsinktest/sensor", options...)
+	s := &Sensor{
+		name:    cfg.name,
+		trace:   make([]Point, len(trace)),
+		speed:   cfg.speed,
+		stepped: cfg.stepped,
+		now:     cfg.now,
+	}
+	for i, p := range trace {
+		s.trace[i] = Point{Time: p.Time - trace[0].Time, Temperature: p.Temperature}
+	}
+	return s, nil
+}
+
+// Temperature returns the temperature of the current point of the trace. If the trace ended,
+// it returns ErrTraceEnded. If the sensor is closed, it returns heatsink.ErrThermoSensorClosed
+func (s *Sensor) Temperature() (float64, error) {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return 0, heatsink.ErrThermoSensorClosed
+	}
+
+	if s.stepped {
+		if s.next >= len(s.trace) {
+			return 0, fmt.Errorf("sensor '%s': %w", s.name, ErrTraceEnded)
+		}
+		s.next++
+		return s.trace[s.next-1].Temperature, nil
+	}
+
+	now := s.now()
+	if s.start.IsZero() {
+		s.start = now
+	}
+	elapsed := time.Duration(float64(now.Sub(s.start)) * s.speed)
+	if elapsed > s.trace[len(s.trace)-1].Time {
+		return 0, fmt.Errorf("sensor '%s': %w", s.name, ErrTraceEnded)
+	}
+	// the index of the first point after the elapsed time is never zero
+	i := sort.Search(len(s.trace), func(i int) bool { return s.trace[i].Time > elapsed })
+	return s.trace[i-1].Temperature, nil
+}
+
+// Name returns the name of this sensor
+func (s *Sensor) Name() string {
+	return s.name
+}
+
+// Close closes this sensor. If it is already closed, it returns heatsink.ErrThermoSensorClosed
+func (s *Sensor) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return heatsink.ErrThermoSensorClosed
+	}
+	s.closed = true
+	return nil
+}
+
+// Record is a duty cycle ratio that was given to a fan along with the time it was given
+type Record struct {
+	Time      time.Time
+	DutyCycle float64
+}
+
+// Fan is a fan driver that records the duty cycles it is given. Instances of this type are
+// safe for concurrent use
+type Fan struct {
+	name    string
+	now     func() time.Time
+	records []Record
+	closed  bool
+	mutex   sync.Mutex
+}
+
+// NewFan returns a fan driver that records the duty cycles it is given. Only the name option
+// applies to fans. For details about options and defaults, see the documentation for type
+// 'Option'
+func NewFan(options ...Option) *Fan {
+	cfg := newSettings("heatsinktest/fan", options...)
+	return &Fan{name: cfg.name, now: cfg.now}
+}
+
+// SetDutyCycle records the given duty cycle ratio. If the fan is closed, it returns
+// heatsink.ErrFanDriverClosed
+func (f *Fan) SetDutyCycle(dcRatio float64) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.closed {
+		return heatsink.ErrFanDriverClosed
+	}
+	f.records = append(f.records, Record{Time: f.now(), DutyCycle: dcRatio})
+	return nil
+}
+
+// Records returns a copy of the duty cycles recorded so far, in the order they were given
+func (f *Fan) Records() []Record {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]Record(nil), f.records...)
+}
+
+// DutyCycles returns the duty cycle ratios recorded so far, in the order they were given
+func (f *Fan) DutyCycles() []float64 {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	dutyCycles := make([]float64, len(f.records))
+	for i, r := range f.records {
+		dutyCycles[i] = r.DutyCycle
+	}
+	return dutyCycles
+}
+
+// Name returns the name of this fan
+func (f *Fan) Name() string {
+	return f.name
+}
+
+// Close closes this fan. Recorded duty cycles remain available. If it is already closed, it
+// returns heatsink.ErrFanDriverClosed
+func (f *Fan) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.closed {
+		return heatsink.ErrFanDriverClosed
+	}
+	f.closed = true
+	return nil
+}
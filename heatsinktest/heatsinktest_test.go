@@ -0,0 +1,159 @@
+package heatsinktest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/malkhamis/heatsink"
+)
+
+func TestNewSensor_errors(t *testing.T) {
+
+	cases := map[string]struct {
+		trace       []Point
+		expectedErr error
+	}{
+		"empty":    {trace: nil, expectedErr: ErrEmptyTrace},
+		"unsorted": {trace: []Point{{Time: time.Second}, {Time: 0}}, expectedErr: ErrBadTrace},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			_, err := NewSensor(c.trace)
+			if !errors.Is(err, c.expectedErr) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", c.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestSensor_Temperature_realTime(t *testing.T) {
+
+	trace := []Point{
+		{Time: 10 * time.Second, Temperature: 40},
+		{Time: 11 * time.Second, Temperature: 45},
+		{Time: 13 * time.Second, Temperature: 50},
+	}
+	sensor, err := NewSensor(trace, OptSpeed(2), OptName("trace"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "trace", sensor.Name(); actual != expected {
+		t.Fatalf("unexpected name\nwant: %s\n got: %s", expected, actual)
+	}
+
+	start := time.Now()
+	var elapsed time.Duration
+	sensor.now = func() time.Time { return start.Add(elapsed) }
+
+	// at twice the speed, the trace times are halved
+	cases := []struct {
+		elapsed  time.Duration
+		expected float64
+	}{
+		{elapsed: 0, expected: 40},
+		{elapsed: 499 * time.Millisecond, expected: 40},
+		{elapsed: 500 * time.Millisecond, expected: 45},
+		{elapsed: 1499 * time.Millisecond, expected: 45},
+		{elapsed: 1500 * time.Millisecond, expected: 50},
+	}
+	for _, c := range cases {
+		elapsed = c.elapsed
+		temp, err := sensor.Temperature()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if temp != c.expected {
+			t.Fatalf("unexpected temperature after %v\nwant: %v\n got: %v", c.elapsed, c.expected, temp)
+		}
+	}
+
+	elapsed = 1501 * time.Millisecond
+	if _, err := sensor.Temperature(); !errors.Is(err, ErrTraceEnded) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", ErrTraceEnded, err)
+	}
+}
+
+func TestSensor_Close(t *testing.T) {
+
+	sensor, err := NewSensor([]Point{{Temperature: 40}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sensor.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sensor.Temperature(); !errors.Is(err, heatsink.ErrThermoSensorClosed) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", heatsink.ErrThermoSensorClosed, err)
+	}
+	if err := sensor.Close(); !errors.Is(err, heatsink.ErrThermoSensorClosed) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", heatsink.ErrThermoSensorClosed, err)
+	}
+}
+
+func TestFan(t *testing.T) {
+
+	fan := NewFan()
+	if expected, actual := "heatsinktest/fan", fan.Name(); actual != expected {
+		t.Fatalf("unexpected name\nwant: %s\n got: %s", expected, actual)
+	}
+
+	at := time.Now()
+	fan.now = func() time.Time { return at }
+	for _, dc := range []float64{0.2, 0.4} {
+		if err := fan.SetDutyCycle(dc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fan.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := fan.SetDutyCycle(1); !errors.Is(err, heatsink.ErrFanDriverClosed) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", heatsink.ErrFanDriverClosed, err)
+	}
+	if err := fan.Close(); !errors.Is(err, heatsink.ErrFanDriverClosed) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", heatsink.ErrFanDriverClosed, err)
+	}
+
+	expected := []Record{{Time: at, DutyCycle: 0.2}, {Time: at, DutyCycle: 0.4}}
+	if diff := deep.Equal(fan.Records(), expected); diff != nil {
+		t.Fatal(diff)
+	}
+	if diff := deep.Equal(fan.DutyCycles(), []float64{0.2, 0.4}); diff != nil {
+		t.Fatal(diff)
+	}
+}
+
+func TestReplay_heatsink(t *testing.T) {
+
+	trace := []Point{{Temperature: 40}, {Temperature: 50}, {Temperature: 55}}
+	sensor, err := NewSensor(trace, OptStepped(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fan := NewFan()
+
+	hs, err := heatsink.New(
+		&heatsink.Config{
+			Fan:            fan,
+			Sensors:        []heatsink.ThermoSensor{sensor},
+			MinTemperature: 35,
+			MaxTemperature: 55,
+		},
+		heatsink.OptFanResponse(heatsink.FanResponseLinear),
+		heatsink.OptTemperatureCheckPeriod(time.Millisecond),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hs.StartThermalControl(); !errors.Is(err, ErrTraceEnded) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", ErrTraceEnded, err)
+	}
+	if diff := deep.Equal(fan.DutyCycles(), []float64{0.25, 0.75, 1}); diff != nil {
+		t.Fatal(diff)
+	}
+}
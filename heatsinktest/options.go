@@ -0,0 +1,56 @@
+package heatsinktest
+
+import "time"
+
+// Option is used to pass optional parameters to the NewSensor and NewFan factory functions
+type Option func(*settings)
+
+// settings holds the values of the options
+type settings struct {
+	name    string
+	speed   float64
+	stepped bool
+	now     func() time.Time
+}
+
+func newSettings(defaultName string, options ...Option) *settings {
+	cfg := &settings{name: defaultName, speed: 1, now: time.Now}
+	for _, opt := range options {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// OptName sets the name of the sensor or fan. If name is empty, it is set to the default value
+//
+// (default: "heatsinktest/sensor" or "heatsinktest/fan")
+func OptName(name string) Option {
+	return func(cfg *settings) {
+		if name != "" {
+			cfg.name = name
+		}
+	}
+}
+
+// OptSpeed replays the trace faster or slower than real time by the given factor, e.g. a
+// factor of 60 replays an hour-long trace in a minute. If factor is not positive, it is set to
+// the default value
+//
+// (default: 1)
+func OptSpeed(factor float64) Option {
+	return func(cfg *settings) {
+		if factor > 0 {
+			cfg.speed = factor
+		}
+	}
+}
+
+// OptStepped ignores the times of the trace and advances it by one point on every reading,
+// which makes replaying deterministic regardless of how often the sensor is read
+//
+// (default: false)
+func OptStepped(enabled bool) Option {
+	return func(cfg *settings) {
+		cfg.stepped = enabled
+	}
+}
@@ -0,0 +1,86 @@
+package heatsinktest
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Point is a temperature reading of a trace at a time relative to the start of the trace
+type Point struct {
+	Time        time.Duration
+	Temperature float64
+}
+
+// ReadCSV reads a trace from CSV data, where every record consists of the time of a reading in
+// seconds followed by the temperature. The first record is skipped if it is a header, i.e. if
+// its time is not a number
+func ReadCSV(r io.Reader) ([]Point, error) {
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadTrace, err)
+	}
+
+	var trace []Point
+	for i, record := range records {
+		seconds, err := strconv.ParseFloat(record[0], 64)
+		if err != nil && i == 0 {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrBadTrace, i+1, err)
+		}
+		temp, err := strconv.ParseFloat(record[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrBadTrace, i+1, err)
+		}
+		trace = append(trace, Point{Time: secondsToDuration(seconds), Temperature: temp})
+	}
+	return trace, nil
+}
+
+// ReadJSON reads a trace from a JSON array of objects, where every object has the field 'time'
+// set to the time of a reading in seconds and the field 'temperature'
+func ReadJSON(r io.Reader) ([]Point, error) {
+
+	var points []struct {
+		Time        *float64 `json:"time"`
+		Temperature *float64 `json:"temperature"`
+	}
+	if err := json.NewDecoder(r).Decode(&points); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadTrace, err)
+	}
+
+	trace := make([]Point, 0, len(points))
+	for i, p := range points {
+		if p.Time == nil || p.Temperature == nil {
+			return nil, fmt.Errorf("%w: point %d: missing time or temperature", ErrBadTrace, i)
+		}
+		trace = append(trace, Point{Time: secondsToDuration(*p.Time), Temperature: *p.Temperature})
+	}
+	return trace, nil
+}
+
+// validateTrace ensures the given trace is not empty and is sorted by time
+func validateTrace(trace []Point) error {
+	if len(trace) == 0 {
+		return ErrEmptyTrace
+	}
+	for i := 1; i < len(trace); i++ {
+		if trace[i].Time < trace[i-1].Time {
+			return fmt.Errorf("%w: point %d is earlier than its predecessor", ErrBadTrace, i)
+		}
+	}
+	return nil
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
@@ -0,0 +1,84 @@
+package heatsinktest
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+)
+
+func TestReadCSV(t *testing.T) {
+
+	data := "time,temperature\n0, 40\n1.5,45.5\n3,50\n"
+	trace, err := ReadCSV(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Point{
+		{Time: 0, Temperature: 40},
+		{Time: 1500 * time.Millisecond, Temperature: 45.5},
+		{Time: 3 * time.Second, Temperature: 50},
+	}
+	if diff := deep.Equal(trace, expected); diff != nil {
+		t.Fatal(diff)
+	}
+}
+
+func TestReadCSV_errors(t *testing.T) {
+
+	cases := map[string]string{
+		"time":          "0,40\nx,45\n",
+		"temperature":   "0,40\n1,x\n",
+		"field-count":   "0,40\n1\n",
+		"second-header": "time,temperature\nx,1\n",
+	}
+
+	for name, data := range cases {
+		data := data
+		t.Run(name, func(t *testing.T) {
+			_, err := ReadCSV(strings.NewReader(data))
+			if !errors.Is(err, ErrBadTrace) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", ErrBadTrace, err)
+			}
+		})
+	}
+}
+
+func TestReadJSON(t *testing.T) {
+
+	data := `[{"time": 0, "temperature": 40}, {"time": 0.5, "temperature": 42}]`
+	trace, err := ReadJSON(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Point{
+		{Time: 0, Temperature: 40},
+		{Time: 500 * time.Millisecond, Temperature: 42},
+	}
+	if diff := deep.Equal(trace, expected); diff != nil {
+		t.Fatal(diff)
+	}
+}
+
+func TestReadJSON_errors(t *testing.T) {
+
+	cases := map[string]string{
+		"syntax":      `[{"time": 0,`,
+		"time":        `[{"temperature": 40}]`,
+		"temperature": `[{"time": 0}]`,
+	}
+
+	for name, data := range cases {
+		data := data
+		t.Run(name, func(t *testing.T) {
+			_, err := ReadJSON(strings.NewReader(data))
+			if !errors.Is(err, ErrBadTrace) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", ErrBadTrace, err)
+			}
+		})
+	}
+}
@@ -1,10 +1,14 @@
 package heatsink
 
-import "sync"
+import (
+	"sync"
+	"time"
+)
 
 var (
 	_ FanDriver    = (*fakeFanDriver)(nil)
 	_ ThermoSensor = (*fakeThermoSensor)(nil)
+	_ ThermoSensor = (*concurrencyTrackingSensor)(nil)
 	_ dutyCycler   = (*fakeDutyCycler)(nil)
 )
 
@@ -85,6 +89,44 @@ func (fts *fakeThermoSensor) Name() string {
 	return fts.onName
 }
 
+// concurrencyTracker counts the calls in progress of the sensors that share it and records the
+// peak count
+type concurrencyTracker struct {
+	active int
+	peak   int
+	mutex  sync.Mutex
+}
+
+func (ct *concurrencyTracker) peakCalls() int {
+	ct.mutex.Lock()
+	defer ct.mutex.Unlock()
+	return ct.peak
+}
+
+// concurrencyTrackingSensor is a sensor that takes a while to read and reports its calls to a
+// shared tracker
+type concurrencyTrackingSensor struct {
+	fakeThermoSensor
+	tracker *concurrencyTracker
+}
+
+func (cts *concurrencyTrackingSensor) Temperature() (float64, error) {
+	cts.tracker.mutex.Lock()
+	cts.tracker.active++
+	if cts.tracker.active > cts.tracker.peak {
+		cts.tracker.peak = cts.tracker.active
+	}
+	cts.tracker.mutex.Unlock()
+
+	time.Sleep(5 * time.Millisecond) // gives other calls a chance to overlap
+	defer func() {
+		cts.tracker.mutex.Lock()
+		cts.tracker.active--
+		cts.tracker.mutex.Unlock()
+	}()
+	return cts.fakeThermoSensor.Temperature()
+}
+
 type fakeDutyCycler struct {
 	tmpToDC map[float64]float64
 }
@@ -92,3 +134,43 @@ type fakeDutyCycler struct {
 func (fdc *fakeDutyCycler) ratio(temp float64) (dcRatio float64) {
 	return fdc.tmpToDC[temp]
 }
+
+func iter(n int) []struct{} {
+	return make([]struct{}, n)
+}
+
+var _ AuxInput = (*fakeAuxInput)(nil)
+
+type fakeAuxInput struct {
+	onValueVals   []float64
+	onValueErrs   []error
+	onCloseErr    error
+	numCloseCalls int
+	mutex         sync.Mutex
+}
+
+func (fai *fakeAuxInput) Value() (val float64, err error) {
+	fai.mutex.Lock()
+	defer fai.mutex.Unlock()
+
+	if len(fai.onValueVals) > 0 {
+		val = fai.onValueVals[0]
+		fai.onValueVals = fai.onValueVals[1:]
+	}
+	if len(fai.onValueErrs) > 0 {
+		err = fai.onValueErrs[0]
+		fai.onValueErrs = fai.onValueErrs[1:]
+	}
+	return
+}
+
+func (fai *fakeAuxInput) Close() error {
+	fai.mutex.Lock()
+	defer fai.mutex.Unlock()
+	fai.numCloseCalls++
+	return fai.onCloseErr
+}
+
+func (fai *fakeAuxInput) Name() string {
+	return "aux"
+}
@@ -0,0 +1,41 @@
+package heatsink
+
+import "time"
+
+// DutyCycleBands is the number of equally wide duty cycle bands of a DutyCycleHistogram
+const DutyCycleBands = 10
+
+// DutyCycleHistogram is the time a fan spent in each duty cycle band, where band i covers the
+// duty cycle ratios in [i/10, (i+1)/10) and the last band also includes a ratio of one
+type DutyCycleHistogram [DutyCycleBands]time.Duration
+
+// Total returns the time spent in all bands
+func (h DutyCycleHistogram) Total() time.Duration {
+	var total time.Duration
+	for _, d := range h {
+		total += d
+	}
+	return total
+}
+
+// add attributes the given duration to the band of the given duty cycle ratio
+func (h *DutyCycleHistogram) add(dcRatio float64, d time.Duration) {
+	band := int(dcRatio * DutyCycleBands)
+	if band < 0 {
+		band = 0
+	}
+	if band >= DutyCycleBands {
+		band = DutyCycleBands - 1
+	}
+	h[band] += d
+}
+
+// DutyCycleHistogram returns the time the fan spent in each duty cycle band, which is useful
+// to estimate the consumed lifetime of the fan. The time between two consecutive control
+// iterations is attributed to the duty cycle applied in the earlier one. It is safe to call it
+// concurrently with thermal control
+func (hs *Heatsink) DutyCycleHistogram() DutyCycleHistogram {
+	hs.smplMutex.RLock()
+	defer hs.smplMutex.RUnlock()
+	return hs.histogram
+}
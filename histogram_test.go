@@ -0,0 +1,43 @@
+package heatsink
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+)
+
+func TestDutyCycleHistogram_add(t *testing.T) {
+	t.Parallel()
+
+	var h DutyCycleHistogram
+	for _, dc := range []float64{-0.1, 0, 0.09, 0.1, 0.55, 0.99, 1, 1.2} {
+		h.add(dc, time.Second)
+	}
+
+	expected := DutyCycleHistogram{3 * time.Second, time.Second, 0, 0, 0, time.Second, 0, 0, 0, 3 * time.Second}
+	if diff := deep.Equal(h, expected); diff != nil {
+		t.Fatal(diff)
+	}
+	if expected, actual := 8*time.Second, h.Total(); actual != expected {
+		t.Fatalf("unexpected total\nwant: %v\n got: %v", expected, actual)
+	}
+}
+
+func TestHeatsink_DutyCycleHistogram(t *testing.T) {
+	t.Parallel()
+
+	initial := DutyCycleHistogram{time.Minute}
+	hs := &Heatsink{}
+	OptDutyCycleHistogram(initial)(nil, hs)
+
+	start := time.Now()
+	hs.recordSample(Sample{Time: start, DutyCycle: 0.05})
+	hs.recordSample(Sample{Time: start.Add(2 * time.Second), DutyCycle: 0.75})
+	hs.recordSample(Sample{Time: start.Add(5 * time.Second), DutyCycle: 0.05})
+
+	expected := DutyCycleHistogram{time.Minute + 2*time.Second, 0, 0, 0, 0, 0, 0, 3 * time.Second}
+	if diff := deep.Equal(hs.DutyCycleHistogram(), expected); diff != nil {
+		t.Fatal(diff)
+	}
+}
@@ -0,0 +1,80 @@
+package heatsink
+
+import (
+	"fmt"
+)
+
+// AddSensor adds the given sensor to the sensors whose temperatures are monitored, e.g. one that
+// was plugged in at runtime, and takes ownership of it. Its health is tracked from scratch. It
+// returns ErrSensorExists if a sensor of the same name is monitored already, or
+// ErrControllerStopped if the heatsink is stopped, in which case the caller keeps owning the
+// sensor. It is safe to call it concurrently with thermal control
+func (hs *Heatsink) AddSensor(sensor ThermoSensor) error {
+
+	if sensor == nil {
+		return ErrNilSensor
+	}
+	hs.sensorMutex.Lock()
+	defer hs.sensorMutex.Unlock()
+
+	if hs.Stopped() {
+		return ErrControllerStopped
+	}
+	if hs.sensorIndex(sensor.Name()) >= 0 {
+		return fmt.Errorf("%w: '%s'", ErrSensorExists, sensor.Name())
+	}
+	hs.sensors = append(hs.sensors, sensor)
+	if q := hs.quarantine; q != nil {
+		q.health = append(q.health, sensorHealth{bad: make([]bool, q.Window)})
+	}
+	if lg := hs.lastGood; lg != nil {
+		lg.temps, lg.ok, lg.misses = append(lg.temps, 0), append(lg.ok, false), append(lg.misses, 0)
+	}
+	return nil
+}
+
+// RemoveSensor stops monitoring the sensor of the given name, e.g. one that was unplugged at
+// runtime, and closes it. It returns ErrUnknownSensor if no such sensor is monitored, and
+// ErrNoSensors if it is the only one, since the heatsink cannot be controlled without sensors.
+// It is safe to call it concurrently with thermal control
+func (hs *Heatsink) RemoveSensor(name string) error {
+
+	hs.sensorMutex.Lock()
+	i := hs.sensorIndex(name)
+	if i < 0 {
+		hs.sensorMutex.Unlock()
+		return fmt.Errorf("%w: '%s'", ErrUnknownSensor, name)
+	}
+	if len(hs.sensors) == 1 {
+		hs.sensorMutex.Unlock()
+		return fmt.Errorf("%w: cannot remove the only sensor '%s'", ErrNoSensors, name)
+	}
+	sensor := hs.sensors[i]
+	hs.sensors = append(hs.sensors[:i:i], hs.sensors[i+1:]...)
+	if q := hs.quarantine; q != nil {
+		q.health = append(q.health[:i:i], q.health[i+1:]...)
+	}
+	if lg := hs.lastGood; lg != nil {
+		lg.temps = append(lg.temps[:i:i], lg.temps[i+1:]...)
+		lg.ok = append(lg.ok[:i:i], lg.ok[i+1:]...)
+		lg.misses = append(lg.misses[:i:i], lg.misses[i+1:]...)
+	}
+	hs.sensorMutex.Unlock()
+
+	// the sensor is closed outside the lock, so that a slow device does not hold up thermal control
+	if err := sensor.Close(); err != nil {
+		return fmt.Errorf("error closing sensor '%s': %w", name, err)
+	}
+	return nil
+}
+
+// sensorIndex returns the index of the sensor of the given name, or -1 if there is none. It
+// must be called with sensorMutex held
+func (hs *Heatsink) sensorIndex(name string) int {
+	for i, sensor := range hs.sensors {
+		if sensor.Name() == name {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,80 @@
+package heatsink
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestHeatsink_AddSensor_RemoveSensor(t *testing.T) {
+	t.Parallel()
+
+	first := &fakeThermoSensor{onName: "first", onTemperatureVals: []float64{40, 40}}
+	hs, err := New(
+		&Config{Fan: &fakeFanDriver{}, Sensors: []ThermoSensor{first}, MaxTemperature: 100},
+		OptSensorQuarantine(SensorQuarantine{MaxJump: 20}),
+		OptLastKnownGood(2),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	probe := &fakeThermoSensor{onName: "probe", onTemperatureVals: []float64{60}}
+	if err := hs.AddSensor(probe); err != nil {
+		t.Fatal(err)
+	}
+	if err := hs.AddSensor(&fakeThermoSensor{onName: "probe"}); !errors.Is(err, ErrSensorExists) {
+		t.Errorf("unexpected error\nwant: %v\n got: %v", ErrSensorExists, err)
+	}
+	if err := hs.AddSensor(nil); !errors.Is(err, ErrNilSensor) {
+		t.Errorf("unexpected error\nwant: %v\n got: %v", ErrNilSensor, err)
+	}
+	if diff := deep.Equal(hs.SensorNames(), []string{"first", "probe"}); diff != nil {
+		t.Error(diff)
+	}
+	if len(hs.quarantine.health) != 2 || len(hs.quarantine.health[1].bad) != 10 || len(hs.lastGood.temps) != 2 {
+		t.Fatalf("expected the health of the added sensor to be tracked, got: %+v %+v", hs.quarantine, hs.lastGood)
+	}
+
+	max, hottest, _, err := hs.maxCoreTemp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if max != 60 || hottest != "probe" {
+		t.Errorf("unexpected hottest sensor\nwant: %v (%s)\n got: %v (%s)", 60.0, "probe", max, hottest)
+	}
+
+	if err := hs.RemoveSensor("probe"); err != nil {
+		t.Fatal(err)
+	}
+	if probe.numCloseCalls != 1 {
+		t.Errorf("expected the removed sensor to be closed once, got: %d", probe.numCloseCalls)
+	}
+	if err := hs.RemoveSensor("probe"); !errors.Is(err, ErrUnknownSensor) {
+		t.Errorf("unexpected error\nwant: %v\n got: %v", ErrUnknownSensor, err)
+	}
+	if err := hs.RemoveSensor("first"); !errors.Is(err, ErrNoSensors) {
+		t.Errorf("unexpected error\nwant: %v\n got: %v", ErrNoSensors, err)
+	}
+	if diff := deep.Equal(hs.SensorNames(), []string{"first"}); diff != nil {
+		t.Error(diff)
+	}
+	if len(hs.quarantine.health) != 1 || len(hs.lastGood.temps) != 1 || len(hs.lastGood.ok) != 1 || len(hs.lastGood.misses) != 1 {
+		t.Fatalf("expected the health of the removed sensor to be dropped, got: %+v %+v", hs.quarantine, hs.lastGood)
+	}
+	if max, hottest, _, err = hs.maxCoreTemp(); err != nil || hottest != "first" {
+		t.Errorf("unexpected hottest sensor\nwant: %v (%s)\n got: %v (%s), %v", 40.0, "first", max, hottest, err)
+	}
+
+	if err := hs.StopThermalControl(); err != nil {
+		t.Fatal(err)
+	}
+	late := &fakeThermoSensor{onName: "late"}
+	if err := hs.AddSensor(late); !errors.Is(err, ErrControllerStopped) {
+		t.Errorf("unexpected error\nwant: %v\n got: %v", ErrControllerStopped, err)
+	}
+	if late.numCloseCalls != 0 {
+		t.Error("expected a sensor that was not added to be left to the caller")
+	}
+}
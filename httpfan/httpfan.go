@@ -0,0 +1,144 @@
+// Package httpfan provides an implementation of the heatsink.FanDriver interface that forwards
+// duty cycles to a remote agent over HTTP, which lets a central controller drive the fans of
+// other hosts or of microcontroller-based fan hubs.
+//
+// The protocol is deliberately small so that it fits on a microcontroller: every duty cycle is
+// sent as 'PUT <url>' with the JSON body '{"duty_cycle": <ratio>}', where ratio is in
+// [0.0, 1.0], and any 2xx response acknowledges it. A duty cycle is sent on every call to
+// SetDutyCycle, even if it did not change, so that agents can treat missing updates as a lost
+// controller and fall back to a safe speed
+package httpfan
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/malkhamis/heatsink"
+)
+
+// compile-time check for interface implementation and dependency inversion
+var _ heatsink.FanDriver = (*Fan)(nil)
+
+// Sentinel errors that are wrapped and returned by this package
+var (
+	ErrBadURL     = errors.New("url must be absolute and use http or https")
+	ErrBadTimeout = errors.New("timeout must be positive")
+	ErrBadStatus  = errors.New("unexpected response status")
+)
+
+// Request is the body of a request that sets the duty cycle of a remote fan
+type Request struct {
+	DutyCycle float64 `json:"duty_cycle"`
+}
+
+// Fan forwards duty cycles to a remote fan. Instances of this type are safe for concurrent use
+type Fan struct {
+	name    string
+	url     string
+	headers http.Header
+	timeout time.Duration
+	client  *http.Client
+	mutex   sync.Mutex
+	closed  bool
+}
+
+// New returns a fan driver for the remote fan at the given url. The agent is not contacted
+// until the first duty cycle is set. For details about options and defaults, see the
+// documentation for type 'Option'
+func New(rawURL string, options ...Option) (*Fan, error) {
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadURL, err)
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("%w: '%s'", ErrBadURL, rawURL)
+	}
+
+	fan := &Fan{ // defaults
+		name:    rawURL,
+		url:     rawURL,
+		headers: make(http.Header),
+		timeout: 2 * time.Second,
+	}
+	for _, applyOption := range options {
+		if applyOption == nil {
+			continue
+		}
+		applyOption(fan)
+	}
+	if fan.timeout <= 0 {
+		return nil, fmt.Errorf("%w: %v", ErrBadTimeout, fan.timeout)
+	}
+	fan.client = &http.Client{Timeout: fan.timeout}
+	return fan, nil
+}
+
+// SetDutyCycle sends the given duty cycle, clamped to [0.0, 1.0], to the remote agent. If the
+// fan driver is closed, it returns heatsink.ErrFanDriverClosed
+func (f *Fan) SetDutyCycle(dcRatio float64) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.closed {
+		return heatsink.ErrFanDriverClosed
+	}
+	return f.send(dcRatio)
+}
+
+func (f *Fan) send(dcRatio float64) error {
+
+	body, err := json.Marshal(Request{DutyCycle: math.Max(0, math.Min(1, dcRatio))})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPut, f.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for key, values := range f.headers {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%w: %s", ErrBadStatus, resp.Status)
+	}
+	return nil
+}
+
+// Close sets the remote fan to its maximum speed so that the remote hardware remains cooled
+// once the controller stops. If the fan driver is already closed, it returns
+// heatsink.ErrFanDriverClosed
+func (f *Fan) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.closed {
+		return heatsink.ErrFanDriverClosed
+	}
+	f.closed = true
+	defer f.client.CloseIdleConnections()
+	if err := f.send(1); err != nil {
+		return fmt.Errorf("failed to set fan speed to max while closing driver: %w", err)
+	}
+	return nil
+}
+
+// Name returns the name of this fan driver
+func (f *Fan) Name() string {
+	return f.name
+}
@@ -0,0 +1,99 @@
+package httpfan
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/malkhamis/heatsink"
+)
+
+func TestNew_errors(t *testing.T) {
+
+	cases := map[string]struct {
+		url         string
+		options     []Option
+		expectedErr error
+	}{
+		"relative":    {url: "/fans/cpu", expectedErr: ErrBadURL},
+		"scheme":      {url: "tcp://hub:8080/fans/cpu", expectedErr: ErrBadURL},
+		"unparseable": {url: "http://hub:port/", expectedErr: ErrBadURL},
+		"timeout":     {url: "http://hub/fans/cpu", options: []Option{OptTimeout(-1)}, expectedErr: ErrBadTimeout},
+		"valid":       {url: "http://hub/fans/cpu", options: []Option{nil}},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			_, err := New(c.url, c.options...)
+			if !errors.Is(err, c.expectedErr) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", c.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestFan_lifeCycle(t *testing.T) {
+
+	var (
+		mutex    sync.Mutex
+		received []float64
+		status   = http.StatusNoContent
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if r.Method != http.MethodPut || r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var req Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received = append(received, req.DutyCycle)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	fan, err := New(server.URL+"/fans/cpu", OptName("hub/cpu"), OptHeader("Authorization", "Bearer secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fan.Name() != "hub/cpu" {
+		t.Fatalf("unexpected name\nwant: hub/cpu\n got: %s", fan.Name())
+	}
+	for _, dc := range []float64{0.25, 0.25, 1.5, -0.5} {
+		if err := fan.SetDutyCycle(dc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mutex.Lock()
+	status = http.StatusInternalServerError
+	mutex.Unlock()
+	if err := fan.SetDutyCycle(0.5); !errors.Is(err, ErrBadStatus) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", ErrBadStatus, err)
+	}
+	mutex.Lock()
+	status = http.StatusOK
+	mutex.Unlock()
+
+	if err := fan.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(received, []float64{0.25, 0.25, 1, 0, 0.5, 1}); diff != nil {
+		t.Fatal(diff)
+	}
+	if err := fan.SetDutyCycle(0.5); !errors.Is(err, heatsink.ErrFanDriverClosed) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", heatsink.ErrFanDriverClosed, err)
+	}
+	if err := fan.Close(); !errors.Is(err, heatsink.ErrFanDriverClosed) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", heatsink.ErrFanDriverClosed, err)
+	}
+}
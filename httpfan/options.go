@@ -0,0 +1,37 @@
+package httpfan
+
+import "time"
+
+// Option is used to pass optional parameters to the fan driver's factory function
+type Option func(*Fan)
+
+// OptName sets the name of the fan driver. if name is empty, it is set to the default value
+//
+// (default: the url)
+func OptName(name string) Option {
+	return func(f *Fan) {
+		if name != "" {
+			f.name = name
+		}
+	}
+}
+
+// OptHeader adds a header that is sent with every request, e.g. 'Authorization' with a bearer
+// token. It may be passed several times
+//
+// (default: none)
+func OptHeader(key, value string) Option {
+	return func(f *Fan) {
+		f.headers.Add(key, value)
+	}
+}
+
+// OptTimeout sets how long a request may take. It should be well below the check period of
+// the heatsink so that an unreachable agent does not stall the control loop
+//
+// (default: 2s)
+func OptTimeout(timeout time.Duration) Option {
+	return func(f *Fan) {
+		f.timeout = timeout
+	}
+}
@@ -0,0 +1,174 @@
+// Package httpsense provides an implementation of the heatsink.ThermoSensor interface that
+// fetches temperatures from a remote HTTP endpoint returning JSON, which lets the fans of one
+// machine respond to the temperature of another device, e.g. the enclosure sensor of a NAS
+package httpsense
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/malkhamis/heatsink"
+)
+
+// compile-time check for interface implementation and dependency inversion
+var _ heatsink.ThermoSensor = (*Sensor)(nil)
+
+// Sentinel errors that are wrapped and returned by this package
+var (
+	ErrBadURL       = errors.New("url must be absolute and use http or https")
+	ErrBadTimeout   = errors.New("timeout must be positive")
+	ErrBadStatus    = errors.New("unexpected response status")
+	ErrBadJSON      = errors.New("response is not valid json")
+	ErrPathNotFound = errors.New("json path not found in response")
+	ErrNotNumber    = errors.New("value at json path is not a number")
+)
+
+// maxResponseSize caps how much of a response is read, which guards against endpoints that
+// return something other than a small json document
+const maxResponseSize = 1 << 20
+
+// Sensor reads the temperature from a remote HTTP endpoint on every call to Temperature. The
+// endpoint is not contacted until then, so a remote device that is still booting does not
+// prevent the sensor from being created. Instances of this type are safe for concurrent use
+type Sensor struct {
+	name     string
+	url      string
+	jsonPath []string
+	headers  http.Header
+	timeout  time.Duration
+	client   *http.Client
+	mutex    sync.RWMutex
+	closed   bool
+}
+
+// New returns a new thermal sensor that fetches the temperature from the given url. For
+// details about options and defaults, see the documentation for type 'Option'
+func New(rawURL string, options ...Option) (*Sensor, error) {
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadURL, err)
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("%w: '%s'", ErrBadURL, rawURL)
+	}
+
+	sensor := &Sensor{ // defaults
+		name:     rawURL,
+		url:      rawURL,
+		jsonPath: []string{"temperature"},
+		headers:  make(http.Header),
+		timeout:  5 * time.Second,
+	}
+	for _, applyOption := range options {
+		if applyOption == nil {
+			continue
+		}
+		applyOption(sensor)
+	}
+	if sensor.timeout <= 0 {
+		return nil, fmt.Errorf("%w: %v", ErrBadTimeout, sensor.timeout)
+	}
+	sensor.client = &http.Client{Timeout: sensor.timeout}
+	return sensor, nil
+}
+
+// Temperature fetches the current temperature in degrees celsius and returns it as well as any
+// error encountered. If the sensor is closed, it returns heatsink.ErrThermoSensorClosed
+func (s *Sensor) Temperature() (float64, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.closed {
+		return math.Inf(1), heatsink.ErrThermoSensorClosed
+	}
+
+	req, err := http.NewRequest(http.MethodGet, s.url, nil)
+	if err != nil {
+		return math.Inf(1), err
+	}
+	for key, values := range s.headers {
+		req.Header[key] = values
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return math.Inf(1), err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxResponseSize))
+		return math.Inf(1), fmt.Errorf("%w: %s", ErrBadStatus, resp.Status)
+	}
+
+	var document interface{}
+	decoder := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize))
+	decoder.UseNumber()
+	if err := decoder.Decode(&document); err != nil {
+		return math.Inf(1), fmt.Errorf("%w: %v", ErrBadJSON, err)
+	}
+	return lookup(document, s.jsonPath)
+}
+
+// lookup walks the given path through a decoded json document and returns the number at its
+// end. Path elements index objects by key and arrays by position
+func lookup(document interface{}, path []string) (float64, error) {
+
+	node := document
+	for i, element := range path {
+		switch typed := node.(type) {
+		case map[string]interface{}:
+			child, ok := typed[element]
+			if !ok {
+				return math.Inf(1), fmt.Errorf("%w: '%s'", ErrPathNotFound, strings.Join(path[:i+1], "."))
+			}
+			node = child
+		case []interface{}:
+			index, err := strconv.Atoi(element)
+			if err != nil || index < 0 || index >= len(typed) {
+				return math.Inf(1), fmt.Errorf("%w: '%s'", ErrPathNotFound, strings.Join(path[:i+1], "."))
+			}
+			node = typed[index]
+		default:
+			return math.Inf(1), fmt.Errorf("%w: '%s'", ErrPathNotFound, strings.Join(path[:i+1], "."))
+		}
+	}
+
+	number, ok := node.(json.Number)
+	if !ok {
+		return math.Inf(1), fmt.Errorf("%w: %v", ErrNotNumber, node)
+	}
+	temp, err := number.Float64()
+	if err != nil {
+		return math.Inf(1), fmt.Errorf("%w: %v", ErrNotNumber, err)
+	}
+	return temp, nil
+}
+
+// Close closes this sensor. If the sensor was previously closed, it returns
+// heatsink.ErrThermoSensorClosed
+func (s *Sensor) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return heatsink.ErrThermoSensorClosed
+	}
+	s.closed = true
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// Name returns the name of this sensor
+func (s *Sensor) Name() string {
+	return s.name
+}
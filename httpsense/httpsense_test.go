@@ -0,0 +1,124 @@
+package httpsense
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/malkhamis/heatsink"
+)
+
+func TestNew_errors(t *testing.T) {
+
+	cases := map[string]struct {
+		url         string
+		options     []Option
+		expectedErr error
+	}{
+		"relative":    {url: "/temperature", expectedErr: ErrBadURL},
+		"scheme":      {url: "ftp://nas/temperature", expectedErr: ErrBadURL},
+		"unparseable": {url: "http://nas:port/", expectedErr: ErrBadURL},
+		"timeout":     {url: "http://nas/", options: []Option{OptTimeout(0)}, expectedErr: ErrBadTimeout},
+		"valid":       {url: "https://nas/api/temperature", options: []Option{nil}},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			_, err := New(c.url, c.options...)
+			if !errors.Is(err, c.expectedErr) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", c.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestSensor_Temperature(t *testing.T) {
+
+	cases := map[string]struct {
+		status       int
+		body         string
+		jsonPath     string
+		expectedTemp float64
+		expectedErr  error
+	}{
+		"default path": {body: `{"temperature": 41.5}`, jsonPath: "temperature", expectedTemp: 41.5},
+		"nested":       {body: `{"sensors": [{"temp": 30}, {"temp": 38.25}]}`, jsonPath: "sensors.1.temp", expectedTemp: 38.25},
+		"whole body":   {body: `27`, jsonPath: "", expectedTemp: 27},
+		"bad status":   {status: http.StatusUnauthorized, expectedErr: ErrBadStatus},
+		"bad json":     {body: `{"temperature":`, jsonPath: "temperature", expectedErr: ErrBadJSON},
+		"missing key":  {body: `{"temp": 41}`, jsonPath: "temperature", expectedErr: ErrPathNotFound},
+		"bad index":    {body: `{"sensors": [1]}`, jsonPath: "sensors.1", expectedErr: ErrPathNotFound},
+		"not object":   {body: `{"sensors": 1}`, jsonPath: "sensors.temp", expectedErr: ErrPathNotFound},
+		"string":       {body: `{"temperature": "41"}`, jsonPath: "temperature", expectedErr: ErrNotNumber},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") != "Bearer secret" {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				if c.status != 0 {
+					w.WriteHeader(c.status)
+				}
+				_, _ = w.Write([]byte(c.body))
+			}))
+			defer server.Close()
+
+			sensor, err := New(
+				server.URL,
+				OptJSONPath(c.jsonPath),
+				OptHeader("Authorization", "Bearer secret"),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer sensor.Close()
+
+			temp, err := sensor.Temperature()
+			if !errors.Is(err, c.expectedErr) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", c.expectedErr, err)
+			}
+			if err == nil && temp != c.expectedTemp {
+				t.Fatalf("unexpected temperature\nwant: %v\n got: %v", c.expectedTemp, temp)
+			}
+		})
+	}
+}
+
+func TestSensor_lifeCycle(t *testing.T) {
+
+	block := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer server.Close()
+	defer close(block)
+
+	sensor, err := New(server.URL, OptName("nas"), OptTimeout(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sensor.Name() != "nas" {
+		t.Fatalf("unexpected name\nwant: nas\n got: %s", sensor.Name())
+	}
+	if _, err := sensor.Temperature(); err == nil {
+		t.Fatal("expected an error given a request that times out")
+	}
+
+	if err := sensor.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sensor.Temperature(); !errors.Is(err, heatsink.ErrThermoSensorClosed) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", heatsink.ErrThermoSensorClosed, err)
+	}
+	if err := sensor.Close(); !errors.Is(err, heatsink.ErrThermoSensorClosed) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", heatsink.ErrThermoSensorClosed, err)
+	}
+}
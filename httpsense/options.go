@@ -0,0 +1,53 @@
+package httpsense
+
+import (
+	"strings"
+	"time"
+)
+
+// Option is used to pass optional parameters to the sensor's factory function
+type Option func(*Sensor)
+
+// OptName sets the name of the sensor. if name is empty, it is set to the default value
+//
+// (default: the url)
+func OptName(name string) Option {
+	return func(s *Sensor) {
+		if name != "" {
+			s.name = name
+		}
+	}
+}
+
+// OptJSONPath sets the dot-separated path of the temperature in the response, e.g.
+// 'sensors.0.temp' for the field 'temp' of the first element of the array 'sensors'. If path
+// is empty, the whole response must be a number
+//
+// (default: "temperature")
+func OptJSONPath(path string) Option {
+	return func(s *Sensor) {
+		s.jsonPath = nil
+		if path != "" {
+			s.jsonPath = strings.Split(path, ".")
+		}
+	}
+}
+
+// OptHeader adds a header that is sent with every request, e.g. 'Authorization' with a bearer
+// token. It may be passed several times
+//
+// (default: none)
+func OptHeader(key, value string) Option {
+	return func(s *Sensor) {
+		s.headers.Add(key, value)
+	}
+}
+
+// OptTimeout sets how long a request may take, including reading the response
+//
+// (default: 5s)
+func OptTimeout(timeout time.Duration) Option {
+	return func(s *Sensor) {
+		s.timeout = timeout
+	}
+}
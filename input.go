@@ -0,0 +1,63 @@
+package heatsink
+
+import (
+	"go.uber.org/zap"
+)
+
+// Input is a group of sensors with its own fan response curve, e.g. the sensors of voltage
+// regulators or NVMe drives that tolerate other temperatures than the processor. Each input
+// derives a duty cycle from its hottest sensor and the fan runs at the highest of them
+type Input struct {
+	// Name identifies this input in logs
+	Name string
+	// Sensors are the sensors of this input, of which the hottest one is used
+	Sensors []ThermoSensor
+	// MinTemperature is the temperature below which this input asks for the minimum speed
+	MinTemperature float64
+	// MaxTemperature is the temperature above which this input asks for the maximum speed
+	MaxTemperature float64
+	// Response is the fan response curve of this input
+	Response fanResponse
+	// Exponent is the exponent of the curve if Response is FanResponsePow
+	Exponent float64
+	// Midpoint and Steepness shape the curve if Response is FanResponseSigmoid. For details,
+	// see the documentation for OptFanResponseSigmoid
+	Midpoint  float64
+	Steepness float64
+}
+
+// input is an additional group of sensors whose curve may raise the duty cycle
+type input struct {
+	name    string
+	sensors []ThermoSensor
+	dcCalc  dutyCycler
+}
+
+// applyInputs raises the given duty cycle to the one derived from each additional input, if
+// higher, and returns it along with the given readings extended by those of the inputs. An
+// input whose sensors all fail to be read asks for full speed, which errs on the side of
+// cooling
+func (hs *Heatsink) applyInputs(dcRatio float64, readings []Reading, why *reason) (float64, []Reading) {
+	for _, in := range hs.inputs {
+		temp, hottest, inReadings, err := hs.hottest(in.sensors)
+		if err != nil {
+			hs.logger.Error(
+				"failed to read all sensors of input, running the fan at full speed",
+				zap.Error(err),
+				zap.String("heatsink_name", hs.name),
+				zap.String("input_name", in.name),
+			)
+			why.adjust("raised to 1.00 since all sensors of input '%s' failed", in.name)
+			dcRatio = 1
+			continue
+		}
+		readings = append(readings, inReadings...)
+		if inDC := in.dcCalc.ratio(temp); inDC > dcRatio {
+			why.adjust(
+				"raised to %.2f by input '%s' with sensor '%s' at %.2f", inDC, in.name, hottest, temp,
+			)
+			dcRatio = inDC
+		}
+	}
+	return dcRatio, readings
+}
@@ -0,0 +1,75 @@
+package heatsink
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+)
+
+func TestOptInput_ignoresInvalid(t *testing.T) {
+	t.Parallel()
+
+	hs := &Heatsink{}
+	OptInput(Input{MinTemperature: 0, MaxTemperature: 1})(nil, hs)
+	OptInput(Input{Sensors: []ThermoSensor{nil}, MinTemperature: 0, MaxTemperature: 1})(nil, hs)
+	OptInput(Input{Sensors: []ThermoSensor{&fakeThermoSensor{}}, MinTemperature: 1, MaxTemperature: 1})(nil, hs)
+	if len(hs.inputs) != 0 {
+		t.Fatalf("expected invalid inputs to be ignored, got: %v", hs.inputs)
+	}
+}
+
+func TestHeatsink_StartThermalControl_inputs(t *testing.T) {
+	t.Parallel()
+
+	simulatedErr := errors.New("simulated error")
+	fanDriver := &fakeFanDriver{}
+	vrm := &fakeThermoSensor{
+		onName:            "vrm",
+		onTemperatureVals: []float64{60, 0, 20},
+		onTemperatureErrs: []error{nil, simulatedErr, nil},
+	}
+	config := &Config{
+		Fan: fanDriver,
+		Sensors: []ThermoSensor{&fakeThermoSensor{
+			onName:            "cpu",
+			onTemperatureVals: []float64{40, 40, 40},
+			onTemperatureErrs: []error{nil, nil, nil, simulatedErr},
+		}},
+		MinTemperature: 35,
+		MaxTemperature: 45,
+	}
+	hs, err := New(
+		config,
+		OptTemperatureCheckPeriod(time.Millisecond),
+		OptInput(Input{
+			Name:           "vrm",
+			Sensors:        []ThermoSensor{vrm},
+			MinTemperature: 0,
+			MaxTemperature: 100,
+			Response:       FanResponseLinear,
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs.dcCalc = &fakeDutyCycler{tmpToDC: map[float64]float64{40: 0.4}}
+
+	if err := hs.StartThermalControl(); !errors.Is(err, simulatedErr) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", simulatedErr, err)
+	}
+
+	// the input raises the duty cycle, asks for full speed when failing, and never lowers it
+	expected := []float64{0.6, 1, 0.4}
+	if diff := deep.Equal(fanDriver.argSetDutyCycle, expected); diff != nil {
+		t.Fatal(diff)
+	}
+	expectedReadings := []Reading{{Sensor: "cpu", Temperature: 40}, {Sensor: "vrm", Temperature: 20}}
+	if diff := deep.Equal(hs.LastSample().Readings, expectedReadings); diff != nil {
+		t.Error(diff)
+	}
+	if vrm.numCloseCalls != 1 {
+		t.Fatalf("expected the input's sensor to be closed once, got: %d", vrm.numCloseCalls)
+	}
+}
@@ -0,0 +1,175 @@
+// Package lmsensors provides an implementation of the heatsink.ThermoSensor interface that
+// reads temperatures through lm-sensors, which names sensors by chip and feature label, e.g.
+// 'coretemp-isa-0000' and 'Package id 0', and applies the scaling configured in sensors.conf.
+// Rather than binding to libsensors with cgo, it parses the output of 'sensors -j'
+package lmsensors
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/malkhamis/heatsink"
+)
+
+// compile-time check for interface implementation and dependency inversion
+var _ heatsink.ThermoSensor = (*Sensor)(nil)
+
+// Sentinel errors that are wrapped and returned by this package
+var (
+	ErrBadIdentifier   = errors.New("chip and feature must not be empty")
+	ErrChipNotFound    = errors.New("no chip matches the given name")
+	ErrChipAmbiguous   = errors.New("more than one chip matches the given name")
+	ErrFeatureNotFound = errors.New("chip has no feature with the given label")
+	ErrNotTemperature  = errors.New("feature is not a temperature")
+	ErrBadOutput       = errors.New("unexpected output from sensors")
+)
+
+// tempInputPattern matches the subfeature that holds the reading of a temperature feature
+var tempInputPattern = regexp.MustCompile(`^temp\d+_input$`)
+
+// runFunc runs the sensors tool at the given path with the given arguments and returns its
+// standard output
+type runFunc func(binary string, args ...string) ([]byte, error)
+
+func run(binary string, args ...string) ([]byte, error) {
+	output, err := exec.Command(binary, args...).Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return output, err
+}
+
+// Sensor reads the temperature of a chip's feature through lm-sensors. Instances of this type
+// are safe for concurrent use
+type Sensor struct {
+	name    string
+	chip    string
+	feature string
+	binary  string
+	onAlarm func(sensor string, alarms []string)
+	run     runFunc
+	mutex   sync.Mutex
+	closed  bool
+}
+
+// New returns a new thermal sensor for the feature with the given label of the given chip.
+// The chip may be a pattern that lm-sensors understands, e.g. 'coretemp-*', as long as it
+// matches exactly one chip. The feature is read once to verify that it is a temperature. For
+// details about options and defaults, see the documentation for type 'Option'
+func New(chip, feature string, options ...Option) (*Sensor, error) {
+	return newSensor(chip, feature, run, options...)
+}
+
+func newSensor(chip, feature string, run runFunc, options ...Option) (*Sensor, error) {
+
+	if chip == "" || feature == "" {
+		return nil, ErrBadIdentifier
+	}
+	sensor := &Sensor{ // defaults
+		name:    chip + "/" + feature,
+		chip:    chip,
+		feature: feature,
+		binary:  "sensors",
+		run:     run,
+	}
+	for _, applyOption := range options {
+		if applyOption == nil {
+			continue
+		}
+		applyOption(sensor)
+	}
+	if _, err := sensor.read(); err != nil {
+		return nil, err
+	}
+	return sensor, nil
+}
+
+// read returns the temperature of the sensor's feature and reports its active alarms
+func (s *Sensor) read() (float64, error) {
+
+	output, err := s.run(s.binary, "-j", s.chip)
+	if err != nil {
+		return math.Inf(1), fmt.Errorf("'%s': %w", s.chip, err)
+	}
+	var chips map[string]map[string]json.RawMessage
+	if err := json.Unmarshal(output, &chips); err != nil {
+		return math.Inf(1), fmt.Errorf("%w: %v", ErrBadOutput, err)
+	}
+	if len(chips) == 0 {
+		return math.Inf(1), fmt.Errorf("%w: '%s'", ErrChipNotFound, s.chip)
+	}
+	if len(chips) > 1 {
+		return math.Inf(1), fmt.Errorf("%w: '%s'", ErrChipAmbiguous, s.chip)
+	}
+
+	var (
+		chipName string
+		features map[string]json.RawMessage
+	)
+	for name, f := range chips {
+		chipName, features = name, f
+	}
+	rawFeature, ok := features[s.feature]
+	if !ok {
+		return math.Inf(1), fmt.Errorf("%w: '%s' of '%s'", ErrFeatureNotFound, s.feature, chipName)
+	}
+	var subfeatures map[string]float64
+	if err := json.Unmarshal(rawFeature, &subfeatures); err != nil {
+		return math.Inf(1), fmt.Errorf("%w: '%s' of '%s'", ErrNotTemperature, s.feature, chipName)
+	}
+
+	temp, found := math.Inf(1), false
+	var alarms []string
+	for subfeature, value := range subfeatures {
+		switch {
+		case tempInputPattern.MatchString(subfeature):
+			temp, found = value, true
+		case strings.HasSuffix(subfeature, "_alarm") && value != 0:
+			alarms = append(alarms, subfeature)
+		}
+	}
+	if !found {
+		return math.Inf(1), fmt.Errorf("%w: '%s' of '%s'", ErrNotTemperature, s.feature, chipName)
+	}
+	if len(alarms) > 0 && s.onAlarm != nil {
+		sort.Strings(alarms)
+		s.onAlarm(s.name, alarms)
+	}
+	return temp, nil
+}
+
+// Temperature returns the current temperature in degrees celsius as well as any error
+// encountered. If the sensor is closed, it returns heatsink.ErrThermoSensorClosed
+func (s *Sensor) Temperature() (float64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return math.Inf(1), heatsink.ErrThermoSensorClosed
+	}
+	return s.read()
+}
+
+// Close closes this sensor. If the sensor was previously closed, it returns
+// heatsink.ErrThermoSensorClosed
+func (s *Sensor) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return heatsink.ErrThermoSensorClosed
+	}
+	s.closed = true
+	return nil
+}
+
+// Name returns the name of this sensor
+func (s *Sensor) Name() string {
+	return s.name
+}
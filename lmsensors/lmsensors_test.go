@@ -0,0 +1,127 @@
+package lmsensors
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/malkhamis/heatsink"
+)
+
+const testOutput = `{
+   "coretemp-isa-0000":{
+      "Adapter": "ISA adapter",
+      "Package id 0":{
+         "temp1_input": 52.000,
+         "temp1_max": 80.000,
+         "temp1_crit": 100.000,
+         "temp1_crit_alarm": 0.000
+      },
+      "Core 0":{
+         "temp2_input": 101.000,
+         "temp2_max": 80.000,
+         "temp2_crit": 100.000,
+         "temp2_max_alarm": 1.000,
+         "temp2_crit_alarm": 1.000
+      },
+      "fan1":{
+         "fan1_input": 1200.000
+      }
+   }
+}`
+
+func TestNew_errors(t *testing.T) {
+
+	errRun := errors.New("exit status 1")
+	cases := map[string]struct {
+		chip, feature string
+		output        string
+		runErr        error
+		expectedErr   error
+	}{
+		"no chip":         {chip: "", feature: "Core 0", expectedErr: ErrBadIdentifier},
+		"no feature":      {chip: "coretemp-*", feature: "", expectedErr: ErrBadIdentifier},
+		"run":             {chip: "coretemp-*", feature: "Core 0", runErr: errRun, expectedErr: errRun},
+		"bad output":      {chip: "coretemp-*", feature: "Core 0", output: "Core 0: +52.0°C", expectedErr: ErrBadOutput},
+		"chip not found":  {chip: "nct6775-*", feature: "Core 0", output: `{}`, expectedErr: ErrChipNotFound},
+		"chip ambiguous":  {chip: "*", feature: "Core 0", output: `{"a": {}, "b": {}}`, expectedErr: ErrChipAmbiguous},
+		"feature missing": {chip: "coretemp-*", feature: "Core 9", output: testOutput, expectedErr: ErrFeatureNotFound},
+		"adapter":         {chip: "coretemp-*", feature: "Adapter", output: testOutput, expectedErr: ErrNotTemperature},
+		"fan":             {chip: "coretemp-*", feature: "fan1", output: testOutput, expectedErr: ErrNotTemperature},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			run := func(string, ...string) ([]byte, error) { return []byte(c.output), c.runErr }
+			_, err := newSensor(c.chip, c.feature, run)
+			if !errors.Is(err, c.expectedErr) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", c.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestSensor_lifeCycle(t *testing.T) {
+
+	var (
+		invocations []string
+		alarms      [][]string
+	)
+	run := func(binary string, args ...string) ([]byte, error) {
+		invocations = append(invocations, binary+" "+args[0]+" "+args[1])
+		return []byte(testOutput), nil
+	}
+	onAlarm := func(sensor string, active []string) {
+		alarms = append(alarms, append([]string{sensor}, active...))
+	}
+
+	sensor, err := newSensor("coretemp-*", "Core 0", run, nil, OptBinary("/usr/bin/sensors"), OptOnAlarm(onAlarm))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sensor.Name() != "coretemp-*/Core 0" {
+		t.Fatalf("unexpected name\nwant: coretemp-*/Core 0\n got: %s", sensor.Name())
+	}
+	temp, err := sensor.Temperature()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if temp != 101 {
+		t.Fatalf("unexpected temperature\nwant: %v\n got: %v", 101, temp)
+	}
+
+	expectedInvocations := []string{"/usr/bin/sensors -j coretemp-*", "/usr/bin/sensors -j coretemp-*"}
+	if diff := deep.Equal(invocations, expectedInvocations); diff != nil {
+		t.Fatal(diff)
+	}
+	expectedAlarm := []string{"coretemp-*/Core 0", "temp2_crit_alarm", "temp2_max_alarm"}
+	if diff := deep.Equal(alarms, [][]string{expectedAlarm, expectedAlarm}); diff != nil {
+		t.Fatal(diff)
+	}
+
+	if err := sensor.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sensor.Temperature(); !errors.Is(err, heatsink.ErrThermoSensorClosed) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", heatsink.ErrThermoSensorClosed, err)
+	}
+	if err := sensor.Close(); !errors.Is(err, heatsink.ErrThermoSensorClosed) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", heatsink.ErrThermoSensorClosed, err)
+	}
+}
+
+func TestSensor_quietFeature(t *testing.T) {
+	run := func(string, ...string) ([]byte, error) { return []byte(testOutput), nil }
+	called := false
+	sensor, err := newSensor("coretemp-isa-0000", "Package id 0", run, OptName("cpu"), OptOnAlarm(func(string, []string) { called = true }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if temp, err := sensor.Temperature(); err != nil || temp != 52 {
+		t.Fatalf("unexpected temperature\nwant: 52\n got: %v (%v)", temp, err)
+	}
+	if called {
+		t.Fatal("expected no alarm given only inactive alarm flags")
+	}
+}
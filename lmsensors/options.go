@@ -0,0 +1,37 @@
+package lmsensors
+
+// Option is used to pass optional parameters to the sensor's factory function
+type Option func(*Sensor)
+
+// OptName sets the name of the sensor. if name is empty, it is set to the default value
+//
+// (default: '<chip>/<feature>')
+func OptName(name string) Option {
+	return func(s *Sensor) {
+		if name != "" {
+			s.name = name
+		}
+	}
+}
+
+// OptBinary sets the path of the sensors tool. If path is empty, it is set to the default value
+//
+// (default: "sensors", which is looked up in PATH)
+func OptBinary(path string) Option {
+	return func(s *Sensor) {
+		if path != "" {
+			s.binary = path
+		}
+	}
+}
+
+// OptOnAlarm sets a function that is called with the names of the active alarm subfeatures,
+// e.g. 'temp1_crit_alarm', whenever a reading finds any. It is called while the sensor is
+// being read, so it should return quickly
+//
+// (default: nil)
+func OptOnAlarm(onAlarm func(sensor string, alarms []string)) Option {
+	return func(s *Sensor) {
+		s.onAlarm = onAlarm
+	}
+}
@@ -0,0 +1,190 @@
+package heatsink
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// SetManualDutyCycle pins the fan to the given duty cycle ratio, which is clamped to [0,1],
+// instead of the duty cycle derived from the fan response curve. Temperatures are still
+// monitored and service levels are still enforced on top of the manual duty cycle. The pin
+// remains in effect until ClearManualDutyCycle is called. It is safe to call it concurrently
+// with thermal control
+func (hs *Heatsink) SetManualDutyCycle(dcRatio float64) {
+	hs.manualMutex.Lock()
+	defer hs.manualMutex.Unlock()
+	hs.manualDC = math.Max(0, math.Min(1, dcRatio))
+	hs.manualSet = true
+}
+
+// ClearManualDutyCycle returns control of the fan to the fan response curve. It is a no-op if
+// no manual duty cycle is set. It is safe to call it concurrently with thermal control
+func (hs *Heatsink) ClearManualDutyCycle() {
+	hs.manualMutex.Lock()
+	defer hs.manualMutex.Unlock()
+	hs.manualDC, hs.manualSet = 0, false
+}
+
+// ManualDutyCycle returns the manual duty cycle ratio and true if one is set. Otherwise, it
+// returns false
+func (hs *Heatsink) ManualDutyCycle() (dcRatio float64, ok bool) {
+	hs.manualMutex.RLock()
+	defer hs.manualMutex.RUnlock()
+	return hs.manualDC, hs.manualSet
+}
+
+// applyManualDutyCycle replaces the given duty cycle with the manual one, if set
+func (hs *Heatsink) applyManualDutyCycle(dcRatio float64, why *reason) float64 {
+	manual, ok := hs.ManualDutyCycle()
+	if !ok {
+		return dcRatio
+	}
+	why.adjust("pinned to manual duty cycle %.2f", manual)
+	return manual
+}
+
+// SetOverrideDutyCycle drives the fan at the given duty cycle ratio, which is clamped to [0,1],
+// instead of the duty cycle derived from the fan response curve, e.g. on behalf of a program
+// that computes duty cycles of its own. Unlike the manual duty cycle, which takes precedence
+// over it, it is meant for automation rather than users, so the two never overwrite each
+// other. Service levels are still enforced on top of it. The override remains in effect until
+// ClearOverrideDutyCycle is called. It is safe to call it concurrently with thermal control
+func (hs *Heatsink) SetOverrideDutyCycle(dcRatio float64) {
+	hs.manualMutex.Lock()
+	defer hs.manualMutex.Unlock()
+	hs.overrideDC = math.Max(0, math.Min(1, dcRatio))
+	hs.overrideSet = true
+}
+
+// ClearOverrideDutyCycle returns control of the fan to the fan response curve, unless a manual
+// duty cycle is set. It is a no-op if no override is set. It is safe to call it concurrently
+// with thermal control
+func (hs *Heatsink) ClearOverrideDutyCycle() {
+	hs.manualMutex.Lock()
+	defer hs.manualMutex.Unlock()
+	hs.overrideDC, hs.overrideSet = 0, false
+}
+
+// OverrideDutyCycle returns the override duty cycle ratio and true if one is set. Otherwise,
+// it returns false
+func (hs *Heatsink) OverrideDutyCycle() (dcRatio float64, ok bool) {
+	hs.manualMutex.RLock()
+	defer hs.manualMutex.RUnlock()
+	return hs.overrideDC, hs.overrideSet
+}
+
+// applyOverrideDutyCycle replaces the given duty cycle with the override, if set
+func (hs *Heatsink) applyOverrideDutyCycle(dcRatio float64, why *reason) float64 {
+	override, ok := hs.OverrideDutyCycle()
+	if !ok {
+		return dcRatio
+	}
+	why.adjust("overridden with duty cycle %.2f", override)
+	return override
+}
+
+// SetMaxDutyCycle caps the fan's duty cycle at the given ratio, which is clamped to [0,1],
+// e.g. to keep the fan quiet for a while. The cap applies on top of the fan response curve,
+// auxiliary inputs, and the manual duty cycle, but service levels are still enforced on top
+// of it. The cap remains in effect until ClearMaxDutyCycle is called. It is safe to call it
+// concurrently with thermal control
+func (hs *Heatsink) SetMaxDutyCycle(dcRatio float64) {
+	hs.manualMutex.Lock()
+	defer hs.manualMutex.Unlock()
+	hs.maxDC = math.Max(0, math.Min(1, dcRatio))
+	hs.maxSet = true
+}
+
+// ClearMaxDutyCycle removes the cap on the fan's duty cycle. It is a no-op if no cap is set.
+// It is safe to call it concurrently with thermal control
+func (hs *Heatsink) ClearMaxDutyCycle() {
+	hs.manualMutex.Lock()
+	defer hs.manualMutex.Unlock()
+	hs.maxDC, hs.maxSet = 0, false
+}
+
+// MaxDutyCycle returns the cap on the fan's duty cycle ratio and true if one is set. Otherwise,
+// it returns false
+func (hs *Heatsink) MaxDutyCycle() (dcRatio float64, ok bool) {
+	hs.manualMutex.RLock()
+	defer hs.manualMutex.RUnlock()
+	return hs.maxDC, hs.maxSet
+}
+
+// applyMaxDutyCycle lowers the given duty cycle to the cap, if set
+func (hs *Heatsink) applyMaxDutyCycle(dcRatio float64, why *reason) float64 {
+	max, ok := hs.MaxDutyCycle()
+	if !ok || dcRatio <= max {
+		return dcRatio
+	}
+	why.adjust("capped at max duty cycle %.2f", max)
+	return max
+}
+
+// SetTemperatureRange replaces the minimum and maximum temperatures of the fan response curve,
+// e.g. to let the fan stay slower up to a higher temperature while running on battery. The
+// curve keeps its response type and boundaries. Delta-T control with its own range and the
+// curves of schedules are not affected. The range remains in effect until
+// ClearTemperatureRange is called. It returns ErrBadTemperatureRange if maxTemp is not greater
+// than minTemp. It is safe to call it concurrently with thermal control
+func (hs *Heatsink) SetTemperatureRange(minTemp, maxTemp float64) error {
+	if maxTemp <= minTemp {
+		return fmt.Errorf("%w: [%v, %v]", ErrBadTemperatureRange, minTemp, maxTemp)
+	}
+	curve := hs.newBoundedCurve(minTemp, maxTemp)
+	hs.manualMutex.Lock()
+	defer hs.manualMutex.Unlock()
+	hs.rangeCurve = curve
+	return nil
+}
+
+// ClearTemperatureRange restores the minimum and maximum temperatures of the config. It is a
+// no-op if no range is set. It is safe to call it concurrently with thermal control
+func (hs *Heatsink) ClearTemperatureRange() {
+	hs.manualMutex.Lock()
+	defer hs.manualMutex.Unlock()
+	hs.rangeCurve = nil
+}
+
+// activeCurve returns the fan response curve for the configured or the replaced temperature
+// range
+func (hs *Heatsink) activeCurve() dutyCycler {
+	hs.manualMutex.RLock()
+	defer hs.manualMutex.RUnlock()
+	if hs.rangeCurve != nil {
+		return hs.rangeCurve
+	}
+	return hs.dcCalc
+}
+
+// SetCheckPeriod replaces the configured check period, e.g. to check less often while running
+// on battery. If adaptive polling is enabled, it lengthens the given period instead. The
+// period remains in effect until ClearCheckPeriod is called. If d is less than or equal to
+// zero, it is a no-op. It is safe to call it concurrently with thermal control
+func (hs *Heatsink) SetCheckPeriod(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	hs.manualMutex.Lock()
+	defer hs.manualMutex.Unlock()
+	hs.setPeriod = d
+}
+
+// ClearCheckPeriod restores the configured check period. It is a no-op if no check period is
+// set. It is safe to call it concurrently with thermal control
+func (hs *Heatsink) ClearCheckPeriod() {
+	hs.manualMutex.Lock()
+	defer hs.manualMutex.Unlock()
+	hs.setPeriod = 0
+}
+
+// basePeriod returns the check period set at runtime, if any, or the configured one
+func (hs *Heatsink) basePeriod() time.Duration {
+	hs.manualMutex.RLock()
+	defer hs.manualMutex.RUnlock()
+	if hs.setPeriod > 0 {
+		return hs.setPeriod
+	}
+	return hs.chkPeriod
+}
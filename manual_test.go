@@ -0,0 +1,230 @@
+package heatsink
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+)
+
+func TestHeatsink_ManualDutyCycle(t *testing.T) {
+	t.Parallel()
+
+	hs := &Heatsink{}
+	if _, ok := hs.ManualDutyCycle(); ok {
+		t.Fatal("expected no manual duty cycle by default")
+	}
+
+	for input, expected := range map[float64]float64{0.4: 0.4, -1: 0, 2: 1} {
+		hs.SetManualDutyCycle(input)
+		actual, ok := hs.ManualDutyCycle()
+		if !ok || actual != expected {
+			t.Fatalf("unexpected manual duty cycle\nwant: %v, true\n got: %v, %v", expected, actual, ok)
+		}
+	}
+
+	hs.ClearManualDutyCycle()
+	if _, ok := hs.ManualDutyCycle(); ok {
+		t.Fatal("expected the manual duty cycle to be cleared")
+	}
+}
+
+func TestHeatsink_OverrideDutyCycle(t *testing.T) {
+	t.Parallel()
+
+	hs := &Heatsink{}
+	hs.SetOverrideDutyCycle(2)
+	if actual, ok := hs.OverrideDutyCycle(); !ok || actual != 1 {
+		t.Fatalf("unexpected override duty cycle\nwant: 1, true\n got: %v, %v", actual, ok)
+	}
+	if _, ok := hs.ManualDutyCycle(); ok {
+		t.Fatal("expected the override to leave the manual duty cycle unset")
+	}
+
+	// the manual duty cycle takes precedence over the override
+	why := &reason{}
+	if actual := hs.applyOverrideDutyCycle(0.2, why); actual != 1 {
+		t.Fatalf("unexpected duty cycle\nwant: 1\n got: %v", actual)
+	}
+	hs.SetManualDutyCycle(0.5)
+	if actual := hs.applyManualDutyCycle(hs.applyOverrideDutyCycle(0.2, why), why); actual != 0.5 {
+		t.Fatalf("unexpected duty cycle\nwant: 0.5\n got: %v", actual)
+	}
+	hs.ClearManualDutyCycle()
+
+	hs.ClearOverrideDutyCycle()
+	if _, ok := hs.OverrideDutyCycle(); ok {
+		t.Fatal("expected the override duty cycle to be cleared")
+	}
+}
+
+func TestHeatsink_StartThermalControl_manualAndInitialDutyCycle(t *testing.T) {
+	t.Parallel()
+
+	simulatedErr := errors.New("simulated error")
+	fanDriver := &fakeFanDriver{}
+	config := &Config{
+		Fan: fanDriver,
+		Sensors: []ThermoSensor{&fakeThermoSensor{
+			onTemperatureVals: []float64{40, 50},
+			onTemperatureErrs: []error{nil, nil, simulatedErr},
+		}},
+		MinTemperature: 35,
+		MaxTemperature: 55,
+	}
+	hs, err := New(
+		config,
+		OptTemperatureCheckPeriod(time.Millisecond),
+		OptInitialDutyCycle(0.2),
+		OptServiceLevel(45, 0.9),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs.SetManualDutyCycle(0.7)
+
+	if err := hs.StartThermalControl(); !errors.Is(err, simulatedErr) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", simulatedErr, err)
+	}
+
+	// the service level is still enforced on top of the manual duty cycle
+	expected := []float64{0.2, 0.7, 0.9}
+	if diff := deep.Equal(fanDriver.argSetDutyCycle, expected); diff != nil {
+		t.Fatal(diff)
+	}
+}
+
+func TestOptInitialDutyCycle(t *testing.T) {
+	t.Parallel()
+
+	hs := &Heatsink{}
+	OptInitialDutyCycle(1.5)(nil, hs)
+	if hs.initDC == nil || *hs.initDC != 1 {
+		t.Fatalf("expected the initial duty cycle to be clamped to 1, got: %v", hs.initDC)
+	}
+	OptInitialDutyCycle(-1)(nil, hs)
+	if hs.initDC != nil {
+		t.Fatalf("expected a negative initial duty cycle to disable it, got: %v", *hs.initDC)
+	}
+}
+
+func TestHeatsink_MaxDutyCycle(t *testing.T) {
+	t.Parallel()
+
+	hs := &Heatsink{}
+	if _, ok := hs.MaxDutyCycle(); ok {
+		t.Fatal("expected no max duty cycle by default")
+	}
+
+	for input, expected := range map[float64]float64{0.4: 0.4, -1: 0, 2: 1} {
+		hs.SetMaxDutyCycle(input)
+		actual, ok := hs.MaxDutyCycle()
+		if !ok || actual != expected {
+			t.Fatalf("unexpected max duty cycle\nwant: %v, true\n got: %v, %v", expected, actual, ok)
+		}
+	}
+
+	hs.ClearMaxDutyCycle()
+	if _, ok := hs.MaxDutyCycle(); ok {
+		t.Fatal("expected the max duty cycle to be cleared")
+	}
+}
+
+func TestHeatsink_StartThermalControl_maxDutyCycle(t *testing.T) {
+	t.Parallel()
+
+	simulatedErr := errors.New("simulated error")
+	fanDriver := &fakeFanDriver{}
+	config := &Config{
+		Fan: fanDriver,
+		Sensors: []ThermoSensor{&fakeThermoSensor{
+			onTemperatureVals: []float64{40, 50, 55},
+			onTemperatureErrs: []error{nil, nil, nil, simulatedErr},
+		}},
+		MinTemperature: 35,
+		MaxTemperature: 55,
+	}
+	hs, err := New(
+		config,
+		OptTemperatureCheckPeriod(time.Millisecond),
+		OptFanResponse(FanResponseLinear),
+		OptServiceLevel(52, 0.9),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs.SetMaxDutyCycle(0.5)
+
+	if err := hs.StartThermalControl(); !errors.Is(err, simulatedErr) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", simulatedErr, err)
+	}
+
+	// the service level is still enforced on top of the max duty cycle
+	expected := []float64{0.25, 0.5, 0.9}
+	if diff := deep.Equal(fanDriver.argSetDutyCycle, expected); diff != nil {
+		t.Fatal(diff)
+	}
+}
+
+func TestHeatsink_StartThermalControl_temperatureRange(t *testing.T) {
+	t.Parallel()
+
+	simulatedErr := errors.New("simulated error")
+	fanDriver := &fakeFanDriver{}
+	config := &Config{
+		Fan: fanDriver,
+		Sensors: []ThermoSensor{&fakeThermoSensor{
+			onTemperatureVals: []float64{45, 45},
+			onTemperatureErrs: []error{nil, nil, simulatedErr},
+		}},
+		MinTemperature: 35,
+		MaxTemperature: 55,
+	}
+	hs, err := New(
+		config,
+		OptTemperatureCheckPeriod(time.Millisecond),
+		OptFanResponse(FanResponseLinear),
+		OptUnchangedDutyCycle(-1, 0),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := hs.SetTemperatureRange(50, 40); !errors.Is(err, ErrBadTemperatureRange) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", ErrBadTemperatureRange, err)
+	}
+	if err := hs.SetTemperatureRange(40, 60); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hs.StartThermalControl(); !errors.Is(err, simulatedErr) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", simulatedErr, err)
+	}
+	expected := []float64{0.25, 0.25}
+	if diff := deep.Equal(fanDriver.argSetDutyCycle, expected); diff != nil {
+		t.Fatal(diff)
+	}
+
+	hs.ClearTemperatureRange()
+	if actual := hs.activeCurve().ratio(45); actual != 0.5 {
+		t.Fatalf("unexpected duty cycle after clearing the range\nwant: %v\n got: %v", 0.5, actual)
+	}
+}
+
+func TestHeatsink_SetCheckPeriod(t *testing.T) {
+	t.Parallel()
+
+	hs := &Heatsink{chkPeriod: time.Second}
+	hs.SetCheckPeriod(0)
+	if actual := hs.CheckPeriod(); actual != time.Second {
+		t.Fatalf("unexpected check period\nwant: %v\n got: %v", time.Second, actual)
+	}
+	hs.SetCheckPeriod(5 * time.Second)
+	if actual := hs.CheckPeriod(); actual != 5*time.Second {
+		t.Fatalf("unexpected check period\nwant: %v\n got: %v", 5*time.Second, actual)
+	}
+	hs.ClearCheckPeriod()
+	if actual := hs.CheckPeriod(); actual != time.Second {
+		t.Fatalf("unexpected check period\nwant: %v\n got: %v", time.Second, actual)
+	}
+}
@@ -0,0 +1,104 @@
+package mqtt
+
+import (
+	"bufio"
+	"net"
+	"sync"
+	"testing"
+)
+
+// fakeBroker accepts connections, answers CONNECT with the configured return code, and
+// records the packets it receives
+type fakeBroker struct {
+	listener   net.Listener
+	returnCode byte
+
+	mutex    sync.Mutex
+	conns    []net.Conn
+	connects int
+	packets  chan packet
+}
+
+func newFakeBroker(t *testing.T, returnCode byte) *fakeBroker {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &fakeBroker{
+		listener:   listener,
+		returnCode: returnCode,
+		packets:    make(chan packet, 100),
+	}
+	go b.accept()
+	return b
+}
+
+func (b *fakeBroker) url() string {
+	return "tcp://" + b.listener.Addr().String()
+}
+
+func (b *fakeBroker) accept() {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		b.mutex.Lock()
+		b.conns = append(b.conns, conn)
+		b.mutex.Unlock()
+		go b.serve(conn)
+	}
+}
+
+func (b *fakeBroker) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		p, err := readPacket(reader)
+		if err != nil {
+			return
+		}
+		switch p.kind {
+		case typeConnect:
+			b.mutex.Lock()
+			b.connects++
+			b.mutex.Unlock()
+			conn.Write(packet{kind: typeConnack, body: []byte{0, b.returnCode}}.encode())
+		case typePingreq:
+			conn.Write(packet{kind: typePingresp}.encode())
+			continue
+		}
+		b.packets <- p
+	}
+}
+
+// send writes the given packet to every open connection
+func (b *fakeBroker) send(p packet) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for _, conn := range b.conns {
+		conn.Write(p.encode())
+	}
+}
+
+// dropConnections closes every open connection without closing the listener
+func (b *fakeBroker) dropConnections() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for _, conn := range b.conns {
+		conn.Close()
+	}
+	b.conns = nil
+}
+
+func (b *fakeBroker) numConnects() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.connects
+}
+
+func (b *fakeBroker) close() {
+	b.listener.Close()
+	b.dropConnections()
+}
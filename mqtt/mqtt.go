@@ -0,0 +1,358 @@
+// Package mqtt provides a minimal MQTT 3.1.1 client that publishes and subscribes with QoS 0,
+// which is all that is needed to integrate the heatsink daemon with home automation systems.
+// The client connects in the background, keeps the connection alive, and reconnects with
+// exponential backoff, restoring its subscriptions on every connection
+package mqtt
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Sentinel errors that are wrapped and returned by this package
+var (
+	ErrBadBroker         = errors.New("invalid broker url")
+	ErrNotConnected      = errors.New("not connected to the broker")
+	ErrConnectionRefused = errors.New("broker refused the connection")
+	ErrProtocol          = errors.New("mqtt protocol violation")
+	ErrClosed            = errors.New("client is closed")
+)
+
+const (
+	dialTimeout  = 10 * time.Second
+	writeTimeout = 5 * time.Second
+)
+
+// Handler is called with the topic and payload of every message that matches the topic
+// filter it was subscribed with. It is called by the goroutine that reads from the broker, so
+// it should return quickly
+type Handler func(topic string, payload []byte)
+
+type subscription struct {
+	filter  string
+	handler Handler
+}
+
+// Client is an MQTT client. Instances of this type are safe for concurrent use
+type Client struct {
+	addr       string
+	useTLS     bool
+	tlsConfig  *tls.Config
+	clientID   string
+	username   string
+	password   string
+	keepAlive  time.Duration
+	will       *will
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	onConnChg  func(err error)
+
+	mutex      sync.Mutex
+	writeMutex sync.Mutex
+	conn       net.Conn
+	subs       []subscription
+	nextID     uint16
+	started    bool
+	closed     bool
+	done       chan struct{}
+	wg         sync.WaitGroup
+}
+
+// New returns a client for the given broker url, whose scheme is either 'tcp' or 'mqtt' for
+// plain connections or 'ssl', 'tls', or 'mqtts' for TLS connections. If the port is omitted,
+// 1883 or 8883 is used, respectively. The client does not connect until Start is called. For
+// details about options and defaults, see the documentation for type 'Option'
+func New(broker string, options ...Option) (*Client, error) {
+
+	u, err := url.Parse(broker)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadBroker, err)
+	}
+	c := &Client{
+		clientID:   defaultClientID(),
+		keepAlive:  30 * time.Second,
+		minBackoff: time.Second,
+		maxBackoff: time.Minute,
+		done:       make(chan struct{}),
+	}
+	port := "1883"
+	switch u.Scheme {
+	case "tcp", "mqtt":
+	case "ssl", "tls", "mqtts":
+		c.useTLS, port = true, "8883"
+	default:
+		return nil, fmt.Errorf("%w: unsupported scheme '%s'", ErrBadBroker, u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("%w: no host in '%s'", ErrBadBroker, broker)
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	c.addr = net.JoinHostPort(u.Hostname(), port)
+
+	for _, applyOption := range options {
+		applyOption(c)
+	}
+	if c.useTLS && c.tlsConfig == nil {
+		c.tlsConfig = &tls.Config{}
+	}
+	if c.useTLS && c.tlsConfig.ServerName == "" {
+		c.tlsConfig = c.tlsConfig.Clone()
+		c.tlsConfig.ServerName = u.Hostname()
+	}
+	return c, nil
+}
+
+// Start connects to the broker in the background and keeps reconnecting until the client is
+// closed. It returns immediately. Subsequent calls have no effect
+func (c *Client) Start() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.started || c.closed {
+		return
+	}
+	c.started = true
+	c.wg.Add(1)
+	go c.run()
+}
+
+// Publish sends a message with QoS 0 to the given topic. If the client is not connected, the
+// message is dropped and ErrNotConnected is returned
+func (c *Client) Publish(topic string, payload []byte, retain bool) error {
+	return c.send(publishPacket(topic, payload, retain))
+}
+
+// Subscribe registers the handler for messages whose topic matches the given filter. The
+// subscription is sent to the broker immediately if connected and on every reconnection
+func (c *Client) Subscribe(filter string, handler Handler) error {
+
+	c.mutex.Lock()
+	if c.closed {
+		c.mutex.Unlock()
+		return ErrClosed
+	}
+	c.subs = append(c.subs, subscription{filter: filter, handler: handler})
+	id := c.packetID()
+	connected := c.conn != nil
+	c.mutex.Unlock()
+
+	if !connected {
+		return nil
+	}
+	return c.send(subscribePacket(id, filter))
+}
+
+// Connected reports whether the client is currently connected to the broker
+func (c *Client) Connected() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.conn != nil
+}
+
+// Close disconnects from the broker and stops reconnecting. If the client is already closed,
+// it returns ErrClosed
+func (c *Client) Close() error {
+
+	c.mutex.Lock()
+	if c.closed {
+		c.mutex.Unlock()
+		return ErrClosed
+	}
+	c.closed = true
+	close(c.done)
+	conn := c.conn
+	c.mutex.Unlock()
+
+	if conn != nil {
+		c.send(packet{kind: typeDisconnect})
+		conn.Close()
+	}
+	c.wg.Wait()
+	return nil
+}
+
+// run connects, serves the connection until it breaks, and reconnects with backoff
+func (c *Client) run() {
+
+	defer c.wg.Done()
+	backoff := c.minBackoff
+	for {
+		conn, err := c.connect()
+		if err == nil {
+			backoff = c.minBackoff
+			err = c.serve(conn)
+		}
+		if c.onConnChg != nil {
+			c.onConnChg(err)
+		}
+
+		select {
+		case <-c.done:
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > c.maxBackoff {
+			backoff = c.maxBackoff
+		}
+	}
+}
+
+// connect dials the broker and completes the MQTT handshake
+func (c *Client) connect() (net.Conn, error) {
+
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	var (
+		conn net.Conn
+		err  error
+	)
+	if c.useTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", c.addr, c.tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", c.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	keepAlive := uint16(c.keepAlive / time.Second)
+	connect := connectPacket(c.clientID, c.username, c.password, keepAlive, c.will)
+	conn.SetDeadline(time.Now().Add(dialTimeout))
+	if _, err := conn.Write(connect.encode()); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	connack, err := readPacket(bufio.NewReader(conn))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if connack.kind != typeConnack || len(connack.body) != 2 {
+		conn.Close()
+		return nil, fmt.Errorf("%w: expected CONNACK, got packet type %d", ErrProtocol, connack.kind)
+	}
+	if code := connack.body[1]; code != 0 {
+		conn.Close()
+		return nil, fmt.Errorf("%w: return code %d", ErrConnectionRefused, code)
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// serve registers the connection, restores the subscriptions, and dispatches incoming
+// messages until the connection breaks or the client is closed
+func (c *Client) serve(conn net.Conn) error {
+
+	c.mutex.Lock()
+	if c.closed {
+		c.mutex.Unlock()
+		conn.Close()
+		return ErrClosed
+	}
+	c.conn = conn
+	var resubscribe []packet
+	for _, sub := range c.subs {
+		resubscribe = append(resubscribe, subscribePacket(c.packetID(), sub.filter))
+	}
+	c.mutex.Unlock()
+
+	defer func() {
+		c.mutex.Lock()
+		c.conn = nil
+		c.mutex.Unlock()
+		conn.Close()
+	}()
+
+	for _, p := range resubscribe {
+		if err := c.send(p); err != nil {
+			return err
+		}
+	}
+	if c.onConnChg != nil {
+		c.onConnChg(nil)
+	}
+
+	stopPing := make(chan struct{})
+	defer close(stopPing)
+	go func() {
+		ticker := time.NewTicker(c.keepAlive)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopPing:
+				return
+			case <-ticker.C:
+				c.send(packet{kind: typePingreq})
+			}
+		}
+	}()
+
+	reader := bufio.NewReader(conn)
+	for {
+		// the broker answers pings, so silence beyond the keep alive means a dead connection
+		conn.SetReadDeadline(time.Now().Add(c.keepAlive * 3 / 2))
+		p, err := readPacket(reader)
+		if err != nil {
+			select {
+			case <-c.done:
+				return ErrClosed
+			default:
+				return err
+			}
+		}
+		if p.kind != typePublish {
+			continue
+		}
+		topic, payload, id, err := decodePublish(p)
+		if err != nil {
+			return err
+		}
+		if id != 0 {
+			c.send(pubackPacket(id))
+		}
+		c.dispatch(topic, payload)
+	}
+}
+
+func (c *Client) dispatch(topic string, payload []byte) {
+	c.mutex.Lock()
+	subs := append([]subscription(nil), c.subs...)
+	c.mutex.Unlock()
+	for _, sub := range subs {
+		if matchTopic(sub.filter, topic) {
+			sub.handler(topic, payload)
+		}
+	}
+}
+
+// send writes the given packet to the current connection
+func (c *Client) send(p packet) error {
+
+	c.mutex.Lock()
+	conn := c.conn
+	c.mutex.Unlock()
+	if conn == nil {
+		return ErrNotConnected
+	}
+
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err := conn.Write(p.encode())
+	return err
+}
+
+// packetID returns the next non-zero packet identifier. The caller must hold the mutex
+func (c *Client) packetID() uint16 {
+	c.nextID++
+	if c.nextID == 0 {
+		c.nextID = 1
+	}
+	return c.nextID
+}
@@ -0,0 +1,239 @@
+package mqtt
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+)
+
+func TestNew_errors(t *testing.T) {
+
+	cases := map[string]string{
+		"bad url":    "tcp://%zz",
+		"bad scheme": "http://localhost",
+		"no host":    "tcp://",
+	}
+
+	for name, broker := range cases {
+		broker := broker
+		t.Run(name, func(t *testing.T) {
+			_, err := New(broker)
+			if !errors.Is(err, ErrBadBroker) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", ErrBadBroker, err)
+			}
+		})
+	}
+}
+
+func TestNew_defaultPorts(t *testing.T) {
+
+	cases := map[string]struct {
+		broker  string
+		addr    string
+		withTLS bool
+	}{
+		"tcp":   {broker: "tcp://host", addr: "host:1883"},
+		"mqtt":  {broker: "mqtt://host:1234", addr: "host:1234"},
+		"ssl":   {broker: "ssl://host", addr: "host:8883", withTLS: true},
+		"mqtts": {broker: "mqtts://host", addr: "host:8883", withTLS: true},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			client, err := New(c.broker)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := deep.Equal([]interface{}{client.addr, client.useTLS}, []interface{}{c.addr, c.withTLS}); diff != nil {
+				t.Fatal(diff)
+			}
+			if c.withTLS && client.tlsConfig.ServerName != "host" {
+				t.Fatalf("expected the server name to be set to the host, got: %q", client.tlsConfig.ServerName)
+			}
+		})
+	}
+}
+
+func TestClient_publishSubscribe(t *testing.T) {
+
+	broker := newFakeBroker(t, 0)
+	defer broker.close()
+
+	connChanges := make(chan error, 10)
+	client, err := New(
+		broker.url(),
+		OptClientID("test"),
+		OptCredentials("user", "pass"),
+		OptWill("status", []byte("offline"), true),
+		OptOnConnectionChange(func(err error) { connChanges <- err }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Publish("a/b", []byte("x"), false); !errors.Is(err, ErrNotConnected) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", ErrNotConnected, err)
+	}
+
+	received := make(chan string, 10)
+	err = client.Subscribe("cmd/+", func(topic string, payload []byte) {
+		received <- topic + "=" + string(payload)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.Start()
+	defer client.Close()
+	if err := waitConnChange(t, connChanges); err != nil {
+		t.Fatal(err)
+	}
+
+	connect := waitPacket(t, broker, typeConnect)
+	expected := connectPacket("test", "user", "pass", 30, &will{topic: "status", payload: []byte("offline"), retain: true})
+	if diff := deep.Equal(connect, expected); diff != nil {
+		t.Fatal(diff)
+	}
+	subscribe := waitPacket(t, broker, typeSubscribe)
+	if diff := deep.Equal(subscribe, subscribePacket(1, "cmd/+")); diff != nil {
+		t.Fatal(diff)
+	}
+
+	if err := client.Publish("a/b", []byte("x"), true); err != nil {
+		t.Fatal(err)
+	}
+	publish := waitPacket(t, broker, typePublish)
+	if diff := deep.Equal(publish, publishPacket("a/b", []byte("x"), true)); diff != nil {
+		t.Fatal(diff)
+	}
+
+	broker.send(publishPacket("other/topic", []byte("ignored"), false))
+	broker.send(publishPacket("cmd/fan", []byte("0.5"), false))
+	select {
+	case actual := <-received:
+		if actual != "cmd/fan=0.5" {
+			t.Fatalf("unexpected message: %s", actual)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for the subscribed message")
+	}
+}
+
+func TestClient_refused(t *testing.T) {
+
+	broker := newFakeBroker(t, 5)
+	defer broker.close()
+
+	connChanges := make(chan error, 10)
+	client, err := New(broker.url(), OptOnConnectionChange(func(err error) { connChanges <- err }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Start()
+	defer client.Close()
+
+	if err := waitConnChange(t, connChanges); !errors.Is(err, ErrConnectionRefused) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", ErrConnectionRefused, err)
+	}
+	if client.Connected() {
+		t.Fatal("expected the client not to be connected")
+	}
+}
+
+func TestClient_reconnect(t *testing.T) {
+
+	broker := newFakeBroker(t, 0)
+	defer broker.close()
+
+	connChanges := make(chan error, 10)
+	client, err := New(
+		broker.url(),
+		OptReconnectBackoff(time.Millisecond, time.Millisecond),
+		OptOnConnectionChange(func(err error) { connChanges <- err }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Subscribe("a", func(string, []byte) {}); err != nil {
+		t.Fatal(err)
+	}
+	client.Start()
+	defer client.Close()
+
+	if err := waitConnChange(t, connChanges); err != nil {
+		t.Fatal(err)
+	}
+	waitPacket(t, broker, typeSubscribe)
+
+	broker.dropConnections()
+	if err := waitConnChange(t, connChanges); err == nil {
+		t.Fatal("expected the broken connection to be reported")
+	}
+	if err := waitConnChange(t, connChanges); err != nil {
+		t.Fatal(err)
+	}
+	// subscriptions are restored on reconnection
+	waitPacket(t, broker, typeSubscribe)
+	if actual := broker.numConnects(); actual != 2 {
+		t.Fatalf("expected 2 connections, got: %d", actual)
+	}
+}
+
+func TestClient_Close(t *testing.T) {
+
+	broker := newFakeBroker(t, 0)
+	defer broker.close()
+
+	connChanges := make(chan error, 10)
+	client, err := New(broker.url(), OptOnConnectionChange(func(err error) { connChanges <- err }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Start()
+	if err := waitConnChange(t, connChanges); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+	waitPacket(t, broker, typeDisconnect)
+	if client.Connected() {
+		t.Fatal("expected the client not to be connected")
+	}
+	if err := client.Close(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", ErrClosed, err)
+	}
+	if err := client.Subscribe("a", nil); !errors.Is(err, ErrClosed) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", ErrClosed, err)
+	}
+}
+
+func waitConnChange(t *testing.T, connChanges <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-connChanges:
+		return err
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for a connection change")
+		return nil
+	}
+}
+
+// waitPacket returns the next packet of the given type that the broker receives
+func waitPacket(t *testing.T, broker *fakeBroker, kind byte) packet {
+	t.Helper()
+	deadline := time.After(time.Second)
+	for {
+		select {
+		case p := <-broker.packets:
+			if p.kind == kind {
+				return p
+			}
+		case <-deadline:
+			t.Fatalf("timeout waiting for packet type %d", kind)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package mqtt
+
+import (
+	"crypto/tls"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Option is used to pass optional parameters to the New factory function
+type Option func(*Client)
+
+func defaultClientID() string {
+	return "heatsink-" + strconv.Itoa(os.Getpid())
+}
+
+// OptClientID sets the client identifier, which must be unique per broker. If id is empty, it
+// is set to the default value
+//
+// (default: "heatsink-<pid>")
+func OptClientID(id string) Option {
+	return func(c *Client) {
+		if id != "" {
+			c.clientID = id
+		}
+	}
+}
+
+// OptCredentials sets the username and password sent to the broker. Empty values are not sent
+//
+// (default: no credentials)
+func OptCredentials(username, password string) Option {
+	return func(c *Client) {
+		c.username, c.password = username, password
+	}
+}
+
+// OptTLSConfig sets the TLS configuration used for 'ssl', 'tls', and 'mqtts' brokers. If the
+// server name is not set, it is set to the broker's host name. If config is nil, it is set to
+// the default value
+//
+// (default: the system's root certificate authorities)
+func OptTLSConfig(config *tls.Config) Option {
+	return func(c *Client) {
+		if config != nil {
+			c.tlsConfig = config
+		}
+	}
+}
+
+// OptKeepAlive sets the interval at which the client pings the broker. If the broker is silent
+// for one and a half times this interval, the connection is considered broken. If d is less
+// than one second, it is set to the default value
+//
+// (default: 30 seconds)
+func OptKeepAlive(d time.Duration) Option {
+	return func(c *Client) {
+		if d >= time.Second {
+			c.keepAlive = d
+		}
+	}
+}
+
+// OptWill sets a message that the broker publishes on behalf of the client if the client
+// disconnects without closing, e.g. to mark the daemon as offline. If topic is empty, no will
+// is set
+//
+// (default: no will)
+func OptWill(topic string, payload []byte, retain bool) Option {
+	return func(c *Client) {
+		if topic == "" {
+			c.will = nil
+			return
+		}
+		c.will = &will{topic: topic, payload: payload, retain: retain}
+	}
+}
+
+// OptReconnectBackoff sets the initial and maximum delays between connection attempts. The
+// delay doubles after every failed attempt. Non-positive values are set to the default values
+//
+// (default: 1 second, 1 minute)
+func OptReconnectBackoff(min, max time.Duration) Option {
+	return func(c *Client) {
+		if min > 0 {
+			c.minBackoff = min
+		}
+		if max > 0 {
+			c.maxBackoff = max
+		}
+		if c.maxBackoff < c.minBackoff {
+			c.maxBackoff = c.minBackoff
+		}
+	}
+}
+
+// OptOnConnectionChange sets a function that is called with nil whenever the client connected
+// and with the cause whenever a connection attempt failed or the connection broke. It is
+// useful for logging and for publishing messages that must be sent on every connection
+//
+// (default: nil)
+func OptOnConnectionChange(handler func(err error)) Option {
+	return func(c *Client) {
+		c.onConnChg = handler
+	}
+}
@@ -0,0 +1,202 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Control packet types of MQTT 3.1.1
+const (
+	typeConnect    byte = 1
+	typeConnack    byte = 2
+	typePublish    byte = 3
+	typePuback     byte = 4
+	typeSubscribe  byte = 8
+	typeSuback     byte = 9
+	typePingreq    byte = 12
+	typePingresp   byte = 13
+	typeDisconnect byte = 14
+	protocolLevel  byte = 4
+)
+
+// packet is a decoded control packet, where body is everything after the fixed header
+type packet struct {
+	kind  byte
+	flags byte
+	body  []byte
+}
+
+// encode returns the packet with its fixed header
+func (p packet) encode() []byte {
+	buf := []byte{p.kind<<4 | p.flags&0x0f}
+	n := len(p.body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		buf = append(buf, b)
+		if n == 0 {
+			break
+		}
+	}
+	return append(buf, p.body...)
+}
+
+// readPacket reads a single control packet
+func readPacket(r *bufio.Reader) (packet, error) {
+
+	first, err := r.ReadByte()
+	if err != nil {
+		return packet{}, err
+	}
+
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return packet{}, err
+		}
+		length += int(b&0x7f) * multiplier
+		if b&0x80 == 0 {
+			break
+		}
+		if i == 3 {
+			return packet{}, fmt.Errorf("%w: remaining length exceeds four bytes", ErrProtocol)
+		}
+		multiplier *= 128
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return packet{}, err
+	}
+	return packet{kind: first >> 4, flags: first & 0x0f, body: body}, nil
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = append(buf, byte(len(s)>>8), byte(len(s)))
+	return append(buf, s...)
+}
+
+// readString reads a length-prefixed string from the given buffer and returns the rest
+func readString(buf []byte) (string, []byte, error) {
+	if len(buf) < 2 {
+		return "", nil, fmt.Errorf("%w: truncated string", ErrProtocol)
+	}
+	n := int(binary.BigEndian.Uint16(buf))
+	if len(buf) < 2+n {
+		return "", nil, fmt.Errorf("%w: truncated string", ErrProtocol)
+	}
+	return string(buf[2 : 2+n]), buf[2+n:], nil
+}
+
+// will is the message the broker publishes on behalf of a client that disconnects abnormally
+type will struct {
+	topic   string
+	payload []byte
+	retain  bool
+}
+
+// connectPacket returns a CONNECT packet with a clean session
+func connectPacket(clientID, username, password string, keepAlive uint16, w *will) packet {
+
+	flags := byte(0x02) // clean session
+	if w != nil {
+		flags |= 0x04
+		if w.retain {
+			flags |= 0x20
+		}
+	}
+	if username != "" {
+		flags |= 0x80
+	}
+	if password != "" {
+		flags |= 0x40
+	}
+
+	body := appendString(nil, "MQTT")
+	body = append(body, protocolLevel, flags, byte(keepAlive>>8), byte(keepAlive))
+	body = appendString(body, clientID)
+	if w != nil {
+		body = appendString(body, w.topic)
+		body = appendString(body, string(w.payload))
+	}
+	if username != "" {
+		body = appendString(body, username)
+	}
+	if password != "" {
+		body = appendString(body, password)
+	}
+	return packet{kind: typeConnect, body: body}
+}
+
+// publishPacket returns a PUBLISH packet with QoS 0
+func publishPacket(topic string, payload []byte, retain bool) packet {
+	var flags byte
+	if retain {
+		flags = 0x01
+	}
+	body := appendString(nil, topic)
+	return packet{kind: typePublish, flags: flags, body: append(body, payload...)}
+}
+
+// decodePublish returns the topic, payload, and packet identifier of a PUBLISH packet. The
+// packet identifier is zero for QoS 0
+func decodePublish(p packet) (topic string, payload []byte, id uint16, err error) {
+	topic, rest, err := readString(p.body)
+	if err != nil {
+		return "", nil, 0, err
+	}
+	if qos := p.flags >> 1 & 0x03; qos > 0 {
+		if len(rest) < 2 {
+			return "", nil, 0, fmt.Errorf("%w: truncated packet identifier", ErrProtocol)
+		}
+		id, rest = binary.BigEndian.Uint16(rest), rest[2:]
+	}
+	return topic, rest, id, nil
+}
+
+// subscribePacket returns a SUBSCRIBE packet requesting QoS 0 for the given topic filter
+func subscribePacket(id uint16, filter string) packet {
+	body := []byte{byte(id >> 8), byte(id)}
+	body = appendString(body, filter)
+	return packet{kind: typeSubscribe, flags: 0x02, body: append(body, 0)}
+}
+
+// pubackPacket returns a PUBACK packet acknowledging the given packet identifier
+func pubackPacket(id uint16) packet {
+	return packet{kind: typePuback, body: []byte{byte(id >> 8), byte(id)}}
+}
+
+// matchTopic reports whether the given topic matches the given filter, which may contain the
+// single-level wildcard '+' and the multi-level wildcard '#'
+func matchTopic(filter, topic string) bool {
+	for {
+		fLevel, fRest, fMore := cutLevel(filter)
+		if fLevel == "#" {
+			return true
+		}
+		tLevel, tRest, tMore := cutLevel(topic)
+		if fLevel != "+" && fLevel != tLevel {
+			return false
+		}
+		if !fMore || !tMore {
+			return fMore == tMore || (!tMore && fRest == "#")
+		}
+		filter, topic = fRest, tRest
+	}
+}
+
+// cutLevel splits the first level of a topic from the remaining levels
+func cutLevel(topic string) (level, rest string, more bool) {
+	for i := 0; i < len(topic); i++ {
+		if topic[i] == '/' {
+			return topic[:i], topic[i+1:], true
+		}
+	}
+	return topic, "", false
+}
@@ -0,0 +1,96 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestPacket_encodeRead(t *testing.T) {
+
+	cases := map[string]int{
+		"empty":      0,
+		"one byte":   127,
+		"two bytes":  128,
+		"many bytes": 16384,
+	}
+
+	for name, size := range cases {
+		size := size
+		t.Run(name, func(t *testing.T) {
+			expected := packet{kind: typePublish, flags: 0x01, body: make([]byte, size)}
+			actual, err := readPacket(bufio.NewReader(bytes.NewReader(expected.encode())))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := deep.Equal(actual, expected); diff != nil {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestReadPacket_lengthTooLong(t *testing.T) {
+	data := []byte{typePublish << 4, 0xff, 0xff, 0xff, 0xff, 0x01}
+	_, err := readPacket(bufio.NewReader(bytes.NewReader(data)))
+	if !errors.Is(err, ErrProtocol) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", ErrProtocol, err)
+	}
+}
+
+func TestDecodePublish(t *testing.T) {
+
+	qos0 := publishPacket("a/b", []byte("hello"), true)
+	topic, payload, id, err := decodePublish(qos0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal([]interface{}{topic, string(payload), id}, []interface{}{"a/b", "hello", uint16(0)}); diff != nil {
+		t.Fatal(diff)
+	}
+
+	qos1 := packet{kind: typePublish, flags: 0x02, body: append(appendString(nil, "a/b"), 0x01, 0x02, 'x')}
+	topic, payload, id, err = decodePublish(qos1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal([]interface{}{topic, string(payload), id}, []interface{}{"a/b", "x", uint16(0x0102)}); diff != nil {
+		t.Fatal(diff)
+	}
+
+	truncated := packet{kind: typePublish, flags: 0x02, body: appendString(nil, "a/b")}
+	if _, _, _, err := decodePublish(truncated); !errors.Is(err, ErrProtocol) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", ErrProtocol, err)
+	}
+}
+
+func TestMatchTopic(t *testing.T) {
+
+	cases := []struct {
+		filter   string
+		topic    string
+		expected bool
+	}{
+		{filter: "a/b", topic: "a/b", expected: true},
+		{filter: "a/b", topic: "a/c", expected: false},
+		{filter: "a/b", topic: "a/b/c", expected: false},
+		{filter: "a/b/c", topic: "a/b", expected: false},
+		{filter: "a/+", topic: "a/b", expected: true},
+		{filter: "a/+", topic: "a/b/c", expected: false},
+		{filter: "a/+/c", topic: "a/b/c", expected: true},
+		{filter: "a/#", topic: "a/b/c", expected: true},
+		{filter: "a/#", topic: "a", expected: true},
+		{filter: "#", topic: "a/b", expected: true},
+		{filter: "+/+", topic: "a/b", expected: true},
+		{filter: "b/#", topic: "a/b", expected: false},
+	}
+
+	for _, c := range cases {
+		if actual := matchTopic(c.filter, c.topic); actual != c.expected {
+			t.Errorf("matchTopic(%q, %q): want %v, got %v", c.filter, c.topic, c.expected, actual)
+		}
+	}
+}
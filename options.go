@@ -1,51 +1,242 @@
 package heatsink
 
 import (
+	"fmt"
+	"math"
+	"math/rand"
 	"time"
 
 	"go.uber.org/zap"
 )
 
-// Option is used to pass optional parameters to the Heatsink factory function
+// Option is used to pass optional parameters to the Heatsink factory function. Options that are
+// given invalid values fall back to their documented behavior, which is logged as a warning
+// unless OptStrict is given, in which case New returns an error instead
 type Option func(*Config, *Heatsink)
 
+// OptStrict makes New return an error wrapping ErrBadOption for every option that was given an
+// invalid value, e.g. an empty name or a negative duration, instead of logging a warning and
+// falling back to the option's documented behavior. This surfaces misconfigurations of the
+// embedding code early
+//
+// (default: false)
+func OptStrict(enabled bool) Option {
+	return func(_ *Config, hs *Heatsink) {
+		hs.strict = enabled
+	}
+}
+
+// invalidOption records that the named option was given an invalid value
+func (hs *Heatsink) invalidOption(name, format string, args ...interface{}) {
+	hs.optErrs = append(hs.optErrs, fmt.Errorf("%w: %s: %s", ErrBadOption, name, fmt.Sprintf(format, args...)))
+}
+
 type fanResponse int
 
 // Values that can be passed to option 'OptFanResponse'
 const (
 	FanResponsePowPi fanResponse = iota
 	FanResponseLinear
+	FanResponsePow
+	FanResponseSigmoid
 )
 
 // OptFanResponse controls how the fan speed is adjusted in response to temperature changes.
 // The following mechanisms are supported:
-//  FanResponseLinear: ideal for unpredictable temperatures -- dutyCucle(x) = x
-//  FanResponsePowPi: ideal for unsustained temperature spikes (quiet) -- f(x) = x**π
+//
+//	FanResponseLinear: ideal for unpredictable temperatures -- dutyCucle(x) = x
+//	FanResponsePowPi: ideal for unsustained temperature spikes (quiet) -- f(x) = x**π
+//	FanResponsePow: f(x) = x**exponent, where the exponent is set by OptFanResponsePow
+//	FanResponseSigmoid: an S-shaped curve, whose shape is set by OptFanResponseSigmoid
 //
 // (default: FanResponsePowPi)
 func OptFanResponse(meth fanResponse) Option {
 	return func(config *Config, hs *Heatsink) {
-		switch meth {
-		case FanResponseLinear:
-			hs.dcCalc = newDutyCyclerLinear(config.MinTemperature, config.MaxTemperature)
-		default:
-			hs.dcCalc = newDutyCyclerPowPi(config.MinTemperature, config.MaxTemperature)
+		if meth < FanResponsePowPi || meth > FanResponseSigmoid {
+			hs.invalidOption("OptFanResponse", "unknown fan response %d", meth)
+		}
+		hs.response = meth
+		hs.dcCalc = newDutyCycler(meth, hs.curve, config.MinTemperature, config.MaxTemperature)
+	}
+}
+
+// OptFanResponsePow makes the fan response a power curve with the given exponent, i.e. f(x) =
+// x**exponent, where x is the fraction of the temperature range. An exponent of one is linear,
+// and the higher it is, the quieter the fan stays before ramping up near the maximum
+// temperature. If exponent is less than or equal to zero, the option is ignored
+//
+// (default: FanResponsePowPi, i.e. an exponent of π)
+func OptFanResponsePow(exponent float64) Option {
+	return func(config *Config, hs *Heatsink) {
+		if exponent <= 0 {
+			hs.invalidOption("OptFanResponsePow", "exponent %v is not positive", exponent)
+			return
+		}
+		hs.response, hs.curve.exponent = FanResponsePow, exponent
+		hs.dcCalc = newDutyCycler(FanResponsePow, hs.curve, config.MinTemperature, config.MaxTemperature)
+	}
+}
+
+// OptFanResponseSigmoid makes the fan response a logistic curve that is scaled to run from zero
+// at the minimum temperature to one at the maximum temperature. The midpoint is where the curve
+// is steepest as a fraction of the temperature range, e.g. 0.7 keeps the fan quiet through
+// mid temperatures and ramps it up steeply in the upper third. The steepness is how sharp the
+// ramp is, where values around 10 are pronounced and values close to zero are almost linear.
+// If midpoint is not within (0, 1) or steepness is not positive, the option is ignored
+//
+// (default: FanResponsePowPi)
+func OptFanResponseSigmoid(midpoint, steepness float64) Option {
+	return func(config *Config, hs *Heatsink) {
+		if !validSigmoid(midpoint, steepness) {
+			hs.invalidOption("OptFanResponseSigmoid", "midpoint %v, steepness %v", midpoint, steepness)
+			return
 		}
+		hs.response = FanResponseSigmoid
+		hs.curve.midpoint, hs.curve.steepness = midpoint, steepness
+		hs.dcCalc = newDutyCycler(FanResponseSigmoid, hs.curve, config.MinTemperature, config.MaxTemperature)
 	}
 }
 
-// OptTemperatureCheckPeriod is the waiting time between temperature checks. If d is less than
-// or equal to zero, it is set to the default value
+// OptSteps replaces the fan response curve with discrete steps, emulating the step behavior of
+// many BIOS fan controls. The duty cycle is that of the highest step whose temperature is
+// exceeded, or zero if there is none, and it only moves to another step after the temperature
+// stayed within that step's band for the dwell time. Steps may be given in any order. Service
+// levels, the critical temperature, and boundaries still apply. If no steps are given or dwell
+// is negative, the option is ignored
+//
+// (default: no steps, the fan response curve is used)
+func OptSteps(steps []Step, dwell time.Duration) Option {
+	return func(_ *Config, hs *Heatsink) {
+		if len(steps) == 0 || dwell < 0 {
+			hs.invalidOption("OptSteps", "%d steps, dwell %v", len(steps), dwell)
+			return
+		}
+		hs.dcCalc = newDutyCyclerStepped(steps, dwell)
+	}
+}
+
+// OptFanResponseFunc replaces the fan response curve with the given function of the
+// temperature, e.g. one compiled from a user-defined expression. The duty cycle is its result
+// clamped to [0,1], or full speed if it fails or returns NaN, which errs on the side of
+// cooling. Service levels, the critical temperature, and boundaries still apply. If curve is
+// nil, the option is ignored
+//
+// (default: no function, the fan response curve is used)
+func OptFanResponseFunc(curve func(temp float64) (float64, error)) Option {
+	return func(_ *Config, hs *Heatsink) {
+		if curve == nil {
+			hs.invalidOption("OptFanResponseFunc", "curve is nil")
+			return
+		}
+		hs.dcCalc = dutyCyclerFunc(curve)
+	}
+}
+
+// OptBoundaries makes the fan's duty cycle at and beyond the minimum and maximum temperatures
+// explicit. By default, the fan stops at and below the minimum temperature and runs at full
+// speed at and above the maximum temperature. For example, a lower boundary with a duty cycle
+// of 0.2 keeps the fan spinning slowly when it is cool, and making it exclusive lets the fan
+// response curve decide the duty cycle exactly at the minimum temperature
+//
+// (default: Boundary{DutyCycle: 0, Inclusive: true}, Boundary{DutyCycle: 1, Inclusive: true})
+func OptBoundaries(lower, upper Boundary) Option {
+	return func(config *Config, hs *Heatsink) {
+		for _, b := range []Boundary{lower, upper} {
+			if b.DutyCycle < 0 || b.DutyCycle > 1 {
+				hs.invalidOption("OptBoundaries", "duty cycle %v is clamped to [0,1]", b.DutyCycle)
+			}
+		}
+		lo, up := lower, upper
+		lo.DutyCycle = math.Max(0, math.Min(1, lo.DutyCycle))
+		up.DutyCycle = math.Max(0, math.Min(1, up.DutyCycle))
+		hs.bounds = &dutyCyclerBounded{
+			minTemp: config.MinTemperature,
+			maxTemp: config.MaxTemperature,
+			lower:   lo,
+			upper:   up,
+		}
+	}
+}
+
+// OptTemperatureCheckPeriod is the interval between the starts of temperature checks. If d is
+// less than or equal to zero, it is set to the default value
 //
 // (default: 1 second)
 func OptTemperatureCheckPeriod(d time.Duration) Option {
 	return func(_ *Config, hs *Heatsink) {
+		if d < 0 {
+			hs.invalidOption("OptTemperatureCheckPeriod", "duration %v is negative", d)
+		}
 		if d > 0 {
 			hs.chkPeriod = d
 		}
 	}
 }
 
+// OptCheckPeriodJitter shifts each waiting time between temperature checks randomly by up to
+// the given duration in either direction, so that heatsinks sharing a check period do not read
+// sensors and write to fans at the same instant. On average, the check period is unchanged. If
+// d is less than or equal to zero, or not less than half the check period, it is set to the
+// default value
+//
+// (default: no jitter)
+func OptCheckPeriodJitter(d time.Duration) Option {
+	return func(_ *Config, hs *Heatsink) {
+		if d < 0 {
+			hs.invalidOption("OptCheckPeriodJitter", "duration %v is negative", d)
+		}
+		if d > 0 {
+			hs.jitter = &jitter{max: d, rnd: rand.New(rand.NewSource(time.Now().UnixNano()))}
+		}
+	}
+}
+
+// OptAdaptiveCheckPeriod lengthens the check period while the temperature is stable and low,
+// which reduces wakeups on battery-powered devices. After each check where the hottest sensor
+// is below calmBelow and its temperature changed by at most maxRate degrees per second, the
+// check period doubles up to maxPeriod. Otherwise, the configured check period is restored.
+// If calmBelow is zero, it is set to the maximum temperature of the config. If maxPeriod is
+// less than or equal to zero or maxRate is negative, the option is ignored
+//
+// (default: fixed check period)
+func OptAdaptiveCheckPeriod(maxPeriod time.Duration, maxRate, calmBelow float64) Option {
+	return func(_ *Config, hs *Heatsink) {
+		if maxPeriod <= 0 || maxRate < 0 {
+			hs.invalidOption("OptAdaptiveCheckPeriod", "max period %v, max rate %v", maxPeriod, maxRate)
+			return
+		}
+		hs.adaptive = &adaptivePeriod{maxPeriod: maxPeriod, maxRate: maxRate, calmBelow: calmBelow}
+	}
+}
+
+// OptPhaseOffset delays the first temperature check by the given duration, which staggers
+// heatsinks that share a check period by a fixed offset. If d is less than or equal to zero, it
+// is set to the default value
+//
+// (default: no offset)
+func OptPhaseOffset(d time.Duration) Option {
+	return func(_ *Config, hs *Heatsink) {
+		if d < 0 {
+			hs.invalidOption("OptPhaseOffset", "duration %v is negative", d)
+		}
+		if d > 0 {
+			hs.phaseOffset = d
+		}
+	}
+}
+
+// OptCatchUpOverruns sets whether the next temperature check is done right away when a control
+// iteration took longer than the check period, instead of skipping the missed checks and
+// waiting for the following multiple of the check period. Either way, the overrun is logged and
+// counted, see Overruns()
+//
+// (default: false)
+func OptCatchUpOverruns(enabled bool) Option {
+	return func(_ *Config, hs *Heatsink) {
+		hs.catchUp = enabled
+	}
+}
+
 // OptLogger is the logger that will be used by the heatsink. If logger is nil, it is set to the
 // default value
 //
@@ -64,8 +255,352 @@ func OptLogger(logger *zap.Logger) Option {
 // (default: "heatsink/<fan.name>")
 func OptName(name string) Option {
 	return func(_ *Config, hs *Heatsink) {
+		if name == "" {
+			hs.invalidOption("OptName", "name is empty")
+		}
 		if name != "" {
 			hs.name = name
 		}
 	}
 }
+
+// OptLogReasons enables debug-level log entries that explain every change to the fan's duty
+// cycle, including the hottest sensor, the aggregated temperature, the output of the fan
+// response curve, and any adjustments applied on top of it. The entries carry the field
+// 'event' set to "duty_cycle_change" so they can be filtered easily
+//
+// (default: false)
+func OptLogReasons(enabled bool) Option {
+	return func(_ *Config, hs *Heatsink) {
+		hs.logReasons = enabled
+	}
+}
+
+// OptPeriodicSummary enables info-level log entries that summarize the temperature and duty
+// cycle over a window of control iterations, which is useful with short check periods where
+// logging every iteration would flood the logs. A summary is logged once the given number of
+// iterations completed or the given period elapsed, whichever comes first. A non-positive
+// value disables the respective trigger and, if both are non-positive, summaries are disabled.
+// The entries carry the field 'event' set to "summary"
+//
+// (default: disabled)
+func OptPeriodicSummary(iterations int, period time.Duration) Option {
+	return func(_ *Config, hs *Heatsink) {
+		if iterations <= 0 && period <= 0 {
+			hs.summary = nil
+			return
+		}
+		hs.summary = &summary{everyN: iterations, period: period}
+	}
+}
+
+// OptSampleHandler sets a function that receives the sample of every control iteration, e.g.
+// to forward it to a telemetry sink. It is called synchronously by the control loop, so it
+// should return quickly. If handler is nil, it is set to the default value
+//
+// (default: nil, i.e. samples are not emitted)
+func OptSampleHandler(handler func(Sample)) Option {
+	return func(_ *Config, hs *Heatsink) {
+		if handler != nil {
+			hs.onSample = handler
+		}
+	}
+}
+
+// OptSampleDeltas limits the samples passed to the sample handler to those whose temperature
+// or duty cycle changed by at least the given deltas since the last passed sample. Regardless
+// of the deltas, a sample is passed once the heartbeat interval elapsed since the last passed
+// one. A non-positive value disables the respective condition and, if all of them are
+// non-positive, every sample is passed
+//
+// (default: every sample is passed)
+func OptSampleDeltas(temperature, dutyCycle float64, heartbeat time.Duration) Option {
+	return func(_ *Config, hs *Heatsink) {
+		if temperature <= 0 && dutyCycle <= 0 && heartbeat <= 0 {
+			hs.smplFilter = nil
+			return
+		}
+		hs.smplFilter = &sampleFilter{
+			tempDelta: temperature,
+			dcDelta:   dutyCycle,
+			heartbeat: heartbeat,
+		}
+	}
+}
+
+// OptInitialDutyCycle sets a duty cycle ratio, which is clamped to [0,1], that is applied to
+// the fan as soon as thermal control starts, before the first temperature check. This is
+// useful to restore the last applied duty cycle after a restart. If dcRatio is negative, no
+// initial duty cycle is applied
+//
+// (default: none)
+func OptInitialDutyCycle(dcRatio float64) Option {
+	return func(_ *Config, hs *Heatsink) {
+		if dcRatio < 0 {
+			hs.initDC = nil
+			return
+		}
+		if dcRatio > 1 {
+			hs.invalidOption("OptInitialDutyCycle", "duty cycle %v is clamped to 1", dcRatio)
+		}
+		dc := math.Min(1, dcRatio)
+		hs.initDC = &dc
+	}
+}
+
+// OptUnchangedDutyCycle sets when applying a duty cycle to the fan is skipped because it is
+// within epsilon of the last applied one, in which case the fan keeps running at the latter.
+// The last applied duty cycle is nonetheless reapplied once the refresh interval elapsed
+// since it was applied, so that fan drivers that check the fan whenever a duty cycle is set
+// keep doing so. A non-positive refresh never reapplies it and a negative epsilon disables
+// skipping altogether
+//
+// (default: epsilon = 0, refresh = 1 minute)
+func OptUnchangedDutyCycle(epsilon float64, refresh time.Duration) Option {
+	return func(_ *Config, hs *Heatsink) {
+		if epsilon < 0 {
+			hs.skipDC = nil
+			return
+		}
+		hs.skipDC = &dutyCycleSkip{epsilon: epsilon, refresh: refresh}
+	}
+}
+
+// OptDutyCycleHistogram sets the initial times of the duty cycle histogram, to which the
+// time spent in each band is added. This is useful to keep accumulating the histogram across
+// restarts
+//
+// (default: all zeros)
+func OptDutyCycleHistogram(initial DutyCycleHistogram) Option {
+	return func(_ *Config, hs *Heatsink) {
+		hs.histogram = initial
+	}
+}
+
+// OptSensorConcurrency sets the maximum number of sensors that are read concurrently during a
+// single temperature check. If n is less than or equal to zero, it is set to the default value.
+// Setting it to one reads the sensors serially
+//
+// (default: 4)
+func OptSensorConcurrency(n int) Option {
+	return func(_ *Config, hs *Heatsink) {
+		if n < 0 {
+			hs.invalidOption("OptSensorConcurrency", "%d is negative", n)
+		}
+		if n > 0 {
+			hs.numWorkers = n
+		}
+	}
+}
+
+// OptAmbientSensor enables delta-T control, in which the minimum and maximum temperatures
+// apply to the difference between the hottest sensor and the given ambient sensor rather than
+// to the absolute temperature. The heatsink takes ownership of the ambient sensor and closes
+// it when thermal control is stopped. If reading the ambient sensor fails, the absolute
+// temperature is used for that check. If sensor is nil, delta-T control is disabled
+//
+// (default: nil)
+func OptAmbientSensor(sensor ThermoSensor) Option {
+	return func(_ *Config, hs *Heatsink) {
+		hs.ambient = sensor
+	}
+}
+
+// OptAmbientDeltaRange gives delta-T control its own range, where the fan spins at the minimum
+// speed while the hottest sensor is at most minDelta degrees above the ambient temperature and
+// at the maximum speed while it is maxDelta degrees or more above it. The minimum and maximum
+// temperatures of the config then only apply to the absolute temperature, which is used while
+// reading the ambient sensor fails. The fan response and boundaries apply to both ranges. If
+// no ambient sensor is set or minDelta is not less than maxDelta, the option is ignored
+//
+// (default: delta-T control uses the minimum and maximum temperatures of the config)
+func OptAmbientDeltaRange(minDelta, maxDelta float64) Option {
+	return func(_ *Config, hs *Heatsink) {
+		if minDelta >= maxDelta {
+			hs.invalidOption("OptAmbientDeltaRange", "min delta %v is not less than max delta %v", minDelta, maxDelta)
+			return
+		}
+		hs.deltaRange = &deltaRange{min: minDelta, max: maxDelta}
+	}
+}
+
+// OptInput adds a group of sensors with its own fan response curve. On each check, the fan's
+// duty cycle is raised to the one derived from the input's hottest sensor whenever it is
+// higher than the one derived from the config's sensors, so the most demanding curve wins.
+// This option can be passed multiple times to add multiple inputs. The heatsink takes
+// ownership of the input's sensors and closes them when thermal control is stopped. If the
+// input has no sensors, a nil sensor, or its minimum temperature is not less than its
+// maximum temperature, the option is ignored
+//
+// (default: no inputs)
+func OptInput(in Input) Option {
+	return func(_ *Config, hs *Heatsink) {
+		if len(in.Sensors) == 0 || in.MinTemperature >= in.MaxTemperature {
+			hs.invalidOption("OptInput", "input '%s' has %d sensors and range [%v, %v]",
+				in.Name, len(in.Sensors), in.MinTemperature, in.MaxTemperature)
+			return
+		}
+		for _, sensor := range in.Sensors {
+			if sensor == nil {
+				hs.invalidOption("OptInput", "input '%s' has a nil sensor", in.Name)
+				return
+			}
+		}
+		hs.inputs = append(hs.inputs, input{
+			name:    in.Name,
+			sensors: append([]ThermoSensor{}, in.Sensors...),
+			dcCalc: newDutyCycler(in.Response, curveParams{
+				exponent:  in.Exponent,
+				midpoint:  in.Midpoint,
+				steepness: in.Steepness,
+			}, in.MinTemperature, in.MaxTemperature),
+		})
+	}
+}
+
+// OptRateOfChange factors in how fast the temperature changes to reduce thermal overshoot on
+// bursty workloads. While the temperature rises, the duty cycle is derived from the temperature
+// projected gain seconds ahead at the current rate of change, which ramps up the fan earlier.
+// While the duty cycle falls, it decreases by at most relaxRate per second, e.g. 0.01 takes at
+// least 100 seconds to go from full speed to a stop. If gain is zero, temperatures are not
+// projected, and if relaxRate is zero, decreases are not limited. If both are less than or
+// equal to zero, the option is ignored
+//
+// (default: rate of change is not considered)
+func OptRateOfChange(gain, relaxRate float64) Option {
+	return func(_ *Config, hs *Heatsink) {
+		if gain < 0 || relaxRate < 0 {
+			hs.invalidOption("OptRateOfChange", "gain %v, relax rate %v", gain, relaxRate)
+		}
+		if gain <= 0 && relaxRate <= 0 {
+			return
+		}
+		hs.roc = &rateOfChange{gain: gain, relaxRate: relaxRate}
+	}
+}
+
+// OptSchedule adjusts the fan during a daily time window, e.g. to cap it at 40% between 22h and
+// 7h unless the temperature exceeds a safety threshold. During the window, the duty cycle is
+// capped and the fan response curve uses the schedule's temperature range, if set. This option
+// can be passed multiple times, in which case the first schedule whose window contains the
+// current time applies. A schedule's curve does not apply to delta-T control with its own
+// range. If the schedule's window is empty or its temperature range is set but invalid, the
+// option is ignored
+//
+// (default: no schedules)
+func OptSchedule(s Schedule) Option {
+	return func(_ *Config, hs *Heatsink) {
+		if s.Start == s.End || s.Start < 0 || s.End < 0 {
+			hs.invalidOption("OptSchedule", "schedule '%s' has an empty window", s.Name)
+			return
+		}
+		hasRange := s.MinTemperature != 0 || s.MaxTemperature != 0
+		if hasRange && s.MinTemperature >= s.MaxTemperature {
+			hs.invalidOption("OptSchedule", "schedule '%s' has the range [%v, %v]",
+				s.Name, s.MinTemperature, s.MaxTemperature)
+			return
+		}
+		hs.schedules = append(hs.schedules, schedule{Schedule: s})
+	}
+}
+
+// OptAuxInput adds an auxiliary input whose readings are mapped linearly to a duty cycle
+// ratio, where readings at or below low map to zero and readings at or above high map to one.
+// The fan's duty cycle is raised to that ratio whenever it is higher than the one derived from
+// temperature, which ramps up the fan before the temperature catches up. This option can be
+// passed multiple times to add multiple inputs. The inputs are closed when thermal control is
+// stopped. If input is nil or low is not less than high, the option is ignored
+//
+// (default: no auxiliary inputs)
+func OptAuxInput(input AuxInput, low, high float64) Option {
+	return func(_ *Config, hs *Heatsink) {
+		if input == nil || low >= high {
+			hs.invalidOption("OptAuxInput", "input is nil or low %v is not less than high %v", low, high)
+			return
+		}
+		hs.auxInputs = append(hs.auxInputs, auxInput{input: input, low: low, high: high})
+	}
+}
+
+// OptServiceLevel declares that the fan's duty cycle must be at least minDutyCycle whenever
+// the hottest sensor's absolute temperature is above aboveTemp. Service levels are enforced
+// after every other adjustment, acting as a final guardrail against misconfiguration. This
+// option can be passed multiple times to declare multiple service levels, in which case the
+// highest applicable minimum wins. minDutyCycle is clamped to the range [0.0, 1.0]
+//
+// (default: no service levels)
+func OptServiceLevel(aboveTemp, minDutyCycle float64) Option {
+	return func(_ *Config, hs *Heatsink) {
+		if minDutyCycle < 0 || minDutyCycle > 1 {
+			hs.invalidOption("OptServiceLevel", "duty cycle %v is clamped to [0,1]", minDutyCycle)
+		}
+		minDC := math.Max(0.0, math.Min(1.0, minDutyCycle))
+		hs.svcLevels = append(hs.svcLevels, serviceLevel{aboveTemp: aboveTemp, minDC: minDC})
+	}
+}
+
+// OptCriticalTemperature sets the temperature at and above which the fan is run at full speed,
+// overriding every other adjustment including service levels. Reaching it is logged as an
+// error and reported by the samples of the affected iterations. It is typically above the
+// maximum temperature and derived from the hardware's own critical trip point
+//
+// (default: no critical temperature)
+func OptCriticalTemperature(temp float64) Option {
+	return func(_ *Config, hs *Heatsink) {
+		hs.critTemp = &temp
+	}
+}
+
+// OptSensorQuarantine leaves the readings of misbehaving sensors out of the hottest
+// temperature, e.g. a sensor whose readings jump by 50°C or that fails every other read, until
+// it reads well again. Quarantining and readmitting a sensor is logged, and samples report the
+// quarantined sensors. If every sensor that reads successfully is quarantined, their readings
+// are used anyway. For details, see the documentation for type 'SensorQuarantine'. If any
+// field is negative or MinScore is above one, the option is ignored
+//
+// (default: sensors are not quarantined)
+func OptSensorQuarantine(q SensorQuarantine) Option {
+	return func(_ *Config, hs *Heatsink) {
+		if q.MaxJump < 0 || q.StuckReads < 0 || q.Window < 0 || q.MinScore < 0 || q.MinScore > 1 || q.Readmit < 0 {
+			hs.invalidOption("OptSensorQuarantine", "%+v", q)
+			return
+		}
+		if q.Window == 0 {
+			q.Window = 10
+		}
+		if q.MinScore == 0 {
+			q.MinScore = 0.5
+		}
+		if q.Readmit == 0 {
+			q.Readmit = 5
+		}
+		hs.quarantine = &quarantine{SensorQuarantine: q, health: make([]sensorHealth, len(hs.sensors))}
+		for i := range hs.quarantine.health {
+			hs.quarantine.health[i].bad = make([]bool, q.Window)
+		}
+	}
+}
+
+// OptLastKnownGood reuses the last successful reading of a sensor whose read fails, for up to
+// maxStale failed reads in a row, before the sensor is considered failed. This keeps a single
+// transient error, e.g. EAGAIN, from leaving the sensor out of the hottest temperature. Reused
+// readings are logged at debug level and are not graded by the sensor quarantine. If maxStale
+// is less than or equal to zero, the option is ignored
+//
+// (default: failed reads are not replaced)
+func OptLastKnownGood(maxStale int) Option {
+	return func(_ *Config, hs *Heatsink) {
+		if maxStale < 0 {
+			hs.invalidOption("OptLastKnownGood", "%d is negative", maxStale)
+		}
+		if maxStale <= 0 {
+			return
+		}
+		hs.lastGood = &lastGood{
+			maxStale: maxStale,
+			temps:    make([]float64, len(hs.sensors)),
+			ok:       make([]bool, len(hs.sensors)),
+			misses:   make([]int, len(hs.sensors)),
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package heatsink
+
+import (
+	"time"
+)
+
+// rateOfChange projects rising temperatures ahead of time and limits how fast the duty cycle
+// decreases while temperatures fall
+type rateOfChange struct {
+	gain       float64
+	relaxRate  float64
+	prevTemp   float64
+	prevTime   time.Time
+	prevDC     float64
+	prevDCTime time.Time
+}
+
+// predict returns the given temperature projected gain seconds ahead at the rate it rose since
+// the previous check. Falling temperatures are not projected, which leaves relaxing the fan
+// to relax
+func (hs *Heatsink) predict(temp float64, now time.Time, why *reason) float64 {
+	roc := hs.roc
+	if roc == nil || roc.gain <= 0 {
+		return temp
+	}
+	prevTemp, prevTime := roc.prevTemp, roc.prevTime
+	roc.prevTemp, roc.prevTime = temp, now
+	elapsed := now.Sub(prevTime).Seconds()
+	if prevTime.IsZero() || elapsed <= 0 {
+		return temp
+	}
+	rate := (temp - prevTemp) / elapsed
+	if rate <= 0 {
+		return temp
+	}
+	projected := temp + roc.gain*rate
+	why.adjust("projected %.2f ahead to %.2f at %.2f per second", temp, projected, rate)
+	return projected
+}
+
+// relax limits how much the given duty cycle decreased since the previous check to the relax
+// rate per second, if any
+func (hs *Heatsink) relax(dcRatio float64, now time.Time, why *reason) float64 {
+	roc := hs.roc
+	if roc == nil || roc.relaxRate <= 0 {
+		return dcRatio
+	}
+	prevDC, prevTime := roc.prevDC, roc.prevDCTime
+	defer func() { roc.prevDC, roc.prevDCTime = dcRatio, now }()
+	if prevTime.IsZero() {
+		return dcRatio
+	}
+	if floor := prevDC - roc.relaxRate*now.Sub(prevTime).Seconds(); dcRatio < floor {
+		why.adjust("relaxed from %.2f to %.2f instead of %.2f", prevDC, floor, dcRatio)
+		dcRatio = floor
+	}
+	return dcRatio
+}
@@ -0,0 +1,70 @@
+package heatsink
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOptRateOfChange_ignoresInvalid(t *testing.T) {
+	t.Parallel()
+
+	hs := &Heatsink{}
+	OptRateOfChange(0, 0)(nil, hs)
+	OptRateOfChange(-1, -0.1)(nil, hs)
+	if hs.roc != nil {
+		t.Fatalf("expected invalid rate of change to be ignored, got: %+v", hs.roc)
+	}
+}
+
+func TestHeatsink_predict(t *testing.T) {
+	t.Parallel()
+
+	hs := &Heatsink{}
+	OptRateOfChange(5, 0)(nil, hs)
+	start := time.Unix(0, 0)
+
+	steps := []struct {
+		temp     float64
+		at       time.Duration
+		expected float64
+	}{
+		{temp: 40, at: 0, expected: 40},                       // no previous temperature
+		{temp: 44, at: 2 * time.Second, expected: 54},         // rising by 2 per second
+		{temp: 44, at: 3 * time.Second, expected: 44},         // steady
+		{temp: 41, at: 4 * time.Second, expected: 41},         // falls are not projected
+		{temp: 41.5, at: 4 * time.Second, expected: 41.5},     // no time elapsed
+		{temp: 42, at: 4500 * time.Millisecond, expected: 47}, // rising by 1 per second
+	}
+	for i, step := range steps {
+		actual := hs.predict(step.temp, start.Add(step.at), &reason{})
+		if actual != step.expected {
+			t.Errorf("step %d: unexpected temperature\nwant: %.2f\n got: %.2f", i, step.expected, actual)
+		}
+	}
+}
+
+func TestHeatsink_relax(t *testing.T) {
+	t.Parallel()
+
+	hs := &Heatsink{}
+	OptRateOfChange(0, 0.1)(nil, hs)
+	start := time.Unix(0, 0)
+
+	steps := []struct {
+		dcRatio  float64
+		at       time.Duration
+		expected float64
+	}{
+		{dcRatio: 1, at: 0, expected: 1},                   // no previous duty cycle
+		{dcRatio: 0, at: 2 * time.Second, expected: 0.8},   // relaxed by 0.1 per second
+		{dcRatio: 0, at: 3 * time.Second, expected: 0.7},   // relaxed from the limited duty cycle
+		{dcRatio: 0.9, at: 4 * time.Second, expected: 0.9}, // increases are not limited
+		{dcRatio: 0.85, at: 5 * time.Second, expected: 0.85},
+	}
+	for i, step := range steps {
+		actual := hs.relax(step.dcRatio, start.Add(step.at), &reason{})
+		if diff := actual - step.expected; diff > 1e-9 || diff < -1e-9 {
+			t.Errorf("step %d: unexpected duty cycle\nwant: %.2f\n got: %.2f", i, step.expected, actual)
+		}
+	}
+}
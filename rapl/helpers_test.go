@@ -0,0 +1,63 @@
+package rapl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDomain creates a directory that looks like a RAPL domain in sysfs. If name or maxRange
+// are empty, the respective file is not created
+func fakeDomain(t *testing.T, name, maxRange string) (dir string, cleanup func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "intel-rapl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+
+	setEnergy(t, dir, 0)
+	files := map[string]string{"name": name, "max_energy_range_uj": maxRange}
+	for filename, content := range files {
+		if content == "" {
+			continue
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, filename), []byte(content+"\n"), 0600); err != nil {
+			cleanup()
+			t.Fatal(err)
+		}
+	}
+	return dir, cleanup
+}
+
+func setEnergy(t *testing.T, dir string, energyUJ uint64) {
+	t.Helper()
+	content := strconv.FormatUint(energyUJ, 10) + "\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "energy_uj"), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fakeClock returns a function that can be used as Meter.now and a function that advances it
+func fakeClock() (now func() time.Time, advance func(time.Duration)) {
+	var (
+		mutex   sync.Mutex
+		current = time.Unix(0, 0)
+	)
+	now = func() time.Time {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return current
+	}
+	advance = func(d time.Duration) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		current = current.Add(d)
+	}
+	return now, advance
+}
@@ -0,0 +1,70 @@
+package rapl
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/malkhamis/heatsink"
+)
+
+type rdOnlyFile interface {
+	io.ReadSeeker
+	io.Closer
+}
+
+// energy returns the current value of the cumulative energy counter in microjoules
+func (m *Meter) energy() (uint64, error) {
+
+	if _, err := m.devFile.Seek(0, 0); err != nil {
+		return 0, err
+	}
+
+	var energyUJ uint64
+	if _, err := fmt.Fscanf(m.devFile, "%d", &energyUJ); err != nil {
+		return 0, err
+	}
+	return energyUJ, nil
+}
+
+func (m *Meter) watts() (float64, error) {
+
+	if m.closed {
+		return 0, heatsink.ErrAuxInputClosed
+	}
+
+	energyUJ, err := m.energy()
+	if err != nil {
+		return 0, err
+	}
+	now := m.now()
+	elapsed := now.Sub(m.prevTime)
+	if elapsed <= 0 {
+		return 0, ErrNoElapsedTime
+	}
+
+	deltaUJ := energyUJ - m.prevUJ
+	if energyUJ < m.prevUJ {
+		// the counter wrapped around, which is only recoverable if its range is known
+		if m.maxRangeUJ == 0 {
+			m.prevUJ, m.prevTime = energyUJ, now
+			return 0, ErrCounterWrapped
+		}
+		deltaUJ = m.maxRangeUJ - m.prevUJ + energyUJ
+	}
+	m.prevUJ, m.prevTime = energyUJ, now
+
+	return float64(deltaUJ) / 1e6 / elapsed.Seconds(), nil
+}
+
+func (m *Meter) close() error {
+	if m.closed {
+		return heatsink.ErrAuxInputClosed
+	}
+	m.closed = true
+
+	if err := m.devFile.Close(); err != nil {
+		return fmt.Errorf("failed to close device file while closing meter: %w", err)
+	}
+
+	return nil
+}
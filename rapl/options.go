@@ -0,0 +1,15 @@
+package rapl
+
+// Option is used to pass optional parameters to the Meter factory function
+type Option func(*Meter)
+
+// OptName sets the name of the meter. if name is empty, it is set to the default value
+//
+// (default: the content of the domain's 'name' file, e.g. "package-0", or its directory)
+func OptName(name string) Option {
+	return func(m *Meter) {
+		if name != "" {
+			m.name = name
+		}
+	}
+}
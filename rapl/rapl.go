@@ -0,0 +1,109 @@
+// Package rapl provides implementations of the heatsink.AuxInput and heatsink.ThermoSensor
+// interfaces that report the power draw of an Intel RAPL (Running Average Power Limit) domain,
+// e.g. a CPU package, as exposed by the powercap framework under
+// '/sys/class/powercap/intel-rapl:[x]'
+package rapl
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/malkhamis/heatsink"
+)
+
+// compile-time check for interface implementation and dependency inversion
+var _ heatsink.AuxInput = (*Meter)(nil)
+
+// Sentinel errors that are wrapped and returned by this package
+var (
+	ErrNoElapsedTime  = errors.New("no time elapsed since the previous reading")
+	ErrCounterWrapped = errors.New("energy counter wrapped around and its range is unknown")
+)
+
+// Meter reports the average power draw, in watts, of a RAPL domain between consecutive
+// readings. It is derived from the domain's cumulative energy counter, which is read from the
+// file 'energy_uj' in the domain's directory. Instances of this type are safe for concurrent use
+type Meter struct {
+	name       string
+	devFile    rdOnlyFile `deep:"-"`
+	maxRangeUJ uint64
+	now        func() time.Time
+	prevUJ     uint64
+	prevTime   time.Time
+	mutex      sync.Mutex
+	closed     bool
+}
+
+// New returns a new power meter for the RAPL domain in the given directory, which looks like
+// '/sys/class/powercap/intel-rapl:[x]'. The domain's energy counter is read once by New, so
+// the first call to Value() reports the average power since the meter was created. The energy
+// counter file will remain open until Close() is called. For details about options and
+// defaults, see the documentation for type 'Option'
+func New(domainDir string, options ...Option) (*Meter, error) {
+
+	devFile, err := os.OpenFile(filepath.Join(domainDir, "energy_uj"), os.O_RDONLY, os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	meter := &Meter{
+		name:    domainDir,
+		devFile: devFile,
+		now:     time.Now,
+	}
+	// both files are optional, in which case the defaults are kept
+	if name, err := readString(filepath.Join(domainDir, "name")); err == nil && name != "" {
+		meter.name = name
+	}
+	if maxRange, err := readString(filepath.Join(domainDir, "max_energy_range_uj")); err == nil {
+		meter.maxRangeUJ, _ = strconv.ParseUint(maxRange, 10, 64)
+	}
+	for _, applyOption := range options {
+		if applyOption == nil {
+			continue
+		}
+		applyOption(meter)
+	}
+
+	if meter.prevUJ, err = meter.energy(); err != nil {
+		devFile.Close()
+		return nil, err
+	}
+	meter.prevTime = meter.now()
+
+	return meter, nil
+}
+
+// Value returns the average power draw in watts since the previous call, or since the meter
+// was created for the first call. If the meter is closed, it returns
+// heatsink.ErrAuxInputClosed. Concurrent calls to this method by multiple go routines will be
+// serialized
+func (m *Meter) Value() (float64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.watts()
+}
+
+// Close closes this meter and releases held resources. If the meter was previously closed, it
+// returns heatsink.ErrAuxInputClosed
+func (m *Meter) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.close()
+}
+
+// Name returns the name of this meter
+func (m *Meter) Name() string {
+	return m.name
+}
+
+func readString(filename string) (string, error) {
+	data, err := ioutil.ReadFile(filename)
+	return strings.TrimSpace(string(data)), err
+}
@@ -0,0 +1,136 @@
+package rapl
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/malkhamis/heatsink"
+)
+
+func TestNew_name(t *testing.T) {
+
+	testCases := []struct {
+		name       string
+		domainName string
+		options    []Option
+		expected   string
+	}{
+		{"from-file", "package-0", nil, "package-0"},
+		{"from-option", "package-0", []Option{OptName("cpu"), nil}, "cpu"},
+		{"empty-option", "package-0", []Option{OptName("")}, "package-0"},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			dir, cleanup := fakeDomain(t, tc.domainName, "")
+			defer cleanup()
+
+			meter, err := New(dir, tc.options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer meter.Close()
+
+			if actual := meter.Name(); actual != tc.expected {
+				t.Fatalf("unexpected name\nwant: %s\n got: %s", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestNew_defaultName(t *testing.T) {
+
+	dir, cleanup := fakeDomain(t, "", "")
+	defer cleanup()
+
+	meter, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer meter.Close()
+
+	if actual := meter.Name(); actual != dir {
+		t.Fatalf("unexpected name\nwant: %s\n got: %s", dir, actual)
+	}
+}
+
+func TestNew_noDomain(t *testing.T) {
+	if _, err := New("/this/domain/does/not/exist"); err == nil {
+		t.Fatal("expected an error given a missing domain")
+	}
+}
+
+func TestMeter_Value(t *testing.T) {
+
+	dir, cleanup := fakeDomain(t, "package-0", "1000000000")
+	defer cleanup()
+
+	now, advance := fakeClock()
+	meter, err := New(dir, func(m *Meter) { m.now = now })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer meter.Close()
+
+	steps := []struct {
+		energyUJ uint64
+		elapsed  time.Duration
+		expected float64
+	}{
+		{energyUJ: 45000000, elapsed: time.Second, expected: 45},
+		{energyUJ: 65000000, elapsed: 2 * time.Second, expected: 10},
+		// wraps around at 1000 joules
+		{energyUJ: 5000000, elapsed: time.Second, expected: 940},
+	}
+
+	for i, step := range steps {
+		setEnergy(t, dir, step.energyUJ)
+		advance(step.elapsed)
+		actual, err := meter.Value()
+		if err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if actual != step.expected {
+			t.Fatalf("step %d: unexpected power\nwant: %v\n got: %v", i, step.expected, actual)
+		}
+	}
+}
+
+func TestMeter_Value_errors(t *testing.T) {
+
+	dir, cleanup := fakeDomain(t, "", "")
+	defer cleanup()
+
+	now, advance := fakeClock()
+	meter, err := New(dir, func(m *Meter) { m.now = now })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := meter.Value(); !errors.Is(err, ErrNoElapsedTime) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", ErrNoElapsedTime, err)
+	}
+
+	setEnergy(t, dir, 10)
+	advance(time.Second)
+	if _, err := meter.Value(); err != nil {
+		t.Fatal(err)
+	}
+	setEnergy(t, dir, 5)
+	advance(time.Second)
+	if _, err := meter.Value(); !errors.Is(err, ErrCounterWrapped) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", ErrCounterWrapped, err)
+	}
+
+	if err := meter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := meter.Value(); !errors.Is(err, heatsink.ErrAuxInputClosed) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", heatsink.ErrAuxInputClosed, err)
+	}
+	if err := meter.Close(); !errors.Is(err, heatsink.ErrAuxInputClosed) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", heatsink.ErrAuxInputClosed, err)
+	}
+}
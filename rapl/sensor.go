@@ -0,0 +1,56 @@
+package rapl
+
+import (
+	"github.com/malkhamis/heatsink"
+)
+
+// compile-time check for interface implementation and dependency inversion
+var _ heatsink.ThermoSensor = (*Sensor)(nil)
+
+// Sensor reports the power draw of a RAPL domain, in watts, in place of a temperature. This
+// lets a heatsink react to power draw instead of, or in addition to, temperature, in which case
+// its minimum and maximum temperatures are in watts. Instances of this type are safe for
+// concurrent use
+type Sensor struct {
+	meter *Meter
+}
+
+// NewSensor returns a new power sensor for the RAPL domain in the given directory, which looks
+// like '/sys/class/powercap/intel-rapl:[x]'. It accepts the same options as New
+func NewSensor(domainDir string, options ...Option) (*Sensor, error) {
+	meter, err := New(domainDir, options...)
+	if err != nil {
+		return nil, err
+	}
+	return &Sensor{meter: meter}, nil
+}
+
+// Temperature returns the average power draw in watts since the previous call, or since the
+// sensor was created for the first call. If the sensor is closed, it returns
+// heatsink.ErrThermoSensorClosed
+func (s *Sensor) Temperature() (float64, error) {
+	s.meter.mutex.Lock()
+	defer s.meter.mutex.Unlock()
+
+	if s.meter.closed {
+		return 0, heatsink.ErrThermoSensorClosed
+	}
+	return s.meter.watts()
+}
+
+// Close closes this sensor and releases held resources. If the sensor was previously closed,
+// it returns heatsink.ErrThermoSensorClosed
+func (s *Sensor) Close() error {
+	s.meter.mutex.Lock()
+	defer s.meter.mutex.Unlock()
+
+	if s.meter.closed {
+		return heatsink.ErrThermoSensorClosed
+	}
+	return s.meter.close()
+}
+
+// Name returns the name of this sensor
+func (s *Sensor) Name() string {
+	return s.meter.Name()
+}
@@ -0,0 +1,52 @@
+package rapl
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/malkhamis/heatsink"
+)
+
+func TestSensor(t *testing.T) {
+
+	dir, cleanup := fakeDomain(t, "package-0", "")
+	defer cleanup()
+
+	sensor, err := NewSensor(dir, OptName("cpu-power"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now, advance := fakeClock()
+	sensor.meter.now, sensor.meter.prevTime = now, now()
+
+	if actual := sensor.Name(); actual != "cpu-power" {
+		t.Fatalf("unexpected name\nwant: %s\n got: %s", "cpu-power", actual)
+	}
+
+	setEnergy(t, dir, 30000000)
+	advance(2 * time.Second)
+	actual, err := sensor.Temperature()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := 15.0; actual != expected {
+		t.Fatalf("unexpected power\nwant: %v\n got: %v", expected, actual)
+	}
+
+	if err := sensor.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sensor.Temperature(); !errors.Is(err, heatsink.ErrThermoSensorClosed) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", heatsink.ErrThermoSensorClosed, err)
+	}
+	if err := sensor.Close(); !errors.Is(err, heatsink.ErrThermoSensorClosed) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", heatsink.ErrThermoSensorClosed, err)
+	}
+}
+
+func TestNewSensor_noDomain(t *testing.T) {
+	if _, err := NewSensor("/this/domain/does/not/exist"); err == nil {
+		t.Fatal("expected an error given a missing domain")
+	}
+}
@@ -0,0 +1,85 @@
+package heatsink
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Schedule adjusts the fan during a daily time window, e.g. to keep it quiet at night
+type Schedule struct {
+	// Name identifies this schedule in logs
+	Name string
+	// Start and End are the offsets of the window from midnight in local time. If End is
+	// before Start, the window spans midnight, e.g. 22h to 7h
+	Start time.Duration
+	End   time.Duration
+	// MaxDutyCycle caps the duty cycle during the window. A negative value means no cap
+	MaxDutyCycle float64
+	// UnlessAbove lifts the cap while the hottest sensor's absolute temperature is above it.
+	// Zero means the cap is never lifted, although service levels and the critical
+	// temperature are still enforced
+	UnlessAbove float64
+	// MinTemperature and MaxTemperature replace those of the config during the window, using
+	// the same fan response. If both are zero, the fan response curve is not replaced
+	MinTemperature float64
+	MaxTemperature float64
+}
+
+// schedule is a schedule along with the fan response curve it replaces, if any
+type schedule struct {
+	Schedule
+	dcCalc dutyCycler
+}
+
+// contains reports whether the given time of day is within the window of this schedule
+func (s schedule) contains(t time.Time) bool {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	offset := t.Sub(midnight)
+	if s.Start <= s.End {
+		return offset >= s.Start && offset < s.End
+	}
+	return offset >= s.Start || offset < s.End
+}
+
+// activeSchedule returns the first schedule whose window contains the given time, or nil if
+// there is none. Entering and leaving schedules is logged
+func (hs *Heatsink) activeSchedule(now time.Time) *schedule {
+
+	var active *schedule
+	for i := range hs.schedules {
+		if hs.schedules[i].contains(now) {
+			active = &hs.schedules[i]
+			break
+		}
+	}
+	name := ""
+	if active != nil {
+		name = active.Name
+	}
+	if name != hs.activeSched {
+		hs.logger.Info(
+			"schedule changed",
+			zap.String("event", "schedule_change"),
+			zap.String("heatsink_name", hs.name),
+			zap.String("from", hs.activeSched),
+			zap.String("to", name),
+		)
+		hs.activeSched = name
+	}
+	return active
+}
+
+// applyScheduleCap lowers the given duty cycle to the cap of the given schedule, if any, unless
+// the given absolute temperature is above the schedule's safety threshold
+func (hs *Heatsink) applyScheduleCap(s *schedule, absTemp, dcRatio float64, why *reason) float64 {
+	if s == nil || s.MaxDutyCycle < 0 || dcRatio <= s.MaxDutyCycle {
+		return dcRatio
+	}
+	if s.UnlessAbove != 0 && absTemp > s.UnlessAbove {
+		why.adjust("schedule '%s' cap lifted above %.2f", s.Name, s.UnlessAbove)
+		return dcRatio
+	}
+	why.adjust("capped at %.2f by schedule '%s'", s.MaxDutyCycle, s.Name)
+	return s.MaxDutyCycle
+}
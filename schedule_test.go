@@ -0,0 +1,101 @@
+package heatsink
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestOptSchedule_ignoresInvalid(t *testing.T) {
+	t.Parallel()
+
+	hs := &Heatsink{}
+	OptSchedule(Schedule{Start: time.Hour, End: time.Hour})(nil, hs)
+	OptSchedule(Schedule{Start: -time.Hour, End: time.Hour})(nil, hs)
+	OptSchedule(Schedule{Start: time.Hour, End: 2 * time.Hour, MinTemperature: 60, MaxTemperature: 40})(nil, hs)
+	if len(hs.schedules) != 0 {
+		t.Fatalf("expected invalid schedules to be ignored, got: %+v", hs.schedules)
+	}
+}
+
+func TestHeatsink_activeSchedule(t *testing.T) {
+	t.Parallel()
+
+	hs := &Heatsink{logger: zap.NewNop()}
+	OptSchedule(Schedule{Name: "night", Start: 22 * time.Hour, End: 7 * time.Hour})(nil, hs)
+	OptSchedule(Schedule{Name: "evening", Start: 18 * time.Hour, End: 23 * time.Hour})(nil, hs)
+	day := time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local)
+
+	cases := []struct {
+		at       time.Duration
+		expected string
+	}{
+		{at: 0, expected: "night"},
+		{at: 6*time.Hour + 59*time.Minute, expected: "night"},
+		{at: 7 * time.Hour, expected: ""},
+		{at: 18 * time.Hour, expected: "evening"},
+		{at: 22 * time.Hour, expected: "night"}, // the first matching schedule wins
+		{at: 23*time.Hour + 30*time.Minute, expected: "night"},
+	}
+	for i, c := range cases {
+		actual := ""
+		if s := hs.activeSchedule(day.Add(c.at)); s != nil {
+			actual = s.Name
+		}
+		if actual != c.expected {
+			t.Errorf("case %d: unexpected schedule\nwant: '%s'\n got: '%s'", i, c.expected, actual)
+		}
+		if hs.activeSched != c.expected {
+			t.Errorf("case %d: unexpected tracked schedule\nwant: '%s'\n got: '%s'", i, c.expected, hs.activeSched)
+		}
+	}
+}
+
+func TestHeatsink_applyScheduleCap(t *testing.T) {
+	t.Parallel()
+
+	hs := &Heatsink{}
+	capped := &schedule{Schedule: Schedule{Name: "quiet", MaxDutyCycle: 0.4, UnlessAbove: 80}}
+	uncapped := &schedule{Schedule: Schedule{Name: "curve", MaxDutyCycle: -1}}
+
+	cases := []struct {
+		sched    *schedule
+		temp     float64
+		dcRatio  float64
+		expected float64
+	}{
+		{sched: nil, temp: 70, dcRatio: 0.9, expected: 0.9},
+		{sched: uncapped, temp: 70, dcRatio: 0.9, expected: 0.9},
+		{sched: capped, temp: 70, dcRatio: 0.3, expected: 0.3},
+		{sched: capped, temp: 70, dcRatio: 0.9, expected: 0.4},
+		{sched: capped, temp: 80, dcRatio: 0.9, expected: 0.4},
+		{sched: capped, temp: 81, dcRatio: 0.9, expected: 0.9}, // above the safety threshold
+	}
+	for i, c := range cases {
+		actual := hs.applyScheduleCap(c.sched, c.temp, c.dcRatio, &reason{})
+		if actual != c.expected {
+			t.Errorf("case %d: unexpected duty cycle\nwant: %.2f\n got: %.2f", i, c.expected, actual)
+		}
+	}
+}
+
+func TestNew_scheduleCurve(t *testing.T) {
+	t.Parallel()
+
+	hs, err := New(
+		&Config{Fan: &fakeFanDriver{}, Sensors: []ThermoSensor{&fakeThermoSensor{}}, MinTemperature: 40, MaxTemperature: 60},
+		OptFanResponse(FanResponseLinear),
+		OptSchedule(Schedule{Name: "night", Start: time.Hour, End: 2 * time.Hour, MinTemperature: 50, MaxTemperature: 70}),
+		OptSchedule(Schedule{Name: "cap", Start: 3 * time.Hour, End: 4 * time.Hour, MaxDutyCycle: 0.5}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hs.schedules[1].dcCalc != nil {
+		t.Errorf("expected no curve for a schedule without a temperature range")
+	}
+	if actual := hs.schedules[0].dcCalc.ratio(60); actual != 0.5 {
+		t.Errorf("unexpected duty cycle\nwant: %.2f\n got: %.2f", 0.5, actual)
+	}
+}
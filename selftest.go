@@ -0,0 +1,80 @@
+package heatsink
+
+import (
+	"errors"
+)
+
+// SelfTester is implemented by devices that can verify that they work, e.g. a fan driver that
+// writes to and restores its device to check for write permission. Wrappers of devices should
+// pass the call on or return ErrNoSelfTest if the wrapped device is not a SelfTester
+type SelfTester interface {
+	// SelfTest returns an error if the device does not work
+	SelfTest() error
+}
+
+// Kinds of devices that are checked by a self-test
+const (
+	DeviceSensor        = "sensor"
+	DeviceAmbientSensor = "ambient_sensor"
+	DeviceInputSensor   = "input_sensor"
+	DeviceFan           = "fan"
+)
+
+// DeviceCheck is the outcome of checking a single device of a heatsink during a self-test
+type DeviceCheck struct {
+	// Device is the name of the sensor or fan
+	Device string
+	// Kind is one of DeviceSensor, DeviceAmbientSensor, DeviceInputSensor, and DeviceFan
+	Kind string
+	// Temperature is the reading of a sensor that passed
+	Temperature float64
+	// Skipped reports whether the device could not be checked, e.g. a fan whose driver is not
+	// a SelfTester. Skipped devices pass
+	Skipped bool
+	// Err is why the device failed, or nil if it passed
+	Err error
+}
+
+// Passed reports whether the device passed the check or was skipped
+func (c DeviceCheck) Passed() bool {
+	return c.Err == nil
+}
+
+// SelfTest reads every sensor of the heatsink once, including the ambient sensor and those of
+// inputs, and self-tests the fan if its driver is a SelfTester. It returns the outcome of each
+// check in that order. It is meant to be called before thermal control starts, since a fan's
+// self-test may briefly change its speed
+func (hs *Heatsink) SelfTest() []DeviceCheck {
+
+	var checks []DeviceCheck
+	readAll := func(kind string, sensors []ThermoSensor) {
+		for i, r := range hs.readSensors(sensors) {
+			checks = append(checks, DeviceCheck{
+				Device:      sensors[i].Name(),
+				Kind:        kind,
+				Temperature: r.temp,
+				Err:         r.err,
+			})
+		}
+	}
+	hs.sensorMutex.Lock()
+	sensors := append([]ThermoSensor{}, hs.sensors...)
+	hs.sensorMutex.Unlock()
+	readAll(DeviceSensor, sensors)
+	if hs.ambient != nil {
+		readAll(DeviceAmbientSensor, []ThermoSensor{hs.ambient})
+	}
+	for _, in := range hs.inputs {
+		readAll(DeviceInputSensor, in.sensors)
+	}
+
+	fan := DeviceCheck{Device: hs.fan.Name(), Kind: DeviceFan, Skipped: true}
+	if tester, ok := hs.fan.(SelfTester); ok {
+		fan.Err = tester.SelfTest()
+		fan.Skipped = errors.Is(fan.Err, ErrNoSelfTest)
+		if fan.Skipped {
+			fan.Err = nil
+		}
+	}
+	return append(checks, fan)
+}
@@ -0,0 +1,81 @@
+package heatsink
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+// selfTestingFan is a fake fan driver that implements SelfTester
+type selfTestingFan struct {
+	fakeFanDriver
+	err error
+}
+
+func (f *selfTestingFan) SelfTest() error {
+	return f.err
+}
+
+func TestHeatsink_SelfTest(t *testing.T) {
+	t.Parallel()
+
+	simErr := errors.New("simulated error")
+	hs, err := New(
+		&Config{
+			Fan: &selfTestingFan{fakeFanDriver: fakeFanDriver{onName: "fan"}, err: simErr},
+			Sensors: []ThermoSensor{
+				&fakeThermoSensor{onName: "core0", onTemperatureVals: []float64{42}},
+				&fakeThermoSensor{onName: "core1", onTemperatureErrs: []error{simErr}},
+			},
+			MaxTemperature: 100,
+		},
+		OptAmbientSensor(&fakeThermoSensor{onName: "intake", onTemperatureVals: []float64{25}}),
+		OptInput(Input{
+			Name:           "gpu",
+			Sensors:        []ThermoSensor{&fakeThermoSensor{onName: "gpu", onTemperatureVals: []float64{55}}},
+			MaxTemperature: 90,
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []DeviceCheck{
+		{Device: "core0", Kind: DeviceSensor, Temperature: 42},
+		{Device: "core1", Kind: DeviceSensor, Err: simErr},
+		{Device: "intake", Kind: DeviceAmbientSensor, Temperature: 25},
+		{Device: "gpu", Kind: DeviceInputSensor, Temperature: 55},
+		{Device: "fan", Kind: DeviceFan, Err: simErr},
+	}
+	actual := hs.SelfTest()
+	if diff := deep.Equal(actual, expected); diff != nil {
+		t.Fatal(diff)
+	}
+	for i, passed := range []bool{true, false, true, true, false} {
+		if actual[i].Passed() != passed {
+			t.Errorf("check %d: expected passed to be %v", i, passed)
+		}
+	}
+}
+
+func TestHeatsink_SelfTest_skipsFan(t *testing.T) {
+	t.Parallel()
+
+	sensors := []ThermoSensor{&fakeThermoSensor{onName: "core0", onTemperatureVals: []float64{42}}}
+	testCases := []FanDriver{
+		&fakeFanDriver{onName: "fan"},
+		&selfTestingFan{fakeFanDriver: fakeFanDriver{onName: "fan"}, err: ErrNoSelfTest},
+	}
+	for i, fan := range testCases {
+		hs, err := New(&Config{Fan: fan, Sensors: sensors, MaxTemperature: 100})
+		if err != nil {
+			t.Fatal(err)
+		}
+		checks := hs.SelfTest()
+		expected := DeviceCheck{Device: "fan", Kind: DeviceFan, Skipped: true}
+		if diff := deep.Equal(checks[len(checks)-1], expected); diff != nil {
+			t.Errorf("case %d: %v", i, diff)
+		}
+	}
+}
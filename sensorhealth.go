@@ -0,0 +1,216 @@
+package heatsink
+
+import (
+	"fmt"
+	"math"
+
+	"go.uber.org/zap"
+)
+
+// SensorQuarantine configures how misbehaving sensors are detected and excluded from the
+// hottest temperature. Every read of a sensor is graded as bad if it fails, if the reading
+// jumped by more than MaxJump since the previous one, or if it is the same as the previous
+// StuckReads-1 readings. A sensor's health score is the fraction of good reads among its last
+// Window reads, and the sensor is quarantined once its score drops below MinScore. A
+// quarantined sensor is still read, but its readings are left out until it reads well Readmit
+// times in a row. Zero values of Window, MinScore, and Readmit select their defaults
+type SensorQuarantine struct {
+	// MaxJump is the largest plausible change between consecutive readings, e.g. 50. If it is
+	// zero, jumps are not checked
+	MaxJump float64
+	// StuckReads is the number of identical consecutive readings at which a sensor is
+	// considered stuck. If it is zero, constant readings are not checked
+	StuckReads int
+	// Window is the number of most recent reads the health score is computed over (default: 10)
+	Window int
+	// MinScore is the health score in (0,1] below which a sensor is quarantined (default: 0.5)
+	MinScore float64
+	// Readmit is the number of consecutive good reads after which a quarantined sensor is
+	// admitted again (default: 5)
+	Readmit int
+}
+
+// quarantine tracks the health of every sensor of a heatsink, in the order of the sensors
+type quarantine struct {
+	SensorQuarantine
+	health   []sensorHealth
+	fallback bool
+}
+
+// sensorHealth is the recent history of a single sensor's reads
+type sensorHealth struct {
+	bad         []bool // ring buffer of the last reads, true if the read was bad
+	next        int
+	numBad      int
+	prev        float64
+	hasPrev     bool
+	same        int
+	good        int
+	quarantined bool
+}
+
+// score returns the fraction of good reads among the last reads. Reads that did not happen
+// yet count as good, so that a sensor is not quarantined by its very first failure
+func (h *sensorHealth) score() float64 {
+	return 1 - float64(h.numBad)/float64(len(h.bad))
+}
+
+// grade records the given read and returns why it is bad, or an empty string if it is good.
+// Stale readings that stand in for failed reads are not graded
+func (q *quarantine) grade(h *sensorHealth, r sensorReading) (problem string) {
+
+	if r.stale {
+		return ""
+	}
+
+	if r.err != nil {
+		problem = "failed to read"
+	} else {
+		if h.hasPrev && r.temp == h.prev {
+			h.same++
+		} else {
+			h.same = 1
+		}
+		switch {
+		case h.hasPrev && q.MaxJump > 0 && math.Abs(r.temp-h.prev) > q.MaxJump:
+			problem = fmt.Sprintf("jumped from %.2f to %.2f", h.prev, r.temp)
+		case q.StuckReads > 0 && h.same >= q.StuckReads:
+			problem = fmt.Sprintf("stuck at %.2f for %d reads", r.temp, h.same)
+		}
+		h.prev, h.hasPrev = r.temp, true
+	}
+
+	isBad := problem != ""
+	if h.bad[h.next] {
+		h.numBad--
+	}
+	if isBad {
+		h.numBad++
+		h.good = 0
+	} else {
+		h.good++
+	}
+	h.bad[h.next] = isBad
+	h.next = (h.next + 1) % len(h.bad)
+	return problem
+}
+
+// screen grades the given readings of the heatsink's sensors, quarantines and readmits sensors
+// accordingly, and marks the readings of quarantined sensors. If no sensor outside quarantine
+// reads successfully, the readings of quarantined sensors are used rather than none at all
+func (hs *Heatsink) screen(results []sensorReading) []sensorReading {
+
+	q := hs.quarantine
+	if q == nil {
+		return results
+	}
+
+	healthy := false
+	for i := range results {
+		h := &q.health[i]
+		problem := q.grade(h, results[i])
+		switch {
+		case !h.quarantined && problem != "" && h.score() < q.MinScore:
+			h.quarantined = true
+			hs.logger.Warn(
+				"quarantined misbehaving sensor",
+				zap.String("event", "sensor_quarantined"),
+				zap.String("heatsink_name", hs.name),
+				zap.String("sensor_name", hs.sensors[i].Name()),
+				zap.String("problem", problem),
+				zap.Float64("health_score", h.score()),
+			)
+		case h.quarantined && h.good >= q.Readmit:
+			h.quarantined = false
+			for j := range h.bad {
+				h.bad[j] = false
+			}
+			h.numBad = 0
+			hs.logger.Info(
+				"readmitted sensor after consecutive good reads",
+				zap.String("event", "sensor_readmitted"),
+				zap.String("heatsink_name", hs.name),
+				zap.String("sensor_name", hs.sensors[i].Name()),
+				zap.Int("good_reads", h.good),
+			)
+		}
+		results[i].quarantined = h.quarantined
+		if !h.quarantined && results[i].err == nil {
+			healthy = true
+		}
+	}
+
+	if healthy != !q.fallback {
+		q.fallback = !healthy
+		if q.fallback {
+			hs.logger.Warn(
+				"no sensor outside quarantine reads, using quarantined sensors",
+				zap.String("heatsink_name", hs.name),
+			)
+		} else {
+			hs.logger.Info("sensors outside quarantine read again", zap.String("heatsink_name", hs.name))
+		}
+	}
+	if q.fallback {
+		for i := range results {
+			results[i].quarantined = false
+		}
+	}
+	return results
+}
+
+// quarantined returns the names of the sensors that are currently quarantined, if any
+func (hs *Heatsink) quarantined() []string {
+	if hs.quarantine == nil {
+		return nil
+	}
+	hs.sensorMutex.Lock()
+	defer hs.sensorMutex.Unlock()
+	var names []string
+	for i, h := range hs.quarantine.health {
+		if h.quarantined {
+			names = append(names, hs.sensors[i].Name())
+		}
+	}
+	return names
+}
+
+// lastGood stands in the last successful reading of a sensor for its failed reads, in the order
+// of the sensors, until maxStale reads in a row failed
+type lastGood struct {
+	maxStale int
+	temps    []float64
+	ok       []bool
+	misses   []int
+}
+
+// reuseLastGood replaces the failed ones of the given readings of the heatsink's sensors with
+// the last successful reading of the respective sensor, unless the sensor failed more than
+// the allowed number of reads in a row or never read successfully
+func (hs *Heatsink) reuseLastGood(results []sensorReading) []sensorReading {
+
+	lg := hs.lastGood
+	if lg == nil {
+		return results
+	}
+	for i, r := range results {
+		if r.err == nil {
+			lg.temps[i], lg.ok[i], lg.misses[i] = r.temp, true, 0
+			continue
+		}
+		lg.misses[i]++
+		if !lg.ok[i] || lg.misses[i] > lg.maxStale {
+			continue
+		}
+		hs.logger.Debug(
+			"reusing last reading of failed sensor",
+			zap.Error(r.err),
+			zap.String("heatsink_name", hs.name),
+			zap.String("sensor_name", hs.sensors[i].Name()),
+			zap.Float64("temperature", lg.temps[i]),
+			zap.Int("consecutive_failures", lg.misses[i]),
+		)
+		results[i] = sensorReading{temp: lg.temps[i], stale: true}
+	}
+	return results
+}
@@ -0,0 +1,212 @@
+package heatsink
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestOptSensorQuarantine(t *testing.T) {
+	t.Parallel()
+
+	hs := &Heatsink{sensors: []ThermoSensor{&fakeThermoSensor{}, &fakeThermoSensor{}}}
+	invalid := []SensorQuarantine{
+		{MaxJump: -1},
+		{StuckReads: -1},
+		{Window: -1},
+		{MinScore: 1.5},
+		{Readmit: -1},
+	}
+	for _, q := range invalid {
+		OptSensorQuarantine(q)(nil, hs)
+		if hs.quarantine != nil {
+			t.Fatalf("expected %+v to be ignored, got: %+v", q, hs.quarantine)
+		}
+	}
+
+	OptSensorQuarantine(SensorQuarantine{MaxJump: 50})(nil, hs)
+	expected := SensorQuarantine{MaxJump: 50, Window: 10, MinScore: 0.5, Readmit: 5}
+	if diff := deep.Equal(hs.quarantine.SensorQuarantine, expected); diff != nil {
+		t.Fatal(diff)
+	}
+	if len(hs.quarantine.health) != 2 || len(hs.quarantine.health[1].bad) != 10 {
+		t.Fatalf("expected the health of every sensor over the window, got: %+v", hs.quarantine.health)
+	}
+}
+
+func TestHeatsink_maxCoreTemp_quarantinesJumps(t *testing.T) {
+	t.Parallel()
+
+	steady := &fakeThermoSensor{onName: "steady", onTemperatureVals: []float64{50, 51, 52, 53, 54, 55, 56}}
+	spiky := &fakeThermoSensor{onName: "spiky", onTemperatureVals: []float64{40, 95, 40, 95, 40, 41, 42}}
+	hs, err := New(
+		&Config{Fan: &fakeFanDriver{}, Sensors: []ThermoSensor{steady, spiky}, MaxTemperature: 100},
+		OptSensorQuarantine(SensorQuarantine{MaxJump: 20, Window: 4, Readmit: 2}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		max         float64
+		numReadings int
+		quarantined []string
+	}{
+		{max: 50, numReadings: 2},
+		{max: 95, numReadings: 2}, // a single jump is tolerated
+		{max: 52, numReadings: 2},
+		{max: 53, numReadings: 1, quarantined: []string{"spiky"}},
+		{max: 54, numReadings: 1, quarantined: []string{"spiky"}},
+		{max: 55, numReadings: 1, quarantined: []string{"spiky"}}, // first good read
+		{max: 56, numReadings: 2},                                 // readmitted
+	}
+	for i, step := range steps {
+		max, _, readings, err := hs.maxCoreTemp()
+		if err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if max != step.max || len(readings) != step.numReadings {
+			t.Errorf("step %d: unexpected max %.1f with readings %v", i, max, readings)
+		}
+		if diff := deep.Equal(hs.quarantined(), step.quarantined); diff != nil {
+			t.Errorf("step %d: %v", i, diff)
+		}
+	}
+}
+
+func TestHeatsink_maxCoreTemp_quarantinesStuckSensors(t *testing.T) {
+	t.Parallel()
+
+	steady := &fakeThermoSensor{onName: "steady", onTemperatureVals: []float64{40, 41, 42, 43, 44}}
+	stuck := &fakeThermoSensor{onName: "stuck", onTemperatureVals: []float64{60, 60, 60, 60, 61}}
+	hs, err := New(
+		&Config{Fan: &fakeFanDriver{}, Sensors: []ThermoSensor{steady, stuck}, MaxTemperature: 100},
+		OptSensorQuarantine(SensorQuarantine{StuckReads: 3, Window: 2, MinScore: 1, Readmit: 1}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, expected := range []float64{60, 60, 42, 43, 61} {
+		max, _, _, err := hs.maxCoreTemp()
+		if err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if max != expected {
+			t.Errorf("step %d: unexpected max core temperature\nwant: %.1f\n got: %.1f", i, expected, max)
+		}
+	}
+}
+
+func TestHeatsink_maxCoreTemp_quarantineFallback(t *testing.T) {
+	t.Parallel()
+
+	simErr := errors.New("simulated error")
+	failing := &fakeThermoSensor{onName: "failing", onTemperatureErrs: []error{simErr, simErr, nil, simErr, simErr, simErr}}
+	stuck := &fakeThermoSensor{onName: "stuck", onTemperatureVals: []float64{60, 60, 60, 60, 60}}
+	hs, err := New(
+		&Config{Fan: &fakeFanDriver{}, Sensors: []ThermoSensor{failing, stuck}, MaxTemperature: 100},
+		OptSensorQuarantine(SensorQuarantine{StuckReads: 2, Window: 1, MinScore: 1}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// once both are quarantined, the stuck sensor is used rather than failing altogether
+	for i := 0; i < 5; i++ {
+		max, hottest, _, err := hs.maxCoreTemp()
+		if err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if max != 60 || hottest != "stuck" {
+			t.Errorf("step %d: unexpected hottest sensor '%s' at %.1f", i, hottest, max)
+		}
+	}
+	if diff := deep.Equal(hs.quarantined(), []string{"failing", "stuck"}); diff != nil {
+		t.Fatal(diff)
+	}
+
+	stuck.onTemperatureErrs = []error{simErr}
+	if _, _, _, err := hs.maxCoreTemp(); !errors.Is(err, simErr) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", simErr, err)
+	}
+}
+
+func TestOptLastKnownGood_ignoresInvalid(t *testing.T) {
+	t.Parallel()
+
+	hs := &Heatsink{}
+	OptLastKnownGood(0)(nil, hs)
+	OptLastKnownGood(-1)(nil, hs)
+	if hs.lastGood != nil {
+		t.Fatalf("expected invalid staleness limits to be ignored, got: %+v", hs.lastGood)
+	}
+}
+
+func TestHeatsink_maxCoreTemp_lastKnownGood(t *testing.T) {
+	t.Parallel()
+
+	simErr := errors.New("simulated error")
+	flaky := &fakeThermoSensor{
+		onName:            "flaky",
+		onTemperatureVals: []float64{0, 50, 0, 0, 0, 52},
+		onTemperatureErrs: []error{simErr, nil, simErr, simErr, simErr, nil},
+	}
+	steady := &fakeThermoSensor{onName: "steady", onTemperatureVals: []float64{40, 40, 40, 40, 40, 40}}
+	hs, err := New(
+		&Config{Fan: &fakeFanDriver{}, Sensors: []ThermoSensor{flaky, steady}, MaxTemperature: 100},
+		OptLastKnownGood(2),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		max         float64
+		numReadings int
+	}{
+		{max: 40, numReadings: 1}, // no reading to reuse yet
+		{max: 50, numReadings: 2},
+		{max: 50, numReadings: 2}, // reused
+		{max: 50, numReadings: 2}, // reused
+		{max: 40, numReadings: 1}, // too stale
+		{max: 52, numReadings: 2},
+	}
+	for i, step := range steps {
+		max, _, readings, err := hs.maxCoreTemp()
+		if err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if max != step.max || len(readings) != step.numReadings {
+			t.Errorf("step %d: unexpected max %.1f with readings %v", i, max, readings)
+		}
+	}
+}
+
+func TestHeatsink_maxCoreTemp_lastKnownGoodIsNotQuarantined(t *testing.T) {
+	t.Parallel()
+
+	simErr := errors.New("simulated error")
+	flaky := &fakeThermoSensor{
+		onName:            "flaky",
+		onTemperatureVals: []float64{50, 0, 51, 0},
+		onTemperatureErrs: []error{nil, simErr, nil, simErr},
+	}
+	hs, err := New(
+		&Config{Fan: &fakeFanDriver{}, Sensors: []ThermoSensor{flaky}, MaxTemperature: 100},
+		OptLastKnownGood(1),
+		OptSensorQuarantine(SensorQuarantine{StuckReads: 2, Window: 1, MinScore: 1}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		if _, _, _, err := hs.maxCoreTemp(); err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+	}
+	if names := hs.quarantined(); names != nil {
+		t.Fatalf("expected reused readings to be neither failed nor stuck, got: %v", names)
+	}
+}
@@ -0,0 +1,79 @@
+package smc
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// value is the raw content of an SMC key along with its data type, e.g. 'sp78' or 'flt'
+type value struct {
+	dataType string
+	data     []byte
+}
+
+// readOutputPattern matches the output of 'smc -k <key> -r', which looks like
+// '  TC0P  [sp78]  45.50 (bytes 2d 80)'
+var readOutputPattern = regexp.MustCompile(`\[([^\]]+)\].*\(bytes ([0-9a-fA-F ]*)\)`)
+
+// parseReadOutput extracts the data type and the raw bytes of a key from the output of the
+// smc tool
+func parseReadOutput(output string) (value, error) {
+	if strings.Contains(output, "no data") {
+		return value{}, ErrKeyNotFound
+	}
+	match := readOutputPattern.FindStringSubmatch(output)
+	if match == nil {
+		return value{}, fmt.Errorf("%w: '%s'", ErrBadOutput, strings.TrimSpace(output))
+	}
+	data, err := hex.DecodeString(strings.Join(strings.Fields(match[2]), ""))
+	if err != nil {
+		return value{}, fmt.Errorf("%w: %v", ErrBadOutput, err)
+	}
+	return value{dataType: strings.TrimSpace(match[1]), data: data}, nil
+}
+
+// float decodes the value as a number
+func (v value) float() (float64, error) {
+	switch {
+	case v.dataType == "sp78" && len(v.data) == 2:
+		return float64(int16(binary.BigEndian.Uint16(v.data))) / 256, nil
+	case v.dataType == "fpe2" && len(v.data) == 2:
+		return float64(binary.BigEndian.Uint16(v.data)) / 4, nil
+	case v.dataType == "flt" && len(v.data) == 4:
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(v.data))), nil
+	case v.dataType == "ui8" && len(v.data) == 1:
+		return float64(v.data[0]), nil
+	case v.dataType == "ui16" && len(v.data) == 2:
+		return float64(binary.BigEndian.Uint16(v.data)), nil
+	}
+	return 0, fmt.Errorf("%w: '%s' of %d bytes", ErrUnsupportedType, v.dataType, len(v.data))
+}
+
+// encode returns the given number in the value's data type as a hex string, which is how the
+// smc tool expects values to be written
+func (v value) encode(f float64) (string, error) {
+	var data []byte
+	switch v.dataType {
+	case "sp78":
+		data = make([]byte, 2)
+		binary.BigEndian.PutUint16(data, uint16(int16(math.Round(f*256))))
+	case "fpe2":
+		data = make([]byte, 2)
+		binary.BigEndian.PutUint16(data, uint16(math.Round(f*4)))
+	case "flt":
+		data = make([]byte, 4)
+		binary.LittleEndian.PutUint32(data, math.Float32bits(float32(f)))
+	case "ui8":
+		data = []byte{uint8(f)}
+	case "ui16":
+		data = make([]byte, 2)
+		binary.BigEndian.PutUint16(data, uint16(f))
+	default:
+		return "", fmt.Errorf("%w: '%s'", ErrUnsupportedType, v.dataType)
+	}
+	return hex.EncodeToString(data), nil
+}
@@ -0,0 +1,86 @@
+package smc
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func Test_parseReadOutput(t *testing.T) {
+
+	cases := map[string]struct {
+		output      string
+		expected    value
+		expectedErr error
+	}{
+		"sp78":      {output: "  TC0P  [sp78]  45.50 (bytes 2d 80)\n", expected: value{"sp78", []byte{0x2d, 0x80}}},
+		"flt":       {output: "  F0Tg  [flt ]  1200 (bytes 00 00 96 44)\n", expected: value{"flt", []byte{0x00, 0x00, 0x96, 0x44}}},
+		"not found": {output: "  TX9Z  [    ]  no data\n", expectedErr: ErrKeyNotFound},
+		"garbage":   {output: "Error: SMCOpen failed", expectedErr: ErrBadOutput},
+		"bad bytes": {output: "  TC0P  [sp78]  45.50 (bytes 2d 8)\n", expectedErr: ErrBadOutput},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			actual, err := parseReadOutput(c.output)
+			if !errors.Is(err, c.expectedErr) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", c.expectedErr, err)
+			}
+			if diff := deep.Equal(actual, c.expected); diff != nil {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func Test_value_roundTrip(t *testing.T) {
+
+	cases := []struct {
+		dataType string
+		number   float64
+		encoded  string
+	}{
+		{dataType: "sp78", number: 45.5, encoded: "2d80"},
+		{dataType: "sp78", number: -1, encoded: "ff00"},
+		{dataType: "fpe2", number: 1200.25, encoded: "12c1"},
+		{dataType: "flt", number: 1200, encoded: "00009644"},
+		{dataType: "ui8", number: 1, encoded: "01"},
+		{dataType: "ui16", number: 3, encoded: "0003"},
+	}
+
+	for _, c := range cases {
+		encoded, err := value{dataType: c.dataType}.encode(c.number)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if encoded != c.encoded {
+			t.Errorf("encoding %v as %s\nwant: %s\n got: %s", c.number, c.dataType, c.encoded, encoded)
+		}
+		v, err := parseReadOutput("[" + c.dataType + "] (bytes " + encoded + ")")
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := v.float()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded != c.number {
+			t.Errorf("decoding %s as %s\nwant: %v\n got: %v", encoded, c.dataType, c.number, decoded)
+		}
+	}
+}
+
+func Test_value_unsupportedType(t *testing.T) {
+	v := value{dataType: "ch8*", data: []byte("abc")}
+	if _, err := v.float(); !errors.Is(err, ErrUnsupportedType) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", ErrUnsupportedType, err)
+	}
+	if _, err := v.encode(1); !errors.Is(err, ErrUnsupportedType) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", ErrUnsupportedType, err)
+	}
+	if _, err := (value{dataType: "sp78", data: []byte{1}}).float(); !errors.Is(err, ErrUnsupportedType) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", ErrUnsupportedType, err)
+	}
+}
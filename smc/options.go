@@ -0,0 +1,26 @@
+package smc
+
+// Option is used to pass optional parameters to the Sensor and Fan factory functions
+type Option func(*device)
+
+// OptName sets the name of the sensor or fan. if name is empty, it is set to the default value
+//
+// (default: the key for sensors and 'smc/fan<index>' for fans)
+func OptName(name string) Option {
+	return func(d *device) {
+		if name != "" {
+			d.name = name
+		}
+	}
+}
+
+// OptBinary sets the path of the smc tool. If path is empty, it is set to the default value
+//
+// (default: "smc", which is looked up in PATH)
+func OptBinary(path string) Option {
+	return func(d *device) {
+		if path != "" {
+			d.binary = path
+		}
+	}
+}
@@ -0,0 +1,18 @@
+//go:build darwin
+// +build darwin
+
+package smc
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+func run(binary string, args ...string) (string, error) {
+	output, err := exec.Command(binary, args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return string(output), nil
+}
@@ -0,0 +1,8 @@
+//go:build !darwin
+// +build !darwin
+
+package smc
+
+func run(binary string, args ...string) (string, error) {
+	return "", ErrUnsupported
+}
@@ -0,0 +1,258 @@
+// Package smc provides implementations of the heatsink.ThermoSensor and heatsink.FanDriver
+// interfaces for Macs, which read temperatures from and set fan speeds through the System
+// Management Controller (SMC). Talking to the SMC requires IOKit, so this package relies on
+// the 'smc' command line tool that ships with smcFanControl instead of binding to it with cgo.
+// Setting fan speeds requires root privileges
+package smc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/malkhamis/heatsink"
+)
+
+// compile-time check for interface implementation and dependency inversion
+var (
+	_ heatsink.ThermoSensor = (*Sensor)(nil)
+	_ heatsink.FanDriver    = (*Fan)(nil)
+)
+
+// Sentinel errors that are wrapped and returned by this package
+var (
+	ErrUnsupported     = errors.New("smc is only supported on macOS")
+	ErrKeyNotFound     = errors.New("smc key not found")
+	ErrBadOutput       = errors.New("unexpected output from the smc tool")
+	ErrUnsupportedType = errors.New("unsupported smc data type")
+	ErrBadFanRange     = errors.New("fan reports an invalid speed range")
+)
+
+// runFunc runs the smc tool at the given path with the given arguments and returns its output
+type runFunc func(binary string, args ...string) (string, error)
+
+// device holds the settings shared by sensors and fans
+type device struct {
+	name   string
+	binary string
+	run    runFunc
+}
+
+func (d *device) read(key string) (value, error) {
+	output, err := d.run(d.binary, "-k", key, "-r")
+	if err != nil {
+		return value{}, fmt.Errorf("reading key '%s': %w", key, err)
+	}
+	v, err := parseReadOutput(output)
+	if err != nil {
+		return value{}, fmt.Errorf("reading key '%s': %w", key, err)
+	}
+	return v, nil
+}
+
+func (d *device) readFloat(key string) (float64, error) {
+	v, err := d.read(key)
+	if err != nil {
+		return math.Inf(1), err
+	}
+	f, err := v.float()
+	if err != nil {
+		return math.Inf(1), fmt.Errorf("reading key '%s': %w", key, err)
+	}
+	return f, nil
+}
+
+// write encodes f in the given value's data type and writes it to the given key
+func (d *device) write(key string, v value, f float64) error {
+	encoded, err := v.encode(f)
+	if err != nil {
+		return fmt.Errorf("writing key '%s': %w", key, err)
+	}
+	if _, err := d.run(d.binary, "-k", key, "-w", encoded); err != nil {
+		return fmt.Errorf("writing key '%s': %w", key, err)
+	}
+	return nil
+}
+
+func newDevice(name string, run runFunc, options []Option) device {
+	d := device{name: name, binary: "smc", run: run}
+	for _, applyOption := range options {
+		if applyOption == nil {
+			continue
+		}
+		applyOption(&d)
+	}
+	return d
+}
+
+// Sensor represents a temperature sensor of the SMC. Instances of this type are safe for
+// concurrent use
+type Sensor struct {
+	device
+	key    string
+	mutex  sync.Mutex
+	closed bool
+}
+
+// NewSensor returns a new thermal sensor for the given SMC key, e.g. 'TC0P' for the CPU
+// proximity sensor of Intel Macs. The key is read once to verify that it exists. For details
+// about options and defaults, see the documentation for type 'Option'
+func NewSensor(key string, options ...Option) (*Sensor, error) {
+	return newSensor(key, run, options...)
+}
+
+func newSensor(key string, run runFunc, options ...Option) (*Sensor, error) {
+	sensor := &Sensor{device: newDevice(key, run, options), key: key}
+	if _, err := sensor.readFloat(key); err != nil {
+		return nil, err
+	}
+	return sensor, nil
+}
+
+// Temperature returns the current temperature in degrees celsius as well as any error
+// encountered. If the sensor is closed, it returns heatsink.ErrThermoSensorClosed
+func (s *Sensor) Temperature() (float64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return math.Inf(1), heatsink.ErrThermoSensorClosed
+	}
+	return s.readFloat(s.key)
+}
+
+// Close closes this sensor. If the sensor was previously closed, it returns
+// heatsink.ErrThermoSensorClosed
+func (s *Sensor) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return heatsink.ErrThermoSensorClosed
+	}
+	s.closed = true
+	return nil
+}
+
+// Name returns the name of this sensor
+func (s *Sensor) Name() string {
+	return s.name
+}
+
+// Fan represents a fan controlled by the SMC, whose duty cycle ratio is mapped linearly to a
+// target speed between the fan's minimum and maximum speeds. Instances of this type are safe
+// for concurrent use
+type Fan struct {
+	device
+	index    int
+	minRPM   float64
+	maxRPM   float64
+	target   value
+	isManual bool
+	mutex    sync.Mutex
+	closed   bool
+}
+
+// NewFan returns a fan driver for the fan with the given zero-based index. The fan remains
+// under automatic control until the first duty cycle is set. For details about options and
+// defaults, see the documentation for type 'Option'
+func NewFan(index int, options ...Option) (*Fan, error) {
+	return newFan(index, run, options...)
+}
+
+func newFan(index int, run runFunc, options ...Option) (*Fan, error) {
+
+	fan := &Fan{device: newDevice(fmt.Sprintf("smc/fan%d", index), run, options), index: index}
+	var err error
+	if fan.minRPM, err = fan.readFloat(fan.key("Mn")); err != nil {
+		return nil, err
+	}
+	if fan.maxRPM, err = fan.readFloat(fan.key("Mx")); err != nil {
+		return nil, err
+	}
+	if fan.maxRPM <= fan.minRPM {
+		return nil, fmt.Errorf("%w: [%v, %v]", ErrBadFanRange, fan.minRPM, fan.maxRPM)
+	}
+	if fan.target, err = fan.read(fan.key("Tg")); err != nil {
+		return nil, err
+	}
+	return fan, nil
+}
+
+// key returns the SMC key of this fan with the given suffix, e.g. 'F0Tg' for the target speed
+func (f *Fan) key(suffix string) string {
+	return fmt.Sprintf("F%d%s", f.index, suffix)
+}
+
+// SetDutyCycle sets the fan's target speed to the given ratio of its speed range. dcRatio is
+// clamped to [0.0, 1.0]. The first call takes the fan out of automatic control
+func (f *Fan) SetDutyCycle(dcRatio float64) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.closed {
+		return heatsink.ErrFanDriverClosed
+	}
+	if !f.isManual {
+		if err := f.setManual(true); err != nil {
+			return err
+		}
+		f.isManual = true
+	}
+	dcRatio = math.Max(0, math.Min(1, dcRatio))
+	return f.write(f.key("Tg"), f.target, f.minRPM+dcRatio*(f.maxRPM-f.minRPM))
+}
+
+// setManual switches the fan between manual and automatic control. Apple Silicon Macs have a
+// mode key per fan, while Intel Macs have a bitmask of forced fans in the 'FS! ' key
+func (f *Fan) setManual(manual bool) error {
+
+	mode := 0.0
+	if manual {
+		mode = 1
+	}
+	if v, err := f.read(f.key("Md")); err == nil {
+		return f.write(f.key("Md"), v, mode)
+	} else if !errors.Is(err, ErrKeyNotFound) {
+		return err
+	}
+
+	v, err := f.read("FS! ")
+	if err != nil {
+		return err
+	}
+	forced, err := v.float()
+	if err != nil {
+		return err
+	}
+	mask := uint16(forced)
+	if manual {
+		mask |= 1 << uint(f.index)
+	} else {
+		mask &^= 1 << uint(f.index)
+	}
+	return f.write("FS! ", v, float64(mask))
+}
+
+// Close returns the fan to automatic control, which lets the SMC protect the hardware once
+// the daemon stops. If the fan is already closed, it returns heatsink.ErrFanDriverClosed
+func (f *Fan) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.closed {
+		return heatsink.ErrFanDriverClosed
+	}
+	f.closed = true
+	if !f.isManual {
+		return nil
+	}
+	if err := f.setManual(false); err != nil {
+		return fmt.Errorf("failed to return fan to automatic control while closing driver: %w", err)
+	}
+	return nil
+}
+
+// Name returns the name of this fan driver
+func (f *Fan) Name() string {
+	return f.name
+}
@@ -0,0 +1,182 @@
+package smc
+
+import (
+	"encoding/hex"
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/malkhamis/heatsink"
+)
+
+// fakeSMC emulates the smc tool with an in-memory set of keys
+type fakeSMC struct {
+	keys   map[string]value
+	writes []string
+}
+
+func (f *fakeSMC) run(binary string, args ...string) (string, error) {
+	if len(args) < 3 || args[0] != "-k" {
+		return "", errors.New("bad arguments: " + strings.Join(args, " "))
+	}
+	v, ok := f.keys[args[1]]
+	switch args[2] {
+	case "-r":
+		if !ok {
+			return "  " + args[1] + "  [    ]  no data\n", nil
+		}
+		raw := make([]string, 0, len(v.data))
+		for _, b := range v.data {
+			raw = append(raw, hex.EncodeToString([]byte{b}))
+		}
+		return "  " + args[1] + "  [" + v.dataType + "]  (bytes " + strings.Join(raw, " ") + ")\n", nil
+	case "-w":
+		f.writes = append(f.writes, binary+" "+args[1]+"="+args[3])
+		return "", nil
+	}
+	return "", errors.New("bad arguments: " + strings.Join(args, " "))
+}
+
+func TestNewSensor_unsupported(t *testing.T) {
+	if runtime.GOOS == "darwin" {
+		t.Skip("smc is supported on macOS")
+	}
+	_, err := NewSensor("TC0P")
+	if !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", ErrUnsupported, err)
+	}
+}
+
+func TestSensor_lifeCycle(t *testing.T) {
+
+	fake := &fakeSMC{keys: map[string]value{"TC0P": {"sp78", []byte{0x2d, 0x80}}}}
+	if _, err := newSensor("TX9Z", fake.run); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", ErrKeyNotFound, err)
+	}
+
+	sensor, err := newSensor("TC0P", fake.run, nil, OptName("cpu"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sensor.Name() != "cpu" {
+		t.Fatalf("unexpected name\nwant: cpu\n got: %s", sensor.Name())
+	}
+	temp, err := sensor.Temperature()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if temp != 45.5 {
+		t.Fatalf("unexpected temperature\nwant: %v\n got: %v", 45.5, temp)
+	}
+
+	if err := sensor.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sensor.Temperature(); !errors.Is(err, heatsink.ErrThermoSensorClosed) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", heatsink.ErrThermoSensorClosed, err)
+	}
+	if err := sensor.Close(); !errors.Is(err, heatsink.ErrThermoSensorClosed) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", heatsink.ErrThermoSensorClosed, err)
+	}
+}
+
+func TestNewFan_errors(t *testing.T) {
+
+	cases := map[string]struct {
+		keys        map[string]value
+		expectedErr error
+	}{
+		"no fan": {keys: map[string]value{}, expectedErr: ErrKeyNotFound},
+		"bad range": {keys: map[string]value{
+			"F0Mn": {"fpe2", []byte{0x1f, 0x40}},
+			"F0Mx": {"fpe2", []byte{0x1f, 0x40}},
+		}, expectedErr: ErrBadFanRange},
+		"no target": {keys: map[string]value{
+			"F0Mn": {"fpe2", []byte{0x1f, 0x40}},
+			"F0Mx": {"fpe2", []byte{0x5d, 0xc0}},
+		}, expectedErr: ErrKeyNotFound},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			_, err := newFan(0, (&fakeSMC{keys: c.keys}).run)
+			if !errors.Is(err, c.expectedErr) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", c.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestFan_lifeCycle(t *testing.T) {
+
+	cases := map[string]struct {
+		keys           map[string]value
+		expectedWrites []string
+	}{
+		"per-fan mode key": {
+			keys: map[string]value{
+				"F1Mn": {"flt", []byte{0x00, 0x00, 0xfa, 0x44}}, // 2000
+				"F1Mx": {"flt", []byte{0x00, 0x00, 0x7a, 0x45}}, // 4000
+				"F1Tg": {"flt", []byte{0x00, 0x00, 0xfa, 0x44}},
+				"F1Md": {"ui8", []byte{0x00}},
+			},
+			expectedWrites: []string{
+				"/usr/local/bin/smc F1Md=01",
+				"/usr/local/bin/smc F1Tg=00401c45", // 2500
+				"/usr/local/bin/smc F1Tg=00007a45",
+				"/usr/local/bin/smc F1Md=00",
+			},
+		},
+		"forced fans bitmask": {
+			keys: map[string]value{
+				"F1Mn": {"fpe2", []byte{0x1f, 0x40}}, // 2000
+				"F1Mx": {"fpe2", []byte{0x3e, 0x80}}, // 4000
+				"F1Tg": {"fpe2", []byte{0x1f, 0x40}},
+				"FS! ": {"ui16", []byte{0x00, 0x01}},
+			},
+			expectedWrites: []string{
+				"/usr/local/bin/smc FS! =0003",
+				"/usr/local/bin/smc F1Tg=2710",
+				"/usr/local/bin/smc F1Tg=3e80",
+				"/usr/local/bin/smc FS! =0001",
+			},
+		},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+
+			fake := &fakeSMC{keys: c.keys}
+			fan, err := newFan(1, fake.run, OptBinary("/usr/local/bin/smc"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fan.Name() != "smc/fan1" {
+				t.Fatalf("unexpected name\nwant: smc/fan1\n got: %s", fan.Name())
+			}
+			if err := fan.SetDutyCycle(0.25); err != nil {
+				t.Fatal(err)
+			}
+			if err := fan.SetDutyCycle(1.5); err != nil {
+				t.Fatal(err)
+			}
+			if err := fan.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if diff := deep.Equal(fake.writes, c.expectedWrites); diff != nil {
+				t.Fatal(diff)
+			}
+
+			if err := fan.SetDutyCycle(0.5); !errors.Is(err, heatsink.ErrFanDriverClosed) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", heatsink.ErrFanDriverClosed, err)
+			}
+			if err := fan.Close(); !errors.Is(err, heatsink.ErrFanDriverClosed) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", heatsink.ErrFanDriverClosed, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package snmpsense
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// BER tags used by SNMP
+const (
+	tagInteger        = 0x02
+	tagOctetString    = 0x04
+	tagNull           = 0x05
+	tagOID            = 0x06
+	tagSequence       = 0x30
+	tagCounter32      = 0x41
+	tagGauge32        = 0x42
+	tagCounter64      = 0x46
+	tagNoSuchObject   = 0x80
+	tagNoSuchInstance = 0x81
+	tagEndOfMibView   = 0x82
+	tagGetRequest     = 0xa0
+	tagResponse       = 0xa2
+	tagReport         = 0xa8
+)
+
+// berElement is a decoded type-length-value triplet. content references the decoded buffer
+type berElement struct {
+	tag     byte
+	content []byte
+}
+
+// encodeLength returns the BER encoding of the given content length
+func encodeLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	var digits []byte
+	for ; n > 0; n >>= 8 {
+		digits = append([]byte{byte(n)}, digits...)
+	}
+	return append([]byte{0x80 | byte(len(digits))}, digits...)
+}
+
+// encodeTLV returns the BER encoding of an element with the given tag and content
+func encodeTLV(tag byte, content ...[]byte) []byte {
+	joined := bytes.Join(content, nil)
+	out := append([]byte{tag}, encodeLength(len(joined))...)
+	return append(out, joined...)
+}
+
+// encodeInt returns the BER encoding of a signed integer in its shortest two's complement form
+func encodeInt(tag byte, v int64) []byte {
+	content := []byte{byte(v)}
+	for v >>= 8; ; v >>= 8 {
+		last := content[0]
+		if (v == 0 && last&0x80 == 0) || (v == -1 && last&0x80 != 0) {
+			break
+		}
+		content = append([]byte{byte(v)}, content...)
+	}
+	return encodeTLV(tag, content)
+}
+
+// encodeOID returns the BER encoding of an object identifier given in dotted notation
+func encodeOID(dotted string) ([]byte, error) {
+
+	parts := strings.Split(strings.TrimPrefix(dotted, "."), ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("%w: '%s'", ErrBadOID, dotted)
+	}
+	arcs := make([]uint64, len(parts))
+	for i, part := range parts {
+		arc, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%w: '%s'", ErrBadOID, dotted)
+		}
+		arcs[i] = arc
+	}
+	if arcs[0] > 2 || (arcs[0] < 2 && arcs[1] > 39) {
+		return nil, fmt.Errorf("%w: '%s'", ErrBadOID, dotted)
+	}
+
+	var content []byte
+	for _, arc := range append([]uint64{40*arcs[0] + arcs[1]}, arcs[2:]...) {
+		encoded := []byte{byte(arc & 0x7f)}
+		for arc >>= 7; arc > 0; arc >>= 7 {
+			encoded = append([]byte{byte(arc&0x7f) | 0x80}, encoded...)
+		}
+		content = append(content, encoded...)
+	}
+	return encodeTLV(tagOID, content), nil
+}
+
+// decodeTLV decodes the first element of data and returns it along with the remaining bytes
+func decodeTLV(data []byte) (berElement, []byte, error) {
+
+	if len(data) < 2 {
+		return berElement{}, nil, fmt.Errorf("%w: truncated element", ErrBadResponse)
+	}
+	tag, length, offset := data[0], int(data[1]), 2
+	if length&0x80 != 0 {
+		numDigits := length & 0x7f
+		if numDigits == 0 || numDigits > 4 || len(data) < 2+numDigits {
+			return berElement{}, nil, fmt.Errorf("%w: bad length", ErrBadResponse)
+		}
+		length = 0
+		for _, digit := range data[2 : 2+numDigits] {
+			length = length<<8 | int(digit)
+		}
+		offset += numDigits
+	}
+	if length < 0 || len(data)-offset < length {
+		return berElement{}, nil, fmt.Errorf("%w: truncated element", ErrBadResponse)
+	}
+	return berElement{tag: tag, content: data[offset : offset+length]}, data[offset+length:], nil
+}
+
+// decodeSequence decodes every element in the given content, which must have the given tags
+func decodeSequence(content []byte, tags ...byte) ([]berElement, error) {
+	elements := make([]berElement, 0, len(tags))
+	for _, tag := range tags {
+		element, rest, err := decodeTLV(content)
+		if err != nil {
+			return nil, err
+		}
+		if tag != 0 && element.tag != tag {
+			return nil, fmt.Errorf("%w: expected tag 0x%02x, got 0x%02x", ErrBadResponse, tag, element.tag)
+		}
+		elements = append(elements, element)
+		content = rest
+	}
+	return elements, nil
+}
+
+// decodeInt decodes the content of a signed integer
+func decodeInt(content []byte) (int64, error) {
+	if len(content) == 0 || len(content) > 8 {
+		return 0, fmt.Errorf("%w: bad integer", ErrBadResponse)
+	}
+	v := int64(int8(content[0]))
+	for _, b := range content[1:] {
+		v = v<<8 | int64(b)
+	}
+	return v, nil
+}
+
+// decodeUint decodes the content of an unsigned integer, such as a Gauge32 or Counter64
+func decodeUint(content []byte) (uint64, error) {
+	if len(content) == 0 || len(content) > 9 || (len(content) == 9 && content[0] != 0) {
+		return 0, fmt.Errorf("%w: bad unsigned integer", ErrBadResponse)
+	}
+	var v uint64
+	for _, b := range content {
+		v = v<<8 | uint64(b)
+	}
+	return v, nil
+}
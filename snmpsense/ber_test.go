@@ -0,0 +1,99 @@
+package snmpsense
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func Test_encodeInt(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		value    int64
+		expected string
+	}{
+		{value: 0, expected: "020100"},
+		{value: 127, expected: "02017f"},
+		{value: 128, expected: "02020080"},
+		{value: 256, expected: "02020100"},
+		{value: -1, expected: "0201ff"},
+		{value: -129, expected: "0202ff7f"},
+		{value: 65507, expected: "020300ffe3"},
+	}
+
+	for _, c := range cases {
+		actual := hex.EncodeToString(encodeInt(tagInteger, c.value))
+		if actual != c.expected {
+			t.Errorf("encoding %d\nwant: %s\n got: %s", c.value, c.expected, actual)
+		}
+		element, _, err := decodeTLV(encodeInt(tagInteger, c.value))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded, err := decodeInt(element.content); err != nil || decoded != c.value {
+			t.Errorf("decoding %s\nwant: %d\n got: %d (%v)", c.expected, c.value, decoded, err)
+		}
+	}
+}
+
+func Test_encodeTLV_longLength(t *testing.T) {
+	t.Parallel()
+
+	encoded := encodeTLV(tagOctetString, make([]byte, 300))
+	if actual := hex.EncodeToString(encoded[:4]); actual != "0482012c" {
+		t.Fatalf("unexpected header\nwant: 0482012c\n got: %s", actual)
+	}
+	element, rest, err := decodeTLV(append(encoded, 0x05, 0x00))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(element.content) != 300 || len(rest) != 2 {
+		t.Fatalf("unexpected decoding: %d content bytes and %d remaining bytes", len(element.content), len(rest))
+	}
+}
+
+func Test_encodeOID(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		oid         string
+		expected    string
+		expectedErr error
+	}{
+		{oid: "1.3.6.1.2.1.1.3.0", expected: "06082b06010201010300"},
+		{oid: ".1.3.6.1.4.1.318.1", expected: "06082b06010401823e01"},
+		{oid: "2.999.1", expected: "0603883701"},
+		{oid: "1", expectedErr: ErrBadOID},
+		{oid: "1.3.x", expectedErr: ErrBadOID},
+		{oid: "1.40.1", expectedErr: ErrBadOID},
+		{oid: "3.1.1", expectedErr: ErrBadOID},
+	}
+
+	for _, c := range cases {
+		encoded, err := encodeOID(c.oid)
+		if !errors.Is(err, c.expectedErr) {
+			t.Fatalf("unexpected error\nwant: %v\n got: %v", c.expectedErr, err)
+		}
+		if err != nil {
+			continue
+		}
+		if actual := hex.EncodeToString(encoded); actual != c.expected {
+			t.Errorf("encoding %s\nwant: %s\n got: %s", c.oid, c.expected, actual)
+		}
+		if actual := oidString(encoded[2:]); "."+actual != c.oid && actual != c.oid {
+			t.Errorf("decoding %s\nwant: %s\n got: %s", c.expected, c.oid, actual)
+		}
+	}
+}
+
+func Test_decodeTLV_errors(t *testing.T) {
+	t.Parallel()
+
+	for _, data := range []string{"", "02", "0202ff", "0485ffffffffff", "0480"} {
+		raw, _ := hex.DecodeString(data)
+		if _, _, err := decodeTLV(raw); !errors.Is(err, ErrBadResponse) {
+			t.Errorf("decoding '%s'\nwant: %v\n got: %v", data, ErrBadResponse, err)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package snmpsense
+
+import (
+	"net"
+	"sync"
+	"testing"
+)
+
+// fakeAgent is an SNMP agent that serves a single object over UDP on the loopback interface
+type fakeAgent struct {
+	conn      net.PacketConn
+	community string
+	value     []byte // the encoded value of the object
+	// v3 settings, where usm is a sensor of the agent's user that is used to encode and decode
+	usm     *Sensor
+	engine  *engine
+	mutex   sync.Mutex
+	reports []string // reports to send instead of the next responses
+	drop    int      // number of requests to ignore
+}
+
+func newFakeAgent(t *testing.T, value []byte) *fakeAgent {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent := &fakeAgent{conn: conn, community: "public", value: value}
+	go agent.serve()
+	return agent
+}
+
+// withCommunity makes the agent answer SNMPv2c requests of the given community only
+func (a *fakeAgent) withCommunity(community string) *fakeAgent {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.community = community
+	return a
+}
+
+// withDrop makes the agent ignore the given number of requests before answering
+func (a *fakeAgent) withDrop(n int) *fakeAgent {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.drop = n
+	return a
+}
+
+// withUSM makes the agent answer SNMPv3 requests of the given user
+func (a *fakeAgent) withUSM(t *testing.T, usm USM) *fakeAgent {
+	t.Helper()
+	sensor, err := New(a.addr(), "1.3.6.1.4.1.1", OptV3(usm))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &engine{id: []byte{0x80, 0x00, 0x1f, 0x88, 0x80, 0xab, 0xcd, 0xef}, boots: 5, time: 1000}
+	e.localize(usm)
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.usm, a.engine = sensor, e
+	return a
+}
+
+func (a *fakeAgent) addr() string {
+	return a.conn.LocalAddr().String()
+}
+
+func (a *fakeAgent) close() {
+	a.conn.Close()
+}
+
+func (a *fakeAgent) serve() {
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, from, err := a.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		request := append([]byte(nil), buf[:n]...)
+		if response := a.handle(request[:n:n]); response != nil {
+			_, _ = a.conn.WriteTo(response, from)
+		}
+	}
+}
+
+func (a *fakeAgent) handle(request []byte) []byte {
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.drop > 0 {
+		a.drop--
+		return nil
+	}
+
+	msg, _, err := decodeTLV(request)
+	if err != nil {
+		return nil
+	}
+	fields, err := decodeSequence(msg.content, tagInteger, 0, 0)
+	if err != nil {
+		return nil
+	}
+
+	if a.usm == nil { // SNMPv2c
+		if string(fields[1].content) != a.community {
+			return nil // agents silently drop requests of unknown communities
+		}
+		pdu, err := decodeV2c(request)
+		if err != nil {
+			return nil
+		}
+		requestID, oid := requestIDAndOID(pdu)
+		return encodeTLV(tagSequence, fields[0].tlv(), fields[1].tlv(), a.response(tagResponse, requestID, oid, a.value))
+	}
+
+	// SNMPv3: unknown engines are reported, like time windows that the test asks for
+	// discovery requests are neither authenticated nor encrypted
+	if _, params, err := a.usm.decodeV3(request, nil); err == nil && len(params.engineID) == 0 {
+		return a.report(0, oidUnknownEngineIDs)
+	}
+	pdu, _, err := a.usm.decodeV3(request, a.engine)
+	if err != nil {
+		return nil
+	}
+	requestID, oid := requestIDAndOID(pdu)
+	if len(a.reports) > 0 {
+		report := a.reports[0]
+		a.reports = a.reports[1:]
+		return a.report(requestID, report)
+	}
+	response, err := a.usm.encodeV3(requestID, a.response(tagResponse, requestID, oid, a.value), a.engine, a.engine.time, 0)
+	if err != nil {
+		return nil
+	}
+	return response
+}
+
+// report returns an unauthenticated report with the agent's engine parameters
+func (a *fakeAgent) report(requestID int32, oid string) []byte {
+	encodedOID, _ := encodeOID(oid)
+	pdu := a.response(tagReport, requestID, encodedOID, encodeTLV(tagCounter32, []byte{1}))
+	secParams, _ := securityParams{engineID: a.engine.id, boots: a.engine.boots, time: a.engine.time}.encode()
+	return encodeTLV(
+		tagSequence,
+		encodeInt(tagInteger, 3),
+		encodeHeader(requestID, 0),
+		encodeTLV(tagOctetString, secParams),
+		encodeTLV(tagSequence, encodeTLV(tagOctetString, a.engine.id), encodeTLV(tagOctetString), pdu),
+	)
+}
+
+func (a *fakeAgent) response(tag byte, requestID int32, oid, value []byte) []byte {
+	return encodeTLV(
+		tag,
+		encodeInt(tagInteger, int64(requestID)),
+		encodeInt(tagInteger, 0),
+		encodeInt(tagInteger, 0),
+		encodeTLV(tagSequence, encodeTLV(tagSequence, oid, value)),
+	)
+}
+
+func (e berElement) tlv() []byte {
+	return encodeTLV(e.tag, e.content)
+}
+
+func requestIDAndOID(pdu berElement) (int32, []byte) {
+	fields, err := decodeSequence(pdu.content, tagInteger, tagInteger, tagInteger, tagSequence)
+	if err != nil {
+		return 0, nil
+	}
+	id, _ := decodeInt(fields[0].content)
+	varbind, _, err := decodeTLV(fields[3].content)
+	if err != nil {
+		return int32(id), nil // discovery requests have no varbinds
+	}
+	pair, _ := decodeSequence(varbind.content, tagOID, 0)
+	if len(pair) == 0 {
+		return int32(id), nil
+	}
+	return int32(id), pair[0].tlv()
+}
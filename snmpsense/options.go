@@ -0,0 +1,63 @@
+package snmpsense
+
+import "time"
+
+// Option is used to pass optional parameters to the sensor's factory function
+type Option func(*Sensor)
+
+// OptName sets the name of the sensor. if name is empty, it is set to the default value
+//
+// (default: '<target>/<oid>')
+func OptName(name string) Option {
+	return func(s *Sensor) {
+		if name != "" {
+			s.name = name
+		}
+	}
+}
+
+// OptCommunity sets the community of SNMPv2c requests. It is ignored if OptV3 is given
+//
+// (default: "public")
+func OptCommunity(community string) Option {
+	return func(s *Sensor) {
+		s.community = community
+	}
+}
+
+// OptV3 switches the sensor to SNMPv3 with the given user's credentials
+//
+// (default: SNMPv2c)
+func OptV3(usm USM) Option {
+	return func(s *Sensor) {
+		s.usm = &usm
+	}
+}
+
+// OptScale sets the factor that the object's value is multiplied by to get degrees celsius,
+// e.g. 0.1 for objects in tenths of a degree
+//
+// (default: 1)
+func OptScale(scale float64) Option {
+	return func(s *Sensor) {
+		s.scale = scale
+	}
+}
+
+// OptTimeout sets how long to wait for each response
+//
+// (default: 2s)
+func OptTimeout(timeout time.Duration) Option {
+	return func(s *Sensor) {
+		s.timeout = timeout
+	}
+}
+
+// OptRetries sets how often a request is sent again after it timed out
+//
+// (default: 1)
+func OptRetries(retries int) Option {
+	return func(s *Sensor) {
+		s.retries = retries
+	}
+}
@@ -0,0 +1,325 @@
+// Package snmpsense provides an implementation of the heatsink.ThermoSensor interface that polls
+// an SNMP object for a temperature, which is useful in racks where the inlet temperature is
+// measured by a PDU or an environmental monitor. SNMPv2c and SNMPv3 with the user-based
+// security model are supported
+package snmpsense
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/malkhamis/heatsink"
+)
+
+// compile-time check for interface implementation and dependency inversion
+var _ heatsink.ThermoSensor = (*Sensor)(nil)
+
+// Sentinel errors that are wrapped and returned by this package
+var (
+	ErrBadOID        = errors.New("invalid object identifier")
+	ErrBadSecurity   = errors.New("invalid snmpv3 security settings")
+	ErrBadResponse   = errors.New("malformed snmp response")
+	ErrNoSuchObject  = errors.New("no such object")
+	ErrNotNumber     = errors.New("object value is not a number")
+	ErrErrorStatus   = errors.New("snmp agent returned an error")
+	ErrReport        = errors.New("snmp agent reported a security error")
+	ErrAuthFailure   = errors.New("snmp response failed authentication")
+	ErrBadParameters = errors.New("invalid timeout or retries")
+)
+
+// reports that are resolved by discovering the authoritative engine again
+var (
+	oidUnknownEngineIDs = "1.3.6.1.6.3.15.1.1.4.0"
+	oidNotInTimeWindows = "1.3.6.1.6.3.15.1.1.2.0"
+)
+
+// Sensor polls an SNMP object for a temperature. Instances of this type are safe for
+// concurrent use
+type Sensor struct {
+	name      string
+	target    string
+	oid       []byte
+	community string
+	usm       *USM
+	scale     float64
+	timeout   time.Duration
+	retries   int
+	engine    *engine
+	requestID int32
+	salt      uint64
+	mutex     sync.Mutex
+	closed    bool
+}
+
+// New returns a sensor that polls the object with the given dotted identifier, e.g.
+// '1.3.6.1.4.1.318.1.1.10.2.3.2.1.4.1' for the probe temperature of an APC PDU, from the
+// agent at the given target, e.g. 'pdu.local:161'. The port defaults to 161 if omitted. The
+// agent is not contacted until the first reading. For details about options and defaults, see
+// the documentation for type 'Option'
+func New(target, oid string, options ...Option) (*Sensor, error) {
+
+	encodedOID, err := encodeOID(oid)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := net.SplitHostPort(target); err != nil {
+		target = net.JoinHostPort(strings.Trim(target, "[]"), "161")
+	}
+
+	sensor := &Sensor{ // defaults
+		name:      target + "/" + strings.TrimPrefix(oid, "."),
+		target:    target,
+		oid:       encodedOID,
+		community: "public",
+		scale:     1,
+		timeout:   2 * time.Second,
+		retries:   1,
+		requestID: rand.Int31(),
+		salt:      rand.Uint64(),
+	}
+	for _, applyOption := range options {
+		if applyOption == nil {
+			continue
+		}
+		applyOption(sensor)
+	}
+	if sensor.timeout <= 0 || sensor.retries < 0 {
+		return nil, fmt.Errorf("%w: %v, %d", ErrBadParameters, sensor.timeout, sensor.retries)
+	}
+	if sensor.usm != nil {
+		if err := sensor.usm.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return sensor, nil
+}
+
+// Temperature polls the object and returns its value multiplied by the configured scale as
+// well as any error encountered. If the sensor is closed, it returns
+// heatsink.ErrThermoSensorClosed
+func (s *Sensor) Temperature() (float64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return math.Inf(1), heatsink.ErrThermoSensorClosed
+	}
+	value, err := s.get()
+	if err != nil {
+		return math.Inf(1), fmt.Errorf("'%s': %w", s.target, err)
+	}
+	return value * s.scale, nil
+}
+
+// get retrieves the object's value with the configured version of the protocol
+func (s *Sensor) get() (float64, error) {
+
+	if s.usm == nil {
+		s.requestID = (s.requestID + 1) & math.MaxInt32
+		response, err := s.exchange(s.encodeV2c(s.requestID))
+		if err != nil {
+			return 0, err
+		}
+		pdu, err := decodeV2c(response)
+		if err != nil {
+			return 0, err
+		}
+		return s.decodePDU(pdu, s.requestID)
+	}
+
+	for attempt := 0; ; attempt++ {
+		if s.engine == nil {
+			if err := s.discover(); err != nil {
+				return 0, err
+			}
+		}
+		value, err := s.getV3()
+		var report reportError
+		if attempt == 0 && errors.As(err, &report) &&
+			(report.oid == oidUnknownEngineIDs || report.oid == oidNotInTimeWindows) {
+			s.engine = nil // the agent restarted or its clock drifted
+			continue
+		}
+		return value, err
+	}
+}
+
+// exchange sends a request to the agent and returns its response, retrying on timeouts
+func (s *Sensor) exchange(request []byte) ([]byte, error) {
+
+	conn, err := net.Dial("udp", s.target)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	buf := make([]byte, maxMessageSize)
+	for attempt := 0; ; attempt++ {
+		if err := conn.SetDeadline(time.Now().Add(s.timeout)); err != nil {
+			return nil, err
+		}
+		if _, err := conn.Write(request); err != nil {
+			return nil, err
+		}
+		n, err := conn.Read(buf)
+		if err == nil {
+			return buf[:n:n], nil
+		}
+		var netErr net.Error
+		if attempt >= s.retries || !errors.As(err, &netErr) || !netErr.Timeout() {
+			return nil, err
+		}
+	}
+}
+
+// encodeGetPDU returns a GetRequest-PDU for the sensor's object or, given no object, for none
+func encodeGetPDU(requestID int32, oid []byte) []byte {
+	var varbinds []byte
+	if oid != nil {
+		varbinds = encodeTLV(tagSequence, oid, encodeTLV(tagNull))
+	}
+	return encodeTLV(
+		tagGetRequest,
+		encodeInt(tagInteger, int64(requestID)),
+		encodeInt(tagInteger, 0), // error-status
+		encodeInt(tagInteger, 0), // error-index
+		encodeTLV(tagSequence, varbinds),
+	)
+}
+
+func (s *Sensor) encodeV2c(requestID int32) []byte {
+	return encodeTLV(
+		tagSequence,
+		encodeInt(tagInteger, 1), // version 2c
+		encodeTLV(tagOctetString, []byte(s.community)),
+		encodeGetPDU(requestID, s.oid),
+	)
+}
+
+func decodeV2c(response []byte) (berElement, error) {
+	msg, _, err := decodeTLV(response)
+	if err != nil {
+		return berElement{}, err
+	}
+	elements, err := decodeSequence(msg.content, tagInteger, tagOctetString, 0)
+	if err != nil {
+		return berElement{}, err
+	}
+	return elements[2], nil
+}
+
+// reportError is a Report-PDU received in place of a response
+type reportError struct {
+	oid string
+}
+
+func (r reportError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrReport, r.oid)
+}
+
+func (r reportError) Unwrap() error {
+	return ErrReport
+}
+
+// decodePDU returns the numeric value of the sensor's object from a Response-PDU
+func (s *Sensor) decodePDU(pdu berElement, requestID int32) (float64, error) {
+
+	if pdu.tag != tagResponse && pdu.tag != tagReport {
+		return 0, fmt.Errorf("%w: unexpected pdu type 0x%02x", ErrBadResponse, pdu.tag)
+	}
+	fields, err := decodeSequence(pdu.content, tagInteger, tagInteger, tagInteger, tagSequence)
+	if err != nil {
+		return 0, err
+	}
+	varbind, _, err := decodeTLV(fields[3].content)
+	if err != nil {
+		return 0, err
+	}
+	pair, err := decodeSequence(varbind.content, tagOID, 0)
+	if err != nil {
+		return 0, err
+	}
+	if pdu.tag == tagReport {
+		return 0, reportError{oid: oidString(pair[0].content)}
+	}
+
+	if id, err := decodeInt(fields[0].content); err != nil || id != int64(requestID) {
+		return 0, fmt.Errorf("%w: request id mismatch", ErrBadResponse)
+	}
+	if status, err := decodeInt(fields[1].content); err != nil || status != 0 {
+		return 0, fmt.Errorf("%w: error-status %d", ErrErrorStatus, status)
+	}
+	if !bytes.Equal(encodeTLV(tagOID, pair[0].content), s.oid) {
+		return 0, fmt.Errorf("%w: response is for another object", ErrBadResponse)
+	}
+	return decodeNumber(pair[1])
+}
+
+// decodeNumber returns the value of a varbind as a number
+func decodeNumber(value berElement) (float64, error) {
+	switch value.tag {
+	case tagInteger:
+		v, err := decodeInt(value.content)
+		return float64(v), err
+	case tagCounter32, tagGauge32, tagCounter64:
+		v, err := decodeUint(value.content)
+		return float64(v), err
+	case tagOctetString:
+		v, err := strconv.ParseFloat(strings.TrimSpace(string(value.content)), 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: '%s'", ErrNotNumber, value.content)
+		}
+		return v, nil
+	case tagNoSuchObject, tagNoSuchInstance, tagEndOfMibView:
+		return 0, ErrNoSuchObject
+	}
+	return 0, fmt.Errorf("%w: type 0x%02x", ErrNotNumber, value.tag)
+}
+
+// oidString returns the dotted notation of an encoded object identifier
+func oidString(content []byte) string {
+	var arcs []string
+	var arc uint64
+	for _, b := range content {
+		arc = arc<<7 | uint64(b&0x7f)
+		if b&0x80 != 0 {
+			continue
+		}
+		if len(arcs) == 0 {
+			first := arc / 40
+			if first > 2 {
+				first = 2
+			}
+			arcs = append(arcs, strconv.FormatUint(first, 10), strconv.FormatUint(arc-40*first, 10))
+		} else {
+			arcs = append(arcs, strconv.FormatUint(arc, 10))
+		}
+		arc = 0
+	}
+	return strings.Join(arcs, ".")
+}
+
+// Close closes this sensor. If the sensor was previously closed, it returns
+// heatsink.ErrThermoSensorClosed
+func (s *Sensor) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return heatsink.ErrThermoSensorClosed
+	}
+	s.closed = true
+	return nil
+}
+
+// Name returns the name of this sensor
+func (s *Sensor) Name() string {
+	return s.name
+}
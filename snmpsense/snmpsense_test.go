@@ -0,0 +1,218 @@
+package snmpsense
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/malkhamis/heatsink"
+)
+
+const testOID = "1.3.6.1.4.1.318.1.1.10.2.3.2.1.4.1"
+
+func TestNew_errors(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		oid         string
+		options     []Option
+		expectedErr error
+	}{
+		"bad oid":      {oid: "temperature", expectedErr: ErrBadOID},
+		"bad timeout":  {oid: testOID, options: []Option{OptTimeout(0)}, expectedErr: ErrBadParameters},
+		"bad retries":  {oid: testOID, options: []Option{OptRetries(-1)}, expectedErr: ErrBadParameters},
+		"bad security": {oid: testOID, options: []Option{OptV3(USM{})}, expectedErr: ErrBadSecurity},
+		"valid":        {oid: testOID, options: []Option{nil}},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			_, err := New("pdu.local", c.oid, c.options...)
+			if !errors.Is(err, c.expectedErr) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", c.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestNew_defaults(t *testing.T) {
+	t.Parallel()
+
+	for target, expected := range map[string]string{
+		"pdu.local":      "pdu.local:161/" + testOID,
+		"pdu.local:1161": "pdu.local:1161/" + testOID,
+		"[::1]":          "[::1]:161/" + testOID,
+	} {
+		sensor, err := New(target, "."+testOID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sensor.Name() != expected {
+			t.Errorf("unexpected name\nwant: %s\n got: %s", expected, sensor.Name())
+		}
+	}
+}
+
+func TestSensor_v2c(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		value          []byte
+		options        []Option
+		agentCommunity string
+		expectTimeout  bool
+		expectedTemp   float64
+		expectedErr    error
+	}{
+		"integer":      {value: encodeInt(tagInteger, 23), expectedTemp: 23},
+		"scaled gauge": {value: encodeTLV(tagGauge32, []byte{0x00, 0xeb}), options: []Option{OptScale(0.1)}, expectedTemp: 23.5},
+		"negative":     {value: encodeInt(tagInteger, -5), expectedTemp: -5},
+		"octet string": {value: encodeTLV(tagOctetString, []byte("21.5")), expectedTemp: 21.5},
+		"not a number": {value: encodeTLV(tagOctetString, []byte("warm")), expectedErr: ErrNotNumber},
+		"null":         {value: encodeTLV(tagNull), expectedErr: ErrNotNumber},
+		"no such":      {value: encodeTLV(tagNoSuchInstance), expectedErr: ErrNoSuchObject},
+		"bad community": {
+			value:          encodeInt(tagInteger, 23),
+			options:        []Option{OptCommunity("private")},
+			agentCommunity: "secret",
+			expectTimeout:  true,
+		},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			agent := newFakeAgent(t, c.value)
+			defer agent.close()
+			if c.agentCommunity != "" {
+				agent.withCommunity(c.agentCommunity)
+			}
+
+			options := append([]Option{OptTimeout(50 * time.Millisecond)}, c.options...)
+			sensor, err := New(agent.addr(), testOID, options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			temp, err := sensor.Temperature()
+			if c.expectTimeout {
+				// agents silently drop requests they do not accept
+				if err == nil {
+					t.Fatal("expected a timeout given a community that the agent does not know")
+				}
+				return
+			}
+			if !errors.Is(err, c.expectedErr) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", c.expectedErr, err)
+			}
+			if err == nil && temp != c.expectedTemp {
+				t.Fatalf("unexpected temperature\nwant: %v\n got: %v", c.expectedTemp, temp)
+			}
+		})
+	}
+}
+
+func TestSensor_retries(t *testing.T) {
+	t.Parallel()
+
+	agent := newFakeAgent(t, encodeInt(tagInteger, 30)).withDrop(1)
+	defer agent.close()
+
+	sensor, err := New(agent.addr(), testOID, OptTimeout(50*time.Millisecond), OptRetries(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if temp, err := sensor.Temperature(); err != nil || temp != 30 {
+		t.Fatalf("unexpected temperature after a lost request\nwant: 30\n got: %v (%v)", temp, err)
+	}
+}
+
+func TestSensor_v3(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]USM{
+		"md5 auth":       {User: "monitor", AuthProtocol: AuthMD5, AuthPassword: "authpass1"},
+		"sha auth":       {User: "monitor", AuthProtocol: AuthSHA, AuthPassword: "authpass1"},
+		"sha auth + aes": {User: "monitor", AuthProtocol: AuthSHA, AuthPassword: "authpass1", PrivProtocol: PrivAES, PrivPassword: "privpass1"},
+	}
+
+	for name, usm := range cases {
+		usm := usm
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			agent := newFakeAgent(t, encodeTLV(tagGauge32, []byte{0x01, 0x04})).withUSM(t, usm)
+			defer agent.close()
+
+			sensor, err := New(agent.addr(), testOID, OptV3(usm), OptScale(0.1), OptTimeout(time.Second))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 2; i++ {
+				if temp, err := sensor.Temperature(); err != nil || temp != 26 {
+					t.Fatalf("unexpected temperature\nwant: 26\n got: %v (%v)", temp, err)
+				}
+			}
+
+			// the agent restarted, so the sensor must discover it again
+			agent.mutex.Lock()
+			agent.reports = []string{oidNotInTimeWindows}
+			agent.engine.boots++
+			agent.engine.localize(usm)
+			agent.mutex.Unlock()
+			if temp, err := sensor.Temperature(); err != nil || temp != 26 {
+				t.Fatalf("unexpected temperature after rediscovery\nwant: 26\n got: %v (%v)", temp, err)
+			}
+
+			// other reports are returned as errors
+			agent.mutex.Lock()
+			agent.reports = []string{"1.3.6.1.6.3.15.1.1.5.0"}
+			agent.mutex.Unlock()
+			if _, err := sensor.Temperature(); !errors.Is(err, ErrReport) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", ErrReport, err)
+			}
+		})
+	}
+}
+
+func TestSensor_v3_wrongPassword(t *testing.T) {
+	t.Parallel()
+
+	usm := USM{User: "monitor", AuthProtocol: AuthSHA, AuthPassword: "authpass1"}
+	agent := newFakeAgent(t, encodeInt(tagInteger, 26)).withUSM(t, usm)
+	defer agent.close()
+
+	usm.AuthPassword = "authpass2"
+	sensor, err := New(agent.addr(), testOID, OptV3(usm), OptTimeout(50*time.Millisecond), OptRetries(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the agent drops requests that fail authentication
+	if _, err := sensor.Temperature(); err == nil {
+		t.Fatal("expected an error given a wrong password")
+	}
+}
+
+func TestSensor_lifeCycle(t *testing.T) {
+	t.Parallel()
+
+	sensor, err := New("pdu.local", testOID, OptName("inlet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sensor.Name() != "inlet" {
+		t.Fatalf("unexpected name\nwant: inlet\n got: %s", sensor.Name())
+	}
+	if err := sensor.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sensor.Temperature(); !errors.Is(err, heatsink.ErrThermoSensorClosed) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", heatsink.ErrThermoSensorClosed, err)
+	}
+	if err := sensor.Close(); !errors.Is(err, heatsink.ErrThermoSensorClosed) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", heatsink.ErrThermoSensorClosed, err)
+	}
+}
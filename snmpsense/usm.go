@@ -0,0 +1,178 @@
+package snmpsense
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"time"
+)
+
+// AuthProtocol is an authentication protocol of the SNMPv3 user-based security model
+type AuthProtocol string
+
+// PrivProtocol is a privacy (encryption) protocol of the SNMPv3 user-based security model
+type PrivProtocol string
+
+// Supported security protocols
+const (
+	AuthNone AuthProtocol = ""
+	AuthMD5  AuthProtocol = "MD5"
+	AuthSHA  AuthProtocol = "SHA"
+	PrivNone PrivProtocol = ""
+	PrivAES  PrivProtocol = "AES"
+)
+
+// USM holds the credentials of an SNMPv3 user. Authentication without privacy and
+// authentication with AES-128 privacy are supported
+type USM struct {
+	User         string
+	AuthProtocol AuthProtocol
+	AuthPassword string
+	PrivProtocol PrivProtocol
+	PrivPassword string
+}
+
+// msgFlags of SNMPv3 messages
+const (
+	flagAuth       = 0x01
+	flagPriv       = 0x02
+	flagReportable = 0x04
+)
+
+// authParamsLen is the length of the truncated HMAC of HMAC-MD5-96 and HMAC-SHA-96
+const authParamsLen = 12
+
+// securityModelUSM identifies the user-based security model in SNMPv3 headers
+const securityModelUSM = 3
+
+// maxMessageSize is the largest message that is accepted in responses
+const maxMessageSize = 65507
+
+func (u USM) validate() error {
+	if u.User == "" {
+		return fmt.Errorf("%w: user is empty", ErrBadSecurity)
+	}
+	switch u.AuthProtocol {
+	case AuthNone:
+		if u.PrivProtocol != PrivNone {
+			return fmt.Errorf("%w: privacy requires authentication", ErrBadSecurity)
+		}
+	case AuthMD5, AuthSHA:
+		if len(u.AuthPassword) < 8 {
+			return fmt.Errorf("%w: auth password must be at least 8 characters", ErrBadSecurity)
+		}
+	default:
+		return fmt.Errorf("%w: unknown auth protocol '%s'", ErrBadSecurity, u.AuthProtocol)
+	}
+	switch u.PrivProtocol {
+	case PrivNone:
+	case PrivAES:
+		if len(u.PrivPassword) < 8 {
+			return fmt.Errorf("%w: priv password must be at least 8 characters", ErrBadSecurity)
+		}
+	default:
+		return fmt.Errorf("%w: unknown priv protocol '%s'", ErrBadSecurity, u.PrivProtocol)
+	}
+	return nil
+}
+
+func (u USM) flags() byte {
+	flags := byte(0)
+	if u.AuthProtocol != AuthNone {
+		flags |= flagAuth
+	}
+	if u.PrivProtocol != PrivNone {
+		flags |= flagPriv
+	}
+	return flags
+}
+
+func (u USM) hash() func() hash.Hash {
+	if u.AuthProtocol == AuthSHA {
+		return sha1.New
+	}
+	return md5.New
+}
+
+// passwordToKey derives the key of a user that is localized to the given engine as specified
+// by RFC 3414, section A.2
+func passwordToKey(newHash func() hash.Hash, password string, engineID []byte) []byte {
+
+	h := newHash()
+	expanded := make([]byte, 64)
+	for written, i := 0, 0; written < 1048576; written += len(expanded) {
+		for j := range expanded {
+			expanded[j] = password[i%len(password)]
+			i++
+		}
+		h.Write(expanded)
+	}
+	ku := h.Sum(nil)
+
+	h.Reset()
+	h.Write(ku)
+	h.Write(engineID)
+	h.Write(ku)
+	return h.Sum(nil)
+}
+
+// engine is what a sender must know about an authoritative SNMP engine to talk to it securely
+type engine struct {
+	id           []byte
+	boots        int64
+	time         int64
+	discoveredAt time.Time
+	authKey      []byte
+	privKey      []byte
+}
+
+// timeNow returns the estimated engine time of the authoritative engine
+func (e *engine) timeNow(now time.Time) int64 {
+	return e.time + int64(now.Sub(e.discoveredAt)/time.Second)
+}
+
+// localize derives the keys of the given user for this engine
+func (e *engine) localize(u USM) {
+	if u.AuthProtocol != AuthNone {
+		e.authKey = passwordToKey(u.hash(), u.AuthPassword, e.id)
+	}
+	if u.PrivProtocol != PrivNone {
+		e.privKey = passwordToKey(u.hash(), u.PrivPassword, e.id)[:16]
+	}
+}
+
+// aesIV returns the initialization vector of AES-CFB privacy as specified by RFC 3826
+func aesIV(boots, engineTime int64, salt []byte) []byte {
+	iv := make([]byte, 16)
+	binary.BigEndian.PutUint32(iv[0:4], uint32(boots))
+	binary.BigEndian.PutUint32(iv[4:8], uint32(engineTime))
+	copy(iv[8:], salt)
+	return iv
+}
+
+// aesCFB encrypts or decrypts data in place with AES-128 in CFB mode
+func aesCFB(key, iv, data []byte, encrypt bool) error {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	if encrypt {
+		cipher.NewCFBEncrypter(block, iv).XORKeyStream(data, data)
+	} else {
+		cipher.NewCFBDecrypter(block, iv).XORKeyStream(data, data)
+	}
+	return nil
+}
+
+// authenticate returns the truncated HMAC of a whole message whose authentication parameters
+// are zeroed
+func authenticate(newHash func() hash.Hash, key, msg []byte) []byte {
+	mac := hmac.New(newHash, key)
+	mac.Write(msg)
+	return mac.Sum(nil)[:authParamsLen]
+}
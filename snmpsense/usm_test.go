@@ -0,0 +1,55 @@
+package snmpsense
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+// Test_passwordToKey checks the sample keys of RFC 3414, section A.3
+func Test_passwordToKey(t *testing.T) {
+	t.Parallel()
+
+	engineID, _ := hex.DecodeString("000000000000000000000002")
+	cases := map[string]string{
+		"md5":  "526f5eed9fcce26f8964c2930787d82b",
+		"sha1": "6695febc9288e36282235fc7151f128497b38f3f",
+	}
+	for name, expected := range cases {
+		newHash := md5.New
+		if name == "sha1" {
+			newHash = sha1.New
+		}
+		actual := hex.EncodeToString(passwordToKey(newHash, "maplesyrup", engineID))
+		if actual != expected {
+			t.Errorf("%s\nwant: %s\n got: %s", name, expected, actual)
+		}
+	}
+}
+
+func TestUSM_validate(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		usm         USM
+		expectedErr error
+	}{
+		"no auth":       {usm: USM{User: "monitor"}},
+		"auth":          {usm: USM{User: "monitor", AuthProtocol: AuthSHA, AuthPassword: "password"}},
+		"auth and priv": {usm: USM{User: "monitor", AuthProtocol: AuthMD5, AuthPassword: "password", PrivProtocol: PrivAES, PrivPassword: "password"}},
+		"no user":       {usm: USM{}, expectedErr: ErrBadSecurity},
+		"priv only":     {usm: USM{User: "monitor", PrivProtocol: PrivAES, PrivPassword: "password"}, expectedErr: ErrBadSecurity},
+		"short auth":    {usm: USM{User: "monitor", AuthProtocol: AuthSHA, AuthPassword: "short"}, expectedErr: ErrBadSecurity},
+		"short priv":    {usm: USM{User: "monitor", AuthProtocol: AuthSHA, AuthPassword: "password", PrivProtocol: PrivAES}, expectedErr: ErrBadSecurity},
+		"unknown auth":  {usm: USM{User: "monitor", AuthProtocol: "SHA512", AuthPassword: "password"}, expectedErr: ErrBadSecurity},
+		"unknown priv":  {usm: USM{User: "monitor", AuthProtocol: AuthSHA, AuthPassword: "password", PrivProtocol: "DES", PrivPassword: "password"}, expectedErr: ErrBadSecurity},
+	}
+
+	for name, c := range cases {
+		if err := c.usm.validate(); !errors.Is(err, c.expectedErr) {
+			t.Errorf("%s: unexpected error\nwant: %v\n got: %v", name, c.expectedErr, err)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package snmpsense
+
+import (
+	"crypto/hmac"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+)
+
+// securityParams are the user-based security parameters of an SNMPv3 message
+type securityParams struct {
+	engineID   []byte
+	boots      int64
+	time       int64
+	user       []byte
+	authParams []byte
+	privParams []byte
+}
+
+// encode returns the BER encoding of these parameters along with the offset of the
+// authentication parameters' content within it
+func (p securityParams) encode() ([]byte, int) {
+	beforeAuth := [][]byte{
+		encodeTLV(tagOctetString, p.engineID),
+		encodeInt(tagInteger, p.boots),
+		encodeInt(tagInteger, p.time),
+		encodeTLV(tagOctetString, p.user),
+	}
+	content := append(beforeAuth,
+		encodeTLV(tagOctetString, p.authParams),
+		encodeTLV(tagOctetString, p.privParams),
+	)
+	encoded := encodeTLV(tagSequence, content...)
+	offset := len(encoded) - totalLen(content) + totalLen(beforeAuth) + len(content[4]) - len(p.authParams)
+	return encoded, offset
+}
+
+func totalLen(elements [][]byte) int {
+	n := 0
+	for _, element := range elements {
+		n += len(element)
+	}
+	return n
+}
+
+// discover learns the identifier, boots and time of the agent's authoritative engine from
+// the report it returns to an unauthenticated request, as specified by RFC 3414, section 4
+func (s *Sensor) discover() error {
+
+	s.requestID = (s.requestID + 1) & math.MaxInt32
+	scopedPDU := encodeTLV(
+		tagSequence,
+		encodeTLV(tagOctetString),
+		encodeTLV(tagOctetString),
+		encodeGetPDU(s.requestID, nil),
+	)
+	secParams, _ := securityParams{}.encode()
+	request := encodeTLV(
+		tagSequence,
+		encodeInt(tagInteger, 3),
+		encodeHeader(s.requestID, flagReportable),
+		encodeTLV(tagOctetString, secParams),
+		scopedPDU,
+	)
+
+	response, err := s.exchange(request)
+	if err != nil {
+		return err
+	}
+	_, params, err := s.decodeV3(response, nil)
+	if err != nil {
+		return err
+	}
+	if len(params.engineID) == 0 {
+		return fmt.Errorf("%w: agent did not report its engine id", ErrBadResponse)
+	}
+
+	e := &engine{id: params.engineID, boots: params.boots, time: params.time, discoveredAt: time.Now()}
+	e.localize(*s.usm)
+	s.engine = e
+	return nil
+}
+
+func encodeHeader(msgID int32, flags byte) []byte {
+	return encodeTLV(
+		tagSequence,
+		encodeInt(tagInteger, int64(msgID)),
+		encodeInt(tagInteger, maxMessageSize),
+		encodeTLV(tagOctetString, []byte{flags}),
+		encodeInt(tagInteger, securityModelUSM),
+	)
+}
+
+// getV3 retrieves the object's value with an authenticated, and possibly encrypted, request
+func (s *Sensor) getV3() (float64, error) {
+
+	s.requestID = (s.requestID + 1) & math.MaxInt32
+	request, err := s.encodeV3(s.requestID, encodeGetPDU(s.requestID, s.oid), s.engine, s.engine.timeNow(time.Now()), flagReportable)
+	if err != nil {
+		return 0, err
+	}
+	response, err := s.exchange(request)
+	if err != nil {
+		return 0, err
+	}
+	pdu, _, err := s.decodeV3(response, s.engine)
+	if err != nil {
+		return 0, err
+	}
+	return s.decodePDU(pdu, s.requestID)
+}
+
+// encodeV3 returns an SNMPv3 message that carries the given pdu with the security level of the
+// sensor's user, addressed to the given engine at the given engine time
+func (s *Sensor) encodeV3(msgID int32, pdu []byte, e *engine, engineTime int64, flags byte) ([]byte, error) {
+
+	flags |= s.usm.flags()
+	params := securityParams{
+		engineID: e.id,
+		boots:    e.boots,
+		time:     engineTime,
+		user:     []byte(s.usm.User),
+	}
+
+	msgData := encodeTLV(tagSequence, encodeTLV(tagOctetString, e.id), encodeTLV(tagOctetString), pdu)
+	if flags&flagPriv != 0 {
+		s.salt++
+		params.privParams = make([]byte, 8)
+		binary.BigEndian.PutUint64(params.privParams, s.salt)
+		iv := aesIV(params.boots, params.time, params.privParams)
+		if err := aesCFB(e.privKey, iv, msgData, true); err != nil {
+			return nil, err
+		}
+		msgData = encodeTLV(tagOctetString, msgData)
+	}
+	if flags&flagAuth != 0 {
+		params.authParams = make([]byte, authParamsLen)
+	}
+
+	secParams, authOffset := params.encode()
+	content := [][]byte{
+		encodeInt(tagInteger, 3),
+		encodeHeader(msgID, flags),
+		encodeTLV(tagOctetString, secParams),
+		msgData,
+	}
+	msg := encodeTLV(tagSequence, content...)
+	if flags&flagAuth != 0 {
+		offset := len(msg) - totalLen(content)
+		offset += len(content[0]) + len(content[1]) + len(content[2]) - len(secParams) + authOffset
+		copy(msg[offset:], authenticate(s.usm.hash(), e.authKey, msg))
+	}
+	return msg, nil
+}
+
+// decodeV3 decodes an SNMPv3 response and returns its pdu and its security parameters. Given an engine, authenticated responses are verified and encrypted ones decrypted
+func (s *Sensor) decodeV3(response []byte, e *engine) (berElement, securityParams, error) {
+
+	var params securityParams
+	msg, _, err := decodeTLV(response)
+	if err != nil {
+		return berElement{}, params, err
+	}
+	fields, err := decodeSequence(msg.content, tagInteger, tagSequence, tagOctetString, 0)
+	if err != nil {
+		return berElement{}, params, err
+	}
+	if version, err := decodeInt(fields[0].content); err != nil || version != 3 {
+		return berElement{}, params, fmt.Errorf("%w: not an snmpv3 message", ErrBadResponse)
+	}
+	header, err := decodeSequence(fields[1].content, tagInteger, tagInteger, tagOctetString, tagInteger)
+	if err != nil {
+		return berElement{}, params, err
+	}
+	if len(header[2].content) != 1 {
+		return berElement{}, params, fmt.Errorf("%w: bad flags", ErrBadResponse)
+	}
+	flags := header[2].content[0]
+
+	secSequence, _, err := decodeTLV(fields[2].content)
+	if err != nil {
+		return berElement{}, params, err
+	}
+	sec, err := decodeSequence(
+		secSequence.content,
+		tagOctetString, tagInteger, tagInteger, tagOctetString, tagOctetString, tagOctetString,
+	)
+	if err != nil {
+		return berElement{}, params, err
+	}
+	params.engineID, params.user = sec[0].content, sec[3].content
+	params.authParams, params.privParams = sec[4].content, sec[5].content
+	if params.boots, err = decodeInt(sec[1].content); err != nil {
+		return berElement{}, params, err
+	}
+	if params.time, err = decodeInt(sec[2].content); err != nil {
+		return berElement{}, params, err
+	}
+
+	if e != nil && flags&flagAuth != 0 {
+		if len(params.authParams) != authParamsLen {
+			return berElement{}, params, ErrAuthFailure
+		}
+		// the authentication parameters reference the response, which is not reused
+		offset := cap(response) - cap(params.authParams)
+		zeroed := append([]byte(nil), response...)
+		copy(zeroed[offset:offset+authParamsLen], make([]byte, authParamsLen))
+		if !hmac.Equal(params.authParams, authenticate(s.usm.hash(), e.authKey, zeroed)) {
+			return berElement{}, params, ErrAuthFailure
+		}
+	}
+
+	scoped := fields[3]
+	if flags&flagPriv != 0 {
+		if e == nil || e.privKey == nil || scoped.tag != tagOctetString || len(params.privParams) != 8 {
+			return berElement{}, params, fmt.Errorf("%w: cannot decrypt response", ErrBadResponse)
+		}
+		plain := append([]byte(nil), scoped.content...)
+		iv := aesIV(params.boots, params.time, params.privParams)
+		if err := aesCFB(e.privKey, iv, plain, false); err != nil {
+			return berElement{}, params, err
+		}
+		if scoped, _, err = decodeTLV(plain); err != nil {
+			return berElement{}, params, err
+		}
+	}
+	if scoped.tag != tagSequence {
+		return berElement{}, params, fmt.Errorf("%w: bad scoped pdu", ErrBadResponse)
+	}
+	scopedFields, err := decodeSequence(scoped.content, tagOctetString, tagOctetString, 0)
+	if err != nil {
+		return berElement{}, params, err
+	}
+	pdu := scopedFields[2]
+	if e != nil && s.usm.flags()&flagAuth != 0 && flags&flagAuth == 0 && pdu.tag != tagReport {
+		return berElement{}, params, fmt.Errorf("%w: response is not authenticated", ErrAuthFailure)
+	}
+	return pdu, params, nil
+}
@@ -0,0 +1,76 @@
+package heatsink
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// compile-time check for interface implementation
+var _ dutyCycler = (*dutyCyclerStepped)(nil)
+
+// Step is a discrete duty cycle that applies while the temperature is above a threshold
+type Step struct {
+	// AboveTemp is the temperature above which this step applies, unless a higher one does
+	AboveTemp float64
+	// DutyCycle is the ratio of this step, which is clamped to [0,1]
+	DutyCycle float64
+}
+
+// dutyCyclerStepped moves the duty cycle between discrete steps. It only moves to another step
+// after the temperature stayed within that step's band for the dwell time, which avoids rapid
+// transitions while the temperature hovers around a threshold
+type dutyCyclerStepped struct {
+	steps        []Step
+	dwell        time.Duration
+	now          func() time.Time
+	current      float64
+	started      bool
+	pending      float64
+	pendingSince time.Time
+}
+
+func newDutyCyclerStepped(steps []Step, dwell time.Duration) *dutyCyclerStepped {
+	sorted := make([]Step, len(steps))
+	for i, step := range steps {
+		step.DutyCycle = math.Max(0, math.Min(1, step.DutyCycle))
+		sorted[i] = step
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].AboveTemp < sorted[j].AboveTemp })
+	return &dutyCyclerStepped{steps: sorted, dwell: dwell, now: time.Now}
+}
+
+// level returns the duty cycle of the highest step whose threshold the given temperature is
+// above, or zero if there is none
+func (dc *dutyCyclerStepped) level(temp float64) float64 {
+	level := 0.0
+	for _, step := range dc.steps {
+		if temp <= step.AboveTemp {
+			break
+		}
+		level = step.DutyCycle
+	}
+	return level
+}
+
+func (dc *dutyCyclerStepped) ratio(temp float64) float64 {
+
+	target := dc.level(temp)
+	now := dc.now()
+	if !dc.started {
+		// there is nothing to dwell on before the first check
+		dc.current, dc.started = target, true
+		return dc.current
+	}
+	if target == dc.current {
+		dc.pendingSince = time.Time{}
+		return dc.current
+	}
+	if dc.pendingSince.IsZero() || target != dc.pending {
+		dc.pending, dc.pendingSince = target, now
+	}
+	if now.Sub(dc.pendingSince) >= dc.dwell {
+		dc.current, dc.pendingSince = target, time.Time{}
+	}
+	return dc.current
+}
@@ -0,0 +1,56 @@
+package heatsink
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDutyCycler_Stepped(t *testing.T) {
+	t.Parallel()
+
+	dc := newDutyCyclerStepped(
+		[]Step{{AboveTemp: 60, DutyCycle: 0.6}, {AboveTemp: 40, DutyCycle: 0.3}, {AboveTemp: 75, DutyCycle: 2}},
+		10*time.Second,
+	)
+	start := time.Unix(0, 0)
+
+	steps := []struct {
+		temp     float64
+		at       time.Duration
+		expected float64
+	}{
+		{temp: 45, at: 0, expected: 0.3},                // the first check needs no dwelling
+		{temp: 65, at: 5 * time.Second, expected: 0.3},  // starts dwelling on the next step
+		{temp: 45, at: 8 * time.Second, expected: 0.3},  // back in the current band
+		{temp: 65, at: 10 * time.Second, expected: 0.3}, // dwelling restarts
+		{temp: 64, at: 19 * time.Second, expected: 0.3}, // still dwelling
+		{temp: 61, at: 20 * time.Second, expected: 0.6}, // dwelled long enough
+		{temp: 80, at: 25 * time.Second, expected: 0.6}, // dwelling on the clamped top step
+		{temp: 35, at: 30 * time.Second, expected: 0.6}, // another band restarts dwelling
+		{temp: 40, at: 40 * time.Second, expected: 0.0}, // not above the lowest step
+		{temp: 80, at: 45 * time.Second, expected: 0.0},
+		{temp: 90, at: 55 * time.Second, expected: 1.0},
+	}
+	for i, step := range steps {
+		now := start.Add(step.at)
+		dc.now = func() time.Time { return now }
+		if actual := dc.ratio(step.temp); actual != step.expected {
+			t.Errorf("step %d: unexpected duty cycle\nwant: %.2f\n got: %.2f", i, step.expected, actual)
+		}
+	}
+}
+
+func TestOptSteps_ignoresInvalid(t *testing.T) {
+	t.Parallel()
+
+	hs := &Heatsink{}
+	OptSteps(nil, time.Second)(nil, hs)
+	OptSteps([]Step{{AboveTemp: 40, DutyCycle: 0.5}}, -time.Second)(nil, hs)
+	if hs.dcCalc != nil {
+		t.Fatalf("expected invalid steps to be ignored, got: %+v", hs.dcCalc)
+	}
+	OptSteps([]Step{{AboveTemp: 40, DutyCycle: 0.5}}, 0)(nil, hs)
+	if _, ok := hs.dcCalc.(*dutyCyclerStepped); !ok {
+		t.Fatalf("expected a stepped duty cycler, got: %T", hs.dcCalc)
+	}
+}
@@ -0,0 +1,78 @@
+package heatsink
+
+import (
+	"math"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// summary aggregates the samples of consecutive control iterations so they can be logged
+// periodically as a single entry instead of one entry per iteration
+type summary struct {
+	everyN      int
+	period      time.Duration
+	start       time.Time
+	count       int
+	minTemp     float64
+	maxTemp     float64
+	sumTemp     float64
+	minDC       float64
+	maxDC       float64
+	sumDC       float64
+	lastHottest string
+}
+
+// add aggregates the given sample and reports whether a summary is due, i.e. whether the
+// configured number of iterations was reached or the configured period elapsed
+func (s *summary) add(smpl Sample) (due bool) {
+
+	if s.count == 0 {
+		s.start = smpl.Time
+		s.minTemp, s.maxTemp = math.Inf(1), math.Inf(-1)
+		s.minDC, s.maxDC = math.Inf(1), math.Inf(-1)
+		s.sumTemp, s.sumDC = 0, 0
+	}
+	s.count++
+	s.minTemp, s.maxTemp = math.Min(s.minTemp, smpl.Temperature), math.Max(s.maxTemp, smpl.Temperature)
+	s.minDC, s.maxDC = math.Min(s.minDC, smpl.DutyCycle), math.Max(s.maxDC, smpl.DutyCycle)
+	s.sumTemp += smpl.Temperature
+	s.sumDC += smpl.DutyCycle
+	s.lastHottest = smpl.Sensor
+
+	if s.everyN > 0 && s.count >= s.everyN {
+		return true
+	}
+	return s.period > 0 && smpl.Time.Sub(s.start) >= s.period
+}
+
+// flush returns the log fields describing the aggregated samples and starts a new window
+func (s *summary) flush(now time.Time) []zap.Field {
+	n := float64(s.count)
+	fields := []zap.Field{
+		zap.Int("iterations", s.count),
+		zap.Duration("window", now.Sub(s.start)),
+		zap.Float64("temperature_min", s.minTemp),
+		zap.Float64("temperature_avg", s.sumTemp/n),
+		zap.Float64("temperature_max", s.maxTemp),
+		zap.Float64("duty_cycle_min", s.minDC),
+		zap.Float64("duty_cycle_avg", s.sumDC/n),
+		zap.Float64("duty_cycle_max", s.maxDC),
+		zap.String("last_hottest_sensor", s.lastHottest),
+	}
+	s.count = 0
+	return fields
+}
+
+// logSummary aggregates the given sample and logs a summary at info level when it is due. It
+// is a no-op if periodic summaries are disabled
+func (hs *Heatsink) logSummary(smpl Sample) {
+	if hs.summary == nil || !hs.summary.add(smpl) {
+		return
+	}
+	fields := append(
+		[]zap.Field{zap.String("event", "summary"), zap.String("heatsink_name", hs.name)},
+		hs.summary.flush(smpl.Time)...,
+	)
+	hs.logger.Info("thermal control summary", fields...)
+}
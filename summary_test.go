@@ -0,0 +1,92 @@
+package heatsink
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestHeatsink_logSummary(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name       string
+		iterations int
+		period     time.Duration
+		expected   []int // iteration counts of the logged summaries
+	}{
+		{"iterations", 2, 0, []int{2, 2}},
+		{"period", 0, 2 * time.Second, []int{3}},
+		{"first-wins", 4, 2 * time.Second, []int{3}},
+		{"disabled", 0, 0, nil},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			core, logs := observer.New(zapcore.InfoLevel)
+			hs := &Heatsink{name: "hs", logger: zap.New(core)}
+			OptPeriodicSummary(tc.iterations, tc.period)(nil, hs)
+
+			start := time.Unix(0, 0)
+			for i := range iter(5) {
+				hs.logSummary(Sample{
+					Time:        start.Add(time.Duration(i) * time.Second),
+					Temperature: float64(40 + i),
+					DutyCycle:   0.1 * float64(i),
+				})
+			}
+
+			var actual []int
+			for _, entry := range logs.FilterMessage("thermal control summary").AllUntimed() {
+				actual = append(actual, int(entry.ContextMap()["iterations"].(int64)))
+			}
+			if diff := deep.Equal(actual, tc.expected); diff != nil {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestHeatsink_logSummary_fields(t *testing.T) {
+	t.Parallel()
+
+	core, logs := observer.New(zapcore.InfoLevel)
+	hs := &Heatsink{name: "hs", logger: zap.New(core)}
+	OptPeriodicSummary(3, 0)(nil, hs)
+
+	start := time.Unix(0, 0)
+	samples := []Sample{
+		{Time: start, Sensor: "core0", Temperature: 40, DutyCycle: 0.2},
+		{Time: start.Add(time.Second), Sensor: "core1", Temperature: 50, DutyCycle: 0.6},
+		{Time: start.Add(2 * time.Second), Sensor: "core0", Temperature: 45, DutyCycle: 0.4},
+	}
+	for _, smpl := range samples {
+		hs.logSummary(smpl)
+	}
+
+	entries := logs.AllUntimed()
+	if len(entries) != 1 {
+		t.Fatalf("expected exactly one summary, got: %v", entries)
+	}
+	expected := map[string]interface{}{
+		"event":               "summary",
+		"heatsink_name":       "hs",
+		"iterations":          int64(3),
+		"window":              2 * time.Second,
+		"temperature_min":     40.0,
+		"temperature_avg":     45.0,
+		"temperature_max":     50.0,
+		"duty_cycle_min":      0.2,
+		"duty_cycle_avg":      0.4,
+		"duty_cycle_max":      0.6,
+		"last_hottest_sensor": "core0",
+	}
+	if diff := deep.Equal(entries[0].ContextMap(), expected); diff != nil {
+		t.Fatal(diff)
+	}
+}
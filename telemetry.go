@@ -0,0 +1,43 @@
+package heatsink
+
+import (
+	"math"
+	"time"
+)
+
+// sampleFilter decides which samples are passed to the sample handler. It passes a sample if
+// the temperature or the duty cycle changed beyond their deltas since the last passed sample,
+// or if the heartbeat interval elapsed since then. The first sample is always passed
+type sampleFilter struct {
+	tempDelta float64
+	dcDelta   float64
+	heartbeat time.Duration
+	last      Sample
+	passed    bool
+}
+
+func (f *sampleFilter) pass(smpl Sample) bool {
+
+	switch {
+	case !f.passed:
+	case f.tempDelta > 0 && math.Abs(smpl.Temperature-f.last.Temperature) >= f.tempDelta:
+	case f.dcDelta > 0 && math.Abs(smpl.DutyCycle-f.last.DutyCycle) >= f.dcDelta:
+	case f.heartbeat > 0 && smpl.Time.Sub(f.last.Time) >= f.heartbeat:
+	default:
+		return false
+	}
+
+	f.last, f.passed = smpl, true
+	return true
+}
+
+// emitSample passes the given sample to the sample handler, if any, unless it is filtered out
+func (hs *Heatsink) emitSample(smpl Sample) {
+	if hs.onSample == nil {
+		return
+	}
+	if hs.smplFilter != nil && !hs.smplFilter.pass(smpl) {
+		return
+	}
+	hs.onSample(smpl)
+}
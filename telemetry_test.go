@@ -0,0 +1,112 @@
+package heatsink
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+)
+
+func TestHeatsink_emitSample(t *testing.T) {
+	t.Parallel()
+
+	start := time.Unix(0, 0)
+	samples := []Sample{
+		{Time: start, Temperature: 40.0, DutyCycle: 0.30},
+		{Time: start.Add(1 * time.Second), Temperature: 40.2, DutyCycle: 0.31},
+		{Time: start.Add(2 * time.Second), Temperature: 41.0, DutyCycle: 0.31},
+		{Time: start.Add(3 * time.Second), Temperature: 41.1, DutyCycle: 0.40},
+		{Time: start.Add(4 * time.Second), Temperature: 41.1, DutyCycle: 0.40},
+		{Time: start.Add(9 * time.Second), Temperature: 41.1, DutyCycle: 0.40},
+	}
+
+	testCases := []struct {
+		name     string
+		option   Option
+		expected []int // indices of the emitted samples
+	}{
+		{"unfiltered", nil, []int{0, 1, 2, 3, 4, 5}},
+		{"all-disabled", OptSampleDeltas(0, 0, 0), []int{0, 1, 2, 3, 4, 5}},
+		{"temperature", OptSampleDeltas(0.5, 0, 0), []int{0, 2}},
+		{"duty-cycle", OptSampleDeltas(0, 0.05, 0), []int{0, 3}},
+		{"heartbeat", OptSampleDeltas(0, 0, 4*time.Second), []int{0, 4, 5}},
+		{"combined", OptSampleDeltas(0.5, 0.05, 4*time.Second), []int{0, 2, 3, 5}},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var actual []Sample
+			hs := &Heatsink{}
+			OptSampleHandler(func(s Sample) { actual = append(actual, s) })(nil, hs)
+			if tc.option != nil {
+				tc.option(nil, hs)
+			}
+
+			for _, smpl := range samples {
+				hs.emitSample(smpl)
+			}
+
+			var expected []Sample
+			for _, i := range tc.expected {
+				expected = append(expected, samples[i])
+			}
+			if diff := deep.Equal(actual, expected); diff != nil {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestHeatsink_StartThermalControl_emitsSamples(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mutex   sync.Mutex
+		emitted []Sample
+	)
+	config := &Config{
+		Fan:            &fakeFanDriver{},
+		Sensors:        []ThermoSensor{&fakeThermoSensor{onName: "core0", onTemperatureVals: []float64{40}}},
+		MinTemperature: 35,
+		MaxTemperature: 45,
+	}
+	hs, err := New(
+		config,
+		OptTemperatureCheckPeriod(time.Millisecond),
+		OptSampleHandler(func(s Sample) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			emitted = append(emitted, s)
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		_ = hs.StartThermalControl()
+	}()
+	defer hs.StopThermalControl()
+
+	for deadline := time.After(time.Second); ; {
+		mutex.Lock()
+		n := len(emitted)
+		mutex.Unlock()
+		if n > 0 {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatal("timeout waiting for a sample to be emitted")
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if expected, actual := "core0", emitted[0].Sensor; actual != expected {
+		t.Fatalf("unexpected sensor in the emitted sample\nwant: %s\n got: %s", expected, actual)
+	}
+}
@@ -2,8 +2,10 @@ package thermosense
 
 import (
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -40,7 +42,7 @@ func (ff *fakeFile) Read(b []byte) (_ int, err error) {
 	return
 }
 
-func temporaryFile(t *testing.T) (file *os.File, cleanup func()) {
+func temporaryFile(t testing.TB) (file *os.File, cleanup func()) {
 	t.Helper()
 
 	tmpFile, err := ioutil.TempFile("", t.Name()+"-")
@@ -65,3 +67,31 @@ func temporaryFile(t *testing.T) (file *os.File, cleanup func()) {
 func iter(n int) []struct{} {
 	return make([]struct{}, n)
 }
+
+// fakeThermalClass creates a directory that looks like /sys/class/thermal with one zone per
+// given zone, whose files are named after the map keys
+func fakeThermalClass(t *testing.T, zones ...map[string]string) (dir string, cleanup func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "thermal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+
+	for i, files := range zones {
+		zoneDir := filepath.Join(dir, fmt.Sprintf("thermal_zone%d", i))
+		if err := os.Mkdir(zoneDir, 0700); err != nil {
+			cleanup()
+			t.Fatal(err)
+		}
+		for filename, content := range files {
+			err := ioutil.WriteFile(filepath.Join(zoneDir, filename), []byte(content+"\n"), 0600)
+			if err != nil {
+				cleanup()
+				t.Fatal(err)
+			}
+		}
+	}
+	return dir, cleanup
+}
@@ -0,0 +1,62 @@
+package thermosense
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+)
+
+var (
+	// ErrNotHwmonInput is returned when a file is not a hwmon temperature input, tempN_input
+	ErrNotHwmonInput = errors.New("not a hwmon temperature input")
+	// ErrBadHwmonLimit is returned when a limit of a hwmon temperature input cannot be parsed
+	ErrBadHwmonLimit = errors.New("malformed hwmon temperature limit")
+)
+
+var hwmonInputRegexp = regexp.MustCompile(`^temp(\d+)_input$`)
+
+// HwmonLimits are the temperatures, in degrees celsius, that a hwmon chip reports as the limits
+// of one of its temperature inputs. A limit that the chip does not report is zero
+type HwmonLimits struct {
+	// Max is the temperature above which the chip considers the input too hot, tempN_max
+	Max float64
+	// Critical is the temperature at which the chip expects the hardware to be in danger,
+	// tempN_crit
+	Critical float64
+}
+
+// ReadHwmonLimits returns the limits that are reported next to the given temperature input,
+// e.g. '/sys/class/hwmon/hwmon1/temp2_max' and '/sys/class/hwmon/hwmon1/temp2_crit' for
+// '/sys/class/hwmon/hwmon1/temp2_input'. Missing limits are not an error since many chips
+// report only some of them
+func ReadHwmonLimits(inputFile string) (HwmonLimits, error) {
+
+	match := hwmonInputRegexp.FindStringSubmatch(filepath.Base(inputFile))
+	if match == nil {
+		return HwmonLimits{}, fmt.Errorf("%w: '%s'", ErrNotHwmonInput, inputFile)
+	}
+	prefix := filepath.Join(filepath.Dir(inputFile), "temp"+match[1]+"_")
+
+	var limits HwmonLimits
+	for _, limit := range []struct {
+		suffix string
+		value  *float64
+	}{{"max", &limits.Max}, {"crit", &limits.Critical}} {
+		content, err := readTrimmed(prefix + limit.suffix)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return HwmonLimits{}, err
+		}
+		milli, err := strconv.ParseInt(content, 10, 64)
+		if err != nil {
+			return HwmonLimits{}, fmt.Errorf("%w: '%s%s': %v", ErrBadHwmonLimit, prefix, limit.suffix, err)
+		}
+		*limit.value = float64(milli) / 1000
+	}
+	return limits, nil
+}
@@ -0,0 +1,60 @@
+package thermosense
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestReadHwmonLimits(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "hwmon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"temp1_input": "45000",
+		"temp1_max":   "80000",
+		"temp1_crit":  "100000",
+		"temp2_input": "45000",
+		"temp2_crit":  "95500",
+		"temp3_input": "45000",
+		"temp3_max":   "n/a",
+	}
+	for filename, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, filename), []byte(content+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := map[string]struct {
+		filename string
+		expected HwmonLimits
+		err      error
+	}{
+		"both-limits":    {filename: "temp1_input", expected: HwmonLimits{Max: 80, Critical: 100}},
+		"only-critical":  {filename: "temp2_input", expected: HwmonLimits{Critical: 95.5}},
+		"malformed":      {filename: "temp3_input", err: ErrBadHwmonLimit},
+		"not-an-input":   {filename: "temp1_max", err: ErrNotHwmonInput},
+		"missing-limits": {filename: "temp4_input", expected: HwmonLimits{}},
+	}
+	for name, testCase := range cases {
+		testCase := testCase
+		t.Run(name, func(t *testing.T) {
+			actual, err := ReadHwmonLimits(filepath.Join(dir, testCase.filename))
+			if !errors.Is(err, testCase.err) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", testCase.err, err)
+			}
+			if diff := deep.Equal(actual, testCase.expected); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -1,9 +1,12 @@
 package thermosense
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"math"
+	"strconv"
 
 	"github.com/malkhamis/heatsink"
 )
@@ -13,6 +16,12 @@ type rdOnlyFile interface {
 	io.Closer
 }
 
+// maxReadLen is the size of the read buffer of a sensor, which is more than enough for any
+// temperature in millidegree celsius followed by a new line
+const maxReadLen = 32
+
+var errValueTooLong = errors.New("value is too long to be a temperature")
+
 type tempMilliDegCelsius int
 
 func (t tempMilliDegCelsius) degCelsius() float64 {
@@ -33,12 +42,33 @@ func (s *Sensor) temperature() (float64, error) {
 		return math.Inf(1), err
 	}
 
-	var temp tempMilliDegCelsius
-	if _, err := fmt.Fscanf(s.devFile, "%d", &temp); err != nil {
+	val, err := s.read()
+	if err != nil {
+		return math.Inf(1), err
+	}
+	temp, err := strconv.Atoi(string(bytes.TrimSpace(val)))
+	if err != nil {
 		return math.Inf(1), err
 	}
 
-	return temp.degCelsius(), nil
+	return tempMilliDegCelsius(temp).degCelsius(), nil
+}
+
+// read reads the device file into the buffer of the sensor, which is reused for every read to
+// spare the allocations of polling many sensors, and returns the read bytes
+func (s *Sensor) read() ([]byte, error) {
+	n := 0
+	for n < len(s.buf) {
+		m, err := s.devFile.Read(s.buf[n:])
+		n += m
+		if errors.Is(err, io.EOF) || (err == nil && m == 0) {
+			return s.buf[:n], nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, errValueTooLong
 }
 
 func (s *Sensor) close() error {
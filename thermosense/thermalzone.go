@@ -0,0 +1,147 @@
+package thermosense
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrZoneNotFound is returned when no thermal zone has the requested type
+	ErrZoneNotFound = errors.New("no thermal zone of the given type")
+	// ErrZoneAmbiguous is returned when more than one thermal zone has the requested type
+	ErrZoneAmbiguous = errors.New("more than one thermal zone of the given type")
+	// ErrBadTripPoint is returned when a trip point of a thermal zone cannot be parsed
+	ErrBadTripPoint = errors.New("malformed thermal zone trip point")
+)
+
+// Trip point types as reported by the kernel's thermal subsystem
+const (
+	TripActive   = "active"
+	TripPassive  = "passive"
+	TripHot      = "hot"
+	TripCritical = "critical"
+)
+
+// ThermalZone is a thermal zone of the kernel's thermal subsystem, e.g. an ACPI thermal zone
+// or the package of an x86 processor, which are typically found under /sys/class/thermal
+type ThermalZone struct {
+	// Dir is the directory of the zone, e.g. /sys/class/thermal/thermal_zone0
+	Dir string
+	// Type is the kind of the zone, e.g. 'acpitz' or 'x86_pkg_temp'
+	Type string
+	// TripPoints are the temperatures at which the platform expects action to be taken, in the
+	// order the kernel numbers them
+	TripPoints []TripPoint
+}
+
+// TripPoint is a temperature, in degrees celsius, at which the platform expects an action of
+// the given type to be taken, e.g. 'passive' cooling or a 'critical' shutdown
+type TripPoint struct {
+	Type        string
+	Temperature float64
+}
+
+// FindThermalZone returns the only thermal zone under the given directory, which is typically
+// /sys/class/thermal, whose type is the given one. It returns ErrZoneNotFound if there is no
+// such zone and ErrZoneAmbiguous if there are many, e.g. multiple 'acpitz' zones
+func FindThermalZone(classDir, zoneType string) (ThermalZone, error) {
+
+	typeFiles, err := filepath.Glob(filepath.Join(classDir, "thermal_zone*", "type"))
+	if err != nil {
+		return ThermalZone{}, err
+	}
+	sort.Strings(typeFiles)
+
+	var dirs []string
+	for _, typeFile := range typeFiles {
+		actual, err := readTrimmed(typeFile)
+		if err != nil {
+			return ThermalZone{}, err
+		}
+		if actual == zoneType {
+			dirs = append(dirs, filepath.Dir(typeFile))
+		}
+	}
+	switch len(dirs) {
+	case 0:
+		return ThermalZone{}, fmt.Errorf("%w: '%s' in '%s'", ErrZoneNotFound, zoneType, classDir)
+	case 1:
+	default:
+		return ThermalZone{}, fmt.Errorf("%w: '%s' is the type of %v", ErrZoneAmbiguous, zoneType, dirs)
+	}
+	return ReadThermalZone(dirs[0])
+}
+
+// ReadThermalZone returns the type and the trip points of the thermal zone in the given
+// directory, e.g. /sys/class/thermal/thermal_zone0
+func ReadThermalZone(dir string) (ThermalZone, error) {
+
+	zoneType, err := readTrimmed(filepath.Join(dir, "type"))
+	if err != nil {
+		return ThermalZone{}, err
+	}
+	zone := ThermalZone{Dir: dir, Type: zoneType}
+
+	for i := 0; ; i++ {
+		prefix := filepath.Join(dir, fmt.Sprintf("trip_point_%d_", i))
+		tripType, err := readTrimmed(prefix + "type")
+		if err != nil {
+			// trip points are numbered contiguously, so the first missing one ends the list
+			break
+		}
+		tripTemp, err := readTrimmed(prefix + "temp")
+		if err != nil {
+			return ThermalZone{}, err
+		}
+		milli, err := strconv.ParseInt(tripTemp, 10, 64)
+		if err != nil {
+			return ThermalZone{}, fmt.Errorf("%w: '%stemp': %v", ErrBadTripPoint, prefix, err)
+		}
+		zone.TripPoints = append(zone.TripPoints, TripPoint{
+			Type:        tripType,
+			Temperature: float64(milli) / 1000,
+		})
+	}
+	return zone, nil
+}
+
+// Trip returns the lowest temperature among the zone's trip points of the given type, and
+// whether there is any. Firmware often reports unused trip points with non-positive
+// temperatures, which are ignored
+func (z ThermalZone) Trip(tripType string) (float64, bool) {
+	var (
+		lowest float64
+		found  bool
+	)
+	for _, tp := range z.TripPoints {
+		if tp.Type != tripType || tp.Temperature <= 0 {
+			continue
+		}
+		if !found || tp.Temperature < lowest {
+			lowest, found = tp.Temperature, true
+		}
+	}
+	return lowest, found
+}
+
+// NewThermalZone returns a new thermal sensor that reads the temperature of the given zone.
+// Unless overridden by an option, the sensor is named after the zone's type
+func NewThermalZone(zone ThermalZone, options ...Option) (*Sensor, error) {
+	return New(
+		filepath.Join(zone.Dir, "temp"),
+		append([]Option{OptName(zone.Type)}, options...)...,
+	)
+}
+
+func readTrimmed(filename string) (string, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(content)), nil
+}
@@ -0,0 +1,122 @@
+package thermosense
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestFindThermalZone(t *testing.T) {
+	t.Parallel()
+
+	classDir, cleanup := fakeThermalClass(t,
+		map[string]string{
+			"type":              "acpitz",
+			"temp":              "27800",
+			"trip_point_0_type": "critical",
+			"trip_point_0_temp": "119000",
+		},
+		map[string]string{
+			"type":              "x86_pkg_temp",
+			"temp":              "45000",
+			"trip_point_0_type": "passive",
+			"trip_point_0_temp": "0",
+			"trip_point_1_type": "passive",
+			"trip_point_1_temp": "95000",
+		},
+	)
+	defer cleanup()
+
+	zone, err := FindThermalZone(classDir, "x86_pkg_temp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := ThermalZone{
+		Dir:  filepath.Join(classDir, "thermal_zone1"),
+		Type: "x86_pkg_temp",
+		TripPoints: []TripPoint{
+			{Type: TripPassive, Temperature: 0},
+			{Type: TripPassive, Temperature: 95},
+		},
+	}
+	if diff := deep.Equal(zone, expected); diff != nil {
+		t.Fatal(diff)
+	}
+	if temp, ok := zone.Trip(TripPassive); !ok || temp != 95 {
+		t.Errorf("unexpected passive trip point\nwant: %v, %v\n got: %v, %v", 95.0, true, temp, ok)
+	}
+	if _, ok := zone.Trip(TripCritical); ok {
+		t.Error("expected no critical trip point")
+	}
+
+	sensor, err := NewThermalZone(zone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sensor.Close()
+	if expected, actual := "x86_pkg_temp", sensor.Name(); expected != actual {
+		t.Errorf("unexpected sensor name\nwant: %s\n got: %s", expected, actual)
+	}
+	temp, err := sensor.Temperature()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if temp != 45 {
+		t.Errorf("unexpected temperature\nwant: %v\n got: %v", 45.0, temp)
+	}
+}
+
+func TestFindThermalZone_errors(t *testing.T) {
+	t.Parallel()
+
+	classDir, cleanup := fakeThermalClass(t,
+		map[string]string{"type": "acpitz"},
+		map[string]string{"type": "acpitz"},
+		map[string]string{
+			"type":              "pch_cannonlake",
+			"trip_point_0_type": "critical",
+			"trip_point_0_temp": "hot",
+		},
+	)
+	defer cleanup()
+
+	cases := map[string]struct {
+		zoneType string
+		expected error
+	}{
+		"not-found":      {zoneType: "x86_pkg_temp", expected: ErrZoneNotFound},
+		"ambiguous":      {zoneType: "acpitz", expected: ErrZoneAmbiguous},
+		"bad-trip-point": {zoneType: "pch_cannonlake", expected: ErrBadTripPoint},
+	}
+	for name, testCase := range cases {
+		testCase := testCase
+		t.Run(name, func(t *testing.T) {
+			_, err := FindThermalZone(classDir, testCase.zoneType)
+			if !errors.Is(err, testCase.expected) {
+				t.Errorf("unexpected error\nwant: %v\n got: %v", testCase.expected, err)
+			}
+		})
+	}
+}
+
+func TestNewThermalZone_optName(t *testing.T) {
+	t.Parallel()
+
+	classDir, cleanup := fakeThermalClass(t, map[string]string{"type": "acpitz", "temp": "30000"})
+	defer cleanup()
+
+	zone, err := ReadThermalZone(filepath.Join(classDir, "thermal_zone0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sensor, err := NewThermalZone(zone, OptName("board"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sensor.Close()
+	if expected, actual := "board", sensor.Name(); expected != actual {
+		t.Errorf("unexpected sensor name\nwant: %s\n got: %s", expected, actual)
+	}
+}
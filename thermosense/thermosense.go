@@ -19,6 +19,7 @@ type Sensor struct {
 	devFile rdOnlyFile `deep:"-"`
 	mutex   sync.Mutex
 	closed  bool
+	buf     [maxReadLen]byte
 }
 
 // New returns a new thermal sensor. The given file should typically represent a digital
@@ -2,7 +2,9 @@ package thermosense
 
 import (
 	"errors"
+	"math"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
@@ -245,3 +247,69 @@ func TestSensor_Close_concurrently_error(t *testing.T) {
 		t.Errorf("expected exactly 999 ErrThermoSensorClosed errors, got: %d", numErrThermoSensorClosed)
 	}
 }
+
+func TestSensor_Temperature_contents(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		contents    string
+		expected    float64
+		expectedErr error
+	}{
+		{contents: "45000\n", expected: 45},
+		{contents: "  -5500 \n", expected: -5.5},
+		{contents: "0", expected: 0},
+		{contents: "", expected: math.Inf(1), expectedErr: strconv.ErrSyntax},
+		{contents: "45.5\n", expected: math.Inf(1), expectedErr: strconv.ErrSyntax},
+		{contents: "99999999999999999999\n", expected: math.Inf(1), expectedErr: strconv.ErrRange},
+		{contents: strings.Repeat("1", maxReadLen), expected: math.Inf(1), expectedErr: errValueTooLong},
+	}
+
+	for _, tc := range testCases {
+		tmpFile, cleanup := temporaryFile(t)
+		defer cleanup()
+		if _, err := tmpFile.WriteString(tc.contents); err != nil {
+			t.Fatal(err)
+		}
+		sensor, err := New(tmpFile.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the second read makes sure the buffer of the first one is not leaked into it
+		for range iter(2) {
+			actual, err := sensor.Temperature()
+			if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("%q: unexpected error\nwant: %v\n got: %v", tc.contents, tc.expectedErr, err)
+			}
+			if actual != tc.expected {
+				t.Errorf("%q: unexpected temperature\nwant: %v\n got: %v", tc.contents, tc.expected, actual)
+			}
+		}
+		if err := sensor.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSensor_Temperature(b *testing.B) {
+
+	tmpFile, cleanup := temporaryFile(b)
+	defer cleanup()
+	if _, err := tmpFile.WriteString("45000\n"); err != nil {
+		b.Fatal(err)
+	}
+	sensor, err := New(tmpFile.Name())
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer sensor.Close()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := sensor.Temperature(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
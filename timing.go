@@ -0,0 +1,159 @@
+package heatsink
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// jitter randomizes the waiting time between temperature checks
+type jitter struct {
+	max time.Duration
+	rnd *rand.Rand
+}
+
+// adaptivePeriod lengthens the check period while the temperature is stable and low
+type adaptivePeriod struct {
+	maxPeriod time.Duration
+	maxRate   float64
+	calmBelow float64
+	current   time.Duration
+	prevTemp  float64
+	prevTime  time.Time
+}
+
+// period returns the current check period, which is the configured one unless it was
+// lengthened by adaptive polling
+func (hs *Heatsink) period() time.Duration {
+	if hs.adaptive == nil {
+		return hs.basePeriod()
+	}
+	return hs.adaptive.current
+}
+
+// adapt doubles the check period, up to the maximum of adaptive polling, if the given absolute
+// temperature is below the calm temperature and changed slower than the maximum rate since the
+// previous check. Otherwise, it restores the configured check period
+func (hs *Heatsink) adapt(temp float64, now time.Time) {
+
+	a := hs.adaptive
+	if a == nil {
+		return
+	}
+	calm := false
+	if elapsed := now.Sub(a.prevTime).Seconds(); !a.prevTime.IsZero() && elapsed > 0 {
+		rate := math.Abs(temp-a.prevTemp) / elapsed
+		calm = temp < a.calmBelow && rate <= a.maxRate
+	}
+	a.prevTemp, a.prevTime = temp, now
+
+	next := hs.basePeriod()
+	if calm {
+		next = 2 * a.current
+		if next > a.maxPeriod {
+			next = a.maxPeriod
+		}
+		if next < a.current {
+			next = a.current
+		}
+	}
+	if next == a.current {
+		return
+	}
+	hs.logger.Debug(
+		"check period changed",
+		zap.String("event", "check_period_change"),
+		zap.String("heatsink_name", hs.name),
+		zap.Duration("from", a.current),
+		zap.Duration("to", next),
+		zap.Float64("temperature", temp),
+	)
+	hs.smplMutex.Lock()
+	a.current = next
+	hs.smplMutex.Unlock()
+}
+
+// nextPeriod returns the waiting time until the next temperature check, which is the current
+// check period shifted randomly by up to the jitter in either direction. The jitter is limited
+// to less than half the current period, which may have been shortened at runtime, so that the
+// waiting time is never cut to nothing
+func (hs *Heatsink) nextPeriod() time.Duration {
+	period := hs.period()
+	if hs.jitter == nil {
+		return period
+	}
+	max := hs.jitter.max
+	if 2*max >= period {
+		max = (period - 1) / 2
+	}
+	if max <= 0 {
+		return period
+	}
+	offset := time.Duration(hs.jitter.rnd.Int63n(int64(2*max)+1)) - max
+	return period + offset
+}
+
+// nextDeadline returns when the temperature check after the one scheduled at the given
+// deadline is due. Deadlines advance by the check period regardless of how long iterations
+// take, so the loop does not drift. If the next deadline already passed at the given time, an
+// overrun is logged and counted, and the next check is either due right away if catching up is
+// enabled or, otherwise, the missed checks are skipped and the next one is due at the following
+// multiple of the check period
+func (hs *Heatsink) nextDeadline(deadline, now time.Time) time.Time {
+	deadline = deadline.Add(hs.nextPeriod())
+	if deadline.After(now) {
+		return deadline
+	}
+	period := hs.period()
+	missed := now.Sub(deadline)/period + 1
+	hs.smplMutex.Lock()
+	hs.overruns++
+	hs.smplMutex.Unlock()
+
+	hs.logger.Warn(
+		"control iteration overran the check period",
+		zap.String("event", "iteration_overrun"),
+		zap.String("heatsink_name", hs.name),
+		zap.Duration("check_period", period),
+		zap.Duration("late_by", now.Sub(deadline)),
+		zap.Int64("missed_checks", int64(missed)),
+		zap.Bool("catch_up", hs.catchUp),
+	)
+	if hs.catchUp {
+		return now
+	}
+	return deadline.Add(missed * period)
+}
+
+// sleepUntil waits until the given deadline. It returns false if the heatsink was stopped while
+// waiting
+func (hs *Heatsink) sleepUntil(deadline time.Time) bool {
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	select {
+	case <-hs.isStopped:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// Overruns returns how many times a control iteration took so long that the next temperature
+// check was already due when it completed. It is safe to call it concurrently with thermal
+// control
+func (hs *Heatsink) Overruns() uint64 {
+	hs.smplMutex.RLock()
+	defer hs.smplMutex.RUnlock()
+	return hs.overruns
+}
+
+// waitPhaseOffset delays the first temperature check by the phase offset, if any. It returns
+// false if the heatsink was stopped while waiting
+func (hs *Heatsink) waitPhaseOffset() bool {
+	if hs.phaseOffset <= 0 {
+		return true
+	}
+	return hs.sleepUntil(time.Now().Add(hs.phaseOffset))
+}
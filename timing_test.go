@@ -0,0 +1,201 @@
+package heatsink
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestHeatsink_nextPeriod(t *testing.T) {
+	t.Parallel()
+
+	hs := &Heatsink{chkPeriod: time.Second}
+	if actual := hs.nextPeriod(); actual != time.Second {
+		t.Fatalf("unexpected period without jitter\nwant: %v\n got: %v", time.Second, actual)
+	}
+
+	OptCheckPeriodJitter(0)(nil, hs)
+	if hs.jitter != nil {
+		t.Fatalf("expected a non-positive jitter to be ignored, got: %+v", hs.jitter)
+	}
+
+	OptCheckPeriodJitter(200*time.Millisecond)(nil, hs)
+	varied := false
+	for range iter(100) {
+		actual := hs.nextPeriod()
+		if actual < 800*time.Millisecond || actual > 1200*time.Millisecond {
+			t.Fatalf("period out of the jitter's range: %v", actual)
+		}
+		varied = varied || actual != time.Second
+	}
+	if !varied {
+		t.Fatal("expected the period to vary")
+	}
+
+	// a check period shortened at runtime limits the jitter to less than half of it
+	hs.SetCheckPeriod(100 * time.Millisecond)
+	for range iter(100) {
+		if actual := hs.nextPeriod(); actual <= 50*time.Millisecond || actual >= 150*time.Millisecond {
+			t.Fatalf("period out of half the check period: %v", actual)
+		}
+	}
+}
+
+func TestHeatsink_waitPhaseOffset(t *testing.T) {
+	t.Parallel()
+
+	hs := &Heatsink{isStopped: make(chan struct{})}
+	if !hs.waitPhaseOffset() {
+		t.Fatal("expected no waiting without a phase offset")
+	}
+
+	OptPhaseOffset(time.Millisecond)(nil, hs)
+	if !hs.waitPhaseOffset() {
+		t.Fatal("expected waiting to complete")
+	}
+
+	OptPhaseOffset(time.Hour)(nil, hs)
+	close(hs.isStopped)
+	if hs.waitPhaseOffset() {
+		t.Fatal("expected waiting to be interrupted by stopping")
+	}
+}
+
+func TestHeatsink_nextDeadline(t *testing.T) {
+	t.Parallel()
+
+	hs := &Heatsink{chkPeriod: time.Second, logger: zap.NewNop()}
+	start := time.Unix(0, 0)
+
+	steps := []struct {
+		deadline time.Duration
+		now      time.Duration
+		expected time.Duration
+		overruns uint64
+	}{
+		{deadline: 0, now: 300 * time.Millisecond, expected: time.Second},
+		{deadline: time.Second, now: 1999 * time.Millisecond, expected: 2 * time.Second},
+		{deadline: 2 * time.Second, now: 3 * time.Second, expected: 4 * time.Second, overruns: 1},
+		{deadline: 4 * time.Second, now: 7500 * time.Millisecond, expected: 8 * time.Second, overruns: 2},
+	}
+	for i, step := range steps {
+		actual := hs.nextDeadline(start.Add(step.deadline), start.Add(step.now))
+		if expected := start.Add(step.expected); !actual.Equal(expected) {
+			t.Errorf("step %d: unexpected deadline\nwant: %v\n got: %v", i, expected, actual)
+		}
+		if actual := hs.Overruns(); actual != step.overruns {
+			t.Errorf("step %d: unexpected overruns\nwant: %d\n got: %d", i, step.overruns, actual)
+		}
+	}
+}
+
+func TestHeatsink_nextDeadline_catchUp(t *testing.T) {
+	t.Parallel()
+
+	core, logs := observer.New(zapcore.WarnLevel)
+	hs := &Heatsink{chkPeriod: time.Second, logger: zap.New(core)}
+	OptCatchUpOverruns(true)(nil, hs)
+	start := time.Unix(0, 0)
+
+	actual, expected := hs.nextDeadline(start, start.Add(300*time.Millisecond)), start.Add(time.Second)
+	if !actual.Equal(expected) {
+		t.Errorf("unexpected deadline without an overrun\nwant: %v\n got: %v", expected, actual)
+	}
+	now := start.Add(3500 * time.Millisecond)
+	if actual := hs.nextDeadline(start, now); !actual.Equal(now) {
+		t.Errorf("unexpected deadline after an overrun\nwant: %v\n got: %v", now, actual)
+	}
+	if actual := hs.Overruns(); actual != 1 {
+		t.Errorf("unexpected overruns\nwant: %d\n got: %d", 1, actual)
+	}
+
+	entries := logs.FilterField(zap.String("event", "iteration_overrun")).AllUntimed()
+	if len(entries) != 1 {
+		t.Fatalf("expected exactly one overrun to be logged, got: %d", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	if expected, actual := int64(3), fields["missed_checks"]; expected != actual {
+		t.Errorf("unexpected missed checks\nwant: %v\n got: %v", expected, actual)
+	}
+	if expected, actual := 2500*time.Millisecond, fields["late_by"]; expected != actual {
+		t.Errorf("unexpected lateness\nwant: %v\n got: %v", expected, actual)
+	}
+}
+
+func TestHeatsink_sleepUntil(t *testing.T) {
+	t.Parallel()
+
+	hs := &Heatsink{isStopped: make(chan struct{})}
+	if !hs.sleepUntil(time.Now().Add(-time.Second)) {
+		t.Fatal("expected a past deadline not to be interrupted")
+	}
+	close(hs.isStopped)
+	if hs.sleepUntil(time.Now().Add(time.Hour)) {
+		t.Fatal("expected sleeping to be interrupted by stopping")
+	}
+}
+
+func TestHeatsink_adapt(t *testing.T) {
+	t.Parallel()
+
+	hs, err := New(
+		&Config{Fan: &fakeFanDriver{}, Sensors: []ThermoSensor{&fakeThermoSensor{}}, MinTemperature: 40, MaxTemperature: 80},
+		OptAdaptiveCheckPeriod(5*time.Second, 0.5, 60),
+		OptTemperatureCheckPeriod(time.Second),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Unix(0, 0)
+
+	steps := []struct {
+		temp     float64
+		at       time.Duration
+		expected time.Duration
+	}{
+		{temp: 45, at: 0, expected: time.Second}, // no previous temperature
+		{temp: 45, at: time.Second, expected: 2 * time.Second},
+		{temp: 46, at: 3 * time.Second, expected: 4 * time.Second},
+		{temp: 46, at: 7 * time.Second, expected: 5 * time.Second}, // up to the maximum
+		{temp: 46, at: 12 * time.Second, expected: 5 * time.Second},
+		{temp: 50, at: 17 * time.Second, expected: time.Second}, // changing rapidly
+		{temp: 50, at: 18 * time.Second, expected: 2 * time.Second},
+		{temp: 61, at: 40 * time.Second, expected: time.Second}, // not low
+	}
+	for i, step := range steps {
+		hs.adapt(step.temp, start.Add(step.at))
+		if actual := hs.CheckPeriod(); actual != step.expected {
+			t.Errorf("step %d: unexpected check period\nwant: %v\n got: %v", i, step.expected, actual)
+		}
+	}
+}
+
+func TestOptAdaptiveCheckPeriod_defaultCalmTemperature(t *testing.T) {
+	t.Parallel()
+
+	hs, err := New(
+		&Config{Fan: &fakeFanDriver{}, Sensors: []ThermoSensor{&fakeThermoSensor{}}, MinTemperature: 40, MaxTemperature: 80},
+		OptAdaptiveCheckPeriod(0, 1, 0),
+		OptAdaptiveCheckPeriod(time.Minute, -1, 0),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hs.adaptive != nil {
+		t.Fatalf("expected invalid adaptive polling to be ignored, got: %+v", hs.adaptive)
+	}
+
+	hs, err = New(
+		&Config{Fan: &fakeFanDriver{}, Sensors: []ThermoSensor{&fakeThermoSensor{}}, MinTemperature: 40, MaxTemperature: 80},
+		OptAdaptiveCheckPeriod(time.Minute, 1, 0),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual := hs.adaptive.calmBelow; actual != 80 {
+		t.Fatalf("unexpected calm temperature\nwant: %v\n got: %v", 80, actual)
+	}
+}
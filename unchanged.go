@@ -0,0 +1,42 @@
+package heatsink
+
+import (
+	"math"
+	"time"
+)
+
+// dutyCycleSkip tracks the duty cycle that was last applied to the fan, so that applying a
+// duty cycle within epsilon of it can be skipped unless the refresh interval elapsed
+type dutyCycleSkip struct {
+	epsilon   float64
+	refresh   time.Duration
+	applied   float64
+	appliedAt time.Time
+	isApplied bool
+}
+
+// setDutyCycle applies the given duty cycle to the fan unless it is within the epsilon of the
+// last applied one, which spares the fan driver from redoing its work for an unchanged speed.
+// A duty cycle that was guarded, i.e. adjusted by service levels or the critical temperature,
+// is never skipped, and neither is any while the heatsink is critical, since the fan could
+// otherwise be left slower than the guardrail demands. It returns the duty cycle the fan is
+// running at, which is the last applied one if skipped
+func (hs *Heatsink) setDutyCycle(dcRatio float64, now time.Time, guarded bool) (float64, error) {
+
+	s := hs.skipDC
+	if s != nil && s.isApplied && !guarded && !hs.critical &&
+		math.Abs(dcRatio-s.applied) <= s.epsilon && (s.refresh <= 0 || now.Sub(s.appliedAt) < s.refresh) {
+		return s.applied, nil
+	}
+	if err := hs.fan.SetDutyCycle(dcRatio); err != nil {
+		if s != nil {
+			// the fan is in an unknown state, so the next duty cycle must not be skipped
+			s.isApplied = false
+		}
+		return dcRatio, err
+	}
+	if s != nil {
+		s.applied, s.appliedAt, s.isApplied = dcRatio, now, true
+	}
+	return dcRatio, nil
+}
@@ -0,0 +1,151 @@
+package heatsink
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+)
+
+func TestHeatsink_setDutyCycle(t *testing.T) {
+	t.Parallel()
+
+	start := time.Unix(1000, 0)
+	testCases := []struct {
+		name            string
+		option          Option
+		dcRatios        []float64
+		elapsed         []time.Duration
+		expectedSet     []float64
+		expectedApplied []float64
+	}{
+		{
+			name:            "default",
+			dcRatios:        []float64{0.5, 0.5, 0.51, 0.51},
+			elapsed:         []time.Duration{0, time.Second, 2 * time.Second, 2 * time.Minute},
+			expectedSet:     []float64{0.5, 0.51, 0.51},
+			expectedApplied: []float64{0.5, 0.5, 0.51, 0.51},
+		},
+		{
+			name:            "epsilon",
+			option:          OptUnchangedDutyCycle(0.02, 0),
+			dcRatios:        []float64{0.5, 0.51, 0.515, 0.53, 0.53},
+			elapsed:         []time.Duration{0, time.Second, 2 * time.Second, 3 * time.Second, time.Hour},
+			expectedSet:     []float64{0.5, 0.53},
+			expectedApplied: []float64{0.5, 0.5, 0.5, 0.53, 0.53},
+		},
+		{
+			name:            "disabled",
+			option:          OptUnchangedDutyCycle(-1, 0),
+			dcRatios:        []float64{0.5, 0.5},
+			elapsed:         []time.Duration{0, time.Second},
+			expectedSet:     []float64{0.5, 0.5},
+			expectedApplied: []float64{0.5, 0.5},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			fanDriver := &fakeFanDriver{}
+			config := &Config{
+				Fan:            fanDriver,
+				Sensors:        []ThermoSensor{&fakeThermoSensor{}},
+				MinTemperature: 35,
+				MaxTemperature: 45,
+			}
+			hs, err := New(config, tc.option)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var applied []float64
+			for i, dcRatio := range tc.dcRatios {
+				actual, err := hs.setDutyCycle(dcRatio, start.Add(tc.elapsed[i]), false)
+				if err != nil {
+					t.Fatal(err)
+				}
+				applied = append(applied, actual)
+			}
+			if diff := deep.Equal(fanDriver.argSetDutyCycle, tc.expectedSet); diff != nil {
+				t.Error(diff)
+			}
+			if diff := deep.Equal(applied, tc.expectedApplied); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestHeatsink_setDutyCycle_errFanDriver(t *testing.T) {
+	t.Parallel()
+
+	simulatedErr := errors.New("simulated error")
+	fanDriver := &fakeFanDriver{onSetDutyCycleErrs: []error{nil, simulatedErr}}
+	config := &Config{
+		Fan:            fanDriver,
+		Sensors:        []ThermoSensor{&fakeThermoSensor{}},
+		MinTemperature: 35,
+		MaxTemperature: 45,
+	}
+	hs, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	if _, err := hs.setDutyCycle(0.5, now, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hs.setDutyCycle(0.7, now, false); !errors.Is(err, simulatedErr) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", simulatedErr, err)
+	}
+	// the fan is in an unknown state after a failure, so the same duty cycle is not skipped
+	if _, err := hs.setDutyCycle(0.5, now, false); err != nil {
+		t.Fatal(err)
+	}
+	expected := []float64{0.5, 0.7, 0.5}
+	if diff := deep.Equal(fanDriver.argSetDutyCycle, expected); diff != nil {
+		t.Fatal(diff)
+	}
+}
+
+func TestHeatsink_setDutyCycle_guardrails(t *testing.T) {
+	t.Parallel()
+
+	fanDriver := &fakeFanDriver{}
+	config := &Config{
+		Fan:            fanDriver,
+		Sensors:        []ThermoSensor{&fakeThermoSensor{}},
+		MinTemperature: 35,
+		MaxTemperature: 45,
+	}
+	hs, err := New(config, OptUnchangedDutyCycle(0.1, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	if _, err := hs.setDutyCycle(0.5, now, false); err != nil {
+		t.Fatal(err)
+	}
+	// a duty cycle raised by a guardrail is applied even if within the epsilon
+	if _, err := hs.setDutyCycle(0.55, now, true); err != nil {
+		t.Fatal(err)
+	}
+	hs.critical = true
+	if _, err := hs.setDutyCycle(0.6, now, false); err != nil {
+		t.Fatal(err)
+	}
+	hs.critical = false
+	if _, err := hs.setDutyCycle(0.65, now, false); err != nil {
+		t.Fatal(err)
+	}
+	expected := []float64{0.5, 0.55, 0.6}
+	if diff := deep.Equal(fanDriver.argSetDutyCycle, expected); diff != nil {
+		t.Fatal(diff)
+	}
+}
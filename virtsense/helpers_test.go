@@ -0,0 +1,34 @@
+package virtsense
+
+import (
+	"sync"
+
+	"github.com/malkhamis/heatsink"
+)
+
+var _ heatsink.ThermoSensor = (*fakeThermoSensor)(nil)
+
+type fakeThermoSensor struct {
+	onTemperatureVal float64
+	onTemperatureErr error
+	onCloseErr       error
+	numCloseCalls    int
+	mutex            sync.Mutex
+}
+
+func (fts *fakeThermoSensor) Temperature() (float64, error) {
+	fts.mutex.Lock()
+	defer fts.mutex.Unlock()
+	return fts.onTemperatureVal, fts.onTemperatureErr
+}
+
+func (fts *fakeThermoSensor) Close() error {
+	fts.mutex.Lock()
+	defer fts.mutex.Unlock()
+	fts.numCloseCalls++
+	return fts.onCloseErr
+}
+
+func (fts *fakeThermoSensor) Name() string {
+	return "fake"
+}
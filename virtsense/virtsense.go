@@ -0,0 +1,121 @@
+// Package virtsense provides a virtual implementation of the heatsink.ThermoSensor interface
+// whose temperature is computed from other sensors using an arithmetic expression
+package virtsense
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/malkhamis/heatsink"
+	"github.com/malkhamis/heatsink/expr"
+)
+
+// compile-time check for interface implementation and dependency inversion
+var _ heatsink.ThermoSensor = (*Sensor)(nil)
+
+// Sentinel errors that are wrapped and returned by this package
+var (
+	ErrUnknownInput = errors.New("expression references an unknown input sensor")
+)
+
+// Sensor is a virtual thermal sensor whose temperature is the result of evaluating an
+// expression over the temperatures of other sensors, e.g. "cpu_package - ambient". Instances
+// of this type are safe for concurrent use
+type Sensor struct {
+	name   string
+	expr   *expr.Expr
+	inputs map[string]heatsink.ThermoSensor
+	mutex  sync.Mutex
+	closed bool
+}
+
+// New returns a new virtual sensor that evaluates the given expression. Each variable in the
+// expression must be a key in inputs, which maps variable names to the sensors that provide
+// their values. The returned sensor takes ownership of the referenced input sensors and
+// closes them when Close() is called. For details about the expression syntax, see
+// expr.Parse. For details about options and defaults, see the documentation for type 'Option'
+func New(expression string, inputs map[string]heatsink.ThermoSensor, options ...Option) (*Sensor, error) {
+
+	compiled, err := expr.Parse(expression)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", expression, err)
+	}
+
+	referenced := make(map[string]heatsink.ThermoSensor)
+	for _, v := range compiled.Vars() {
+		input, ok := inputs[v]
+		if !ok || input == nil {
+			return nil, fmt.Errorf("%w: '%s'", ErrUnknownInput, v)
+		}
+		referenced[v] = input
+	}
+
+	sensor := &Sensor{
+		name:   expression,
+		expr:   compiled,
+		inputs: referenced,
+	}
+	for _, applyOption := range options {
+		if applyOption == nil {
+			continue
+		}
+		applyOption(sensor)
+	}
+
+	return sensor, nil
+}
+
+// Temperature reads all input sensors and returns the result of evaluating the expression. If
+// the sensor is closed, it returns heatsink.ErrThermoSensorClosed. Concurrent calls to this
+// method by multiple go routines will be serialized
+func (s *Sensor) Temperature() (float64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return math.Inf(1), heatsink.ErrThermoSensorClosed
+	}
+
+	vars := make(map[string]float64, len(s.inputs))
+	for v, input := range s.inputs {
+		temp, err := input.Temperature()
+		if err != nil {
+			return math.Inf(1), fmt.Errorf("input sensor '%s': %w", v, err)
+		}
+		vars[v] = temp
+	}
+
+	temp, err := s.expr.Eval(vars)
+	if err != nil {
+		return math.Inf(1), fmt.Errorf("evaluating %q: %w", s.expr, err)
+	}
+	return temp, nil
+}
+
+// Close closes this sensor as well as all of its input sensors. If the sensor was previously
+// closed, it returns heatsink.ErrThermoSensorClosed. If closing more than one input fails,
+// the first encountered error is returned
+func (s *Sensor) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return heatsink.ErrThermoSensorClosed
+	}
+	s.closed = true
+
+	var firstErr error
+	for v, input := range s.inputs {
+		if err := input.Close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to close input sensor '%s': %w", v, err)
+		}
+	}
+	return firstErr
+}
+
+// Name returns the name of this sensor
+func (s *Sensor) Name() string {
+	return s.name
+}
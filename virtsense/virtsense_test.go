@@ -0,0 +1,114 @@
+package virtsense
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/malkhamis/heatsink"
+	"github.com/malkhamis/heatsink/expr"
+)
+
+func TestSensor(t *testing.T) {
+	t.Parallel()
+
+	cpu := &fakeThermoSensor{onTemperatureVal: 61.5}
+	ambient := &fakeThermoSensor{onTemperatureVal: 24.0}
+	unused := &fakeThermoSensor{}
+	inputs := map[string]heatsink.ThermoSensor{"cpu": cpu, "ambient": ambient, "unused": unused}
+
+	s, err := New("cpu - ambient", inputs, nil, OptName(t.Name()))
+	if err != nil {
+		t.Fatalf("expected no error creating a virtual sensor, got: %v", err)
+	}
+	if s.Name() != t.Name() {
+		t.Errorf("unexpected sensor name\nwant: %q\n got: %q", t.Name(), s.Name())
+	}
+
+	actual, err := s.Temperature()
+	if err != nil {
+		t.Fatalf("expected no error reading temperature, got: %v", err)
+	}
+	if expected := 37.5; expected != actual {
+		t.Fatalf("unexpected temperature\nwant: %.1f\n got: %.1f", expected, actual)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if cpu.numCloseCalls != 1 || ambient.numCloseCalls != 1 {
+		t.Error("expected referenced input sensors to be closed exactly once")
+	}
+	if unused.numCloseCalls != 0 {
+		t.Error("expected unreferenced input sensors not to be closed")
+	}
+	if _, err := s.Temperature(); !errors.Is(err, heatsink.ErrThermoSensorClosed) {
+		t.Errorf("unexpected error\nwant: %v\n got: %v", heatsink.ErrThermoSensorClosed, err)
+	}
+	if err := s.Close(); !errors.Is(err, heatsink.ErrThermoSensorClosed) {
+		t.Errorf("unexpected error\nwant: %v\n got: %v", heatsink.ErrThermoSensorClosed, err)
+	}
+}
+
+func TestNew_defaultName(t *testing.T) {
+	t.Parallel()
+
+	s, err := New("a * 2", map[string]heatsink.ThermoSensor{"a": &fakeThermoSensor{}}, OptName(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "a * 2"; s.Name() != expected {
+		t.Errorf("unexpected sensor name\nwant: %q\n got: %q", expected, s.Name())
+	}
+}
+
+func TestNew_errors(t *testing.T) {
+	t.Parallel()
+
+	_, err := New("a +", nil)
+	if !errors.Is(err, expr.ErrSyntax) {
+		t.Errorf("unexpected error\nwant: %v\n got: %v", expr.ErrSyntax, err)
+	}
+	_, err = New("a - b", map[string]heatsink.ThermoSensor{"a": &fakeThermoSensor{}})
+	if !errors.Is(err, ErrUnknownInput) {
+		t.Errorf("unexpected error\nwant: %v\n got: %v", ErrUnknownInput, err)
+	}
+}
+
+func TestSensor_Temperature_errors(t *testing.T) {
+	t.Parallel()
+
+	simErr := errors.New("simulated error")
+	inputs := map[string]heatsink.ThermoSensor{
+		"a": &fakeThermoSensor{onTemperatureErr: simErr},
+	}
+	s, err := New("a", inputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Temperature(); !errors.Is(err, simErr) {
+		t.Errorf("unexpected error\nwant: %v\n got: %v", simErr, err)
+	}
+
+	inputs = map[string]heatsink.ThermoSensor{"a": &fakeThermoSensor{}}
+	s, err = New("1 / a", inputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Temperature(); !errors.Is(err, expr.ErrDivideByZero) {
+		t.Errorf("unexpected error\nwant: %v\n got: %v", expr.ErrDivideByZero, err)
+	}
+}
+
+func TestSensor_Close_error(t *testing.T) {
+	t.Parallel()
+
+	simErr := errors.New("simulated error")
+	inputs := map[string]heatsink.ThermoSensor{"a": &fakeThermoSensor{onCloseErr: simErr}}
+	s, err := New("a", inputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); !errors.Is(err, simErr) {
+		t.Errorf("unexpected error\nwant: %v\n got: %v", simErr, err)
+	}
+}
@@ -0,0 +1,33 @@
+package wmisense
+
+// WMI namespaces of the supported hardware monitors
+const (
+	NamespaceLibreHardwareMonitor = `root\LibreHardwareMonitor`
+	NamespaceOpenHardwareMonitor  = `root\OpenHardwareMonitor`
+)
+
+// Option is used to pass optional parameters to the Sensor factory function
+type Option func(*Sensor)
+
+// OptName sets the name of the sensor. if name is empty, it is set to the default value
+//
+// (default: identifier)
+func OptName(name string) Option {
+	return func(s *Sensor) {
+		if name != "" {
+			s.name = name
+		}
+	}
+}
+
+// OptNamespace sets the WMI namespace that the sensor is published in, e.g.
+// NamespaceOpenHardwareMonitor. If namespace is empty, it is set to the default value
+//
+// (default: NamespaceLibreHardwareMonitor)
+func OptNamespace(namespace string) Option {
+	return func(s *Sensor) {
+		if namespace != "" {
+			s.namespace = namespace
+		}
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+// +build !windows
+
+package wmisense
+
+func query(namespace, identifier string) (string, error) {
+	return "", ErrUnsupported
+}
@@ -0,0 +1,24 @@
+//go:build windows
+// +build windows
+
+package wmisense
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// query asks powershell for the sensor through the CIM cmdlets, which avoids depending on COM
+// bindings
+func query(namespace, identifier string) (string, error) {
+	script := fmt.Sprintf(
+		`Get-CimInstance -Namespace '%s' -ClassName Sensor -Filter "Identifier='%s'" | `+
+			`ForEach-Object { "$($_.SensorType) $($_.Value)" }`,
+		namespace, identifier,
+	)
+	output, err := exec.Command("powershell.exe", "-NoProfile", "-NonInteractive", "-Command", script).Output()
+	if err != nil {
+		return "", err
+	}
+	return string(output), nil
+}
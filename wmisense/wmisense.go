@@ -0,0 +1,130 @@
+// Package wmisense provides an implementation of the heatsink.ThermoSensor interface for
+// Windows, which reads temperatures that LibreHardwareMonitor or OpenHardwareMonitor publish
+// through WMI. Either program must be running for the sensors to be available. WMI exposes
+// fan controls as read-only sensors, so this package does not provide a fan driver
+package wmisense
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/malkhamis/heatsink"
+)
+
+// compile-time check for interface implementation and dependency inversion
+var _ heatsink.ThermoSensor = (*Sensor)(nil)
+
+// Sentinel errors that are wrapped and returned by this package
+var (
+	ErrUnsupported     = errors.New("wmi sensors are only supported on windows")
+	ErrBadIdentifier   = errors.New("invalid sensor identifier")
+	ErrSensorNotFound  = errors.New("sensor not found in wmi")
+	ErrNotTemperature  = errors.New("sensor is not a temperature sensor")
+	ErrBadSensorOutput = errors.New("unexpected output while querying wmi")
+)
+
+// queryFunc returns the type and value of the sensor with the given identifier in the given
+// namespace, separated by a space, or empty output if there is no such sensor
+type queryFunc func(namespace, identifier string) (string, error)
+
+// Sensor represents a temperature sensor published through WMI. Instances of this type are
+// safe for concurrent use
+type Sensor struct {
+	name       string
+	identifier string
+	namespace  string
+	query      queryFunc `deep:"-"`
+	mutex      sync.Mutex
+	closed     bool
+}
+
+// New returns a new thermal sensor for the given identifier, which is the 'Identifier'
+// property of the sensor as shown by LibreHardwareMonitor, e.g. '/intelcpu/0/temperature/1'.
+// The sensor is queried once to verify that it exists and measures temperature. For details
+// about options and defaults, see the documentation for type 'Option'
+func New(identifier string, options ...Option) (*Sensor, error) {
+	return newSensor(identifier, query, options...)
+}
+
+func newSensor(identifier string, query queryFunc, options ...Option) (*Sensor, error) {
+
+	// the identifier is embedded in a wmi query, so quotes and escapes must not be allowed
+	if identifier == "" || strings.ContainsAny(identifier, "'\"\\`$") {
+		return nil, fmt.Errorf("%w: '%s'", ErrBadIdentifier, identifier)
+	}
+
+	sensor := &Sensor{
+		name:       identifier,
+		identifier: identifier,
+		namespace:  NamespaceLibreHardwareMonitor,
+		query:      query,
+	}
+	for _, applyOption := range options {
+		if applyOption == nil {
+			continue
+		}
+		applyOption(sensor)
+	}
+
+	if _, err := sensor.temperature(); err != nil {
+		return nil, err
+	}
+	return sensor, nil
+}
+
+// Temperature returns the current temperature in degrees celsius as well as any error
+// encountered. If the sensor is closed, it returns heatsink.ErrThermoSensorClosed. Each call
+// spawns a short-lived process, so the sensor should not be read more often than every second
+func (s *Sensor) Temperature() (float64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return math.Inf(1), heatsink.ErrThermoSensorClosed
+	}
+	return s.temperature()
+}
+
+func (s *Sensor) temperature() (float64, error) {
+
+	output, err := s.query(s.namespace, s.identifier)
+	if err != nil {
+		return math.Inf(1), fmt.Errorf("querying '%s': %w", s.identifier, err)
+	}
+	fields := strings.Fields(output)
+	if len(fields) == 0 {
+		return math.Inf(1), fmt.Errorf("%w: '%s' in '%s'", ErrSensorNotFound, s.identifier, s.namespace)
+	}
+	if len(fields) != 2 {
+		return math.Inf(1), fmt.Errorf("%w: '%s'", ErrBadSensorOutput, output)
+	}
+	if fields[0] != "Temperature" {
+		return math.Inf(1), fmt.Errorf("%w: '%s' is of type '%s'", ErrNotTemperature, s.identifier, fields[0])
+	}
+	// the decimal separator depends on the locale of the windows installation
+	temp, err := strconv.ParseFloat(strings.Replace(fields[1], ",", ".", 1), 64)
+	if err != nil {
+		return math.Inf(1), fmt.Errorf("%w: %v", ErrBadSensorOutput, err)
+	}
+	return temp, nil
+}
+
+// Close closes this sensor. If the sensor was previously closed, it returns
+// heatsink.ErrThermoSensorClosed
+func (s *Sensor) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return heatsink.ErrThermoSensorClosed
+	}
+	s.closed = true
+	return nil
+}
+
+// Name returns the name of this sensor
+func (s *Sensor) Name() string {
+	return s.name
+}
@@ -0,0 +1,100 @@
+package wmisense
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/malkhamis/heatsink"
+)
+
+func TestNew_unsupported(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("wmi is supported on windows")
+	}
+	_, err := New("/intelcpu/0/temperature/0")
+	if !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", ErrUnsupported, err)
+	}
+}
+
+func TestNew_errors(t *testing.T) {
+
+	cases := map[string]struct {
+		identifier  string
+		output      string
+		queryErr    error
+		expectedErr error
+	}{
+		"empty identifier": {identifier: "", expectedErr: ErrBadIdentifier},
+		"quoted":           {identifier: "/cpu/0' OR '1'='1", expectedErr: ErrBadIdentifier},
+		"not found":        {identifier: "/cpu/0", output: "\r\n", expectedErr: ErrSensorNotFound},
+		"not temperature":  {identifier: "/cpu/0", output: "Load 12.5", expectedErr: ErrNotTemperature},
+		"bad output":       {identifier: "/cpu/0", output: "Temperature", expectedErr: ErrBadSensorOutput},
+		"bad value":        {identifier: "/cpu/0", output: "Temperature hot", expectedErr: ErrBadSensorOutput},
+		"query":            {identifier: "/cpu/0", queryErr: ErrUnsupported, expectedErr: ErrUnsupported},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			query := func(string, string) (string, error) { return c.output, c.queryErr }
+			_, err := newSensor(c.identifier, query)
+			if !errors.Is(err, c.expectedErr) {
+				t.Fatalf("unexpected error\nwant: %v\n got: %v", c.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestSensor_lifeCycle(t *testing.T) {
+
+	var queried []string
+	outputs := []string{"Temperature 40\r\n", "Temperature 42,5\r\n"}
+	query := func(namespace, identifier string) (string, error) {
+		queried = append(queried, namespace+" "+identifier)
+		output := outputs[0]
+		outputs = outputs[1:]
+		return output, nil
+	}
+
+	sensor, err := newSensor(
+		"/amdcpu/0/temperature/2",
+		query,
+		nil, // should be ignored
+		OptName("cpu"),
+		OptNamespace(NamespaceOpenHardwareMonitor),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sensor.Name() != "cpu" {
+		t.Fatalf("unexpected name\nwant: cpu\n got: %s", sensor.Name())
+	}
+
+	temp, err := sensor.Temperature()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if temp != 42.5 {
+		t.Fatalf("unexpected temperature\nwant: %v\n got: %v", 42.5, temp)
+	}
+	expected := []string{
+		`root\OpenHardwareMonitor /amdcpu/0/temperature/2`,
+		`root\OpenHardwareMonitor /amdcpu/0/temperature/2`,
+	}
+	if diff := deep.Equal(queried, expected); diff != nil {
+		t.Fatal(diff)
+	}
+
+	if err := sensor.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sensor.Temperature(); !errors.Is(err, heatsink.ErrThermoSensorClosed) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", heatsink.ErrThermoSensorClosed, err)
+	}
+	if err := sensor.Close(); !errors.Is(err, heatsink.ErrThermoSensorClosed) {
+		t.Fatalf("unexpected error\nwant: %v\n got: %v", heatsink.ErrThermoSensorClosed, err)
+	}
+}
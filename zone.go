@@ -0,0 +1,130 @@
+package heatsink
+
+import (
+	"fmt"
+)
+
+// ZoneMember is a heatsink whose temperature drives the fan of a zone, e.g. a chassis fan that
+// cools both the processor and the graphics card, through a fan response curve of its own
+type ZoneMember struct {
+	// Heatsink is the member, which keeps controlling its own fan
+	Heatsink *Heatsink
+	// MinTemperature and MaxTemperature are the range of the member's curve for the zone's fan.
+	// If both are zero, the range of the member itself is used
+	MinTemperature float64
+	MaxTemperature float64
+	// Response is the fan response curve of the member for the zone's fan
+	Response fanResponse
+	// Exponent is the exponent of the curve if Response is FanResponsePow
+	Exponent float64
+	// Midpoint and Steepness shape the curve if Response is FanResponseSigmoid. For details,
+	// see the documentation for OptFanResponseSigmoid
+	Midpoint  float64
+	Steepness float64
+}
+
+// NewZone returns a heatsink that drives the given fan, e.g. a chassis fan, at the highest duty
+// cycle derived from the temperatures of its members, each through the member's own curve, so
+// the case fan follows whichever component needs the most airflow. The temperature of a member
+// is that of its hottest sensor as of its last control iteration, which spares reading the
+// sensors twice. The zone does not own its members, which must be stopped separately. Once a
+// member stopped, reading it fails like a failed sensor, i.e. the first member is left out
+// while the others run the fan at full speed, as inputs do. Options apply on top of the first
+// member's curve and range, e.g. OptCriticalTemperature
+func NewZone(fan FanDriver, members []ZoneMember, options ...Option) (*Heatsink, error) {
+
+	if len(members) == 0 {
+		return nil, fmt.Errorf("invalid configuration: %w", ErrNoMembers)
+	}
+	inputs := make([]Input, len(members))
+	for i, m := range members {
+		if m.Heatsink == nil {
+			return nil, fmt.Errorf("invalid configuration: %w", ErrNilMember)
+		}
+		if m.MinTemperature == 0 && m.MaxTemperature == 0 {
+			m.MinTemperature, m.MaxTemperature = m.Heatsink.MinTemperature(), m.Heatsink.MaxTemperature()
+		}
+		if m.MinTemperature >= m.MaxTemperature {
+			return nil, fmt.Errorf(
+				"invalid configuration: member '%s': %w", m.Heatsink.Name(), ErrBadTemperatureRange,
+			)
+		}
+		inputs[i] = Input{
+			Name:           m.Heatsink.Name(),
+			Sensors:        []ThermoSensor{NewMemberSensor(m.Heatsink)},
+			MinTemperature: m.MinTemperature,
+			MaxTemperature: m.MaxTemperature,
+			Response:       m.Response,
+			Exponent:       m.Exponent,
+			Midpoint:       m.Midpoint,
+			Steepness:      m.Steepness,
+		}
+	}
+
+	first := inputs[0]
+	opts := []Option{optInputCurve(first)}
+	for _, in := range inputs[1:] {
+		opts = append(opts, OptInput(in))
+	}
+	config := &Config{
+		Fan:            fan,
+		Sensors:        first.Sensors,
+		MinTemperature: first.MinTemperature,
+		MaxTemperature: first.MaxTemperature,
+	}
+	return New(config, append(opts, options...)...)
+}
+
+// optInputCurve makes the fan response curve of the heatsink that of the given input
+func optInputCurve(in Input) Option {
+	return func(config *Config, hs *Heatsink) {
+		hs.response = in.Response
+		hs.curve = curveParams{exponent: in.Exponent, midpoint: in.Midpoint, steepness: in.Steepness}
+		hs.dcCalc = newDutyCycler(hs.response, hs.curve, config.MinTemperature, config.MaxTemperature)
+	}
+}
+
+// memberSensor reports the temperature of the hottest sensor of a heatsink
+type memberSensor struct {
+	member *Heatsink
+}
+
+// NewMemberSensor returns a sensor, named after the given heatsink, that reports the temperature
+// of its hottest sensor as of its last control iteration, or as read directly if there was none
+// yet. Reading it fails with an error wrapping ErrControllerStopped once the heatsink stopped.
+// Closing it leaves the heatsink alone
+func NewMemberSensor(member *Heatsink) ThermoSensor {
+	return &memberSensor{member: member}
+}
+
+// Temperature implements the ThermoSensor interface
+func (s *memberSensor) Temperature() (float64, error) {
+
+	if s.member.Stopped() {
+		return 0, fmt.Errorf("%w: heatsink '%s'", ErrControllerStopped, s.member.Name())
+	}
+	smpl := s.member.LastSample()
+	for _, r := range smpl.Readings {
+		if r.Sensor == smpl.Sensor {
+			return r.Temperature, nil
+		}
+	}
+
+	s.member.sensorMutex.Lock()
+	defer s.member.sensorMutex.Unlock()
+	temp, _, _, err := s.member.hottest(s.member.sensors)
+	if err != nil {
+		return 0, fmt.Errorf("heatsink '%s': %w", s.member.Name(), err)
+	}
+	return temp, nil
+}
+
+// Name implements the ThermoSensor interface
+func (s *memberSensor) Name() string {
+	return s.member.Name()
+}
+
+// Close implements the ThermoSensor interface
+func (s *memberSensor) Close() error {
+	return nil
+}
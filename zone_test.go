@@ -0,0 +1,131 @@
+package heatsink
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNewZone_invalid(t *testing.T) {
+	t.Parallel()
+
+	cpu, err := New(&Config{
+		Fan:            &fakeFanDriver{},
+		Sensors:        []ThermoSensor{&fakeThermoSensor{}},
+		MaxTemperature: 80,
+	}, OptName("cpu"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		members []ZoneMember
+		wantErr error
+	}{
+		{"no members", nil, ErrNoMembers},
+		{"nil member", []ZoneMember{{Heatsink: cpu}, {}}, ErrNilMember},
+		{"bad range", []ZoneMember{{Heatsink: cpu, MinTemperature: 50, MaxTemperature: 40}}, ErrBadTemperatureRange},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := NewZone(&fakeFanDriver{}, c.members)
+			if !errors.Is(err, c.wantErr) {
+				t.Errorf("unexpected error\nwant: %v\n got: %v", c.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestNewZone_curves(t *testing.T) {
+	t.Parallel()
+
+	newMember := func(name string) *Heatsink {
+		hs, err := New(&Config{
+			Fan:            &fakeFanDriver{},
+			Sensors:        []ThermoSensor{&fakeThermoSensor{}},
+			MinTemperature: 30,
+			MaxTemperature: 90,
+		}, OptName(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hs
+	}
+	cpu, gpu := newMember("cpu"), newMember("gpu")
+	cpu.recordSample(Sample{Time: time.Now(), Sensor: "core", Readings: []Reading{{"core", 60}}})
+	gpu.recordSample(Sample{Time: time.Now(), Sensor: "die", Readings: []Reading{{"die", 70}}})
+
+	zone, err := NewZone(&fakeFanDriver{}, []ZoneMember{
+		{Heatsink: cpu, MinTemperature: 40, MaxTemperature: 80, Response: FanResponseLinear},
+		{Heatsink: gpu, Response: FanResponseLinear},
+	}, OptName("case"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	temp, hottest, _, err := zone.maxCoreTemp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if temp != 60 || hottest != "cpu" {
+		t.Errorf("expected the cpu at 60, got: %s at %v", hottest, temp)
+	}
+	if dc := zone.dcCalc.ratio(temp); dc != 0.5 {
+		t.Errorf("expected the cpu curve to ask for 0.5, got: %v", dc)
+	}
+	// the gpu at 70 in the range of its own heatsink, i.e. [30, 90], asks for 2/3
+	dc, _ := zone.applyInputs(0.5, nil, &reason{})
+	if want := 40.0 / 60; dc != want {
+		t.Errorf("expected the gpu curve to raise the duty cycle to %v, got: %v", want, dc)
+	}
+}
+
+func TestMemberSensor_Temperature(t *testing.T) {
+	t.Parallel()
+
+	simulatedErr := errors.New("simulated error")
+	probe := &fakeThermoSensor{
+		onName:            "probe",
+		onTemperatureVals: []float64{45, 0},
+		onTemperatureErrs: []error{nil, simulatedErr},
+	}
+	member, err := New(&Config{
+		Fan:            &fakeFanDriver{},
+		Sensors:        []ThermoSensor{probe},
+		MaxTemperature: 80,
+	}, OptName("cpu"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sensor := NewMemberSensor(member)
+	if sensor.Name() != "cpu" {
+		t.Errorf("expected the sensor to be named after the heatsink, got: %s", sensor.Name())
+	}
+
+	// no sample yet, so the sensors of the member are read directly
+	if temp, err := sensor.Temperature(); err != nil || temp != 45 {
+		t.Errorf("expected 45 read directly, got: %v, %v", temp, err)
+	}
+	if _, err := sensor.Temperature(); !errors.Is(err, simulatedErr) {
+		t.Errorf("unexpected error\nwant: %v\n got: %v", simulatedErr, err)
+	}
+
+	member.recordSample(Sample{Sensor: "probe", Readings: []Reading{{"probe", 55}}})
+	if temp, err := sensor.Temperature(); err != nil || temp != 55 {
+		t.Errorf("expected 55 of the last sample, got: %v, %v", temp, err)
+	}
+
+	if err := sensor.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if probe.numCloseCalls != 0 {
+		t.Error("expected closing the sensor to leave the member's sensors alone")
+	}
+	member.StopThermalControl()
+	if _, err := sensor.Temperature(); !errors.Is(err, ErrControllerStopped) {
+		t.Errorf("unexpected error\nwant: %v\n got: %v", ErrControllerStopped, err)
+	}
+}